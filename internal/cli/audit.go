@@ -0,0 +1,63 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// openNetworkAuditLog returns an auditor which appends the requests made to
+// the repositories as lines of JSON to path, when it is set, and a function
+// which closes it.
+func openNetworkAuditLog(path string) (apk.NetworkAuditor, func() error, error) {
+	if path == "" {
+		return nil, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening network audit log: %w", err)
+	}
+	l := &jsonAuditLog{enc: json.NewEncoder(f)}
+	return l, func() error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return errors.Join(l.err, f.Close())
+	}, nil
+}
+
+// jsonAuditLog writes each request as a line of JSON. The first write which
+// fails stops the log, and is returned when it is closed.
+type jsonAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func (l *jsonAuditLog) Audit(ev apk.NetworkEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	if err := l.enc.Encode(ev); err != nil {
+		l.err = fmt.Errorf("writing network audit log: %w", err)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestNetworkAuditLogWriteError(t *testing.T) {
+	if _, err := os.Stat("/dev/full"); err != nil {
+		t.Skip("no /dev/full")
+	}
+	auditor, closeLog, err := openNetworkAuditLog("/dev/full")
+	require.NoError(t, err)
+	auditor.Audit(apk.NetworkEvent{URL: "https://example.com/os/x86_64/APKINDEX.tar.gz"})
+	auditor.Audit(apk.NetworkEvent{URL: "https://example.com/os/x86_64/busybox-1.36.1-r0.apk"})
+	require.ErrorContains(t, closeLog(), "writing network audit log")
+}
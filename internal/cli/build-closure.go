@@ -0,0 +1,78 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+)
+
+// BuildClosureCmd builds the root filesystem and writes the files programs
+// need to run, and the files matching the globs of paths, to dest, or to the
+// standard output for "-", as a tarball. Without programs, the program of
+// the entrypoint, or else of the cmd, of the image is used.
+func BuildClosureCmd(ctx context.Context, dest string, programs, paths []string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	fs := apkfs.DirFS(ctx, wd, apkfs.WithCreateDir())
+	bc, err := build.New(ctx, fs, opts...)
+	if err != nil {
+		return err
+	}
+
+	ic := bc.ImageConfiguration()
+
+	if len(ic.Archs) != 0 {
+		log.Infof("building the closure for %s only", bc.Arch())
+	}
+
+	_, layer, err := bc.BuildLayer(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build layer image: %w", err)
+	}
+	files, err := bc.Closure(ctx, programs, paths)
+	if err != nil {
+		return err
+	}
+	log.Infof("writing the %d files of the closure to %s", len(files), dest)
+
+	out := os.Stdout
+	if dest != stdoutPath {
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := build.WriteClosure(layer, files, out); err != nil {
+		return err
+	}
+	if dest != stdoutPath {
+		return out.Close()
+	}
+	return nil
+}
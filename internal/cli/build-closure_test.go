@@ -0,0 +1,43 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBuildClosure(t *testing.T) {
+	ctx := context.Background()
+	output := filepath.Join(t.TempDir(), "closure.tar")
+
+	config := filepath.Join("testdata", "apko.yaml")
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithArch(types.ParseArchitecture("amd64"))}
+
+	// The packages of the configuration have no programs, so the shell of
+	// its entrypoint cannot run.
+	err := cli.BuildClosureCmd(ctx, output, nil, nil, opts...)
+	require.ErrorContains(t, err, "the x86_64 image cannot run /bin/sh:\n  /bin/sh: file does not exist")
+	_, err = os.Stat(output)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -38,16 +40,30 @@ func buildCPIO() *cobra.Command {
 	var extraBuildRepos []string
 	var extraRuntimeRepos []string
 	var extraPackages []string
+	var compression string
 
 	cmd := &cobra.Command{
 		Use:     "build-cpio",
-		Short:   "Build a cpio file from a YAML configuration file",
-		Long:    "Build a cpio file from a YAML configuration file",
-		Example: `  apko build-cpio <config.yaml> <output.cpio>`,
-		Hidden:  true,
-		Args:    cobra.ExactArgs(2),
+		Aliases: []string{"build-initramfs"},
+		Short:   "Build a cpio initramfs from a YAML configuration file",
+		Long: `Build a cpio initramfs from a YAML configuration file
+
+The root filesystem is packed as a newc cpio archive, which the kernel
+unpacks as an initramfs. Files are written in a reproducible order with
+their ownership and timestamps, and the archive is compressed as named by
+--compression, or by the extension of the output (.gz or .zst) by default.`,
+		Example: `  apko build-cpio <config.yaml> <output.cpio>
+  apko build-cpio <config.yaml> initramfs.cpio.zst
+  apko build-cpio --compression gzip <config.yaml> - > initramfs.cpio.gz`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return BuildCPIOCmd(cmd.Context(), args[1],
+			if compression == "" {
+				compression = cpio.CompressionFor(args[1])
+			}
+			if !slices.Contains(cpio.Compressions, compression) {
+				return fmt.Errorf("unsupported compression %q, must be one of: %s", compression, strings.Join(cpio.Compressions, ", "))
+			}
+			return BuildCPIOCmd(cmd.Context(), args[1], compression,
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
@@ -67,11 +83,14 @@ func buildCPIO() *cobra.Command {
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringVar(&compression, "compression", "", "compression of the archive: none, gzip or zstd (default from the extension of the output)")
 
 	return cmd
 }
 
-func BuildCPIOCmd(ctx context.Context, dest string, opts ...build.Option) error {
+// BuildCPIOCmd builds the root filesystem and writes it to dest, or to the
+// standard output for "-", as a cpio archive compressed with compression.
+func BuildCPIOCmd(ctx context.Context, dest, compression string, opts ...build.Option) error {
 	log := clog.FromContext(ctx)
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
@@ -97,16 +116,28 @@ func BuildCPIOCmd(ctx context.Context, dest string, opts ...build.Option) error
 	}
 	log.Debugf("converting layer to cpio %s", dest)
 
-	// Create the CPIO file, and set up a deduplicating writer
-	// to produce the gzip-compressed CPIO archive.
-	f, err := os.Create(dest)
+	out := os.Stdout
+	if dest != stdoutPath {
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	cw, err := cpio.NewWriter(out, compression)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	// TODO(mattmoor): Consider wrapping in a gzip writer if the filename
-	// ends in .gz
-
-	return cpio.FromLayer(layer, f)
+	if err := cpio.FromLayer(ctx, layer, cw); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return fmt.Errorf("compressing %s: %w", dest, err)
+	}
+	if dest != stdoutPath {
+		return out.Close()
+	}
+	return nil
 }
@@ -0,0 +1,70 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/u-root/u-root/pkg/cpio"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	apkocpio "chainguard.dev/apko/pkg/cpio"
+)
+
+func TestBuildCPIO(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	output := filepath.Join(tmp, "initramfs.cpio.zst")
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithArch(types.ParseArchitecture("amd64"))}
+
+	require.NoError(t, cli.BuildCPIOCmd(ctx, output, apkocpio.CompressionFor(output), opts...))
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	require.NoError(t, err)
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+
+	records, err := cpio.ReadAllRecords(cpio.Newc.Reader(bytes.NewReader(data)))
+	require.NoError(t, err)
+	var names []string
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+	require.Contains(t, names, "etc/apko.json")
+
+	// Building again gives the same archive.
+	again := filepath.Join(tmp, "again.cpio.zst")
+	require.NoError(t, cli.BuildCPIOCmd(ctx, again, apkocpio.CompressionZstd, opts...))
+	want, err := os.ReadFile(output)
+	require.NoError(t, err)
+	got, err := os.ReadFile(again)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
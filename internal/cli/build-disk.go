@@ -0,0 +1,65 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/diskimage"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+// BuildDiskCmd builds the root filesystem and writes it to dest as a
+// filesystem image of format, which virtual machines can boot from.
+func BuildDiskCmd(ctx context.Context, dest, format string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+	if dest == stdoutPath {
+		return errors.New("filesystem images cannot be written to stdout")
+	}
+	// The root filesystem is built in memory, as for images, so that the
+	// times of its files are those of the build date.
+	bc, err := build.New(ctx, tarfs.New(), opts...)
+	if err != nil {
+		return err
+	}
+
+	ic := bc.ImageConfiguration()
+
+	if len(ic.Archs) != 0 {
+		log.Infof("building the %s filesystem image for %s only", format, bc.Arch())
+	}
+
+	_, layer, err := bc.BuildLayer(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to build layer image: %w", err)
+	}
+	log.Debugf("converting layer to %s image %s", format, dest)
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := diskimage.FromLayer(layer, format, f); err != nil {
+		return fmt.Errorf("writing %s: %w", dest, err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,66 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/diskimage"
+)
+
+func TestBuildDisk(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithArch(types.ParseArchitecture("amd64"))}
+
+	output := filepath.Join(tmp, "rootfs.ext4")
+	require.NoError(t, cli.BuildDiskCmd(ctx, output, diskimage.FormatExt4, opts...))
+	want, err := os.ReadFile(output)
+	require.NoError(t, err)
+	require.Equal(t, uint16(0xef53), binary.LittleEndian.Uint16(want[1024+56:]))
+
+	if debugfs, err := exec.LookPath("debugfs"); err == nil {
+		out, err := exec.Command(debugfs, "-R", "cat /etc/apko.json", output).Output()
+		require.NoError(t, err)
+		require.Contains(t, string(out), "contents")
+	}
+
+	// Building again gives the same image.
+	again := filepath.Join(tmp, "again.ext4")
+	require.NoError(t, cli.BuildDiskCmd(ctx, again, diskimage.FormatExt4, opts...))
+	got, err := os.ReadFile(again)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	erofs := filepath.Join(tmp, "rootfs.erofs")
+	require.NoError(t, cli.BuildDiskCmd(ctx, erofs, diskimage.FormatErofs, opts...))
+	b, err := os.ReadFile(erofs)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0xe0f5e1e2), binary.LittleEndian.Uint32(b[1024:]))
+
+	require.ErrorContains(t, cli.BuildDiskCmd(ctx, "-", diskimage.FormatErofs, opts...), "cannot be written to stdout")
+}
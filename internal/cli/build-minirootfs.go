@@ -18,12 +18,14 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
 
 	"github.com/spf13/cobra"
 
 	"github.com/chainguard-dev/clog"
 
+	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/tarfs"
@@ -34,30 +36,66 @@ func buildMinirootFS() *cobra.Command {
 	var buildArch string
 	var sbomPath string
 	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var verifyPackageSignatures bool
+	var synthesizeLocalIndexes bool
+	var progress string
 	var extraKeys []string
 	var extraBuildRepos []string
 	var extraRuntimeRepos []string
 	var extraPackages []string
+	var cacheDir string
+	var buildArgs []string
 
 	cmd := &cobra.Command{
-		Use:     "build-minirootfs",
-		Short:   "Build a minirootfs image from a YAML configuration file",
-		Long:    "Build a minirootfs image from a YAML configuration file",
-		Example: `  apko build-minirootfs <config.yaml> <output.tar.gz>`,
-		Args:    cobra.ExactArgs(2),
+		Use:   "build-minirootfs",
+		Short: "Build a minirootfs image from a YAML configuration file",
+		Long:  "Build a minirootfs image from a YAML configuration file",
+		Example: `  apko build-minirootfs <config.yaml> <output.tar.gz>
+  apko build-minirootfs <config.yaml> - | tar -tzf -`,
+		Args: cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return BuildMinirootFSCmd(cmd.Context(),
+			reporter, endProgress, err := progressReporter(progress, os.Stderr)
+			if err != nil {
+				return err
+			}
+			defer endProgress()
+
+			// build aside and copy the tarball over when writing to stdout
+			output := args[1]
+			if output == stdoutPath {
+				tmp, err := os.MkdirTemp("", "apko-minirootfs-*")
+				if err != nil {
+					return err
+				}
+				defer os.RemoveAll(tmp)
+				output = filepath.Join(tmp, "minirootfs.tar.gz")
+			}
+
+			if err := BuildMinirootFSCmd(cmd.Context(),
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRuntimeRepos(extraRuntimeRepos),
 				build.WithExtraPackages(extraPackages),
-				build.WithTarball(args[1]),
+				build.WithTarball(output),
 				build.WithBuildDate(buildDate),
 				build.WithSBOM(sbomPath),
 				build.WithArch(types.ParseArchitecture(buildArch)),
 				build.WithIgnoreSignatures(ignoreSignatures),
-			)
+				build.WithUnsignedRepositories(unsignedRepos),
+				build.WithVerifyPackageSignatures(verifyPackageSignatures),
+				build.WithLocalIndexSynthesis(synthesizeLocalIndexes),
+				build.WithProgressReporter(reporter),
+				build.WithCache(cacheDir, false, apk.NewCache(true)),
+				buildArgsOption(buildArgs),
+			); err != nil {
+				return err
+			}
+			if args[1] == stdoutPath {
+				return copyToStdout(output)
+			}
+			return nil
 		},
 	}
 
@@ -65,10 +103,17 @@ func buildMinirootFS() *cobra.Command {
 	cmd.Flags().StringVar(&buildArch, "build-arch", runtime.GOARCH, "architecture to build for -- default is Go runtime architecture")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate an SBOM")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().BoolVar(&verifyPackageSignatures, "verify-package-signatures", false, "verify the signature of every installed package against the keyring, like apk --verify")
+	cmd.Flags().BoolVar(&synthesizeLocalIndexes, "synthesize-local-indexes", false, "synthesize an unsigned index for a local repository from its packages when it has none, or one older than any of them")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().StringVar(&progress, "progress", "auto", "how to report the progress of installing packages on stderr: auto (tty when stderr is a terminal), tty, json (one event per line, for CI) or none")
 
 	return cmd
 }
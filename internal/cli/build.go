@@ -18,36 +18,58 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"os"
-	"path/filepath"
 	"slices"
-	"sync"
+	"strings"
+	"time"
 
-	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/spf13/cobra"
-	"go.opentelemetry.io/otel"
-	"golang.org/x/sync/errgroup"
-	"golang.org/x/sys/unix"
-
-	"github.com/chainguard-dev/clog"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build"
-	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+	"chainguard.dev/apko/pkg/diskimage"
 	"chainguard.dev/apko/pkg/sbom"
-	"chainguard.dev/apko/pkg/tarfs"
 )
 
+// The outputs of apko build: an image, a tarball of the closure of some of
+// its programs, or its root filesystem as a filesystem image of the format
+// after diskOutputPrefix.
+const (
+	ociOutput        = "oci"
+	closureOutput    = "closure"
+	diskOutputPrefix = "disk:"
+)
+
+// parseOutput returns the format of the filesystem image an output of
+// apko build names, or "" for another output.
+func parseOutput(output string) (string, error) {
+	if output == ociOutput || output == closureOutput {
+		return "", nil
+	}
+	if format, ok := strings.CutPrefix(output, diskOutputPrefix); ok && slices.Contains(diskimage.Formats, format) {
+		return format, nil
+	}
+	outputs := []string{ociOutput, closureOutput}
+	for _, format := range diskimage.Formats {
+		outputs = append(outputs, diskOutputPrefix+format)
+	}
+	return "", fmt.Errorf("unsupported output %q, must be one of: %s", output, strings.Join(outputs, ", "))
+}
+
 func buildCmd() *cobra.Command {
 	var withVCS bool
+	var vcsPath string
+	var vcsTagPrefix string
 	var buildDate string
 	var archstrs []string
 	var writeSBOM bool
 	var sbomPath string
 	var sbomFormats []string
+	var sbomFiles bool
+	var vexFiles []string
+	var sbomAttestationKey string
 	var extraKeys []string
 	var extraBuildRepos []string
 	var extraRuntimeRepos []string
@@ -56,8 +78,36 @@ func buildCmd() *cobra.Command {
 	var cacheDir string
 	var offline bool
 	var lockfile string
+	var locked bool
+	var frozen bool
 	var includePaths []string
 	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var verifyPackageSignatures bool
+	var synthesizeLocalIndexes bool
+	var checkEntrypoint bool
+	var policies []string
+	var triggers []string
+	var recordTriggers, firstBootTriggers bool
+	var buildArgs []string
+	var progress string
+	var dryRun bool
+	var buildReport string
+	var fetchTimeout, resolveTimeout time.Duration
+	var retry retryFlags
+	var permissions permissionsFlags
+	var scanning scanFlags
+	var maxDownloads int
+	var bandwidthLimit int64
+	var networkAuditLog string
+	var bundlePath string
+	var all bool
+	var jobs int
+	var outputType string
+	var closurePrograms, closurePaths []string
+	var watch bool
+	var variant string
+	var debug debugFlags
 
 	cmd := &cobra.Command{
 		Use:   "build",
@@ -70,16 +120,188 @@ command, e.g.
   # docker load < output.tar
 
 Along the image, apko will generate SBOMs (software bill of materials) describing the image contents.
+
+With --dry-run, apko resolves the packages and verifies the keyring and
+repositories as a build would, prints the packages, their sizes, the layers
+and the files it would create outside packages, and writes nothing. The tag
+and output path are then optional.
+
+With --all, apko builds every configuration file of a directory, or every
+image listed by a manifest, in one process sharing the fetched indexes and
+packages. Each image is tagged <repository>/<name>:latest, where the name is
+the configuration file name without its extension, and written to
+<output-dir>/<name>.tar, with its SBOMs in <output-dir>/<name>/. A manifest
+lists the images, relative to the manifest, optionally with their name and
+tag:
+
+  images:
+    - config: nginx.apko.yaml
+    - config: base/python.apko.yaml
+      name: python-3.12
+      tag: registry.example.com/python:3.12
+
+With --debug-image, apko also builds a debug image of the same packages plus
+the --debug-packages, running a login shell and with a writable /tmp, or as
+described by the debug variant of the configuration if it has one. It is
+tagged with the tag followed by -debug, and written next to the image, e.g.
+to image-debug.tar, with its SBOMs next to those of the image, e.g.
+sbom-x86_64-debug.spdx.json.
+
+With --watch, apko builds the image, then watches the configuration, the
+files it includes, the lockfile and the local repositories, and rebuilds the
+image whenever they change, printing the digest of each build, until it is
+interrupted.
+
+With --output disk:ext4 or disk:erofs, apko writes the root filesystem of
+one architecture to the output path as an ext4 or erofs filesystem image,
+instead of an image, for virtual machines like firecracker or
+cloud-hypervisor to boot from as a block device. The filesystem image is
+reproducible: its inodes are numbered and its data laid out in the order of
+the paths, and its identifier is derived from its contents.
+
+With --output closure, apko writes a tarball of only the files of one
+architecture which the programs named by --closure-program, by default the
+program of the entrypoint or else of the cmd, need to run: the programs, the
+interpreters of scripts, the ELF interpreters and shared libraries of
+binaries, the symlinks leading to them, the configuration files they may read
+(accounts, name resolution, the dynamic linker search paths and
+certificates), the license files of their packages, and the --closure-path
+globs, for bundles as minimal as an image built from scratch.
 `,
-		Example: `  apko build <config.yaml> <tag> <output.tar|oci-layout-dir/>`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) != 3 {
-				return fmt.Errorf("requires 3 arg: 1 config file, a tag for the image, and an output path")
+		Example: `  apko build <config.yaml> <tag> <output.tar|oci-layout-dir/>
+  apko build <config.yaml> <tag> - | crane push - <tag>
+  apko build --dry-run <config.yaml>
+  apko build --variant debug <config.yaml> <tag> <output.tar|oci-layout-dir/>
+  apko build --debug-image <config.yaml> <tag> <output.tar|oci-layout-dir/>
+  apko build --all <config-dir/|manifest.yaml> <repository> <output-dir/>
+  apko build --watch <config.yaml> <tag> <output.tar|oci-layout-dir/>
+  apko build --output disk:ext4 --arch x86_64 <config.yaml> <tag> <rootfs.ext4>
+  apko build --output closure --closure-program /usr/bin/app <config.yaml> <tag> <app.tar>`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			auditor, closeAuditLog, err := openNetworkAuditLog(networkAuditLog)
+			if err != nil {
+				return err
 			}
+			defer func() { err = errors.Join(err, closeAuditLog()) }()
 
+			if debug.image {
+				for _, name := range []string{"dry-run", "all", "watch"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s cannot be used with --debug-image", name)
+					}
+				}
+			}
+			if watch {
+				for _, name := range []string{"dry-run", "all", "bundle"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s cannot be used with --watch", name)
+					}
+				}
+			}
+			diskFormat, err := parseOutput(outputType)
+			if err != nil {
+				return err
+			}
+			if outputType != ociOutput {
+				for _, name := range []string{"dry-run", "all", "watch", "debug-image"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s cannot be used with --output %s", name, outputType)
+					}
+				}
+			}
+			if outputType != closureOutput {
+				for _, name := range []string{"closure-program", "closure-path"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s can only be used with --output %s", name, closureOutput)
+					}
+				}
+			}
+			policyOpt, err := policyOption(cmd.Context(), policies)
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				if bundlePath != "" {
+					return errors.New("--dry-run cannot be used with --bundle")
+				}
+				if all {
+					return errors.New("--dry-run cannot be used with --all")
+				}
+				if len(args) < 1 || len(args) > 3 {
+					return fmt.Errorf("requires 1 to 3 args: 1 config file, and optionally a tag for the image and an output path")
+				}
+				archs := types.ParseArchitectures(archstrs)
+				return DryRunCmd(cmd.Context(), cmd.OutOrStdout(), archs,
+					build.WithConfig(args[0], includePaths),
+					build.WithExtraKeys(extraKeys),
+					build.WithExtraBuildRepos(extraBuildRepos),
+					build.WithExtraRuntimeRepos(extraRuntimeRepos),
+					build.WithExtraPackages(extraPackages),
+					build.WithCache(cacheDir, offline, apk.NewCache(true)),
+					build.WithLockFile(lockfile),
+					build.WithLocked(locked, frozen),
+					build.WithIncludePaths(includePaths),
+					build.WithIgnoreSignatures(ignoreSignatures),
+					build.WithUnsignedRepositories(unsignedRepos),
+					buildArgsOption(buildArgs),
+					build.WithVariant(variant),
+					policyOpt,
+					build.WithFetchTimeout(fetchTimeout),
+					build.WithResolveTimeout(resolveTimeout),
+					withRetryPolicy(retry.retryPolicy(cmd)),
+					build.WithMaxConcurrentDownloads(maxDownloads),
+					build.WithBandwidthLimit(bandwidthLimit),
+					build.WithNetworkAuditor(auditor),
+				)
+			}
 			// TODO(kaniini): Print warning when multi-arch build is requested
 			// and ignored by the build system.
 			archs := types.ParseArchitectures(archstrs)
+
+			var source []build.Option
+			if all {
+				if len(args) != 3 {
+					return fmt.Errorf("requires 3 args with --all: a directory of config files or a manifest listing them, a repository for the images, and an output directory")
+				}
+				for _, name := range []string{"bundle", "lockfile", "locked", "frozen"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s cannot be used with --all", name)
+					}
+				}
+				// The builds share the cache, so each index is only fetched once.
+				source = []build.Option{build.WithCache(cacheDir, offline, apk.NewCache(true))}
+			} else if bundlePath != "" {
+				if len(args) != 2 {
+					return fmt.Errorf("requires 2 args with --bundle: a tag for the image, and an output path")
+				}
+				for _, name := range []string{"keyring-append", "build-repository-append", "repository-append", "package-append", "cache-dir", "offline", "lockfile", "frozen", "include-paths", "build-arg", "variant", "debug-image"} {
+					if cmd.Flags().Changed(name) {
+						return fmt.Errorf("--%s cannot be used with --bundle", name)
+					}
+				}
+				opts, ic, cleanup, err := openBundle(bundlePath)
+				if err != nil {
+					return err
+				}
+				defer cleanup()
+				for _, arch := range archs {
+					if !slices.Contains(ic.Archs, arch) {
+						return fmt.Errorf("bundle %s has no packages for %s", bundlePath, arch)
+					}
+				}
+				source = append(opts, build.WithLocked(locked, true))
+			} else {
+				if len(args) != 3 {
+					return fmt.Errorf("requires 3 arg: 1 config file, a tag for the image, and an output path")
+				}
+				source = []build.Option{
+					build.WithConfig(args[0], includePaths),
+					build.WithCache(cacheDir, offline, apk.NewCache(true)),
+					build.WithLockFile(lockfile),
+					build.WithLocked(locked, frozen),
+				}
+			}
+			tag, output := args[len(args)-2], args[len(args)-1]
 			annotations, err := parseAnnotations(rawAnnotations)
 			if err != nil {
 				return fmt.Errorf("parsing annotations from command line: %w", err)
@@ -88,6 +310,10 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 			if !writeSBOM {
 				sbomFormats = []string{}
 			}
+			scanOption, err := scanning.scanOption(writeSBOM)
+			if err != nil {
+				return err
+			}
 
 			tmp, err := os.MkdirTemp(os.TempDir(), "apko-temp-*")
 			if err != nil {
@@ -95,37 +321,111 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 			}
 			defer os.RemoveAll(tmp)
 
-			return BuildCmd(cmd.Context(), args[1], args[2], archs,
-				[]string{args[1]},
-				writeSBOM,
-				sbomPath,
-				build.WithConfig(args[0], includePaths),
+			reporter, endProgress, err := progressReporter(progress, os.Stderr)
+			if err != nil {
+				return err
+			}
+			defer endProgress()
+
+			// SBOMs bound for stdout are generated in the work directory
+			sbomDir := sbomPath
+			if sbomDir == stdoutPath {
+				sbomDir = ""
+			}
+
+			normalizations, writeReport := startBuildReport(buildReport)
+			opts := append(source,
 				build.WithBuildDate(buildDate),
-				build.WithSBOM(sbomPath),
-				build.WithSBOMFormats(sbomFormats),
+				build.WithSBOM(sbomDir),
+				sbomFormatsOption(cmd, sbomFormats),
+				build.WithSBOMFiles(sbomFiles),
+				build.WithVEX(vexFiles),
+				build.WithSBOMAttestationKey(sbomAttestationKey),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRuntimeRepos(extraRuntimeRepos),
 				build.WithExtraPackages(extraPackages),
-				build.WithTags(args[1]),
+				build.WithTags(tag),
 				build.WithVCS(withVCS),
+				build.WithVCSPath(vcsPath),
+				build.WithVCSTagPrefix(vcsTagPrefix),
 				build.WithAnnotations(annotations),
-				build.WithCache(cacheDir, offline, apk.NewCache(true)),
-				build.WithLockFile(lockfile),
 				build.WithTempDir(tmp),
 				build.WithIncludePaths(includePaths),
 				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithUnsignedRepositories(unsignedRepos),
+				build.WithVerifyPackageSignatures(verifyPackageSignatures),
+				build.WithLocalIndexSynthesis(synthesizeLocalIndexes),
+				build.WithCheckEntrypoint(checkEntrypoint),
+				build.WithPermissionsPolicy(permissions.permissionsPolicy()),
+				normalizations,
+				build.WithBaseDirectoryPolicy(permissions.baseDirectoryPolicy()),
+				policyOpt,
+				build.WithTriggers(triggers),
+				build.WithRecordTriggers(recordTriggers, firstBootTriggers),
+				scanOption,
+				buildArgsOption(buildArgs),
+				build.WithVariant(variant),
+				build.WithProgressReporter(reporter),
+				build.WithFetchTimeout(fetchTimeout),
+				build.WithResolveTimeout(resolveTimeout),
+				withRetryPolicy(retry.retryPolicy(cmd)),
+				build.WithMaxConcurrentDownloads(maxDownloads),
+				build.WithBandwidthLimit(bandwidthLimit),
+				build.WithNetworkAuditor(auditor),
 			)
+			if all {
+				images, err := ListImageConfigs(args[0], args[1])
+				if err != nil {
+					return err
+				}
+				err = BuildAllCmd(cmd.Context(), images, args[2], archs, writeSBOM, sbomPath, jobs, includePaths, opts...)
+				return errors.Join(err, writeReport(cmd.Context()))
+			}
+			if watch {
+				if output == stdoutPath || sbomPath == stdoutPath {
+					return errors.New("--watch cannot write to stdout")
+				}
+				err = WatchCmd(cmd.Context(), cmd.OutOrStdout(), tag, output, archs, []string{tag}, sbomPath, opts...)
+				return errors.Join(err, writeReport(cmd.Context()))
+			}
+			if outputType != ociOutput {
+				if len(archs) > 1 {
+					return fmt.Errorf("--output %s builds a single architecture, not %d", outputType, len(archs))
+				}
+				if len(archs) == 1 {
+					opts = append(opts, build.WithArch(archs[0]))
+				}
+				if diskFormat != "" {
+					err = BuildDiskCmd(cmd.Context(), output, diskFormat, opts...)
+				} else {
+					err = BuildClosureCmd(cmd.Context(), output, closurePrograms, closurePaths, opts...)
+				}
+				return errors.Join(err, writeReport(cmd.Context()))
+			}
+			if debug.image && (output == stdoutPath || sbomPath == stdoutPath) {
+				return errors.New("--debug-image cannot write to stdout")
+			}
+			err = BuildCmd(cmd.Context(), tag, output, archs, []string{tag}, writeSBOM, sbomPath, opts...)
+			if err == nil && debug.image {
+				err = BuildDebugCmd(cmd.Context(), tag, output, archs, []string{tag}, writeSBOM, sbomPath, debug.packages, opts...)
+			}
+			return errors.Join(err, writeReport(cmd.Context()))
 		},
 	}
 
 	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
+	cmd.Flags().StringVar(&vcsPath, "vcs-path", "", "path in the git repository to detect VCS URLs from, instead of the directory of the config")
+	cmd.Flags().StringVar(&vcsTagPrefix, "vcs-tag-prefix", "", "prefix of the git tags the image version is detected from, e.g. foo/ for tags like foo/v1.2.3")
 	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image in RFC3339 format")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate SBOMs")
-	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate SBOMs in dir (defaults to image directory)")
+	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate SBOMs in dir (defaults to image directory), or write them one after the other to stdout with -")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
-	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", sbom.DefaultOptions.Formats, "SBOM formats to output")
+	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", sbom.DefaultOptions.Formats, "SBOM formats to output (spdx, cyclonedx), overriding sbom-formats in the config")
+	cmd.Flags().BoolVar(&sbomFiles, "sbom-files", false, "list the files installed by each package, with their sha256 checksums, in the image SBOMs (makes them much larger)")
+	cmd.Flags().StringSliceVar(&vexFiles, "vex", []string{}, "OpenVEX documents whose statements to bind to the image and write along the SBOMs")
+	cmd.Flags().StringVar(&sbomAttestationKey, "sbom-attestation-key", "", "PEM private key to sign the SBOMs and VEX documents with, writing each as an in-toto attestation in a DSSE envelope next to it")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
@@ -134,239 +434,57 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
 	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append.")
+	cmd.Flags().BoolVar(&locked, "locked", false, "require a lockfile, and fail with the list of deviations if any package, index or key is not exactly described by it")
+	cmd.Flags().BoolVar(&frozen, "frozen", false, "like --locked, and do not use the network: the packages, indexes and keys must be in the cache")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().BoolVar(&verifyPackageSignatures, "verify-package-signatures", false, "verify the signature of every installed package against the keyring, like apk --verify")
+	cmd.Flags().BoolVar(&synthesizeLocalIndexes, "synthesize-local-indexes", false, "synthesize an unsigned index for a local repository from its packages when it has none, or one older than any of them")
+	cmd.Flags().BoolVar(&checkEntrypoint, "check-entrypoint", false, "fail the build if the program of the entrypoint (or cmd), its ELF interpreter or the shared libraries it needs are missing from the image")
+	cmd.Flags().StringSliceVar(&policies, "policy", []string{}, "Rego policies, files or directories of them, to evaluate against the plan of the build before installing anything; their deny rules fail the build and their warn rules are logged")
+	cmd.Flags().StringSliceVar(&triggers, "triggers", []string{}, "packages whose triggers to run in the image after installing the packages, through qemu-user for an architecture the host cannot run (Linux only)")
+	cmd.Flags().BoolVar(&recordTriggers, "record-triggers", false, "record the triggers of the installed packages which are not run in /usr/lib/apko/triggers.json")
+	cmd.Flags().BoolVar(&firstBootTriggers, "first-boot-triggers", false, "record the triggers which are not run, with their scripts and /usr/lib/apko/run-triggers, a script running them once when the image starts")
+	cmd.Flags().StringVar(&variant, "variant", "", "name of the variant of the configuration to build, one of those under its variants (e.g. debug)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "resolve the packages and verify the keyring and repositories, print what would be installed and written, and write nothing")
+	cmd.Flags().StringVar(&buildReport, "build-report", "", "write the time spent in each phase of the build, and on each package, and the files whose ownership or permissions were normalized, to this file as JSON")
+	cmd.Flags().DurationVar(&fetchTimeout, "fetch-timeout", 0, "fail the build if fetching the keys of a repository, the indexes or a package takes longer than this (e.g. 5m, default 0 means no timeout)")
+	cmd.Flags().DurationVar(&resolveTimeout, "resolve-timeout", 0, "fail the build if resolving the packages of an architecture takes longer than this (default 0 means no timeout)")
+	retry.addFlags(cmd)
+	permissions.addFlags(cmd)
+	scanning.addFlags(cmd)
+	debug.addFlags(cmd)
+	cmd.Flags().IntVar(&maxDownloads, "max-concurrent-downloads", 0, "maximum number of packages, indexes and keys to download at the same time (default 0 means no limit)")
+	cmd.Flags().StringVar(&outputType, "output", ociOutput, "what to write to the output path: oci for an image, closure for a tarball of only the files some programs need to run, or disk:ext4 or disk:erofs for a filesystem image of the root filesystem of one architecture, which virtual machines can boot from")
+	cmd.Flags().StringSliceVar(&closurePrograms, "closure-program", []string{}, "with --output closure, the programs to keep with the files they need (default is the program of the entrypoint, or else of the cmd)")
+	cmd.Flags().StringSliceVar(&closurePaths, "closure-path", []string{}, "with --output closure, globs of extra paths to keep, with everything below the directories they match")
+	cmd.Flags().BoolVar(&all, "all", false, "build every config file of a directory, or every image listed by a manifest, sharing the fetched indexes and packages")
+	cmd.Flags().BoolVar(&watch, "watch", false, "rebuild the image whenever the configuration, the files it includes, the lockfile or the local repositories change, printing the digest of each build")
+	cmd.Flags().IntVar(&jobs, "jobs", 4, "with --all, the number of images to build at the same time")
+	cmd.Flags().StringVar(&bundlePath, "bundle", "", "build from a bundle written by \"apko bundle export\", without network access, instead of a config file")
+	cmd.Flags().StringVar(&networkAuditLog, "network-audit-log", "", "append every request made to the repositories and registries, with its status, size and digest, to this file as JSON lines")
+	cmd.Flags().Int64Var(&bandwidthLimit, "bandwidth-limit", 0, "maximum total bandwidth of the downloads, in bytes per second (default 0 means no limit)")
+	cmd.Flags().StringVar(&progress, "progress", "auto", "how to report the progress of installing packages on stderr: auto (tty when stderr is a terminal), tty, json (one event per line, for CI) or none")
 	return cmd
 }
 
-func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, opts ...build.Option) error {
-	log := clog.FromContext(ctx)
-	wd, err := os.MkdirTemp("", "apko-*")
-	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
-	}
-	defer os.RemoveAll(wd)
-
-	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, opts...)
-	if err != nil {
-		return err
-	}
-
-	if fi, err := os.Stat(output); err == nil && fi.IsDir() {
-		// bundle the parts of the image into a tarball
-		if _, err := layout.Write(output, idx); err != nil {
-			return fmt.Errorf("writing image layout: %w", err)
-		}
-		log.Debugf("Final image layout at: %s", output)
-	} else {
-		// bundle the parts of the image into a tarball
-		if _, err := oci.BuildIndex(output, idx, append([]string{imageRef}, tags...)); err != nil {
-			return fmt.Errorf("bundling image: %w", err)
-		}
-		log.Debugf("Final index tgz at: %s", output)
-	}
-
-	// copy sboms over to the sbomPath target directory
-	for _, sbom := range sboms {
-		// because os.Rename fails across partitions, we do our own
-		if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
-			return fmt.Errorf("moving sbom: %w", err)
-		}
-	}
-	return nil
-}
-
-// buildImage build all of the components of an image in a single working directory.
-// Each layer is a separate file, as are config, manifests, index and sbom.
-func buildImageComponents(ctx context.Context, workDir string, archs []types.Architecture, opts ...build.Option) (idx v1.ImageIndex, sboms []types.SBOM, err error) {
-	log := clog.FromContext(ctx)
-	ctx, span := otel.Tracer("apko").Start(ctx, "buildImageComponents")
-	defer span.End()
-
-	o, ic, err := build.NewOptions(opts...)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
-		return nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
-	}
-
-	// cases:
-	// - archs set: use those archs
-	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
-	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
-	switch {
-	case len(archs) != 0:
-		ic.Archs = archs
-	case len(ic.Archs) != 0:
-		// do nothing
-	default:
-		ic.Archs = types.AllArchs
-	}
-	// save the final set we will build
-	log.Debugf("Building images for %d architectures: %+v", len(ic.Archs), ic.Archs)
-
-	// Probe the VCS URL if it is not set and we are asked to do so.
-	if o.WithVCS && ic.VCSUrl == "" {
-		ic.ProbeVCSUrl(ctx, o.ImageConfigFile)
-	}
-
-	// The build context options is sometimes copied in the next functions. Ensure
-	// we have the directory defined and created by invoking the function early.
-
-	// workDir, passed to us, is where we will lay out the various image filesystems
-	// under it we will have:
-	//  <arch>/ - the rootfs for each architecture
-	//  image/ - the summary layer files and sboms for each architecture
-	// imageDir, created here, is where the final artifacts will be: layer tars, indexes, etc.
-
-	log.Debugf("building tags %v", o.Tags)
-
-	var errg errgroup.Group
-	imageDir := filepath.Join(workDir, "image")
-	if err := os.MkdirAll(imageDir, 0755); err != nil {
-		return nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
-	}
-	opts = append(opts, build.WithSBOM(imageDir))
-
-	imgs := map[types.Architecture]v1.Image{}
-
-	mtx := sync.Mutex{}
-
-	// We compute the "build date epoch" of the multi-arch image to be the
-	// maximum "build date epoch" of the per-arch images.  If the user has
-	// explicitly set SOURCE_DATE_EPOCH, that will always trump this
-	// computation.
-	multiArchBDE := o.SourceDateEpoch
-
-	configs, _, err := build.LockImageConfiguration(ctx, *ic, opts...)
-	if err != nil {
-		return nil, nil, fmt.Errorf("locking config: %w", err)
-	}
-
-	for arch, ic := range configs {
-		errg.Go(func() error {
-			if arch == "index" {
-				return nil
-			}
-
-			arch := types.ParseArchitecture(arch)
-			log := log.With("arch", arch.ToAPK())
-			ctx := clog.WithLogger(ctx, log)
-
-			opts := slices.Clone(opts)
-			opts = append(opts, build.WithArch(arch), build.WithImageConfiguration(*ic))
-
-			bc, err := build.New(ctx, tarfs.New(), opts...)
-			if err != nil {
-				return fmt.Errorf("new build for arch %s: %w", arch, err)
-			}
-			layers, err := bc.BuildLayers(ctx)
-			if err != nil {
-				return fmt.Errorf("building %q layer: %w", arch, err)
-			}
-
-			// Compute the "build date epoch" from the packages that were
-			// installed.  The "build date epoch" is the MAX of the builddate
-			// embedded in the installed APKs.  If SOURCE_DATE_EPOCH is
-			// explicitly set by the user, that trumps this.
-			// This computation will only affect the timestamp of the image
-			// itself and its SBOMs, since the timestamps on files come from the
-			// APKs.
-			bde, err := bc.GetBuildDateEpoch()
-			if err != nil {
-				return fmt.Errorf("failed to determine build date epoch: %w", err)
-			}
-
-			img, err := oci.BuildImageFromLayers(ctx, bc.BaseImage(), layers, bc.ImageConfiguration(), bde, bc.Arch())
-			if err != nil {
-				return fmt.Errorf("failed to build OCI image for %q: %w", arch, err)
-			}
-
-			var outputs []types.SBOM
-			if len(o.SBOMFormats) != 0 {
-				outputs, err = bc.GenerateImageSBOM(ctx, arch, img)
-				if err != nil {
-					return fmt.Errorf("generating sbom for %s: %w", arch, err)
-				}
-			}
-
-			mtx.Lock()
-			defer mtx.Unlock()
-
-			imgs[arch] = img
-
-			if bde.After(multiArchBDE) {
-				multiArchBDE = bde
-			}
-
-			if len(o.SBOMFormats) != 0 {
-				sboms = append(sboms, outputs...)
-			}
-
-			return nil
-		})
+// sbomFormatsOption sets the SBOM formats from the --sbom-formats flag, which
+// yields to the configuration's sbom-formats unless it was set explicitly.
+func sbomFormatsOption(cmd *cobra.Command, formats []string) build.Option {
+	if len(formats) == 0 || cmd.Flags().Changed("sbom-formats") {
+		return build.WithSBOMFormats(formats)
 	}
-	if err := errg.Wait(); err != nil {
-		return nil, nil, err
-	}
-
-	// generate the index
-	finalDigest, idx, err := oci.GenerateIndex(ctx, *ic, imgs, multiArchBDE)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
-	}
-
-	opts = append(opts,
-		build.WithImageConfiguration(*ic),       // We mutate Archs above.
-		build.WithSourceDateEpoch(multiArchBDE), // Maximum child's time.
-	)
-
-	o, ic, err = build.NewOptions(opts...)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if _, err := build.WriteIndex(ctx, o, idx); err != nil {
-		return nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
-	}
-
-	// the sboms are saved to the same working directory as the image components
-	if len(o.SBOMFormats) != 0 {
-		files, err := build.GenerateIndexSBOM(ctx, *o, *ic, finalDigest, imgs)
-		if err != nil {
-			return nil, nil, fmt.Errorf("generating index SBOM: %w", err)
+	return func(bc *build.Context) error {
+		if err := build.WithSBOMFormats(formats)(bc); err != nil {
+			return err
 		}
-		sboms = append(sboms, files...)
+		return build.WithConfigSBOMFormats()(bc)
 	}
-
-	return idx, sboms, nil
 }
 
-// rename just like os.Rename, but does a copy and delete if the rename fails
-func rename(from, to string) error {
-	err := os.Rename(from, to)
-	if err == nil {
-		return nil
-	}
-	// we can handle cross-device rename errors
-	if !errors.Is(err, unix.EXDEV) {
-		return err
-	}
-	f1, err := os.Open(from)
-	if err != nil {
-		return err
-	}
-	defer f1.Close()
-	f2, err := os.Create(to)
-	if err != nil {
-		return err
-	}
-	defer f2.Close()
-	_, err = io.Copy(f2, f1)
-	if err != nil {
-		return err
-	}
-	return os.Remove(from)
+func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, opts ...build.Option) error {
+	_, _, err := builder.BuildImage(ctx, imageRef, output, archs, tags, sbomPath, opts...)
+	return err
 }
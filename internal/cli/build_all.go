@@ -0,0 +1,195 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/chainguard-dev/clog"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// ImageConfig is an image built by apko build --all.
+type ImageConfig struct {
+	// Name names the image tarball and the directory of its SBOMs
+	Name string `yaml:"name,omitempty"`
+	// Config is the path of the configuration file
+	Config string `yaml:"config"`
+	// Tag is the tag of the image
+	Tag string `yaml:"tag,omitempty"`
+}
+
+// buildManifest lists the images built by apko build --all.
+type buildManifest struct {
+	Images []ImageConfig `yaml:"images"`
+}
+
+// configName returns the name of an image from its configuration file,
+// e.g. nginx for nginx.apko.yaml.
+func configName(config string) string {
+	name := filepath.Base(config)
+	for _, ext := range []string{".apko.yaml", ".apko.yml", ".yaml", ".yml"} {
+		if trimmed, ok := strings.CutSuffix(name, ext); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+// ListImageConfigs returns the images built from src, which is either a
+// directory whose YAML files are each a configuration, or a manifest
+// listing the configurations, relative to the manifest. Images are tagged
+// <repository>/<name>:latest unless the manifest sets their tag.
+func ListImageConfigs(src, repository string) ([]ImageConfig, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []ImageConfig
+	if fi.IsDir() {
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || (filepath.Ext(e.Name()) != ".yaml" && filepath.Ext(e.Name()) != ".yml") {
+				continue
+			}
+			images = append(images, ImageConfig{Config: filepath.Join(src, e.Name())})
+		}
+		if len(images) == 0 {
+			return nil, fmt.Errorf("no configuration files in %s", src)
+		}
+	} else {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		var m buildManifest
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("parsing manifest %s: %w", src, err)
+		}
+		if len(m.Images) == 0 {
+			return nil, fmt.Errorf("manifest %s lists no images", src)
+		}
+		for _, img := range m.Images {
+			if img.Config == "" {
+				return nil, fmt.Errorf("manifest %s has an image without a config", src)
+			}
+			if !filepath.IsAbs(img.Config) {
+				img.Config = filepath.Join(filepath.Dir(src), img.Config)
+			}
+			images = append(images, img)
+		}
+	}
+
+	seen := make(map[string]string, len(images))
+	for i := range images {
+		img := &images[i]
+		img.Name = cmp.Or(img.Name, configName(img.Config))
+		if other, ok := seen[img.Name]; ok {
+			return nil, fmt.Errorf("%s and %s would both build image %s", other, img.Config, img.Name)
+		}
+		seen[img.Name] = img.Config
+		if img.Tag == "" {
+			if repository == "" {
+				return nil, fmt.Errorf("image %s has no tag, and no repository was given", img.Name)
+			}
+			img.Tag = strings.TrimSuffix(repository, "/") + "/" + img.Name + ":latest"
+		}
+	}
+	return images, nil
+}
+
+// BuildAllCmd builds each image into <outputDir>/<name>.tar, with its SBOMs
+// in <sbomPath>/<name> (by default in <outputDir>/<name>), up to jobs at a
+// time. The builds share the options, so passing a shared cache with
+// build.WithCache lets them share the fetched indexes and packages. A
+// failed build does not stop the others.
+func BuildAllCmd(ctx context.Context, images []ImageConfig, outputDir string, archs []types.Architecture, wantSBOM bool, sbomPath string, jobs int, includePaths []string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		errg errgroup.Group
+	)
+	errg.SetLimit(max(jobs, 1))
+	for _, img := range images {
+		errg.Go(func() error {
+			log := log.With("image", img.Name)
+			ctx := clog.WithLogger(ctx, log)
+
+			err := buildOne(ctx, img, outputDir, archs, wantSBOM, sbomPath, includePaths, opts)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				log.Errorf("failed to build %s: %v", img.Config, err)
+				errs = append(errs, fmt.Errorf("building %s: %w", img.Config, err))
+				return nil
+			}
+			log.Infof("built %s as %s", img.Config, img.Tag)
+			return nil
+		})
+	}
+	_ = errg.Wait()
+
+	if len(errs) != 0 {
+		slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+		return fmt.Errorf("%d of %d images failed to build: %w", len(errs), len(images), errors.Join(errs...))
+	}
+	log.Infof("built %d images", len(images))
+	return nil
+}
+
+func buildOne(ctx context.Context, img ImageConfig, outputDir string, archs []types.Architecture, wantSBOM bool, sbomPath string, includePaths []string, opts []build.Option) error {
+	tmp, err := os.MkdirTemp(os.TempDir(), "apko-temp-*")
+	if err != nil {
+		return fmt.Errorf("creating tempdir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	sbomDir := filepath.Join(cmp.Or(sbomPath, outputDir), img.Name)
+	if wantSBOM {
+		if err := os.MkdirAll(sbomDir, 0755); err != nil {
+			return fmt.Errorf("creating SBOM directory: %w", err)
+		}
+	}
+
+	opts = slices.Concat([]build.Option{build.WithConfig(img.Config, includePaths)}, opts, []build.Option{
+		build.WithTags(img.Tag),
+		build.WithTempDir(tmp),
+	})
+	return BuildCmd(ctx, img.Tag, filepath.Join(outputDir, img.Name+".tar"), archs, []string{img.Tag}, wantSBOM, sbomDir, opts...)
+}
@@ -0,0 +1,30 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// buildArgsOption returns the option setting the build arguments given with
+// --build-arg, which fails the build if one of them is not NAME=value.
+func buildArgsOption(args []string) build.Option {
+	parsed, err := types.ParseBuildArgs(args)
+	if err != nil {
+		return func(*build.Context) error { return err }
+	}
+	return build.WithBuildArgs(parsed)
+}
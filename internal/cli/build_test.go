@@ -15,21 +15,33 @@
 package cli_test
 
 import (
+	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
-	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/attest"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+	"chainguard.dev/apko/pkg/sbom"
 )
 
 func TestBuild(t *testing.T) {
@@ -76,34 +88,93 @@ func TestBuild(t *testing.T) {
 
 	for _, s := range sboms {
 		goldSbom := filepath.Join(goldenSboms, s.Name())
-		sbom := filepath.Join(sbomPath, s.Name())
+		sbomFile := filepath.Join(sbomPath, s.Name())
 
 		want, err := os.ReadFile(goldSbom)
 		require.NoError(t, err)
 
-		got, err := os.ReadFile(sbom)
+		got, err := os.ReadFile(sbomFile)
 		require.NoError(t, err)
 
 		if bytes.Equal(want, got) {
 			continue
 		}
 
-		// https://github.com/google/go-cmp/issues/224#issuecomment-650429859
-		transformJSON := cmp.FilterValues(func(x, y []byte) bool {
-			return json.Valid(x) && json.Valid(y)
-		}, cmp.Transformer("ParseJSON", func(in []byte) (out interface{}) {
-			if err := json.Unmarshal(in, &out); err != nil {
-				panic(err) // should never occur given previous filter to ensure valid JSON
-			}
-			return out
-		}))
-
-		if diff := cmp.Diff(want, got, transformJSON); diff != "" {
-			t.Errorf("Mismatched SBOMs (-%q +%q):\n%s", goldSbom, sbom, diff)
+		diff, err := sbom.Diff(want, got)
+		require.NoError(t, err)
+		if diff != "" {
+			t.Errorf("Mismatched SBOMs (-%q +%q):\n%s", goldSbom, sbomFile, diff)
+		} else {
+			t.Errorf("SBOM %q is not byte-identical to %q", sbomFile, goldSbom)
 		}
 	}
 }
 
+func TestBuildToStdout(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithSBOMFormats([]string{"spdx"}), build.WithTags("golden:latest")}
+
+	_, _, err := builder.BuildImage(ctx, "golden:latest", "-", archs, []string{}, "-", opts...)
+	require.ErrorContains(t, err, "cannot write both")
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	out := filepath.Join(tmp, "stdout.tar")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = f
+	digest, _, err := builder.BuildImage(ctx, "golden:latest", "-", archs, []string{}, sbomPath, opts...)
+	os.Stdout = stdout
+	require.NoError(t, f.Close())
+	require.NoError(t, err)
+
+	// the streamed tarball holds the image of each architecture
+	gold, err := layout.ImageIndexFromPath(filepath.Join("testdata", "golden"))
+	require.NoError(t, err)
+	want, err := gold.Digest()
+	require.NoError(t, err)
+	require.Equal(t, want, digest)
+
+	tag, err := name.NewTag("golden:latest-amd64")
+	require.NoError(t, err)
+	img, err := tarball.ImageFromPath(out, &tag)
+	require.NoError(t, err)
+	require.NoError(t, validate.Image(img))
+}
+
+func TestBuildReproducibleSBOMs(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+
+	build1 := func() string {
+		tmp := t.TempDir()
+		sbomPath := filepath.Join(tmp, "sboms")
+		require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+		opts := []build.Option{build.WithConfig(config, []string{}), build.WithSBOMFormats([]string{"spdx", "cyclonedx"}), build.WithTags("golden:latest")}
+		require.NoError(t, cli.BuildCmd(ctx, "golden:latest", tmp, archs, []string{}, true, sbomPath, opts...))
+		return sbomPath
+	}
+	first, second := build1(), build1()
+
+	sboms, err := os.ReadDir(first)
+	require.NoError(t, err)
+	require.Len(t, sboms, 6)
+	for _, s := range sboms {
+		want, err := os.ReadFile(filepath.Join(first, s.Name()))
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(second, s.Name()))
+		require.NoError(t, err)
+		require.Equal(t, string(want), string(got), "SBOM %s differs between builds", s.Name())
+	}
+}
+
 func TestBuildWithBase(t *testing.T) {
 	// top_image golden file can be regenerated using ./internal/cli/testdata/regenerate_golden_top_image.sh script.
 
@@ -146,3 +217,207 @@ func TestBuildWithBase(t *testing.T) {
 
 	require.Equal(t, want, got)
 }
+
+func TestBuildAttestSBOMs(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.key")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithSBOMFormats([]string{"spdx"}), build.WithTags("golden:latest"), build.WithSBOMAttestationKey(keyPath)}
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+	require.NoError(t, cli.BuildCmd(ctx, "golden:latest", tmp, archs, []string{}, true, sbomPath, opts...))
+
+	root, err := layout.ImageIndexFromPath(tmp)
+	require.NoError(t, err)
+	digest, err := root.Digest()
+	require.NoError(t, err)
+
+	for _, name := range []string{"sbom-index.spdx.json", "sbom-x86_64.spdx.json", "sbom-aarch64.spdx.json"} {
+		sbom, err := os.ReadFile(filepath.Join(sbomPath, name))
+		require.NoError(t, err)
+		data, err := os.ReadFile(filepath.Join(sbomPath, name+build.AttestationExt))
+		require.NoError(t, err)
+
+		var env attest.Envelope
+		require.NoError(t, json.Unmarshal(data, &env))
+		require.NoError(t, env.Verify(&key.PublicKey))
+		require.Equal(t, attest.PayloadType, env.PayloadType)
+
+		var st attest.Statement
+		require.NoError(t, json.Unmarshal(env.Payload, &st))
+		require.Equal(t, attest.StatementType, st.Type)
+		require.Equal(t, "https://spdx.dev/Document", st.PredicateType)
+		require.JSONEq(t, string(sbom), string(st.Predicate))
+		require.Len(t, st.Subject, 1)
+		require.Equal(t, "index.docker.io/library/golden", st.Subject[0].Name)
+		if name == "sbom-index.spdx.json" {
+			require.Equal(t, map[string]string{"sha256": digest.Hex}, st.Subject[0].Digest)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+
+	var out bytes.Buffer
+	err := cli.DryRunCmd(ctx, &out, archs, build.WithConfig(config, []string{}))
+	require.NoError(t, err)
+
+	got := out.String()
+	require.Contains(t, got, "x86_64: 2 packages")
+	require.Contains(t, got, "aarch64: 2 packages")
+	require.Contains(t, got, "replayout")
+	require.Contains(t, got, "etc/apko.json")
+	require.Less(t, strings.Index(got, "aarch64"), strings.Index(got, "x86_64"))
+}
+
+func TestListImageConfigs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"nginx.apko.yaml", "python.yml", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+	images, err := cli.ListImageConfigs(dir, "registry.example.com/team/")
+	require.NoError(t, err)
+	require.Equal(t, []cli.ImageConfig{
+		{Name: "nginx", Config: filepath.Join(dir, "nginx.apko.yaml"), Tag: "registry.example.com/team/nginx:latest"},
+		{Name: "python", Config: filepath.Join(dir, "python.yml"), Tag: "registry.example.com/team/python:latest"},
+	}, images)
+
+	manifest := filepath.Join(dir, "images.yaml")
+	require.NoError(t, os.WriteFile(manifest, []byte(`images:
+  - config: nginx.apko.yaml
+  - config: python.yml
+    name: python-3.12
+    tag: registry.example.com/python:3.12
+`), 0o644))
+	images, err = cli.ListImageConfigs(manifest, "registry.example.com/team")
+	require.NoError(t, err)
+	require.Equal(t, []cli.ImageConfig{
+		{Name: "nginx", Config: filepath.Join(dir, "nginx.apko.yaml"), Tag: "registry.example.com/team/nginx:latest"},
+		{Name: "python-3.12", Config: filepath.Join(dir, "python.yml"), Tag: "registry.example.com/python:3.12"},
+	}, images)
+
+	require.NoError(t, os.WriteFile(manifest, []byte("images:\n  - config: a/nginx.yaml\n  - config: b/nginx.yaml\n"), 0o644))
+	_, err = cli.ListImageConfigs(manifest, "registry.example.com/team")
+	require.ErrorContains(t, err, "would both build image nginx")
+
+	_, err = cli.ListImageConfigs(t.TempDir(), "registry.example.com/team")
+	require.ErrorContains(t, err, "no configuration files")
+}
+
+func TestBuildAll(t *testing.T) {
+	ctx := context.Background()
+	configs := t.TempDir()
+	out := t.TempDir()
+
+	config, err := os.ReadFile(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+	for _, name := range []string{"one.apko.yaml", "two.apko.yaml"} {
+		require.NoError(t, os.WriteFile(filepath.Join(configs, name), config, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(configs, "broken.apko.yaml"), []byte("contents:\n  packages: [does-not-exist]\n  repositories: [./testdata/packages]\n  keyring: [./testdata/melange.rsa.pub]\n"), 0o644))
+
+	images, err := cli.ListImageConfigs(configs, "example.com/apko")
+	require.NoError(t, err)
+	archs := types.ParseArchitectures([]string{"amd64"})
+	err = cli.BuildAllCmd(ctx, images, out, archs, true, "", 2, nil, build.WithSBOMFormats([]string{"spdx"}))
+	require.ErrorContains(t, err, "1 of 3 images failed to build")
+	require.ErrorContains(t, err, "broken.apko.yaml")
+
+	// The other images are built anyway.
+	for _, name := range []string{"one", "two"} {
+		_, err := os.Stat(filepath.Join(out, name+".tar"))
+		require.NoError(t, err, name)
+		sboms, err := os.ReadDir(filepath.Join(out, name))
+		require.NoError(t, err, name)
+		require.NotEmpty(t, sboms, name)
+	}
+	_, err = os.Stat(filepath.Join(out, "broken.tar"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBuildDebugImage(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64"})
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithSBOMFormats([]string{"spdx"}), build.WithTags("debug:latest")}
+	sbomPath := filepath.Join(tmp, "sboms")
+	output := filepath.Join(tmp, "image.tar")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	require.NoError(t, cli.BuildCmd(ctx, "debug:latest", output, archs, []string{"debug:latest"}, true, sbomPath, opts...))
+	require.NoError(t, cli.BuildDebugCmd(ctx, "debug:latest", output, archs, []string{"debug:latest"}, true, sbomPath, []string{"pretend-baselayout"}, opts...))
+
+	// The debug image is written and tagged next to the image, with its SBOMs next to those of the image.
+	tag, err := name.NewTag("debug:latest-debug-amd64")
+	require.NoError(t, err)
+	img, err := tarball.ImageFromPath(filepath.Join(tmp, "image-debug.tar"), &tag)
+	require.NoError(t, err)
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	require.Equal(t, []string{"/bin/sh"}, cfg.Config.Entrypoint)
+	require.Equal(t, []string{"-l"}, cfg.Config.Cmd)
+
+	for _, name := range []string{"sbom-x86_64.spdx.json", "sbom-x86_64-debug.spdx.json"} {
+		_, err := os.Stat(filepath.Join(sbomPath, name))
+		require.NoError(t, err, name)
+	}
+	entries, err := os.ReadDir(sbomPath)
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.False(t, e.IsDir(), e.Name())
+	}
+
+	// /tmp is writable by everyone.
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err)
+		if hdr.Name == "tmp" || hdr.Name == "tmp/" {
+			require.Equal(t, fs.FileMode(0o777)|fs.ModeSticky, hdr.FileInfo().Mode()&(fs.ModePerm|fs.ModeSticky))
+			break
+		}
+	}
+}
+
+func TestBuildDebugImageLocked(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64"})
+	lockfile := filepath.Join(tmp, "apko.lock.json")
+	debugPackages := []string{"pretend-baselayout"}
+	require.NoError(t, builder.LockImage(ctx, lockfile, archs, nil, []build.Option{build.WithConfig(config, []string{})}))
+
+	opts := []build.Option{build.WithConfig(config, []string{}), build.WithLockFile(lockfile), build.WithLocked(true, false)}
+	output := filepath.Join(tmp, "image.tar")
+
+	// The debug image installs other packages, so it needs its own lockfile.
+	err := cli.BuildDebugCmd(ctx, "debug:latest", output, archs, []string{"debug:latest"}, false, "", debugPackages, opts...)
+	require.ErrorContains(t, err, "apko lock --debug-image")
+
+	debugLockfile := filepath.Join(tmp, "apko.debug.lock.json")
+	require.NoError(t, builder.LockImage(ctx, debugLockfile, archs, nil, []build.Option{build.WithConfig(config, []string{}), build.WithDebugImage(debugPackages)}))
+	require.NoError(t, cli.BuildDebugCmd(ctx, "debug:latest", output, archs, []string{"debug:latest"}, false, "", debugPackages, opts...))
+}
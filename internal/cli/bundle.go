@@ -0,0 +1,416 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+)
+
+// The layout of a bundle.
+const (
+	// bundleConfig is the configuration, with its includes and build
+	// arguments resolved, and its local keys in bundleKeys.
+	bundleConfig = "apko.yaml"
+	bundleLock   = "apko.lock.json"
+	bundleCache  = "cache"
+	bundleKeys   = "keys"
+)
+
+func bundle() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Export what a build needs for disconnected environments",
+	}
+	cmd.AddCommand(bundleExport())
+	return cmd
+}
+
+func bundleExport() *cobra.Command {
+	var config string
+	var output string
+	var archstrs []string
+	var extraKeys []string
+	var extraBuildRepos []string
+	var extraRuntimeRepos []string
+	var extraPackages []string
+	var includePaths []string
+	var buildArgs []string
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the keys, indexes and packages of a build into a single archive",
+		Long: `Export the keys, indexes and packages of a build into a single archive.
+
+The packages of the configuration are locked and downloaded, along with the
+repository indexes and keys they are verified with, and written with the
+configuration and its lockfile to a tar archive. "apko build --bundle" then
+builds the image from the archive alone, without network access.
+
+Only http(s) repositories can be bundled, and configurations with a base
+image cannot.`,
+		Example: `  apko bundle export -f image.yaml -o bundle.tar`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if config == "" || output == "" {
+				return errors.New("both --file and --output are required")
+			}
+			return BundleExportCmd(cmd.Context(), output, types.ParseArchitectures(archstrs),
+				build.WithConfig(config, includePaths),
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRuntimeRepos(extraRuntimeRepos),
+				build.WithExtraPackages(extraPackages),
+				build.WithIncludePaths(includePaths),
+				buildArgsOption(buildArgs),
+			)
+		},
+	}
+
+	cmd.Flags().StringVarP(&config, "file", "f", "", "the configuration to export the build of")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "path of the bundle to write")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to export (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, etc.)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	return cmd
+}
+
+// BundleExportCmd writes the bundle of the build of opts for archs, or the
+// architectures of the configuration, to output.
+func BundleExportCmd(ctx context.Context, output string, archs []types.Architecture, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	dir, err := os.MkdirTemp("", "apko-bundle-*")
+	if err != nil {
+		return fmt.Errorf("creating bundle directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	if ic.Contents.BaseImage != nil {
+		return errors.New("configurations with a base image cannot be bundled")
+	}
+	ic.Contents.Keyring = sets.List(sets.New(ic.Contents.Keyring...).Insert(o.ExtraKeyFiles...))
+	ic.Contents.BuildRepositories = sets.List(sets.New(ic.Contents.BuildRepositories...).Insert(o.ExtraBuildRepos...))
+	ic.Contents.RuntimeRepositories = sets.List(sets.New(ic.Contents.RuntimeRepositories...).Insert(o.ExtraRuntimeRepos...))
+	ic.Contents.Packages = sets.List(sets.New(ic.Contents.Packages...).Insert(o.ExtraPackages...))
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) == 0:
+		ic.Archs = types.AllArchs
+	}
+
+	for _, repo := range slices.Concat(ic.Contents.BuildRepositories, ic.Contents.RuntimeRepositories) {
+		u, err := builder.RemoveLabel(repo)
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+			return fmt.Errorf("only http(s) repositories can be bundled, not %s", repo)
+		}
+	}
+	if err := bundleKeyring(ctx, ic, dir); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, bundleConfig))
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(f)
+	if err := errors.Join(enc.Encode(ic), enc.Close(), f.Close()); err != nil {
+		return fmt.Errorf("writing the bundle configuration: %w", err)
+	}
+
+	lockfile := filepath.Join(dir, bundleLock)
+	bundleOpts := []build.Option{
+		build.WithImageConfiguration(bundledConfiguration(*ic, dir)),
+		build.WithCache(filepath.Join(dir, bundleCache), false, apk.NewCache(true)),
+	}
+	if err := builder.LockImage(ctx, lockfile, ic.Archs, nil, bundleOpts); err != nil {
+		return fmt.Errorf("locking the packages: %w", err)
+	}
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+	for _, arch := range ic.Archs {
+		log.Infof("fetching the packages for %s", arch)
+		fs := apkfs.DirFS(ctx, filepath.Join(wd, arch.ToAPK()), apkfs.WithCreateDir())
+		bc, err := build.New(ctx, fs, append(bundleOpts, build.WithArch(arch), build.WithLockFile(lockfile))...)
+		if err != nil {
+			return err
+		}
+		if err := bc.Fetch(ctx); err != nil {
+			return fmt.Errorf("fetching the packages for %s: %w", arch, err)
+		}
+	}
+
+	return writeBundle(dir, output)
+}
+
+// bundleKeyring copies the local keys of ic, and the keys held by its OCI
+// keyring artifacts, into the keys of the bundle in dir, and refers to them
+// by their path in the bundle. The keys of an artifact are verified as the
+// configuration requires before they are bundled.
+func bundleKeyring(ctx context.Context, ic *types.ImageConfiguration, dir string) error {
+	var (
+		keyring []string
+		bc      *build.Context
+	)
+	for _, key := range ic.Contents.Keyring {
+		switch {
+		case strings.HasPrefix(key, "https://") || strings.HasPrefix(key, "http://"):
+			keyring = append(keyring, key)
+		case strings.HasPrefix(key, apk.OCIKeyringScheme):
+			if bc == nil {
+				var err error
+				bc, err = build.New(ctx, apkfs.NewMemFS(), build.WithImageConfiguration(*ic), build.WithArch(ic.Archs[0]))
+				if err != nil {
+					return err
+				}
+			}
+			keys, err := bc.OCIKeyringKeys(ctx, key)
+			if err != nil {
+				return err
+			}
+			for _, name := range slices.Sorted(maps.Keys(keys)) {
+				path, err := writeBundleKey(dir, name, keys[name])
+				if err != nil {
+					return err
+				}
+				keyring = append(keyring, path)
+			}
+		default:
+			data, err := os.ReadFile(strings.TrimPrefix(key, "file://"))
+			if err != nil {
+				return fmt.Errorf("reading key %s: %w", key, err)
+			}
+			path, err := writeBundleKey(dir, filepath.Base(key), data)
+			if err != nil {
+				return err
+			}
+			keyring = append(keyring, path)
+		}
+	}
+	ic.Contents.Keyring = keyring
+	return nil
+}
+
+// writeBundleKey writes the key named name into the keys of the bundle in
+// dir, and returns its path in the bundle.
+func writeBundleKey(dir, name string, data []byte) (string, error) {
+	path := filepath.Join(bundleKeys, name)
+	if err := os.MkdirAll(filepath.Join(dir, bundleKeys), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return "", fmt.Errorf("more than one key is named %s", name)
+	} else if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(path), nil
+}
+
+// bundledConfiguration returns ic with its bundled keys in dir.
+func bundledConfiguration(ic types.ImageConfiguration, dir string) types.ImageConfiguration {
+	ic.Contents.Keyring = slices.Clone(ic.Contents.Keyring)
+	for i, key := range ic.Contents.Keyring {
+		if strings.HasPrefix(key, bundleKeys+"/") {
+			ic.Contents.Keyring[i] = filepath.Join(dir, filepath.FromSlash(key))
+		}
+	}
+	return ic
+}
+
+// openBundle extracts the bundle at path into a new directory, and returns
+// the options to build from it, which is to be frozen, its configuration and
+// a function which removes the directory.
+func openBundle(path string) ([]build.Option, types.ImageConfiguration, func(), error) {
+	var ic types.ImageConfiguration
+	dir, err := os.MkdirTemp("", "apko-bundle-*")
+	if err != nil {
+		return nil, ic, nil, fmt.Errorf("creating bundle directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	if err := extractBundle(path, dir); err != nil {
+		cleanup()
+		return nil, ic, nil, fmt.Errorf("extracting bundle %s: %w", path, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, bundleConfig))
+	if err != nil {
+		cleanup()
+		return nil, ic, nil, fmt.Errorf("reading the configuration of bundle %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, &ic); err != nil {
+		cleanup()
+		return nil, ic, nil, fmt.Errorf("parsing the configuration of bundle %s: %w", path, err)
+	}
+	ic = bundledConfiguration(ic, dir)
+	return []build.Option{
+		build.WithImageConfiguration(ic),
+		build.WithLockFile(filepath.Join(dir, bundleLock)),
+		build.WithCache(filepath.Join(dir, bundleCache), true, apk.NewCache(true)),
+	}, ic, cleanup, nil
+}
+
+// writeBundle writes the files of dir to a tar archive at output.
+func writeBundle(dir, output string) error {
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("creating bundle: %w", err)
+	}
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		var link string
+		if d.Type()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		hdr.ModTime = time.Unix(0, 0)
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		r, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		_, err = io.Copy(tw, r)
+		return err
+	})
+	if err := errors.Join(err, tw.Close(), f.Close()); err != nil {
+		return fmt.Errorf("writing bundle: %w", err)
+	}
+	return nil
+}
+
+// extractBundle extracts the tar archive at path into dir, refusing entries
+// which would land outside of it.
+func extractBundle(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path %s", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			w, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, tr); err != nil {
+				w.Close()
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if filepath.IsAbs(hdr.Linkname) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), filepath.FromSlash(hdr.Linkname))) {
+				return fmt.Errorf("invalid link %s to %s", hdr.Name, hdr.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported entry %s of type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBundle(t *testing.T) {
+	ctx := t.Context()
+	tmp := t.TempDir()
+
+	s := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("testdata", "packages"))))
+	config := filepath.Join(tmp, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, fmt.Appendf(nil, `contents:
+  keyring:
+    - ./testdata/melange.rsa.pub
+  repositories:
+    - %s
+  packages:
+    - replayout
+`, s.URL), 0o644))
+
+	bundle := filepath.Join(tmp, "bundle.tar")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	require.NoError(t, cli.BundleExportCmd(ctx, bundle, archs, build.WithConfig(config, nil)))
+
+	// The build must not need the repository anymore.
+	s.Close()
+
+	out := filepath.Join(tmp, "image")
+	require.NoError(t, os.MkdirAll(out, 0o755))
+	cmd := cli.New()
+	cmd.SetArgs([]string{"build", "--bundle", bundle, "--sbom=false", "--arch", "amd64", "bundle:latest", out})
+	require.NoError(t, cmd.ExecuteContext(ctx))
+
+	idx, err := layout.ImageIndexFromPath(out)
+	require.NoError(t, err)
+	m, err := idx.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, m.Manifests, 1)
+	require.Equal(t, "amd64", m.Manifests[0].Platform.Architecture)
+
+	// A bundle only has the packages of its architectures.
+	cmd = cli.New()
+	cmd.SetArgs([]string{"build", "--bundle", bundle, "--sbom=false", "--arch", "riscv64", "bundle:latest", out})
+	require.ErrorContains(t, cmd.ExecuteContext(ctx), "no packages for riscv64")
+}
+
+func TestBundleOCIKeyring(t *testing.T) {
+	ctx := t.Context()
+	tmp := t.TempDir()
+
+	key, err := os.ReadFile(filepath.Join("testdata", "melange.rsa.pub"))
+	require.NoError(t, err)
+	reg := httptest.NewServer(registry.New())
+	img, err := mutate.Append(mutate.MediaType(empty.Image, ggcrtypes.OCIManifestSchema1), mutate.Addendum{
+		Layer:       static.NewLayer(key, "application/x-pem-file"),
+		Annotations: map[string]string{"org.opencontainers.image.title": "melange.rsa.pub"},
+	})
+	require.NoError(t, err)
+	ref, err := name.ParseReference(strings.TrimPrefix(reg.URL, "http://") + "/keys:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	s := httptest.NewServer(http.FileServer(http.Dir(filepath.Join("testdata", "packages"))))
+	config := filepath.Join(tmp, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, fmt.Appendf(nil, `contents:
+  keyring:
+    - oci://%s
+  repositories:
+    - %s
+  packages:
+    - replayout
+`, ref, s.URL), 0o644))
+
+	bundle := filepath.Join(tmp, "bundle.tar")
+	require.NoError(t, cli.BundleExportCmd(ctx, bundle, types.ParseArchitectures([]string{"amd64"}), build.WithConfig(config, nil)))
+
+	// The keys of the artifact are in the bundle, which needs neither the
+	// repository nor the registry anymore.
+	s.Close()
+	reg.Close()
+
+	out := filepath.Join(tmp, "image")
+	require.NoError(t, os.MkdirAll(out, 0o755))
+	cmd := cli.New()
+	cmd.SetArgs([]string{"build", "--bundle", bundle, "--sbom=false", "--arch", "amd64", "bundle:latest", out})
+	require.NoError(t, cmd.ExecuteContext(ctx))
+}
@@ -55,13 +55,27 @@ func New() *cobra.Command {
 	cmd.AddCommand(buildCmd())
 	cmd.AddCommand(buildMinirootFS())
 	cmd.AddCommand(buildCPIO())
+	cmd.AddCommand(bundle())
+	cmd.AddCommand(repository())
+	cmd.AddCommand(indexCmd())
 	cmd.AddCommand(showConfig())
 	cmd.AddCommand(publish())
+	cmd.AddCommand(push())
+	cmd.AddCommand(tagCmd())
 	cmd.AddCommand(showPackages())
+	cmd.AddCommand(searchCmd())
 	cmd.AddCommand(dotcmd())
 	cmd.AddCommand(lock())
+	cmd.AddCommand(diffCmd())
+	cmd.AddCommand(inspectCmd())
+	cmd.AddCommand(extractCmd())
+	cmd.AddCommand(verifyCmd())
+	cmd.AddCommand(lintCmd())
+	cmd.AddCommand(runCmd())
 	cmd.AddCommand(resolve())
 	cmd.AddCommand(installKeys())
+	cmd.AddCommand(schema())
+	cmd.AddCommand(serveCmd())
 	cmd.AddCommand(version.Version())
 
 	cmd.PersistentFlags().StringVarP(&workDir, "workdir", "C", cwd, "working dir (default is current dir where executed)")
@@ -0,0 +1,172 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+)
+
+// debugSuffix is appended to the tags, and output paths, of debug images.
+const debugSuffix = "-debug"
+
+// debugFlags are the flags of the commands which build a debug image along
+// the image.
+type debugFlags struct {
+	image    bool
+	packages []string
+}
+
+func (f *debugFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.image, "debug-image", false, "also build a debug image, tagged with the -debug suffix, adding the debug packages, a shell entrypoint and a writable /tmp, or applying the debug variant of the configuration")
+	cmd.Flags().StringSliceVar(&f.packages, "debug-packages", types.DefaultDebugPackages, "packages to add to the debug image, unless the configuration defines a debug variant")
+}
+
+// debugTag returns the tag of the debug image of the image tagged ref.
+func debugTag(ref string) (string, error) {
+	tag, err := name.NewTag(ref)
+	if err != nil {
+		return "", fmt.Errorf("parsing tag %q of the debug image: %w", ref, err)
+	}
+	return tag.Context().Tag(tag.TagStr() + debugSuffix).String(), nil
+}
+
+// debugTags returns the tags of the debug image of the image tagged refs.
+func debugTags(refs []string) ([]string, error) {
+	tags := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		tag, err := debugTag(ref)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// debugOutput returns where to write the debug image of an image written to
+// output: next to the tarball, with the -debug suffix before its extension,
+// or to an OCI layout directory next to the layout directory, which it
+// creates.
+func debugOutput(output string) (string, error) {
+	if fi, err := os.Stat(output); err == nil && fi.IsDir() {
+		dir := strings.TrimRight(output, string(filepath.Separator)) + debugSuffix
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", err
+		}
+		return dir, nil
+	}
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + debugSuffix + ext, nil
+}
+
+// withDebugSBOMs runs build with a directory for the SBOMs of the debug image
+// of an image whose SBOMs are written to sbomPath, the working directory when
+// empty, then moves them there with the debug suffix after their name, e.g.
+// sbom-x86_64-debug.spdx.json, so that they don't replace those of the
+// image. The directory is made in sbomPath, so that they are renamed.
+func withDebugSBOMs(sbomPath string, build func(dir string) error) error {
+	if sbomPath == "" {
+		sbomPath = "."
+	}
+	dir, err := os.MkdirTemp(sbomPath, ".apko-debug-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := build(dir); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		base, ext, ok := strings.Cut(e.Name(), ".")
+		name := base + debugSuffix
+		if ok {
+			name += "." + ext
+		}
+		if err := os.Rename(filepath.Join(dir, e.Name()), filepath.Join(sbomPath, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// debugOptions returns the options building the debug image of the image
+// built with opts, tagged tags, writing its SBOMs to sbomPath.
+func debugOptions(opts []build.Option, packages, tags []string, sbomPath string) []build.Option {
+	return append(opts[:len(opts):len(opts)],
+		build.WithDebugImage(packages),
+		build.WithTags(tags...),
+		build.WithSBOM(sbomPath),
+	)
+}
+
+// BuildDebugCmd builds the debug image of the image BuildCmd builds with the
+// same arguments, tagging it with the debug tags and writing it next to the
+// image, with its SBOMs next to those of the image, with the debug suffix.
+func BuildDebugCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, packages []string, opts ...build.Option) error {
+	if output == stdoutPath || sbomPath == stdoutPath {
+		return errors.New("the debug image cannot be written to stdout")
+	}
+	ref, err := debugTag(imageRef)
+	if err != nil {
+		return err
+	}
+	dtags, err := debugTags(tags)
+	if err != nil {
+		return err
+	}
+	out, err := debugOutput(output)
+	if err != nil {
+		return err
+	}
+	return withDebugSBOMs(sbomPath, func(dir string) error {
+		return BuildCmd(ctx, ref, out, archs, dtags, wantSBOM, dir, debugOptions(opts, packages, dtags, dir)...)
+	})
+}
+
+// PublishDebugCmd publishes the debug image of the image PublishCmd publishes
+// to tags with the same options, to the debug tags, printing its digest. Its
+// SBOMs are written next to those of the image, with the debug suffix, when
+// sbomPath is set.
+func PublishDebugCmd(ctx context.Context, archs []types.Architecture, ropt []remote.Option, sbomPath string, tags, packages []string, buildOpts []build.Option, publishOpts []builder.PublishOption) error {
+	dtags, err := debugTags(tags)
+	if err != nil {
+		return err
+	}
+	publish := func(dir string) error {
+		return PublishCmd(ctx, "", archs, ropt, dir, debugOptions(buildOpts, packages, dtags, dir),
+			append(publishOpts[:len(publishOpts):len(publishOpts)], builder.WithTags(dtags...)))
+	}
+	if sbomPath == "" {
+		return publish("")
+	}
+	return withDebugSBOMs(sbomPath, publish)
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/diff"
+)
+
+func diffCmd() *cobra.Command {
+	var arch string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Compare the packages and files of two images or lockfiles",
+		Long: `Compare the packages and files of two images or lockfiles.
+
+Each side is a lockfile (e.g. produced by apko lock), a directory containing an
+OCI layout (e.g. produced by apko build), or a reference to an image in a
+registry. Package additions, removals, upgrades and downgrades are reported for
+a single architecture. Files and installed sizes are read from the installed
+apk database, so are only reported when neither side is a lockfile.`,
+		Example: `  apko diff apko.lock.json cgr.dev/chainguard/static:latest
+  apko diff --format json old-layout/ new-layout/`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			a := types.ParseArchitecture(arch)
+			before, err := diff.Load(ctx, args[0], a, remote.WithAuthFromKeychain(keychain))
+			if err != nil {
+				return err
+			}
+			after, err := diff.Load(ctx, args[1], a, remote.WithAuthFromKeychain(keychain))
+			if err != nil {
+				return err
+			}
+
+			report := diff.Compare(before, after)
+			switch format {
+			case "text":
+				return report.WriteText(cmd.OutOrStdout())
+			case "json":
+				return report.WriteJSON(cmd.OutOrStdout())
+			default:
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&arch, "arch", runtime.GOARCH, "architecture to compare")
+	cmd.Flags().StringVar(&format, "format", "text", "output format, one of: text, json")
+	return cmd
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// DryRunCmd resolves the packages of the image for each architecture and
+// prints what a build would install and write to w, without fetching
+// packages or writing anything. The keyring and repository indexes are
+// fetched and verified, so that a dry run fails where a build would fail to
+// resolve.
+func DryRunCmd(ctx context.Context, w io.Writer, archs []types.Architecture, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
+		return fmt.Errorf("building with base image is supported only with a lockfile")
+	}
+
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	log.Infof("Planning images for %d architectures: %+v", len(ic.Archs), ic.Archs)
+
+	opts = append(opts, build.WithImageConfiguration(*ic))
+	mc, err := build.NewMultiArch(ctx, ic.Archs, opts...)
+	if err != nil {
+		return err
+	}
+	plans, err := mc.Plans(ctx)
+	if err != nil {
+		return err
+	}
+
+	archOrder := slices.SortedFunc(maps.Keys(plans), func(a, b types.Architecture) int {
+		return strings.Compare(a.ToAPK(), b.ToAPK())
+	})
+	for i, arch := range archOrder {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		printPlan(w, plans[arch])
+	}
+	return nil
+}
+
+// printPlan prints a plan for people to read.
+func printPlan(w io.Writer, p *build.Plan) {
+	fmt.Fprintf(w, "%s: %d packages, %s to download, about %s installed\n",
+		p.Arch, len(p.Packages), formatBytes(p.DownloadSize), formatBytes(p.InstalledSize))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  NAME\tVERSION\tDOWNLOAD\tINSTALLED")
+	for _, pkg := range p.Packages {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", pkg.Name, pkg.Version, formatBytes(pkg.Size), formatBytes(pkg.InstalledSize))
+	}
+	tw.Flush()
+
+	if len(p.Layers) != 0 {
+		fmt.Fprintf(w, "%d layers:\n", len(p.Layers)+1)
+		for i, layer := range p.Layers {
+			fmt.Fprintf(w, "  %d (%s): %s\n", i+1, formatBytes(layer.InstalledSize), strings.Join(layer.Packages, " "))
+		}
+		fmt.Fprintf(w, "  %d: files outside packages\n", len(p.Layers)+1)
+	}
+
+	fmt.Fprintln(w, "files outside packages:")
+	for _, f := range p.Files {
+		fmt.Fprintf(w, "  %s\n", f)
+	}
+}
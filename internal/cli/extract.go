@@ -0,0 +1,100 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func extractCmd() *cobra.Command {
+	var arch string
+
+	cmd := &cobra.Command{
+		Use:   "extract <image> <dir|file.tar|->",
+		Short: "Extract the root filesystem of an image to a directory or tarball",
+		Long: `Extract the root filesystem of an image to a directory or tarball.
+
+The image is a directory containing an OCI layout (e.g. produced by apko
+build), an image tarball, or a reference to an image in a registry, for a
+single architecture. Its layers are merged as container runtimes merge them,
+applying whiteouts and opaque directories. The destination is a directory,
+created if need be, unless it ends in .tar or is -, in which case the
+filesystem is written as a tarball to the file or to stdout.`,
+		Example: `  apko extract cgr.dev/chainguard/static:latest rootfs/
+  apko extract --arch arm64 image.tar rootfs.tar
+  apko extract oci-layout-dir/ - | tar -t`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			return ExtractCmd(cmd.Context(), args[0], args[1], types.ParseArchitecture(arch), remote.WithAuthFromKeychain(keychain))
+		},
+	}
+
+	cmd.Flags().StringVar(&arch, "arch", runtime.GOARCH, "architecture of the image to extract")
+	return cmd
+}
+
+// ExtractCmd extracts the root filesystem of the image for arch from src to
+// dest, a directory, a tarball ending in .tar, or - for stdout.
+func ExtractCmd(ctx context.Context, src, dest string, arch types.Architecture, ropt ...remote.Option) error {
+	log := clog.FromContext(ctx)
+
+	img, err := oci.ReadImage(ctx, src, arch, ropt...)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case dest == stdoutPath:
+		return oci.ExtractTar(img, os.Stdout)
+	case strings.HasSuffix(dest, ".tar"):
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		if err := oci.ExtractTar(img, f); err != nil {
+			f.Close()
+			return err
+		}
+		log.Infof("extracted %s to %s", src, dest)
+		return f.Close()
+	default:
+		if entries, err := os.ReadDir(dest); err == nil && len(entries) != 0 {
+			return fmt.Errorf("%s is not empty", dest)
+		}
+		if err := oci.Extract(img, apkfs.DirFS(ctx, dest, apkfs.WithCreateDir())); err != nil {
+			return fmt.Errorf("extracting %s: %w", src, err)
+		}
+		log.Infof("extracted %s to %s", src, dest)
+		return nil
+	}
+}
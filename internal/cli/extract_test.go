@@ -0,0 +1,63 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestExtract(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	golden := filepath.Join("testdata", "golden")
+	arch := types.ParseArchitecture("amd64")
+
+	dir := filepath.Join(tmp, "rootfs")
+	require.NoError(t, cli.ExtractCmd(ctx, golden, dir, arch))
+	installed, err := os.ReadFile(filepath.Join(dir, "usr", "lib", "apk", "db", "installed"))
+	require.NoError(t, err)
+	require.Contains(t, string(installed), "P:replayout")
+
+	// a directory is only extracted to when empty
+	require.ErrorContains(t, cli.ExtractCmd(ctx, golden, dir, arch), "is not empty")
+
+	tarball := filepath.Join(tmp, "rootfs.tar")
+	require.NoError(t, cli.ExtractCmd(ctx, golden, tarball, arch))
+	f, err := os.Open(tarball)
+	require.NoError(t, err)
+	defer f.Close()
+	found := false
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		found = found || hdr.Name == "usr/lib/apk/db/installed"
+	}
+	require.True(t, found)
+}
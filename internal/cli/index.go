@@ -0,0 +1,204 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// signingKeyPassphraseEnv holds the passphrase of an encrypted signing key.
+const signingKeyPassphraseEnv = "APKO_SIGNING_KEY_PASSPHRASE" //nolint:gosec
+
+func indexCmd() *cobra.Command {
+	var output string
+	var merge bool
+	var archstr string
+	var description string
+	var signingKey string
+
+	cmd := &cobra.Command{
+		Use:   "index <package.apk|APKINDEX.tar.gz>...",
+		Short: "Build an APKINDEX from packages and other indexes",
+		Long: `Build an APKINDEX.tar.gz from packages and the packages of other indexes.
+
+Packages are read from their .PKGINFO, with their provides and dependencies,
+and streamed through rather than held in memory. The packages of indexes, such
+as the APKINDEX.tar.gz of other repositories, are merged in without being
+verified. A package replaces one of the same name and version given before it;
+with --merge, the packages of the existing output come first.
+
+With --arch, only the packages of that architecture, and noarch packages, are
+indexed. With --signing-key, the index is signed with the RSA private key,
+under the name of the key with the .pub extension. The passphrase of an encrypted key is read from the ` + signingKeyPassphraseEnv + `
+environment variable.`,
+		Example: `  apko index -o packages/x86_64/APKINDEX.tar.gz --signing-key melange.rsa packages/x86_64/*.apk
+  apko index --merge -o APKINDEX.tar.gz --arch x86_64 other/APKINDEX.tar.gz`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b := apk.NewIndexBuilder()
+			b.Description = description
+			if archstr != "" {
+				b.Arch = types.ParseArchitecture(archstr).ToAPK()
+			}
+			if merge {
+				if output == stdoutPath {
+					return errors.New("--merge can not be used with - as the output")
+				}
+				args = append([]string{output}, args...)
+			}
+			return IndexCmd(cmd.Context(), b, output, signingKey, os.Getenv(signingKeyPassphraseEnv), args)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "APKINDEX.tar.gz", "path to write the index to, or - for stdout")
+	cmd.Flags().BoolVarP(&merge, "merge", "m", false, "merge the packages of the existing output, if any")
+	cmd.Flags().StringVar(&archstr, "arch", "", "only index the packages of this architecture, and noarch packages")
+	cmd.Flags().StringVar(&description, "description", "", "description of the index")
+	cmd.Flags().StringVar(&signingKey, "signing-key", "", "private key to sign the index with")
+	cmd.AddCommand(indexSignCmd())
+	return cmd
+}
+
+func indexSignCmd() *cobra.Command {
+	var signingKey string
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "sign <APKINDEX.tar.gz>",
+		Short: "Re-sign an APKINDEX with a new key",
+		Long: `Re-sign an APKINDEX.tar.gz with a new key, replacing its signatures. The
+index itself is unchanged, so the signature of any key it was signed with
+before no longer applies.
+
+The passphrase of an encrypted key is read from the ` + signingKeyPassphraseEnv + `
+environment variable.`,
+		Example: `  apko index sign --signing-key new.rsa packages/x86_64/APKINDEX.tar.gz`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if signingKey == "" {
+				return errors.New("--signing-key is required")
+			}
+			if output == "" {
+				output = args[0]
+			}
+			return IndexSignCmd(cmd.Context(), args[0], output, signingKey, os.Getenv(signingKeyPassphraseEnv))
+		},
+	}
+
+	cmd.Flags().StringVar(&signingKey, "signing-key", "", "private key to sign the index with")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "path to write the index to, or - for stdout (default is to replace the index)")
+	return cmd
+}
+
+// IndexCmd adds the packages and indexes of inputs to b, and writes the index
+// to output, signed with signingKey unless it is empty. Inputs which don't
+// exist are skipped when they are the output, as for --merge.
+func IndexCmd(ctx context.Context, b *apk.IndexBuilder, output, signingKey, passphrase string, inputs []string) error {
+	log := clog.FromContext(ctx)
+	for _, in := range inputs {
+		f, err := os.Open(in)
+		if errors.Is(err, fs.ErrNotExist) && in == output {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if strings.HasSuffix(in, ".apk") {
+			pkg, ok, err := b.AddPackage(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", in, err)
+			}
+			if !ok {
+				log.Infof("skipping %s, which is for %s", in, pkg.Arch)
+				continue
+			}
+			log.Debugf("indexed %s", pkg.Filename())
+			continue
+		}
+		idx, err := apk.IndexFromArchive(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading index %s: %w", in, err)
+		}
+		b.AddIndex(idx)
+	}
+
+	var buf bytes.Buffer
+	if err := b.Write(&buf, signingKey, passphrase); err != nil {
+		return err
+	}
+	log.Infof("indexed %d packages", len(b.Index().Packages))
+	return writeOutput(output, &buf)
+}
+
+// IndexSignCmd writes the index at input to output, signed with signingKey
+// instead of the keys it was signed with.
+func IndexSignCmd(_ context.Context, input, output, signingKey, passphrase string) error {
+	b, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	index, err := apk.StripIndexSignatures(b)
+	if err != nil {
+		return fmt.Errorf("reading index %s: %w", input, err)
+	}
+	var buf bytes.Buffer
+	if err := apk.SignIndex(&buf, index, signingKey, passphrase); err != nil {
+		return err
+	}
+	return writeOutput(output, &buf)
+}
+
+// writeOutput writes r to the file at path, or to stdout if it is -. The
+// file is replaced atomically, so that a repository never serves a partial
+// index.
+func writeOutput(path string, r io.Reader) error {
+	if path == stdoutPath {
+		_, err := io.Copy(os.Stdout, r)
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	// indexes are publicly readable
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,69 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	output := filepath.Join(tmp, "APKINDEX.tar.gz")
+
+	apks, err := filepath.Glob("testdata/packages/x86_64/*.apk")
+	require.NoError(t, err)
+	b := apk.NewIndexBuilder()
+	b.Arch = "x86_64"
+	require.NoError(t, cli.IndexCmd(ctx, b, output, "testdata/melange.rsa", "", apks))
+
+	want := readIndex(t, "testdata/packages/x86_64/APKINDEX.tar.gz")
+	got := readIndex(t, output)
+	require.Len(t, got.Packages, len(want.Packages))
+	for i, pkg := range got.Packages {
+		require.Equal(t, want.Packages[i].Name, pkg.Name)
+		require.Equal(t, want.Packages[i].Version, pkg.Version)
+		require.Equal(t, want.Packages[i].Checksum, pkg.Checksum)
+		require.Equal(t, want.Packages[i].Size, pkg.Size)
+	}
+	require.NotEmpty(t, got.Signature)
+
+	// Merging an index of another architecture leaves its packages out.
+	b = apk.NewIndexBuilder()
+	b.Arch = "x86_64"
+	require.NoError(t, cli.IndexCmd(ctx, b, output, "", "", []string{output, "testdata/packages/aarch64/APKINDEX.tar.gz"}))
+	require.Len(t, readIndex(t, output).Packages, len(want.Packages))
+	require.Empty(t, readIndex(t, output).Signature)
+
+	require.NoError(t, cli.IndexSignCmd(ctx, output, output, "testdata/melange.rsa", ""))
+	require.NotEmpty(t, readIndex(t, output).Signature)
+}
+
+func readIndex(t *testing.T, path string) *apk.APKIndex {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	idx, err := apk.IndexFromArchive(f)
+	require.NoError(t, err)
+	return idx
+}
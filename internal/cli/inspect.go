@@ -0,0 +1,73 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/inspect"
+)
+
+func inspectCmd() *cobra.Command {
+	var arch string
+	var format string
+	var files bool
+
+	cmd := &cobra.Command{
+		Use:   "inspect <image>",
+		Short: "Show the packages, files and configuration of an image",
+		Long: `Show the packages, files and configuration of an image.
+
+The image is a directory containing an OCI layout (e.g. produced by apko
+build), an image tarball (e.g. produced by apko build or docker save), or a
+reference to an image in a registry, which need not have been built with apko.
+Its packages are read from the installed apk database, and its distribution
+from os-release, for a single architecture.`,
+		Example: `  apko inspect cgr.dev/chainguard/static:latest
+  apko inspect --files --format json image.tar`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			report, err := inspect.Load(cmd.Context(), args[0], types.ParseArchitecture(arch), files, remote.WithAuthFromKeychain(keychain))
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "text":
+				return report.WriteText(cmd.OutOrStdout())
+			case "json":
+				return report.WriteJSON(cmd.OutOrStdout())
+			default:
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&arch, "arch", runtime.GOARCH, "architecture to inspect")
+	cmd.Flags().StringVar(&format, "format", "text", "output format, one of: text, json")
+	cmd.Flags().BoolVar(&files, "files", false, "also list the files in the image, with the packages which installed them")
+	return cmd
+}
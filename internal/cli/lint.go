@@ -0,0 +1,216 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/auth"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lint"
+	pkglock "chainguard.dev/apko/pkg/lock"
+)
+
+func lintCmd() *cobra.Command {
+	var config string
+	var lockfile string
+	var archstrs []string
+	var extraKeys []string
+	var extraBuildRepos []string
+	var extraRuntimeRepos []string
+	var includePaths []string
+	var buildArgs []string
+	var cacheDir string
+	var offline bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check a configuration for common mistakes",
+		Long: `Check a configuration for common mistakes.
+
+Each finding names the rule which found it, where it is in the configuration,
+as a JSON pointer, and a suggested fix. With --format json, fixes which can be
+applied mechanically come with a JSON patch of the configuration. The rules are:
+
+  unpinned-package:         a package has no version, while the configuration
+                            has a lockfile
+  repository-without-keys:  no key of the keyring is for a repository, and
+                            none are discovered
+  entrypoint-not-provided:  no resolved package provides the command of the
+                            entrypoint
+  missing-group:            the group of a user is not in accounts.groups
+
+The packages of the configuration are resolved to check the entrypoint; when
+they cannot be, the other rules are still checked.
+
+The command fails if there are findings.`,
+		Example: `  apko lint -f image.yaml`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if config == "" {
+				return errors.New("--file is required")
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+			}
+			if lockfile == "" {
+				lockfile = strings.TrimSuffix(config, filepath.Ext(config)) + ".lock.json"
+			}
+			return LintCmd(cmd.Context(), cmd.OutOrStdout(), format, lockfile, types.ParseArchitectures(archstrs), offline,
+				build.WithConfig(config, includePaths),
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRuntimeRepos(extraRuntimeRepos),
+				build.WithIncludePaths(includePaths),
+				buildArgsOption(buildArgs),
+				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+			)
+		},
+	}
+
+	cmd.Flags().StringVarP(&config, "file", "f", "", "the configuration to check")
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "path to the lockfile of the configuration (default is the configuration with the .lock.json extension, if it exists)")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to resolve the packages for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, etc.)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to resolve packages or discover keys (cache must be pre-populated)")
+	cmd.Flags().StringVar(&format, "format", "text", "output format, one of: text, json")
+	return cmd
+}
+
+// LintCmd writes the findings of the rules of package lint in the
+// configuration of opts to w, in format, and fails if there are any. The
+// lockfile is only used if it exists.
+func LintCmd(ctx context.Context, w io.Writer, format, lockfile string, archs []types.Architecture, offline bool, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	in := lint.Input{Config: ic}
+	if l, err := pkglock.FromFile(lockfile); err == nil {
+		in.Lock = &l
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading lockfile: %w", err)
+	}
+
+	switch {
+	case len(archs) != 0:
+	case len(ic.Archs) != 0:
+		archs = ic.Archs
+	default:
+		archs = types.AllArchs
+	}
+
+	// The repositories whose indexes were verified when resolving have keys.
+	var verified []string
+	if ic.Contents.BaseImage != nil {
+		log.Warnf("not checking the entrypoint of a configuration with a base image")
+	} else if resolved, available, sources, err := lintResolve(ctx, archs, append(opts, build.WithImageConfiguration(*ic))...); err != nil {
+		log.Warnf("not checking the entrypoint: %v", err)
+	} else {
+		in.Resolved, in.Available = resolved, available
+		for _, source := range sources {
+			if _, ok := apk.UnsignedReasonFor(o.UnsignedRepositories, source); !ok {
+				verified = append(verified, source)
+			}
+		}
+	}
+	in.KeysDiscovered = func(repo string) bool {
+		prefix := strings.TrimSuffix(repo, "/") + "/"
+		for _, source := range verified {
+			if strings.HasPrefix(source, prefix) {
+				return true
+			}
+		}
+		if offline {
+			return false
+		}
+		keys, err := apk.DiscoverKeys(ctx, http.DefaultClient, auth.DefaultAuthenticators, repo)
+		return err == nil && len(keys) > 0
+	}
+
+	findings := lint.Config(in)
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []lint.Finding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s: %s: %s\n", f.Path, f.Rule, f.Message)
+			if f.Fix != nil {
+				fmt.Fprintf(w, "  fix: %s\n", f.Fix.Description)
+			}
+		}
+	}
+
+	if len(findings) != 0 {
+		return fmt.Errorf("%d findings", len(findings))
+	}
+	return nil
+}
+
+// lintResolve resolves the packages of the configuration for archs, and
+// returns them with the packages of the repositories and the sources of their
+// indexes.
+func lintResolve(ctx context.Context, archs []types.Architecture, opts ...build.Option) (resolved, available map[types.Architecture][]*apk.RepositoryPackage, sources []string, err error) {
+	mc, err := build.NewMultiArch(ctx, archs, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	resolved, err = mc.BuildPackageLists(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	available = map[types.Architecture][]*apk.RepositoryPackage{}
+	for arch, bc := range mc.Contexts {
+		indexes, err := bc.RepositoryIndexes(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for _, idx := range indexes {
+			available[arch] = append(available[arch], idx.Packages()...)
+			sources = append(sources, idx.Source())
+		}
+	}
+	return resolved, available, sources, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lint"
+)
+
+func TestLint(t *testing.T) {
+	ctx := context.Background()
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, fmt.Appendf(nil, `contents:
+  keyring:
+    - %[1]s/melange.rsa.pub
+  repositories:
+    - %[1]s/packages
+  packages:
+    - replayout
+entrypoint:
+  command: /usr/bin/app
+accounts:
+  users:
+    - username: nonroot
+      uid: 65532
+`, testdata), 0o644))
+
+	var out bytes.Buffer
+	err = cli.LintCmd(ctx, &out, "json", filepath.Join(testdata, "apko.lock.json"), types.ParseArchitectures([]string{"amd64"}), true,
+		build.WithConfig(config, nil))
+	require.ErrorContains(t, err, "3 findings")
+
+	var findings []lint.Finding
+	require.NoError(t, json.Unmarshal(out.Bytes(), &findings))
+	var rules []string
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	require.Equal(t, []string{lint.RuleUnpinnedPackage, lint.RuleEntrypointNotProvided, lint.RuleMissingGroup}, rules)
+	require.Equal(t, []lint.PatchOperation{{Op: "replace", Path: "/contents/packages/0", Value: "replayout=1.0.0-r0"}}, findings[0].Fix.Patch)
+}
@@ -16,8 +16,9 @@ package cli
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"slices"
@@ -31,34 +32,67 @@ import (
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
 	pkglock "chainguard.dev/apko/pkg/lock"
 )
 
 func lock() *cobra.Command {
-	return lockInternal("lock", "lock.json", "")
+	cmd := lockInternal("lock", "lock.json", "")
+	cmd.AddCommand(lockExport(), lockOutdated())
+	return cmd
+}
+
+func lockExport() *cobra.Command {
+	var format string
+	var namespace string
+
+	cmd := &cobra.Command{
+		Use:   "export <lockfile>",
+		Short: "Export the packages of a lockfile to other formats",
+		Long: fmt.Sprintf(`Export the packages of a lockfile to other formats, so they can be consumed
+by policy engines and dependency tracking systems.
+
+The formats are:
+  cyclonedx           a CycloneDX BOM with the packages as components
+  slsa-resolved-deps  the resolvedDependencies of SLSA provenance, with the
+                      keys, repository indexes and packages
+  plain               the packages as name=version, one per line
+
+Supported formats: %s`, strings.Join(pkglock.ExportFormats, ", ")),
+		Example: `  apko lock export --format cyclonedx --namespace wolfi apko.lock.json`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			l, err := pkglock.FromFile(args[0])
+			if err != nil {
+				return err
+			}
+			return l.Export(cmd.OutOrStdout(), format, namespace)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "plain", "output format, one of: "+strings.Join(pkglock.ExportFormats, ", "))
+	cmd.Flags().StringVar(&namespace, "namespace", "", "distribution of the packages, used as the namespace of their package URLs (e.g. wolfi)")
+	return cmd
 }
 
 func resolve() *cobra.Command {
-	return lockInternal(
+	cmd := lockInternal(
 		"resolve",
 		"resolved.json",
-		"Please use `lock` command. The `resolve` command will get removed in the future versions.")
-}
+		"Please use `lock` command. Writing a lockfile with the `resolve` command will get removed in the future versions.")
+	cmd.Hidden = false
+	cmd.Short = "Resolve the packages of a configuration, and print the plan of the build as JSON"
+	cmd.Long = `Resolve the packages of a configuration.
 
-func RemoveLabel(s string) (string, error) {
-	if s == "" {
-		return "", fmt.Errorf("input is empty")
-	}
+With -o json, apko prints the plan of the build: the packages to install for
+each architecture, with their checksums and sizes, the annotations of the
+image, and a digest of the whole plan. The plan is written the same way for
+the same packages, so plans can be diffed, and its schema is versioned: its
+version is only increased by changes which are not backwards compatible.
 
-	for strings.HasPrefix(s, "@") {
-		parts := strings.SplitN(s, " ", 2)
-		if len(parts) < 2 {
-			return "", fmt.Errorf("input does not follow the format '@label url'")
-		}
-		s = parts[1]
-	}
-
-	return s, nil
+Otherwise, the packages are written to a lockfile, as with apko lock.`
+	cmd.Example = `  apko resolve -o json <config.yaml>`
+	return cmd
 }
 
 func lockInternal(cmdName string, extension string, deprecated string) *cobra.Command {
@@ -69,38 +103,91 @@ func lockInternal(cmdName string, extension string, deprecated string) *cobra.Co
 	var output string
 	var includePaths []string
 	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var buildArgs []string
 	var cacheDir string
+	var update []string
+	var format string
+	var variant string
+	var debug debugFlags
 
 	cmd := &cobra.Command{
 		Use: cmdName,
+		Long: `Resolve the packages of a configuration and write them to a lockfile.
+
+With --arch, only the given architectures are resolved, and the other
+architectures of an existing lockfile are kept as they are.
+
+With --update, the existing lockfile is refreshed: the given packages are
+updated to their latest versions, and every other package keeps its locked
+version. If that is not possible, the packages which depend on the given
+packages, and their direct dependencies, are updated as well.
+
+With --debug-image, the packages of the debug image of the configuration are
+resolved instead, to the lockfile which apko build --debug-image uses for the
+debug image along the lockfile of the image, e.g. apko.debug.lock.json.`,
 		// hidden for now until we get some feedback on it.
-		Hidden:     true,
-		Example:    fmt.Sprintf(`apko %v <config.yaml>`, cmdName),
-		Args:       cobra.MinimumNArgs(1),
-		Deprecated: deprecated,
+		Hidden:  true,
+		Example: fmt.Sprintf(`apko %v <config.yaml>`, cmdName),
+		Args:    cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if output == "" {
-				output = fmt.Sprintf("%s."+extension, strings.TrimSuffix(args[0], filepath.Ext(args[0])))
+			archs := types.ParseArchitectures(archstrs)
+			opts := []build.Option{
+				build.WithConfig(args[0], includePaths),
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRuntimeRepos(extraRuntimeRepos),
+				build.WithIncludePaths(includePaths),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithUnsignedRepositories(unsignedRepos),
+				buildArgsOption(buildArgs),
+				build.WithVariant(variant),
+				build.WithCache(cacheDir, false, apk.NewCache(true)),
+			}
+			if debug.image {
+				opts = append(opts, build.WithDebugImage(debug.packages))
 			}
 
-			archs := types.ParseArchitectures(archstrs)
+			switch format {
+			case "json":
+				if len(update) != 0 {
+					return errors.New("--update cannot be used with -o json")
+				}
+				w := cmd.OutOrStdout()
+				if output != "" {
+					f, err := os.Create(output)
+					if err != nil {
+						return err
+					}
+					defer f.Close()
+					w = f
+				}
+				return ResolvePlanCmd(cmd.Context(), w, archs, opts...)
+			case "", "lockfile":
+			default:
+				return fmt.Errorf("unknown output format %q, expected json or lockfile", format)
+			}
 
-			return LockCmd(
-				cmd.Context(),
-				output,
-				archs,
-				[]build.Option{
-					build.WithConfig(args[0], includePaths),
-					build.WithExtraKeys(extraKeys),
-					build.WithExtraBuildRepos(extraBuildRepos),
-					build.WithExtraRuntimeRepos(extraRuntimeRepos),
-					build.WithIncludePaths(includePaths),
-					build.WithIgnoreSignatures(ignoreSignatures),
-					build.WithCache(cacheDir, false, apk.NewCache(true)),
-				},
-			)
+			if deprecated != "" {
+				clog.FromContext(cmd.Context()).Warn(deprecated)
+			}
+			if output == "" {
+				// Each variant resolves its own packages, so it has its own lockfile.
+				base := strings.TrimSuffix(args[0], filepath.Ext(args[0]))
+				if variant != "" {
+					base += "." + variant
+				}
+				if debug.image && variant != types.DebugVariantName {
+					base += "." + types.DebugVariantName
+				}
+				output = fmt.Sprintf("%s."+extension, base)
+			}
+			return builder.LockImage(cmd.Context(), output, archs, update, opts)
 		},
 	}
+	if cmd.Name() == "resolve" {
+		cmd.Flags().StringVarP(&format, "output-format", "o", "lockfile", "what to write: json, the plan of the build, or lockfile")
+	}
 
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
@@ -109,151 +196,107 @@ func lockInternal(cmdName string, extension string, deprecated string) *cobra.Co
 	cmd.Flags().StringVar(&output, "output", "", "path to file where lock file will be written")
 	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().StringVar(&variant, "variant", "", "name of the variant of the configuration to resolve, one of those under its variants; its lockfile defaults to <config>.<variant>.lock.json")
+	cmd.Flags().StringSliceVar(&update, "update", nil, "only update these packages (and the packages related to them, if needed) in the existing lockfile")
+	debug.addFlags(cmd)
+	cmd.Flags().Lookup("debug-image").Usage = "resolve the packages of the debug image of the configuration instead; its lockfile defaults to <config>.debug.lock.json"
 
 	return cmd
 }
 
-func LockCmd(ctx context.Context, output string, archs []types.Architecture, opts []build.Option) error {
-	log := clog.FromContext(ctx)
-	wd, err := os.MkdirTemp("", "apko-*")
-	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
+func lockOutdated() *cobra.Command {
+	var lockfile string
+	var format string
+	var includePaths []string
+	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var buildArgs []string
+	var cacheDir string
+
+	cmd := &cobra.Command{
+		Use:   "outdated <config.yaml>",
+		Short: "List the locked packages which have newer versions",
+		Long: `List the locked packages which have newer versions in the repositories of a
+configuration, with the repository they are in and, for projects hosted on
+GitHub or GitLab, where to find their changelog.
+
+With -o json, the list is written in a form bots can turn into pull requests.`,
+		Example: `  apko lock outdated -o json apko.yaml`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lockfile == "" {
+				lockfile = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".lock.json"
+			}
+			return LockOutdatedCmd(cmd.Context(), lockfile, cmd.OutOrStdout(), format, []build.Option{
+				build.WithConfig(args[0], includePaths),
+				build.WithIncludePaths(includePaths),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithUnsignedRepositories(unsignedRepos),
+				buildArgsOption(buildArgs),
+				build.WithCache(cacheDir, false, apk.NewCache(true)),
+			})
+		},
 	}
-	defer os.RemoveAll(wd)
 
-	o, ic, err := build.NewOptions(opts...)
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "path to the lockfile (default is the configuration with the .lock.json extension)")
+	cmd.Flags().StringVarP(&format, "output", "o", "text", "output format, one of: text, json")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append")
+	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	return cmd
+}
 
+// LockOutdatedCmd writes the packages of the lockfile which have newer
+// versions in the repositories of the configuration to w, in format.
+func LockOutdatedCmd(ctx context.Context, lockfile string, w io.Writer, format string, opts []build.Option) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+	}
+	l, err := pkglock.FromFile(lockfile)
 	if err != nil {
 		return err
 	}
-	// cases:
-	// - archs set: use those archs
-	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
-	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
-	switch {
-	case len(archs) != 0:
-		ic.Archs = archs
-	case len(ic.Archs) != 0:
-		// do nothing
-	default:
-		ic.Archs = types.AllArchs
-	}
-	// save the final set we will build
-	archs = ic.Archs
-	log.Infof("Determining packages for %d architectures: %+v", len(ic.Archs), ic.Archs)
-
-	// The build context options is sometimes copied in the next functions. Ensure
-	// we have the directory defined and created by invoking the function early.
-	defer os.RemoveAll(o.TempDir())
-
-	lock := pkglock.Lock{
-		Version: "v1",
-		Config: &pkglock.Config{
-			Name:         o.ImageConfigFile,
-			DeepChecksum: o.ImageConfigChecksum,
-		},
-		Contents: pkglock.LockContents{
-			Packages:            make([]pkglock.LockPkg, 0, len(ic.Contents.Packages)),
-			BuildRepositories:   make([]pkglock.LockRepo, 0, len(ic.Contents.BuildRepositories)),
-			RuntimeRepositories: make([]pkglock.LockRepo, 0, len(ic.Contents.RuntimeRepositories)),
-			Keyrings:            make([]pkglock.LockKeyring, 0, len(ic.Contents.Keyring)),
-		},
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
 	}
+	defer os.RemoveAll(wd)
 
-	for _, keyring := range ic.Contents.Keyring {
-		lock.Contents.Keyrings = append(lock.Contents.Keyrings, pkglock.LockKeyring{
-			Name: stripURLScheme(keyring),
-			URL:  keyring,
-		})
+	var archs []types.Architecture
+	for _, p := range l.Contents.Packages {
+		if arch := types.ParseArchitecture(p.Architecture); !slices.Contains(archs, arch) {
+			archs = append(archs, arch)
+		}
 	}
 
-	// TODO: If the archs can't agree on package versions (e.g., arm builds are ahead of x86) then we should fail instead of producing inconsistent locks.
+	var updates []pkglock.Update
 	for _, arch := range archs {
-		arch := arch
-
-		log := log.With("arch", arch.ToAPK())
-		ctx := clog.WithLogger(ctx, log)
-
-		// working directory for this architecture
-		wd := filepath.Join(wd, arch.ToAPK())
-		bopts := append(slices.Clone(opts), build.WithArch(arch))
-		fs := apkfs.DirFS(ctx, wd, apkfs.WithCreateDir())
-		bc, err := build.New(ctx, fs, bopts...)
+		fsys := apkfs.DirFS(ctx, filepath.Join(wd, arch.ToAPK()), apkfs.WithCreateDir())
+		bc, err := build.New(ctx, fsys, append(slices.Clone(opts), build.WithArch(arch))...)
 		if err != nil {
 			return err
 		}
-
-		resolvedPkgs, err := bc.ResolveWithBase(ctx)
+		indexes, err := bc.RepositoryIndexes(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to get package list for image: %w", err)
+			return fmt.Errorf("failed to get repository indexes for %s: %w", arch, err)
 		}
-
-		for _, rpkg := range resolvedPkgs {
-			lockPkg := pkglock.LockPkg{
-				Name:         rpkg.Package.Name,
-				URL:          rpkg.Package.URL(),
-				Architecture: rpkg.Package.Arch,
-				Version:      rpkg.Package.Version,
-				Control: pkglock.LockPkgRangeAndChecksum{
-					Range:    fmt.Sprintf("bytes=%d-%d", rpkg.SignatureSize, rpkg.SignatureSize+rpkg.ControlSize-1),
-					Checksum: "sha1-" + base64.StdEncoding.EncodeToString(rpkg.ControlHash),
-				},
-				Data: pkglock.LockPkgRangeAndChecksum{
-					Range:    fmt.Sprintf("bytes=%d-%d", rpkg.SignatureSize+rpkg.ControlSize, rpkg.SignatureSize+rpkg.ControlSize+rpkg.DataSize-1),
-					Checksum: "sha256-" + base64.StdEncoding.EncodeToString(rpkg.DataHash),
-				},
-				Checksum: rpkg.Package.ChecksumString(),
-			}
-
-			if rpkg.SignatureSize != 0 {
-				lockPkg.Signature = pkglock.LockPkgRangeAndChecksum{
-					Range:    fmt.Sprintf("bytes=0-%d", rpkg.SignatureSize-1),
-					Checksum: "sha1-" + base64.StdEncoding.EncodeToString(rpkg.SignatureHash),
-				}
-			}
-
-			lock.Contents.Packages = append(lock.Contents.Packages, lockPkg)
-		}
-		for _, repositoryURI := range ic.Contents.BuildRepositories {
-			repo := apk.Repository{URI: fmt.Sprintf("%s/%s", repositoryURI, arch.ToAPK())}
-			name, err := RemoveLabel(stripURLScheme(repo.URI))
-			if err != nil {
-				return fmt.Errorf("failed to remove label from repository URI: %w", err)
-			}
-			url, err := RemoveLabel(repo.IndexURI())
-			if err != nil {
-				return fmt.Errorf("failed to remove label from repository index URI: %w", err)
-			}
-			lock.Contents.BuildRepositories = append(lock.Contents.BuildRepositories, pkglock.LockRepo{
-				Name:         name,
-				URL:          url,
-				Architecture: arch.ToAPK(),
-			})
-		}
-		for _, repositoryURI := range ic.Contents.RuntimeRepositories {
-			repo := apk.Repository{URI: fmt.Sprintf("%s/%s", repositoryURI, arch.ToAPK())}
-			name, err := RemoveLabel(stripURLScheme(repo.URI))
-			if err != nil {
-				return fmt.Errorf("failed to remove label from repository URI: %w", err)
-			}
-			url, err := RemoveLabel(repo.IndexURI())
-			if err != nil {
-				return fmt.Errorf("failed to remove label from repository index URI: %w", err)
-			}
-			lock.Contents.RuntimeRepositories = append(lock.Contents.RuntimeRepositories, pkglock.LockRepo{
-				Name:         name,
-				URL:          url,
-				Architecture: arch.ToAPK(),
-			})
+		archUpdates, err := l.Outdated(arch, indexes)
+		if err != nil {
+			return err
 		}
+		updates = append(updates, archUpdates...)
 	}
-	return lock.SaveToFile(output)
-}
 
-func stripURLScheme(url string) string {
-	return strings.TrimPrefix(
-		strings.TrimPrefix(url, "https://"),
-		"http://",
-	)
+	if format == "json" {
+		return pkglock.WriteUpdatesJSON(w, updates)
+	}
+	return pkglock.WriteUpdatesText(w, updates)
 }
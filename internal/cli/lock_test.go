@@ -17,16 +17,22 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+	pkglock "chainguard.dev/apko/pkg/lock"
+	"chainguard.dev/apko/pkg/plan"
 )
 
 func TestLock(t *testing.T) {
@@ -40,7 +46,7 @@ func TestLock(t *testing.T) {
 	opts := []build.Option{build.WithConfig(config, []string{"testdata"})}
 	outputPath := filepath.Join(tmp, "apko.lock.json")
 
-	err := cli.LockCmd(ctx, outputPath, archs, opts)
+	err := builder.LockImage(ctx, outputPath, archs, nil, opts)
 	require.NoError(t, err)
 
 	want, err := os.ReadFile(golden)
@@ -66,7 +72,7 @@ func TestLockWithBaseImage(t *testing.T) {
 	opts := []build.Option{build.WithConfig(config, []string{})}
 	outputPath := filepath.Join(tmp, "apko.lock.json")
 
-	err := cli.LockCmd(ctx, outputPath, archs, opts)
+	err := builder.LockImage(ctx, outputPath, archs, nil, opts)
 	require.NoError(t, err)
 
 	want, err := os.ReadFile(golden)
@@ -81,33 +87,155 @@ func TestLockWithBaseImage(t *testing.T) {
 	}
 }
 
-func TestRemoveLabel(t *testing.T) {
-	tests := []struct {
-		value string
-		want  string
-	}{
-		{
-			value: "docker.io/library/alpine:latest",
-			want:  "docker.io/library/alpine:latest",
-		}, {
-			value: "@alpine docker.io/library/alpine:latest",
-			want:  "docker.io/library/alpine:latest",
-		}, {
-			value: "@string",
-			want:  "",
-		}, {
-			value: "@label @label2 docker.io/library/alpine:latest",
-			want:  "docker.io/library/alpine:latest",
-		}, {
-			value: "@label @label2 @label3 any_string",
-			want:  "any_string",
-		},
+func TestLockIgnoreSignatures(t *testing.T) {
+	ctx := context.Background()
+	outputPath := filepath.Join(t.TempDir(), "apko.lock.json")
+
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"}), build.WithIgnoreSignatures(true)}
+	require.NoError(t, builder.LockImage(ctx, outputPath, types.ParseArchitectures([]string{"amd64"}), nil, opts))
+
+	// The index may have been verified by another test, but not by this lock,
+	// which ignores the signatures of each repository with the same reason.
+	got, err := pkglock.FromFile(outputPath)
+	require.NoError(t, err)
+	require.Len(t, got.Contents.RuntimeRepositories, 1)
+	require.Equal(t, &apk.Verification{Reason: "signature verification is disabled for the repository: " + build.ReasonAllSignaturesIgnored}, got.Contents.RuntimeRepositories[0].Verification)
+
+	// Which the lockout lists.
+	t.Setenv(apk.ForbidUnsignedEnv, "1")
+	err = builder.LockImage(ctx, outputPath, types.ParseArchitectures([]string{"amd64"}), nil, opts)
+	require.ErrorContains(t, err, "APKO_FORBID_UNSIGNED=1 forbids ignoring the signatures of ./testdata/packages")
+}
+
+func TestLockUnsignedRepository(t *testing.T) {
+	ctx := context.Background()
+	outputPath := filepath.Join(t.TempDir(), "apko.lock.json")
+
+	unsigned := map[string]string{"./testdata/packages": "packages built by this test suite"}
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"}), build.WithUnsignedRepositories(unsigned)}
+	require.NoError(t, builder.LockImage(ctx, outputPath, types.ParseArchitectures([]string{"amd64"}), nil, opts))
+
+	got, err := pkglock.FromFile(outputPath)
+	require.NoError(t, err)
+	require.Len(t, got.Contents.RuntimeRepositories, 1)
+	require.Equal(t, &apk.Verification{Reason: "signature verification is disabled for the repository: packages built by this test suite"}, got.Contents.RuntimeRepositories[0].Verification)
+
+	// An organization can forbid ignoring signatures altogether.
+	t.Setenv(apk.ForbidUnsignedEnv, "1")
+	err = builder.LockImage(ctx, outputPath, types.ParseArchitectures([]string{"amd64"}), nil, opts)
+	require.ErrorContains(t, err, "APKO_FORBID_UNSIGNED=1 forbids ignoring the signatures of ./testdata/packages")
+
+	_, err = build.New(ctx, nil, build.WithUnsignedRepositories(map[string]string{"./testdata/packages": ""}))
+	require.ErrorContains(t, err, "needs a reason")
+}
+
+func TestLockSingleArch(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	golden, err := pkglock.FromFile(filepath.Join("testdata", "apko.lock.json"))
+	require.NoError(t, err)
+
+	// Change the locked aarch64 packages, which should be kept as they are.
+	previous := golden
+	previous.Contents.Packages = slices.Clone(golden.Contents.Packages)
+	for i, p := range previous.Contents.Packages {
+		if p.Architecture == "aarch64" {
+			previous.Contents.Packages[i].Version = "0.9.0-r0"
+		}
 	}
-	for _, tt := range tests {
-		t.Run(tt.value, func(t *testing.T) {
-			if got, _ := cli.RemoveLabel(tt.value); got != tt.want {
-				t.Errorf("RemoveLabel() = %v, want %v", got, tt.want)
-			}
-		})
+	outputPath := filepath.Join(tmp, "apko.lock.json")
+	require.NoError(t, previous.SaveToFile(outputPath))
+
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"})}
+	require.NoError(t, builder.LockImage(ctx, outputPath, types.ParseArchitectures([]string{"amd64"}), nil, opts))
+
+	got, err := pkglock.FromFile(outputPath)
+	require.NoError(t, err)
+	require.Equal(t, previous, got)
+}
+
+func TestLockUpdate(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"})}
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	outputPath := filepath.Join(tmp, "apko.lock.json")
+
+	require.ErrorContains(t, builder.LockImage(ctx, outputPath, archs, []string{"replayout"}, opts), "reading existing lockfile")
+
+	golden, err := os.ReadFile(filepath.Join("testdata", "apko.lock.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(outputPath, golden, 0o644))
+	require.NoError(t, builder.LockImage(ctx, outputPath, archs, []string{"replayout"}, opts))
+
+	got, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	require.Equal(t, string(golden), string(got))
+}
+
+func TestLockOutdated(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	l, err := pkglock.FromFile(filepath.Join("testdata", "apko.lock.json"))
+	require.NoError(t, err)
+	for i, p := range l.Contents.Packages {
+		if p.Architecture == "x86_64" && p.Name == "replayout" {
+			l.Contents.Packages[i].Version = "0.9.0-r0"
+		}
+	}
+	lockfile := filepath.Join(tmp, "apko.lock.json")
+	require.NoError(t, l.SaveToFile(lockfile))
+
+	var buf bytes.Buffer
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"})}
+	require.NoError(t, cli.LockOutdatedCmd(ctx, lockfile, &buf, "json", opts))
+
+	var got struct {
+		Updates []pkglock.Update `json:"updates"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, []pkglock.Update{{
+		Name:         "replayout",
+		Architecture: "x86_64",
+		Current:      "0.9.0-r0",
+		Candidate:    "1.0.0-r0",
+		Repository:   "./testdata/packages/x86_64",
+	}}, got.Updates)
+}
+
+func TestResolvePlan(t *testing.T) {
+	ctx := context.Background()
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{build.WithConfig("apko.yaml", []string{"testdata"})}
+
+	var first, second bytes.Buffer
+	require.NoError(t, cli.ResolvePlanCmd(ctx, &first, archs, opts...))
+	require.NoError(t, cli.ResolvePlanCmd(ctx, &second, archs, opts...))
+	require.Equal(t, first.String(), second.String(), "the plan is written the same way each time")
+
+	doc, err := plan.Read(&first)
+	require.NoError(t, err)
+	require.Equal(t, plan.Version, doc.Version)
+	require.Len(t, doc.Archs, 2)
+	require.Equal(t, "aarch64", doc.Archs[0].Arch)
+	require.Equal(t, "x86_64", doc.Archs[1].Arch)
+
+	// The packages and their checksums match the lockfile of the same
+	// configuration.
+	l, err := pkglock.FromFile(filepath.Join("testdata", "apko.lock.json"))
+	require.NoError(t, err)
+	locked := map[string]string{}
+	for _, p := range l.Contents.Packages {
+		locked[p.Architecture+"/"+p.Name] = p.Checksum
+	}
+	planned := map[string]string{}
+	for _, a := range doc.Archs {
+		for _, p := range a.Packages {
+			planned[a.Arch+"/"+p.Name] = p.Checksum
+		}
 	}
+	require.Equal(t, locked, planned)
 }
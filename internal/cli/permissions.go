@@ -0,0 +1,49 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// permissionsFlags are the flags which normalize the ownership and
+// permissions of the files installed from packages.
+type permissionsFlags struct {
+	policy          apk.PermissionsPolicy
+	baseDirectories string
+}
+
+func (f *permissionsFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.policy.RootOwned, "normalize-ownership", false, "make root (uid and gid 0) own every file installed from packages")
+	cmd.Flags().BoolVar(&f.policy.StripSetID, "strip-setid", false, "clear the setuid and setgid bits of every file installed from packages, but those of --keep-setid")
+	cmd.Flags().StringSliceVar(&f.policy.KeepSetID, "keep-setid", nil, "absolute paths, or glob patterns, of the files which keep their setuid and setgid bits with --strip-setid")
+	cmd.Flags().StringVar(&f.baseDirectories, "base-directories", string(apk.BaseDirectoriesStrict), "what to do with base directories, such as /tmp, existing with other permissions than expected: strict fails the build, fix changes their permissions, keep warns and keeps them")
+}
+
+// permissionsPolicy returns the policy set by the flags, or nil when it
+// changes nothing.
+func (f *permissionsFlags) permissionsPolicy() *apk.PermissionsPolicy {
+	if !f.policy.RootOwned && !f.policy.StripSetID {
+		return nil
+	}
+	return &f.policy
+}
+
+// baseDirectoryPolicy returns the base directory policy set by the flags.
+func (f *permissionsFlags) baseDirectoryPolicy() apk.BaseDirectoryPolicy {
+	return apk.BaseDirectoryPolicy(f.baseDirectories)
+}
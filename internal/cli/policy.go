@@ -0,0 +1,35 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/policy/rego"
+)
+
+// policyOption returns the option evaluating the Rego policies in paths, files
+// or directories of them, which are compiled once for all the builds.
+func policyOption(ctx context.Context, paths []string) (build.Option, error) {
+	if len(paths) == 0 {
+		return build.WithPolicy(nil), nil
+	}
+	p, err := rego.Load(ctx, paths...)
+	if err != nil {
+		return nil, err
+	}
+	return build.WithPolicy(p), nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/term"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// ttyRedrawInterval limits how often download progress redraws the line.
+const ttyRedrawInterval = 100 * time.Millisecond
+
+// progressReporter returns the apk.Reporter for the --progress mode, which
+// writes to w, and a function which ends its output. It returns a nil
+// Reporter when progress isn't reported.
+func progressReporter(mode string, w *os.File) (apk.Reporter, func(), error) {
+	switch mode {
+	case "auto":
+		if !term.IsTerminal(int(w.Fd())) { //nolint:gosec
+			return nil, func() {}, nil
+		}
+		fallthrough
+	case "tty":
+		p := &ttyProgress{w: w, archs: map[string]*archProgress{}}
+		return p, p.end, nil
+	case "json":
+		p := &jsonProgress{enc: json.NewEncoder(w)}
+		return p, func() {}, nil
+	case "none":
+		return nil, func() {}, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown progress mode %q, expected one of auto, tty, json or none", mode)
+	}
+}
+
+// jsonProgress writes each event as a line of JSON, for CI.
+type jsonProgress struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (p *jsonProgress) Report(ev apk.ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.enc.Encode(ev)
+}
+
+// ttyProgress redraws a single line with the progress of each architecture.
+type ttyProgress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	archs map[string]*archProgress
+	drawn time.Time
+}
+
+type archProgress struct {
+	expanded, installed, total int
+
+	downloading       string
+	bytes, totalBytes int64
+}
+
+func (p *ttyProgress) Report(ev apk.ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	a, ok := p.archs[ev.Arch]
+	if !ok {
+		a = &archProgress{}
+		p.archs[ev.Arch] = a
+	}
+	switch ev.Phase {
+	case apk.PhaseDownload:
+		a.downloading, a.bytes, a.totalBytes = ev.Package, ev.Bytes, ev.TotalBytes
+		if time.Since(p.drawn) < ttyRedrawInterval {
+			return
+		}
+	case apk.PhaseExpand:
+		a.expanded, a.total = ev.Done, ev.Total
+		if a.downloading == ev.Package {
+			a.downloading = ""
+		}
+	case apk.PhaseInstall:
+		a.installed, a.total = ev.Done, ev.Total
+	}
+	p.draw()
+}
+
+func (p *ttyProgress) draw() {
+	parts := make([]string, 0, len(p.archs))
+	for _, arch := range slices.Sorted(maps.Keys(p.archs)) {
+		a := p.archs[arch]
+		part := fmt.Sprintf("%s: %d/%d fetched, %d/%d installed", arch, a.expanded, a.total, a.installed, a.total)
+		if a.downloading != "" {
+			size := "?"
+			if a.totalBytes > 0 {
+				size = humanize.Bytes(uint64(a.totalBytes)) //nolint:gosec
+			}
+			part += fmt.Sprintf(" (%s %s/%s)", a.downloading, humanize.Bytes(uint64(a.bytes)), size) //nolint:gosec
+		}
+		parts = append(parts, part)
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", strings.Join(parts, " | "))
+	p.drawn = time.Now()
+}
+
+// end moves past the progress line, if one was drawn.
+func (p *ttyProgress) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.drawn.IsZero() {
+		fmt.Fprintln(p.w)
+	}
+}
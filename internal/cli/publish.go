@@ -16,33 +16,57 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/github"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/spf13/cobra"
-	"go.opentelemetry.io/otel"
-
-	"github.com/chainguard-dev/clog"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
 	"chainguard.dev/apko/pkg/sbom"
 )
 
 func publish() *cobra.Command {
+	return publishInternal(false)
+}
+
+func push() *cobra.Command {
+	cmd := publishInternal(true)
+	cmd.Use = "push <config.yaml> [repository]"
+	cmd.Short = "Build an image and publish it by digest only"
+	cmd.Long = `Build an image and publish it to a repository by digest only, without
+tagging it, and print its digest.
+
+Without a repository, the image is published the way ko does, to
+$KO_DOCKER_REPO/<config name>, or $KO_DOCKER_REPO with --bare. Tag the
+image later with "apko tag", e.g. when promoting it to an environment.`
+	cmd.Example = `  digest=$(apko push hello-world.yaml registry.example.com/hello)
+  apko tag "$digest" registry.example.com/hello:v1.0.0 registry.example.com/hello:prod`
+	return cmd
+}
+
+// publishInternal returns the publish command, or with digestOnly the push
+// command, which publishes the image without tagging it.
+func publishInternal(digestOnly bool) *cobra.Command {
 	var imageRefs string
 	var buildDate string
 	var sbomPath string
 	var sbomFormats []string
+	var sbomFiles bool
+	var vexFiles []string
+	var sbomAttestationKey string
 	var archstrs []string
 	var extraKeys []string
 	var extraBuildRepos []string
@@ -50,29 +74,88 @@ func publish() *cobra.Command {
 	var extraPackages []string
 	var rawAnnotations []string
 	var withVCS bool
+	var vcsPath string
+	var vcsTagPrefix string
 	var writeSBOM bool
 	var local bool
+	var attachSBOMs bool
 	var cacheDir string
 	var offline bool
 	var lockfile string
+	var locked bool
+	var frozen bool
 	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var checkEntrypoint bool
+	var policies []string
+	var triggers []string
+	var recordTriggers, firstBootTriggers bool
+	var buildArgs []string
+	var progress string
+	var buildReport string
+	var fetchTimeout, resolveTimeout time.Duration
+	var retry retryFlags
+	var permissions permissionsFlags
+	var scanning scanFlags
+	var maxDownloads int
+	var bandwidthLimit int64
+	var networkAuditLog string
+	var archTags []string
+	var bare bool
+	var koTagNames []string
+	var tagSuffix string
+	var mountFrom []string
+	var chunkSize int64
+	var debug debugFlags
 
 	cmd := &cobra.Command{
-		Use:   "publish <config.yaml> <tag...>",
+		Use:   "publish <config.yaml> [tag...]",
 		Short: "Build and publish an image",
 		Long: `Publish a built image from a YAML configuration file.
 
 It is assumed that you have used "docker login" to store credentials
-in a keychain.`,
-		Example: `  apko publish hello-world.yaml hello:v1.0.0`,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) < 2 {
-				return fmt.Errorf("requires at least 2 arg(s), 1 config file and at least 1 tag for the image")
+in a keychain.
+
+Tags are templates, where {{.Config.Name}} is the name of the config file
+without its extension. Without tags, the image is published the way ko
+does, to $KO_DOCKER_REPO/<config name>, or $KO_DOCKER_REPO with --bare,
+tagged with --tags.`,
+		Example: `  apko publish hello-world.yaml hello:v1.0.0
+
+  # publish to registry.example.com/hello-world:v1.0.0-dev, and each
+  # architecture to registry.example.com/hello-world:v1.0.0-<arch>-dev
+  KO_DOCKER_REPO=registry.example.com apko publish hello-world.yaml \
+    --tags v1.0.0 --tag-suffix -dev \
+    --arch-tag 'registry.example.com/{{.Config.Name}}:v1.0.0-{{.Arch}}'`,
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if len(args) < 1 {
+				return fmt.Errorf("requires at least 1 arg(s), 1 config file and optionally tags for the image")
+			}
+			var tags []string
+			if digestOnly {
+				repo, err := pushRepository(args[0], args[1:], os.Getenv("KO_DOCKER_REPO"), bare)
+				if err != nil {
+					return err
+				}
+				tags = []string{repo}
+			} else {
+				var err error
+				if tags, err = publishTags(args[0], args[1:], os.Getenv("KO_DOCKER_REPO"), bare, koTagNames, tagSuffix); err != nil {
+					return err
+				}
 			}
 
 			if !writeSBOM {
 				sbomFormats = []string{}
 			}
+			scanOption, err := scanning.scanOption(writeSBOM)
+			if err != nil {
+				return err
+			}
+			policyOpt, err := policyOption(cmd.Context(), policies)
+			if err != nil {
+				return err
+			}
 			archs := types.ParseArchitectures(archstrs)
 			annotations, err := parseAnnotations(rawAnnotations)
 			if err != nil {
@@ -83,7 +166,23 @@ in a keychain.`,
 				authn.DefaultKeychain,
 				github.Keychain,
 			)
-			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain)}
+			auditor, closeAuditLog, err := openNetworkAuditLog(networkAuditLog)
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, closeAuditLog()) }()
+
+			// The images are pushed through one transport, whether the
+			// blobs are uploaded in chunks or not.
+			rt := apk.AuditTransport(remote.DefaultTransport, auditor, "")
+			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain), remote.WithTransport(rt)}
+			if p := retry.retryPolicy(cmd); p != nil {
+				remoteOpts = append(remoteOpts, p.RemoteOptionsWithTransport(rt)...)
+			}
+			blobs, err := blobOptions(mountFrom, chunkSize, keychain, rt, retry.retryPolicy(cmd))
+			if err != nil {
+				return err
+			}
 
 			pusher, err := remote.NewPusher(remoteOpts...)
 			if err != nil {
@@ -103,44 +202,81 @@ in a keychain.`,
 			}
 			defer os.RemoveAll(tmp)
 
-			if err := PublishCmd(cmd.Context(), imageRefs, archs, remoteOpts,
-				sbomPath,
-				[]build.Option{
-					build.WithConfig(args[0], []string{}),
-					build.WithBuildDate(buildDate),
-					build.WithSBOM(sbomPath),
-					build.WithSBOMFormats(sbomFormats),
-					build.WithExtraKeys(extraKeys),
-					build.WithExtraBuildRepos(extraBuildRepos),
-					build.WithExtraRuntimeRepos(extraRuntimeRepos),
-					build.WithExtraPackages(extraPackages),
-					build.WithTags(args[1:]...),
-					build.WithVCS(withVCS),
-					build.WithAnnotations(annotations),
-					build.WithCache(cacheDir, offline, apk.NewCache(true)),
-					build.WithLockFile(lockfile),
-					build.WithTempDir(tmp),
-					build.WithIgnoreSignatures(ignoreSignatures),
-				},
-				[]PublishOption{
-					// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
-					WithLocal(local),
-					WithTags(args[1:]...),
-				},
-			); err != nil {
+			reporter, endProgress, err := progressReporter(progress, os.Stderr)
+			if err != nil {
 				return err
 			}
-			return nil
+			defer endProgress()
+
+			normalizations, writeReport := startBuildReport(buildReport)
+			buildOpts := []build.Option{
+				build.WithConfig(args[0], []string{}),
+				build.WithBuildDate(buildDate),
+				build.WithSBOM(sbomPath),
+				sbomFormatsOption(cmd, sbomFormats),
+				build.WithSBOMFiles(sbomFiles),
+				build.WithVEX(vexFiles),
+				build.WithSBOMAttestationKey(sbomAttestationKey),
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRuntimeRepos(extraRuntimeRepos),
+				build.WithExtraPackages(extraPackages),
+				build.WithTags(tags...),
+				build.WithVCS(withVCS),
+				build.WithVCSPath(vcsPath),
+				build.WithVCSTagPrefix(vcsTagPrefix),
+				build.WithAnnotations(annotations),
+				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithLockFile(lockfile),
+				build.WithLocked(locked, frozen),
+				build.WithTempDir(tmp),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithUnsignedRepositories(unsignedRepos),
+				build.WithCheckEntrypoint(checkEntrypoint),
+				build.WithPermissionsPolicy(permissions.permissionsPolicy()),
+				normalizations,
+				build.WithBaseDirectoryPolicy(permissions.baseDirectoryPolicy()),
+				policyOpt,
+				build.WithTriggers(triggers),
+				build.WithRecordTriggers(recordTriggers, firstBootTriggers),
+				scanOption,
+				buildArgsOption(buildArgs),
+				build.WithProgressReporter(reporter),
+				build.WithFetchTimeout(fetchTimeout),
+				build.WithResolveTimeout(resolveTimeout),
+				withRetryPolicy(retry.retryPolicy(cmd)),
+				build.WithMaxConcurrentDownloads(maxDownloads),
+				build.WithBandwidthLimit(bandwidthLimit),
+				build.WithNetworkAuditor(auditor),
+			}
+			// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
+			publishOpts := []builder.PublishOption{
+				builder.WithLocal(local),
+				builder.WithAttachSBOMs(attachSBOMs),
+				builder.WithBlobOptions(blobs),
+				builder.WithDigestOnly(digestOnly),
+			}
+			err = PublishCmd(cmd.Context(), imageRefs, archs, remoteOpts, sbomPath, buildOpts,
+				append(publishOpts, builder.WithTags(tags...), builder.WithArchTags(archTagFunc(args[0], archTags, tagSuffix))))
+			if err == nil && debug.image {
+				err = PublishDebugCmd(cmd.Context(), archs, remoteOpts, sbomPath, tags, debug.packages, buildOpts, publishOpts)
+			}
+			return errors.Join(err, writeReport(cmd.Context()))
 		},
 	}
 
 	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
+	cmd.Flags().StringVar(&vcsPath, "vcs-path", "", "path in the git repository to detect VCS URLs from, instead of the directory of the config")
+	cmd.Flags().StringVar(&vcsTagPrefix, "vcs-tag-prefix", "", "prefix of the git tags the image version is detected from, e.g. foo/ for tags like foo/v1.2.3")
 	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate an SBOM")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "path to write the SBOMs")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config.")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
-	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", sbom.DefaultOptions.Formats, "SBOM formats to output")
+	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", sbom.DefaultOptions.Formats, "SBOM formats to output (spdx, cyclonedx), overriding sbom-formats in the config")
+	cmd.Flags().BoolVar(&sbomFiles, "sbom-files", false, "list the files installed by each package, with their sha256 checksums, in the image SBOMs (makes them much larger)")
+	cmd.Flags().StringSliceVar(&vexFiles, "vex", []string{}, "OpenVEX documents whose statements to bind to the image and write along the SBOMs, and attach to the published index")
+	cmd.Flags().StringVar(&sbomAttestationKey, "sbom-attestation-key", "", "PEM private key to sign the SBOMs and VEX documents with, writing each as an in-toto attestation in a DSSE envelope next to it")
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
@@ -148,101 +284,79 @@ in a keychain.`,
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
+	cmd.Flags().BoolVar(&locked, "locked", false, "require a lockfile, and fail with the list of deviations if any package, index or key is not exactly described by it")
+	cmd.Flags().BoolVar(&frozen, "frozen", false, "like --locked, and do not use the network: the packages, indexes and keys must be in the cache")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().BoolVar(&checkEntrypoint, "check-entrypoint", false, "fail the build if the program of the entrypoint (or cmd), its ELF interpreter or the shared libraries it needs are missing from the image")
+	cmd.Flags().StringSliceVar(&policies, "policy", []string{}, "Rego policies, files or directories of them, to evaluate against the plan of the build before installing anything; their deny rules fail the build and their warn rules are logged")
+	cmd.Flags().StringSliceVar(&triggers, "triggers", []string{}, "packages whose triggers to run in the image after installing the packages, through qemu-user for an architecture the host cannot run (Linux only)")
+	cmd.Flags().BoolVar(&recordTriggers, "record-triggers", false, "record the triggers of the installed packages which are not run in /usr/lib/apko/triggers.json")
+	cmd.Flags().BoolVar(&firstBootTriggers, "first-boot-triggers", false, "record the triggers which are not run, with their scripts and /usr/lib/apko/run-triggers, a script running them once when the image starts")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().DurationVar(&fetchTimeout, "fetch-timeout", 0, "fail the build if fetching the keys of a repository, the indexes or a package takes longer than this (e.g. 5m, default 0 means no timeout)")
+	cmd.Flags().DurationVar(&resolveTimeout, "resolve-timeout", 0, "fail the build if resolving the packages of an architecture takes longer than this (default 0 means no timeout)")
+	retry.addFlags(cmd)
+	permissions.addFlags(cmd)
+	scanning.addFlags(cmd)
+	cmd.Flags().IntVar(&maxDownloads, "max-concurrent-downloads", 0, "maximum number of packages, indexes and keys to download at the same time (default 0 means no limit)")
+	cmd.Flags().StringVar(&networkAuditLog, "network-audit-log", "", "append every request made to the repositories and registries, with its status, size and digest, to this file as JSON lines")
+	cmd.Flags().Int64Var(&bandwidthLimit, "bandwidth-limit", 0, "maximum total bandwidth of the downloads, in bytes per second (default 0 means no limit)")
+	cmd.Flags().StringVar(&buildReport, "build-report", "", "write the time spent in each phase of the build, and on each package, and the files whose ownership or permissions were normalized, to this file as JSON")
+	cmd.Flags().StringVar(&progress, "progress", "auto", "how to report the progress of installing packages on stderr: auto (tty when stderr is a terminal), tty, json (one event per line, for CI) or none")
+	debug.addFlags(cmd)
 
 	// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
-	cmd.Flags().BoolVar(&local, "local", false, "publish image just to local Docker daemon")
+	cmd.Flags().BoolVar(&attachSBOMs, "attach-sboms", false, "attach the SBOMs to the published index and images as OCI referrers")
 	cmd.Flags().StringVar(&imageRefs, "image-refs", "", "path to file where a list of the published image references will be written")
+	cmd.Flags().BoolVar(&bare, "bare", false, "publish to $KO_DOCKER_REPO itself instead of $KO_DOCKER_REPO/<config name>")
+	if !digestOnly {
+		cmd.Flags().BoolVar(&local, "local", false, "publish image just to local Docker daemon")
+		cmd.Flags().StringSliceVar(&archTags, "arch-tag", []string{}, "templates of tags to also publish the image of each architecture with, where {{.Arch}} is its architecture (e.g. registry.example.com/{{.Config.Name}}-{{.Arch}})")
+		cmd.Flags().StringSliceVarP(&koTagNames, "tags", "t", []string{"latest"}, "without tags, the tags to publish to $KO_DOCKER_REPO with")
+		cmd.Flags().StringVar(&tagSuffix, "tag-suffix", "", "suffix to append to every tag of the image, including those of --arch-tag")
+	}
+	cmd.Flags().StringSliceVar(&mountFrom, "mount-from", []string{}, "repositories of the registry to mount the layers from instead of uploading them, when the registry has them there")
+	cmd.Flags().Int64Var(&chunkSize, "chunk-size", 0, "upload the layers in chunks of this many bytes, resuming interrupted uploads (default 0 means in one request)")
 
 	return cmd
 }
 
-func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architecture, ropt []remote.Option, sbomPath string, buildOpts []build.Option, publishOpts []PublishOption) error {
-	log := clog.FromContext(ctx)
-	ctx, span := otel.Tracer("apko").Start(ctx, "PublishCmd")
-	defer span.End()
-
-	var opts publishOpt
-	for _, opt := range publishOpts {
-		if err := opt(&opts); err != nil {
-			return err
-		}
-	}
-
-	wd, err := os.MkdirTemp("", "apko-*")
+func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architecture, ropt []remote.Option, sbomPath string, buildOpts []build.Option, publishOpts []builder.PublishOption) error {
+	ref, err := builder.PublishImage(ctx, outputRefs, archs, ropt, sbomPath, buildOpts, publishOpts)
 	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
+		return err
 	}
-	defer os.RemoveAll(wd)
 
-	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, buildOpts...)
-	if err != nil {
-		return fmt.Errorf("failed to build image components: %w", err)
-	}
+	// Write the image digest to STDOUT in order to enable command
+	// composition e.g. kn service create --image=$(apko publish ...)
+	fmt.Println(ref)
 
-	var (
-		local           = opts.local
-		tags            = opts.tags
-		builtReferences = make([]string, 0)
-	)
+	return nil
+}
 
-	if local {
-		// TODO: We shouldn't even need to build the index if we're loading a single image.
-		ref, err := oci.LoadIndex(ctx, idx, tags)
+// blobOptions returns how to publish the layers of the images, mounting
+// them from the repositories of mountFrom, and uploading them in chunks of
+// chunkSize bytes, retried according to policy or the default, when set.
+func blobOptions(mountFrom []string, chunkSize int64, keychain authn.Keychain, rt http.RoundTripper, policy *apk.RetryPolicy) (oci.BlobOptions, error) {
+	// The blobs published to one repository are mounted in the next ones.
+	blobs := oci.BlobOptions{Published: &oci.PublishedBlobs{}}
+	for _, r := range mountFrom {
+		repo, err := name.NewRepository(r)
 		if err != nil {
-			return fmt.Errorf("loading index: %w", err)
+			return oci.BlobOptions{}, fmt.Errorf("parsing %q as repository: %w", r, err)
 		}
-		log.Infof("using local option, exiting early")
-		fmt.Println(ref.String())
-		return nil
-	}
-
-	// publish each arch-specific image
-	// TODO: This should just happen as part of PublishIndex.
-	ref, err := name.ParseReference(tags[0])
-	if err != nil {
-		return fmt.Errorf("parsing %q as tag: %w", tags[0], err)
-	}
-	refs, err := oci.PublishImagesFromIndex(ctx, idx, ref.Context(), ropt...)
-	if err != nil {
-		return fmt.Errorf("publishing images from index: %w", err)
+		blobs.MountFrom = append(blobs.MountFrom, repo)
 	}
-	for _, ref := range refs {
-		builtReferences = append(builtReferences, ref.String())
-	}
-
-	// publish the index
-	finalDigest, err := oci.PublishIndex(ctx, idx, tags, ropt...)
-	if err != nil {
-		return fmt.Errorf("publishing image index: %w", err)
-	}
-	builtReferences = append(builtReferences, finalDigest.String())
-
-	// output any file info requested
-	// If provided, this is the name of the file to write digest referenced into
-	if outputRefs != "" {
-		//nolint:gosec // Make image ref file readable by non-root
-		if err := os.WriteFile(outputRefs, []byte(strings.Join(builtReferences, "\n")+"\n"), 0o666); err != nil {
-			return fmt.Errorf("failed to write digest: %w", err)
-		}
-	}
-
-	// copy sboms over to the sbomPath target directory
-	if sbomPath != "" {
-		for _, sbom := range sboms {
-			// because os.Rename fails across partitions, we do our own
-			if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
-				return fmt.Errorf("moving sbom: %w", err)
-			}
+	if chunkSize > 0 {
+		retry := apk.DefaultRetryPolicy()
+		if policy != nil {
+			retry = *policy
 		}
+		blobs.Chunked = &oci.ChunkedUploader{Keychain: keychain, Transport: rt, ChunkSize: chunkSize, Retry: retry}
 	}
-
-	// Write the image digest to STDOUT in order to enable command
-	// composition e.g. kn service create --image=$(apko publish ...)
-	fmt.Println(finalDigest)
-
-	return nil
+	return blobs, nil
 }
 
 func parseAnnotations(rawAnnotations []string) (map[string]string, error) {
@@ -0,0 +1,151 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// imageNameData is the data of the templates of the tags of published
+// images.
+type imageNameData struct {
+	Config struct {
+		// Name is the name of the configuration file, without its extension.
+		Name string
+	}
+	// Arch is the architecture of the image, without slashes (e.g. armv7),
+	// in the templates of per-architecture tags.
+	Arch string
+}
+
+func newImageNameData(config string, arch types.Architecture) imageNameData {
+	var data imageNameData
+	data.Config.Name = configName(config)
+	data.Arch = strings.ReplaceAll(arch.String(), "/", "")
+	return data
+}
+
+// expandTags executes the templates of tags with data.
+func expandTags(templates []string, data imageNameData) ([]string, error) {
+	tags := make([]string, 0, len(templates))
+	for _, t := range templates {
+		tmpl, err := template.New("tag").Option("missingkey=error").Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tag %q: %w", t, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("expanding tag %q: %w", t, err)
+		}
+		tags = append(tags, b.String())
+	}
+	return tags, nil
+}
+
+// koTags returns the tags of the image of config in repo, the way ko names
+// images: <repo>/<config name>, or repo itself when bare is set, tagged
+// with each of tags.
+func koTags(repo, config string, bare bool, tags []string) []string {
+	image := repo
+	if !bare {
+		image = path.Join(repo, configName(config))
+	}
+	refs := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		refs = append(refs, image+":"+tag)
+	}
+	return refs
+}
+
+// withTagSuffix appends suffix to the tag of each reference of refs,
+// tagging references without a tag latest<suffix>.
+func withTagSuffix(refs []string, suffix string) ([]string, error) {
+	if suffix == "" {
+		return refs, nil
+	}
+	suffixed := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		tag, err := name.NewTag(ref)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q as tag: %w", ref, err)
+		}
+		image := strings.TrimSuffix(ref, ":"+tag.TagStr())
+		suffixed = append(suffixed, image+":"+tag.TagStr()+suffix)
+	}
+	return suffixed, nil
+}
+
+// publishTags returns the tags to publish the image of config with: the
+// templates of tags when given, else the tags of the image of config in
+// koRepo with each of koTagNames. suffix is appended to every tag.
+func publishTags(config string, tags []string, koRepo string, bare bool, koTagNames []string, suffix string) ([]string, error) {
+	if len(tags) == 0 {
+		if koRepo == "" {
+			return nil, fmt.Errorf("requires at least 1 tag for the image, or KO_DOCKER_REPO to be set")
+		}
+		tags = koTags(koRepo, config, bare, koTagNames)
+	}
+	tags, err := expandTags(tags, newImageNameData(config, ""))
+	if err != nil {
+		return nil, err
+	}
+	return withTagSuffix(tags, suffix)
+}
+
+// pushRepository returns the repository to push the image of config to:
+// the one of args when given, else the repository of the image of config in
+// koRepo.
+func pushRepository(config string, args []string, koRepo string, bare bool) (string, error) {
+	var repo string
+	switch {
+	case len(args) > 1:
+		return "", fmt.Errorf("requires at most 1 repository, got %d", len(args))
+	case len(args) == 1:
+		repo = args[0]
+	case koRepo == "":
+		return "", fmt.Errorf("requires a repository, or KO_DOCKER_REPO to be set")
+	case bare:
+		repo = koRepo
+	default:
+		repo = path.Join(koRepo, configName(config))
+	}
+	if _, err := name.NewRepository(repo); err != nil {
+		return "", fmt.Errorf("parsing %q as repository: %w", repo, err)
+	}
+	return repo, nil
+}
+
+// archTagFunc returns the tags to publish the image of each architecture of
+// config with, the expansion of templates with suffix appended, or nil
+// without templates.
+func archTagFunc(config string, templates []string, suffix string) func(types.Architecture) ([]string, error) {
+	if len(templates) == 0 {
+		return nil
+	}
+	return func(arch types.Architecture) ([]string, error) {
+		tags, err := expandTags(templates, newImageNameData(config, arch))
+		if err != nil {
+			return nil, err
+		}
+		return withTagSuffix(tags, suffix)
+	}
+}
@@ -16,6 +16,7 @@ package cli_test
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
@@ -29,6 +30,7 @@ import (
 
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
@@ -38,7 +40,9 @@ import (
 	"chainguard.dev/apko/internal/tarfs"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
 	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/vex"
 )
 
 func TestPublish(t *testing.T) {
@@ -72,7 +76,7 @@ func TestPublish(t *testing.T) {
 		build.WithSBOMFormats(sbom.DefaultOptions.Formats),
 		build.WithAnnotations(map[string]string{"foo": "bar"}),
 	}
-	publishOpts := []cli.PublishOption{cli.WithTags(dst)}
+	publishOpts := []builder.PublishOption{builder.WithTags(dst)}
 
 	sbomPath := filepath.Join(tmp, "sboms")
 	err = os.MkdirAll(sbomPath, 0o750)
@@ -95,7 +99,7 @@ func TestPublish(t *testing.T) {
 
 	// This test will fail if we ever make a change in apko that changes the image.
 	// Sometimes, this is intentional, and we need to change this and bump the version.
-	want := "sha256:ca74f5c6d9e4b9d265ed9812aba5bfaa4ff107ea66638df4c325f65b239d96b2"
+	want := "sha256:1fa61fcc5a901ccb87903723089884583d22acfe2f59634de6a0754543575340"
 	require.Equal(t, want, digest.String())
 
 	// Check that the sbomPath is not empty.
@@ -144,7 +148,7 @@ func TestPublishLayering(t *testing.T) {
 		build.WithSBOMFormats(sbom.DefaultOptions.Formats),
 		build.WithAnnotations(map[string]string{"foo": "bar"}),
 	}
-	publishOpts := []cli.PublishOption{cli.WithTags(dst)}
+	publishOpts := []builder.PublishOption{builder.WithTags(dst)}
 
 	sbomPath := filepath.Join(tmp, "sboms")
 	err = os.MkdirAll(sbomPath, 0o750)
@@ -167,7 +171,7 @@ func TestPublishLayering(t *testing.T) {
 
 	// This test will fail if we ever make a change in apko that changes the image.
 	// Sometimes, this is intentional, and we need to change this and bump the version.
-	want := "sha256:d5fe88a41005bc378fc42d3066d4762b2c082e528cd2856e27f4e005031bfd35"
+	want := "sha256:449dd6fab7052fc92743c09511a61b8c4f7c937630332aac1d901fcd0fb0a058"
 	require.Equal(t, want, digest.String())
 
 	im, err := idx.IndexManifest()
@@ -198,3 +202,232 @@ func TestPublishLayering(t *testing.T) {
 		}
 	}
 }
+
+func TestPublishVEX(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	dst := fmt.Sprintf("%s/test/vex", u.Host)
+
+	vexFile := filepath.Join(tmp, "vex.json")
+	require.NoError(t, os.WriteFile(vexFile, []byte(`{
+  "@context": "https://openvex.dev/ns/v0.2.0",
+  "@id": "https://example.com/vex-1",
+  "author": "Example Security",
+  "version": 1,
+  "statements": [{
+    "vulnerability": {"name": "CVE-2024-0001"},
+    "products": [{"@id": "pkg:apk/replaces/pretend-baselayout"}],
+    "status": "not_affected",
+    "justification": "vulnerable_code_not_present"
+  }, {
+    "vulnerability": {"name": "CVE-2024-0002"},
+    "products": [{"@id": "pkg:apk/replaces/not-installed"}],
+    "status": "fixed"
+  }]
+}`), 0o644))
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMFormats(sbom.DefaultOptions.Formats),
+		build.WithVEX([]string{vexFile}),
+	}
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, nil, sbomPath, opts, []builder.PublishOption{builder.WithTags(dst)}))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	desc, err := remote.Head(ref)
+	require.NoError(t, err)
+
+	referrers, err := remote.Referrers(ref.Context().Digest(desc.Digest.String()))
+	require.NoError(t, err)
+	manifest, err := referrers.IndexManifest()
+	require.NoError(t, err)
+	require.Len(t, manifest.Manifests, 1)
+	require.Equal(t, vex.MediaType, manifest.Manifests[0].ArtifactType)
+
+	img, err := remote.Image(ref.Context().Digest(manifest.Manifests[0].Digest.String()))
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	rc, err := layers[0].Uncompressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	attached, err := io.ReadAll(rc)
+	require.NoError(t, err)
+
+	// The attached document is the one written along the SBOMs.
+	written, err := os.ReadFile(filepath.Join(sbomPath, "vex.openvex.json"))
+	require.NoError(t, err)
+	require.Equal(t, written, attached)
+
+	doc := &vex.Document{}
+	require.NoError(t, json.Unmarshal(attached, doc))
+	require.Equal(t, "Example Security", doc.Author)
+	require.Len(t, doc.Statements, 1)
+	require.Equal(t, "CVE-2024-0001", doc.Statements[0].Vulnerability.Name)
+	// The index and both images.
+	require.Len(t, doc.Statements[0].Products, 3)
+	require.True(t, strings.HasPrefix(doc.Statements[0].Products[0].ID, "pkg:oci/vex@sha256%3A"+desc.Digest.Hex))
+	require.Len(t, doc.Statements[0].Products[0].Subcomponents, 2)
+	require.Equal(t, []vex.Component{{ID: "pkg:apk/replaces/pretend-baselayout@1.0.0-r0?arch=x86_64"}}, doc.Statements[0].Products[1].Subcomponents)
+}
+
+func TestPublishAttachSBOMs(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	dst := fmt.Sprintf("%s/test/sboms", u.Host)
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithTags(dst),
+		build.WithSBOMFormats([]string{"spdx", "cyclonedx"}),
+	}
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	require.NoError(t, cli.PublishCmd(ctx, "", archs, nil, sbomPath, opts, []builder.PublishOption{builder.WithTags(dst), builder.WithAttachSBOMs(true)}))
+
+	ref, err := name.ParseReference(dst)
+	require.NoError(t, err)
+	idx, err := remote.Index(ref)
+	require.NoError(t, err)
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+
+	// attached reads the SBOM of each artifact type attached to subject.
+	attached := func(subject v1.Hash) map[string][]byte {
+		referrers, err := remote.Referrers(ref.Context().Digest(subject.String()))
+		require.NoError(t, err)
+		m, err := referrers.IndexManifest()
+		require.NoError(t, err)
+		docs := map[string][]byte{}
+		for _, desc := range m.Manifests {
+			img, err := remote.Image(ref.Context().Digest(desc.Digest.String()))
+			require.NoError(t, err)
+			layers, err := img.Layers()
+			require.NoError(t, err)
+			require.Len(t, layers, 1)
+			rc, err := layers[0].Uncompressed()
+			require.NoError(t, err)
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			require.NoError(t, err)
+			docs[desc.ArtifactType] = data
+		}
+		return docs
+	}
+
+	// The index SBOMs are attached to the index, as written along the image.
+	docs := attached(digest)
+	require.Len(t, docs, 2)
+	for artifactType, file := range map[string]string{
+		"application/spdx+json":          "sbom-index.spdx.json",
+		"application/vnd.cyclonedx+json": "sbom-index.cdx.json",
+	} {
+		written, err := os.ReadFile(filepath.Join(sbomPath, file))
+		require.NoError(t, err)
+		require.Equal(t, written, docs[artifactType], artifactType)
+	}
+
+	// The index SBOM references each per-platform SBOM, which is attached to
+	// its image.
+	index := struct {
+		ExternalDocumentRefs []struct {
+			SPDXDocument string `json:"spdxDocument"`
+		} `json:"externalDocumentRefs"`
+	}{}
+	require.NoError(t, json.Unmarshal(docs["application/spdx+json"], &index))
+	require.Len(t, index.ExternalDocumentRefs, 2)
+
+	namespaces := []string{}
+	for _, m := range manifest.Manifests {
+		docs := attached(m.Digest)
+		require.Len(t, docs, 2)
+		image := struct {
+			Namespace string `json:"documentNamespace"`
+		}{}
+		require.NoError(t, json.Unmarshal(docs["application/spdx+json"], &image))
+		namespaces = append(namespaces, image.Namespace)
+	}
+	require.ElementsMatch(t, namespaces, []string{
+		index.ExternalDocumentRefs[0].SPDXDocument,
+		index.ExternalDocumentRefs[1].SPDXDocument,
+	})
+}
+
+func TestPublishKoNames(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	t.Setenv("KO_DOCKER_REPO", u.Host+"/test")
+
+	imageRefs := filepath.Join(tmp, "refs")
+	cmd := cli.New()
+	cmd.SetArgs([]string{"publish", filepath.Join("testdata", "apko.yaml"),
+		"--sbom=false", "--arch", "amd64,arm64",
+		"--tags", "v1,v1.2", "--tag-suffix", "-dev",
+		"--arch-tag", u.Host + "/test/{{.Config.Name}}-{{.Arch}}:v1",
+		"--image-refs", imageRefs,
+	})
+	require.NoError(t, cmd.ExecuteContext(ctx))
+
+	// The index is published as <repo>/<config name>:<tag><suffix>.
+	ref, err := name.ParseReference(u.Host + "/test/apko:v1-dev")
+	require.NoError(t, err)
+	idx, err := remote.Index(ref)
+	require.NoError(t, err)
+	ref, err = name.ParseReference(u.Host + "/test/apko:v1.2-dev")
+	require.NoError(t, err)
+	_, err = remote.Head(ref)
+	require.NoError(t, err)
+	manifest, err := idx.IndexManifest()
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(imageRefs)
+	require.NoError(t, err)
+	refs := strings.Fields(string(b))
+
+	// Each image is tagged with its architecture and the suffix, and listed
+	// by digest.
+	for _, m := range manifest.Manifests {
+		tagged := fmt.Sprintf("%s/test/apko-%s", u.Host, m.Platform.Architecture)
+		ref, err := name.ParseReference(tagged + ":v1-dev")
+		require.NoError(t, err)
+		desc, err := remote.Head(ref)
+		require.NoError(t, err)
+		require.Equal(t, m.Digest, desc.Digest)
+		require.Contains(t, refs, tagged+"@"+m.Digest.String())
+	}
+	digest, err := idx.Digest()
+	require.NoError(t, err)
+	require.Contains(t, refs, u.Host+"/test/apko@"+digest.String())
+
+	// Without tags nor KO_DOCKER_REPO, there is nowhere to publish.
+	t.Setenv("KO_DOCKER_REPO", "")
+	cmd = cli.New()
+	cmd.SetArgs([]string{"publish", filepath.Join("testdata", "apko.yaml"), "--sbom=false"})
+	require.ErrorContains(t, cmd.ExecuteContext(ctx), "KO_DOCKER_REPO")
+}
@@ -0,0 +1,44 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/report"
+)
+
+// startBuildReport records the timings of the phases of the command, and the
+// files its permissions policy normalized, when path is set. It returns the
+// option which records the latter, and a function which writes the report to
+// path as JSON.
+func startBuildReport(path string) (build.Option, func(context.Context) error) {
+	if path == "" {
+		return build.WithNormalizationRecorder(nil), func(context.Context) error { return nil }
+	}
+	rec := report.NewRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	otel.SetTracerProvider(tp)
+	return build.WithNormalizationRecorder(rec), func(ctx context.Context) error {
+		if err := tp.Shutdown(ctx); err != nil {
+			return err
+		}
+		return rec.Report().WriteFile(path)
+	}
+}
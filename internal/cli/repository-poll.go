@@ -0,0 +1,171 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/feed"
+)
+
+func repositoryPoll() *cobra.Command {
+	var state string
+	var config string
+	var format string
+	var archstrs []string
+	var extraKeys []string
+	var extraRepos []string
+	var ignoreSignatures bool
+	var unsignedRepos map[string]string
+	var cacheDir string
+
+	cmd := &cobra.Command{
+		Use:   "poll --state <state.json>",
+		Short: "List what changed in the repositories since they were last polled",
+		Long: `List what changed in the repositories since they were last polled, and
+record their state for the next poll, so that automation rebuilds images when
+their packages or keys change rather than on a schedule.
+
+The repositories and keyring are those of the configuration, if any, and the
+ones given with --repository-append and --keyring-append, with the keys a
+build discovers from them. The indexes of each architecture are polled: those
+given with --arch, or else those of the configuration, or else all of them.
+
+The events are:
+  new-package         a package which was not in a repository
+  new-version         a newer version of a package
+  withdrawn           the latest version of a package was taken out, leaving
+                      an older one the latest
+  removed             a package which is no longer in a repository
+  repository-added    a repository which was not polled before
+  repository-removed  a repository which is no longer polled
+  key-added           a key which was not in the keyring
+  key-rotated         a key whose contents changed
+  key-removed         a key which is no longer in the keyring
+
+The state file records the latest version of each package of each index, the
+checksum of each index and the checksum of each key. When it doesn't exist,
+the poll only records the state. The packages of a repository which was not
+polled before are recorded without an event each.
+
+With -o json, the events are written in a form automation can act on.`,
+		Example: `  apko repository poll --state feed.json --config apko.yaml -o json
+  apko repo poll --state feed.json -r https://packages.wolfi.dev/os -k https://packages.wolfi.dev/os/wolfi-signing.rsa.pub --arch x86_64`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if state == "" {
+				return errors.New("--state is required")
+			}
+			if config == "" && len(extraRepos) == 0 {
+				return errors.New("--config or --repository-append is required")
+			}
+			opts := []build.Option{
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraRuntimeRepos(extraRepos),
+				build.WithIgnoreSignatures(ignoreSignatures),
+				build.WithUnsignedRepositories(unsignedRepos),
+				build.WithCache(cacheDir, false, apk.NewCache(true)),
+			}
+			if config != "" {
+				opts = append(opts, build.WithConfig(config, []string{}))
+			}
+			return RepositoryPollCmd(cmd.Context(), cmd.OutOrStdout(), state, format, types.ParseArchitectures(archstrs), opts...)
+		},
+	}
+
+	cmd.Flags().StringVar(&state, "state", "", "path to the file recording the state of the repositories, which is updated")
+	cmd.Flags().StringVar(&config, "config", "", "the configuration whose repositories and keyring to poll")
+	cmd.Flags().StringVarP(&format, "output", "o", "text", "output format, one of: text, json")
+	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures whose indexes to poll (e.g., x86_64,arm64) -- default is those of the configuration, or all")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to poll")
+	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
+	cmd.Flags().StringToStringVar(&unsignedRepos, "ignore-signatures-for", map[string]string{}, "ignore the signatures of a repository, giving why (REPOSITORY=reason, can be repeated)")
+	_ = cmd.Flags().MarkDeprecated("ignore-signatures", "use --ignore-signatures-for with the repositories and why instead")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	return cmd
+}
+
+// RepositoryPollCmd polls the indexes of the repositories for archs and the
+// keyring, writes what changed since the state saved at stateFile to w in
+// format, and saves their state there.
+func RepositoryPollCmd(ctx context.Context, w io.Writer, stateFile, format string, archs []types.Architecture, opts ...build.Option) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+	}
+	prev, err := feed.FromFile(stateFile)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+	if len(archs) == 0 {
+		archs = ic.Archs
+	}
+	if len(archs) == 0 {
+		archs = types.AllArchs
+	}
+
+	// The repositories and keyring are the same for all the archs, so
+	// their indexes are fetched with those of a single build.
+	bc, err := build.New(ctx, apkfs.DirFS(ctx, wd, apkfs.WithCreateDir()), append(slices.Clone(opts), build.WithArch(archs[0]))...)
+	if err != nil {
+		return err
+	}
+	keys, err := bc.Keyring()
+	if err != nil {
+		return err
+	}
+	var next feed.State
+	for _, arch := range archs {
+		indexes, err := bc.RepositoryIndexesFor(ctx, arch)
+		if err != nil {
+			return fmt.Errorf("failed to get repository indexes for %s: %w", arch, err)
+		}
+		next.Merge(feed.Snapshot(indexes, keys))
+	}
+
+	events := next.Changes(prev)
+	if format == "json" {
+		err = feed.WriteEventsJSON(w, events)
+	} else {
+		err = feed.WriteEventsText(w, events)
+	}
+	if err != nil {
+		return err
+	}
+	return next.SaveToFile(stateFile)
+}
@@ -0,0 +1,74 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/feed"
+)
+
+func TestRepositoryPoll(t *testing.T) {
+	ctx := context.Background()
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	stateFile := filepath.Join(t.TempDir(), "feed.json")
+	opts := []build.Option{
+		build.WithExtraKeys([]string{"testdata/melange.rsa.pub"}),
+		build.WithExtraRuntimeRepos([]string{"testdata/packages"}),
+	}
+	const index = "testdata/packages/x86_64/APKINDEX.tar.gz"
+
+	// The first poll only records the state.
+	var out bytes.Buffer
+	require.NoError(t, cli.RepositoryPollCmd(ctx, &out, stateFile, "json", archs, opts...))
+	require.JSONEq(t, `{"events": []}`, out.String())
+	state, err := feed.FromFile(stateFile)
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0-r0", state.Repositories[index].Packages["replayout"])
+	require.Contains(t, state.Repositories, "testdata/packages/aarch64/APKINDEX.tar.gz")
+	require.Contains(t, state.Keys, "melange.rsa.pub")
+
+	// Pretend the repository and keyring changed since.
+	r := state.Repositories[index]
+	r.Checksum = ""
+	r.Packages["replayout"] = "0.9.0-r0"
+	r.Packages["gone"] = "1.0.0-r0"
+	state.Repositories[index] = r
+	state.Keys["melange.rsa.pub"] = "sha256-old"
+	require.NoError(t, state.SaveToFile(stateFile))
+
+	out.Reset()
+	require.NoError(t, cli.RepositoryPollCmd(ctx, &out, stateFile, "json", archs, opts...))
+	require.JSONEq(t, `{"events": [
+		{"type": "key-rotated", "key": "melange.rsa.pub"},
+		{"type": "removed", "repository": "testdata/packages/x86_64/APKINDEX.tar.gz", "package": "gone", "previous": "1.0.0-r0"},
+		{"type": "new-version", "repository": "testdata/packages/x86_64/APKINDEX.tar.gz", "package": "replayout", "previous": "0.9.0-r0", "version": "1.0.0-r0"}
+	]}`, out.String())
+
+	// Which are recorded, so that the next poll has none.
+	out.Reset()
+	require.NoError(t, cli.RepositoryPollCmd(ctx, &out, stateFile, "text", archs, opts...))
+	require.Equal(t, "EVENT  NAME  PREVIOUS  VERSION  REPOSITORY\n", out.String())
+
+	require.ErrorContains(t, cli.RepositoryPollCmd(ctx, &out, stateFile, "yaml", archs, opts...), `unsupported format "yaml"`)
+}
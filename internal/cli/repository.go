@@ -0,0 +1,193 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"chainguard.dev/apko/pkg/apk/auth"
+	"chainguard.dev/apko/pkg/repo"
+)
+
+func repository() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "repository",
+		Aliases: []string{"repo"},
+		Short:   "Manage apk repositories and their credentials",
+	}
+	cmd.AddCommand(repositoryLogin())
+	cmd.AddCommand(repositoryLogout())
+	cmd.AddCommand(repositoryPublish())
+	cmd.AddCommand(repositoryPoll())
+	return cmd
+}
+
+func repositoryLogin() *cobra.Command {
+	var username string
+	var passwordStdin bool
+	var store string
+
+	cmd := &cobra.Command{
+		Use:   "login <host>[/<path>]",
+		Short: "Save the credentials of apk repositories",
+		Long: `Save the credentials of the apk repositories of a host, or of the
+repositories under a path of a host, which builds then use instead of the
+HTTP_AUTH environment variable.
+
+The password is read from the terminal, or from stdin with --password-stdin,
+so that it is not left in the shell history. It is kept in the keychain of
+the OS by default, or with --store=file encrypted in the credentials file,
+with a key derived from the APKO_CREDENTIALS_PASSPHRASE environment
+variable, which builds then need as well.
+
+The credentials file is $APKO_CREDENTIALS_FILE, or apko/credentials.json in
+the user configuration directory.`,
+		Example: `  apko repository login apk.example.com -u build
+  echo "$TOKEN" | apko repository login apk.example.com/private -u build --password-stdin --store=file`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readPassword(cmd, passwordStdin)
+			if err != nil {
+				return err
+			}
+			path, err := auth.DefaultCredentialsPath()
+			if err != nil {
+				return err
+			}
+			if err := auth.SaveCredentials(path, args[0], username, password, store); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Saved the credentials of %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&username, "username", "u", "user", "the user name")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from stdin")
+	cmd.Flags().StringVar(&store, "store", auth.StoreKeychain, "where to keep the password: keychain or file")
+	return cmd
+}
+
+func repositoryLogout() *cobra.Command {
+	return &cobra.Command{
+		Use:     "logout <host>[/<path>]",
+		Short:   "Remove the saved credentials of apk repositories",
+		Example: `  apko repository logout apk.example.com`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := auth.DefaultCredentialsPath()
+			if err != nil {
+				return err
+			}
+			if err := auth.DeleteCredentials(path, args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed the credentials of %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func repositoryPublish() *cobra.Command {
+	var to string
+	var signingKey string
+	var s3Endpoint string
+
+	cmd := &cobra.Command{
+		Use:   "publish --to <destination> --signing-key <key> <package.apk>...",
+		Short: "Publish packages and a signed index to a repository",
+		Long: `Publish packages to a repository, with the APKINDEX.tar.gz of each of their
+architectures signed with the private key. The packages of the existing index
+are kept, and replaced by packages of the same name and version.
+
+The destination is one of:
+  s3://bucket/path  a path in an S3 bucket, with the credentials and region of
+                    the default AWS configuration; --s3-endpoint addresses S3
+                    compatible storage instead
+  oci://ref         an OCI artifact with a layer per file, titled by its path,
+                    as oras push stores a directory
+  a directory       a local repository
+
+The packages are uploaded first and each index last, so the index never names
+a package which isn't there yet. Files in a directory are written to a
+temporary file and renamed, objects in S3 are replaced by a single PUT, and an
+OCI artifact is replaced by pushing its manifest once its files are uploaded.
+
+The passphrase of an encrypted key is read from the ` + signingKeyPassphraseEnv + `
+environment variable.`,
+		Example: `  apko repo publish --to s3://my-bucket/os --signing-key melange.rsa packages/*/*.apk
+  apko repo publish --to oci://registry.example.com/os:latest --signing-key melange.rsa packages/x86_64/*.apk`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if to == "" {
+				return errors.New("--to is required")
+			}
+			if signingKey == "" {
+				return errors.New("--signing-key is required")
+			}
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			ctx := cmd.Context()
+			s, err := repo.Open(ctx, to,
+				repo.WithS3Endpoint(s3Endpoint),
+				repo.WithRemoteOptions(remote.WithAuthFromKeychain(keychain)),
+			)
+			if err != nil {
+				return err
+			}
+			return repo.Publish(ctx, s, args, signingKey, os.Getenv(signingKeyPassphraseEnv))
+		},
+	}
+
+	cmd.Flags().StringVar(&to, "to", "", "the repository to publish to: s3://bucket/path, oci://ref or a directory")
+	cmd.Flags().StringVar(&signingKey, "signing-key", "", "private key to sign the indexes with")
+	cmd.Flags().StringVar(&s3Endpoint, "s3-endpoint", "", "endpoint of S3 compatible storage, whose buckets are addressed by path (e.g. http://localhost:9000)")
+	return cmd
+}
+
+// readPassword reads the password from stdin, or prompts for it on the
+// terminal.
+func readPassword(cmd *cobra.Command, fromStdin bool) (string, error) {
+	if fromStdin {
+		b, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", fmt.Errorf("reading the password from stdin: %w", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	fd := int(os.Stdin.Fd()) //nolint:gosec
+	if !term.IsTerminal(fd) {
+		return "", errors.New("stdin is not a terminal, use --password-stdin to read the password from it")
+	}
+	fmt.Fprint(cmd.ErrOrStderr(), "Password: ")
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", fmt.Errorf("reading the password: %w", err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/plan"
+)
+
+// ResolvePlanCmd resolves the packages of the image for each architecture,
+// as DryRunCmd does, and writes the plan of the build to w as a versioned
+// JSON document.
+func ResolvePlanCmd(ctx context.Context, w io.Writer, archs []types.Architecture, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
+		return fmt.Errorf("building with base image is supported only with a lockfile")
+	}
+
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	log.Infof("Resolving packages for %d architectures: %+v", len(ic.Archs), ic.Archs)
+
+	opts = append(opts, build.WithImageConfiguration(*ic))
+	mc, err := build.NewMultiArch(ctx, ic.Archs, opts...)
+	if err != nil {
+		return err
+	}
+	plans, err := mc.Plans(ctx)
+	if err != nil {
+		return err
+	}
+
+	doc, err := plan.New(plan.Config{Name: o.ImageConfigFile, Checksum: o.ImageConfigChecksum}, ic.Annotations, plans)
+	if err != nil {
+		return err
+	}
+	return doc.Write(w)
+}
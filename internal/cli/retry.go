@@ -0,0 +1,57 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+)
+
+// retryFlags are the flags which tune how failed requests to repositories
+// and registries are retried.
+type retryFlags struct {
+	policy apk.RetryPolicy
+}
+
+func (f *retryFlags) addFlags(cmd *cobra.Command) {
+	def := apk.DefaultRetryPolicy()
+	cmd.Flags().IntVar(&f.policy.MaxRetries, "retry-max", def.MaxRetries, "number of times a failed request to a repository or registry is retried")
+	cmd.Flags().DurationVar(&f.policy.MinBackoff, "retry-min-backoff", def.MinBackoff, "minimum wait before retrying a failed request")
+	cmd.Flags().DurationVar(&f.policy.MaxBackoff, "retry-max-backoff", def.MaxBackoff, "maximum wait before retrying a failed request, unless the response asks for longer with Retry-After")
+	cmd.Flags().IntSliceVar(&f.policy.RetryOnStatus, "retry-on-status", nil, "HTTP status codes of the responses to retry (default 429 and 5xx but 501)")
+	cmd.Flags().DurationVar(&f.policy.Budget, "retry-budget", 0, "maximum time to spend on a request and its retries (default 0 means no limit)")
+}
+
+// retryPolicy returns the policy set by the flags, or nil when none is set.
+func (f *retryFlags) retryPolicy(cmd *cobra.Command) *apk.RetryPolicy {
+	for _, name := range []string{"retry-max", "retry-min-backoff", "retry-max-backoff", "retry-on-status", "retry-budget"} {
+		if cmd.Flags().Changed(name) {
+			return &f.policy
+		}
+	}
+	return nil
+}
+
+// withRetryPolicy sets the retry policy of the build, if p is set.
+func withRetryPolicy(p *apk.RetryPolicy) build.Option {
+	return func(bc *build.Context) error {
+		if p == nil {
+			return nil
+		}
+		return build.WithRetryPolicy(*p)(bc)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+)
+
+// The runtimes apko run can run an image with.
+const (
+	runtimeAuto   = "auto"
+	runtimeDocker = "docker"
+	runtimePodman = "podman"
+	runtimeChroot = "chroot"
+)
+
+func runCmd() *cobra.Command {
+	var config string
+	var archstr string
+	var runtimeName string
+	var timeout time.Duration
+	var extraKeys []string
+	var extraBuildRepos []string
+	var extraRuntimeRepos []string
+	var extraPackages []string
+	var includePaths []string
+	var buildArgs []string
+	var cacheDir string
+	var offline bool
+	var lockfile string
+
+	cmd := &cobra.Command{
+		Use:   "run -f <config.yaml> [-- <command> [args...]]",
+		Short: "Build an image and run a command in it",
+		Long: `Build an image and run a command in it, as a smoke test.
+
+The image is built for a single architecture, the host's by default, without
+SBOMs, and run with the given command, or with its own entrypoint and cmd if
+none is given. The packages come from the cache as in any other build. The
+result is reported with the exit status and the time the command took, and
+apko run fails if the command does.
+
+The runtime is one of:
+
+  docker, podman: the image is loaded, run with "<runtime> run --rm" and
+                  removed afterwards
+  chroot:         the image is extracted and the command run chrooted into it,
+                  in a user namespace, without isolation of the network or
+                  the processes, and through qemu-user for an architecture
+                  the host cannot run; Linux only
+  auto:           docker or podman if either is installed, chroot otherwise`,
+		Example: `  apko run -f image.yaml -- /usr/bin/nginx -t
+  apko run -f image.yaml --runtime chroot --timeout 30s`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config == "" {
+				return errors.New("--file is required")
+			}
+			if cmd.ArgsLenAtDash() > 0 {
+				return fmt.Errorf("unexpected arguments before --: %v", args[:cmd.ArgsLenAtDash()])
+			}
+			return RunCmd(cmd.Context(), runtimeName, types.ParseArchitecture(archstr), args, timeout, cmd.ErrOrStderr(),
+				build.WithConfig(config, includePaths),
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraBuildRepos(extraBuildRepos),
+				build.WithExtraRuntimeRepos(extraRuntimeRepos),
+				build.WithExtraPackages(extraPackages),
+				build.WithIncludePaths(includePaths),
+				buildArgsOption(buildArgs),
+				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithLockFile(lockfile),
+			)
+		},
+	}
+
+	cmd.Flags().StringVarP(&config, "file", "f", "", "the configuration of the image to run")
+	cmd.Flags().StringVar(&archstr, "arch", runtime.GOARCH, "architecture of the image to build and run")
+	cmd.Flags().StringVar(&runtimeName, "runtime", runtimeAuto, "runtime to run the image with, one of: auto, docker, podman, chroot")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "fail if the command runs longer than this, not counting building and loading the image (default 0 means no timeout)")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
+	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, etc.)")
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "values of build arguments referenced as ${NAME} in the configuration (NAME=value, can be repeated)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
+	return cmd
+}
+
+// errRunTimeout is the cause of the cancellation of a command which runs longer
+// than the timeout of apko run.
+var errRunTimeout = errors.New("the command timed out")
+
+// RunCmd builds the image of opts for arch, runs argv in it, or its
+// entrypoint and cmd if argv is empty, with the runtime, and reports the
+// result to w. It fails if the command does, or runs longer than timeout.
+func RunCmd(ctx context.Context, runtimeName string, arch types.Architecture, argv []string, timeout time.Duration, w io.Writer, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	runtimeName, err := selectRuntime(runtimeName)
+	if err != nil {
+		return err
+	}
+
+	wd, err := os.MkdirTemp("", "apko-run-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	opts = append(opts, build.WithTempDir(wd), build.WithSBOMFormats(nil))
+	idx, _, err := builder.BuildComponents(ctx, wd, []types.Architecture{arch}, opts...)
+	if err != nil {
+		return err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return err
+	}
+	if len(im.Manifests) != 1 {
+		return fmt.Errorf("expected the image of one architecture, got %d", len(im.Manifests))
+	}
+	img, err := idx.Image(im.Manifests[0].Digest)
+	if err != nil {
+		return err
+	}
+	log.Infof("running %s image %s with %s", arch, im.Manifests[0].Digest, runtimeName)
+
+	var run func(context.Context) error
+	switch runtimeName {
+	case runtimeChroot:
+		run, err = prepareChroot(wd, arch, img, argv)
+	default:
+		var cleanup func()
+		run, cleanup, err = prepareContainer(ctx, runtimeName, wd, im.Manifests[0].Platform, img, argv)
+		if cleanup != nil {
+			defer cleanup()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// The timeout only applies to the command, not to preparing the image.
+	runCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeoutCause(ctx, timeout, errRunTimeout)
+		defer cancel()
+	}
+
+	what := "the entrypoint"
+	if len(argv) != 0 {
+		what = fmt.Sprintf("%q", strings.Join(argv, " "))
+	}
+	start := time.Now()
+	err = run(runCtx)
+	elapsed := time.Since(start).Round(time.Millisecond)
+
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("%s was stopped after %s: %w", what, elapsed, context.Cause(ctx))
+	case errors.Is(context.Cause(runCtx), errRunTimeout):
+		return fmt.Errorf("%s did not finish within %s", what, timeout)
+	case errors.As(err, &exitErr):
+		return fmt.Errorf("%s exited with status %d after %s", what, exitErr.ExitCode(), elapsed)
+	case err != nil:
+		return err
+	}
+	fmt.Fprintf(w, "%s exited with status 0 after %s\n", what, elapsed)
+	return nil
+}
+
+// selectRuntime returns the runtime to use for name, resolving auto to the
+// first of docker and podman which is installed, or else chroot.
+func selectRuntime(name string) (string, error) {
+	switch name {
+	case runtimeDocker, runtimePodman, runtimeChroot:
+		return name, nil
+	case runtimeAuto:
+		for _, rt := range []string{runtimeDocker, runtimePodman} {
+			if _, err := exec.LookPath(rt); err == nil {
+				return rt, nil
+			}
+		}
+		return runtimeChroot, nil
+	default:
+		return "", fmt.Errorf("unsupported runtime %q, must be one of: auto, docker, podman, chroot", name)
+	}
+}
+
+// prepareContainer loads img into a container runtime, docker or podman, and
+// returns the function running argv in a container of it on platform, the
+// one of the image in the index, and the one removing the image from the
+// runtime.
+func prepareContainer(ctx context.Context, runtimeName, wd string, platform *v1.Platform, img v1.Image, argv []string) (func(context.Context) error, func(), error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, nil, err
+	}
+	tag, err := name.NewTag("apko.local/run:" + digest.Hex[:12])
+	if err != nil {
+		return nil, nil, err
+	}
+	tarPath := filepath.Join(wd, "run.tar")
+	if err := tarball.WriteToFile(tarPath, tag, img); err != nil {
+		return nil, nil, fmt.Errorf("writing image tarball: %w", err)
+	}
+
+	load := exec.CommandContext(ctx, runtimeName, "load", "-i", tarPath)
+	if out, err := load.CombinedOutput(); err != nil {
+		return nil, nil, fmt.Errorf("loading the image with %s: %w: %s", runtimeName, err, out)
+	}
+	// The image is removed even when the run was cancelled.
+	cleanup := func() {
+		if out, err := exec.Command(runtimeName, "rmi", tag.String()).CombinedOutput(); err != nil {
+			clog.FromContext(ctx).Warnf("removing %s with %s: %v: %s", tag, runtimeName, err, out)
+		}
+	}
+
+	// Killing the runtime client does not stop the container, so it is
+	// named to be removed on timeout.
+	container := fmt.Sprintf("apko-run-%s-%d", digest.Hex[:12], os.Getpid())
+	args := []string{"run", "--rm", "-i", "--name", container, "--platform", platform.OS + "/" + platform.Architecture}
+	if platform.Variant != "" {
+		args[len(args)-1] += "/" + platform.Variant
+	}
+	if len(argv) != 0 {
+		args = append(args, "--entrypoint", argv[0], tag.String())
+		args = append(args, argv[1:]...)
+	} else {
+		args = append(args, tag.String())
+	}
+	return func(ctx context.Context) error {
+		run := exec.CommandContext(ctx, runtimeName, args...)
+		run.Stdin, run.Stdout, run.Stderr = os.Stdin, os.Stdout, os.Stderr
+		err := run.Run()
+		if ctx.Err() != nil {
+			_ = exec.Command(runtimeName, "rm", "-f", container).Run()
+		}
+		return err
+	}, cleanup, nil
+}
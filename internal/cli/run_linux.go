@@ -0,0 +1,133 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package cli
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/executor"
+)
+
+// prepareChroot extracts img under wd and returns the function running argv,
+// or its entrypoint and cmd, in it with the default executor for arch.
+func prepareChroot(wd string, arch types.Architecture, img v1.Image, argv []string) (func(context.Context) error, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if len(argv) == 0 {
+		argv = append(append([]string{}, cfg.Config.Entrypoint...), cfg.Config.Cmd...)
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("the image has no entrypoint or cmd, and no command was given")
+	}
+	e, err := executor.Default(arch)
+	if err != nil {
+		return nil, err
+	}
+
+	root := filepath.Join(wd, "rootfs")
+	if err := os.Mkdir(root, 0o755); err != nil {
+		return nil, err
+	}
+	rc := mutate.Extract(img)
+	defer rc.Close()
+	if err := extractRootfs(rc, root); err != nil {
+		return nil, fmt.Errorf("extracting the image: %w", err)
+	}
+
+	return func(ctx context.Context) error {
+		return e.Execute(ctx, root, apk.Command{
+			Args:   argv,
+			Env:    cfg.Config.Env,
+			Dir:    cfg.Config.WorkingDir,
+			Stdin:  os.Stdin,
+			Stdout: os.Stdout,
+			Stderr: os.Stderr,
+		})
+	}, nil
+}
+
+// extractRootfs extracts the flattened filesystem of an image into root.
+// Ownership and device files cannot be created without privileges, so they
+// are left out.
+func extractRootfs(r io.Reader, root string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		dir, base := path.Split(path.Clean("/" + hdr.Name))
+		if base == "" {
+			continue
+		}
+		// Parents may be symlinks in the image, resolved as in a chroot.
+		parent, err := executor.Resolve(root, dir)
+		if err != nil {
+			return fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		target := filepath.Join(parent, base)
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, mode|0o700); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+		case tar.TypeReg:
+			w, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, mode|0o600)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, tr); err != nil {
+				w.Close()
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			source, err := executor.Resolve(root, path.Clean("/"+hdr.Linkname))
+			if err != nil {
+				return fmt.Errorf("%s: %w", hdr.Name, err)
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	config := filepath.Join("testdata", "apko.yaml")
+	amd64 := types.ParseArchitecture("amd64")
+
+	// docker is a stand-in for the runtime which logs its arguments, and
+	// sleeps for FAKE_SLEEP then exits with the status in FAKE_EXIT when
+	// running.
+	bin := t.TempDir()
+	log := filepath.Join(bin, "log")
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "docker"), []byte(`#!/bin/sh
+echo "$@" >> `+log+`
+if [ "$1" = run ]; then sleep "${FAKE_SLEEP:-0}"; exit "${FAKE_EXIT:-0}"; fi
+`), 0o755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	t.Run("success", func(t *testing.T) {
+		var out bytes.Buffer
+		err := cli.RunCmd(ctx, "auto", amd64, []string{"/bin/true", "--flag"}, 0, &out, build.WithConfig(config, nil))
+		require.NoError(t, err)
+		require.Contains(t, out.String(), `"/bin/true --flag" exited with status 0 after`)
+
+		b, err := os.ReadFile(log)
+		require.NoError(t, err)
+		require.Regexp(t, `^load -i .*/run.tar\nrun --rm -i --name apko-run-[0-9a-f]{12}-[0-9]+ --platform linux/amd64 --entrypoint /bin/true apko.local/run:[0-9a-f]{12} --flag\nrmi apko.local/run:[0-9a-f]{12}\n$`, string(b))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		t.Setenv("FAKE_SLEEP", "10")
+		require.NoError(t, os.Remove(log))
+		// The timeout does not include building and loading the image.
+		err := cli.RunCmd(ctx, "docker", amd64, nil, time.Second, &bytes.Buffer{}, build.WithConfig(config, nil))
+		require.ErrorContains(t, err, "the entrypoint did not finish within 1s")
+
+		b, err := os.ReadFile(log)
+		require.NoError(t, err)
+		require.Regexp(t, `\nrm -f apko-run-[0-9a-f]{12}-[0-9]+\nrmi apko.local/run:[0-9a-f]{12}\n$`, string(b))
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		t.Setenv("FAKE_SLEEP", "10")
+		interrupted := errors.New("interrupted")
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		time.AfterFunc(2*time.Second, func() { cancel(interrupted) })
+		err := cli.RunCmd(ctx, "docker", amd64, nil, time.Minute, &bytes.Buffer{}, build.WithConfig(config, nil))
+		require.ErrorIs(t, err, interrupted)
+		require.ErrorContains(t, err, "the entrypoint was stopped after")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		t.Setenv("FAKE_EXIT", "3")
+		err := cli.RunCmd(ctx, "docker", amd64, nil, 0, &bytes.Buffer{}, build.WithConfig(config, nil))
+		require.ErrorContains(t, err, "the entrypoint exited with status 3 after")
+	})
+
+	t.Run("unsupported runtime", func(t *testing.T) {
+		err := cli.RunCmd(ctx, "lxc", amd64, nil, 0, &bytes.Buffer{}, build.WithConfig(config, nil))
+		require.ErrorContains(t, err, `unsupported runtime "lxc"`)
+	})
+
+	t.Run("chroot", func(t *testing.T) {
+		if runtime.GOOS != "linux" {
+			t.Skip("the chroot runtime is only supported on Linux")
+		}
+		// The image has no programs, but is extracted before the
+		// command is looked up in it.
+		err := cli.RunCmd(ctx, "chroot", amd64, []string{"true"}, 0, &bytes.Buffer{}, build.WithConfig(config, nil))
+		require.ErrorContains(t, err, "true: not found in PATH /usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin of the root filesystem")
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"errors"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/scan"
+)
+
+// scanFlags are the flags which scan the images built for vulnerabilities.
+type scanFlags struct {
+	scan    bool
+	scanner string
+	failOn  string
+}
+
+func (f *scanFlags) addFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&f.scan, "scan", false, "scan each image for vulnerabilities with its SBOM once it is built")
+	cmd.Flags().StringVar(&f.scanner, "scanner", scan.Auto, "scanner to run with --scan, one of: auto (grype if installed, else trivy), grype, trivy")
+	cmd.Flags().StringVar(&f.failOn, "fail-on", "", "fail the build if --scan finds vulnerabilities of at least this severity, e.g. severity>=high (default '' means to only report them)")
+}
+
+// scanOption returns the option setting the scanner of the build, which
+// needs the SBOMs of the images, if --scan is set.
+func (f *scanFlags) scanOption(wantSBOM bool) (build.Option, error) {
+	if !f.scan {
+		if f.failOn != "" {
+			return nil, errors.New("--fail-on needs --scan")
+		}
+		return func(*build.Context) error { return nil }, nil
+	}
+	if !wantSBOM {
+		return nil, errors.New("--scan needs the SBOMs of the images, it cannot be used with --sbom=false")
+	}
+	s, err := scan.New(f.scanner)
+	if err != nil {
+		return nil, err
+	}
+	return build.WithScan(s, f.failOn), nil
+}
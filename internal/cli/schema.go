@@ -0,0 +1,38 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func schema() *cobra.Command {
+	return &cobra.Command{
+		Use:     "schema",
+		Example: `apko schema > apko.schema.json`,
+		Short:   "Print the JSON schema of the image configuration",
+		Long: `Print the JSON schema of the image configuration.
+
+The schema can be used by editors to validate and complete apko configuration
+files.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			_, err := cmd.OutOrStdout().Write(types.Schema())
+			return err
+		},
+	}
+}
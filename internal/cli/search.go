@@ -0,0 +1,144 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func searchCmd() *cobra.Command {
+	var config string
+	var file string
+	var archstr string
+	var extraKeys []string
+	var extraRepos []string
+	var cacheDir string
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:   "search [name-glob]",
+		Short: "Search the repositories for packages",
+		Long: `Search the repositories for packages, by name or by a file they install.
+
+The repositories are those of the configuration, if any, and the ones given
+with --repository-append. Their indexes are fetched, or read from the cache,
+as for a build.
+
+With a glob, the packages whose name matches it are shown. With --file, the
+packages which install the file are shown: a command, such as convert or
+bin/convert, is found by the cmd: provides of the packages, and a shared
+library by their so: provides. Repositories which publish a contents database,
+a CONTENTS.gz next to their APKINDEX.tar.gz with lines of a path and the
+comma separated packages installing it, are searched for any file.
+
+The latest version of each package in each repository is shown.`,
+		Example: `  apko search 'py3-*' -r https://packages.wolfi.dev/os -k https://packages.wolfi.dev/os/wolfi-signing.rsa.pub
+  apko search --file bin/convert --config image.yaml`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 0) == (file == "") {
+				return errors.New("exactly one of a name glob or --file is required")
+			}
+			if config == "" && len(extraRepos) == 0 {
+				return errors.New("--config or --repository-append is required")
+			}
+			pattern := ""
+			if len(args) == 1 {
+				pattern = args[0]
+			}
+			opts := []build.Option{
+				build.WithExtraKeys(extraKeys),
+				build.WithExtraRuntimeRepos(extraRepos),
+				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+			}
+			if config != "" {
+				opts = append(opts, build.WithConfig(config, []string{}))
+			}
+			arch := types.ParseArchitectures([]string{archstr})[0]
+			return SearchCmd(cmd.Context(), cmd.OutOrStdout(), pattern, file, arch, opts...)
+		},
+	}
+
+	cmd.Flags().StringVar(&config, "config", "", "the configuration whose repositories and keyring to search")
+	cmd.Flags().StringVar(&file, "file", "", "search for the packages installing this file instead")
+	cmd.Flags().StringVar(&archstr, "arch", "host", "architecture whose indexes to search (e.g., x86_64, arm64)")
+	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
+	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to search")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch indexes (cache must be pre-populated)")
+	return cmd
+}
+
+// SearchCmd writes the packages of the repositories for arch whose name
+// matches pattern, or which install file, to w.
+func SearchCmd(ctx context.Context, w io.Writer, pattern, file string, arch types.Architecture, opts ...build.Option) error {
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	o, _, err := build.NewOptions(opts...)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(o.TempDir())
+
+	fsys := apkfs.DirFS(ctx, filepath.Join(wd, arch.ToAPK()), apkfs.WithCreateDir())
+	bc, err := build.New(ctx, fsys, append(opts, build.WithArch(arch))...)
+	if err != nil {
+		return err
+	}
+
+	var results []build.SearchResult
+	if file != "" {
+		results, err = bc.SearchFile(ctx, file)
+	} else {
+		results, err = bc.SearchPackages(ctx, pattern)
+	}
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return errors.New("no packages found")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if file != "" {
+		fmt.Fprintln(tw, "NAME\tVERSION\tMATCH\tREPOSITORY")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Name, r.Version, r.Match, r.Repository)
+		}
+	} else {
+		fmt.Fprintln(tw, "NAME\tVERSION\tREPOSITORY")
+		for _, r := range results {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Name, r.Version, r.Repository)
+		}
+	}
+	return tw.Flush()
+}
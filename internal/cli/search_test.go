@@ -0,0 +1,44 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	arch := types.ParseArchitecture("amd64")
+	opts := []build.Option{
+		build.WithExtraKeys([]string{"testdata/melange.rsa.pub"}),
+		build.WithExtraRuntimeRepos([]string{"testdata/packages"}),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, cli.SearchCmd(ctx, &out, "re*", "", arch, opts...))
+	require.Equal(t, `NAME       VERSION   REPOSITORY
+replayout  1.0.0-r0  testdata/packages/x86_64/APKINDEX.tar.gz
+`, out.String())
+
+	require.ErrorContains(t, cli.SearchCmd(ctx, &out, "", "/usr/bin/convert", arch, opts...), "no packages found")
+}
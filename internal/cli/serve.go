@@ -0,0 +1,727 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func serveCmd() *cobra.Command {
+	var addr string
+	var tokenFile string
+	var workDir string
+	var cacheDir string
+	var offline bool
+	var maxBuilds int
+	var retention time.Duration
+	var includePaths []string
+	var sbomFormats []string
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an API to build images, keeping the indexes and packages warm across builds",
+		Long: `Serve an HTTP API to build images.
+
+The server keeps the parsed indexes in memory and the fetched packages in its
+cache across builds, so CI systems and editors which build often don't pay
+for a cold start each time. Builds run in the background, and their logs and
+progress can be followed while they run:
+
+  POST   /v1/builds                   submit a build, returns its status
+  GET    /v1/builds                   list the builds
+  GET    /v1/builds/{id}              the status of a build
+  GET    /v1/builds/{id}/events       the logs and progress, as JSON lines, until the build ends
+  GET    /v1/builds/{id}/image        the image, in a format "docker load" accepts
+  GET    /v1/builds/{id}/sboms/{name} an SBOM of the image
+  DELETE /v1/builds/{id}              cancel a build and delete its outputs
+
+A build is submitted as JSON, with the configuration as YAML:
+
+  {"config": "contents: ...", "tag": "example.com/image:latest", "archs": ["amd64"], "sbom": true}
+
+The server listens on localhost unless --addr says otherwise, and every
+request but GET /healthz needs the token of the server as a bearer token, in
+an "Authorization: Bearer <token>" header. The token is read from
+--token-file, or from $APKO_SERVE_TOKEN, or else generated and written to the
+"token" file of the working directory, readable only by its owner.
+
+Paths in the configuration are relative to the working directory of the
+server, or to --include-paths. The outputs of finished builds are deleted
+after --retention.
+`,
+		Example: `  apko serve --addr localhost:8080`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			log := clog.FromContext(ctx)
+
+			if workDir == "" {
+				tmp, err := os.MkdirTemp("", "apko-serve-*")
+				if err != nil {
+					return fmt.Errorf("creating working directory: %w", err)
+				}
+				defer os.RemoveAll(tmp)
+				workDir = tmp
+			}
+
+			token, err := serverToken(ctx, tokenFile, workDir)
+			if err != nil {
+				return err
+			}
+
+			// The HEAD requests aren't cached, so the server notices when an
+			// index changes, but the parsed indexes are kept in memory as
+			// long as their etag doesn't change.
+			s, err := NewServer(workDir, token, maxBuilds, retention, includePaths,
+				build.WithCache(cacheDir, offline, apk.NewCache(false)),
+				build.WithSBOMFormats(sbomFormats),
+			)
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				return err
+			}
+			srv := &http.Server{
+				Handler:           s.Handler(),
+				ReadHeaderTimeout: 10 * time.Second,
+				BaseContext:       func(net.Listener) context.Context { return ctx },
+			}
+			go func() {
+				<-ctx.Done()
+				shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(shutdown)
+			}()
+
+			log.Infof("serving on http://%s", l.Addr())
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", "localhost:8080", "address to listen on")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "file holding the token requests must carry as a bearer token (default '' means $APKO_SERVE_TOKEN, or a generated token written to the working directory)")
+	cmd.Flags().StringVar(&workDir, "work-dir", "", "directory to keep the outputs of the builds in (default '' means a temporary directory, deleted on exit)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().IntVar(&maxBuilds, "max-builds", 2, "the number of images to build at the same time; other builds wait their turn")
+	cmd.Flags().DurationVar(&retention, "retention", time.Hour, "how long to keep the outputs of a finished build (0 means until it is deleted)")
+	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir.")
+	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", []string{"spdx"}, "SBOM formats to output (spdx, cyclonedx) when a build asks for SBOMs")
+	return cmd
+}
+
+// serverToken returns the token of the server, read from tokenFile, or
+// APKO_SERVE_TOKEN, or else generated and written to the token file of
+// workDir.
+func serverToken(ctx context.Context, tokenFile, workDir string) (string, error) {
+	if tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("reading token: %w", err)
+		}
+		token := strings.TrimSpace(string(data))
+		if token == "" {
+			return "", fmt.Errorf("token file %s is empty", tokenFile)
+		}
+		return token, nil
+	}
+	if token := os.Getenv("APKO_SERVE_TOKEN"); token != "" {
+		return token, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", fmt.Errorf("creating working directory: %w", err)
+	}
+	path := filepath.Join(workDir, "token")
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("writing token: %w", err)
+	}
+	clog.FromContext(ctx).Infof("the token of the server is in %s", path)
+	return token, nil
+}
+
+// BuildState is the state of a build submitted to the server.
+type BuildState string
+
+const (
+	BuildQueued    BuildState = "queued"
+	BuildRunning   BuildState = "running"
+	BuildSucceeded BuildState = "succeeded"
+	BuildFailed    BuildState = "failed"
+	BuildCanceled  BuildState = "canceled"
+)
+
+// done returns whether the build ended.
+func (s BuildState) done() bool {
+	return s == BuildSucceeded || s == BuildFailed || s == BuildCanceled
+}
+
+// BuildRequest is a build submitted to the server.
+type BuildRequest struct {
+	// Config is the image configuration, as YAML
+	Config string `json:"config"`
+	// Tag is the tag of the image
+	Tag string `json:"tag"`
+	// Archs are the architectures to build, by default those of the
+	// configuration
+	Archs []string `json:"archs,omitempty"`
+	// SBOM is whether to generate SBOMs
+	SBOM bool `json:"sbom,omitempty"`
+	// BuildArgs are the values of the build arguments of the configuration
+	BuildArgs map[string]string `json:"build_args,omitempty"`
+}
+
+// BuildStatus is the status of a build submitted to the server.
+type BuildStatus struct {
+	ID       string     `json:"id"`
+	State    BuildState `json:"state"`
+	Tag      string     `json:"tag"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// SBOMs are the names of the SBOMs of a successful build
+	SBOMs []string `json:"sboms,omitempty"`
+}
+
+// BuildEvent is a log line, the progress of installing packages, or the end
+// of a build, streamed by the server.
+type BuildEvent struct {
+	Time     time.Time          `json:"time"`
+	Level    string             `json:"level,omitempty"`
+	Message  string             `json:"message,omitempty"`
+	Progress *apk.ProgressEvent `json:"progress,omitempty"`
+	// State is set on the last event of a build
+	State BuildState `json:"state,omitempty"`
+}
+
+// Server builds the images submitted to its API, sharing its options, and
+// so the cache of indexes and packages, between the builds.
+type Server struct {
+	workDir      string
+	token        string
+	retention    time.Duration
+	includePaths []string
+	opts         []build.Option
+	slots        chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	nextID int
+	builds map[string]*serverBuild
+}
+
+// NewServer returns a Server which keeps the outputs of the builds in
+// workDir, for retention after they end (forever when 0), and runs up to
+// maxBuilds of them at the same time. Requests must carry token as a bearer
+// token.
+func NewServer(workDir, token string, maxBuilds int, retention time.Duration, includePaths []string, opts ...build.Option) (*Server, error) {
+	if token == "" {
+		return nil, errors.New("the server needs a token")
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, fmt.Errorf("creating working directory: %w", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		workDir:      workDir,
+		token:        token,
+		retention:    retention,
+		includePaths: includePaths,
+		opts:         opts,
+		slots:        make(chan struct{}, max(maxBuilds, 1)),
+		ctx:          ctx,
+		cancel:       cancel,
+		builds:       map[string]*serverBuild{},
+	}, nil
+}
+
+// Close cancels the builds which haven't ended.
+func (s *Server) Close() {
+	s.cancel()
+}
+
+// Handler returns the handler of the API.
+func (s *Server) Handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /v1/builds", s.submit)
+	api.HandleFunc("GET /v1/builds", s.list)
+	api.HandleFunc("GET /v1/builds/{id}", s.withBuild(s.status))
+	api.HandleFunc("DELETE /v1/builds/{id}", s.withBuild(s.delete))
+	api.HandleFunc("GET /v1/builds/{id}/events", s.withBuild(s.events))
+	api.HandleFunc("GET /v1/builds/{id}/image", s.withBuild(s.image))
+	api.HandleFunc("GET /v1/builds/{id}/sboms/{name}", s.withBuild(s.sbom))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/v1/", s.authorize(api))
+	return mux
+}
+
+// authorize rejects the requests which don't carry the token of the server.
+func (s *Server) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, http.StatusUnauthorized, errors.New("the request needs the token of the server"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// maxBuildEvents is the number of events of a build kept for its streams.
+const maxBuildEvents = 10000
+
+// serverBuild is a build submitted to the server.
+type serverBuild struct {
+	id      string
+	dir     string
+	req     BuildRequest
+	created time.Time
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	state    BuildState
+	err      error
+	finished time.Time
+	sboms    []string
+	// events are the latest events of the build, after the dropped oldest
+	// ones, so that a chatty build doesn't hold on to all of its logs.
+	events  []BuildEvent
+	dropped int
+	// changed is closed, and replaced, whenever the build changes.
+	changed chan struct{}
+}
+
+func (b *serverBuild) status() BuildStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := BuildStatus{
+		ID:      b.id,
+		State:   b.state,
+		Tag:     b.req.Tag,
+		Created: b.created,
+		SBOMs:   b.sboms,
+	}
+	if b.err != nil {
+		st.Error = b.err.Error()
+	}
+	if !b.finished.IsZero() {
+		st.Finished = &b.finished
+	}
+	return st
+}
+
+// addEvent appends the event and wakes up the streams of events.
+func (b *serverBuild) addEvent(ev BuildEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addEventLocked(ev)
+}
+
+func (b *serverBuild) addEventLocked(ev BuildEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	b.events = append(b.events, ev)
+	if len(b.events) > maxBuildEvents {
+		// Drop a quarter at once, so that events aren't copied every time.
+		drop := len(b.events) - maxBuildEvents*3/4
+		b.events = slices.Clone(b.events[drop:])
+		b.dropped += drop
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *serverBuild) setState(state BuildState, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state.done() {
+		return
+	}
+	b.state, b.err = state, err
+	if state.done() {
+		b.finished = time.Now()
+		ev := BuildEvent{State: state}
+		if err != nil {
+			ev.Level, ev.Message = slog.LevelError.String(), err.Error()
+		}
+		b.addEventLocked(ev)
+		return
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Report implements apk.Reporter.
+func (b *serverBuild) Report(ev apk.ProgressEvent) {
+	b.addEvent(BuildEvent{Progress: &ev})
+}
+
+// eventHandler is a slog.Handler which records the logs of a build as
+// events.
+type eventHandler struct {
+	b     *serverBuild
+	attrs []slog.Attr
+}
+
+func (h *eventHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *eventHandler) Handle(_ context.Context, r slog.Record) error {
+	var sb strings.Builder
+	sb.WriteString(r.Message)
+	appendAttr := func(a slog.Attr) bool {
+		fmt.Fprintf(&sb, " %s=%v", a.Key, a.Value)
+		return true
+	}
+	for _, a := range h.attrs {
+		appendAttr(a)
+	}
+	r.Attrs(appendAttr)
+	h.b.addEvent(BuildEvent{Time: r.Time, Level: r.Level.String(), Message: sb.String()})
+	return nil
+}
+
+func (h *eventHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &eventHandler{b: h.b, attrs: slices.Concat(h.attrs, attrs)}
+}
+
+// WithGroup doesn't qualify the attributes of the group, which are only
+// read by people following the build.
+func (h *eventHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+		httpError(w, http.StatusUnsupportedMediaType, errors.New("the build request must be application/json"))
+		return
+	}
+	var req BuildRequest
+	dec := json.NewDecoder(io.LimitReader(r.Body, 10<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Errorf("parsing build request: %w", err))
+		return
+	}
+	if req.Config == "" {
+		httpError(w, http.StatusBadRequest, errors.New("the build request has no config"))
+		return
+	}
+	if req.Tag == "" {
+		httpError(w, http.StatusBadRequest, errors.New("the build request has no tag"))
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	dir := filepath.Join(s.workDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(dir, "apko.yaml"), []byte(req.Config), 0644); err != nil {
+		httpError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	b := &serverBuild{
+		id:      id,
+		dir:     dir,
+		req:     req,
+		created: time.Now(),
+		cancel:  cancel,
+		state:   BuildQueued,
+		changed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.builds[id] = b
+	s.mu.Unlock()
+
+	clog.FromContext(r.Context()).Infof("build %s of %s submitted", id, req.Tag)
+	go s.run(ctx, b)
+
+	w.Header().Set("Location", "/v1/builds/"+id)
+	writeJSON(w, http.StatusAccepted, b.status())
+}
+
+// run waits for a free slot, builds the image, and deletes its outputs
+// after the retention.
+func (s *Server) run(ctx context.Context, b *serverBuild) {
+	defer b.cancel()
+	log := clog.FromContext(s.ctx)
+
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		b.setState(BuildCanceled, nil)
+		return
+	}
+	b.setState(BuildRunning, nil)
+	err := s.build(ctx, b)
+	<-s.slots
+
+	switch {
+	case ctx.Err() != nil:
+		b.setState(BuildCanceled, nil)
+	case err != nil:
+		log.Warnf("build %s of %s failed: %v", b.id, b.req.Tag, err)
+		b.setState(BuildFailed, err)
+	default:
+		log.Infof("build %s of %s succeeded", b.id, b.req.Tag)
+		b.setState(BuildSucceeded, nil)
+	}
+
+	if s.retention > 0 {
+		time.AfterFunc(s.retention, func() { s.remove(b) })
+	}
+}
+
+func (s *Server) build(ctx context.Context, b *serverBuild) error {
+	ctx = clog.WithLogger(ctx, clog.New(&eventHandler{b: b}))
+
+	tmp := filepath.Join(b.dir, "tmp")
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	sbomDir := filepath.Join(b.dir, "sboms")
+	if b.req.SBOM {
+		if err := os.MkdirAll(sbomDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	opts := slices.Concat([]build.Option{build.WithConfig(filepath.Join(b.dir, "apko.yaml"), s.includePaths)}, s.opts, []build.Option{
+		build.WithIncludePaths(s.includePaths),
+		build.WithBuildArgs(b.req.BuildArgs),
+		build.WithTags(b.req.Tag),
+		build.WithTempDir(tmp),
+		build.WithProgressReporter(b),
+	})
+	if !b.req.SBOM {
+		opts = append(opts, build.WithSBOMFormats([]string{}))
+	}
+	archs := types.ParseArchitectures(b.req.Archs)
+	if err := BuildCmd(ctx, b.req.Tag, filepath.Join(b.dir, "image.tar"), archs, []string{b.req.Tag}, b.req.SBOM, sbomDir, opts...); err != nil {
+		return err
+	}
+
+	if b.req.SBOM {
+		entries, err := os.ReadDir(sbomDir)
+		if err != nil {
+			return err
+		}
+		b.mu.Lock()
+		for _, e := range entries {
+			b.sboms = append(b.sboms, e.Name())
+		}
+		b.mu.Unlock()
+	}
+	return nil
+}
+
+// remove cancels the build and deletes it and its outputs.
+func (s *Server) remove(b *serverBuild) {
+	b.cancel()
+	s.mu.Lock()
+	delete(s.builds, b.id)
+	s.mu.Unlock()
+	_ = os.RemoveAll(b.dir)
+}
+
+func (s *Server) list(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	builds := make([]*serverBuild, 0, len(s.builds))
+	for _, b := range s.builds {
+		builds = append(builds, b)
+	}
+	s.mu.Unlock()
+
+	statuses := make([]BuildStatus, 0, len(builds))
+	for _, b := range builds {
+		statuses = append(statuses, b.status())
+	}
+	slices.SortFunc(statuses, func(a, b BuildStatus) int { return a.Created.Compare(b.Created) })
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// withBuild looks up the build of the request.
+func (s *Server) withBuild(h func(http.ResponseWriter, *http.Request, *serverBuild)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		b, ok := s.builds[r.PathValue("id")]
+		s.mu.Unlock()
+		if !ok {
+			httpError(w, http.StatusNotFound, fmt.Errorf("no build %q", r.PathValue("id")))
+			return
+		}
+		h(w, r, b)
+	}
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request, b *serverBuild) {
+	writeJSON(w, http.StatusOK, b.status())
+}
+
+func (s *Server) delete(w http.ResponseWriter, _ *http.Request, b *serverBuild) {
+	s.remove(b)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// events streams the events of the build, as JSON lines, until it ends or
+// the client goes away. Events dropped before they were sent are replaced
+// by a warning saying how many were.
+func (s *Server) events(w http.ResponseWriter, r *http.Request, b *serverBuild) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	flusher, _ := w.(http.Flusher)
+
+	sent := 0
+	for {
+		b.mu.Lock()
+		skipped := max(b.dropped-sent, 0)
+		events := b.events[sent+skipped-b.dropped:]
+		done := b.state.done()
+		changed := b.changed
+		b.mu.Unlock()
+
+		if skipped > 0 {
+			if err := enc.Encode(BuildEvent{
+				Time:    time.Now(),
+				Level:   slog.LevelWarn.String(),
+				Message: fmt.Sprintf("%d events were dropped", skipped),
+			}); err != nil {
+				return
+			}
+			sent += skipped
+		}
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+		}
+		sent += len(events)
+		if err := bw.Flush(); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) image(w http.ResponseWriter, r *http.Request, b *serverBuild) {
+	if !s.succeeded(w, b) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	http.ServeFile(w, r, filepath.Join(b.dir, "image.tar"))
+}
+
+func (s *Server) sbom(w http.ResponseWriter, r *http.Request, b *serverBuild) {
+	if !s.succeeded(w, b) {
+		return
+	}
+	name := r.PathValue("name")
+	b.mu.Lock()
+	ok := slices.Contains(b.sboms, name)
+	b.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, fmt.Errorf("build %s has no SBOM %q", b.id, name))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, r, filepath.Join(b.dir, "sboms", name))
+}
+
+// succeeded writes an error unless the build succeeded.
+func (s *Server) succeeded(w http.ResponseWriter, b *serverBuild) bool {
+	st := b.status()
+	if st.State != BuildSucceeded {
+		httpError(w, http.StatusConflict, fmt.Errorf("build %s is %s", b.id, st.State))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
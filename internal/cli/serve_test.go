@@ -0,0 +1,194 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+)
+
+func TestServe(t *testing.T) {
+	const token = "secret"
+	_, err := cli.NewServer(t.TempDir(), "", 1, 0, nil)
+	require.ErrorContains(t, err, "needs a token")
+	s, err := cli.NewServer(t.TempDir(), token, 1, 0, nil,
+		build.WithCache(t.TempDir(), false, apk.NewCache(false)),
+		build.WithSBOMFormats([]string{"spdx"}),
+	)
+	require.NoError(t, err)
+	defer s.Close()
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	config, err := os.ReadFile(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+
+	// do sends the request with the token of the server.
+	do := func(t *testing.T, method, path, contentType string, body io.Reader) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, body)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	submit := func(t *testing.T, req cli.BuildRequest) (*http.Response, cli.BuildStatus) {
+		t.Helper()
+		body, err := json.Marshal(req)
+		require.NoError(t, err)
+		resp := do(t, http.MethodPost, "/v1/builds", "application/json; charset=utf-8", bytes.NewReader(body))
+		defer resp.Body.Close()
+		var st cli.BuildStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&st))
+		return resp, st
+	}
+	// follow reads the events of the build until it ends.
+	follow := func(t *testing.T, id string) []cli.BuildEvent {
+		t.Helper()
+		resp := do(t, http.MethodGet, "/v1/builds/"+id+"/events", "", nil)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var events []cli.BuildEvent
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			var ev cli.BuildEvent
+			require.NoError(t, json.Unmarshal(sc.Bytes(), &ev))
+			events = append(events, ev)
+		}
+		require.NoError(t, sc.Err())
+		return events
+	}
+	get := func(t *testing.T, path string) (int, []byte) {
+		t.Helper()
+		resp := do(t, http.MethodGet, path, "", nil)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, body
+	}
+
+	t.Run("build", func(t *testing.T) {
+		resp, st := submit(t, cli.BuildRequest{Config: string(config), Tag: "example.com/served:latest", Archs: []string{"amd64"}, SBOM: true})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		require.Equal(t, "/v1/builds/"+st.ID, resp.Header.Get("Location"))
+
+		events := follow(t, st.ID)
+		require.NotEmpty(t, events)
+		last := events[len(events)-1]
+		require.Equal(t, cli.BuildSucceeded, last.State, last.Message)
+		var progress int
+		for _, ev := range events {
+			if ev.Progress != nil {
+				progress++
+			}
+		}
+		require.NotZero(t, progress)
+
+		code, body := get(t, "/v1/builds/"+st.ID)
+		require.Equal(t, http.StatusOK, code)
+		require.NoError(t, json.Unmarshal(body, &st))
+		require.Equal(t, cli.BuildSucceeded, st.State)
+		require.NotNil(t, st.Finished)
+		require.NotEmpty(t, st.SBOMs)
+
+		code, body = get(t, "/v1/builds/"+st.ID+"/image")
+		require.Equal(t, http.StatusOK, code)
+		img, err := tarball.Image(func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }, nil)
+		require.NoError(t, err)
+		_, err = img.Digest()
+		require.NoError(t, err)
+
+		code, body = get(t, "/v1/builds/"+st.ID+"/sboms/"+st.SBOMs[0])
+		require.Equal(t, http.StatusOK, code)
+		require.True(t, json.Valid(body))
+
+		code, _ = get(t, "/v1/builds/"+st.ID+"/sboms/nope.json")
+		require.Equal(t, http.StatusNotFound, code)
+
+		resp = do(t, http.MethodDelete, "/v1/builds/"+st.ID, "", nil)
+		resp.Body.Close()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		code, _ = get(t, "/v1/builds/"+st.ID)
+		require.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("failed build", func(t *testing.T) {
+		broken := "contents:\n  packages: [does-not-exist]\n  repositories: [./testdata/packages]\n  keyring: [./testdata/melange.rsa.pub]\n"
+		resp, st := submit(t, cli.BuildRequest{Config: broken, Tag: "example.com/broken:latest", Archs: []string{"amd64"}})
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		events := follow(t, st.ID)
+		last := events[len(events)-1]
+		require.Equal(t, cli.BuildFailed, last.State)
+		require.Contains(t, last.Message, "does-not-exist")
+
+		code, _ := get(t, "/v1/builds/"+st.ID+"/image")
+		require.Equal(t, http.StatusConflict, code)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		resp, _ := submit(t, cli.BuildRequest{Tag: "example.com/empty:latest"})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = submit(t, cli.BuildRequest{Config: string(config)})
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		code, _ := get(t, "/v1/builds/404")
+		require.Equal(t, http.StatusNotFound, code)
+
+		// A form, which a browser can send across origins, isn't accepted.
+		resp = do(t, http.MethodPost, "/v1/builds", "text/plain", bytes.NewReader([]byte(`{"config": "x", "tag": "y"}`)))
+		resp.Body.Close()
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("token", func(t *testing.T) {
+		resp, err := http.Get(srv.URL + "/healthz")
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		for _, auth := range []string{"", "Bearer wrong", token} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/v1/builds", nil)
+			require.NoError(t, err)
+			if auth != "" {
+				req.Header.Set("Authorization", auth)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusUnauthorized, resp.StatusCode, auth)
+		}
+	})
+}
@@ -34,6 +34,7 @@ func showConfig() *cobra.Command {
 	var extraRuntimeRepos []string
 	var cacheDir string
 	var offline bool
+	var variant string
 
 	cmd := &cobra.Command{
 		Use:   "show-config",
@@ -51,6 +52,7 @@ The derived configuration is rendered in YAML.
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRuntimeRepos(extraRuntimeRepos),
 				build.WithCache(cacheDir, offline, apk.NewCache(true)),
+				build.WithVariant(variant),
 			)
 		},
 	}
@@ -60,6 +62,7 @@ The derived configuration is rendered in YAML.
 	cmd.Flags().StringSliceVarP(&extraRuntimeRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().StringVar(&variant, "variant", "", "name of the variant of the configuration to show, one of those under its variants")
 
 	return cmd
 }
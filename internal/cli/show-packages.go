@@ -17,7 +17,9 @@ package cli
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"text/template"
 
 	"github.com/spf13/cobra"
@@ -58,6 +60,7 @@ type pkgInfo struct {
 	Name    string
 	Version string
 	Source  string
+	Size    uint64
 }
 
 func showPackages() *cobra.Command {
@@ -69,6 +72,8 @@ func showPackages() *cobra.Command {
 	var tmpl string
 	var cacheDir string
 	var offline bool
+	var tree bool
+	var rdeps string
 
 	cmd := &cobra.Command{
 		Use:   "show-packages",
@@ -78,7 +83,7 @@ The result is identical to the first stages of a build, but does not actuall ins
 
 The output is one of several pre-defined formats, or can be customized to any go template, using
 the provided vars. See https://pkg.go.dev/text/template for more information. Available vars are
-.Name, .Version, .Source
+.Name, .Version, .Source, .Size (the installed size in bytes)
 
 The pre-defined formats are:
   name-version:          {{ .Name }} {{ .Version }}
@@ -93,6 +98,12 @@ The pre-defined formats are:
 The default format is name-version.
 
 packagelock and packagelock-source are particularly useful for inserting back into a yaml list of packages.
+
+With --tree, the dependency graph is shown instead, starting from the packages which nothing
+else depends on, with the installed size of each package and the total installed size of it
+and everything it depends on. A package which was already shown is marked with (*) and its
+dependencies are not repeated. With --rdeps, the packages which depend on the given package are
+shown in the same way.
 `,
 		Example: `  apko show-packages <config.yaml>`,
 		Args:    cobra.ExactArgs(1),
@@ -104,7 +115,10 @@ packagelock and packagelock-source are particularly useful for inserting back in
 				// assume it's a template
 				tmpl = format
 			}
-			return ShowPackagesCmd(cmd.Context(), tmpl, archs,
+			if tree && rdeps != "" {
+				return fmt.Errorf("--tree and --rdeps can not be used together")
+			}
+			return ShowPackagesCmd(cmd.Context(), tmpl, showPackagesView{tree: tree, rdeps: rdeps}, archs,
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
@@ -121,11 +135,22 @@ packagelock and packagelock-source are particularly useful for inserting back in
 	cmd.Flags().StringVar(&format, "format", showPkgsFormatDefault, "format for showing packages; if pre-defined from list, will use that, else go template. See https://pkg.go.dev/text/template for more information. Available vars are `.Name`, `.Version`, `.Source`")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
+	cmd.Flags().BoolVar(&tree, "tree", false, "show the dependency graph as a tree, with installed sizes")
+	cmd.Flags().StringVar(&rdeps, "rdeps", "", "show the packages which depend on this package, as a tree")
 
 	return cmd
 }
 
-func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architecture, opts ...build.Option) error {
+// showPackagesView selects how show-packages presents the packages, by
+// default as a list using the format.
+type showPackagesView struct {
+	// tree shows the dependency graph.
+	tree bool
+	// rdeps shows the reverse dependencies of this package.
+	rdeps string
+}
+
+func ShowPackagesCmd(ctx context.Context, format string, view showPackagesView, archs []types.Architecture, opts ...build.Option) error {
 	log := clog.FromContext(ctx)
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
@@ -179,11 +204,32 @@ func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architect
 		if len(archs) != 1 {
 			log.Infof("packages for %s", arch)
 		}
+		switch {
+		case view.tree:
+			g := apk.NewPackageGraph(pkgs)
+			// Packages in a dependency cycle may not be reachable from a
+			// root, so start from them after the roots.
+			names := make([]string, 0, len(pkgs))
+			for _, pkg := range pkgs {
+				names = append(names, pkg.Name)
+			}
+			slices.Sort(names)
+			printPackageTree(os.Stdout, g, append(g.Roots(), names...), g.Dependencies)
+			continue
+		case view.rdeps != "":
+			g := apk.NewPackageGraph(pkgs)
+			if g.Package(view.rdeps) == nil {
+				return fmt.Errorf("package %q is not installed for %s", view.rdeps, arch)
+			}
+			printPackageTree(os.Stdout, g, []string{view.rdeps}, g.ReverseDependencies)
+			continue
+		}
 		var p pkgInfo
 		for _, pkg := range pkgs {
 			p.Name = pkg.Name
 			p.Version = pkg.Version
 			p.Source = pkg.URL()
+			p.Size = pkg.InstalledSize
 			if err = tmpl.Execute(os.Stdout, p); err != nil {
 				return fmt.Errorf("failed to execute template: %w", err)
 			}
@@ -192,3 +238,49 @@ func ShowPackagesCmd(ctx context.Context, format string, archs []types.Architect
 	}
 	return nil
 }
+
+// printPackageTree prints the graph starting from each of roots which was
+// not already printed, following edges. Every package reachable from the
+// roots is printed in full once; later occurrences are marked with (*).
+func printPackageTree(w io.Writer, g *apk.PackageGraph, roots []string, edges func(string) []string) {
+	seen := map[string]struct{}{}
+	var walk func(name, prefix, branch string)
+	walk = func(name, prefix, branch string) {
+		pkg := g.Package(name)
+		line := fmt.Sprintf("%s%s %s (%s, total %s)", branch, name, pkg.Version, formatBytes(pkg.InstalledSize), formatBytes(g.SubtreeSize(name)))
+		if _, ok := seen[name]; ok {
+			fmt.Fprintln(w, line+" (*)")
+			return
+		}
+		fmt.Fprintln(w, line)
+		seen[name] = struct{}{}
+
+		children := edges(name)
+		for i, child := range children {
+			if i == len(children)-1 {
+				walk(child, prefix+"    ", prefix+"└── ")
+			} else {
+				walk(child, prefix+"│   ", prefix+"├── ")
+			}
+		}
+	}
+	for _, root := range roots {
+		if _, ok := seen[root]; !ok {
+			walk(root, "", "")
+		}
+	}
+}
+
+// formatBytes formats a size in bytes using binary units.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,67 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/oci"
+)
+
+func tagCmd() *cobra.Command {
+	var retry retryFlags
+
+	cmd := &cobra.Command{
+		Use:   "tag <digest> <tag...>",
+		Short: "Tag a published image",
+		Long: `Tag an image or index published by digest, e.g. with "apko push".
+
+Tags already pointing to the digest are left alone, so tagging again is
+harmless. Tags in another repository of the registry copy the image there.
+A tag pointing to another image fails when the registry does not allow
+moving it, leaving the tags after it untouched.`,
+		Example: `  apko tag registry.example.com/hello@sha256:... registry.example.com/hello:prod`,
+		Args:    cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain)}
+			if p := retry.retryPolicy(cmd); p != nil {
+				remoteOpts = append(remoteOpts, p.RemoteOptions()...)
+			}
+			return TagCmd(cmd.Context(), args[0], args[1:], remoteOpts...)
+		},
+	}
+	retry.addFlags(cmd)
+	return cmd
+}
+
+// TagCmd tags the image or index published at digest with each of tags.
+func TagCmd(ctx context.Context, digest string, tags []string, ropt ...remote.Option) error {
+	d, err := name.NewDigest(digest)
+	if err != nil {
+		return fmt.Errorf("parsing %q as digest: %w", digest, err)
+	}
+	return oci.Tag(ctx, d, tags, ropt...)
+}
@@ -4,11 +4,15 @@ SCRIPT_DIR=$( cd -- "$( dirname -- "${BASH_SOURCE[0]}" )" &> /dev/null && pwd)
 set -e -x
 
 mkdir -p "${SCRIPT_DIR}/top_image.new"
+# The SBOMs are not part of the golden image, keep them out of the tree.
+SBOM_DIR=$(mktemp -d)
+trap 'rm -rf "${SBOM_DIR}"' EXIT
 (
   cd "${SCRIPT_DIR}/.."
   go run "../.." build \
     --include-paths="${SCRIPT_DIR}/.." \
     --lockfile=./testdata/image_on_top.apko.lock.json \
+    --sbom-path="${SBOM_DIR}" \
     ./testdata/image_on_top.apko.yaml  \
     topimage \
     ./testdata/top_image.new/
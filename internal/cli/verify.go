@@ -0,0 +1,128 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/authn/github"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/spf13/cobra"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	pkglock "chainguard.dev/apko/pkg/lock"
+	"chainguard.dev/apko/pkg/verify"
+)
+
+func verifyCmd() *cobra.Command {
+	var arch string
+	var lockfile string
+	var sbomPath string
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify an image against the lockfile and SBOM it was built with",
+		Long: `Verify an image against the lockfile and SBOM it was built with.
+
+The image is a directory containing an OCI layout, or a reference to an image
+in a registry. The packages in its installed apk database are checked against
+the versions and checksums in the lockfile, and against the packages in the
+SPDX SBOM, whose image and layer digests are also checked.
+
+The command fails if anything does not match.`,
+		Example: `  apko verify --lockfile apko.lock.json --sbom sbom-x86_64.spdx.json --arch amd64 cgr.dev/chainguard/static:latest`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if lockfile == "" && sbomPath == "" {
+				return errors.New("at least one of --lockfile and --sbom is required")
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("unsupported format %q, must be one of: text, json", format)
+			}
+
+			var l *pkglock.Lock
+			if lockfile != "" {
+				lf, err := pkglock.FromFile(lockfile)
+				if err != nil {
+					return err
+				}
+				l = &lf
+			}
+			var sbom []byte
+			if sbomPath != "" {
+				var err error
+				if sbom, err = os.ReadFile(sbomPath); err != nil {
+					return fmt.Errorf("reading SBOM: %w", err)
+				}
+			}
+
+			keychain := authn.NewMultiKeychain(
+				authn.DefaultKeychain,
+				github.Keychain,
+			)
+			a := types.ParseArchitecture(arch)
+			img, err := oci.ReadImage(cmd.Context(), args[0], a, remote.WithAuthFromKeychain(keychain))
+			if err != nil {
+				return err
+			}
+			installed, err := oci.InstalledPackages(img)
+			if err != nil {
+				return err
+			}
+			result, err := verify.Image(img, installed, a, l, sbom)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(result); err != nil {
+					return err
+				}
+			} else {
+				for _, f := range result.Findings {
+					fmt.Fprintf(out, "%s: %s: %s", f.Source, f.Subject, f.Message)
+					if f.Expected != "" || f.Actual != "" {
+						fmt.Fprintf(out, " (expected %q, got %q)", f.Expected, f.Actual)
+					}
+					fmt.Fprintln(out)
+				}
+			}
+
+			if !result.Verified {
+				return fmt.Errorf("%s does not match: %d findings", result.Digest, len(result.Findings))
+			}
+			if format == "text" {
+				fmt.Fprintf(out, "%s verified\n", result.Digest)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&arch, "arch", runtime.GOARCH, "architecture of the image to verify")
+	cmd.Flags().StringVar(&lockfile, "lockfile", "", "lockfile (e.g. produced by apko lock) the image was built with")
+	cmd.Flags().StringVar(&sbomPath, "sbom", "", "SPDX SBOM of the image for the architecture")
+	cmd.Flags().StringVar(&format, "format", "text", "output format, one of: text, json")
+	return cmd
+}
@@ -0,0 +1,252 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+	"chainguard.dev/apko/pkg/paths"
+)
+
+// watchDebounce is how long to wait for changes to settle before
+// rebuilding, as editors and melange write several files in a row.
+const watchDebounce = 250 * time.Millisecond
+
+// WatchCmd builds the image like BuildCmd, then rebuilds it whenever the
+// configuration, the files it includes, the lockfile or the packages of a
+// local repository change, until ctx is done. It prints the digest of each
+// image it builds to w. The rebuilds reuse the cache of opts, so that only
+// the changed indexes and packages are read again; a failed rebuild is logged
+// and the watch goes on.
+func WatchCmd(ctx context.Context, w io.Writer, imageRef, output string, archs []types.Architecture, tags []string, sbomPath string, opts ...build.Option) error {
+	log := clog.FromContext(ctx)
+
+	files, repos, err := watchPaths(archs, opts...)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("watching for changes: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch before building, so that changes made during a build are not missed.
+	updateWatches(ctx, watcher, files, repos)
+	for {
+		digest, _, err := builder.BuildImage(ctx, imageRef, output, archs, tags, sbomPath, opts...)
+		if err != nil {
+			log.Errorf("building image: %v", err)
+		} else {
+			fmt.Fprintln(w, digest)
+		}
+
+		// The configuration may have changed its includes or repositories.
+		if f, r, err := watchPaths(archs, opts...); err == nil {
+			files, repos = f, r
+			updateWatches(ctx, watcher, files, repos)
+		}
+
+		changed, err := waitForChange(ctx, watcher, func(name string) bool {
+			if slices.Contains(files, name) || slices.Contains(repos, name) {
+				return true
+			}
+			base := filepath.Base(name)
+			return slices.Contains(repos, filepath.Dir(name)) && (strings.HasSuffix(base, ".apk") || base == "APKINDEX.tar.gz")
+		})
+		if err != nil {
+			return err
+		}
+		if changed == "" {
+			// ctx is done
+			return nil
+		}
+		log.Infof("%s changed, rebuilding", changed)
+	}
+}
+
+// watchPaths returns the absolute paths of the configuration, the files it
+// includes and the lockfile, and of the package directories of the local
+// repositories, for each architecture built.
+func watchPaths(archs []types.Architecture, opts ...build.Option) (files, repos []string, err error) {
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if o.ImageConfigFile != "" {
+		files, err = configFiles(o.ImageConfigFile, o.IncludePaths)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if o.Lockfile != "" {
+		lockfile, err := filepath.Abs(o.Lockfile)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, lockfile)
+	}
+
+	if len(archs) == 0 {
+		archs = ic.Archs
+	}
+	if len(archs) == 0 {
+		// All of them, rather than those the local repositories have
+		// packages for, so that the directory of another architecture
+		// melange builds for is noticed and built too.
+		archs = types.AllArchs
+	}
+	for _, repo := range slices.Concat(ic.Contents.BuildRepositories, ic.Contents.RuntimeRepositories, o.ExtraBuildRepos, o.ExtraRuntimeRepos) {
+		if strings.HasPrefix(repo, "@") {
+			fields := strings.Fields(repo)
+			if len(fields) < 2 {
+				continue
+			}
+			repo = fields[1]
+		}
+		if strings.Contains(repo, "://") {
+			continue
+		}
+		for _, arch := range archs {
+			dir, err := filepath.Abs(filepath.Join(repo, arch.ToAPK()))
+			if err != nil {
+				return nil, nil, err
+			}
+			if !slices.Contains(repos, dir) {
+				repos = append(repos, dir)
+			}
+		}
+	}
+	return files, repos, nil
+}
+
+// configFiles returns the absolute paths of a configuration and of the
+// files it includes, resolved the way the configuration is loaded.
+func configFiles(configFile string, includePaths []string) ([]string, error) {
+	var files []string
+	dirs := includePaths
+	for p := configFile; p != ""; {
+		resolved, err := paths.ResolvePath(p, dirs)
+		if err != nil {
+			return nil, err
+		}
+		abs, err := filepath.Abs(resolved)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(files, abs) {
+			// an include cycle, which the build reports
+			break
+		}
+		files = append(files, abs)
+
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return nil, err
+		}
+		var config struct {
+			Include string `yaml:"include"`
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			// the build reports the error, and the file is watched for a fix
+			break
+		}
+		p = config.Include
+		// Includes are also looked up relative to the including file.
+		dirs = append(slices.Clone(dirs), filepath.Dir(resolved))
+	}
+	return files, nil
+}
+
+// updateWatches watches the directories of files, and the repository
+// directories and their parents, so that files replaced by a rename and
+// repository directories created later are noticed too.
+func updateWatches(ctx context.Context, watcher *fsnotify.Watcher, files, repos []string) {
+	log := clog.FromContext(ctx)
+
+	var dirs []string
+	for _, f := range files {
+		dirs = append(dirs, filepath.Dir(f))
+	}
+	for _, r := range repos {
+		dirs = append(dirs, r, filepath.Dir(r))
+	}
+	slices.Sort(dirs)
+	dirs = slices.Compact(dirs)
+
+	for _, dir := range watcher.WatchList() {
+		if !slices.Contains(dirs, dir) {
+			if err := watcher.Remove(dir); err != nil {
+				log.Debugf("unwatching %s: %v", dir, err)
+			}
+		}
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			log.Warnf("watching %s: %v", dir, err)
+		}
+	}
+}
+
+// waitForChange waits until a relevant file changed and no other change
+// followed for watchDebounce, and returns the first file which changed. It
+// returns an empty name when ctx is done.
+func waitForChange(ctx context.Context, watcher *fsnotify.Watcher, relevant func(string) bool) (string, error) {
+	var changed string
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return "", nil
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return "", nil
+			}
+			return "", fmt.Errorf("watching for changes: %w", err)
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return "", nil
+			}
+			if ev.Op == fsnotify.Chmod || !relevant(ev.Name) {
+				continue
+			}
+			if changed == "" {
+				changed = ev.Name
+			}
+			settled = time.After(watchDebounce)
+		case <-settled:
+			return changed, nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/internal/cli"
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tmp := t.TempDir()
+
+	packages, err := filepath.Abs(filepath.Join("testdata", "packages"))
+	require.NoError(t, err)
+	key, err := filepath.Abs(filepath.Join("testdata", "melange.rsa.pub"))
+	require.NoError(t, err)
+
+	base := filepath.Join(tmp, "base.yaml")
+	require.NoError(t, os.WriteFile(base, []byte("contents:\n  keyring: ["+key+"]\n  repositories: ["+packages+"]\n  packages: [replayout]\n"), 0o644))
+	config := filepath.Join(tmp, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("include: base.yaml\nentrypoint:\n  command: /bin/sh -l\n"), 0o644))
+
+	archs := types.ParseArchitectures([]string{"amd64"})
+	opts := []build.Option{
+		build.WithConfig(config, nil),
+		build.WithCache("", false, apk.NewCache(true)),
+		build.WithSBOMFormats([]string{}),
+		build.WithTags("watch:latest"),
+	}
+
+	r, w := io.Pipe()
+	done := make(chan error)
+	go func() {
+		done <- cli.WatchCmd(ctx, w, "watch:latest", filepath.Join(tmp, "image.tar"), archs, nil, "", opts...)
+		w.Close()
+	}()
+	digests := bufio.NewScanner(r)
+
+	require.True(t, digests.Scan())
+	first := digests.Text()
+	require.Contains(t, first, "sha256:")
+
+	// Changing an included file rebuilds the image.
+	require.NoError(t, os.WriteFile(base, []byte("contents:\n  keyring: ["+key+"]\n  repositories: ["+packages+"]\n  packages: [replayout]\nenvironment:\n  FOO: bar\n"), 0o644))
+	require.True(t, digests.Scan())
+	second := digests.Text()
+	require.Contains(t, second, "sha256:")
+	require.NotEqual(t, first, second)
+
+	cancel()
+	require.NoError(t, <-done)
+}
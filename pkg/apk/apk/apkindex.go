@@ -76,6 +76,20 @@ type APKIndex struct { //nolint:revive
 	Signature   []byte
 	Description string
 	Packages    []*Package
+	// Checksum is the SHA-256 of the APKINDEX.tar.gz the index was read
+	// from, when it was fetched from a repository.
+	Checksum []byte
+	// Verification is how the signature of the index was verified, when it
+	// was fetched from a repository.
+	Verification Verification
+}
+
+// verifiedBy records that the index was verified as v by an IndexVerifier,
+// unless it was verified with a key as well, or v is not a verification.
+func (idx *APKIndex) verifiedBy(v Verification) {
+	if v.Verified && !idx.Verification.Verified {
+		idx.Verification = v
+	}
 }
 
 // Splitting empty string results in single element array with one empty string, which would
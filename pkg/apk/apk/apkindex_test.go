@@ -2,16 +2,27 @@ package apk
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/signature"
 )
 
 func TestSinglePackage(t *testing.T) {
@@ -310,3 +321,130 @@ func TestMultipleKeys(t *testing.T) {
 		assert.Greater(len(apkIndex.Signature), 0, "Signature missing")
 	})
 }
+
+func TestNonRSAKeys(t *testing.T) {
+	signed, err := os.ReadFile("testdata/signing/APKINDEX.tar.gz")
+	require.NoError(t, err)
+
+	// Strip the existing signatures, leaving the index itself.
+	r := bytes.NewReader(signed)
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	gz.Multistream(false)
+	_, err = io.Copy(io.Discard, gz)
+	require.NoError(t, err)
+	indexData := signed[len(signed)-r.Len():]
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	for name, priv := range map[string]crypto.Signer{
+		"test.ecdsa.pub":   ecKey,
+		"test.ed25519.pub": edKey,
+	} {
+		t.Run(name, func(t *testing.T) {
+			der, err := x509.MarshalPKCS8PrivateKey(priv)
+			require.NoError(t, err)
+			keyFile := filepath.Join(t.TempDir(), "key.pem")
+			require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+			sig, err := signature.Sign(indexData, crypto.SHA256, keyFile, "")
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gw)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: ".SIGN.RSA256." + name, Mode: 0o644, Size: int64(len(sig))}))
+			_, err = tw.Write(sig)
+			require.NoError(t, err)
+			require.NoError(t, tw.Close())
+			require.NoError(t, gw.Close())
+			buf.Write(indexData)
+
+			pubDER, err := x509.MarshalPKIXPublicKey(priv.Public())
+			require.NoError(t, err)
+			pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+			ctx := context.Background()
+			index, err := parseRepositoryIndex(ctx, "testdata/signing/APKINDEX.tar.gz",
+				map[string][]byte{name: pub}, "aarch64", buf.Bytes(), &indexOpts{})
+			require.NoError(t, err)
+			require.NotEmpty(t, index.Signature)
+
+			// Keys downloaded without their extension match too.
+			_, err = parseRepositoryIndex(ctx, "testdata/signing/APKINDEX.tar.gz",
+				map[string][]byte{"test": pub}, "aarch64", buf.Bytes(), &indexOpts{})
+			require.NoError(t, err)
+
+			// A signature from a different key does not verify.
+			otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			require.NoError(t, err)
+			otherDER, err := x509.MarshalPKIXPublicKey(otherKey.Public())
+			require.NoError(t, err)
+			_, err = parseRepositoryIndex(ctx, "testdata/signing/APKINDEX.tar.gz",
+				map[string][]byte{name: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER})},
+				"aarch64", buf.Bytes(), &indexOpts{})
+			require.ErrorContains(t, err, "signature verification failed")
+		})
+	}
+}
+
+type fakeIndexVerifier struct {
+	signature []byte
+	called    bool
+}
+
+func (f *fakeIndexVerifier) SignatureSuffix() string { return ".fake" }
+
+func (f *fakeIndexVerifier) VerifyIndex(_ context.Context, index, signature []byte) error {
+	f.called = true
+	if !bytes.Equal(signature, f.signature) {
+		return fmt.Errorf("bad signature %q", signature)
+	}
+	if len(index) == 0 {
+		return fmt.Errorf("empty index")
+	}
+	return nil
+}
+
+func TestIndexVerification(t *testing.T) {
+	index, err := os.ReadFile("testdata/signing/APKINDEX.tar.gz")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name      string
+		signature []byte
+		skipKeys  bool
+		ignore    bool
+		wantErr   string
+	}{
+		{name: "instead of keys", signature: []byte("good"), skipKeys: true},
+		{name: "bad signature", signature: []byte("bad"), skipKeys: true, wantErr: `bad signature "bad"`},
+		{name: "missing signature", skipKeys: true, wantErr: "index signature"},
+		{name: "in addition to keys", signature: []byte("good"), wantErr: "no keys provided"},
+		{name: "ignore signatures", ignore: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(repo, "aarch64"), 0o755))
+			u := IndexURL(repo, "aarch64")
+			require.NoError(t, os.WriteFile(u, index, 0o644))
+			if tc.signature != nil {
+				require.NoError(t, os.WriteFile(u+".fake", tc.signature, 0o644))
+			}
+
+			v := &fakeIndexVerifier{signature: []byte("good")}
+			_, err := GetRepositoryIndexes(t.Context(), []string{repo + "/"}, nil, "aarch64",
+				WithIgnoreSignatures(tc.ignore),
+				WithIndexVerifications(map[string]IndexVerification{repo: {Verifier: v, SkipKeys: tc.skipKeys}}))
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tc.signature != nil && !tc.ignore, v.called)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// NetworkEvent is a request made to a repository or registry, for the audit
+// of the endpoints touched by a build. Each attempt of a retried request is
+// an event, and requests served from the cache are not.
+type NetworkEvent struct {
+	Time time.Time `json:"time"`
+	// Arch is the architecture of the build which made the request, empty
+	// for requests made for all of them.
+	Arch   string `json:"arch,omitempty"`
+	Method string `json:"method"`
+	// URL is the URL requested, without credentials.
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	// Bytes is how many bytes of the response body were read.
+	Bytes int64 `json:"bytes"`
+	// Digest is the sha256 of the response body, if it was read entirely.
+	Digest string `json:"digest,omitempty"`
+	// Error is why the request, or reading its response, failed.
+	Error string `json:"error,omitempty"`
+}
+
+// NetworkAuditor records the requests made to repositories. Requests are
+// made concurrently, so Audit must be safe to call from multiple goroutines.
+type NetworkAuditor interface {
+	Audit(NetworkEvent)
+}
+
+// NetworkAuditorFunc is a NetworkAuditor which calls the function.
+type NetworkAuditorFunc func(NetworkEvent)
+
+func (f NetworkAuditorFunc) Audit(ev NetworkEvent) {
+	f(ev)
+}
+
+// AuditTransport records the requests made through next with auditor, once
+// their response is read or closed, for arch. The APK audits its own
+// requests; this is for requests made on its behalf, such as those fetching
+// the trusted root of a Sigstore verifier, whose arch is empty.
+func AuditTransport(next http.RoundTripper, auditor NetworkAuditor, arch string) http.RoundTripper {
+	if auditor == nil {
+		return next
+	}
+	return &auditingTransport{next: next, auditor: auditor, arch: arch}
+}
+
+type auditingTransport struct {
+	next    http.RoundTripper
+	auditor NetworkAuditor
+	arch    string
+}
+
+func (t *auditingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ev := NetworkEvent{
+		Time:   time.Now(),
+		Arch:   t.arch,
+		Method: req.Method,
+		URL:    req.URL.Redacted(),
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		ev.Error = err.Error()
+		t.auditor.Audit(ev)
+		return nil, err
+	}
+	ev.Status = res.StatusCode
+	res.Body = &auditBody{ReadCloser: res.Body, auditor: t.auditor, ev: ev, h: sha256.New()}
+	return res, nil
+}
+
+// auditBody counts and digests the body, and audits its event once read or
+// closed.
+type auditBody struct {
+	io.ReadCloser
+	auditor NetworkAuditor
+	ev      NetworkEvent
+	h       hash.Hash
+	once    sync.Once
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.ev.Bytes += int64(n)
+	b.h.Write(p[:n])
+	switch {
+	case err == io.EOF:
+		b.audit(true, nil)
+	case err != nil:
+		b.audit(false, err)
+	}
+	return n, err
+}
+
+func (b *auditBody) Close() error {
+	b.audit(false, nil)
+	return b.ReadCloser.Close()
+}
+
+func (b *auditBody) audit(complete bool, err error) {
+	b.once.Do(func() {
+		if complete {
+			b.ev.Digest = "sha256:" + hex.EncodeToString(b.h.Sum(nil))
+		}
+		if err != nil {
+			b.ev.Error = err.Error()
+		}
+		b.auditor.Audit(b.ev)
+	})
+}
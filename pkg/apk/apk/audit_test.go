@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestNetworkAuditor(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ok" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer s.Close()
+
+	var mu sync.Mutex
+	var events []NetworkEvent
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithArch(testArch), WithNetworkAuditor(NetworkAuditorFunc(func(ev NetworkEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+	})))
+	require.NoError(t, err)
+
+	withCreds := strings.Replace(s.URL, "http://", "http://user:secret@", 1)
+	res, err := a.client.Get(withCreds + "/ok")
+	require.NoError(t, err)
+	_, err = io.ReadAll(res.Body)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	res, err = a.client.Get(s.URL + "/missing")
+	require.NoError(t, err)
+	res.Body.Close()
+
+	require.Len(t, events, 2)
+	require.Equal(t, testArch, events[0].Arch)
+	require.Equal(t, http.MethodGet, events[0].Method)
+	require.Equal(t, strings.Replace(s.URL, "http://", "http://user:xxxxx@", 1)+"/ok", events[0].URL)
+	require.Equal(t, http.StatusOK, events[0].Status)
+	require.Equal(t, int64(5), events[0].Bytes)
+	require.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello"))), events[0].Digest)
+
+	require.Equal(t, s.URL+"/missing", events[1].URL)
+	require.Equal(t, http.StatusNotFound, events[1].Status)
+	require.Empty(t, events[1].Digest)
+}
+
+func TestNetworkAuditorRegistry(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+	bundle := []byte(`{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json"}`)
+	element := pushKeyring(t, host, "keys/audited", bundle)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default"},
+		{name: "retry policy", opts: []Option{WithRetryPolicy(DefaultRetryPolicy())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var urls []string
+			a, err := New(t.Context(), append(tc.opts,
+				WithFS(apkfs.NewMemFS()),
+				WithArch(testArch),
+				WithKeyringVerification(OCIKeyringScheme+host+"/keys/audited", fakeArtifactVerifier{bundle: bundle}),
+				WithNetworkAuditor(NetworkAuditorFunc(func(ev NetworkEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					require.Equal(t, testArch, ev.Arch)
+					urls = append(urls, ev.URL)
+				})))...)
+			require.NoError(t, err)
+
+			_, err = a.FetchOCIKeys(t.Context(), element)
+			require.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Contains(t, urls, s.URL+"/v2/keys/audited/manifests/latest")
+			var referrers bool
+			for _, u := range urls {
+				referrers = referrers || strings.Contains(u, "/v2/keys/audited/referrers/")
+			}
+			require.True(t, referrers, "the referrers holding the Sigstore bundles are audited: %v", urls)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// BaseDirectoryPolicy is what InitDB does with a base directory, such as
+// /tmp, which already exists with other permissions than apk creates it
+// with, as when building over an extracted base image.
+type BaseDirectoryPolicy string
+
+const (
+	// BaseDirectoriesStrict fails InitDB. It is the default.
+	BaseDirectoriesStrict BaseDirectoryPolicy = "strict"
+	// BaseDirectoriesFix changes the permissions of the directory to those
+	// apk creates it with, and warns.
+	BaseDirectoriesFix BaseDirectoryPolicy = "fix"
+	// BaseDirectoriesKeep keeps the permissions of the directory, and warns.
+	BaseDirectoriesKeep BaseDirectoryPolicy = "keep"
+)
+
+// ParseBaseDirectoryPolicy parses s as a BaseDirectoryPolicy, the empty
+// string being BaseDirectoriesStrict.
+func ParseBaseDirectoryPolicy(s string) (BaseDirectoryPolicy, error) {
+	switch p := BaseDirectoryPolicy(s); p {
+	case "":
+		return BaseDirectoriesStrict, nil
+	case BaseDirectoriesStrict, BaseDirectoriesFix, BaseDirectoriesKeep:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown base directory policy %q, must be one of %s, %s or %s", s, BaseDirectoriesStrict, BaseDirectoriesFix, BaseDirectoriesKeep)
+}
+
+// baseDirectoryModes are the bits of the mode of a base directory compared
+// with those it is created with.
+const baseDirectoryModes = fs.ModePerm | fs.ModeSticky
+
+// initBaseDirectories creates the base directories which are missing, and
+// applies the policy to those which exist with other permissions.
+func (a *APK) initBaseDirectories(ctx context.Context) error {
+	log := clog.FromContext(ctx)
+	for _, e := range baseDirectories {
+		stat, err := a.fs.Stat(e.path)
+		switch {
+		case err != nil && errors.Is(err, fs.ErrNotExist):
+			err := a.fs.Mkdir(e.path, e.perms)
+			if err != nil {
+				return fmt.Errorf("failed to create base directory %s: %w", e.path, err)
+			}
+			continue
+		case err != nil:
+			return fmt.Errorf("error opening base directory %s: %w", e.path, err)
+		case !stat.IsDir():
+			return fmt.Errorf("base directory %s is not a directory", e.path)
+		}
+
+		got := stat.Mode() & baseDirectoryModes
+		if got == e.perms {
+			continue
+		}
+		switch a.baseDirectoryPolicy {
+		case BaseDirectoriesFix:
+			log.Warnf("base directory %s has permissions %s, changing them to %s", e.path, got, e.perms)
+			if err := a.fs.Chmod(e.path, e.perms); err != nil {
+				return fmt.Errorf("failed to change the permissions of base directory %s: %w", e.path, err)
+			}
+		case BaseDirectoriesKeep:
+			log.Warnf("base directory %s has permissions %s rather than %s, keeping them", e.path, got, e.perms)
+		default:
+			return fmt.Errorf("base directory %s has incorrect permissions: %s, want %s", e.path, got, e.perms)
+		}
+	}
+	return nil
+}
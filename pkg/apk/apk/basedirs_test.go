@@ -0,0 +1,59 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestInitDBBaseDirectoryPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		policy  BaseDirectoryPolicy
+		tmp     fs.FileMode
+		want    fs.FileMode
+		wantErr string
+	}{
+		{name: "strict", tmp: 0o755, wantErr: "base directory /tmp has incorrect permissions: -rwxr-xr-x, want trwxrwxrwx"},
+		{name: "strict matching", policy: BaseDirectoriesStrict, tmp: 0o777 | fs.ModeSticky, want: 0o777 | fs.ModeSticky},
+		{name: "fix", policy: BaseDirectoriesFix, tmp: 0o755, want: 0o777 | fs.ModeSticky},
+		{name: "keep", policy: BaseDirectoriesKeep, tmp: 0o755, want: 0o755},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := apkfs.NewMemFS()
+			require.NoError(t, src.Mkdir("tmp", 0o755))
+			require.NoError(t, src.Chmod("tmp", tc.tmp))
+			a, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors), WithBaseDirectoryPolicy(tc.policy))
+			require.NoError(t, err)
+			err = a.InitDB(t.Context())
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			fi, err := src.Stat("tmp")
+			require.NoError(t, err)
+			require.Equal(t, tc.want, fi.Mode()&baseDirectoryModes)
+		})
+	}
+
+	_, err := New(t.Context(), WithBaseDirectoryPolicy("lax"))
+	require.EqualError(t, err, `unknown base directory policy "lax", must be one of strict, fix or keep`)
+}
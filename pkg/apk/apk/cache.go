@@ -86,6 +86,12 @@ func (f *flightCache[T]) Do(key string, fn func() (T, error)) (T, error) {
 	return t, nil
 }
 
+// Forget drops the cached result for key, so that the next call fetches it
+// again.
+func (f *flightCache[T]) Forget(key string) {
+	f.cache.Delete(key)
+}
+
 type Cache struct {
 	etagCache  *sync.Map
 	headFlight *singleflight.Group
@@ -412,16 +418,19 @@ func (t *cacheTransport) retrieveAndSaveFile(ctx context.Context, request *http.
 	if err != nil {
 		return "", err
 	} else if resp.StatusCode != 200 {
+		resp.Body.Close()
 		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
 	}
 
 	// Determine the file we will caching stuff in based on the URL/response
 	cacheFile, err := cp(resp)
 	if err != nil {
+		resp.Body.Close()
 		return "", err
 	}
 	cacheDir := filepath.Dir(cacheFile)
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		resp.Body.Close()
 		return "", fmt.Errorf("unable to create cache directory: %w", err)
 	}
 
@@ -429,6 +438,7 @@ func (t *cacheTransport) retrieveAndSaveFile(ctx context.Context, request *http.
 	// directory
 	tmp, err := os.CreateTemp(cacheDir, "*.tmp")
 	if err != nil {
+		resp.Body.Close()
 		return "", fmt.Errorf("unable to create a temporary cache file: %w", err)
 	}
 	// Now that symlinks are used to advertise cached files,
@@ -447,6 +457,14 @@ func (t *cacheTransport) retrieveAndSaveFile(ctx context.Context, request *http.
 		}
 		return nil
 	}(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	// The body may have been cut short by a cancelled request, don't populate
+	// the cache with it.
+	if err := ctx.Err(); err != nil {
+		os.Remove(tmp.Name())
 		return "", err
 	}
 
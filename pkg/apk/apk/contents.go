@@ -0,0 +1,178 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/auth"
+)
+
+// contentsFilename is the name of the contents database a repository may
+// publish next to its index. It is a gzipped text file with a line per file,
+// as Debian Contents files: the path of the file without a leading slash,
+// whitespace, and the comma separated names of the packages installing it.
+const contentsFilename = "CONTENTS.gz"
+
+// ContentsEntry is a file in the contents database of a repository.
+type ContentsEntry struct {
+	// Index is the index of the repository.
+	Index NamedIndex
+	// Path is the path of the file, without a leading slash.
+	Path string
+	// Packages are the names of the packages installing the file.
+	Packages []string
+}
+
+// SearchContents returns the entries of the contents databases of the
+// repositories of indexes whose path matches, skipping the repositories which
+// don't publish one.
+func (a *APK) SearchContents(ctx context.Context, indexes []NamedIndex, match func(path string) bool) ([]ContentsEntry, error) {
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "SearchContents")
+	defer span.End()
+
+	var entries []ContentsEntry
+	for _, idx := range indexes {
+		u := contentsURL(idx)
+		if u == "" {
+			continue
+		}
+		rc, err := a.openContents(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+		if rc == nil {
+			continue
+		}
+		found, err := scanContents(rc, idx, match)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", redact(u), err)
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// contentsURL returns the location of the contents database of the
+// repository of idx.
+func contentsURL(idx NamedIndex) string {
+	src := idx.Source()
+	i := strings.LastIndex(src, "/")
+	if i < 0 {
+		return ""
+	}
+	return src[:i+1] + contentsFilename
+}
+
+// openContents opens the contents database at u, returning nil when the
+// repository doesn't publish one.
+func (a *APK) openContents(ctx context.Context, u string) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "http://") {
+		client := a.client
+		if a.cache != nil {
+			client = a.cache.client(client, true)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		authenticator := a.auth
+		if authenticator == nil {
+			authenticator = auth.DefaultAuthenticators
+		}
+		if err := authenticator.AddAuth(ctx, req); err != nil {
+			return nil, fmt.Errorf("unable to add auth to request: %w", err)
+		}
+		res, err := client.Do(req)
+		if err != nil && a.cache != nil && a.cache.offline {
+			// offline, only the contents databases in the cache are searched
+			clog.FromContext(ctx).Debugf("no cached contents database %s: %v", redact(u), err)
+			return nil, nil
+		} else if err != nil {
+			return nil, repoUnavailable(u, res, err)
+		}
+		switch res.StatusCode {
+		case http.StatusOK:
+			rc = res.Body
+		case http.StatusNotFound, http.StatusForbidden:
+			// buckets often answer 403 for missing objects
+			res.Body.Close()
+			return nil, nil
+		default:
+			res.Body.Close()
+			return nil, &ErrRepoUnavailable{URL: redact(u), Status: res.StatusCode}
+		}
+	} else {
+		f, err := os.Open(u)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rc = f
+	}
+
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("reading %s: %w", redact(u), err)
+	}
+	return readCloser{zr, rc}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// scanContents returns the entries of a contents database whose path
+// matches.
+func scanContents(r io.Reader, idx NamedIndex, match func(path string) bool) ([]ContentsEntry, error) {
+	var entries []ContentsEntry
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		i := strings.LastIndexAny(line, " \t")
+		if i < 0 {
+			continue
+		}
+		p := strings.TrimLeft(strings.TrimSpace(line[:i]), "/")
+		if !match(p) {
+			continue
+		}
+		entries = append(entries, ContentsEntry{
+			Index:    idx,
+			Path:     p,
+			Packages: strings.Split(line[i+1:], ","),
+		})
+	}
+	return entries, s.Err()
+}
@@ -0,0 +1,64 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchContents(t *testing.T) {
+	var contents bytes.Buffer
+	zw := gzip.NewWriter(&contents)
+	_, err := zw.Write([]byte("usr/bin/convert imagemagick\nusr/lib/libMagick.so.7 imagemagick-libs,imagemagick-dev\nusr/share/doc/convert.txt imagemagick-doc\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/os/x86_64/"+contentsFilename {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(contents.Bytes()) //nolint:errcheck
+	}))
+	defer s.Close()
+
+	a, err := New(t.Context(), WithTransport(s.Client().Transport))
+	require.NoError(t, err)
+
+	repo := &Repository{URI: s.URL + "/os/x86_64"}
+	other := &Repository{URI: s.URL + "/other/x86_64"}
+	indexes := []NamedIndex{
+		NewNamedRepositoryWithIndex("os", repo.WithIndex(&APKIndex{})),
+		NewNamedRepositoryWithIndex("other", other.WithIndex(&APKIndex{})),
+	}
+
+	entries, err := a.SearchContents(t.Context(), indexes, func(p string) bool {
+		return strings.HasPrefix(p, "usr/lib/") || strings.HasSuffix(p, "/convert")
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "os", entries[0].Index.Name())
+	require.Equal(t, "usr/bin/convert", entries[0].Path)
+	require.Equal(t, []string{"imagemagick"}, entries[0].Packages)
+	require.Equal(t, "usr/lib/libMagick.so.7", entries[1].Path)
+	require.Equal(t, []string{"imagemagick-libs", "imagemagick-dev"}, entries[1].Packages)
+}
@@ -0,0 +1,292 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// The apk database of an installation is kept in three files of its root
+// filesystem, which are read and written the same way as apk does:
+//
+//   - InstalledDBPath lists the installed packages and their files, see
+//     ParseInstalled and WriteInstalled;
+//   - ScriptsDBPath is a tarball of the install scripts and triggers of the
+//     installed packages, see ParseScripts and WriteScripts;
+//   - TriggersDBPath lists the directories the triggers of the installed
+//     packages watch, see ParseTriggers and WriteTriggers.
+//
+// The paths have no leading slash, as paths in an fs.FS.
+const (
+	InstalledDBPath = installedFilePath
+	ScriptsDBPath   = scriptsFilePath
+	TriggersDBPath  = triggersFilePath
+)
+
+// Database is the apk database of an installation.
+type Database struct {
+	Installed []*InstalledPackage
+	Scripts   []Script
+	Triggers  []Trigger
+}
+
+// ReadDatabase reads the apk database of the root filesystem fsys. The
+// scripts and triggers are empty if their files do not exist, as in images
+// built before apko kept them.
+func ReadDatabase(fsys fs.FS) (*Database, error) {
+	db := &Database{}
+
+	f, err := fsys.Open(InstalledDBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	db.Installed, err = ParseInstalled(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", InstalledDBPath, err)
+	}
+
+	if f, err := fsys.Open(ScriptsDBPath); err == nil {
+		defer f.Close()
+		if db.Scripts, err = ParseScripts(f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", ScriptsDBPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if f, err := fsys.Open(TriggersDBPath); err == nil {
+		defer f.Close()
+		if db.Triggers, err = ParseTriggers(f); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", TriggersDBPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Script returns the script of pkg of type typ, e.g. ".post-install", if it
+// has one.
+func (db *Database) Script(pkg *Package, typ string) (Script, bool) {
+	for _, s := range db.Scripts {
+		if s.Type == typ && string(s.Checksum) == string(pkg.Checksum) {
+			return s, true
+		}
+	}
+	return Script{}, false
+}
+
+// Trigger returns the trigger of pkg, if it has one.
+func (db *Database) Trigger(pkg *Package) (Trigger, bool) {
+	for _, t := range db.Triggers {
+		if string(t.Checksum) == string(pkg.Checksum) {
+			return t, true
+		}
+	}
+	return Trigger{}, false
+}
+
+// WriteInstalled writes the entry of pkg, with files, to w, in the format of
+// InstalledDBPath. The entries of the installed packages follow one another
+// in the file, in the order they were installed.
+//
+// The files are listed by directory, with an entry added for any parent
+// directory which is not in files. The checksum of a regular file is that of
+// its APK-TOOLS.checksum.SHA1 PAX record, as in the data section of a package.
+func WriteInstalled(w io.Writer, pkg *Package, files []tar.Header) error {
+	// sort the files by directory
+	sortedFiles := sortTarHeaders(withParentDirs(files))
+	// package lines
+	pkgLines := PackageToInstalled(pkg)
+	// file lines
+	for _, f := range sortedFiles {
+		perm := f.Mode & 0777
+		user := f.Uid
+		group := f.Gid
+
+		if f.Typeflag == tar.TypeDir {
+			dirName := strings.TrimSuffix(f.Name, "/")
+			pkgLines = append(pkgLines, fmt.Sprintf("F:%s", dirName))
+			if perm != 0o755 || user != 0 || group != 0 {
+				pkgLines = append(pkgLines, fmt.Sprintf("M:%d:%d:%04o", user, group, perm))
+			}
+		} else {
+			pkgLines = append(pkgLines, fmt.Sprintf("R:%s", f.Name[strings.LastIndex(f.Name, "/")+1:]))
+			if perm != 0o644 || user != 0 || group != 0 {
+				pkgLines = append(pkgLines, fmt.Sprintf("a:%d:%d:%04o", user, group, perm))
+			}
+			if f.PAXRecords != nil {
+				if checksum := f.PAXRecords[paxRecordsChecksumKey]; checksum != "" {
+					checksum, err := installedChecksum(checksum)
+					if err != nil {
+						return fmt.Errorf("checksum of %s: %w", f.Name, err)
+					}
+					pkgLines = append(pkgLines, fmt.Sprintf("Z:%s", checksum))
+				}
+			}
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(pkgLines, "\n")+"\n\n")
+	return err
+}
+
+// Script is an install script or the trigger of an installed package, as kept
+// in the tarball at ScriptsDBPath.
+type Script struct {
+	// Package, Version and Checksum identify the package of the script.
+	Package  string
+	Version  string
+	Checksum []byte
+	// Type is the name of the script in the control section of the package,
+	// e.g. ".post-install" or ".trigger".
+	Type    string
+	Mode    int64
+	ModTime time.Time
+	Content []byte
+}
+
+// FileName returns the name of s in the scripts tarball,
+// <package>-<version>.Q1<checksum><type>.
+func (s *Script) FileName() string {
+	return fmt.Sprintf("%s-%s.Q1%s%s", s.Package, s.Version, base64.StdEncoding.EncodeToString(s.Checksum), s.Type)
+}
+
+// ParseScripts parses the scripts tarball at ScriptsDBPath.
+func ParseScripts(r io.Reader) ([]Script, error) {
+	var scripts []Script
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return scripts, nil
+		} else if err != nil {
+			return nil, err
+		}
+		s, err := parseScriptName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		s.Mode = hdr.Mode
+		s.ModTime = hdr.ModTime
+		if s.Content, err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		scripts = append(scripts, s)
+	}
+}
+
+// parseScriptName parses the name of a script in the scripts tarball into the
+// package, version, checksum and type of the script.
+func parseScriptName(name string) (Script, error) {
+	i := strings.LastIndex(name, ".Q1")
+	if i < 0 {
+		return Script{}, fmt.Errorf("script %s: no checksum in the name", name)
+	}
+	// The base64 alphabet has no dot.
+	sum, typ, ok := strings.Cut(name[i+3:], ".")
+	if !ok {
+		return Script{}, fmt.Errorf("script %s: no type in the name", name)
+	}
+	checksum, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil {
+		return Script{}, fmt.Errorf("script %s: %w", name, err)
+	}
+	// As apk does, the version starts after the last dash which is followed
+	// by a valid version.
+	nameVersion := name[:i]
+	for j := strings.LastIndex(nameVersion, "-"); j > 0; j = strings.LastIndex(nameVersion[:j], "-") {
+		if _, err := ParseVersion(nameVersion[j+1:]); err == nil {
+			return Script{
+				Package:  nameVersion[:j],
+				Version:  nameVersion[j+1:],
+				Checksum: checksum,
+				Type:     "." + typ,
+			}, nil
+		}
+	}
+	return Script{}, fmt.Errorf("script %s: no version in the name", name)
+}
+
+// WriteScripts writes scripts to w as a tarball in the format of
+// ScriptsDBPath.
+func WriteScripts(w io.Writer, scripts ...Script) error {
+	tw := tar.NewWriter(w)
+	for _, s := range scripts {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     s.FileName(),
+			Mode:     s.Mode,
+			ModTime:  s.ModTime,
+			Size:     int64(len(s.Content)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(s.Content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// Trigger is the trigger of an installed package, as listed in the file at
+// TriggersDBPath. The script of the trigger is in the scripts tarball.
+type Trigger struct {
+	// Checksum identifies the package of the trigger.
+	Checksum []byte
+	// Paths are the directories the trigger watches, as globs.
+	Paths []string
+}
+
+// ParseTriggers parses the file at TriggersDBPath.
+func ParseTriggers(r io.Reader) ([]Trigger, error) {
+	var triggers []Trigger
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		sum, ok := strings.CutPrefix(fields[0], "Q1")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a Q1 checksum, got %q", n, fields[0])
+		}
+		checksum, err := base64.StdEncoding.DecodeString(sum)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		triggers = append(triggers, Trigger{Checksum: checksum, Paths: fields[1:]})
+	}
+	return triggers, scanner.Err()
+}
+
+// WriteTriggers writes triggers to w in the format of TriggersDBPath.
+func WriteTriggers(w io.Writer, triggers ...Trigger) error {
+	for _, t := range triggers {
+		if _, err := fmt.Fprintf(w, "Q1%s %s\n", base64.StdEncoding.EncodeToString(t.Checksum), strings.Join(t.Paths, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstalledRoundTrip(t *testing.T) {
+	pkg := &Package{
+		Name:      "hello",
+		Version:   "2.12-r0",
+		Arch:      "x86_64",
+		Checksum:  []byte("0123456789abcdefghij"),
+		BuildTime: time.Unix(1700000000, 0).UTC(),
+	}
+	files := []tar.Header{
+		{Name: "usr/bin/hello", Typeflag: tar.TypeReg, Mode: 0o755, PAXRecords: map[string]string{
+			paxRecordsChecksumKey: "91abf197227d2fe71d016f4ccb68b16c9c9b2768",
+		}},
+		{Name: "usr/share/hello", Typeflag: tar.TypeDir, Mode: 0o750, Uid: 1, Gid: 2},
+		{Name: "usr/share/hello/data", Typeflag: tar.TypeReg, Mode: 0o600, Uid: 1, Gid: 2, PAXRecords: map[string]string{
+			paxRecordsChecksumKey: "Q1kavxlyJ9L+cdAW9My2ixbJybJ2g=",
+		}},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteInstalled(&b, pkg, files))
+	require.NoError(t, WriteInstalled(&b, &Package{Name: "empty", Version: "1-r0", BuildTime: time.Unix(0, 0).UTC()}, nil))
+	require.Equal(t, `P:hello
+V:2.12-r0
+A:x86_64
+L:
+T:
+o:
+m:
+U:
+c:
+t:1700000000
+S:0
+I:0
+k:0
+C:Q1MDEyMzQ1Njc4OWFiY2RlZmdoaWo=
+F:usr
+F:usr/bin
+R:hello
+a:0:0:0755
+Z:Q1kavxlyJ9L+cdAW9My2ixbJybJ2g=
+F:usr/share
+F:usr/share/hello
+M:1:2:0750
+R:data
+a:1:2:0600
+Z:Q1kavxlyJ9L+cdAW9My2ixbJybJ2g=
+
+P:empty
+V:1-r0
+A:
+L:
+T:
+o:
+m:
+U:
+c:
+t:0
+S:0
+I:0
+k:0
+
+`, b.String())
+
+	installed, err := ParseInstalled(bytes.NewReader(b.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, installed, 2)
+	require.Equal(t, "hello", installed[0].Name)
+	require.Equal(t, pkg.Checksum, installed[0].Checksum)
+	// The files keep their modes, but not their checksums.
+	require.Equal(t, []tar.Header{
+		{Name: "usr", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin/hello", Mode: 0o755},
+		{Name: "usr/share", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/share/hello", Typeflag: tar.TypeDir, Mode: 0o750, Uid: 1, Gid: 2},
+		{Name: "usr/share/hello/data", Mode: 0o600, Uid: 1, Gid: 2},
+	}, installed[0].Files)
+	require.Equal(t, "empty", installed[1].Name)
+	require.Empty(t, installed[1].Files)
+}
+
+func TestScriptsRoundTrip(t *testing.T) {
+	scripts := []Script{{
+		Package:  "glib",
+		Version:  "2.80.0-r0",
+		Checksum: []byte("glib-checksum"),
+		Type:     ".trigger",
+		Mode:     0o755,
+		ModTime:  time.Unix(1700000000, 0),
+		Content:  []byte("#!/bin/sh\nglib-compile-schemas \"$@\"\n"),
+	}, {
+		Package:  "py3-setuptools-scm",
+		Version:  "8.1.0_git20240101-r12",
+		Checksum: []byte("py3-checksum"),
+		Type:     ".post-install",
+		Mode:     0o755,
+		ModTime:  time.Unix(1700000000, 0),
+		Content:  []byte("#!/bin/sh\n"),
+	}}
+	require.Equal(t, "glib-2.80.0-r0.Q1Z2xpYi1jaGVja3N1bQ==.trigger", scripts[0].FileName())
+
+	var b bytes.Buffer
+	require.NoError(t, WriteScripts(&b, scripts...))
+	got, err := ParseScripts(&b)
+	require.NoError(t, err)
+	require.Equal(t, scripts, got)
+}
+
+func TestParseScriptName(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		want    Script
+		wantErr string
+	}{{
+		name: "busybox-1.36.1-r0.Q1ZGF0YQ==.post-install",
+		want: Script{Package: "busybox", Version: "1.36.1-r0", Checksum: []byte("data"), Type: ".post-install"},
+	}, {
+		name: "font-noto-cjk-2-0.Q1ZGF0YQ==.trigger",
+		want: Script{Package: "font-noto-cjk-2", Version: "0", Checksum: []byte("data"), Type: ".trigger"},
+	}, {
+		name:    "busybox-1.36.1-r0.post-install",
+		wantErr: "script busybox-1.36.1-r0.post-install: no checksum in the name",
+	}, {
+		name:    "busybox.Q1ZGF0YQ==.post-install",
+		wantErr: "script busybox.Q1ZGF0YQ==.post-install: no version in the name",
+	}, {
+		name:    "busybox-1.36.1-r0.Q1ZGF0YQ==",
+		wantErr: "script busybox-1.36.1-r0.Q1ZGF0YQ==: no type in the name",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScriptName(tt.name)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTriggersRoundTrip(t *testing.T) {
+	triggers := []Trigger{
+		{Checksum: []byte("glib-checksum"), Paths: []string{"/usr/share/glib-2.0/schemas", "/usr/lib/gio/modules"}},
+		{Checksum: []byte("mime-checksum"), Paths: []string{"/usr/share/mime"}},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteTriggers(&b, triggers...))
+	require.Equal(t, "Q1Z2xpYi1jaGVja3N1bQ== /usr/share/glib-2.0/schemas /usr/lib/gio/modules\nQ1bWltZS1jaGVja3N1bQ== /usr/share/mime\n", b.String())
+	got, err := ParseTriggers(&b)
+	require.NoError(t, err)
+	require.Equal(t, triggers, got)
+
+	_, err = ParseTriggers(bytes.NewBufferString("\nsha1 /usr/share/mime\n"))
+	require.EqualError(t, err, `line 2: expected a Q1 checksum, got "sha1"`)
+}
+
+func TestReadDatabase(t *testing.T) {
+	glib := &Package{Name: "glib", Version: "2.80.0-r0", Checksum: []byte("glib-checksum")}
+	musl := &Package{Name: "musl", Version: "1.2.5-r0", Checksum: []byte("musl-checksum")}
+	var installed, scripts, triggers bytes.Buffer
+	require.NoError(t, WriteInstalled(&installed, musl, nil))
+	require.NoError(t, WriteInstalled(&installed, glib, nil))
+	trigger := Script{Package: "glib", Version: "2.80.0-r0", Checksum: glib.Checksum, Type: ".trigger", Content: []byte("#!/bin/sh\n")}
+	require.NoError(t, WriteScripts(&scripts, trigger))
+	require.NoError(t, WriteTriggers(&triggers, Trigger{Checksum: glib.Checksum, Paths: []string{"/usr/share/glib-2.0/schemas"}}))
+
+	fsys := fstest.MapFS{
+		InstalledDBPath: {Data: installed.Bytes()},
+		ScriptsDBPath:   {Data: scripts.Bytes()},
+		TriggersDBPath:  {Data: triggers.Bytes()},
+	}
+	db, err := ReadDatabase(fsys)
+	require.NoError(t, err)
+	require.Len(t, db.Installed, 2)
+	got, ok := db.Script(glib, ".trigger")
+	require.True(t, ok)
+	require.Equal(t, trigger.Content, got.Content)
+	_, ok = db.Script(glib, ".post-install")
+	require.False(t, ok)
+	tr, ok := db.Trigger(glib)
+	require.True(t, ok)
+	require.Equal(t, []string{"/usr/share/glib-2.0/schemas"}, tr.Paths)
+	_, ok = db.Trigger(musl)
+	require.False(t, ok)
+
+	// The scripts and triggers are optional, the installed packages are not.
+	delete(fsys, ScriptsDBPath)
+	delete(fsys, TriggersDBPath)
+	db, err = ReadDatabase(fsys)
+	require.NoError(t, err)
+	require.Len(t, db.Installed, 2)
+	require.Empty(t, db.Scripts)
+	require.Empty(t, db.Triggers)
+
+	delete(fsys, InstalledDBPath)
+	_, err = ReadDatabase(fsys)
+	require.Error(t, err)
+}
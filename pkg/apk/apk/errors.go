@@ -15,8 +15,13 @@
 package apk
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
+
+	"chainguard.dev/apko/pkg/apk/expandapk"
 )
 
 type FileExistsError struct {
@@ -56,3 +61,99 @@ func (f FileConflictError) Is(target error) bool {
 	var targetError FileConflictError
 	return errors.As(target, &targetError)
 }
+
+var (
+	// ErrPackageNotFound is returned when no package in the indexes satisfies
+	// a constraint.
+	ErrPackageNotFound = errors.New("package not found")
+
+	// ErrChecksumMismatch is returned when a fetched package differs from the
+	// checksum in its index, or one of its files from the checksum recorded
+	// for it in the package.
+	ErrChecksumMismatch = expandapk.ErrChecksumMismatch
+
+	// ErrSignatureInvalid is returned when an index or package is unsigned, or
+	// its signature can't be verified with the keyring.
+	ErrSignatureInvalid = errors.New("invalid signature")
+)
+
+// ErrRepoUnavailable is returned when a repository index or package can't be
+// fetched, because the request failed or the repository responded with an
+// error status.
+type ErrRepoUnavailable struct {
+	// URL is the redacted URL that was requested.
+	URL string
+	// Status is the HTTP status code of the response, or 0 if there was none.
+	Status int
+	// Err is why the request failed, if known.
+	Err error
+}
+
+func (e *ErrRepoUnavailable) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("unexpected status code %d (%s)", e.Status, http.StatusText(e.Status))
+}
+
+func (e *ErrRepoUnavailable) Unwrap() error {
+	return e.Err
+}
+
+// repoUnavailable returns the ErrRepoUnavailable for a failed request for u,
+// with the status of its response if there was one.
+func repoUnavailable(u string, res *http.Response, err error) *ErrRepoUnavailable {
+	e := &ErrRepoUnavailable{URL: redact(u), Err: err}
+	if res != nil {
+		e.Status = res.StatusCode
+	}
+	return e
+}
+
+// classifiedError is an error that also matches one of the sentinel errors
+// above, without changing its message.
+type classifiedError struct {
+	err  error
+	kind error
+}
+
+// classify marks err as being of kind, one of the sentinel errors.
+func classify(kind, err error) error {
+	return &classifiedError{err: err, kind: kind}
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+// PhaseTimeoutError is the cause of the cancellation of an operation which
+// ran out of the time of its phase, see WithFetchTimeout and
+// WithResolveTimeout. It matches context.DeadlineExceeded.
+type PhaseTimeoutError struct {
+	// Phase is "fetch" or "resolve".
+	Phase string
+	// What is what was being fetched or resolved.
+	What    string
+	Timeout time.Duration
+}
+
+func (e *PhaseTimeoutError) Error() string {
+	return fmt.Sprintf("%s of %s timed out after %s", e.Phase, e.What, e.Timeout)
+}
+
+func (e *PhaseTimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// withPhaseTimeout returns a copy of ctx which is cancelled with a
+// PhaseTimeoutError after timeout, if it is set.
+func withPhaseTimeout(ctx context.Context, phase, what string, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeoutCause(ctx, timeout, &PhaseTimeoutError{Phase: phase, What: what, Timeout: timeout})
+}
@@ -0,0 +1,177 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha1" //nolint:gosec // apk file checksums are SHA-1
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestErrPackageNotFound(t *testing.T) {
+	_, index := testGetPackagesAndIndex()
+	resolver := NewPkgResolver(t.Context(), testNamedRepositoryFromIndexes(index))
+
+	for _, names := range [][]string{
+		{"package-does-not-exist"},
+		{"package1>999"},
+	} {
+		t.Run(names[0], func(t *testing.T) {
+			_, _, err := resolver.GetPackagesWithDependencies(t.Context(), names, nil)
+			require.ErrorIs(t, err, ErrPackageNotFound)
+		})
+	}
+}
+
+func TestErrRepoUnavailable(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	_, err := GetRepositoryIndexes(t.Context(), []string{s.URL + "/os"}, nil, testArch, WithHTTPClient(s.Client()), WithIgnoreSignatures(true))
+	var unavailable *ErrRepoUnavailable
+	require.ErrorAs(t, err, &unavailable)
+	require.Equal(t, http.StatusServiceUnavailable, unavailable.Status)
+	require.Equal(t, fmt.Sprintf("%s/os/%s/APKINDEX.tar.gz", s.URL, testArch), unavailable.URL)
+
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()))
+	require.NoError(t, err)
+	a.SetClient(&http.Client{Transport: &testLocalTransport{fail: true}})
+	repo := Repository{URI: fmt.Sprintf("%s/%s", testAlpineRepos, testArch)}
+	pkg := NewRepositoryPackage(&testPkg, repo.WithIndex(&APKIndex{Packages: []*Package{&testPkg}}))
+	_, err = a.FetchPackage(t.Context(), pkg)
+	require.ErrorAs(t, err, &unavailable)
+	require.Equal(t, http.StatusNotFound, unavailable.Status)
+}
+
+// writeTamperedAPK writes an unsigned package for pkg to dir whose only file
+// differs from the checksum in its header.
+func writeTamperedAPK(t *testing.T, dir string, pkg *Package) {
+	t.Helper()
+
+	stream := func(w io.Writer, hdr *tar.Header, content string) {
+		gw := gzip.NewWriter(w)
+		tw := tar.NewWriter(gw)
+		hdr.Size = int64(len(content))
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := io.WriteString(tw, content)
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+	}
+
+	var buf bytes.Buffer
+	stream(&buf, &tar.Header{Name: ".PKGINFO", Mode: 0o644}, fmt.Sprintf("pkgname = %s\npkgver = %s\n", pkg.Name, pkg.Version))
+	sum := sha1.Sum([]byte("expected")) //nolint:gosec // apk file checksums are SHA-1
+	stream(&buf, &tar.Header{
+		Name:       "usr/share/tampered",
+		Mode:       0o644,
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{"APK-TOOLS.checksum.SHA1": hex.EncodeToString(sum[:])},
+	}, "tampered")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, pkg.Filename()), buf.Bytes(), 0o644))
+}
+
+func TestErrChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	tampered := &Package{Name: "tampered", Version: "1.0-r0"}
+	writeTamperedAPK(t, dir, tampered)
+	src, err := filepath.Abs(filepath.Join(testPrimaryPkgDir, testPkg.Filename()))
+	require.NoError(t, err)
+	require.NoError(t, os.Symlink(src, filepath.Join(dir, testPkg.Filename())))
+
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()))
+	require.NoError(t, err)
+	a.SetClient(&http.Client{Transport: &testLocalTransport{root: dir, basenameOnly: true}})
+
+	mismatched := testPkg
+	mismatched.Checksum = make([]byte, len(testPkg.Checksum))
+	repo := Repository{URI: fmt.Sprintf("%s/%s", testAlpineRepos, testArch)}
+	for _, tc := range []struct {
+		name    string
+		pkg     *Package
+		wantErr error
+	}{
+		{name: "match", pkg: &testPkg},
+		{name: "mismatch", pkg: tampered, wantErr: ErrChecksumMismatch},
+		{name: "index mismatch", pkg: &mismatched, wantErr: ErrChecksumMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pkg := NewRepositoryPackage(tc.pkg, repo.WithIndex(&APKIndex{Packages: []*Package{tc.pkg}}))
+			exp, err := a.expandPackage(t.Context(), pkg)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			exp.Close()
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	err := classify(ErrSignatureInvalid, errors.New("package foo is not signed"))
+	require.EqualError(t, err, "package foo is not signed")
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+	require.NotErrorIs(t, err, ErrPackageNotFound)
+
+	wrapped := fmt.Errorf("installing foo: %w", err)
+	require.ErrorIs(t, wrapped, ErrSignatureInvalid)
+}
+
+func TestPhaseTimeout(t *testing.T) {
+	// A mirror which accepts connections and never answers.
+	s := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer s.Close()
+
+	const timeout = 100 * time.Millisecond
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithArch(testArch), WithFetchTimeout(timeout), WithIgnoreMknodErrors(true))
+	require.NoError(t, err)
+	a.SetClient(s.Client())
+	require.NoError(t, a.InitDB(t.Context()))
+	require.NoError(t, a.SetRepositories(t.Context(), []string{s.URL + "/os"}))
+
+	_, err = a.GetRepositoryIndexes(t.Context(), true)
+	var timedOut *PhaseTimeoutError
+	require.ErrorAs(t, err, &timedOut)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, "fetch", timedOut.Phase)
+	require.Equal(t, timeout, timedOut.Timeout)
+
+	repo := Repository{URI: fmt.Sprintf("%s/os/%s", s.URL, testArch)}
+	pkg := NewRepositoryPackage(&testPkg, repo.WithIndex(&APKIndex{Packages: []*Package{&testPkg}}))
+	_, err = a.expandPackage(t.Context(), pkg)
+	require.ErrorAs(t, err, &timedOut)
+	require.Equal(t, testPkg.Name, timedOut.What)
+}
@@ -14,8 +14,39 @@
 
 package apk
 
-// Executor provider of interface to execute commands, if used.
-// Will be used primarily to execute scripts.
+import (
+	"context"
+	"io"
+)
+
+// Executor runs commands inside a root filesystem on disk, the way the install
+// scripts and triggers of packages would be run. Install scripts and triggers
+// are not run by apk itself; an Executor lets callers run equivalent commands,
+// or commands which validate the result, after the packages are installed.
+//
+// See chainguard.dev/apko/pkg/executor for implementations.
 type Executor interface {
-	Execute(name string, arg ...string) error
+	// Execute runs cmd with root, a directory on the host, as its root
+	// directory, and waits for it to finish. It returns an error if the
+	// command could not be started, or did not exit with status 0, in which
+	// case the error wraps an *exec.ExitError.
+	Execute(ctx context.Context, root string, cmd Command) error
+}
+
+// Command is a command for an Executor to run.
+type Command struct {
+	// Args holds the program and its arguments. A program without a slash is
+	// looked up in the directories of the PATH of Env, in the root filesystem.
+	Args []string
+	// Env holds the environment of the command, as KEY=value pairs.
+	Env []string
+	// Dir is the working directory of the command in the root filesystem,
+	// or / if empty.
+	Dir string
+
+	// Stdin, Stdout and Stderr are connected to the command as in
+	// exec.Cmd: the null device is used for those which are nil.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
 }
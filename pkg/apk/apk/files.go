@@ -0,0 +1,137 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/paths"
+)
+
+// FetchFile fetches the file at u, which must have the hex encoded sha256
+// digest. With a cache, the file is kept in the cache by its digest, so it
+// is only fetched once and can be read back offline.
+func (a *APK) FetchFile(ctx context.Context, u, digest string) ([]byte, error) {
+	log := clog.FromContext(ctx)
+
+	asURL, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", redact(u), err)
+	}
+
+	var cacheFile string
+	if a.cache != nil {
+		cacheFile = filepath.Join(a.cache.dir, "sha256", digest)
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			if err := verifyFileDigest(u, data, digest); err == nil {
+				log.Debugf("using cached %s", redact(u))
+				return data, nil
+			}
+		}
+	}
+
+	var data []byte
+	switch asURL.Scheme {
+	case "file":
+		data, err = os.ReadFile(asURL.Path)
+		if err != nil {
+			return nil, err
+		}
+	case "https", "http":
+		if a.cache != nil && a.cache.offline {
+			return nil, fmt.Errorf("%s is not in the offline cache", redact(u))
+		}
+		data, err = a.fetchFile(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("scheme %s of %s not supported", asURL.Scheme, redact(u))
+	}
+	if err := verifyFileDigest(u, data, digest); err != nil {
+		return nil, err
+	}
+
+	if cacheFile != "" {
+		if err := cacheFetchedFile(cacheFile, data); err != nil {
+			log.Warnf("unable to cache %s: %v", redact(u), err)
+		}
+	}
+	return data, nil
+}
+
+func (a *APK) fetchFile(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.auth.AddAuth(ctx, req); err != nil {
+		return nil, fmt.Errorf("failed to add auth to request: %w", err)
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get %s: %w", redact(u), err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get %s: %w", redact(u), &ErrRepoUnavailable{URL: redact(u), Status: res.StatusCode})
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", redact(u), err)
+	}
+	return data, nil
+}
+
+func verifyFileDigest(u string, data []byte, digest string) error {
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != digest {
+		return fmt.Errorf("the sha256 digest of %s is %s, expected %s", redact(u), got, digest)
+	}
+	return nil
+}
+
+// cacheFetchedFile atomically writes the contents of a fetched file to the
+// cache.
+func cacheFetchedFile(cacheFile string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cacheFile), "*.tmp")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Chmod(os.FileMode(0664))
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return paths.AdvertiseCachedFile(tmp.Name(), cacheFile)
+}
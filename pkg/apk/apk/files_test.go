@@ -0,0 +1,84 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestFetchFile(t *testing.T) {
+	content := []byte("#!/bin/sh\necho hello\n")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/hello" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	cache := t.TempDir()
+	newAPK := func(offline bool) *APK {
+		a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithCache(cache, offline, NewCache(false)))
+		require.NoError(t, err)
+		return a
+	}
+
+	a := newAPK(false)
+	data, err := a.FetchFile(t.Context(), srv.URL+"/hello", digest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, 1, requests)
+
+	// The file is only fetched once, and can be read back offline.
+	data, err = a.FetchFile(t.Context(), srv.URL+"/hello", digest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	data, err = newAPK(true).FetchFile(t.Context(), srv.URL+"/hello", digest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, 1, requests)
+
+	_, err = a.FetchFile(t.Context(), srv.URL+"/hello", "00"+digest[2:])
+	require.ErrorContains(t, err, fmt.Sprintf("the sha256 digest of %s/hello is %s", srv.URL, digest))
+
+	_, err = a.FetchFile(t.Context(), srv.URL+"/missing", digest[:62]+"00")
+	require.ErrorContains(t, err, "unable to get")
+
+	_, err = newAPK(true).FetchFile(t.Context(), srv.URL+"/other", digest[:62]+"00")
+	require.ErrorContains(t, err, "not in the offline cache")
+
+	local := filepath.Join(t.TempDir(), "hello")
+	require.NoError(t, os.WriteFile(local, content, 0o644))
+	data, err = a.FetchFile(t.Context(), "file://"+local, digest)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+}
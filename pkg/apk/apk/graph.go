@@ -0,0 +1,126 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"slices"
+	"strings"
+)
+
+// PackageGraph is the dependency graph of a resolved set of packages, with
+// each dependency resolved to the package in the set which satisfies it.
+type PackageGraph struct {
+	packages map[string]*RepositoryPackage
+	deps     map[string][]string
+	rdeps    map[string][]string
+}
+
+// NewPackageGraph returns the dependency graph of pkgs, e.g. as returned by
+// ResolveWorld. Dependencies which are not satisfied by any of pkgs, and
+// conflicts, are ignored.
+func NewPackageGraph(pkgs []*RepositoryPackage) *PackageGraph {
+	g := &PackageGraph{
+		packages: make(map[string]*RepositoryPackage, len(pkgs)),
+		deps:     make(map[string][]string, len(pkgs)),
+		rdeps:    make(map[string][]string, len(pkgs)),
+	}
+
+	providers := map[string]string{}
+	for _, pkg := range pkgs {
+		g.packages[pkg.Name] = pkg
+		for _, p := range pkg.Provides {
+			name, _, _ := strings.Cut(p, "=")
+			providers[name] = pkg.Name
+		}
+	}
+	// A package always provides itself, even if another claims to.
+	for _, pkg := range pkgs {
+		providers[pkg.Name] = pkg.Name
+	}
+
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			provider, ok := providers[ResolvePackageNameVersionPin(dep).Name]
+			if !ok || provider == pkg.Name || slices.Contains(g.deps[pkg.Name], provider) {
+				continue
+			}
+			g.deps[pkg.Name] = append(g.deps[pkg.Name], provider)
+			g.rdeps[provider] = append(g.rdeps[provider], pkg.Name)
+		}
+	}
+	for _, names := range g.deps {
+		slices.Sort(names)
+	}
+	for _, names := range g.rdeps {
+		slices.Sort(names)
+	}
+	return g
+}
+
+// Package returns the package with the given name, or nil if it is not in
+// the graph.
+func (g *PackageGraph) Package(name string) *RepositoryPackage {
+	return g.packages[name]
+}
+
+// Dependencies returns the names of the packages the named package directly
+// depends on, sorted by name.
+func (g *PackageGraph) Dependencies(name string) []string {
+	return g.deps[name]
+}
+
+// ReverseDependencies returns the names of the packages which directly
+// depend on the named package, sorted by name.
+func (g *PackageGraph) ReverseDependencies(name string) []string {
+	return g.rdeps[name]
+}
+
+// Roots returns the names of the packages which no other package depends
+// on, sorted by name.
+func (g *PackageGraph) Roots() []string {
+	var roots []string
+	for name := range g.packages {
+		if len(g.rdeps[name]) == 0 {
+			roots = append(roots, name)
+		}
+	}
+	slices.Sort(roots)
+	return roots
+}
+
+// SubtreeSize returns the installed size of the named package and of every
+// package it transitively depends on, each counted once.
+func (g *PackageGraph) SubtreeSize(name string) uint64 {
+	var size uint64
+	seen := map[string]struct{}{}
+	var walk func(string)
+	walk = func(n string) {
+		if _, ok := seen[n]; ok {
+			return
+		}
+		seen[n] = struct{}{}
+		if pkg, ok := g.packages[n]; ok {
+			size += pkg.InstalledSize
+		}
+		for _, d := range g.deps[n] {
+			walk(d)
+		}
+	}
+	walk(name)
+	return size
+}
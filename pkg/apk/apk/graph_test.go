@@ -0,0 +1,50 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageGraph(t *testing.T) {
+	pkg := func(name string, size uint64, deps, provides []string) *RepositoryPackage {
+		return NewRepositoryPackage(&Package{
+			Name:          name,
+			Version:       "1.0-r0",
+			InstalledSize: size,
+			Dependencies:  deps,
+			Provides:      provides,
+		}, nil)
+	}
+	g := NewPackageGraph([]*RepositoryPackage{
+		pkg("app", 100, []string{"so:libc.so.1", "openssl>3", "!app-legacy", "missing"}, nil),
+		pkg("openssl", 50, []string{"so:libc.so.1", "ca-certificates"}, []string{"so:libssl.so.3=3.2.0"}),
+		pkg("libc", 10, nil, []string{"so:libc.so.1=1"}),
+		pkg("ca-certificates", 5, []string{"openssl"}, nil),
+	})
+
+	require.Equal(t, []string{"libc", "openssl"}, g.Dependencies("app"))
+	require.Equal(t, []string{"ca-certificates", "libc"}, g.Dependencies("openssl"))
+	require.Equal(t, []string{"app", "openssl"}, g.ReverseDependencies("libc"))
+	require.Equal(t, []string{"app", "ca-certificates"}, g.ReverseDependencies("openssl"))
+	require.Equal(t, []string{"app"}, g.Roots())
+
+	require.Equal(t, uint64(165), g.SubtreeSize("app"))
+	// openssl and ca-certificates depend on each other, and are counted once.
+	require.Equal(t, uint64(65), g.SubtreeSize("openssl"))
+	require.Equal(t, uint64(10), g.SubtreeSize("libc"))
+}
@@ -18,8 +18,10 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
-	"crypto/sha1" //nolint:gosec // this is what apk tools is using
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
@@ -29,6 +31,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
@@ -39,9 +42,10 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/hashicorp/go-retryablehttp"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"go.lsp.dev/uri"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -53,6 +57,7 @@ import (
 
 	"chainguard.dev/apko/internal/tarfs"
 	"chainguard.dev/apko/pkg/apk/auth"
+	"chainguard.dev/apko/pkg/apk/digest"
 	"chainguard.dev/apko/pkg/apk/expandapk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/paths"
@@ -76,6 +81,42 @@ type APK struct {
 	ignoreSignatures   bool
 	noSignatureIndexes []string
 	auth               auth.Authenticator
+	keyringPolicy      KeyringPolicy
+	indexVerifications map[string]IndexVerification
+	signaturePolicies  map[string]SignaturePolicy
+
+	unsignedRepositories map[string]string
+	repositoryKeys       map[string]map[string][]byte
+
+	verifyPackageSignatures  bool
+	signatureVerificationsMu sync.Mutex
+	indexSignatures          map[string]Verification
+	packageSignatures        map[string]Verification
+
+	// localIndexes synthesizes the indexes of local repositories.
+	localIndexes bool
+
+	remoteOptions        []remote.Option
+	keyringVerifications map[string]ArtifactVerifier
+
+	// keyringMu guards the keys discovered for keyRepositories, the build
+	// repositories given to InitDB, so that RefreshKeys can replace them
+	// while indexes and packages are verified.
+	keyringMu       sync.RWMutex
+	keyRepositories []string
+	discoveredKeys  map[string]discoveredKey
+
+	progress Reporter
+	metrics  *metrics
+
+	fetchTimeout   time.Duration
+	resolveTimeout time.Duration
+	retry          RetryPolicy
+
+	fileFilter          FileFilter
+	permissionsPolicy   *PermissionsPolicy
+	normalizations      NormalizationRecorder
+	baseDirectoryPolicy BaseDirectoryPolicy
 
 	// filename to owning package, last write wins
 	installedFiles map[string]*Package
@@ -93,18 +134,38 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 		}
 	}
 
+	if err := forbidUnsigned(opt.ignoreSignatures, opt.localIndexes, opt.unsignedRepositories, opt.signaturePolicies); err != nil {
+		return nil, err
+	}
+
 	if opt.fs == nil {
 		// This is expensive so we only want to do it if we aren't passed WithFS.
 		opt.fs = apkfs.DirFS(ctx, "/")
 	}
 
-	client := retryablehttp.NewClient()
+	m, err := newMetrics(opt.metricsRegistry)
+	if err != nil {
+		return nil, fmt.Errorf("registering metrics: %w", err)
+	}
 
-	client.HTTPClient = &http.Client{Transport: opt.transport}
-	client.Logger = clog.FromContext(ctx)
+	// The requests to registries, for OCI keyrings and their Sigstore
+	// bundles, are audited as those to repositories.
+	registry := AuditTransport(remote.DefaultTransport, opt.auditor, opt.arch)
+	retry := DefaultRetryPolicy()
+	remoteOptions := opt.remoteOptions
+	if opt.retryPolicy != nil {
+		retry = *opt.retryPolicy
+		remoteOptions = append(slices.Clone(remoteOptions), retry.RemoteOptionsWithTransport(registry)...)
+	} else if opt.auditor != nil {
+		remoteOptions = append(slices.Clone(remoteOptions), remote.WithTransport(registry))
+	}
+
+	transport := opt.downloads.transport(opt.transport)
+	transport = AuditTransport(transport, opt.auditor, opt.arch)
 
 	return &APK{
-		client:             client.StandardClient(),
+		client:             retry.client(ctx, &http.Client{Transport: transport}),
+		retry:              retry,
 		fs:                 opt.fs,
 		arch:               opt.arch,
 		executor:           opt.executor,
@@ -115,6 +176,26 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 		noSignatureIndexes: opt.noSignatureIndexes,
 		installedFiles:     map[string]*Package{},
 		auth:               opt.auth,
+		keyringPolicy:      opt.keyringPolicy,
+		indexVerifications: opt.indexVerifications,
+		signaturePolicies:  opt.signaturePolicies,
+
+		unsignedRepositories: opt.unsignedRepositories,
+		repositoryKeys:       opt.repositoryKeys,
+
+		verifyPackageSignatures: opt.verifyPackageSignatures,
+		localIndexes:            opt.localIndexes,
+
+		remoteOptions:        remoteOptions,
+		keyringVerifications: opt.keyringVerifications,
+		progress:             opt.progress,
+		metrics:              m,
+		fetchTimeout:         opt.fetchTimeout,
+		resolveTimeout:       opt.resolveTimeout,
+		fileFilter:           opt.fileFilter,
+		permissionsPolicy:    opt.permissionsPolicy,
+		normalizations:       opt.normalizations,
+		baseDirectoryPolicy:  opt.baseDirectoryPolicy,
 	}, nil
 }
 
@@ -254,7 +335,7 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 	*/
 	log.Debug("initializing apk database")
 
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "InitDB")
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "InitDB", trace.WithAttributes(attribute.String("arch", a.arch)))
 	defer span.End()
 
 	// additionalFiles are files we need but can only be resolved in the context of
@@ -263,21 +344,8 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 		{"/etc/apk/arch", 0o644, []byte(a.arch + "\n")},
 	}
 
-	for _, e := range baseDirectories {
-		stat, err := a.fs.Stat(e.path)
-		switch {
-		case err != nil && errors.Is(err, fs.ErrNotExist):
-			err := a.fs.Mkdir(e.path, e.perms)
-			if err != nil {
-				return fmt.Errorf("failed to create base directory %s: %w", e.path, err)
-			}
-		case err != nil:
-			return fmt.Errorf("error opening base directory %s: %w", e.path, err)
-		case !stat.IsDir():
-			return fmt.Errorf("base directory %s is not a directory", e.path)
-		case stat.Mode().Perm() != e.perms:
-			return fmt.Errorf("base directory %s has incorrect permissions: %o", e.path, stat.Mode().Perm())
-		}
+	if err := a.initBaseDirectories(ctx); err != nil {
+		return err
 	}
 	for _, e := range initDirectories {
 		err := a.fs.Mkdir(e.path, e.perms)
@@ -294,7 +362,17 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 			}
 		}
 	}
+	if err := a.adoptAlpineDatabase(ctx); err != nil {
+		return err
+	}
 	for _, e := range append(initFiles, additionalFiles...) {
+		// Keep the database of a root which already has packages installed,
+		// so that FixateWorld applies the new world to it.
+		if e.path == "/"+installedFilePath || e.path == "/"+triggersFilePath {
+			if _, err := a.fs.Stat(e.path); err == nil {
+				continue
+			}
+		}
 		if err := a.fs.WriteFile(e.path, e.contents, e.perms); err != nil {
 			return fmt.Errorf("failed to create file %s: %w", e.path, err)
 		}
@@ -302,27 +380,33 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 	for _, e := range initDeviceFiles {
 		perms := uint32(e.perms.Perm())
 		err := a.fs.Mknod(e.path, unix.S_IFCHR|perms, int(unix.Mkdev(e.major, e.minor)))
-		if !a.ignoreMknodErrors && err != nil {
+		// A root initialized before already has the devices.
+		if !a.ignoreMknodErrors && err != nil && !errors.Is(err, fs.ErrExist) {
 			return fmt.Errorf("failed to create char device %s: %w", e.path, err)
 		}
 	}
 
-	// add scripts.tar with nothing in it
-	scriptsTarPerms := 0o644
-	TarFile, err := a.fs.OpenFile(scriptsFilePath, os.O_CREATE|os.O_WRONLY, fs.FileMode(scriptsTarPerms))
-	if err != nil {
-		return fmt.Errorf("could not create tarball file '%s', got error '%w'", scriptsFilePath, err)
-	}
-	defer TarFile.Close()
-	tarWriter := tar.NewWriter(TarFile)
-	defer tarWriter.Close()
+	// add scripts.tar with nothing in it, unless the root already has one
+	if _, err := a.fs.Stat(scriptsFilePath); errors.Is(err, fs.ErrNotExist) {
+		scriptsTarPerms := 0o644
+		TarFile, err := a.fs.OpenFile(scriptsFilePath, os.O_CREATE|os.O_WRONLY, fs.FileMode(scriptsTarPerms))
+		if err != nil {
+			return fmt.Errorf("could not create tarball file '%s', got error '%w'", scriptsFilePath, err)
+		}
+		defer TarFile.Close()
+		tarWriter := tar.NewWriter(TarFile)
+		defer tarWriter.Close()
 
-	// nothing to add to it; scripts.tar should be empty
+		// nothing to add to it; scripts.tar should be empty
+	}
 
 	// Perform key discovery for the various build-time repositories.
+	a.keyringMu.Lock()
+	a.keyRepositories = append(a.keyRepositories, buildRepos...)
+	a.keyringMu.Unlock()
 	for _, repo := range buildRepos {
 		if ver, ok := parseAlpineVersion(repo); ok {
-			if err := a.fetchAlpineKeys(ctx, ver); err != nil {
+			if err := a.fetchAlpineKeys(ctx, repo, ver); err != nil {
 				var nokeysErr *NoKeysFoundError
 				if !errors.As(err, &nokeysErr) {
 					return fmt.Errorf("failed to fetch alpine-keys: %w", err)
@@ -471,9 +555,12 @@ func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string)
 	log := clog.FromContext(ctx)
 	log.Debug("initializing apk keyring")
 
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "InitKeyring")
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "InitKeyring", trace.WithAttributes(attribute.String("arch", a.arch)))
 	defer span.End()
 
+	ctx, cancel := withPhaseTimeout(ctx, "fetch", "the keyring", a.fetchTimeout)
+	defer cancel()
+
 	if err := a.fs.MkdirAll(DefaultKeyRingPath, 0o755); err != nil {
 		return fmt.Errorf("failed to make keys dir: %w", err)
 	}
@@ -490,6 +577,19 @@ func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string)
 		eg.Go(func() error {
 			log.Debugf("installing key %v", element)
 
+			if strings.HasPrefix(element, OCIKeyringScheme) {
+				keys, err := a.FetchOCIKeys(ctx, element)
+				if err != nil {
+					return err
+				}
+				for name, data := range keys {
+					if err := a.installKey(ctx, name, data); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
 			var asURL *url.URL
 			var err error
 			if strings.HasPrefix(element, "https://") || strings.HasPrefix(element, "http://") {
@@ -541,17 +641,28 @@ func (a *APK) InitKeyring(ctx context.Context, keyFiles, extraKeyFiles []string)
 				return fmt.Errorf("scheme %s not supported", asURL.Scheme)
 			}
 
-			// #nosec G306 -- apk keyring must be publicly readable
-			if err := a.fs.WriteFile(filepath.Join("etc", "apk", "keys", filepath.Base(element)), data,
-				0o644); err != nil {
-				return fmt.Errorf("failed to write apk key: %w", err)
-			}
-
-			return nil
+			return a.installKey(ctx, filepath.Base(element), data)
 		})
 	}
 
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return withCause(ctx, err)
+	}
+	return nil
+}
+
+// installKey writes a key from the keyring, once it passes the keyring policy.
+func (a *APK) installKey(ctx context.Context, name string, data []byte) error {
+	if err := a.checkKey(ctx, "", name, data); err != nil {
+		return err
+	}
+
+	// #nosec G306 -- apk keyring must be publicly readable
+	if err := a.fs.WriteFile(filepath.Join("etc", "apk", "keys", name), data,
+		0o644); err != nil {
+		return fmt.Errorf("failed to write apk key: %w", err)
+	}
+	return nil
 }
 
 // ResolveWorld determine the target state for the requested dependencies in /etc/apk/world. Does not install anything.
@@ -559,9 +670,12 @@ func (a *APK) ResolveWorld(ctx context.Context) (toInstall []*RepositoryPackage,
 	log := clog.FromContext(ctx)
 	log.Debug("determining desired apk world")
 
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "ResolveWorld")
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "ResolveWorld", trace.WithAttributes(attribute.String("arch", a.arch)))
 	defer span.End()
 
+	ctx, cancel := withPhaseTimeout(ctx, "resolve", "the world for "+a.arch, a.resolveTimeout)
+	defer cancel()
+
 	// to fix the world, we need to:
 	// 1. Get the apkIndexes for each repository for the target arch
 	indexes, err := a.GetRepositoryIndexes(ctx, a.ignoreSignatures)
@@ -590,7 +704,7 @@ func (a *APK) ResolveWorld(ctx context.Context) (toInstall []*RepositoryPackage,
 
 	toInstall, conflicts, err = resolver.GetPackagesWithDependencies(ctx, directPkgs, allArchs)
 	if err != nil {
-		return
+		return toInstall, conflicts, withCause(ctx, err)
 	}
 	log.Debugf("got %d packages to install:\n%s", len(toInstall), strings.Join(packageRefs(toInstall), "\n"))
 	return
@@ -653,6 +767,11 @@ func (a *APK) ResolveAndCalculateWorld(ctx context.Context) ([]*APKResolved, err
 }
 
 // FixateWorld force apk's resolver to re-resolve the requested dependencies in /etc/apk/world.
+//
+// The root may already have packages installed, by a previous run or by the
+// apk-tools of Alpine: those which are not in the world are removed with
+// their files, those at another version are upgraded, and the others are
+// left as they are.
 func (a *APK) FixateWorld(ctx context.Context, sourceDateEpoch *time.Time) ([]*Package, error) {
 	log := clog.FromContext(ctx)
 	/*
@@ -672,6 +791,19 @@ func (a *APK) FixateWorld(ctx context.Context, sourceDateEpoch *time.Time) ([]*P
 	if err != nil {
 		return nil, fmt.Errorf("error getting package dependencies: %w", err)
 	}
+	return a.FixateResolvedWorld(ctx, sourceDateEpoch, allpkgs, conflicts)
+}
+
+// FixateResolvedWorld installs the world as ResolveWorld resolved it to
+// allpkgs and conflicts, as FixateWorld does, so that callers can check what
+// is installed before installing it.
+func (a *APK) FixateResolvedWorld(ctx context.Context, sourceDateEpoch *time.Time, allpkgs []*RepositoryPackage, conflicts []string) ([]*Package, error) {
+	// 2. Remove the installed packages which are not in the world, or at
+	//    another version, as when applying a new world to a root installed
+	//    before
+	if err := a.removeStalePackages(ctx, allpkgs); err != nil {
+		return nil, fmt.Errorf("removing packages not in the world: %w", err)
+	}
 
 	// 3. For each name on the list:
 	//     a. Check if it is installed, if so, skip
@@ -707,9 +839,13 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 
 	expanded := make([]*expandapk.APKExpanded, len(allpkgs))
 
+	// Count the packages expanded so far, for progress reporting.
+	var numExpanded atomic.Int64
+
 	// Track what files were installed by which packages so we can deduplicate in idb.
 	allFiles := make([][]tar.Header, len(allpkgs))
 	infos := make([]*Package, len(allpkgs))
+	kept := make([]bool, len(allpkgs))
 
 	// A slice of pseudo-promises that get closed when expanded[i] is ready.
 	done := make([]chan struct{}, len(allpkgs))
@@ -735,12 +871,16 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 					return fmt.Errorf("expansion of %s failed", pkg)
 				}
 
-				isInstalled, err := a.isInstalledPackage(pkg.PackageName())
+				ip, err := a.installedPackage(pkg.PackageName())
 				if err != nil {
 					return fmt.Errorf("error checking if package %s is installed: %w", pkg, err)
 				}
 
-				if isInstalled {
+				// A package left installed, as when applying a world to a
+				// root installed before, is part of the result as it is.
+				if ip != nil {
+					infos[i] = &ip.Package
+					kept[i] = true
 					continue
 				}
 
@@ -757,6 +897,7 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 				}
 
 				allFiles[i] = installedFiles
+				a.report(ProgressEvent{Phase: PhaseInstall, Package: pkg.PackageName(), Done: i + 1, Total: len(allpkgs)})
 			}
 		}
 
@@ -770,12 +911,14 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 
 		g.Go(func() error {
 			defer func() { close(done[i]) }()
+			cached := a.progress != nil && a.IsCached(pkg)
 			exp, err := a.expandPackage(ctx, pkg)
 			if err != nil {
 				return fmt.Errorf("expanding %s: %w", pkg, err)
 			}
 
 			expanded[i] = exp
+			a.report(ProgressEvent{Phase: PhaseExpand, Package: pkg.PackageName(), Cached: cached, Done: int(numExpanded.Add(1)), Total: len(allpkgs)})
 
 			return nil
 		})
@@ -793,7 +936,7 @@ func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, a
 		// I'm ignoring this for now because that isn't really a thing that can happen,
 		// but if there are overlapping files from an already installed package, we should
 		// modify those in the idb file.
-		if pkg == nil {
+		if pkg == nil || kept[i] {
 			continue
 		}
 
@@ -829,8 +972,43 @@ func (e *NoKeysFoundError) Error() string {
 	return fmt.Sprintf("no keys found for arch %s and releases %v", e.arch, e.releases)
 }
 
-// fetchAlpineKeys fetches the public keys for the repositories in the APK database.
-func (a *APK) fetchAlpineKeys(ctx context.Context, alpineVersions ...string) error {
+// fetchAlpineKey fetches the alpine key at u.
+func fetchAlpineKey(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// NB: Not setting basic auth, since we know Alpine doesn't support it.
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch alpine key %s: %w", u, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get alpine key at %s: %v", u, res.Status)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alpine key %s: %w", u, err)
+	}
+	return data, nil
+}
+
+// fetchAlpineKeys fetches the public keys for the alpine repository in the APK database.
+func (a *APK) fetchAlpineKeys(ctx context.Context, repository string, alpineVersions ...string) error {
+	ctx, cancel := withPhaseTimeout(ctx, "fetch", "the keys of "+redact(repository), a.fetchTimeout)
+	defer cancel()
+
+	keys, err := a.alpineKeys(ctx, alpineVersions...)
+	if err != nil {
+		return withCause(ctx, err)
+	}
+	return a.writeDiscoveredKeys(ctx, repository, keys)
+}
+
+// alpineKeys fetches the public keys of the alpine releases which are not
+// deprecated, expiring on their deprecation date.
+func (a *APK) alpineKeys(ctx context.Context, alpineVersions ...string) ([]Key, error) {
 	ctx, span := otel.Tracer("go-apk").Start(ctx, "fetchAlpineKeys")
 	defer span.End()
 
@@ -838,26 +1016,27 @@ func (a *APK) fetchAlpineKeys(ctx context.Context, alpineVersions ...string) err
 	client := a.client
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// NB: Not setting basic auth, since we know Alpine doesn't support it.
 	res, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to fetch alpine releases: %w", err)
+		return nil, fmt.Errorf("failed to fetch alpine releases: %w", err)
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("unable to get alpine releases at %s: %v", u, res.Status)
+		return nil, fmt.Errorf("unable to get alpine releases at %s: %v", u, res.Status)
 	}
 	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read alpine releases: %w", err)
+		return nil, fmt.Errorf("failed to read alpine releases: %w", err)
 	}
 	var releases Releases
 	if err := json.Unmarshal(b, &releases); err != nil {
-		return fmt.Errorf("failed to unmarshal alpine releases: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal alpine releases: %w", err)
 	}
 	var urls []string
+	deprecations := map[string]time.Time{}
 	// now just need to get the keys for the desired architecture and releases
 	for _, version := range alpineVersions {
 		branch := releases.GetReleaseBranch(version)
@@ -865,43 +1044,40 @@ func (a *APK) fetchAlpineKeys(ctx context.Context, alpineVersions ...string) err
 			continue
 		}
 		urls = append(urls, branch.KeysFor(a.arch, time.Now())...)
+		maps.Copy(deprecations, branch.KeyDeprecations(a.arch))
 	}
 	if len(urls) == 0 {
-		return &NoKeysFoundError{arch: a.arch, releases: alpineVersions}
+		return nil, &NoKeysFoundError{arch: a.arch, releases: alpineVersions}
 	}
-	// get the keys for each URL and save them to a file with that name
+	// get the keys for each URL, named after the file
+	keys := make([]Key, 0, len(urls))
 	for _, u := range urls {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
-		if err != nil {
-			return err
-		}
-		// NB: Not setting basic auth, since we know Alpine doesn't support it.
-		res, err := client.Do(req)
-		if err != nil {
-			return fmt.Errorf("failed to fetch alpine key %s: %w", u, err)
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		defer res.Body.Close()
 		basefilenameEscape := filepath.Base(u)
 		basefilename, err := url.PathUnescape(basefilenameEscape)
 		if err != nil {
-			return fmt.Errorf("failed to unescape key filename %s: %w", basefilenameEscape, err)
+			return nil, fmt.Errorf("failed to unescape key filename %s: %w", basefilenameEscape, err)
 		}
-		filename := filepath.Join(keysDirPath, basefilename)
-		f, err := a.fs.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0o644)
+		data, err := fetchAlpineKey(ctx, client, u)
 		if err != nil {
-			return fmt.Errorf("failed to open key file %s: %w", filename, err)
-		}
-		defer f.Close()
-		if _, err := io.Copy(f, res.Body); err != nil {
-			return fmt.Errorf("failed to write key file %s: %w", filename, err)
+			return nil, err
 		}
+		keys = append(keys, Key{
+			ID:      basefilename,
+			Bytes:   data,
+			Expires: deprecations[u],
+		})
 	}
-	return nil
+	return keys, nil
 }
 
 type Key struct {
 	ID    string
 	Bytes []byte
+	// Expires is when the key stops being valid, or zero when unknown.
+	Expires time.Time
 }
 
 // DiscoverKeys fetches the public keys for the repositories in the APK database using chainguard-style discovery.
@@ -977,9 +1153,13 @@ func DiscoverKeys(ctx context.Context, client *http.Client, auth auth.Authentica
 		if key.KeyID == "" {
 			return nil, fmt.Errorf(`key missing "kid"`)
 		}
-		keyName := key.KeyID + ".rsa.pub"
+		suffix, err := keyFileSuffix(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.KeyID, err)
+		}
+		keyName := key.KeyID + suffix
 
-		b, err := x509.MarshalPKIXPublicKey(key.Key.(*rsa.PublicKey))
+		b, err := x509.MarshalPKIXPublicKey(key.Key)
 		if err != nil {
 			return nil, err
 		} else if len(b) == 0 {
@@ -993,25 +1173,42 @@ func DiscoverKeys(ctx context.Context, client *http.Client, auth auth.Authentica
 			return nil, fmt.Errorf("failed to pem encode key %s: %w", keyName, err)
 		}
 
-		keys = append(keys, Key{
+		k := Key{
 			ID:    keyName,
 			Bytes: buf.Bytes(),
-		})
+		}
+		if len(key.Certificates) > 0 {
+			// Keys published with a certificate expire with it.
+			k.Expires = key.Certificates[0].NotAfter
+		}
+		keys = append(keys, k)
 	}
 
 	return keys, nil
 }
 
+// keyFileSuffix returns the suffix of the keyring file name for a public key,
+// following the "<name>.rsa.pub" convention for RSA keys.
+func keyFileSuffix(pub any) (string, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return ".rsa.pub", nil
+	case *ecdsa.PublicKey:
+		return ".ecdsa.pub", nil
+	case ed25519.PublicKey:
+		return ".ed25519.pub", nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
 func (a *APK) DiscoverKeys(ctx context.Context, repository string) ([]Key, error) {
 	client := a.client
 	if a.cache != nil {
 		client = a.cache.client(client, false)
 
 		if !a.cache.offline {
-			rc := retryablehttp.NewClient()
-			rc.HTTPClient = client
-			rc.Logger = clog.FromContext(ctx)
-			client = rc.StandardClient()
+			client = a.retry.client(ctx, client)
 		}
 
 		return a.cache.shared.discoverKeys.Do(repository, func() ([]Key, error) {
@@ -1034,24 +1231,26 @@ func (a *APK) fetchChainguardKeys(ctx context.Context, repository string) error
 		return nil
 	}
 
-	keys, err := a.DiscoverKeys(ctx, repository)
+	fetchCtx, cancel := withPhaseTimeout(ctx, "fetch", "the keys of "+redact(repository), a.fetchTimeout)
+	defer cancel()
+	keys, err := a.DiscoverKeys(fetchCtx, repository)
 	if err != nil {
-		log.Warnf("ignoring missing keys for %s: %v", repository, err)
+		log.Warnf("ignoring missing keys for %s: %v", repository, withCause(fetchCtx, err))
 	}
 
-	for _, key := range keys {
-		filename := filepath.Join(keysDirPath, key.ID)
-		if err := a.fs.WriteFile(filename, key.Bytes, 0o644); err != nil {
-			return fmt.Errorf("failed to write key file %s: %w", filename, err)
-		}
-	}
-	return nil
+	return a.writeDiscoveredKeys(ctx, repository, keys)
 }
 
 func (a *APK) cachePackage(ctx context.Context, pkg InstallablePackage, exp *expandapk.APKExpanded, cacheDir string) (*expandapk.APKExpanded, error) {
 	_, span := otel.Tracer("go-apk").Start(ctx, "cachePackage", trace.WithAttributes(attribute.String("package", pkg.PackageName())))
 	defer span.End()
 
+	// Don't advertise the files of a package whose fetch was cancelled.
+	if err := ctx.Err(); err != nil {
+		exp.Close()
+		return nil, withCause(ctx, err)
+	}
+
 	// Rename exp's temp files to content-addressable identifiers in the cache.
 
 	ctlHex := hex.EncodeToString(exp.ControlHash)
@@ -1113,6 +1312,56 @@ func (a *APK) cachePackage(ctx context.Context, pkg InstallablePackage, exp *exp
 	return exp, nil
 }
 
+// IsCached returns whether pkg can be installed without the network: it is a
+// local file, or it is in the cache.
+func (a *APK) IsCached(pkg InstallablePackage) bool {
+	asURL, err := packageAsURL(pkg)
+	if err != nil {
+		return false
+	}
+	if asURL.Scheme == "file" {
+		_, err := os.Stat(pkg.URL())
+		return err == nil
+	}
+	if a.cache == nil {
+		return false
+	}
+	cacheDir, err := cacheDirForPackage(a.cache.dir, pkg)
+	if err != nil {
+		return false
+	}
+	// The package is either cached expanded, by its control checksum, or as
+	// it was downloaded.
+	if chk := pkg.ChecksumString(); strings.HasPrefix(chk, "Q1") {
+		if checksum, err := base64.StdEncoding.DecodeString(chk[2:]); err == nil {
+			if _, err := os.Stat(filepath.Join(cacheDir, hex.EncodeToString(checksum)+".ctl.tar.gz")); err == nil {
+				return true
+			}
+		}
+	}
+	_, err = os.Stat(cacheDir + ".apk")
+	return err == nil
+}
+
+// CachePackage downloads pkg into the cache, unless it is already there, so
+// that an offline build can install it.
+func (a *APK) CachePackage(ctx context.Context, pkg InstallablePackage) error {
+	if a.cache == nil {
+		return errors.New("no cache to download packages into")
+	}
+	if a.IsCached(pkg) {
+		return nil
+	}
+	// Bypass the global cache, which may hold the package expanded into
+	// another cache directory.
+	exp, err := expandPackage(ctx, a, pkg)
+	if err != nil {
+		return err
+	}
+	defer exp.Close()
+	return a.verifyPackage(ctx, pkg, exp)
+}
+
 func (a *APK) cachedPackage(ctx context.Context, pkg InstallablePackage, cacheDir string) (*expandapk.APKExpanded, error) {
 	_, span := otel.Tracer("go-apk").Start(ctx, "cachedPackage", trace.WithAttributes(attribute.String("package", pkg.PackageName())))
 	defer span.End()
@@ -1163,8 +1412,13 @@ func (a *APK) cachedPackage(ctx context.Context, pkg InstallablePackage, cacheDi
 		if err != nil {
 			return nil, err
 		}
-		signatureHash := sha1.Sum(signatureData) //nolint:gosec // this is what apk tools is using
-		exp.SignatureHash = signatureHash[:]
+		// The apk format mandates SHA-1 for the checksum of the signature section.
+		h, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(signatureData)
+		exp.SignatureHash = h.Sum(nil)
 	}
 
 	f, err := os.Open(ctl)
@@ -1223,7 +1477,9 @@ type apkCache struct {
 }
 
 func (c *apkCache) get(ctx context.Context, a *APK, pkg InstallablePackage) (*expandapk.APKExpanded, error) {
-	u := pkg.URL()
+	// The expanded package lives in the cache directory of a, so the same
+	// package cached in another directory is another entry.
+	u := a.cache.dir + "\x00" + pkg.URL()
 	// Do all the expensive things inside the once.
 	once, _ := c.onces.LoadOrStore(u, &sync.Once{})
 	once.(*sync.Once).Do(func() {
@@ -1236,7 +1492,7 @@ func (c *apkCache) get(ctx context.Context, a *APK, pkg InstallablePackage) (*ex
 
 	v, ok := c.resps.Load(u)
 	if !ok {
-		panic(fmt.Errorf("did not see apk %q after writing it", u))
+		panic(fmt.Errorf("did not see apk %q after writing it", pkg.URL()))
 	}
 
 	result := v.(apkResult)
@@ -1244,20 +1500,40 @@ func (c *apkCache) get(ctx context.Context, a *APK, pkg InstallablePackage) (*ex
 }
 
 func (a *APK) expandPackage(ctx context.Context, pkg InstallablePackage) (*expandapk.APKExpanded, error) {
+	ctx, cancel := withPhaseTimeout(ctx, "fetch", pkg.PackageName(), a.fetchTimeout)
+	defer cancel()
+
 	if a.cache == nil {
 		// If we don't have a cache configured, don't use the global cache.
 		// Calling APKExpanded.Close() will clean up a tempdir.
 		// This is fine when we have a cache because we move all the backing files into the cache.
 		// This is not fine when we don't have a cache because the tempdir contains all our state.
-		return expandPackage(ctx, a, pkg)
+		exp, err := expandPackage(ctx, a, pkg)
+		if err != nil {
+			return nil, withCause(ctx, err)
+		}
+		if err := a.verifyPackage(ctx, pkg, exp); err != nil {
+			a.metrics.verificationFailed(a.arch, err)
+			exp.Close()
+			return nil, err
+		}
+		return exp, nil
 	}
 
-	return globalApkCache.get(ctx, a, pkg)
+	exp, err := globalApkCache.get(ctx, a, pkg)
+	if err != nil {
+		return nil, withCause(ctx, err)
+	}
+	if err := a.verifyPackage(ctx, pkg, exp); err != nil {
+		a.metrics.verificationFailed(a.arch, err)
+		return nil, err
+	}
+	return exp, nil
 }
 
 func expandPackage(ctx context.Context, a *APK, pkg InstallablePackage) (*expandapk.APKExpanded, error) {
 	log := clog.FromContext(ctx)
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "expandPackage", trace.WithAttributes(attribute.String("package", pkg.PackageName())))
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "expandPackage", trace.WithAttributes(attribute.String("package", pkg.PackageName()), attribute.String("arch", a.arch)))
 	defer span.End()
 
 	cacheDir := ""
@@ -1271,10 +1547,12 @@ func expandPackage(ctx context.Context, a *APK, pkg InstallablePackage) (*expand
 		exp, err := a.cachedPackage(ctx, pkg, cacheDir)
 		if err == nil {
 			log.Debugf("cache hit (%s)", pkg.PackageName())
+			a.metrics.cacheHit(a.arch)
 			return exp, nil
 		}
 
 		log.Debugf("cache miss (%s): %v", pkg.PackageName(), err)
+		a.metrics.cacheMiss(a.arch)
 
 		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
 			return nil, fmt.Errorf("unable to create cache directory %q: %w", cacheDir, err)
@@ -1287,10 +1565,12 @@ func expandPackage(ctx context.Context, a *APK, pkg InstallablePackage) (*expand
 	}
 	defer rc.Close()
 
-	exp, err := expandapk.ExpandApk(ctx, rc, cacheDir)
+	exp, err := expandapk.ExpandApk(ctx, a.reportDownload(pkg, rc), cacheDir)
 	if err != nil {
+		a.metrics.verificationFailed(a.arch, err)
 		return nil, fmt.Errorf("expanding %s: %w", pkg.PackageName(), err)
 	}
+	a.metrics.fetched(a.arch, exp.Size)
 
 	// If we don't have a cache, we're done.
 	if a.cache == nil {
@@ -1360,11 +1640,11 @@ func (a *APK) FetchPackage(ctx context.Context, pkg FetchablePackage) (io.ReadCl
 		rrt := newRangeRetryTransport(ctx, client)
 		res, err := rrt.RoundTrip(req)
 		if err != nil {
-			return nil, fmt.Errorf("unable to get package apk at %s: %w", u, err)
+			return nil, fmt.Errorf("unable to get package apk at %s: %w", u, repoUnavailable(u, res, err))
 		}
 		if res.StatusCode != http.StatusOK {
 			res.Body.Close()
-			return nil, fmt.Errorf("unable to get package apk at %s: %v", u, res.Status)
+			return nil, fmt.Errorf("unable to get package apk at %s: %w", u, &ErrRepoUnavailable{URL: redact(u), Status: res.StatusCode})
 		}
 		return res.Body, nil
 	default:
@@ -1411,16 +1691,24 @@ func (a *APK) installPackage(ctx context.Context, pkg *Package, expanded *expand
 	// This is not a big deal because the temp files if not referred by
 	// a symlink will be cleaned up anyway.
 
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "installPackage", trace.WithAttributes(attribute.String("package", pkg.Name)))
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "installPackage", trace.WithAttributes(attribute.String("package", pkg.Name), attribute.String("arch", a.arch)))
 	defer span.End()
 
 	var (
 		err            error
 		installedFiles []tar.Header
+		keep           func(string) bool
 	)
 
+	if a.fileFilter != nil {
+		keep, err = a.fileFilter(pkg, expanded.TarFS)
+		if err != nil {
+			return nil, fmt.Errorf("filtering files of pkg %s: %w", pkg.Name, err)
+		}
+	}
+
 	if wh, ok := a.fs.(WriteHeaderer); ok {
-		installedFiles, err = a.lazilyInstallAPKFiles(ctx, wh, expanded.TarFS, pkg)
+		installedFiles, err = a.lazilyInstallAPKFiles(ctx, wh, expanded.TarFS, pkg, keep)
 		if err != nil {
 			return nil, fmt.Errorf("unable to install files for pkg %s: %w", pkg.Name, err)
 		}
@@ -1431,7 +1719,7 @@ func (a *APK) installPackage(ctx context.Context, pkg *Package, expanded *expand
 		}
 		defer packageData.Close()
 
-		installedFiles, err = a.installAPKFiles(ctx, packageData, pkg)
+		installedFiles, err = a.installAPKFiles(ctx, packageData, pkg, keep)
 		if err != nil {
 			return nil, fmt.Errorf("unable to install files for pkg %s: %w", pkg.Name, err)
 		}
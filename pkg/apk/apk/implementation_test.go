@@ -16,6 +16,14 @@ package apk
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"io/fs"
@@ -30,6 +38,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
 
 	"chainguard.dev/apko/pkg/apk/auth"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
@@ -812,3 +821,47 @@ func TestAuth_bad(t *testing.T) {
 	require.Error(t, err, "should fail with bad auth")
 	require.True(t, called, "did not make request")
 }
+
+func TestDiscoverKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{KeyID: "rsa", Key: rsaKey.Public()},
+		{KeyID: "ecdsa", Key: ecKey.Public()},
+		{KeyID: "ed25519", Key: edPub},
+	}}
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/os/apk-configuration":
+			fmt.Fprintf(w, `{"jwks_uri": %q}`, s.URL+"/jwks")
+		case "/jwks":
+			require.NoError(t, json.NewEncoder(w).Encode(jwks))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	keys, err := DiscoverKeys(t.Context(), s.Client(), auth.MultiAuthenticator(), s.URL+"/os")
+	require.NoError(t, err)
+
+	want := map[string]any{
+		"rsa.rsa.pub":         rsaKey.Public(),
+		"ecdsa.ecdsa.pub":     ecKey.Public(),
+		"ed25519.ed25519.pub": edPub,
+	}
+	require.Len(t, keys, len(want))
+	for _, key := range keys {
+		block, _ := pem.Decode(key.Bytes)
+		require.NotNil(t, block, key.ID)
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		require.NoError(t, err)
+		require.Equal(t, want[key.ID], pub, key.ID)
+	}
+}
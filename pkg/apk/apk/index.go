@@ -18,16 +18,15 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
-	"crypto"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
-	"maps"
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
@@ -40,15 +39,23 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"chainguard.dev/apko/pkg/apk/auth"
-	sign "chainguard.dev/apko/pkg/apk/signature"
+	"chainguard.dev/apko/pkg/apk/digest"
 )
 
-var signatureFileRegex = regexp.MustCompile(`^\.SIGN\.(DSA|RSA|RSA256|RSA512)\.(.*\.rsa\.pub)$`)
+// IndexVerifier verifies a repository index with a signature published next
+// to it, in addition to or instead of the key signatures inside the index.
+type IndexVerifier interface {
+	// SignatureSuffix is appended to the index URL to locate the signature.
+	SignatureSuffix() string
+	// VerifyIndex verifies the contents of the index with its signature.
+	VerifyIndex(ctx context.Context, index, signature []byte) error
+}
 
-type Signature struct {
-	KeyID           string
-	Signature       []byte
-	DigestAlgorithm crypto.Hash
+// IndexVerification verifies the indexes of a repository with a verifier.
+type IndexVerification struct {
+	Verifier IndexVerifier
+	// SkipKeys trusts the verifier alone, skipping the key signatures.
+	SkipKeys bool
 }
 
 // This is terrible but simpler than plumbing around a cache for now.
@@ -133,11 +140,11 @@ func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map
 
 		resp, err := client.Do(head)
 		if err != nil {
-			return nil, err
+			return nil, &ErrRepoUnavailable{URL: asURL.Redacted(), Err: err}
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+			return nil, &ErrRepoUnavailable{URL: asURL.Redacted(), Status: resp.StatusCode}
 		}
 
 		fetchAndParse := func(etag string) (NamedIndex, error) {
@@ -145,10 +152,15 @@ func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map
 			if err != nil {
 				return nil, fmt.Errorf("fetching %s: %w", asURL.Redacted(), err)
 			}
+			opts, verified, err := verifyIndex(ctx, repoURL, u, arch, b, opts)
+			if err != nil {
+				return nil, err
+			}
 			idx, err := parseRepositoryIndex(ctx, u, keys, arch, b, opts)
 			if err != nil {
 				return nil, fmt.Errorf("parsing %s: %w", asURL.Redacted(), err)
 			}
+			idx.verifiedBy(verified)
 			return NewNamedRepositoryWithIndex(repoName, repoRef.WithIndex(idx)), nil
 		}
 
@@ -187,12 +199,31 @@ func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map
 		defer i.Unlock()
 
 		// We do expect local indexes to change, so we check modtimes.
+		newest, synthesize := newerLocalPackages(u, opts)
 		stat, err := os.Stat(u)
-		if err != nil {
+		if err != nil && !synthesize {
 			return nil, fmt.Errorf("stat: %w", err)
 		}
 
-		mod := stat.ModTime()
+		mod := newest
+		if err == nil && stat.ModTime().After(mod) {
+			mod = stat.ModTime()
+		}
+		if synthesize {
+			// cached apart from the index, which other clients read
+			key := u + "#synthesized"
+			if before, ok := i.modtimes[key]; !ok || mod.After(before) {
+				idx, err := synthesizeIndex(ctx, filepath.Dir(u), arch)
+				if err != nil {
+					i.store(key, nil, err)
+				} else {
+					i.store(key, NewNamedRepositoryWithIndex(repoName, repoRef.WithIndex(idx)), nil)
+				}
+				i.modtimes[key] = mod
+			}
+			return i.load(key)
+		}
+
 		before, ok := i.modtimes[u]
 		if !ok || mod.After(before) {
 			b, err := os.ReadFile(u)
@@ -200,10 +231,15 @@ func (i *indexCache) get(ctx context.Context, repoName, repoURL string, keys map
 				return nil, fmt.Errorf("reading file: %w", err)
 			}
 			// If this is the first time or it has changed since the last time...
-			idx, err := parseRepositoryIndex(ctx, u, keys, arch, b, opts)
+			popts, verified, err := verifyIndex(ctx, repoURL, u, arch, b, opts)
+			var idx *APKIndex
+			if err == nil {
+				idx, err = parseRepositoryIndex(ctx, u, keys, arch, b, popts)
+			}
 			if err != nil {
 				i.store(u, nil, err)
 			} else {
+				idx.verifiedBy(verified)
 				i.store(u, NewNamedRepositoryWithIndex(repoName, repoRef.WithIndex(idx)), nil)
 			}
 			i.modtimes[u] = mod
@@ -235,6 +271,9 @@ func GetRepositoryIndexes(ctx context.Context, repos []string, keys map[string][
 	for _, opt := range options {
 		opt(opts)
 	}
+	if err := forbidUnsigned(opts.ignoreSignatures, opts.localIndexes, opts.unsignedRepositories, opts.signaturePolicies); err != nil {
+		return nil, err
+	}
 
 	indexes := make([]NamedIndex, len(repos))
 
@@ -287,15 +326,71 @@ func GetRepositoryIndexes(ctx context.Context, repos []string, keys map[string][
 }
 
 func shouldCheckSignatureForIndex(index string, arch string, opts *indexOpts) bool {
+	return indexSignatureSkipped(index, arch, opts) == ""
+}
+
+// indexSignatureSkipped returns why the signature of index is not checked,
+// or an empty string if it is.
+func indexSignatureSkipped(index string, arch string, opts *indexOpts) string {
 	if opts.ignoreSignatures {
-		return false
+		return ReasonSignaturesIgnored
+	}
+	if p, ok := signaturePolicyFor(opts.signaturePolicies, index); ok && p.IgnoreIndexSignature {
+		return ReasonIndexIgnored
+	}
+	if reason, ok := UnsignedReasonFor(opts.unsignedRepositories, index); ok {
+		return reasonRepositoryUnsigned(reason)
 	}
 	for _, ignoredIndex := range opts.noSignatureIndexes {
 		if IndexURL(ignoredIndex, arch) == index {
-			return false
+			return ReasonNoSignatureIndex
 		}
 	}
-	return true
+	return ""
+}
+
+// verifyIndex verifies the index b read from u with the verification
+// configured for repoURL, returning the options to parse it with and how it
+// was verified, if it was.
+func verifyIndex(ctx context.Context, repoURL, u, arch string, b []byte, opts *indexOpts) (*indexOpts, Verification, error) {
+	v, ok := opts.verifications[strings.TrimRight(repoURL, "/")]
+	if !ok || !shouldCheckSignatureForIndex(u, arch, opts) {
+		return opts, Verification{}, nil
+	}
+
+	sigURL := u + v.Verifier.SignatureSuffix()
+	var (
+		sig []byte
+		err error
+	)
+	if strings.HasPrefix(sigURL, "https://") || strings.HasPrefix(sigURL, "http://") {
+		sig, err = fetchRepositoryIndex(ctx, sigURL, "", opts)
+	} else {
+		sig, err = os.ReadFile(sigURL)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		// Local repositories without an index are skipped, but an index
+		// missing its signature must fail.
+		return nil, Verification{}, fmt.Errorf("index signature %s not found", redact(sigURL))
+	} else if err != nil {
+		return nil, Verification{}, fmt.Errorf("fetching index signature %s: %w", redact(sigURL), err)
+	}
+	if err := v.Verifier.VerifyIndex(ctx, b, sig); err != nil {
+		return nil, Verification{}, fmt.Errorf("verifying %s: %w", redact(u), err)
+	}
+	// The signature is named by the format of the verifier, such as
+	// .sigstore.json.
+	verified := Verification{
+		Verified:  true,
+		Algorithm: strings.TrimSuffix(strings.TrimPrefix(v.Verifier.SignatureSuffix(), "."), ".json"),
+	}
+
+	if !v.SkipKeys {
+		return opts, verified, nil
+	}
+	skip := *opts
+	skip.noSignatureIndexes = append(slices.Clone(opts.noSignatureIndexes), repoURL)
+	return &skip, verified, nil
 }
 
 func fetchRepositoryIndex(ctx context.Context, u string, etag string, opts *indexOpts) ([]byte, error) { //nolint:gocyclo
@@ -325,10 +420,10 @@ func fetchRepositoryIndex(ctx context.Context, u string, etag string, opts *inde
 	rrt := newRangeRetryTransport(ctx, client)
 	res, err := rrt.RoundTrip(req)
 	if err != nil {
-		return nil, err
+		return nil, repoUnavailable(u, res, err)
 	}
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code %d", res.StatusCode)
+		return nil, &ErrRepoUnavailable{URL: redact(u), Status: res.StatusCode}
 	}
 	defer res.Body.Close()
 
@@ -340,12 +435,19 @@ func fetchRepositoryIndex(ctx context.Context, u string, etag string, opts *inde
 	return b, nil
 }
 
-func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte, arch string, b []byte, opts *indexOpts) (*APKIndex, error) { //nolint:gocyclo
+func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte, arch string, b []byte, opts *indexOpts) (*APKIndex, error) {
 	_, span := otel.Tracer("go-apk").Start(ctx, "parseRepositoryIndex")
 	defer span.End()
 	// validate the signature
-	if shouldCheckSignatureForIndex(u, arch, opts) {
-		if len(keys) == 0 {
+	skipped := indexSignatureSkipped(u, arch, opts)
+	verification := unverified(skipped)
+	if skipped == "" {
+		policy, _ := signaturePolicyFor(opts.signaturePolicies, u)
+		keys = policy.acceptedKeys(withRepositoryKeys(keys, opts.repositoryKeys, u))
+		if len(keys) == 0 && !policy.AllowUnsigned {
+			if len(policy.KeyIDs) > 0 {
+				return nil, fmt.Errorf("none of the required keys %v are in the keyring", policy.KeyIDs)
+			}
 			return nil, fmt.Errorf("no keys provided to verify signature")
 		}
 		// check that they key name aren't paths or URLs
@@ -365,96 +467,23 @@ func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte,
 		gzipReader.Multistream(false)
 		defer gzipReader.Close()
 
-		tarReader := tar.NewReader(gzipReader)
-
-		sigs := make([]Signature, 0, len(keys))
-
-		for {
-			// read the signature(s)
-			signatureFile, err := tarReader.Next()
-			// found everything, end of stream
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			// oops something went wrong
-			if err != nil {
-				return nil, fmt.Errorf("unexpected error reading from tgz: %w", err)
-			}
-			matches := signatureFileRegex.FindStringSubmatch(signatureFile.Name)
-			if len(matches) != 3 {
-				return nil, fmt.Errorf("failed to find key name in signature file name: %s", signatureFile.Name)
-			}
-			keyfile := matches[2]
-
-			trimmedKeyFile := strings.TrimSuffix(keyfile, ".rsa.pub")
-			if _, ok := keys[keyfile]; ok {
-				// We found a matching key
-			} else if _, ok := keys[trimmedKeyFile]; ok {
-				// When we download keys from proxy servers - like artifactory, we ignore the 'content-disposition' header
-				// (that would be difficult to cache as well), and the header is responsible for providing key name with
-				// proper extension. Here we accept matching keys without proper extension.
-				keyfile = trimmedKeyFile
-			} else {
-				clog.FromContext(ctx).Warnf("skipping signature %s due to missing keyfile: %s", signatureFile.Name, keyfile)
-				// Ignore this signature if we don't have the key
-				continue
-			}
-			var digestAlgorithm crypto.Hash
-			switch signatureType := matches[1]; signatureType {
-			case "DSA":
-				// Obsolete
-				continue
-			case "RSA":
-				// Current legacy compat
-				digestAlgorithm = crypto.SHA1
-			case "RSA256":
-				// Current best practice
-				digestAlgorithm = crypto.SHA256
-			case "RSA512":
-				// Too big, too slow, not compiled in
-				continue
-			default:
-				return nil, fmt.Errorf("unknown signature format: %s", signatureType)
-			}
-			signature, err := io.ReadAll(tarReader)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read signature from repository index: %w", err)
-			}
-			sigs = append(sigs, Signature{
-				KeyID:           keyfile,
-				Signature:       signature,
-				DigestAlgorithm: digestAlgorithm,
-			})
-		}
-		if len(sigs) == 0 {
-			return nil, fmt.Errorf("no signature with known key (one of: %v) found in repository index", slices.Collect(maps.Keys(keys)))
+		sigs, signed, err := readSignatures(ctx, tar.NewReader(gzipReader), keys, "repository index")
+		if err != nil {
+			return nil, err
 		}
-		// we now have the signature bytes and name, get the contents of the rest;
-		// this should be everything else in the raw gzip file as is.
-		allBytes := len(b)
-		unreadBytes := buf.Len()
-		readBytes := allBytes - unreadBytes
-		indexData := b[readBytes:]
-		indexDigest := make(map[crypto.Hash][]byte, len(keys))
-		verified := false
-		for _, sig := range sigs {
-			// compute the digest if not already done
-			if _, hasDigest := indexDigest[sig.DigestAlgorithm]; !hasDigest {
-				h := sig.DigestAlgorithm.New()
-				if n, err := h.Write(indexData); err != nil || n != len(indexData) {
-					return nil, fmt.Errorf("unable to hash data: %w", err)
-				}
-				indexDigest[sig.DigestAlgorithm] = h.Sum(nil)
-			}
-			if err := sign.RSAVerifyDigest(indexDigest[sig.DigestAlgorithm], sig.DigestAlgorithm, sig.Signature, keys[sig.KeyID]); err == nil {
-				verified = true
-				break
-			} else {
-				clog.FromContext(ctx).Warnf("failed to verify signature for keyfile %s: %v", sig.KeyID, err)
+		if signed {
+			// we now have the signature bytes and name, get the contents of the rest;
+			// this should be everything else in the raw gzip file as is.
+			indexData := b[len(b)-buf.Len():]
+			verification, err = verifySignatures(ctx, digest.Default(), indexData, sigs, keys, opts.keyExpiries, "repository index")
+			if err != nil {
+				return nil, err
 			}
-		}
-		if !verified {
-			return nil, errors.New("signature verification failed for repository index, for all provided keys")
+		} else if policy.AllowUnsigned {
+			clog.FromContext(ctx).Warnf("repository index %s is not signed", redact(u))
+			verification = unverified(ReasonUnsignedAllowed)
+		} else {
+			return nil, classify(ErrSignatureInvalid, errors.New("repository index is not signed"))
 		}
 	}
 	// with a valid signature, convert it to an ApkIndex
@@ -462,15 +491,24 @@ func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte,
 	if err != nil {
 		return nil, fmt.Errorf("unable to read convert repository index bytes to index struct: %w", err)
 	}
+	sum := sha256.Sum256(b)
+	index.Checksum = sum[:]
+	index.Verification = verification
 
 	return index, err
 }
 
 type indexOpts struct {
-	ignoreSignatures   bool
-	noSignatureIndexes []string
-	httpClient         *http.Client
-	auth               auth.Authenticator
+	ignoreSignatures     bool
+	noSignatureIndexes   []string
+	httpClient           *http.Client
+	auth                 auth.Authenticator
+	verifications        map[string]IndexVerification
+	signaturePolicies    map[string]SignaturePolicy
+	unsignedRepositories map[string]string
+	repositoryKeys       map[string]map[string][]byte
+	keyExpiries          map[string]time.Time
+	localIndexes         bool
 }
 type IndexOption func(*indexOpts)
 
@@ -492,6 +530,54 @@ func WithHTTPClient(c *http.Client) IndexOption {
 	}
 }
 
+// WithIndexVerifications sets the verification of the indexes of each
+// repository, in addition to or instead of their key signatures.
+func WithIndexVerifications(verifications map[string]IndexVerification) IndexOption {
+	return func(o *indexOpts) {
+		o.verifications = verifications
+	}
+}
+
+// WithSignaturePolicies sets how the signatures of the indexes of each
+// repository are verified.
+func WithSignaturePolicies(policies map[string]SignaturePolicy) IndexOption {
+	return func(o *indexOpts) {
+		o.signaturePolicies = policies
+	}
+}
+
+// WithUnsignedRepositories skips verifying the indexes of each repository,
+// for the reason given, as WithUnsignedRepository.
+func WithUnsignedRepositories(unsigned map[string]string) IndexOption {
+	return func(o *indexOpts) {
+		o.unsignedRepositories = unsigned
+	}
+}
+
+// WithRepositoryKeyrings sets the keys accepted for the indexes of each
+// repository only, as WithRepositoryKeys.
+func WithRepositoryKeyrings(keys map[string]map[string][]byte) IndexOption {
+	return func(o *indexOpts) {
+		o.repositoryKeys = keys
+	}
+}
+
+// WithKeyExpiries sets when the keys expire, by their name, to report
+// signatures made with expired keys.
+func WithKeyExpiries(expiries map[string]time.Time) IndexOption {
+	return func(o *indexOpts) {
+		o.keyExpiries = expiries
+	}
+}
+
+// WithLocalIndexes synthesizes the indexes of local repositories from their
+// packages, as WithLocalIndexSynthesis.
+func WithLocalIndexes(synthesize bool) IndexOption {
+	return func(o *indexOpts) {
+		o.localIndexes = synthesize
+	}
+}
+
 func WithIndexAuthenticator(a auth.Authenticator) IndexOption {
 	return func(o *indexOpts) {
 		o.auth = a
@@ -0,0 +1,187 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	sign "chainguard.dev/apko/pkg/apk/signature"
+)
+
+// noarch is the architecture of packages which install on any architecture.
+const noarch = "noarch"
+
+// IndexBuilder builds a repository index from packages and the packages of
+// other indexes. A package replaces one of the same name and version added
+// before it.
+type IndexBuilder struct {
+	// Description is the DESCRIPTION of the index.
+	Description string
+	// Arch, when set, is the only architecture whose packages are added,
+	// besides noarch packages.
+	Arch string
+
+	pkgs map[string]*Package
+}
+
+// NewIndexBuilder returns an IndexBuilder without packages.
+func NewIndexBuilder() *IndexBuilder {
+	return &IndexBuilder{pkgs: map[string]*Package{}}
+}
+
+// Add adds pkg, and reports whether it is of the architecture of the
+// builder.
+func (b *IndexBuilder) Add(pkg *Package) bool {
+	if b.Arch != "" && pkg.Arch != b.Arch && pkg.Arch != noarch && pkg.Arch != "" {
+		return false
+	}
+	b.pkgs[pkg.Name+"="+pkg.Version] = pkg
+	return true
+}
+
+// AddPackage reads an apk from r and adds its package, from the .PKGINFO of
+// the control section and the checksum and size of the apk. The data section
+// is streamed through, so the apk is never held in memory. It reports
+// whether the package is of the architecture of the builder.
+func (b *IndexBuilder) AddPackage(r io.Reader) (*Package, bool, error) {
+	cr := &countingReader{r: r}
+	info, h, err := ParsePackageInfo(cr)
+	if err != nil {
+		return nil, false, err
+	}
+	// drain the data section for the size of the apk
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return nil, false, fmt.Errorf("reading data section: %w", err)
+	}
+	pkg := packageFromInfo(info, h.Sum(nil), uint64(cr.n)) //nolint:gosec
+	return pkg, b.Add(pkg), nil
+}
+
+// AddIndex adds the packages of idx of the architecture of the builder.
+func (b *IndexBuilder) AddIndex(idx *APKIndex) {
+	for _, pkg := range idx.Packages {
+		b.Add(pkg)
+	}
+}
+
+// Index returns the index of the packages, sorted by name and version.
+func (b *IndexBuilder) Index() *APKIndex {
+	pkgs := slices.SortedFunc(maps.Values(b.pkgs), func(x, y *Package) int {
+		return cmp.Or(cmp.Compare(x.Name, y.Name), CompareVersionStrings(x.Version, y.Version))
+	})
+	return &APKIndex{Description: b.Description, Packages: pkgs}
+}
+
+// Write writes the APKINDEX.tar.gz of the index to w, signed with the
+// private key in keyFile unless it is empty.
+func (b *IndexBuilder) Write(w io.Writer, keyFile, passphrase string) error {
+	archive, err := ArchiveFromIndex(b.Index())
+	if err != nil {
+		return err
+	}
+	index, err := io.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	if keyFile != "" {
+		return SignIndex(w, index, keyFile, passphrase)
+	}
+	_, err = w.Write(index)
+	return err
+}
+
+// SignIndex writes the APKINDEX.tar.gz index to w, signed with the RSA
+// private key in keyFile. The signature is named after the public key,
+// keyFile with the .pub extension, as the keyring names it. Other keys are
+// refused, as the .SIGN.RSA256 signatures of apk-tools are RSA signatures.
+func SignIndex(w io.Writer, index []byte, keyFile, passphrase string) error {
+	digest := sha256.Sum256(index)
+	sig, err := sign.RSASignDigest(digest[:], crypto.SHA256, keyFile, passphrase)
+	if err != nil {
+		return fmt.Errorf("signing index with %s: %w", keyFile, err)
+	}
+
+	// The signature section is a tar stream without its end, so that the
+	// index follows it as one archive.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     ".SIGN.RSA256." + filepath.Base(keyFile) + ".pub",
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     int64(len(sig)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(sig); err != nil {
+		return err
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	buf.Write(index)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// StripIndexSignatures returns the index of the APKINDEX.tar.gz b without
+// its signatures, as it was signed.
+func StripIndexSignatures(b []byte) ([]byte, error) {
+	r := bytes.NewReader(b)
+	for {
+		rest := b[len(b)-r.Len():]
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		zr.Multistream(false)
+		hdr, err := tar.NewReader(zr).Next()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(hdr.Name, ".SIGN.") {
+			return rest, nil
+		}
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,127 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile, pub := writeIndexKey(t, "test.pem", key)
+	keys := map[string][]byte{"test.pem.pub": pub}
+
+	apk := signedTestPackage(t, "", "")
+	want, err := ParsePackage(ctx, bytes.NewReader(apk), uint64(len(apk)))
+	require.NoError(t, err)
+
+	b := NewIndexBuilder()
+	b.Description = "test"
+	b.Arch = "x86_64"
+	pkg, ok, err := b.AddPackage(bytes.NewReader(apk))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, want, pkg)
+	require.Equal(t, uint64(len(apk)), pkg.Size)
+
+	// Packages of other architectures are left out, and later packages
+	// replace earlier ones of the same name and version.
+	b.AddIndex(&APKIndex{Packages: []*Package{
+		{Name: "zlib", Version: "1.3-r0", Arch: "aarch64"},
+		{Name: "abc", Version: "2.0-r0", Arch: "x86_64"},
+		{Name: "abc", Version: "10.0-r0", Arch: "x86_64"},
+		{Name: "hello", Version: "1.0-r0", Arch: "noarch", Description: "replaced"},
+	}})
+	idx := b.Index()
+	var got []string
+	for _, p := range idx.Packages {
+		got = append(got, p.Filename())
+	}
+	require.Equal(t, []string{"abc-2.0-r0.apk", "abc-10.0-r0.apk", "hello-1.0-r0.apk"}, got)
+	require.Equal(t, "replaced", idx.Packages[2].Description)
+
+	var signed bytes.Buffer
+	require.NoError(t, b.Write(&signed, keyFile, ""))
+	parsed, err := parseRepositoryIndex(ctx, "APKINDEX.tar.gz", keys, "x86_64", signed.Bytes(), &indexOpts{})
+	require.NoError(t, err)
+	require.Equal(t, "test", parsed.Description)
+	require.Len(t, parsed.Packages, 3)
+	require.Equal(t, "replaced", parsed.Packages[2].Description)
+
+	// Re-signing keeps the index and replaces the signature.
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKeyFile, otherPub := writeIndexKey(t, "other.pem", otherKey)
+
+	index, err := StripIndexSignatures(signed.Bytes())
+	require.NoError(t, err)
+	var unsigned bytes.Buffer
+	require.NoError(t, b.Write(&unsigned, "", ""))
+	require.Equal(t, unsigned.Bytes(), index)
+
+	var resigned bytes.Buffer
+	require.NoError(t, SignIndex(&resigned, index, otherKeyFile, ""))
+	_, err = parseRepositoryIndex(ctx, "APKINDEX.tar.gz", keys, "x86_64", resigned.Bytes(), &indexOpts{})
+	require.Error(t, err)
+	_, err = parseRepositoryIndex(ctx, "APKINDEX.tar.gz",
+		map[string][]byte{"other.pem.pub": otherPub},
+		"x86_64", resigned.Bytes(), &indexOpts{})
+	require.NoError(t, err)
+
+	again, err := StripIndexSignatures(resigned.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, index, again)
+
+	// An unsigned index is its own index.
+	index, err = StripIndexSignatures(unsigned.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, unsigned.Bytes(), index)
+
+	// The signatures of apk-tools are RSA signatures.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecKeyFile, _ := writeIndexKey(t, "ec.pem", ecKey)
+	require.ErrorContains(t, SignIndex(io.Discard, index, ecKeyFile, ""), "not an RSA key")
+}
+
+// writeIndexKey writes key as a PKCS8 private key named name, and returns
+// its path and its public key.
+func writeIndexKey(t *testing.T, name string, key crypto.Signer) (string, []byte) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	return keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
@@ -18,7 +18,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
-	"crypto/sha1" //nolint:gosec // this is what apk tools is using
+	"crypto"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -30,6 +30,7 @@ import (
 	"go.opentelemetry.io/otel"
 
 	"chainguard.dev/apko/internal/tarfs"
+	"chainguard.dev/apko/pkg/apk/digest"
 )
 
 // writeOneFile writes one file from the APK given the tar header and tar reader.
@@ -38,7 +39,11 @@ func (a *APK) writeOneFile(header *tar.Header, r io.Reader, allowOverwrite bool)
 	if _, err := a.fs.Stat(header.Name); err == nil {
 		if !allowOverwrite {
 			// get the sum of the file, so we can compare it to the new file
-			w := sha1.New() //nolint:gosec // this is what apk tools is using
+			// The apk format mandates SHA-1 for the checksums of files.
+			w, err := digest.Identify(crypto.SHA1)
+			if err != nil {
+				return err
+			}
 			f, err := a.fs.Open(header.Name)
 			if err != nil {
 				return fmt.Errorf("unable to open existing file to calculate sum %s: %w", header.Name, err)
@@ -84,7 +89,11 @@ func (a *APK) installRegularFile(header *tar.Header, tr *tar.Reader, tmpDir stri
 	if checksum == nil {
 		// There was no checksum header, which is unexpected, but we can just recalculate it.
 
-		w := sha1.New() //nolint:gosec // this is what apk tools is using
+		// The apk format mandates SHA-1 for the checksums of files.
+		w, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return false, err
+		}
 		tee := io.TeeReader(tr, w)
 
 		// we need to calculate the checksum of the file, and then pass it to the writeOneFile,
@@ -179,8 +188,9 @@ func (a *APK) installRegularFile(header *tar.Header, tr *tar.Reader, tmpDir stri
 
 // installAPKFiles install the files from the APK and return the list of installed files
 // and their permissions. Returns a tar.Header because it is a convenient existing
-// struct that has all of the fields we need.
-func (a *APK) installAPKFiles(ctx context.Context, in io.Reader, pkg *Package) ([]tar.Header, error) {
+// struct that has all of the fields we need. Files for which keep, if not nil,
+// returns false are skipped.
+func (a *APK) installAPKFiles(ctx context.Context, in io.Reader, pkg *Package, keep func(string) bool) ([]tar.Header, error) {
 	_, span := otel.Tracer("go-apk").Start(ctx, "installAPKFiles")
 	defer span.End()
 
@@ -214,6 +224,11 @@ func (a *APK) installAPKFiles(ctx context.Context, in io.Reader, pkg *Package) (
 		// whatever it is now, it is in the data section
 		startedDataSection = true
 
+		if filteredOut(header, keep) {
+			continue
+		}
+		a.normalize(pkg, header)
+
 		switch header.Typeflag {
 		case tar.TypeDir:
 			// special case, if the target already exists, and it is a symlink to a directory, we can accept it as is
@@ -278,6 +293,19 @@ func (a *APK) installAPKFiles(ctx context.Context, in io.Reader, pkg *Package) (
 	return files, nil
 }
 
+// filteredOut returns whether the file of header is left out by keep.
+// Directories are always kept, and hard links are left out with their
+// target.
+func filteredOut(header *tar.Header, keep func(string) bool) bool {
+	if keep == nil || header.Typeflag == tar.TypeDir {
+		return false
+	}
+	if header.Typeflag == tar.TypeLink && !keep(header.Linkname) {
+		return true
+	}
+	return !keep(header.Name)
+}
+
 func checksumFromHeader(header *tar.Header) ([]byte, error) {
 	pax := header.PAXRecords
 	if pax == nil {
@@ -314,7 +342,7 @@ func checksumFromHeader(header *tar.Header) ([]byte, error) {
 // to provide much cheaper access to the file data when we read it later.
 //
 // This is an optimizing fastpath for when a.fs is a specific implementation that supports it.
-func (a *APK) lazilyInstallAPKFiles(ctx context.Context, wh WriteHeaderer, tf *tarfs.FS, pkg *Package) ([]tar.Header, error) {
+func (a *APK) lazilyInstallAPKFiles(ctx context.Context, wh WriteHeaderer, tf *tarfs.FS, pkg *Package, keep func(string) bool) ([]tar.Header, error) {
 	_, span := otel.Tracer("go-apk").Start(ctx, "lazilyInstallAPKFiles")
 	defer span.End()
 
@@ -334,16 +362,22 @@ func (a *APK) lazilyInstallAPKFiles(ctx context.Context, wh WriteHeaderer, tf *t
 		// whatever it is now, it is in the data section
 		startedDataSection = true
 
-		installed, err := wh.WriteHeader(file.Header, tf, pkg)
+		if filteredOut(&file.Header, keep) {
+			continue
+		}
+		header := file.Header
+		a.normalize(pkg, &header)
+
+		installed, err := wh.WriteHeader(header, tf, pkg)
 		if err != nil {
 			return nil, err
 		}
 
-		if installed && file.Header.Typeflag == tar.TypeReg {
-			a.installedFiles[file.Header.Name] = pkg
+		if installed && header.Typeflag == tar.TypeReg {
+			a.installedFiles[header.Name] = pkg
 		}
 
-		files = append(files, file.Header)
+		files = append(files, header)
 	}
 
 	return files, nil
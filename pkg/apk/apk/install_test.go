@@ -60,7 +60,7 @@ func TestInstallAPKFiles(t *testing.T) {
 		}
 
 		r := testCreateTarForPackage(entries)
-		headers, err := apk.installAPKFiles(context.Background(), r, &Package{Origin: ""})
+		headers, err := apk.installAPKFiles(context.Background(), r, &Package{Origin: ""}, nil)
 		require.NoError(t, err)
 
 		require.Equal(t, len(headers), len(entries))
@@ -105,6 +105,34 @@ func TestInstallAPKFiles(t *testing.T) {
 		}
 	})
 
+	t.Run("filtered", func(t *testing.T) {
+		apk, src, err := testGetTestAPK()
+		require.NoErrorf(t, err, "failed to get test APK")
+
+		entries := []testDirEntry{
+			{"lib", 0o755, true, nil, nil},
+			{"lib/firmware", 0o755, true, nil, nil},
+			{"lib/firmware/kept.bin", 0644, false, []byte("kept"), nil},
+			{"lib/firmware/dropped.bin", 0644, false, []byte("dropped"), nil},
+		}
+
+		r := testCreateTarForPackage(entries)
+		keep := func(path string) bool { return path != "lib/firmware/dropped.bin" }
+		headers, err := apk.installAPKFiles(context.Background(), r, &Package{}, keep)
+		require.NoError(t, err)
+
+		var names []string
+		for _, h := range headers {
+			names = append(names, h.Name)
+		}
+		require.Equal(t, []string{"lib", "lib/firmware", "lib/firmware/kept.bin"}, names)
+
+		_, err = fs.Stat(src, "lib/firmware/dropped.bin")
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = fs.Stat(src, "lib/firmware/kept.bin")
+		require.NoError(t, err)
+	})
+
 	t.Run("xattrs", func(t *testing.T) {
 		apk, src, err := testGetTestAPK()
 		require.NoErrorf(t, err, "failed to get test APK")
@@ -117,7 +145,7 @@ func TestInstallAPKFiles(t *testing.T) {
 		}
 
 		r := testCreateTarForPackage(entries)
-		headers, err := apk.installAPKFiles(context.Background(), r, &Package{})
+		headers, err := apk.installAPKFiles(context.Background(), r, &Package{}, nil)
 		require.NoError(t, err)
 
 		require.Equal(t, len(headers), len(entries))
@@ -24,6 +24,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -56,61 +57,85 @@ func (a *APK) AddInstalledPackage(pkg *Package, files []tar.Header) error {
 	}
 	defer installedFile.Close()
 
-	// sort the files by directory
-	sortedFiles := sortTarHeaders(files)
-	// package lines
-	pkgLines := PackageToInstalled(pkg)
-	// file lines
-	for _, f := range sortedFiles {
-		perm := f.Mode & 0777
-		user := f.Uid
-		group := f.Gid
+	return WriteInstalled(installedFile, pkg, files)
+}
 
+// installedChecksum returns checksum, a SHA-1 in hex or Q1-prefixed base64,
+// as the latter, as files are listed in InstalledDBPath.
+func installedChecksum(checksum string) (string, error) {
+	if strings.HasPrefix(checksum, "Q1") {
+		return checksum, nil
+	}
+	hexsum, err := hex.DecodeString(checksum)
+	if err != nil {
+		return "", err
+	}
+	return "Q1" + base64.StdEncoding.EncodeToString(hexsum), nil
+}
+
+// withParentDirs returns the headers with an entry added for every parent
+// directory which does not already have one. apk lists files relative to the
+// preceding directory entry, so without this a file whose directory is not in
+// the package would be attributed to the wrong directory.
+func withParentDirs(files []tar.Header) []tar.Header {
+	dirs := make(map[string]struct{}, len(files))
+	for _, f := range files {
 		if f.Typeflag == tar.TypeDir {
-			dirName := strings.TrimSuffix(f.Name, fmt.Sprintf("%c", filepath.Separator))
-			pkgLines = append(pkgLines, fmt.Sprintf("F:%s", dirName))
-			if perm != 0o755 || user != 0 || group != 0 {
-				pkgLines = append(pkgLines, fmt.Sprintf("M:%d:%d:%04o", user, group, perm))
-			}
-		} else {
-			pkgLines = append(pkgLines, fmt.Sprintf("R:%s", filepath.Base(f.Name)))
-			if perm != 0o644 || user != 0 || group != 0 {
-				pkgLines = append(pkgLines, fmt.Sprintf("a:%d:%d:%04o", user, group, perm))
+			dirs[filepath.Clean(f.Name)] = struct{}{}
+		}
+	}
+
+	out := files
+	for _, f := range files {
+		for dir := filepath.Dir(filepath.Clean(f.Name)); dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if _, ok := dirs[dir]; ok {
+				break
 			}
-			if f.PAXRecords != nil {
-				if checksum := f.PAXRecords[paxRecordsChecksumKey]; checksum != "" {
-					if !strings.HasPrefix(checksum, "Q1") {
-						hexsum, err := hex.DecodeString(checksum)
-						if err != nil {
-							return err
-						}
-						checksum = "Q1" + base64.StdEncoding.EncodeToString(hexsum)
-					}
-					pkgLines = append(pkgLines, fmt.Sprintf("Z:%s", checksum))
-				}
+			dirs[dir] = struct{}{}
+			if len(out) == len(files) {
+				out = slices.Clone(files)
 			}
+			out = append(out, tar.Header{
+				Name:     dir,
+				Typeflag: tar.TypeDir,
+				Mode:     0o755,
+			})
 		}
 	}
-	// write to installed file
-	b := []byte(strings.Join(pkgLines, "\n") + "\n\n")
-	if _, err := installedFile.Write(b); err != nil {
-		return err
-	}
-	return nil
+	return out
 }
 
 // isInstalledPackage check if a specific package is installed
 func (a *APK) isInstalledPackage(pkg string) (bool, error) {
+	ip, err := a.installedPackage(pkg)
+	return ip != nil, err
+}
+
+// installedPackage returns the installed package named pkg, or nil if it is
+// not installed.
+func (a *APK) installedPackage(pkg string) (*InstalledPackage, error) {
 	installedPackages, err := a.GetInstalled()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 	for _, installedPkg := range installedPackages {
 		if installedPkg.Name == pkg {
-			return true, nil
+			return installedPkg, nil
 		}
 	}
-	return false, nil
+	return nil, nil
+}
+
+// scriptNames are the names of the scripts in a package's control section
+// which apk knows how to run.
+var scriptNames = []string{
+	".pre-install",
+	".post-install",
+	".pre-upgrade",
+	".post-upgrade",
+	".pre-deinstall",
+	".post-deinstall",
+	".trigger",
 }
 
 // updateScriptsTar insert the scripts into the tarball
@@ -154,15 +179,14 @@ func (a *APK) updateScriptsTar(pkg *Package, controlTarGz io.Reader, sourceDateE
 			continue
 		}
 
-		// Ignore files that aren't executable.
-		// This is mostly to ignore .melange.yaml files in the control section,
-		// but apk itself has hardcoded list of scripts that we might want to do too.
-		if header.FileInfo().Mode().Perm()&0555 != 0555 {
+		// Only keep the scripts apk knows how to run, this is mostly to
+		// ignore .melange.yaml files in the control section.
+		if !slices.Contains(scriptNames, header.Name) {
 			continue
 		}
 
-		origName := header.Name
-		header.Name = fmt.Sprintf("%s-%s.Q1%s%s", pkg.Name, pkg.Version, base64.StdEncoding.EncodeToString(pkg.Checksum), origName)
+		script := Script{Package: pkg.Name, Version: pkg.Version, Checksum: pkg.Checksum, Type: header.Name}
+		header.Name = script.FileName()
 
 		// zero out timestamps for reproducibility
 		if sourceDateEpoch != nil {
@@ -222,10 +246,16 @@ func (a *APK) updateTriggers(pkg *Package, controlTarGz io.Reader) error {
 		return fmt.Errorf("updating triggers for %s: %w", pkg.Name, err)
 	}
 
+	// apk keeps one line per package, with all of its trigger paths.
+	var paths []string
 	for _, value := range values {
-		if _, err := fmt.Fprintf(triggers, "Q1%s %s\n", base64.StdEncoding.EncodeToString(pkg.Checksum), value); err != nil {
-			return fmt.Errorf("unable to write triggers file %s: %w", triggersFilePath, err)
-		}
+		paths = append(paths, strings.Fields(value)...)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	if err := WriteTriggers(triggers, Trigger{Checksum: pkg.Checksum, Paths: paths}); err != nil {
+		return fmt.Errorf("unable to write triggers file %s: %w", triggersFilePath, err)
 	}
 
 	return nil
@@ -236,7 +266,11 @@ func (a *APK) readTriggers() (io.ReadCloser, error) {
 	return a.fs.Open(triggersFilePath)
 }
 
-// parseInstalled parses an installed file. It returns the installed packages.
+// ParseInstalled parses an installed file. It returns the installed packages.
+//
+// The headers of the files have the ownership and permissions of their a: and
+// M: lines, but no checksums, so writing them with WriteInstalled does not
+// give the same file back.
 func ParseInstalled(installed io.Reader) ([]*InstalledPackage, error) { //nolint:gocyclo
 	if closer, ok := installed.(io.Closer); ok {
 		defer closer.Close()
@@ -331,14 +365,16 @@ func ParseInstalled(installed io.Reader) ([]*InstalledPackage, error) { //nolint
 				pkg.Checksum = checksum
 			}
 		case "F":
-			lastDir = &tar.Header{
+			// lastDir and lastFile point into pkg.Files, so that the lines
+			// which follow them can set their permissions.
+			pkg.Files = append(pkg.Files, tar.Header{
 				Name:     val,
 				Mode:     0o755,
 				Uid:      0,
 				Gid:      0,
 				Typeflag: tar.TypeDir,
-			}
-			pkg.Files = append(pkg.Files, *lastDir)
+			})
+			lastDir = &pkg.Files[len(pkg.Files)-1]
 			lastFile = nil
 		case "M":
 			// directory perms if not 0o755
@@ -357,13 +393,13 @@ func ParseInstalled(installed io.Reader) ([]*InstalledPackage, error) { //nolint
 			if lastDir != nil {
 				fullpath, _ = sanitizeArchivePath(lastDir.Name, val)
 			}
-			lastFile = &tar.Header{
+			pkg.Files = append(pkg.Files, tar.Header{
 				Name: fullpath,
 				Mode: 0o644,
 				Uid:  0,
 				Gid:  0,
-			}
-			pkg.Files = append(pkg.Files, *lastFile)
+			})
+			lastFile = &pkg.Files[len(pkg.Files)-1]
 		case "a":
 			// file perms if not 0o644
 			if lastFile == nil {
@@ -104,6 +104,34 @@ func TestAddInstalledPackage(t *testing.T) {
 	require.Contains(t, str, want)
 }
 
+func TestAddInstalledPackageParentDirs(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err, "unable to initialize APK implementation")
+	newPkg := &Package{
+		Name:      "testpkg",
+		Version:   "1.0.0",
+		Arch:      "x86_64",
+		InstallIf: []string{"foo", "bar"},
+		BuildTime: time.Now(),
+	}
+	newFiles := []tar.Header{
+		{Name: "etc", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "etc/foo.conf", Typeflag: tar.TypeReg, Size: 12, Mode: 0o644},
+		// usr and usr/bin are missing, and must be added so the file is not
+		// attributed to etc.
+		{Name: "usr/bin/foo", Typeflag: tar.TypeReg, Size: 1234, Mode: 0o755},
+	}
+	require.NoError(t, a.AddInstalledPackage(newPkg, newFiles))
+
+	installedFile, err := a.fs.ReadFile(installedFilePath)
+	require.NoError(t, err)
+	str := string(installedFile)
+	require.Contains(t, str, "i:foo bar\n")
+	require.NotContains(t, str, "D:\n")
+	require.Contains(t, str, "F:etc\nR:foo.conf\n")
+	require.Contains(t, str, "F:usr\nF:usr/bin\nR:foo\n")
+}
+
 func TestIsInstalledPackage(t *testing.T) {
 	a, _, err := testGetTestAPK()
 	require.NoErrorf(t, err, "unable to initialize APK implementation: %v", err)
@@ -162,6 +190,15 @@ func TestUpdateScriptsTar(t *testing.T) {
 		_, _ = tw.Write(content)
 	}
 
+	// not a script apk knows about, so should not be included
+	melange := []byte("package: testpkg")
+	_ = tw.WriteHeader(&tar.Header{
+		Name: ".melange.yaml",
+		Mode: 0o755,
+		Size: int64(len(melange)),
+	})
+	_, _ = tw.Write(melange)
+
 	_ = tw.WriteHeader(&tar.Header{
 		Name: ".PKGINFO",
 		Mode: 0o644,
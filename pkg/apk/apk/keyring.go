@@ -0,0 +1,89 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// KeyringPolicy restricts the keys installed into the keyring to those with
+// pinned fingerprints.
+type KeyringPolicy struct {
+	// Pins maps repositories to the fingerprints of the keys expected to sign
+	// them. Keys discovered for repositories without pins are trusted, and
+	// keys from the keyring must match a pin of any repository.
+	Pins map[string][]string
+	// Warn logs keys which are not pinned instead of rejecting them.
+	Warn bool
+}
+
+// KeyFingerprint returns the fingerprint of a PEM encoded public key, which is
+// "sha256:" followed by the hex encoded SHA-256 digest of its DER encoding.
+func KeyFingerprint(key []byte) (string, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return "", errors.New("no PEM block found")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// checkKey applies the keyring policy to the key name discovered for
+// repository, or to a key from the keyring when repository is empty.
+func (a *APK) checkKey(ctx context.Context, repository, name string, key []byte) error {
+	if len(a.keyringPolicy.Pins) == 0 {
+		return nil
+	}
+
+	var pinned []string
+	if repository == "" {
+		for _, fps := range a.keyringPolicy.Pins {
+			pinned = append(pinned, fps...)
+		}
+	} else {
+		var ok bool
+		pinned, ok = a.keyringPolicy.Pins[strings.TrimRight(repository, "/")]
+		if !ok {
+			return nil
+		}
+	}
+
+	fp, err := KeyFingerprint(key)
+	if err != nil {
+		return fmt.Errorf("fingerprinting key %s: %w", name, err)
+	}
+	if slices.Contains(pinned, fp) {
+		return nil
+	}
+
+	err = fmt.Errorf("key %s with fingerprint %s is not pinned", name, fp)
+	if repository != "" {
+		err = fmt.Errorf("key %s with fingerprint %s is not pinned for %s", name, fp, repository)
+	}
+	if a.keyringPolicy.Warn {
+		clog.FromContext(ctx).Warnf("%v, installing it anyway", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+const (
+	// OCIKeyringScheme prefixes keyring entries naming an OCI artifact whose
+	// layers are keys, e.g. oci://ghcr.io/example/keys:latest.
+	OCIKeyringScheme = "oci://"
+
+	// ociTitleAnnotation names the key file held by a layer, as set by
+	// oras push.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+
+	// SigstoreBundleArtifactType is the artifact type of the Sigstore bundles
+	// attached to a keyring artifact as referrers, as cosign attaches them.
+	SigstoreBundleArtifactType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+)
+
+// ArtifactVerifier verifies the signature of an artifact, such as a Sigstore
+// bundle, which is attached to it.
+type ArtifactVerifier interface {
+	// VerifyArtifact verifies the signature of the artifact, returning an
+	// error unless it is valid.
+	VerifyArtifact(ctx context.Context, artifact, signature []byte) error
+}
+
+// ociKeyCache holds the keys of the keyring artifacts fetched so far, by the
+// digest of their manifest, so that the keys of an artifact are downloaded
+// once however many builds use it. The manifest is still fetched, and
+// verified, every time, as its tag may move.
+var ociKeyCache sync.Map // v1.Hash -> map[string][]byte
+
+// keyringRepository returns the name of the OCI repository of a keyring
+// entry, with or without its scheme, tag or digest.
+func keyringRepository(ref string) (string, error) {
+	r, err := name.ParseReference(strings.TrimPrefix(ref, OCIKeyringScheme))
+	if err != nil {
+		return "", err
+	}
+	return r.Context().Name(), nil
+}
+
+// FetchOCIKeys returns the keys held by the OCI artifact of a keyring entry,
+// such as oci://ghcr.io/example/keys:latest, by the title annotations of its
+// layers. When a verifier is configured for its repository, one of the
+// Sigstore bundles attached to the artifact must satisfy it.
+func (a *APK) FetchOCIKeys(ctx context.Context, element string) (map[string][]byte, error) {
+	ref, err := name.ParseReference(strings.TrimPrefix(element, OCIKeyringScheme))
+	if err != nil {
+		return nil, fmt.Errorf("parsing keyring reference %s: %w", element, err)
+	}
+	opts := append([]remote.Option{remote.WithContext(ctx)}, a.remoteOptions...)
+	img, err := remote.Image(ref, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keyring artifact %s: %w", element, err)
+	}
+
+	if v, ok := a.keyringVerifications[ref.Context().Name()]; ok {
+		if err := verifyOCIArtifact(ctx, ref.Context(), img, v, opts); err != nil {
+			return nil, fmt.Errorf("verifying keyring artifact %s: %w", element, err)
+		}
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of keyring artifact %s: %w", element, err)
+	}
+	if keys, ok := ociKeyCache.Load(digest); ok {
+		return maps.Clone(keys.(map[string][]byte)), nil
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of keyring artifact %s: %w", element, err)
+	}
+	keys := make(map[string][]byte, len(m.Layers))
+	for _, desc := range m.Layers {
+		title := desc.Annotations[ociTitleAnnotation]
+		if title == "" || strings.ContainsAny(title, `/\`) {
+			clog.FromContext(ctx).Warnf("skipping layer %s of keyring artifact %s with invalid title %q", desc.Digest, element, title)
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("fetching key %s from %s: %w", title, element, err)
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("fetching key %s from %s: %w", title, element, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading key %s from %s: %w", title, element, err)
+		}
+		keys[title] = data
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys found in keyring artifact %s", element)
+	}
+	ociKeyCache.Store(digest, maps.Clone(keys))
+	return keys, nil
+}
+
+// verifyOCIArtifact checks that one of the Sigstore bundles referring to img
+// signs its manifest and satisfies v.
+func verifyOCIArtifact(ctx context.Context, repo name.Repository, img v1.Image, v ArtifactVerifier, opts []remote.Option) error {
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	referrers, err := remote.Referrers(repo.Digest(digest.String()), append(opts, remote.WithFilter("artifactType", SigstoreBundleArtifactType))...)
+	if err != nil {
+		return fmt.Errorf("listing referrers: %w", err)
+	}
+	index, err := referrers.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("listing referrers: %w", err)
+	}
+
+	var errs []error
+	for _, desc := range index.Manifests {
+		if desc.ArtifactType != SigstoreBundleArtifactType {
+			continue
+		}
+		bundle, err := ociBundle(repo.Digest(desc.Digest.String()), opts)
+		if err == nil {
+			err = v.VerifyArtifact(ctx, manifest, bundle)
+		}
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("bundle %s: %w", desc.Digest, err))
+	}
+	if len(errs) == 0 {
+		return errors.New("no sigstore bundle found")
+	}
+	return errors.Join(errs...)
+}
+
+// ociBundle returns the Sigstore bundle held by the single layer of the
+// artifact at ref.
+func ociBundle(ref name.Digest, opts []remote.Option) ([]byte, error) {
+	img, err := remote.Image(ref, opts...)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("expected 1 layer, found %d", len(layers))
+	}
+	rc, err := layers[0].Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
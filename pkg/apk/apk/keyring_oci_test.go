@@ -0,0 +1,153 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+type fakeArtifactVerifier struct {
+	bundle []byte
+}
+
+func (f fakeArtifactVerifier) VerifyArtifact(_ context.Context, _, signature []byte) error {
+	if !bytes.Equal(signature, f.bundle) {
+		return errors.New("bundle does not match")
+	}
+	return nil
+}
+
+// pushKeyring pushes an artifact holding the demo key to the registry at
+// host, attaching bundle to it when set, and returns its keyring entry.
+func pushKeyring(t *testing.T, host, repo string, bundle []byte) string {
+	t.Helper()
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer:       static.NewLayer([]byte(testDemoKey), "application/x-pem-file"),
+		Annotations: map[string]string{ociTitleAnnotation: "demo.rsa.pub"},
+	})
+	require.NoError(t, err)
+	ref, err := name.ParseReference(host + "/" + repo + ":latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+
+	if bundle != nil {
+		desc, err := partial.Descriptor(img)
+		require.NoError(t, err)
+		sig, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+			Layer: static.NewLayer(bundle, SigstoreBundleArtifactType),
+		})
+		require.NoError(t, err)
+		sig = mutate.ConfigMediaType(sig, SigstoreBundleArtifactType)
+		sig = mutate.Subject(sig, v1.Descriptor{MediaType: desc.MediaType, Digest: desc.Digest, Size: desc.Size}).(v1.Image)
+		d, err := sig.Digest()
+		require.NoError(t, err)
+		require.NoError(t, remote.Write(ref.Context().Digest(d.String()), sig))
+	}
+	return OCIKeyringScheme + ref.String()
+}
+
+func TestInitKeyringOCI(t *testing.T) {
+	s := httptest.NewServer(registry.New())
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+	bundle := []byte(`{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json"}`)
+
+	for _, tc := range []struct {
+		name     string
+		bundle   []byte
+		verifier ArtifactVerifier
+		wantErr  string
+	}{
+		{name: "unverified"},
+		{name: "verified", bundle: bundle, verifier: fakeArtifactVerifier{bundle: bundle}},
+		{name: "no bundle", verifier: fakeArtifactVerifier{bundle: bundle}, wantErr: "no sigstore bundle found"},
+		{name: "invalid bundle", bundle: []byte(`{}`), verifier: fakeArtifactVerifier{bundle: bundle}, wantErr: "bundle does not match"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := "keys/" + strings.ReplaceAll(tc.name, " ", "-")
+			element := pushKeyring(t, host, repo, tc.bundle)
+
+			opts := []Option{WithFS(apkfs.NewMemFS())}
+			if tc.verifier != nil {
+				opts = append(opts, WithKeyringVerification(OCIKeyringScheme+host+"/"+repo, tc.verifier))
+			}
+			a, err := New(t.Context(), opts...)
+			require.NoError(t, err)
+
+			err = a.InitKeyring(t.Context(), []string{element}, nil)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			keys, err := a.GetKeys()
+			require.NoError(t, err)
+			require.Equal(t, map[string][]byte{"demo.rsa.pub": []byte(testDemoKey)}, keys)
+		})
+	}
+}
+
+func TestFetchOCIKeysCache(t *testing.T) {
+	reg := registry.New()
+	var blobs atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/blobs/") {
+			blobs.Add(1)
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+	// Unlike the other keyring artifacts, its key is unique to the test.
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), mutate.Addendum{
+		Layer:       static.NewLayer([]byte(testDemoKey+"\n"), "application/x-pem-file"),
+		Annotations: map[string]string{ociTitleAnnotation: "cached.rsa.pub"},
+	})
+	require.NoError(t, err)
+	ref, err := name.ParseReference(host + "/keys/cached:latest")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	blobs.Store(0)
+
+	// Each build fetches the manifest, but the keys are downloaded once.
+	for range 2 {
+		a, err := New(t.Context(), WithFS(apkfs.NewMemFS()))
+		require.NoError(t, err)
+		keys, err := a.FetchOCIKeys(t.Context(), OCIKeyringScheme+ref.String())
+		require.NoError(t, err)
+		require.Equal(t, map[string][]byte{"cached.rsa.pub": []byte(testDemoKey + "\n")}, keys)
+	}
+	require.EqualValues(t, 1, blobs.Load())
+}
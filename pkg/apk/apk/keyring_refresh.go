@@ -0,0 +1,245 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+)
+
+// discoveredKey is a keyring key discovered for a build repository.
+type discoveredKey struct {
+	repository string
+	expires    time.Time
+}
+
+// writeDiscoveredKeys installs the keys discovered for repository in the
+// keyring, remembering when they expire.
+func (a *APK) writeDiscoveredKeys(ctx context.Context, repository string, keys []Key) error {
+	a.keyringMu.Lock()
+	defer a.keyringMu.Unlock()
+
+	for _, key := range keys {
+		if err := a.checkKey(ctx, repository, key.ID, key.Bytes); err != nil {
+			return err
+		}
+		filename := filepath.Join(keysDirPath, key.ID)
+		if err := a.fs.WriteFile(filename, key.Bytes, 0o644); err != nil {
+			return fmt.Errorf("failed to write key file %s: %w", filename, err)
+		}
+		if a.discoveredKeys == nil {
+			a.discoveredKeys = map[string]discoveredKey{}
+		}
+		a.discoveredKeys[key.ID] = discoveredKey{repository: repository, expires: key.Expires}
+	}
+	return nil
+}
+
+// keyExpiries returns when the keyring keys with a known expiry expire, by
+// their name.
+func (a *APK) keyExpiries() map[string]time.Time {
+	a.keyringMu.RLock()
+	defer a.keyringMu.RUnlock()
+
+	expiries := map[string]time.Time{}
+	for name, key := range a.discoveredKeys {
+		if !key.expires.IsZero() {
+			expiries[name] = key.expires
+		}
+	}
+	return expiries
+}
+
+// ExpiredKeyError is returned when a signature can't be verified with any
+// key, and some of the keys that made it have expired, which usually means
+// that the repository rotated its keys since the keyring was populated.
+type ExpiredKeyError struct {
+	What string
+	// Keys are the expired keys, with the time they expired.
+	Keys map[string]time.Time
+}
+
+func (e *ExpiredKeyError) Unwrap() error {
+	return ErrSignatureInvalid
+}
+
+func (e *ExpiredKeyError) Error() string {
+	expired := make([]string, 0, len(e.Keys))
+	for name, t := range e.Keys {
+		expired = append(expired, fmt.Sprintf("%s expired on %s", name, t.Format(time.DateOnly)))
+	}
+	slices.Sort(expired)
+	return fmt.Sprintf("signature verification failed for %s: key %s; refresh the keyring to pick up rotated keys", e.What, strings.Join(expired, ", "))
+}
+
+// KeyringChanges are the changes RefreshKeys made to the keyring, by key name.
+type KeyringChanges struct {
+	// Added are keys which were not in the keyring.
+	Added []string
+	// Rotated are keys whose contents changed.
+	Rotated []string
+	// Removed are keys no longer published by their repository, or which
+	// expired.
+	Removed []string
+}
+
+// Changed reports whether the keyring changed.
+func (c KeyringChanges) Changed() bool {
+	return len(c.Added)+len(c.Rotated)+len(c.Removed) > 0
+}
+
+// RefreshKeys runs the Alpine and Chainguard-style key discovery of InitDB
+// again for the same repositories, for long-lived users of APK which outlive
+// the keys of a repository. Keys which were added, rotated or removed since,
+// or which expired, are updated in /etc/apk/keys. Keys which were not
+// discovered, such as those installed by InitKeyring, are left alone.
+//
+// The keyring is updated atomically: all keys are discovered and checked
+// against the keyring policy first, indexes and packages are not verified
+// while it is rewritten, and the previous keys are restored if rewriting it
+// fails.
+func (a *APK) RefreshKeys(ctx context.Context) (KeyringChanges, error) {
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "RefreshKeys")
+	defer span.End()
+
+	log := clog.FromContext(ctx)
+
+	if a.cache != nil && a.cache.offline {
+		return KeyringChanges{}, errors.New("cannot refresh keys offline")
+	}
+
+	a.keyringMu.RLock()
+	repos := slices.Clone(a.keyRepositories)
+	a.keyringMu.RUnlock()
+
+	now := time.Now()
+	fresh := map[string]discoveredKey{}
+	contents := map[string][]byte{}
+	for _, repo := range repos {
+		keys, err := a.rediscoverKeys(ctx, repo)
+		if err != nil {
+			return KeyringChanges{}, err
+		}
+		for _, key := range keys {
+			if !key.Expires.IsZero() && !key.Expires.After(now) {
+				log.Warnf("ignoring key %s for %s, which expired on %s", key.ID, repo, key.Expires.Format(time.DateOnly))
+				continue
+			}
+			if err := a.checkKey(ctx, repo, key.ID, key.Bytes); err != nil {
+				return KeyringChanges{}, err
+			}
+			fresh[key.ID] = discoveredKey{repository: repo, expires: key.Expires}
+			contents[key.ID] = key.Bytes
+		}
+	}
+
+	a.keyringMu.Lock()
+	defer a.keyringMu.Unlock()
+
+	// previous holds the contents of each key file that is changed, nil for
+	// those which did not exist, to restore them on failure.
+	previous := map[string][]byte{}
+	var changes KeyringChanges
+	restore := func(err error) (KeyringChanges, error) {
+		for name, b := range previous {
+			filename := filepath.Join(keysDirPath, name)
+			if b == nil {
+				_ = a.fs.Remove(filename)
+			} else {
+				_ = a.fs.WriteFile(filename, b, 0o644)
+			}
+		}
+		return KeyringChanges{}, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(fresh)) {
+		filename := filepath.Join(keysDirPath, name)
+		old, err := a.fs.ReadFile(filename)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changes.Added = append(changes.Added, name)
+		case err != nil:
+			return restore(fmt.Errorf("reading key file %s: %w", filename, err))
+		case string(old) == string(contents[name]):
+			continue
+		default:
+			changes.Rotated = append(changes.Rotated, name)
+		}
+		previous[name] = old
+		if err := a.fs.WriteFile(filename, contents[name], 0o644); err != nil {
+			return restore(fmt.Errorf("failed to write key file %s: %w", filename, err))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(a.discoveredKeys)) {
+		if _, ok := fresh[name]; ok {
+			continue
+		}
+		filename := filepath.Join(keysDirPath, name)
+		old, err := a.fs.ReadFile(filename)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return restore(fmt.Errorf("reading key file %s: %w", filename, err))
+		}
+		previous[name] = old
+		if err := a.fs.Remove(filename); err != nil {
+			return restore(fmt.Errorf("removing key file %s: %w", filename, err))
+		}
+		changes.Removed = append(changes.Removed, name)
+	}
+	a.discoveredKeys = fresh
+
+	if changes.Changed() {
+		log.Infof("refreshed keyring: added %v, rotated %v, removed %v", changes.Added, changes.Rotated, changes.Removed)
+	}
+	return changes, nil
+}
+
+// rediscoverKeys discovers the keys of repository like InitDB, bypassing
+// the cache. Unlike InitDB, failures are returned rather than ignored, so
+// that a repository which can't be reached doesn't lose its keys.
+func (a *APK) rediscoverKeys(ctx context.Context, repository string) ([]Key, error) {
+	var keys []Key
+	if ver, ok := parseAlpineVersion(repository); ok {
+		alpine, err := a.alpineKeys(ctx, ver)
+		var nokeysErr *NoKeysFoundError
+		if err != nil && !errors.As(err, &nokeysErr) {
+			return nil, fmt.Errorf("failed to fetch alpine-keys: %w", err)
+		}
+		keys = append(keys, alpine...)
+	}
+
+	if !strings.HasPrefix(repository, "https://") && !strings.HasPrefix(repository, "http://") {
+		return keys, nil
+	}
+	if a.cache != nil {
+		a.cache.shared.discoverKeys.Forget(repository)
+	}
+	discovered, err := DiscoverKeys(ctx, a.client, a.auth, repository)
+	if err != nil {
+		return nil, fmt.Errorf("fetching chainguard keys for %s: %w", repository, err)
+	}
+	return append(keys, discovered...), nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"chainguard.dev/apko/pkg/apk/digest"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestRefreshKeys(t *testing.T) {
+	newKey := func(id string) jose.JSONWebKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		return jose.JSONWebKey{KeyID: id, Key: key.Public()}
+	}
+	expiredKey := func(id string) jose.JSONWebKey {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: id},
+			NotBefore:    time.Now().Add(-48 * time.Hour),
+			NotAfter:     time.Now().Add(-24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return jose.JSONWebKey{KeyID: id, Key: key.Public(), Certificates: []*x509.Certificate{cert}}
+	}
+
+	var (
+		mu     sync.Mutex
+		jwks   = []jose.JSONWebKey{newKey("rotated"), newKey("removed")}
+		broken bool
+		s      *httptest.Server
+	)
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case broken:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case r.URL.Path == "/os/apk-configuration":
+			fmt.Fprintf(w, `{"jwks_uri": %q}`, s.URL+"/jwks")
+		case r.URL.Path == "/jwks":
+			require.NoError(t, json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: jwks}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	src := apkfs.NewMemFS()
+	a, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors))
+	require.NoError(t, err)
+	require.NoError(t, a.InitDB(t.Context(), s.URL+"/os"))
+	require.NoError(t, src.WriteFile(filepath.Join(keysDirPath, "local.rsa.pub"), []byte(testDemoKey), 0o644))
+	before, err := a.GetKeys()
+	require.NoError(t, err)
+	require.Len(t, before, 3)
+
+	mu.Lock()
+	jwks = []jose.JSONWebKey{newKey("rotated"), newKey("added"), expiredKey("expired")}
+	mu.Unlock()
+
+	changes, err := a.RefreshKeys(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, KeyringChanges{
+		Added:   []string{"added.ecdsa.pub"},
+		Rotated: []string{"rotated.ecdsa.pub"},
+		Removed: []string{"removed.ecdsa.pub"},
+	}, changes)
+
+	after, err := a.GetKeys()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"added.ecdsa.pub", "rotated.ecdsa.pub", "local.rsa.pub"}, keyNames(after))
+	require.NotEqual(t, before["rotated.ecdsa.pub"], after["rotated.ecdsa.pub"])
+
+	changes, err = a.RefreshKeys(t.Context())
+	require.NoError(t, err)
+	require.False(t, changes.Changed())
+
+	// A repository which can't be reached keeps its keys.
+	mu.Lock()
+	broken = true
+	mu.Unlock()
+	_, err = a.RefreshKeys(t.Context())
+	require.Error(t, err)
+	unchanged, err := a.GetKeys()
+	require.NoError(t, err)
+	require.Equal(t, after, unchanged)
+}
+
+func keyNames(keys map[string][]byte) []string {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestVerifySignaturesExpiredKey(t *testing.T) {
+	sigs := []Signature{{KeyID: "demo.rsa.pub", Signature: []byte("not a signature"), DigestAlgorithm: crypto.SHA256}}
+	keys := map[string][]byte{"demo.rsa.pub": []byte(testDemoKey)}
+	expired := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name     string
+		expiries map[string]time.Time
+		wantErr  string
+	}{
+		{name: "no expiry", wantErr: "signature verification failed for test, for all provided keys"},
+		{name: "not expired", expiries: map[string]time.Time{"demo.rsa.pub": time.Now().Add(time.Hour)}, wantErr: "for all provided keys"},
+		{name: "expired", expiries: map[string]time.Time{"demo.rsa.pub": expired}, wantErr: "key demo.rsa.pub expired on 2020-01-02"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := verifySignatures(t.Context(), digest.Default(), []byte("data"), sigs, keys, tc.expiries, "test")
+			require.ErrorContains(t, err, tc.wantErr)
+			require.ErrorIs(t, err, ErrSignatureInvalid)
+			var expiredErr *ExpiredKeyError
+			require.Equal(t, tc.name == "expired", errors.As(err, &expiredErr))
+		})
+	}
+}
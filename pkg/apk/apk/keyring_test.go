@@ -0,0 +1,135 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.step.sm/crypto/jose"
+
+	"chainguard.dev/apko/pkg/apk/auth"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestKeyFingerprint(t *testing.T) {
+	block, _ := pem.Decode([]byte(testDemoKey))
+	sum := sha256.Sum256(block.Bytes)
+
+	fp, err := KeyFingerprint([]byte(testDemoKey))
+	require.NoError(t, err)
+	require.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), fp)
+
+	_, err = KeyFingerprint([]byte("not a key"))
+	require.Error(t, err)
+}
+
+func TestInitKeyringPolicy(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "demo.rsa.pub")
+	require.NoError(t, os.WriteFile(keyPath, []byte(testDemoKey), 0o644)) //nolint:gosec
+	fp, err := KeyFingerprint([]byte(testDemoKey))
+	require.NoError(t, err)
+	other := "sha256:" + hex.EncodeToString(make([]byte, 32))
+
+	for _, tc := range []struct {
+		name    string
+		policy  KeyringPolicy
+		wantErr bool
+	}{
+		{name: "no pins"},
+		{name: "pinned", policy: KeyringPolicy{Pins: map[string][]string{"https://example.com/os": {other, fp}}}},
+		{name: "not pinned", policy: KeyringPolicy{Pins: map[string][]string{"https://example.com/os": {other}}}, wantErr: true},
+		{name: "warn", policy: KeyringPolicy{Pins: map[string][]string{"https://example.com/os": {other}}, Warn: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := apkfs.NewMemFS()
+			a, err := New(t.Context(), WithFS(src), WithKeyringPolicy(tc.policy))
+			require.NoError(t, err)
+
+			err = a.InitKeyring(t.Context(), []string{keyPath}, nil)
+			if tc.wantErr {
+				require.ErrorContains(t, err, "is not pinned")
+				return
+			}
+			require.NoError(t, err)
+			_, err = src.Stat("etc/apk/keys/demo.rsa.pub")
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDiscoveredKeysPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var s *httptest.Server
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/os/apk-configuration":
+			fmt.Fprintf(w, `{"jwks_uri": %q}`, s.URL+"/jwks")
+		case "/jwks":
+			require.NoError(t, json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{KeyID: "signing", Key: key.Public()}}}))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+	repo := s.URL + "/os"
+
+	discovered, err := DiscoverKeys(t.Context(), s.Client(), auth.MultiAuthenticator(), repo)
+	require.NoError(t, err)
+	require.Len(t, discovered, 1)
+	fp, err := KeyFingerprint(discovered[0].Bytes)
+	require.NoError(t, err)
+	other := "sha256:" + hex.EncodeToString(make([]byte, 32))
+
+	for _, tc := range []struct {
+		name    string
+		pins    map[string][]string
+		wantErr bool
+	}{
+		{name: "pinned", pins: map[string][]string{repo: {fp}}},
+		{name: "other repository", pins: map[string][]string{"https://example.com/os": {other}}},
+		{name: "rotated", pins: map[string][]string{repo: {other}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := apkfs.NewMemFS()
+			require.NoError(t, src.MkdirAll(keysDirPath, 0o755))
+			a, err := New(t.Context(), WithFS(src), WithKeyringPolicy(KeyringPolicy{Pins: tc.pins}))
+			require.NoError(t, err)
+
+			err = a.fetchChainguardKeys(t.Context(), repo+"/")
+			if tc.wantErr {
+				require.ErrorContains(t, err, "is not pinned for")
+				return
+			}
+			require.NoError(t, err)
+			_, err = src.Stat(filepath.Join(keysDirPath, "signing.ecdsa.pub"))
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// downloadLimits bounds the number of concurrent downloads, and their
+// bandwidth, of the APKs which share them.
+type downloadLimits struct {
+	slots   chan struct{}
+	limiter *rate.Limiter
+}
+
+// transport returns a transport which downloads through next within the
+// limits.
+func (l *downloadLimits) transport(next http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return next
+	}
+	return &limitTransport{next: next, limits: l}
+}
+
+type limitTransport struct {
+	next   http.RoundTripper
+	limits *downloadLimits
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	release := func() {}
+	if t.limits.slots != nil {
+		select {
+		case t.limits.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+		release = sync.OnceFunc(func() { <-t.limits.slots })
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &limitBody{ReadCloser: res.Body, ctx: ctx, limiter: t.limits.limiter, release: release}
+	return res, nil
+}
+
+// limitBody reads within the bandwidth limit, and releases its download
+// slot once read or closed.
+type limitBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *rate.Limiter
+	release func()
+}
+
+func (b *limitBody) Read(p []byte) (int, error) {
+	if b.limiter != nil && len(p) > b.limiter.Burst() {
+		p = p[:b.limiter.Burst()]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if b.limiter != nil && n > 0 {
+		if werr := b.limiter.WaitN(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	if err == io.EOF {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *limitBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,85 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestMaxConcurrentDownloads(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer s.Close()
+
+	// Both APKs share the limit of the option.
+	limit := WithMaxConcurrentDownloads(2)
+	var eg errgroup.Group
+	for range 2 {
+		a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), limit)
+		require.NoError(t, err)
+		for range 4 {
+			eg.Go(func() error {
+				res, err := a.client.Get(s.URL)
+				if err != nil {
+					return err
+				}
+				return res.Body.Close()
+			})
+		}
+	}
+	require.NoError(t, eg.Wait())
+	require.Equal(t, int32(2), maxInFlight.Load())
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	const size = 64 << 10
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte{'a'}, size))
+	}))
+	defer s.Close()
+
+	// The first 32KiB are a burst, the rest takes a second.
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithBandwidthLimit(size/2))
+	require.NoError(t, err)
+	start := time.Now()
+	res, err := a.client.Get(s.URL)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Len(t, data, size)
+	require.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond)
+}
@@ -0,0 +1,120 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// newerLocalPackages reports whether the index u of a local repository is to
+// be synthesized from the packages next to it, because it is missing or
+// older than any of them, and returns when the newest of them changed.
+func newerLocalPackages(u string, opts *indexOpts) (time.Time, bool) {
+	if !opts.localIndexes {
+		return time.Time{}, false
+	}
+	if policy, ok := signaturePolicyFor(opts.signaturePolicies, u); ok && len(policy.KeyIDs) > 0 {
+		return time.Time{}, false
+	}
+	apks, err := filepath.Glob(filepath.Join(filepath.Dir(u), "*.apk"))
+	if err != nil || len(apks) == 0 {
+		return time.Time{}, false
+	}
+	var newest time.Time
+	for _, p := range apks {
+		if fi, err := os.Stat(p); err == nil && fi.ModTime().After(newest) {
+			newest = fi.ModTime()
+		}
+	}
+	fi, err := os.Stat(u)
+	if err != nil {
+		return newest, errors.Is(err, os.ErrNotExist)
+	}
+	return newest, newest.After(fi.ModTime())
+}
+
+// synthesizeIndex returns the index of the packages of arch in the local
+// repository directory dir.
+func synthesizeIndex(ctx context.Context, dir, arch string) (*APKIndex, error) {
+	log := clog.FromContext(ctx)
+	apks, err := filepath.Glob(filepath.Join(dir, "*.apk"))
+	if err != nil {
+		return nil, err
+	}
+	b := NewIndexBuilder()
+	b.Arch = arch
+	for _, p := range apks {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok, err := b.AddPackage(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("indexing %s: %w", p, err)
+		}
+		if !ok {
+			log.Warnf("skipping %s, which is for %s", p, pkg.Arch)
+		}
+	}
+	idx := b.Index()
+	idx.Verification = unverified(ReasonSynthesizedIndex)
+	log.Infof("synthesized the index of %s from %d packages", dir, len(idx.Packages))
+	return idx, nil
+}
+
+// IndexKeyNames returns the names of the keys the APKINDEX.tar.gz r is
+// signed with, as the keyring names them.
+func IndexKeyNames(r io.Reader) ([]string, error) {
+	// gzip leaves a byte reader at the end of each stream, for the next.
+	br := bufio.NewReader(r)
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var names []string
+	for {
+		zr.Multistream(false)
+		hdr, err := tar.NewReader(zr).Next()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(hdr.Name, ".SIGN.") {
+			return names, nil
+		}
+		if m := signatureFileRegex.FindStringSubmatch(hdr.Name); len(m) == 3 {
+			names = append(names, m[2])
+		}
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			return nil, err
+		}
+		if err := zr.Reset(br); err != nil {
+			return nil, err
+		}
+	}
+}
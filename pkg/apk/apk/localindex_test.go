@@ -0,0 +1,131 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalIndexSynthesis(t *testing.T) {
+	ctx := context.Background()
+	repo := t.TempDir()
+	dir := filepath.Join(repo, testArch)
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	apk := signedTestPackage(t, "", "")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello-1.0-r0.apk"), apk, 0o644))
+
+	names := func(opts ...IndexOption) []string {
+		t.Helper()
+		indexes, err := GetRepositoryIndexes(ctx, []string{repo}, nil, testArch, opts...)
+		require.NoError(t, err)
+		var names []string
+		for _, idx := range indexes {
+			for _, pkg := range idx.Packages() {
+				names = append(names, pkg.Name)
+			}
+		}
+		return names
+	}
+
+	// Without an index, the repository is skipped unless it is synthesized.
+	require.Empty(t, names())
+	require.Equal(t, []string{"hello"}, names(WithLocalIndexes(true)))
+
+	// An index newer than the packages is read instead.
+	b := NewIndexBuilder()
+	b.Add(&Package{Name: "indexed", Version: "1.0-r0"})
+	var buf bytes.Buffer
+	require.NoError(t, b.Write(&buf, "", ""))
+	index := filepath.Join(dir, "APKINDEX.tar.gz")
+	require.NoError(t, os.WriteFile(index, buf.Bytes(), 0o644))
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(index, future, future))
+	require.Equal(t, []string{"indexed"}, names(WithLocalIndexes(true), WithIgnoreSignatures(true)))
+
+	// And packages newer than the index are indexed.
+	later := future.Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "hello-1.0-r0.apk"), later, later))
+	require.Equal(t, []string{"hello"}, names(WithLocalIndexes(true)))
+	require.Equal(t, []string{"indexed"}, names(WithIgnoreSignatures(true)))
+
+	// Unless the keys of the repository are required.
+	_, synthesize := newerLocalPackages(index, &indexOpts{localIndexes: true})
+	require.True(t, synthesize)
+	_, synthesize = newerLocalPackages(index, &indexOpts{
+		localIndexes:      true,
+		signaturePolicies: map[string]SignaturePolicy{repo: {KeyIDs: []string{"test.rsa.pub"}}},
+	})
+	require.False(t, synthesize)
+}
+
+func TestIndexKeyNames(t *testing.T) {
+	var keyFiles []string
+	for _, name := range []string{"first.rsa", "second.rsa"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		keyFile, _ := writeIndexKey(t, name, key)
+		keyFiles = append(keyFiles, keyFile)
+	}
+
+	var unsigned bytes.Buffer
+	require.NoError(t, NewIndexBuilder().Write(&unsigned, "", ""))
+	names, err := IndexKeyNames(bytes.NewReader(unsigned.Bytes()))
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	var once, twice bytes.Buffer
+	require.NoError(t, SignIndex(&once, unsigned.Bytes(), keyFiles[0], ""))
+	require.NoError(t, SignIndex(&twice, once.Bytes(), keyFiles[1], ""))
+	names, err = IndexKeyNames(bytes.NewReader(twice.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, []string{"second.rsa.pub", "first.rsa.pub"}, names)
+}
+
+func TestRepositoryKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyFile, pub := writeIndexKey(t, "melange.rsa", key)
+	keys := map[string][]byte{"melange.rsa.pub": pub}
+
+	// Both repositories are signed with the key, which is only accepted for
+	// the first.
+	var repos []string
+	for range 2 {
+		repo := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(repo, testArch), 0o755))
+		b := NewIndexBuilder()
+		b.Add(&Package{Name: "hello", Version: "1.0-r0"})
+		f, err := os.Create(filepath.Join(repo, testArch, "APKINDEX.tar.gz"))
+		require.NoError(t, err)
+		require.NoError(t, b.Write(f, keyFile, ""))
+		require.NoError(t, f.Close())
+		repos = append(repos, repo)
+	}
+	opt := WithRepositoryKeyrings(map[string]map[string][]byte{repos[0]: keys})
+
+	_, err = GetRepositoryIndexes(t.Context(), repos[:1], nil, testArch, opt)
+	require.NoError(t, err)
+	_, err = GetRepositoryIndexes(t.Context(), repos[1:], nil, testArch, opt)
+	require.ErrorContains(t, err, "no keys provided")
+}
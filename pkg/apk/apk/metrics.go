@@ -0,0 +1,103 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"chainguard.dev/apko/internal/promutil"
+)
+
+// metrics are the Prometheus metrics of an APK, which are all labelled with
+// its architecture. A nil *metrics records nothing.
+type metrics struct {
+	packagesFetched      *prometheus.CounterVec
+	downloadedBytes      *prometheus.CounterVec
+	cacheHits            *prometheus.CounterVec
+	cacheMisses          *prometheus.CounterVec
+	verificationFailures *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	if reg == nil {
+		return nil, nil
+	}
+	counter := func(name, help string, labels ...string) (*prometheus.CounterVec, error) {
+		return promutil.Register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "apko",
+			Subsystem: "apk",
+			Name:      name,
+			Help:      help,
+		}, append([]string{"arch"}, labels...)))
+	}
+
+	var (
+		m   metrics
+		err error
+	)
+	if m.packagesFetched, err = counter("packages_fetched_total", "Packages fetched from their repository."); err != nil {
+		return nil, err
+	}
+	if m.downloadedBytes, err = counter("downloaded_bytes_total", "Bytes of the packages fetched from their repository."); err != nil {
+		return nil, err
+	}
+	if m.cacheHits, err = counter("cache_hits_total", "Packages expanded from the cache."); err != nil {
+		return nil, err
+	}
+	if m.cacheMisses, err = counter("cache_misses_total", "Packages which were not in the cache."); err != nil {
+		return nil, err
+	}
+	if m.verificationFailures, err = counter("verification_failures_total", "Indexes and packages which failed verification, by reason: signature or checksum.", "reason"); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (m *metrics) fetched(arch string, size int64) {
+	if m == nil {
+		return
+	}
+	m.packagesFetched.WithLabelValues(arch).Inc()
+	m.downloadedBytes.WithLabelValues(arch).Add(float64(size))
+}
+
+func (m *metrics) cacheHit(arch string) {
+	if m == nil {
+		return
+	}
+	m.cacheHits.WithLabelValues(arch).Inc()
+}
+
+func (m *metrics) cacheMiss(arch string) {
+	if m == nil {
+		return
+	}
+	m.cacheMisses.WithLabelValues(arch).Inc()
+}
+
+// verificationFailed counts err if it is a signature or checksum failure.
+func (m *metrics) verificationFailed(arch string, err error) {
+	if m == nil {
+		return
+	}
+	switch {
+	case errors.Is(err, ErrSignatureInvalid):
+		m.verificationFailures.WithLabelValues(arch, "signature").Inc()
+	case errors.Is(err, ErrChecksumMismatch):
+		m.verificationFailures.WithLabelValues(arch, "checksum").Inc()
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithArch(testArch), WithMetricsRegistry(reg))
+	require.NoError(t, err)
+	a.SetClient(&http.Client{Transport: &testLocalTransport{root: testPrimaryPkgDir, basenameOnly: true}})
+
+	// The metrics of another APK go to the same collectors.
+	_, err = New(t.Context(), WithFS(apkfs.NewMemFS()), WithArch(testArch), WithMetricsRegistry(reg))
+	require.NoError(t, err)
+
+	repo := Repository{URI: fmt.Sprintf("%s/%s", testAlpineRepos, testArch)}
+	pkg := NewRepositoryPackage(&testPkg, repo.WithIndex(&APKIndex{Packages: []*Package{&testPkg}}))
+	exp, err := a.expandPackage(t.Context(), pkg)
+	require.NoError(t, err)
+	exp.Close()
+
+	dir := t.TempDir()
+	tampered := &Package{Name: "tampered", Version: "1.0-r0"}
+	writeTamperedAPK(t, dir, tampered)
+	a.SetClient(&http.Client{Transport: &testLocalTransport{root: dir, basenameOnly: true}})
+	pkg = NewRepositoryPackage(tampered, repo.WithIndex(&APKIndex{Packages: []*Package{tampered}}))
+	_, err = a.expandPackage(t.Context(), pkg)
+	require.ErrorIs(t, err, ErrChecksumMismatch)
+
+	m := a.metrics
+	require.InDelta(t, 1, testutil.ToFloat64(m.packagesFetched.WithLabelValues(testArch)), 0)
+	require.InDelta(t, float64(exp.Size), testutil.ToFloat64(m.downloadedBytes.WithLabelValues(testArch)), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.verificationFailures.WithLabelValues(testArch, "checksum")), 0)
+	require.InDelta(t, 0, testutil.ToFloat64(m.verificationFailures.WithLabelValues(testArch, "signature")), 0)
+}
@@ -15,12 +15,20 @@
 package apk
 
 import (
+	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/hashicorp/go-cleanhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
 
 	"chainguard.dev/apko/pkg/apk/auth"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
@@ -37,11 +45,37 @@ type opts struct {
 	auth               auth.Authenticator
 	ignoreSignatures   bool
 	transport          http.RoundTripper
+	keyringPolicy      KeyringPolicy
+	indexVerifications map[string]IndexVerification
+	signaturePolicies  map[string]SignaturePolicy
+
+	unsignedRepositories map[string]string
+	repositoryKeys       map[string]map[string][]byte
+
+	verifyPackageSignatures bool
+	localIndexes            bool
+
+	remoteOptions        []remote.Option
+	keyringVerifications map[string]ArtifactVerifier
+
+	progress        Reporter
+	metricsRegistry prometheus.Registerer
+
+	fetchTimeout        time.Duration
+	resolveTimeout      time.Duration
+	retryPolicy         *RetryPolicy
+	downloads           *downloadLimits
+	auditor             NetworkAuditor
+	fileFilter          FileFilter
+	permissionsPolicy   *PermissionsPolicy
+	normalizations      NormalizationRecorder
+	baseDirectoryPolicy BaseDirectoryPolicy
 }
 
 type Option func(*opts) error
 
-// WithExecutor executor to use. Not currently used.
+// WithExecutor sets the executor which runs commands in the root filesystem.
+// It is not used to run install scripts or triggers, which apk does not run.
 func WithExecutor(executor Executor) Option {
 	return func(o *opts) error {
 		o.executor = executor
@@ -144,11 +178,264 @@ func WithTransport(t http.RoundTripper) Option {
 	}
 }
 
+// WithKeyringPolicy sets the policy restricting the keys installed into the
+// keyring. By default all keys are installed.
+func WithKeyringPolicy(p KeyringPolicy) Option {
+	return func(o *opts) error {
+		o.keyringPolicy = p
+		return nil
+	}
+}
+
+// WithIndexVerification verifies the indexes of repository with v, in
+// addition to or instead of their key signatures.
+func WithIndexVerification(repository string, v IndexVerification) Option {
+	return func(o *opts) error {
+		if o.indexVerifications == nil {
+			o.indexVerifications = map[string]IndexVerification{}
+		}
+		o.indexVerifications[strings.TrimRight(repository, "/")] = v
+		return nil
+	}
+}
+
+// WithSignaturePolicy sets how the signatures of the index and packages of
+// repository are verified.
+func WithSignaturePolicy(repository string, p SignaturePolicy) Option {
+	return func(o *opts) error {
+		if o.signaturePolicies == nil {
+			o.signaturePolicies = map[string]SignaturePolicy{}
+		}
+		o.signaturePolicies[strings.TrimRight(repository, "/")] = p
+		return nil
+	}
+}
+
+// WithUnsignedRepository skips verifying the signatures of the index and
+// packages of repository, for reason, which is recorded with how they were
+// verified. Unlike WithIgnoreSignatures, it only affects that repository.
+func WithUnsignedRepository(repository, reason string) Option {
+	return func(o *opts) error {
+		if strings.TrimSpace(reason) == "" {
+			return fmt.Errorf("ignoring the signatures of %s needs a reason", repository)
+		}
+		if o.unsignedRepositories == nil {
+			o.unsignedRepositories = map[string]string{}
+		}
+		o.unsignedRepositories[strings.TrimRight(repository, "/")] = reason
+		return nil
+	}
+}
+
+// WithRepositoryKeys accepts keys, by their name, for the signatures of the
+// index and packages of repository only, rather than adding them to the
+// keyring, which all repositories are verified with.
+func WithRepositoryKeys(repository string, keys map[string][]byte) Option {
+	return func(o *opts) error {
+		if o.repositoryKeys == nil {
+			o.repositoryKeys = map[string]map[string][]byte{}
+		}
+		o.repositoryKeys[strings.TrimRight(repository, "/")] = keys
+		return nil
+	}
+}
+
+// WithVerifyPackageSignatures verifies the signature of every installed
+// package against the keyring, like apk --verify, instead of relying on the
+// checksums of the signed indexes alone.
+func WithVerifyPackageSignatures(verify bool) Option {
+	return func(o *opts) error {
+		o.verifyPackageSignatures = verify
+		return nil
+	}
+}
+
+// WithLocalIndexSynthesis synthesizes the index of a local repository from
+// its packages when it has none, or one older than any of them, as melange
+// leaves the directory of the packages it built. A synthesized index is not
+// signed, and is trusted as the files it is built from are, unless a
+// signature policy names the keys of the repository.
+func WithLocalIndexSynthesis(synthesize bool) Option {
+	return func(o *opts) error {
+		o.localIndexes = synthesize
+		return nil
+	}
+}
+
+// WithProgressReporter sets the Reporter that receives the progress of
+// downloading, expanding and installing packages.
+func WithProgressReporter(r Reporter) Option {
+	return func(o *opts) error {
+		o.progress = r
+		return nil
+	}
+}
+
+// WithFetchTimeout bounds the time spent fetching each of the keys of a
+// repository, the keyring, the repository indexes and each package, so that
+// a hung mirror fails in bounded time with a PhaseTimeoutError. Zero, the
+// default, means no timeout.
+func WithFetchTimeout(timeout time.Duration) Option {
+	return func(o *opts) error {
+		o.fetchTimeout = timeout
+		return nil
+	}
+}
+
+// WithResolveTimeout bounds the time spent resolving the world, including
+// fetching the indexes it is resolved from. Zero, the default, means no
+// timeout.
+func WithResolveTimeout(timeout time.Duration) Option {
+	return func(o *opts) error {
+		o.resolveTimeout = timeout
+		return nil
+	}
+}
+
+// WithRetryPolicy sets how failed requests to repositories, and to the
+// registries of OCI keyrings, are retried. The default is
+// DefaultRetryPolicy.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *opts) error {
+		o.retryPolicy = &p
+		return nil
+	}
+}
+
+// WithMaxConcurrentDownloads bounds the number of packages, indexes and keys
+// which are downloaded at the same time. The APKs created with the same
+// Option share the bound. Zero means no bound.
+func WithMaxConcurrentDownloads(n int) Option {
+	var slots chan struct{}
+	if n > 0 {
+		slots = make(chan struct{}, n)
+	}
+	return func(o *opts) error {
+		if o.downloads == nil {
+			o.downloads = &downloadLimits{}
+		}
+		o.downloads.slots = slots
+		return nil
+	}
+}
+
+// WithBandwidthLimit bounds the total bandwidth of the downloads of packages,
+// indexes and keys, in bytes per second. The APKs created with the same
+// Option share the bandwidth. Zero means no limit.
+func WithBandwidthLimit(bytesPerSec int64) Option {
+	var limiter *rate.Limiter
+	if bytesPerSec > 0 {
+		// Allow bursts of up to 64KiB to read in reasonable chunks, unless
+		// that is more than a second worth.
+		limiter = rate.NewLimiter(rate.Limit(bytesPerSec), int(min(bytesPerSec, 64<<10)))
+	}
+	return func(o *opts) error {
+		if o.downloads == nil {
+			o.downloads = &downloadLimits{}
+		}
+		o.downloads.limiter = limiter
+		return nil
+	}
+}
+
+// WithNetworkAuditor records every request made to the repositories, with
+// the status, size and digest of its response, with auditor.
+func WithNetworkAuditor(auditor NetworkAuditor) Option {
+	return func(o *opts) error {
+		o.auditor = auditor
+		return nil
+	}
+}
+
+// WithMetricsRegistry registers the Prometheus metrics of the APK, such as
+// the packages and bytes fetched, cache hits and verification failures, with
+// reg. The APKs of a process may share the same registry.
+func WithMetricsRegistry(reg prometheus.Registerer) Option {
+	return func(o *opts) error {
+		o.metricsRegistry = reg
+		return nil
+	}
+}
+
+// WithRemoteOptions sets the options for fetching OCI keyring artifacts from
+// their registries. By default the credentials of the default keychain are
+// used.
+func WithRemoteOptions(options ...remote.Option) Option {
+	return func(o *opts) error {
+		o.remoteOptions = options
+		return nil
+	}
+}
+
+// WithKeyringVerification verifies the OCI keyring artifacts of repository
+// with v before installing their keys.
+func WithKeyringVerification(repository string, v ArtifactVerifier) Option {
+	return func(o *opts) error {
+		repo, err := keyringRepository(repository)
+		if err != nil {
+			return fmt.Errorf("parsing keyring repository %s: %w", repository, err)
+		}
+		if o.keyringVerifications == nil {
+			o.keyringVerifications = map[string]ArtifactVerifier{}
+		}
+		o.keyringVerifications[repo] = v
+		return nil
+	}
+}
+
+// FileFilter returns which files of a package about to be installed are
+// installed, given the files of the package. A nil keep installs them all.
+type FileFilter func(pkg *Package, files fs.FS) (keep func(path string) bool, err error)
+
+// WithFileFilter sets the filter of the files installed from packages.
+// Directories are always installed, and files left out are not recorded
+// in the installed database.
+func WithFileFilter(f FileFilter) Option {
+	return func(o *opts) error {
+		o.fileFilter = f
+		return nil
+	}
+}
+
+// WithPermissionsPolicy normalizes the ownership and permissions of the
+// files installed from packages with p, which may be nil to keep them as
+// they are in the packages.
+func WithPermissionsPolicy(p *PermissionsPolicy) Option {
+	return func(o *opts) error {
+		o.permissionsPolicy = p
+		return nil
+	}
+}
+
+// WithNormalizationRecorder records the changes the permissions policy makes
+// to the files installed from packages with r.
+func WithNormalizationRecorder(r NormalizationRecorder) Option {
+	return func(o *opts) error {
+		o.normalizations = r
+		return nil
+	}
+}
+
+// WithBaseDirectoryPolicy sets what InitDB does with the base directories
+// which already exist with other permissions. The default is
+// BaseDirectoriesStrict.
+func WithBaseDirectoryPolicy(p BaseDirectoryPolicy) Option {
+	return func(o *opts) error {
+		p, err := ParseBaseDirectoryPolicy(string(p))
+		if err != nil {
+			return err
+		}
+		o.baseDirectoryPolicy = p
+		return nil
+	}
+}
+
 func defaultOpts() *opts {
 	return &opts{
 		arch:              ArchToAPK(runtime.GOARCH),
 		ignoreMknodErrors: false,
 		auth:              auth.DefaultAuthenticators,
 		transport:         cleanhttp.DefaultPooledTransport(),
+		remoteOptions:     []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain)},
 	}
 }
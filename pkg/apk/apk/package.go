@@ -19,7 +19,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/sha1" //nolint:gosec // this is what apk tools is using
+	"crypto"
 	"encoding/base64"
 	"fmt"
 	"hash"
@@ -29,10 +29,13 @@ import (
 
 	"gopkg.in/ini.v1"
 
+	"chainguard.dev/apko/pkg/apk/digest"
 	"chainguard.dev/apko/pkg/apk/expandapk"
 )
 
 // PackageToInstalled takes a Package and returns it as the string representation of lines in a /usr/lib/apk/db/installed file.
+//
+// Optional fields are omitted when they are empty, as apk itself does.
 func PackageToInstalled(pkg *Package) (out []string) {
 	out = append(out, fmt.Sprintf("P:%s", pkg.Name))
 	out = append(out, fmt.Sprintf("V:%s", pkg.Version))
@@ -42,13 +45,19 @@ func PackageToInstalled(pkg *Package) (out []string) {
 	out = append(out, fmt.Sprintf("o:%s", pkg.Origin))
 	out = append(out, fmt.Sprintf("m:%s", pkg.Maintainer))
 	out = append(out, fmt.Sprintf("U:%s", pkg.URL))
-	out = append(out, fmt.Sprintf("D:%s", strings.Join(pkg.Dependencies, " ")))
-	out = append(out, fmt.Sprintf("p:%s", strings.Join(pkg.Provides, " ")))
+	if len(pkg.Dependencies) != 0 {
+		out = append(out, fmt.Sprintf("D:%s", strings.Join(pkg.Dependencies, " ")))
+	}
+	if len(pkg.Provides) != 0 {
+		out = append(out, fmt.Sprintf("p:%s", strings.Join(pkg.Provides, " ")))
+	}
 	if len(pkg.Replaces) != 0 {
 		out = append(out, fmt.Sprintf("r:%s", strings.Join(pkg.Replaces, " ")))
 	}
 	out = append(out, fmt.Sprintf("c:%s", pkg.RepoCommit))
-	out = append(out, fmt.Sprintf("i:%s", pkg.InstallIf))
+	if len(pkg.InstallIf) != 0 {
+		out = append(out, fmt.Sprintf("i:%s", strings.Join(pkg.InstallIf, " ")))
+	}
 	out = append(out, fmt.Sprintf("t:%d", pkg.BuildTime.Unix()))
 	out = append(out, fmt.Sprintf("S:%d", pkg.Size))
 	out = append(out, fmt.Sprintf("I:%d", pkg.InstalledSize))
@@ -169,7 +178,12 @@ func ParsePackage(ctx context.Context, apkPackage io.Reader, size uint64) (*Pack
 	if err != nil {
 		return nil, err
 	}
+	return packageFromInfo(pkginfo, h.Sum(nil), size), nil
+}
 
+// packageFromInfo returns the package of an apk of size bytes, with the
+// .PKGINFO pkginfo and the control section checksum.
+func packageFromInfo(pkginfo *PackageInfo, checksum []byte, size uint64) *Package {
 	return &Package{
 		Name:             pkginfo.Name,
 		Version:          pkginfo.Version,
@@ -179,7 +193,7 @@ func ParsePackage(ctx context.Context, apkPackage io.Reader, size uint64) (*Pack
 		Origin:           pkginfo.Origin,
 		Maintainer:       pkginfo.Maintainer,
 		URL:              pkginfo.URL,
-		Checksum:         h.Sum(nil),
+		Checksum:         checksum,
 		Dependencies:     pkginfo.Dependencies,
 		Provides:         pkginfo.Provides,
 		InstallIf:        pkginfo.InstallIf,
@@ -191,7 +205,7 @@ func ParsePackage(ctx context.Context, apkPackage io.Reader, size uint64) (*Pack
 		RepoCommit:       pkginfo.RepoCommit,
 		Replaces:         pkginfo.Replaces,
 		DataHash:         pkginfo.DataHash,
-	}, nil
+	}
 }
 
 // ParsePackageInfo returns a parsed .PKGINFO from an APK reader and the control section hash.
@@ -211,7 +225,11 @@ func ParsePackageInfo(apkPackage io.Reader) (*PackageInfo, hash.Hash, error) {
 		return nil, nil, err
 	}
 
-	h := sha1.New() //nolint:gosec
+	// The apk format mandates SHA-1 for the checksum of the control section.
+	h, err := digest.Identify(crypto.SHA1)
+	if err != nil {
+		return nil, nil, err
+	}
 	if _, err = h.Write(b); err != nil {
 		return nil, nil, err
 	}
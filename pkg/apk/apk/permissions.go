@@ -0,0 +1,117 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"path"
+	"strings"
+)
+
+// PermissionsPolicy normalizes the ownership and permissions of the files
+// installed from packages, for platforms which refuse images with files not
+// owned by root, or with setuid binaries.
+type PermissionsPolicy struct {
+	// RootOwned makes root, uid and gid 0, own every file.
+	RootOwned bool `json:"rootOwned,omitempty"`
+	// StripSetID clears the setuid and setgid bits of every file but those
+	// matching KeepSetID.
+	StripSetID bool `json:"stripSetID,omitempty"`
+	// KeepSetID are the absolute paths, or path.Match patterns, of the
+	// files which keep their setuid and setgid bits.
+	KeepSetID []string `json:"keepSetID,omitempty"`
+}
+
+// Normalization is a change a PermissionsPolicy made to a file installed
+// from a package.
+type Normalization struct {
+	Package string `json:"package"`
+	Arch    string `json:"arch,omitempty"`
+	Path    string `json:"path"`
+	// UID and GID are the owner of the file in the package, when it was
+	// changed to root.
+	UID int `json:"uid,omitempty"`
+	GID int `json:"gid,omitempty"`
+	// Setuid and Setgid are set when the bit was stripped.
+	Setuid bool `json:"setuid,omitempty"`
+	Setgid bool `json:"setgid,omitempty"`
+}
+
+// NormalizationRecorder records the changes the PermissionsPolicy of an APK
+// makes to the files it installs. It may be called concurrently.
+type NormalizationRecorder interface {
+	RecordNormalization(Normalization)
+}
+
+// NormalizationRecorderFunc is a NormalizationRecorder which calls the
+// function.
+type NormalizationRecorderFunc func(Normalization)
+
+func (f NormalizationRecorderFunc) RecordNormalization(n Normalization) {
+	f(n)
+}
+
+// keepsSetID reports whether the file at name, relative to the root, keeps
+// its setuid and setgid bits.
+func (p *PermissionsPolicy) keepsSetID(name string) bool {
+	name = "/" + strings.TrimPrefix(name, "/")
+	for _, pattern := range p.KeepSetID {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize applies the policy to header, and returns the changes it made,
+// if any.
+func (p *PermissionsPolicy) normalize(header *tar.Header) (Normalization, bool) {
+	if p == nil {
+		return Normalization{}, false
+	}
+	var (
+		n       = Normalization{Path: "/" + strings.TrimPrefix(header.Name, "/")}
+		changed bool
+	)
+	if p.RootOwned && (header.Uid != 0 || header.Gid != 0) {
+		n.UID, n.GID = header.Uid, header.Gid
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "root", "root"
+		changed = true
+	}
+	if p.StripSetID && header.Mode&(tarSetuid|tarSetgid) != 0 && !p.keepsSetID(header.Name) {
+		n.Setuid, n.Setgid = header.Mode&tarSetuid != 0, header.Mode&tarSetgid != 0
+		header.Mode &^= tarSetuid | tarSetgid
+		changed = true
+	}
+	return n, changed
+}
+
+// normalize applies the permissions policy of the APK to header, a file of
+// pkg, recording the changes it made with its NormalizationRecorder.
+func (a *APK) normalize(pkg *Package, header *tar.Header) {
+	n, changed := a.permissionsPolicy.normalize(header)
+	if !changed || a.normalizations == nil {
+		return
+	}
+	n.Package, n.Arch = pkg.Name, a.arch
+	a.normalizations.RecordNormalization(n)
+}
+
+// The setuid and setgid bits of tar.Header.Mode.
+const (
+	tarSetuid = 0o4000
+	tarSetgid = 0o2000
+)
@@ -0,0 +1,79 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermissionsPolicy(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0o755, Uid: 1000, Gid: 1000},
+		{Name: "usr/bin/su", Typeflag: tar.TypeReg, Mode: 0o4755},
+		{Name: "usr/bin/ping", Typeflag: tar.TypeReg, Mode: 0o4755},
+		{Name: "usr/bin/wall", Typeflag: tar.TypeReg, Mode: 0o2755, Gid: 5},
+		{Name: "usr/bin/app", Typeflag: tar.TypeReg, Mode: 0o755, Uid: 65532, Gid: 65532},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+	}
+	require.NoError(t, tw.Close())
+
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err)
+	a.permissionsPolicy = &PermissionsPolicy{RootOwned: true, StripSetID: true, KeepSetID: []string{"/usr/bin/s*"}}
+
+	var normalized []Normalization
+	a.normalizations = NormalizationRecorderFunc(func(n Normalization) {
+		normalized = append(normalized, n)
+	})
+	headers, err := a.installAPKFiles(context.Background(), &buf, &Package{Name: "test"}, nil)
+	require.NoError(t, err)
+
+	type file struct {
+		uid, gid int
+		mode     int64
+	}
+	got := map[string]file{}
+	for _, h := range headers {
+		got[h.Name] = file{h.Uid, h.Gid, h.Mode}
+	}
+	require.Equal(t, map[string]file{
+		"usr/":         {mode: 0o755},
+		"usr/bin/":     {mode: 0o755},
+		"usr/bin/su":   {mode: 0o4755},
+		"usr/bin/ping": {mode: 0o755},
+		"usr/bin/wall": {mode: 0o755},
+		"usr/bin/app":  {mode: 0o755},
+	}, got)
+
+	fi, err := a.fs.Stat("usr/bin/ping")
+	require.NoError(t, err)
+	require.Zero(t, fi.Mode()&(0o4000|0o2000))
+
+	require.Equal(t, []Normalization{
+		{Package: "test", Arch: a.arch, Path: "/usr/bin/", UID: 1000, GID: 1000},
+		{Package: "test", Arch: a.arch, Path: "/usr/bin/ping", Setuid: true},
+		{Package: "test", Arch: a.arch, Path: "/usr/bin/wall", GID: 5, Setgid: true},
+		{Package: "test", Arch: a.arch, Path: "/usr/bin/app", UID: 65532, GID: 65532},
+	}, normalized)
+}
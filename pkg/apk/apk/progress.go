@@ -0,0 +1,113 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"io"
+)
+
+// ProgressPhase is a phase of installing packages.
+type ProgressPhase string
+
+const (
+	// PhaseDownload reports the bytes of a package downloaded so far.
+	PhaseDownload ProgressPhase = "download"
+	// PhaseExpand reports that a package was expanded, after downloading it
+	// or from the cache.
+	PhaseExpand ProgressPhase = "expand"
+	// PhaseInstall reports that the files of a package were installed.
+	PhaseInstall ProgressPhase = "install"
+)
+
+// progressInterval is how many downloaded bytes are reported at once.
+const progressInterval = 1 << 20
+
+// ProgressEvent is the progress of installing a package.
+type ProgressEvent struct {
+	Phase   ProgressPhase `json:"phase"`
+	Arch    string        `json:"arch"`
+	Package string        `json:"package"`
+
+	// Bytes is how many bytes of the package were downloaded so far, and
+	// TotalBytes is its size, or 0 if unknown. Only set for PhaseDownload.
+	Bytes      int64 `json:"bytes,omitempty"`
+	TotalBytes int64 `json:"total_bytes,omitempty"`
+
+	// Cached is whether the package was expanded from the cache rather than
+	// downloaded. Only set for PhaseExpand.
+	Cached bool `json:"cached,omitempty"`
+
+	// Done is how many packages completed the phase, including this one, of
+	// the Total packages being installed. Not set for PhaseDownload.
+	Done  int `json:"done,omitempty"`
+	Total int `json:"total,omitempty"`
+}
+
+// Reporter receives the progress of installing packages. Packages are
+// fetched and expanded concurrently, so Report must be safe to call from
+// multiple goroutines.
+type Reporter interface {
+	Report(ProgressEvent)
+}
+
+// ReporterFunc is a Reporter which calls the function.
+type ReporterFunc func(ProgressEvent)
+
+func (f ReporterFunc) Report(ev ProgressEvent) {
+	f(ev)
+}
+
+// report sends the event to the Reporter of the APK, if any.
+func (a *APK) report(ev ProgressEvent) {
+	if a.progress == nil {
+		return
+	}
+	ev.Arch = a.arch
+	a.progress.Report(ev)
+}
+
+// reportDownload returns rc, reporting the bytes read from it as the
+// download of pkg.
+func (a *APK) reportDownload(pkg InstallablePackage, rc io.ReadCloser) io.ReadCloser {
+	if a.progress == nil {
+		return rc
+	}
+	var total int64
+	if p, ok := pkg.(*RepositoryPackage); ok {
+		total = int64(p.Size) //nolint:gosec
+	}
+	return &progressReader{ReadCloser: rc, a: a, pkg: pkg.PackageName(), total: total}
+}
+
+// progressReader reports the bytes read through it every progressInterval
+// bytes, and when the end is reached.
+type progressReader struct {
+	io.ReadCloser
+	a     *APK
+	pkg   string
+	total int64
+
+	read, reported int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	if r.read-r.reported >= progressInterval || (err == io.EOF && r.read != r.reported) { //nolint:errorlint
+		r.reported = r.read
+		r.a.report(ProgressEvent{Phase: PhaseDownload, Package: r.pkg, Bytes: r.read, TotalBytes: r.total})
+	}
+	return n, err
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReporter(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err)
+
+	var (
+		mu     sync.Mutex
+		events []ProgressEvent
+	)
+	a.progress = ReporterFunc(func(ev ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, ev)
+	})
+
+	first := fakePackage(t, &Package{Name: "first", Origin: "first"}, []testDirEntry{
+		{"etc", 0o755, true, nil, nil},
+		{"etc/first", 0o644, false, []byte("first"), nil},
+	})
+	second := fakePackage(t, &Package{Name: "second", Origin: "second"}, []testDirEntry{
+		{"etc", 0o755, true, nil, nil},
+		{"etc/second", 0o644, false, []byte("second"), nil},
+	})
+	_, err = a.InstallPackages(t.Context(), nil, []InstallablePackage{first, second})
+	require.NoError(t, err)
+
+	downloaded := map[string]int64{}
+	var expanded, installed []string
+	for _, ev := range events {
+		require.Equal(t, a.arch, ev.Arch)
+		switch ev.Phase {
+		case PhaseDownload:
+			downloaded[ev.Package] = ev.Bytes
+		case PhaseExpand:
+			expanded = append(expanded, ev.Package)
+			require.Equal(t, 2, ev.Total)
+			require.Equal(t, len(expanded), ev.Done)
+		case PhaseInstall:
+			installed = append(installed, ev.Package)
+			require.Equal(t, 2, ev.Total)
+			require.Equal(t, len(installed), ev.Done)
+		}
+	}
+	require.Positive(t, downloaded["first"])
+	require.Positive(t, downloaded["second"])
+	require.ElementsMatch(t, []string{"first", "second"}, expanded)
+	require.Equal(t, []string{"first", "second"}, installed)
+}
@@ -66,9 +66,13 @@ func (c DateTime) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + c.Format("2006-01-02") + `"`), nil
 }
 
-// GetReleaseBranch returns the release branch for the given version. If not found,
-// nil is returned.
+// GetReleaseBranch returns the release branch for the given version, with
+// latest-stable standing for the latest stable release. If not found, nil is
+// returned.
 func (r Releases) GetReleaseBranch(version string) *ReleaseBranch {
+	if version == "latest-stable" {
+		version = r.LatestStable
+	}
 	for _, branch := range r.ReleaseBranches {
 		if branch.ReleaseBranch == version {
 			return &branch
@@ -95,3 +99,16 @@ func (r ReleaseBranch) KeysFor(arch string, date time.Time) []string {
 	}
 	return urls
 }
+
+// KeyDeprecations returns the dates from which the keys for the given
+// architecture are deprecated, by their URL as returned by KeysFor. Keys
+// which are never deprecated are omitted.
+func (r ReleaseBranch) KeyDeprecations(arch string) map[string]time.Time {
+	deprecations := map[string]time.Time{}
+	for _, key := range r.Keys[arch] {
+		if !key.Deprecated.IsZero() {
+			deprecations[strings.ReplaceAll(key.URL, "%20", "@")] = key.Deprecated.Time
+		}
+	}
+	return deprecations
+}
@@ -0,0 +1,48 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetReleaseBranch(t *testing.T) {
+	var releases Releases
+	require.NoError(t, json.Unmarshal([]byte(`{
+  "latest_stable": "v3.22",
+  "release_branches": [
+    {"rel_branch": "edge", "keys": {"x86_64": [{"url": "https://alpinelinux.org/keys/edge.rsa.pub"}]}},
+    {"rel_branch": "v3.22", "keys": {"x86_64": [{"url": "https://alpinelinux.org/keys/v3.22.rsa.pub"}]}},
+    {"rel_branch": "v3.21", "keys": {"x86_64": [{"url": "https://alpinelinux.org/keys/v3.21.rsa.pub"}]}}
+  ]
+}`), &releases))
+
+	for version, want := range map[string]string{
+		"v3.21": "v3.21",
+		"edge":  "edge",
+		// The default version of the alpine flavor.
+		"latest-stable": "v3.22",
+	} {
+		branch := releases.GetReleaseBranch(version)
+		require.NotNil(t, branch, version)
+		require.Equal(t, want, branch.ReleaseBranch)
+		require.Equal(t, []string{"https://alpinelinux.org/keys/" + want + ".rsa.pub"}, branch.KeysFor("x86_64", time.Now()))
+	}
+	require.Nil(t, releases.GetReleaseBranch("v2.0"))
+}
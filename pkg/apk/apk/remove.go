@@ -0,0 +1,182 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type removeOpts struct {
+	orphans bool
+}
+
+// RemoveOption is an option of RemovePackages.
+type RemoveOption func(*removeOpts)
+
+// WithRemoveOrphans also removes the packages which were only installed as
+// dependencies of the removed ones: those which are not in the world, and
+// which no package left installed depends on. RemovePackages fails with it if
+// the root has no world, which would make every package an orphan.
+func WithRemoveOrphans(remove bool) RemoveOption {
+	return func(o *removeOpts) {
+		o.orphans = remove
+	}
+}
+
+// RemovePackages removes the installed packages named names from the root,
+// as apk del does: their files are deleted, but for those another installed
+// package has, with the directories left empty, their entries, scripts and
+// triggers are dropped from the database, and they are dropped from the
+// world. It fails if a package left installed depends on one of them. It
+// returns the packages removed, in the order they were installed.
+func (a *APK) RemovePackages(ctx context.Context, names []string, opts ...RemoveOption) ([]*InstalledPackage, error) {
+	o := &removeOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "RemovePackages", trace.WithAttributes(attribute.StringSlice("packages", names)))
+	defer span.End()
+
+	installed, err := a.GetInstalled()
+	if err != nil {
+		return nil, err
+	}
+	remove := map[string]bool{}
+	for _, name := range names {
+		if !slices.ContainsFunc(installed, func(ip *InstalledPackage) bool { return ip.Name == name }) {
+			return nil, fmt.Errorf("package %s is not installed", name)
+		}
+		remove[name] = true
+	}
+
+	world, err := a.GetWorld()
+	if errors.Is(err, fs.ErrNotExist) && o.orphans {
+		return nil, fmt.Errorf("cannot tell the orphans to remove without a world: %w", err)
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	world = slices.DeleteFunc(world, func(w string) bool {
+		return remove[ResolvePackageNameVersionPin(w).Name]
+	})
+
+	if o.orphans {
+		inWorld := map[string]bool{}
+		for _, w := range world {
+			inWorld[ResolvePackageNameVersionPin(w).Name] = true
+		}
+		// Removing an orphan may leave its own dependencies orphaned.
+		for changed := true; changed; {
+			changed = false
+			needed := neededNames(installed, remove)
+			for _, ip := range installed {
+				if remove[ip.Name] || inWorld[ip.Name] || slices.ContainsFunc(providedNames(&ip.Package), func(n string) bool { return needed[n] }) {
+					continue
+				}
+				remove[ip.Name] = true
+				changed = true
+			}
+		}
+	}
+
+	providers := map[string]bool{}
+	for _, ip := range installed {
+		if !remove[ip.Name] {
+			for _, n := range providedNames(&ip.Package) {
+				providers[n] = true
+			}
+		}
+	}
+	var kept, removed []*InstalledPackage
+	for _, ip := range installed {
+		if remove[ip.Name] {
+			removed = append(removed, ip)
+			continue
+		}
+		kept = append(kept, ip)
+		for _, dep := range dependencyNames(&ip.Package) {
+			if providers[dep] {
+				continue
+			}
+			for _, r := range installed {
+				if remove[r.Name] && slices.Contains(providedNames(&r.Package), dep) {
+					return nil, fmt.Errorf("cannot remove %s, which %s depends on", r.Name, ip.Name)
+				}
+			}
+		}
+	}
+
+	log := clog.FromContext(ctx)
+	for _, ip := range removed {
+		log.Infof("removing %s-%s", ip.Name, ip.Version)
+	}
+	if err := a.uninstall(ctx, kept, removed); err != nil {
+		return nil, err
+	}
+	if _, err := a.fs.Stat(worldFilePath); err == nil {
+		if err := a.SetWorld(ctx, world); err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// providedNames returns the names pkg can be depended on by: its own and
+// those it provides.
+func providedNames(pkg *Package) []string {
+	names := []string{pkg.Name}
+	for _, p := range pkg.Provides {
+		names = append(names, ResolvePackageNameVersionPin(p).Name)
+	}
+	return names
+}
+
+// dependencyNames returns the names of the dependencies of pkg, without
+// its conflicts.
+func dependencyNames(pkg *Package) []string {
+	var names []string
+	for _, dep := range pkg.Dependencies {
+		if dep == "" || strings.HasPrefix(dep, "!") {
+			continue
+		}
+		names = append(names, ResolvePackageNameVersionPin(dep).Name)
+	}
+	return names
+}
+
+// neededNames returns the names the installed packages which are not being
+// removed depend on.
+func neededNames(installed []*InstalledPackage, remove map[string]bool) map[string]bool {
+	needed := map[string]bool{}
+	for _, ip := range installed {
+		if remove[ip.Name] {
+			continue
+		}
+		for _, dep := range dependencyNames(&ip.Package) {
+			needed[dep] = true
+		}
+	}
+	return needed
+}
@@ -0,0 +1,123 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestRemovePackages(t *testing.T) {
+	setup := func(t *testing.T) (*APK, apkfs.FullFS) {
+		src := apkfs.NewMemFS()
+		a, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors))
+		require.NoError(t, err)
+		require.NoError(t, a.InitDB(t.Context()))
+		require.NoError(t, a.SetWorld(t.Context(), []string{"app", "tool>=1.0"}))
+
+		lib := fakePackage(t, &Package{Name: "libfoo", Version: "1.0-r0", Origin: "foo", Provides: []string{"so:libfoo.so.1=1"}}, []testDirEntry{
+			{"usr", 0o755, true, nil, nil},
+			{"usr/lib", 0o755, true, nil, nil},
+			{"usr/lib/libfoo.so.1", 0o755, false, []byte("libfoo"), nil},
+		})
+		app := fakePackage(t, &Package{Name: "app", Version: "1.0-r0", Origin: "app", Dependencies: []string{"so:libfoo.so.1", "!legacy-app"}}, []testDirEntry{
+			{"usr", 0o755, true, nil, nil},
+			{"usr/bin", 0o755, true, nil, nil},
+			{"usr/bin/app", 0o755, false, []byte("app"), nil},
+		})
+		tool := fakePackage(t, &Package{Name: "tool", Version: "1.0-r0", Origin: "tool"}, []testDirEntry{
+			{"usr", 0o755, true, nil, nil},
+			{"usr/bin", 0o755, true, nil, nil},
+			{"usr/bin/tool", 0o755, false, []byte("tool"), nil},
+		})
+		_, err = a.InstallPackages(t.Context(), nil, []InstallablePackage{lib, app, tool})
+		require.NoError(t, err)
+		return a, src
+	}
+	names := func(t *testing.T, pkgs []*InstalledPackage) []string {
+		var names []string
+		for _, ip := range pkgs {
+			names = append(names, ip.Name)
+		}
+		return names
+	}
+	exists := func(t *testing.T, src apkfs.FullFS, name string) bool {
+		_, err := src.Stat(name)
+		if err != nil {
+			require.ErrorIs(t, err, fs.ErrNotExist)
+		}
+		return err == nil
+	}
+
+	t.Run("not installed", func(t *testing.T) {
+		a, _ := setup(t)
+		_, err := a.RemovePackages(t.Context(), []string{"nope"})
+		require.EqualError(t, err, "package nope is not installed")
+	})
+
+	t.Run("dependency", func(t *testing.T) {
+		a, src := setup(t)
+		_, err := a.RemovePackages(t.Context(), []string{"libfoo"})
+		require.EqualError(t, err, "cannot remove libfoo, which app depends on")
+		require.True(t, exists(t, src, "usr/lib/libfoo.so.1"))
+	})
+
+	t.Run("keeps orphans", func(t *testing.T) {
+		a, src := setup(t)
+		removed, err := a.RemovePackages(t.Context(), []string{"app"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"app"}, names(t, removed))
+
+		installed, err := a.GetInstalled()
+		require.NoError(t, err)
+		require.Equal(t, []string{"libfoo", "tool"}, names(t, installed))
+		require.False(t, exists(t, src, "usr/bin/app"))
+		require.True(t, exists(t, src, "usr/bin/tool"))
+		require.True(t, exists(t, src, "usr/lib/libfoo.so.1"))
+
+		world, err := a.GetWorld()
+		require.NoError(t, err)
+		require.Equal(t, []string{"tool>=1.0"}, world)
+	})
+
+	t.Run("removes orphans", func(t *testing.T) {
+		a, src := setup(t)
+		removed, err := a.RemovePackages(t.Context(), []string{"app"}, WithRemoveOrphans(true))
+		require.NoError(t, err)
+		require.Equal(t, []string{"libfoo", "app"}, names(t, removed))
+
+		installed, err := a.GetInstalled()
+		require.NoError(t, err)
+		require.Equal(t, []string{"tool"}, names(t, installed))
+		require.False(t, exists(t, src, "usr/lib/libfoo.so.1"))
+		require.True(t, exists(t, src, "usr/bin"))
+		require.True(t, exists(t, src, "usr/lib/apk/db/installed"))
+		require.NotContains(t, a.installedFiles, "usr/bin/app")
+	})
+
+	t.Run("orphans without a world", func(t *testing.T) {
+		a, src := setup(t)
+		require.NoError(t, src.Remove(worldFilePath))
+		_, err := a.RemovePackages(t.Context(), []string{"app"}, WithRemoveOrphans(true))
+		require.ErrorIs(t, err, fs.ErrNotExist)
+		require.ErrorContains(t, err, "without a world")
+		require.True(t, exists(t, src, "usr/bin/app"))
+		require.True(t, exists(t, src, "usr/bin/tool"))
+	})
+}
@@ -28,6 +28,8 @@ import (
 	"sync"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/chainguard-dev/clog"
 )
@@ -92,6 +94,26 @@ func (n *namedRepositoryWithIndex) Source() string {
 	return n.repo.IndexURI()
 }
 
+// IndexChecksum returns the SHA-256 of the APKINDEX.tar.gz which idx was read
+// from, or nil if it is not known.
+func IndexChecksum(idx NamedIndex) []byte {
+	n, ok := idx.(*namedRepositoryWithIndex)
+	if !ok || n.repo == nil || n.repo.index == nil {
+		return nil
+	}
+	return n.repo.index.Checksum
+}
+
+// IndexSignatureVerification returns how the signature of idx was verified, or why it
+// was not. Indexes which were not fetched from a repository are unverified.
+func IndexSignatureVerification(idx NamedIndex) Verification {
+	n, ok := idx.(*namedRepositoryWithIndex)
+	if !ok || n.repo == nil || n.repo.index == nil || n.repo.index.Verification == (Verification{}) {
+		return unverified("the index was not fetched from a repository")
+	}
+	return n.repo.index.Verification
+}
+
 // repositoryPackage is a package that is part of a repository.
 // it is nearly identical to RepositoryPackage, but it includes the pinned name of the repository.
 type repositoryPackage struct {
@@ -136,18 +158,33 @@ func (a *APK) GetRepositories() (repos []string, err error) {
 	return
 }
 
-// GetRepositoryIndexes returns the indexes for the repositories in the specified root.
-// The signatures for each index are verified unless ignoreSignatures is set to true.
-func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) ([]NamedIndex, error) {
-	ctx, span := otel.Tracer("go-apk").Start(ctx, "GetRepositoryIndexes")
-	defer span.End()
+// GetKeys returns the contents of the keys in the keyring, by their name.
+func (a *APK) GetKeys() (map[string][]byte, error) {
+	a.keyringMu.RLock()
+	defer a.keyringMu.RUnlock()
 
-	// get the repository URLs
-	repos, err := a.GetRepositories()
+	keys := make(map[string][]byte)
+	dir, err := a.fs.ReadDir(keysDirPath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("could not read keys directory in %s at %s: %w", a.fs, keysDirPath, err)
 	}
+	for _, d := range dir {
+		if d.IsDir() {
+			continue
+		}
+		fullPath := filepath.Join(keysDirPath, d.Name())
+		b, err := a.fs.ReadFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key file at %s: %w", fullPath, err)
+		}
+		keys[d.Name()] = b
+	}
+	return keys, nil
+}
 
+// GetRepositoryIndexes returns the indexes for the repositories in the specified root.
+// The signatures for each index are verified unless ignoreSignatures is set to true.
+func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) ([]NamedIndex, error) {
 	archFile, err := a.fs.Open(archFilePath)
 	if err != nil {
 		return nil, fmt.Errorf("could not open arch file in %s at %s: %w", a.fs, archFile, err)
@@ -161,22 +198,28 @@ func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) (
 	// trim the newline
 	arch := strings.TrimSuffix(string(archB), "\n")
 
-	// create the list of keys
-	keys := make(map[string][]byte)
-	dir, err := a.fs.ReadDir(keysDirPath)
+	return a.GetRepositoryIndexesForArch(ctx, arch, ignoreSignatures)
+}
+
+// GetRepositoryIndexesForArch returns the indexes of arch for the
+// repositories in the specified root, verified with its keyring as
+// GetRepositoryIndexes does, whatever the architecture of the root.
+func (a *APK) GetRepositoryIndexesForArch(ctx context.Context, arch string, ignoreSignatures bool) ([]NamedIndex, error) {
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "GetRepositoryIndexes", trace.WithAttributes(attribute.String("arch", arch)))
+	defer span.End()
+
+	ctx, cancel := withPhaseTimeout(ctx, "fetch", "the indexes for "+arch, a.fetchTimeout)
+	defer cancel()
+
+	// get the repository URLs
+	repos, err := a.GetRepositories()
 	if err != nil {
-		return nil, fmt.Errorf("could not read keys directory in %s at %s: %w", a.fs, keysDirPath, err)
+		return nil, err
 	}
-	for _, d := range dir {
-		if d.IsDir() {
-			continue
-		}
-		fullPath := filepath.Join(keysDirPath, d.Name())
-		b, err := a.fs.ReadFile(fullPath)
-		if err != nil {
-			return nil, fmt.Errorf("could not read key file at %s: %w", fullPath, err)
-		}
-		keys[d.Name()] = b
+
+	keys, err := a.GetKeys()
+	if err != nil {
+		return nil, err
 	}
 	httpClient := a.client
 	if a.cache != nil {
@@ -186,8 +229,44 @@ func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) (
 		WithIgnoreSignatureForIndexes(a.noSignatureIndexes...),
 		WithHTTPClient(httpClient),
 		WithIndexAuthenticator(a.auth),
+		WithIndexVerifications(a.indexVerifications),
+		WithSignaturePolicies(a.signaturePolicies),
+		WithUnsignedRepositories(a.unsignedRepositories),
+		WithRepositoryKeyrings(a.repositoryKeys),
+		WithKeyExpiries(a.keyExpiries()),
+		WithLocalIndexes(a.localIndexes),
+	}
+	indexes, err := GetRepositoryIndexes(ctx, repos, keys, arch, opts...)
+	if err != nil {
+		a.metrics.verificationFailed(arch, err)
+		return nil, withCause(ctx, err)
 	}
-	return GetRepositoryIndexes(ctx, repos, keys, arch, opts...)
+
+	a.signatureVerificationsMu.Lock()
+	defer a.signatureVerificationsMu.Unlock()
+	if a.indexSignatures == nil {
+		a.indexSignatures = map[string]Verification{}
+	}
+	for _, idx := range indexes {
+		v := IndexSignatureVerification(idx)
+		// The index may have been verified by an earlier fetch.
+		if ignoreSignatures {
+			v = unverified(ReasonSignaturesIgnored)
+		} else if reason, ok := UnsignedReasonFor(a.unsignedRepositories, idx.Source()); ok {
+			v = unverified(reasonRepositoryUnsigned(reason))
+		}
+		a.indexSignatures[idx.Source()] = v
+	}
+	return indexes, nil
+}
+
+// IndexSignatureVerifications returns how the signature of each index
+// fetched by GetRepositoryIndexes was verified, or why it was not, by the URL
+// of the index.
+func (a *APK) IndexSignatureVerifications() map[string]Verification {
+	a.signatureVerificationsMu.Lock()
+	defer a.signatureVerificationsMu.Unlock()
+	return maps.Clone(a.indexSignatures)
 }
 
 // PkgResolver resolves packages from a list of indexes.
@@ -290,7 +369,7 @@ func (p *PkgResolver) nextPackage(packages []string, dq map[*RepositoryPackage]s
 			return "", &ConstraintError{pkgName, err}
 		}
 		if len(pkgs) == 0 {
-			return "", fmt.Errorf("could not find package %s", pkgName)
+			return "", classify(ErrPackageNotFound, fmt.Errorf("could not find package %s", pkgName))
 		}
 
 		if next == "" {
@@ -505,6 +584,9 @@ func (p *PkgResolver) GetPackagesWithDependencies(ctx context.Context, packages
 	}
 
 	for len(constraints) != 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		next, err := p.nextPackage(constraints, dq)
 		if err != nil {
 			return nil, nil, err
@@ -641,7 +723,7 @@ func (p *PkgResolver) ResolvePackage(pkgName string, dq map[*RepositoryPackage]s
 	name, version, compare, pin := constraint.Name, constraint.Version, constraint.dep, constraint.pin
 	pkgsWithVersions, ok := p.nameMap[name]
 	if !ok {
-		return nil, fmt.Errorf("nothing provides %q", name)
+		return nil, classify(ErrPackageNotFound, fmt.Errorf("nothing provides %q", name))
 	}
 
 	// pkgsWithVersions contains a map of all versions of the package
@@ -668,7 +750,7 @@ func (p *PkgResolver) resolvePackage(pkgName string, dq map[*RepositoryPackage]s
 
 	pkgsWithVersions, ok := p.nameMap[name]
 	if !ok {
-		return nil, fmt.Errorf("nothing provides %q", name)
+		return nil, classify(ErrPackageNotFound, fmt.Errorf("nothing provides %q", name))
 	}
 
 	// pkgsWithVersions contains a map of all versions of the package
@@ -826,7 +908,7 @@ func (p *PkgResolver) getPackageDependencies(ctx context.Context, pkg *Repositor
 			// first see if it is a name of a package
 			depPkgWithVersions, ok := p.nameMap[name]
 			if !ok {
-				return nil, nil, &ConstraintError{dep, fmt.Errorf("nothing provides %q", name)}
+				return nil, nil, &ConstraintError{dep, classify(ErrPackageNotFound, fmt.Errorf("nothing provides %q", name))}
 			}
 			// pkgsWithVersions contains a map of all versions of the package
 			// get the one that most matches what was requested
@@ -869,7 +951,7 @@ func (p *PkgResolver) getPackageDependencies(ctx context.Context, pkg *Repositor
 
 		best := p.bestPackage(pkgs, nil, name, existing, existingOrigins, "")
 		if best == nil {
-			return nil, nil, &ConstraintError{name, fmt.Errorf("could not find package for %q", name)}
+			return nil, nil, &ConstraintError{name, classify(ErrPackageNotFound, fmt.Errorf("could not find package for %q", name))}
 		}
 
 		depPkg := best.RepositoryPackage
@@ -1130,10 +1212,10 @@ func maybedqerror(pkgs []*repositoryPackage, dq map[*RepositoryPackage]string) e
 	}
 
 	if len(errs) != 0 {
-		return errors.Join(errs...)
+		return classify(ErrPackageNotFound, errors.Join(errs...))
 	}
 
-	return errors.New("not in indexes")
+	return classify(ErrPackageNotFound, errors.New("not in indexes"))
 }
 
 func disqualifyDifference(ctx context.Context, byArch map[string][]NamedIndex) map[*RepositoryPackage]string {
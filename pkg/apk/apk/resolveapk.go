@@ -4,12 +4,12 @@ package apk
 import (
 	"bytes"
 	"context"
-	"crypto/sha1"
+	"crypto"
 	"crypto/sha256"
 	"fmt"
-	"hash"
 	"io"
 
+	"chainguard.dev/apko/pkg/apk/digest"
 	"chainguard.dev/apko/pkg/apk/expandapk"
 
 	"go.opentelemetry.io/otel"
@@ -47,7 +47,11 @@ func ResolveApk(ctx context.Context, source io.Reader) (*APKResolved, error) {
 		// When it's signed the control section is the second stream
 		control, data = split[1], split[2]
 
-		var h hash.Hash = sha1.New() //nolint:gosec
+		// The apk format mandates SHA-1 for the checksums of sections.
+		h, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return nil, err
+		}
 		size, err := io.Copy(h, split[0])
 		if err != nil {
 			return nil, fmt.Errorf("hashing signature: %w", err)
@@ -61,8 +65,12 @@ func ResolveApk(ctx context.Context, source io.Reader) (*APKResolved, error) {
 		return nil, fmt.Errorf("hashing control: %w", err)
 	}
 	resolved.ControlSize = buf.Len()
-	ctrlHash := sha1.Sum(buf.Bytes())
-	resolved.ControlHash = ctrlHash[:]
+	ctrlHash, err := digest.Identify(crypto.SHA1)
+	if err != nil {
+		return nil, err
+	}
+	ctrlHash.Write(buf.Bytes())
+	resolved.ControlHash = ctrlHash.Sum(nil)
 
 	dataHash := sha256.New()
 	size, err := io.Copy(dataHash, data)
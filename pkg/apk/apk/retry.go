@@ -0,0 +1,216 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/hashicorp/go-retryablehttp"
+)
+
+// RetryPolicy configures how failed requests to repositories, and to the
+// registries of OCI keyrings, are retried. A Retry-After header of a failed
+// response is honoured in place of the backoff, even when it is longer than
+// MaxBackoff, as long as it fits in the Budget.
+type RetryPolicy struct {
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// MinBackoff and MaxBackoff bound the exponential wait between retries.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryOnStatus are the response status codes which are retried, besides
+	// connection errors. When empty, 429 and the 5xx statuses but 501 are.
+	RetryOnStatus []int
+	// Budget bounds the time spent on a request and its retries: a request
+	// is not retried when the retry would start after it. Zero means no
+	// budget.
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used unless WithRetryPolicy is given.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 4,
+		MinBackoff: 1 * time.Second,
+		MaxBackoff: 30 * time.Second,
+	}
+}
+
+// client returns a client which retries the failed requests of c according
+// to the policy.
+func (p RetryPolicy) client(ctx context.Context, c *http.Client) *http.Client {
+	rc := retryablehttp.NewClient()
+	rc.HTTPClient = c
+	rc.Logger = clog.FromContext(ctx)
+	rc.RetryMax = p.MaxRetries
+	rc.RetryWaitMin = p.MinBackoff
+	rc.RetryWaitMax = p.MaxBackoff
+	rc.CheckRetry = p.checkRetry
+	rc.Backoff = backoff
+
+	std := rc.StandardClient()
+	if p.Budget > 0 {
+		std.Transport = &budgetTransport{next: std.Transport, budget: p.Budget}
+	}
+	return std
+}
+
+// RemoteOptions returns the options which make go-containerregistry retry
+// the requests to registries according to the policy. Reads are retried in
+// the transport; the upload of a blob or manifest, which takes several
+// requests, is retried as a whole, with an exponential backoff from
+// MinBackoff.
+func (p RetryPolicy) RemoteOptions() []remote.Option {
+	return p.RemoteOptionsWithTransport(remote.DefaultTransport)
+}
+
+// RemoteOptionsWithTransport returns the RemoteOptions of the policy, which
+// make their requests through next.
+func (p RetryPolicy) RemoteOptionsWithTransport(next http.RoundTripper) []remote.Option {
+	c := p.client(context.Background(), &http.Client{Transport: next})
+	return []remote.Option{
+		remote.WithTransport(&readRetryTransport{retry: c.Transport, next: next}),
+		// go-containerregistry retries reads in its transport too, unless
+		// there are no statuses to retry.
+		remote.WithRetryStatusCodes(),
+		remote.WithRetryPredicate(p.Retryable),
+		remote.WithRetryBackoff(remote.Backoff{
+			Duration: p.MinBackoff,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    p.MaxRetries + 1,
+		}),
+	}
+}
+
+// Retryable reports whether an upload which failed with err is
+// retried: on connection errors, and on the statuses of the policy.
+func (p RetryPolicy) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		if len(p.RetryOnStatus) > 0 {
+			return slices.Contains(p.RetryOnStatus, terr.StatusCode)
+		}
+		return terr.StatusCode == http.StatusTooManyRequests ||
+			(terr.StatusCode >= 500 && terr.StatusCode != http.StatusNotImplemented)
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// readRetryTransport retries the reads, which can be repeated as they are,
+// through retry, and sends the other requests, part of uploads retried as a
+// whole, through next.
+type readRetryTransport struct {
+	retry, next http.RoundTripper
+}
+
+func (t *readRetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.retry.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+func (p RetryPolicy) checkRetry(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	var retry bool
+	if err != nil || len(p.RetryOnStatus) == 0 {
+		retry, err = retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	} else {
+		retry = slices.Contains(p.RetryOnStatus, resp.StatusCode)
+	}
+	if !retry {
+		return false, err
+	}
+
+	if b, ok := ctx.Value(retryBudgetKey{}).(*retryBudget); ok {
+		// the wait before the retry, as backoff computes it
+		wait := backoff(p.MinBackoff, p.MaxBackoff, b.attempt, resp)
+		b.attempt++
+		if time.Now().Add(wait).After(b.deadline) {
+			return false, err
+		}
+	}
+	return true, err
+}
+
+// backoff waits as long as the Retry-After header of resp asks, if any,
+// and exponentially otherwise.
+func backoff(minWait, maxWait time.Duration, attempt int, resp *http.Response) time.Duration {
+	if wait, ok := retryAfter(resp); ok {
+		return wait
+	}
+	return retryablehttp.DefaultBackoff(minWait, maxWait, attempt, nil)
+}
+
+// retryAfter parses the Retry-After header of resp, in seconds or as a date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+type retryBudgetKey struct{}
+
+// retryBudget is the deadline of the retries of a request, and how many
+// were checked against it.
+type retryBudget struct {
+	deadline time.Time
+	attempt  int
+}
+
+// budgetTransport sets the deadline of the retries of each request.
+type budgetTransport struct {
+	next   http.RoundTripper
+	budget time.Duration
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), retryBudgetKey{}, &retryBudget{deadline: time.Now().Add(t.budget)})
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
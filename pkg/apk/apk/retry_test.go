@@ -0,0 +1,138 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		policy     RetryPolicy
+		status     int
+		retryAfter string
+		// wantStatus is the status of the response once the retries are
+		// done, the server succeeds on the third request.
+		wantStatus   int
+		wantRequests int32
+		wantWait     time.Duration
+	}{{
+		name:         "default statuses",
+		policy:       RetryPolicy{MaxRetries: 4, MaxBackoff: time.Millisecond},
+		status:       http.StatusBadGateway,
+		wantStatus:   http.StatusOK,
+		wantRequests: 3,
+	}, {
+		name:         "not retried by default",
+		policy:       RetryPolicy{MaxRetries: 4, MaxBackoff: time.Millisecond},
+		status:       http.StatusTeapot,
+		wantStatus:   http.StatusTeapot,
+		wantRequests: 1,
+	}, {
+		name:         "retry on status",
+		policy:       RetryPolicy{MaxRetries: 4, MaxBackoff: time.Millisecond, RetryOnStatus: []int{http.StatusTeapot}},
+		status:       http.StatusTeapot,
+		wantStatus:   http.StatusOK,
+		wantRequests: 3,
+	}, {
+		name:         "retry after",
+		policy:       RetryPolicy{MaxRetries: 4, MaxBackoff: time.Millisecond},
+		status:       http.StatusTooManyRequests,
+		retryAfter:   "1",
+		wantStatus:   http.StatusOK,
+		wantRequests: 3,
+		wantWait:     2 * time.Second,
+	}, {
+		name:         "retry after exceeds budget",
+		policy:       RetryPolicy{MaxRetries: 4, MaxBackoff: time.Millisecond, Budget: time.Second},
+		status:       http.StatusTooManyRequests,
+		retryAfter:   "10",
+		wantStatus:   http.StatusTooManyRequests,
+		wantRequests: 1,
+	}, {
+		name:         "backoff exceeds budget",
+		policy:       RetryPolicy{MaxRetries: 4, MinBackoff: 10 * time.Second, MaxBackoff: 10 * time.Second, Budget: time.Second},
+		status:       http.StatusBadGateway,
+		wantStatus:   http.StatusBadGateway,
+		wantRequests: 1,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if requests.Add(1) > 2 {
+					return
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer s.Close()
+
+			start := time.Now()
+			res, err := tt.policy.client(t.Context(), s.Client()).Get(s.URL)
+			require.NoError(t, err)
+			res.Body.Close()
+			require.Equal(t, tt.wantStatus, res.StatusCode)
+			require.Equal(t, tt.wantRequests, requests.Load())
+			require.GreaterOrEqual(t, time.Since(start), tt.wantWait)
+		})
+	}
+}
+
+func TestRetryPolicyUploads(t *testing.T) {
+	// The registry fails the first commit of each upload, which is retried
+	// as a whole from a new upload.
+	reg := registry.New()
+	var uploads, failed atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/blobs/uploads/") {
+			uploads.Add(1)
+		}
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/blobs/uploads/") && failed.Add(1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(strings.TrimPrefix(s.URL, "http://") + "/test/retry")
+	require.NoError(t, err)
+
+	policy := RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	require.NoError(t, remote.Write(ref, img, policy.RemoteOptions()...))
+
+	// Two layers and the config, each uploaded twice.
+	require.Equal(t, int32(6), uploads.Load())
+	got, err := remote.Image(ref)
+	require.NoError(t, err)
+	require.NoError(t, validate.Image(got))
+}
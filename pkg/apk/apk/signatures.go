@@ -0,0 +1,471 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/digest"
+	"chainguard.dev/apko/pkg/apk/expandapk"
+	sign "chainguard.dev/apko/pkg/apk/signature"
+)
+
+var signatureFileRegex = regexp.MustCompile(`^\.SIGN\.(DSA|RSA|RSA256|RSA512)\.(.*\.pub)$`)
+
+// keyFileSuffixes are the keyring file suffixes of the supported key types.
+var keyFileSuffixes = []string{".rsa.pub", ".ecdsa.pub", ".ed25519.pub"}
+
+type Signature struct {
+	KeyID           string
+	Signature       []byte
+	DigestAlgorithm crypto.Hash
+}
+
+// Verification records how the signature of an index or a package was
+// checked, so that a build can be audited after the fact.
+type Verification struct {
+	// Verified is whether a signature was verified.
+	Verified bool `json:"verified"`
+	// KeyID is the name of the keyring key which made the signature.
+	KeyID string `json:"keyID,omitempty"`
+	// Algorithm is how the signature was made, such as RSA-SHA256, or the
+	// format of the signature of an index verified with an IndexVerifier,
+	// such as sigstore.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Reason is why no signature was verified.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Reasons for not verifying the signature of an index or a package.
+const (
+	ReasonSignaturesIgnored  = "signature verification is disabled"
+	ReasonIndexIgnored       = "the signature policy of the repository ignores the index signature"
+	ReasonNoSignatureIndex   = "the index is configured to not need a signature"
+	ReasonUnsignedAllowed    = "not signed, which the signature policy of the repository allows"
+	ReasonSynthesizedIndex   = "the index was generated from the packages of a local directory"
+	ReasonPackageNotRequired = "package signatures are not verified; the control section matched the checksum in the index"
+	ReasonNoIndexChecksum    = "package signatures are not verified and the index has no checksum for the package"
+)
+
+// reasonRepositoryUnsigned is the reason recorded for the indexes and
+// packages of a repository whose signatures are ignored with
+// WithUnsignedRepository.
+func reasonRepositoryUnsigned(reason string) string {
+	return "signature verification is disabled for the repository: " + reason
+}
+
+// ForbidUnsignedEnv is the environment variable which, set to 1, makes New
+// and GetRepositoryIndexes fail instead of ignoring any signature, so that
+// an organization can keep unverified packages out of its builds whatever
+// the options of the tool calling the library.
+const ForbidUnsignedEnv = "APKO_FORBID_UNSIGNED"
+
+// forbidUnsigned returns an error if ForbidUnsignedEnv is set and the
+// options ignore the signatures of any repository, or synthesize the
+// unsigned indexes of local repositories.
+func forbidUnsigned(ignoreAll, localIndexes bool, unsigned map[string]string, policies map[string]SignaturePolicy) error {
+	if os.Getenv(ForbidUnsignedEnv) != "1" {
+		return nil
+	}
+	var ignored []string
+	if ignoreAll {
+		ignored = append(ignored, "all repositories")
+	}
+	if localIndexes {
+		ignored = append(ignored, "the synthesized indexes of local repositories")
+	}
+	ignored = append(ignored, slices.Sorted(maps.Keys(unsigned))...)
+	for _, repo := range slices.Sorted(maps.Keys(policies)) {
+		if p := policies[repo]; p.IgnoreIndexSignature || p.AllowUnsigned {
+			ignored = append(ignored, repo)
+		}
+	}
+	if len(ignored) == 0 {
+		return nil
+	}
+	return classify(ErrSignatureInvalid, fmt.Errorf("%s=1 forbids ignoring the signatures of %s", ForbidUnsignedEnv, strings.Join(ignored, ", ")))
+}
+
+// String describes the verification in a phrase.
+func (v Verification) String() string {
+	switch {
+	case !v.Verified:
+		return "unverified: " + v.Reason
+	case v.KeyID == "":
+		return "verified with a " + v.Algorithm + " signature"
+	default:
+		return fmt.Sprintf("verified with key %s (%s)", v.KeyID, v.Algorithm)
+	}
+}
+
+// unverified returns the Verification of a signature not verified for reason.
+func unverified(reason string) Verification {
+	return Verification{Reason: reason}
+}
+
+// signatureAlgorithm names the algorithm of a signature made by key over a
+// digest of type h, such as RSA-SHA256.
+func signatureAlgorithm(key []byte, h crypto.Hash) string {
+	digest := strings.ReplaceAll(h.String(), "-", "")
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return digest
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return digest
+	}
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "RSA-" + digest
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + digest
+	case ed25519.PublicKey:
+		return "Ed25519-" + digest
+	default:
+		return digest
+	}
+}
+
+// SignaturePolicy describes how the signatures of a repository's index and
+// packages are verified.
+type SignaturePolicy struct {
+	// IgnoreIndexSignature skips verifying the signature of the index.
+	IgnoreIndexSignature bool
+	// RequireSignedPackages verifies the signature of each package installed
+	// from the repository.
+	RequireSignedPackages bool
+	// AllowUnsigned accepts an index or package that carries no signature at
+	// all. Invalid signatures are still rejected.
+	AllowUnsigned bool
+	// KeyIDs restricts the keys accepted for the repository's signatures to
+	// the keyring keys with these names. Any key is accepted when empty.
+	KeyIDs []string
+}
+
+// acceptedKeys returns the keys the policy accepts signatures from.
+func (p SignaturePolicy) acceptedKeys(keys map[string][]byte) map[string][]byte {
+	if len(p.KeyIDs) == 0 {
+		return keys
+	}
+	accepted := make(map[string][]byte, len(p.KeyIDs))
+	for name, key := range keys {
+		if slices.ContainsFunc(p.KeyIDs, func(id string) bool {
+			return trimKeyFileSuffix(id) == trimKeyFileSuffix(name)
+		}) {
+			accepted[name] = key
+		}
+	}
+	return accepted
+}
+
+// signaturePolicyFor returns the policy of the repository that u, the URL of
+// an index or package, belongs to. The longest matching repository wins.
+func signaturePolicyFor(policies map[string]SignaturePolicy, u string) (SignaturePolicy, bool) {
+	return repositoryFor(policies, u)
+}
+
+// UnsignedReasonFor returns why the signatures of the repository in unsigned
+// that u, the URL of an index or package, belongs to are ignored, if they
+// are.
+func UnsignedReasonFor(unsigned map[string]string, u string) (string, bool) {
+	return repositoryFor(unsigned, u)
+}
+
+// repositoryFor returns the value of the repository in m that u belongs to.
+// The longest matching repository wins.
+func repositoryFor[V any](m map[string]V, u string) (V, bool) {
+	var (
+		value V
+		found string
+	)
+	for repo, v := range m {
+		repo = strings.TrimRight(repo, "/")
+		if strings.HasPrefix(u, repo+"/") && len(repo) > len(found) {
+			value, found = v, repo
+		}
+	}
+	return value, found != ""
+}
+
+// withRepositoryKeys returns keys, with the keys accepted for the repository
+// that u belongs to only.
+func withRepositoryKeys(keys map[string][]byte, repositoryKeys map[string]map[string][]byte, u string) map[string][]byte {
+	extra, ok := repositoryFor(repositoryKeys, u)
+	if !ok {
+		return keys
+	}
+	merged := make(map[string][]byte, len(keys)+len(extra))
+	maps.Copy(merged, keys)
+	maps.Copy(merged, extra)
+	return merged
+}
+
+// trimKeyFileSuffix strips the key type suffix from a keyring file name.
+func trimKeyFileSuffix(keyfile string) string {
+	for _, suffix := range keyFileSuffixes {
+		if trimmed, ok := strings.CutSuffix(keyfile, suffix); ok {
+			return trimmed
+		}
+	}
+	return keyfile
+}
+
+// readSignatures reads the signatures made with any of keys from the
+// signature part of an index or package. It reports whether the part holds
+// signatures at all, as an unsigned archive starts with its contents instead.
+func readSignatures(ctx context.Context, tarReader *tar.Reader, keys map[string][]byte, what string) ([]Signature, bool, error) {
+	sigs := make([]Signature, 0, len(keys))
+
+	for first := true; ; first = false {
+		// read the signature(s)
+		signatureFile, err := tarReader.Next()
+		// found everything, end of stream
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		// oops something went wrong
+		if err != nil {
+			return nil, false, fmt.Errorf("unexpected error reading from tgz: %w", err)
+		}
+		if first && !strings.HasPrefix(signatureFile.Name, ".SIGN.") {
+			return nil, false, nil
+		}
+		matches := signatureFileRegex.FindStringSubmatch(signatureFile.Name)
+		if len(matches) != 3 {
+			return nil, true, fmt.Errorf("failed to find key name in signature file name: %s", signatureFile.Name)
+		}
+		keyfile := matches[2]
+
+		trimmedKeyFile := trimKeyFileSuffix(keyfile)
+		if _, ok := keys[keyfile]; ok {
+			// We found a matching key
+		} else if _, ok := keys[trimmedKeyFile]; ok {
+			// When we download keys from proxy servers - like artifactory, we ignore the 'content-disposition' header
+			// (that would be difficult to cache as well), and the header is responsible for providing key name with
+			// proper extension. Here we accept matching keys without proper extension.
+			keyfile = trimmedKeyFile
+		} else {
+			clog.FromContext(ctx).Warnf("skipping signature %s due to missing keyfile: %s", signatureFile.Name, keyfile)
+			// Ignore this signature if we don't have the key
+			continue
+		}
+		// The signature type names the digest; RSA, ECDSA and Ed25519
+		// keys all sign it, and the key decides how it is verified.
+		var digestAlgorithm crypto.Hash
+		switch signatureType := matches[1]; signatureType {
+		case "DSA":
+			// Obsolete
+			continue
+		case "RSA":
+			// Current legacy compat
+			digestAlgorithm = crypto.SHA1
+		case "RSA256":
+			// Current best practice
+			digestAlgorithm = crypto.SHA256
+		case "RSA512":
+			// Too big, too slow, not compiled in
+			continue
+		default:
+			return nil, true, fmt.Errorf("unknown signature format: %s", signatureType)
+		}
+		signature, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to read signature from %s: %w", what, err)
+		}
+		sigs = append(sigs, Signature{
+			KeyID:           keyfile,
+			Signature:       signature,
+			DigestAlgorithm: digestAlgorithm,
+		})
+	}
+	if len(sigs) == 0 {
+		return nil, true, classify(ErrSignatureInvalid, fmt.Errorf("no signature with known key (one of: %v) found in %s", slices.Collect(maps.Keys(keys)), what))
+	}
+	return sigs, true, nil
+}
+
+// verifySignatures checks that at least one of sigs is a valid signature of
+// data, returning how it was verified. Signatures made with keys
+// that expired according to expiries are reported as such, rather than as
+// opaque verification failures. The digests of the signatures must be
+// approved by hasher.
+func verifySignatures(ctx context.Context, hasher digest.Hasher, data []byte, sigs []Signature, keys map[string][]byte, expiries map[string]time.Time, what string) (Verification, error) {
+	now := time.Now()
+	expired := map[string]time.Time{}
+	for _, sig := range sigs {
+		if t, ok := expiries[sig.KeyID]; ok && !t.After(now) {
+			expired[sig.KeyID] = t
+		}
+	}
+
+	var refused error
+	for _, sig := range sigs {
+		// FIPS builds refuse the SHA-1 of legacy .SIGN.RSA signatures, and
+		// rely on the .SIGN.RSA256 signatures instead.
+		if _, err := hasher.New(sig.DigestAlgorithm, digest.Integrity); err != nil {
+			clog.FromContext(ctx).Warnf("skipping signature of %s with keyfile %s: %v", what, sig.KeyID, err)
+			refused = err
+			continue
+		}
+		// Ed25519 keys sign data itself, and the others its digest.
+		if err := sign.Verify(data, sig.DigestAlgorithm, sig.Signature, keys[sig.KeyID]); err == nil {
+			if t, ok := expired[sig.KeyID]; ok {
+				clog.FromContext(ctx).Warnf("%s is signed with key %s, which expired on %s; refresh the keyring to pick up rotated keys", what, sig.KeyID, t.Format(time.DateOnly))
+			}
+			return Verification{
+				Verified:  true,
+				KeyID:     sig.KeyID,
+				Algorithm: signatureAlgorithm(keys[sig.KeyID], sig.DigestAlgorithm),
+			}, nil
+		} else {
+			clog.FromContext(ctx).Warnf("failed to verify signature for keyfile %s: %v", sig.KeyID, err)
+		}
+	}
+	if len(expired) > 0 {
+		return Verification{}, &ExpiredKeyError{What: what, Keys: expired}
+	}
+	if refused != nil {
+		return Verification{}, classify(ErrSignatureInvalid, fmt.Errorf("no signature of %s could be verified: %w", what, refused))
+	}
+	return Verification{}, classify(ErrSignatureInvalid, fmt.Errorf("signature verification failed for %s, for all provided keys", what))
+}
+
+// checkControlHash checks that the control section of a fetched package has
+// the checksum of the package in its index, and reports whether the index has
+// one to check.
+func checkControlHash(pkg InstallablePackage, exp *expandapk.APKExpanded) (bool, error) {
+	chk := pkg.ChecksumString()
+	if !strings.HasPrefix(chk, "Q1") {
+		return false, nil
+	}
+	want, err := base64.StdEncoding.DecodeString(chk[2:])
+	if err != nil || len(want) == 0 {
+		return false, nil
+	}
+	if !bytes.Equal(want, exp.ControlHash) {
+		return true, fmt.Errorf("package %s has checksum Q1%s, expected %s: %w", pkg.PackageName(), base64.StdEncoding.EncodeToString(exp.ControlHash), chk, ErrChecksumMismatch)
+	}
+	return true, nil
+}
+
+// verifyPackage verifies the signature of a package when all packages are
+// verified, or its repository's policy requires signed packages. How the
+// package was verified is recorded for PackageSignatureVerifications.
+func (a *APK) verifyPackage(ctx context.Context, pkg InstallablePackage, exp *expandapk.APKExpanded) error {
+	if a.ignoreSignatures {
+		a.recordVerification(pkg, unverified(ReasonSignaturesIgnored))
+		return nil
+	}
+	if reason, ok := UnsignedReasonFor(a.unsignedRepositories, pkg.URL()); ok {
+		a.recordVerification(pkg, unverified(reasonRepositoryUnsigned(reason)))
+		return nil
+	}
+	policy, _ := signaturePolicyFor(a.signaturePolicies, pkg.URL())
+	// The index trusts the package by the SHA-1 checksum of its control
+	// section, which FIPS builds do not, so they verify its signature.
+	indexTrusted := digest.Approved(crypto.SHA1, digest.Integrity)
+	if !a.verifyPackageSignatures && !policy.RequireSignedPackages && indexTrusted {
+		checked, err := checkControlHash(pkg, exp)
+		if err != nil {
+			return err
+		}
+		if !checked {
+			a.recordVerification(pkg, unverified(ReasonNoIndexChecksum))
+			return nil
+		}
+		a.recordVerification(pkg, unverified(ReasonPackageNotRequired))
+		return nil
+	}
+	what := "package " + pkg.PackageName()
+	if exp.SignatureFile == "" {
+		if !policy.AllowUnsigned {
+			return classify(ErrSignatureInvalid, fmt.Errorf("%s is not signed", what))
+		}
+		clog.FromContext(ctx).Warnf("%s is not signed", what)
+		a.recordVerification(pkg, unverified(ReasonUnsignedAllowed))
+		return nil
+	}
+
+	keys, err := a.GetKeys()
+	if err != nil {
+		return fmt.Errorf("reading keyring: %w", err)
+	}
+	keys = policy.acceptedKeys(withRepositoryKeys(keys, a.repositoryKeys, pkg.URL()))
+
+	f, err := os.Open(exp.SignatureFile)
+	if err != nil {
+		return fmt.Errorf("opening signature of %s: %w", what, err)
+	}
+	defer f.Close()
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("unable to create gzip reader for signature of %s: %w", what, err)
+	}
+	defer gzipReader.Close()
+	sigs, _, err := readSignatures(ctx, tar.NewReader(gzipReader), keys, what)
+	if err != nil {
+		return err
+	}
+
+	control, err := os.ReadFile(exp.ControlFile)
+	if err != nil {
+		return fmt.Errorf("reading control section of %s: %w", what, err)
+	}
+	v, err := verifySignatures(ctx, digest.Default(), control, sigs, keys, a.keyExpiries(), what)
+	if err != nil {
+		return err
+	}
+	a.recordVerification(pkg, v)
+	return nil
+}
+
+func (a *APK) recordVerification(pkg InstallablePackage, v Verification) {
+	a.signatureVerificationsMu.Lock()
+	defer a.signatureVerificationsMu.Unlock()
+	if a.packageSignatures == nil {
+		a.packageSignatures = map[string]Verification{}
+	}
+	a.packageSignatures[pkg.PackageName()] = v
+}
+
+// PackageSignatureVerifications returns how the signature of each package fetched
+// for installing it was verified, or why it was not, by package name.
+func (a *APK) PackageSignatureVerifications() map[string]Verification {
+	a.signatureVerificationsMu.Lock()
+	defer a.signatureVerificationsMu.Unlock()
+	return maps.Clone(a.packageSignatures)
+}
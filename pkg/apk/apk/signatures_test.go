@@ -0,0 +1,396 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/digest"
+	"chainguard.dev/apko/pkg/apk/expandapk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/apk/signature"
+)
+
+func TestSignaturePolicyFor(t *testing.T) {
+	policies := map[string]SignaturePolicy{
+		"https://example.com/os":       {AllowUnsigned: true},
+		"https://example.com/os/extra": {RequireSignedPackages: true},
+	}
+	for _, tc := range []struct {
+		url   string
+		found bool
+		want  SignaturePolicy
+	}{
+		{url: "https://example.com/os/x86_64/APKINDEX.tar.gz", found: true, want: SignaturePolicy{AllowUnsigned: true}},
+		{url: "https://example.com/os/extra/x86_64/APKINDEX.tar.gz", found: true, want: SignaturePolicy{RequireSignedPackages: true}},
+		{url: "https://example.com/osx/x86_64/APKINDEX.tar.gz"},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			got, found := signaturePolicyFor(policies, tc.url)
+			require.Equal(t, tc.found, found)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestIndexSignaturePolicy(t *testing.T) {
+	const indexPath = "testdata/signing/APKINDEX.tar.gz"
+	signed, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+
+	// Strip the signatures, leaving the index itself.
+	r := bytes.NewReader(signed)
+	gz, err := gzip.NewReader(r)
+	require.NoError(t, err)
+	gz.Multistream(false)
+	_, err = io.Copy(io.Discard, gz)
+	require.NoError(t, err)
+	unsigned := signed[len(signed)-r.Len():]
+
+	entries, err := os.ReadDir("testdata/signing/keys")
+	require.NoError(t, err)
+	keys := map[string][]byte{}
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join("testdata/signing/keys", e.Name()))
+		require.NoError(t, err)
+		keys[e.Name()] = b
+	}
+	first := entries[0].Name()
+	verified := Verification{Verified: true, KeyID: first, Algorithm: "RSA-SHA256"}
+
+	for _, tc := range []struct {
+		name     string
+		index    []byte
+		keys     map[string][]byte
+		policy   SignaturePolicy
+		unsigned string
+		wantErr  string
+		want     Verification
+	}{{
+		name:  "signed",
+		index: signed,
+		keys:  keys,
+		want:  verified,
+	}, {
+		name:    "unsigned",
+		index:   unsigned,
+		keys:    keys,
+		wantErr: "repository index is not signed",
+	}, {
+		name:   "unsigned allowed",
+		index:  unsigned,
+		keys:   keys,
+		policy: SignaturePolicy{AllowUnsigned: true},
+		want:   Verification{Reason: ReasonUnsignedAllowed},
+	}, {
+		name:   "unsigned allowed without keys",
+		index:  unsigned,
+		policy: SignaturePolicy{AllowUnsigned: true},
+		want:   Verification{Reason: ReasonUnsignedAllowed},
+	}, {
+		name:   "required key",
+		index:  signed,
+		keys:   keys,
+		policy: SignaturePolicy{KeyIDs: []string{strings.TrimSuffix(first, ".rsa.pub")}},
+		want:   verified,
+	}, {
+		name:    "required key missing",
+		index:   signed,
+		keys:    map[string][]byte{entries[1].Name(): keys[entries[1].Name()]},
+		policy:  SignaturePolicy{KeyIDs: []string{first}},
+		wantErr: "none of the required keys",
+	}, {
+		name:   "ignored",
+		index:  unsigned,
+		policy: SignaturePolicy{IgnoreIndexSignature: true},
+		want:   Verification{Reason: ReasonIndexIgnored},
+	}, {
+		name:     "unsigned repository",
+		index:    unsigned,
+		unsigned: "mirror of a vendor repository",
+		want:     Verification{Reason: "signature verification is disabled for the repository: mirror of a vendor repository"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &indexOpts{signaturePolicies: map[string]SignaturePolicy{"testdata/signing": tc.policy}}
+			if tc.unsigned != "" {
+				opts.unsignedRepositories = map[string]string{"testdata/signing": tc.unsigned}
+			}
+			idx, err := parseRepositoryIndex(context.Background(), indexPath, tc.keys, "aarch64", tc.index, opts)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, idx.Verification)
+		})
+	}
+}
+
+// signedTestPackage builds an apk whose control section is signed with keyFile
+// under the name keyName, or an unsigned one when keyFile is empty.
+func signedTestPackage(t *testing.T, keyFile, keyName string) []byte {
+	t.Helper()
+	section := func(name, content string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, tw.Flush())
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	control := section(".PKGINFO", "pkgname = hello\npkgver = 1.0-r0\n")
+	var apk bytes.Buffer
+	if keyFile != "" {
+		sig, err := signature.Sign(control, crypto.SHA256, keyFile, "")
+		require.NoError(t, err)
+		apk.Write(section(".SIGN.RSA256."+keyName, string(sig)))
+	}
+	apk.Write(control)
+	apk.Write(section("usr/share/hello", "hello\n"))
+	return apk.Bytes()
+}
+
+func TestVerifyPackage(t *testing.T) {
+	ctx := context.Background()
+	const repo = "https://example.com/os"
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "test.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherDER, err := x509.MarshalPKCS8PrivateKey(otherKey)
+	require.NoError(t, err)
+	otherKeyFile := filepath.Join(t.TempDir(), "other.pem")
+	require.NoError(t, os.WriteFile(otherKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: otherDER}), 0o600))
+
+	for _, tc := range []struct {
+		name      string
+		apk       []byte
+		policy    SignaturePolicy
+		verifyAll bool
+		unsigned  string
+		// checksum is the checksum of the package in its index, given the
+		// checksum of its control section.
+		checksum func([]byte) []byte
+		wantErr  string
+		want     Verification
+	}{{
+		name:   "signed",
+		apk:    signedTestPackage(t, keyFile, "test.ecdsa.pub"),
+		policy: SignaturePolicy{RequireSignedPackages: true},
+		want:   Verification{Verified: true, KeyID: "test.ecdsa.pub", Algorithm: "ECDSA-SHA256"},
+	}, {
+		name:      "all packages",
+		apk:       signedTestPackage(t, keyFile, "test.ecdsa.pub"),
+		verifyAll: true,
+		want:      Verification{Verified: true, KeyID: "test.ecdsa.pub", Algorithm: "ECDSA-SHA256"},
+	}, {
+		name:      "all packages unsigned",
+		apk:       signedTestPackage(t, "", ""),
+		verifyAll: true,
+		wantErr:   "package hello is not signed",
+	}, {
+		name:    "unsigned",
+		apk:     signedTestPackage(t, "", ""),
+		policy:  SignaturePolicy{RequireSignedPackages: true},
+		wantErr: "package hello is not signed",
+	}, {
+		name:   "unsigned allowed",
+		apk:    signedTestPackage(t, "", ""),
+		policy: SignaturePolicy{RequireSignedPackages: true, AllowUnsigned: true},
+		want:   Verification{Reason: ReasonUnsignedAllowed},
+	}, {
+		name:    "wrong key",
+		apk:     signedTestPackage(t, otherKeyFile, "test.ecdsa.pub"),
+		policy:  SignaturePolicy{RequireSignedPackages: true, AllowUnsigned: true},
+		wantErr: "signature verification failed for package hello",
+	}, {
+		name:    "key not required",
+		apk:     signedTestPackage(t, keyFile, "test.ecdsa.pub"),
+		policy:  SignaturePolicy{RequireSignedPackages: true, KeyIDs: []string{"other.rsa.pub"}},
+		wantErr: "no signature with known key",
+	}, {
+		name:     "not required",
+		apk:      signedTestPackage(t, "", ""),
+		checksum: func(control []byte) []byte { return control },
+		want:     Verification{Reason: ReasonPackageNotRequired},
+	}, {
+		name:     "not required checksum mismatch",
+		apk:      signedTestPackage(t, "", ""),
+		checksum: func(control []byte) []byte { return make([]byte, len(control)) },
+		wantErr:  "package hello has checksum",
+	}, {
+		name: "not required without checksum",
+		apk:  signedTestPackage(t, "", ""),
+		want: Verification{Reason: ReasonNoIndexChecksum},
+	}, {
+		name:      "unsigned repository",
+		apk:       signedTestPackage(t, "", ""),
+		verifyAll: true,
+		unsigned:  "internal staging",
+		want:      Verification{Reason: "signature verification is disabled for the repository: internal staging"},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := apkfs.NewMemFS()
+			require.NoError(t, fsys.MkdirAll(keysDirPath, 0o755))
+			require.NoError(t, fsys.WriteFile(filepath.Join(keysDirPath, "test.ecdsa.pub"), pub, 0o644))
+			opts := []Option{WithFS(fsys), WithSignaturePolicy(repo+"/", tc.policy), WithVerifyPackageSignatures(tc.verifyAll)}
+			if tc.unsigned != "" {
+				opts = append(opts, WithUnsignedRepository(repo, tc.unsigned))
+			}
+			a, err := New(ctx, opts...)
+			require.NoError(t, err)
+
+			exp, err := expandapk.ExpandApk(ctx, bytes.NewReader(tc.apk), "")
+			require.NoError(t, err)
+			defer exp.Close()
+
+			p := &Package{Name: "hello", Version: "1.0-r0"}
+			if tc.checksum != nil {
+				p.Checksum = tc.checksum(exp.ControlHash)
+			}
+			pkg := NewRepositoryPackage(p, &RepositoryWithIndex{Repository: &Repository{URI: repo + "/x86_64"}})
+			err = a.verifyPackage(ctx, pkg, exp)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				if tc.checksum != nil {
+					require.ErrorIs(t, err, ErrChecksumMismatch)
+				}
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, map[string]Verification{"hello": tc.want}, a.PackageSignatureVerifications())
+		})
+	}
+}
+
+func TestForbidUnsigned(t *testing.T) {
+	ctx := context.Background()
+	const repo = "https://example.com/os"
+
+	_, err := New(ctx, WithFS(apkfs.NewMemFS()), WithUnsignedRepository(repo, " "))
+	require.ErrorContains(t, err, "ignoring the signatures of https://example.com/os needs a reason")
+
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		wantErr string
+	}{{
+		name: "verified",
+		opts: []Option{WithSignaturePolicy(repo, SignaturePolicy{RequireSignedPackages: true})},
+	}, {
+		name: "no signature indexes",
+		opts: []Option{WithNoSignatureIndexes(repo)},
+	}, {
+		name:    "all repositories",
+		opts:    []Option{WithIgnoreIndexSignatures(true)},
+		wantErr: "APKO_FORBID_UNSIGNED=1 forbids ignoring the signatures of all repositories",
+	}, {
+		name:    "unsigned repository",
+		opts:    []Option{WithUnsignedRepository(repo+"/", "mirror")},
+		wantErr: "forbids ignoring the signatures of https://example.com/os",
+	}, {
+		name:    "policy",
+		opts:    []Option{WithSignaturePolicy(repo, SignaturePolicy{AllowUnsigned: true})},
+		wantErr: "forbids ignoring the signatures of https://example.com/os",
+	}, {
+		name:    "local indexes",
+		opts:    []Option{WithLocalIndexSynthesis(true)},
+		wantErr: "forbids ignoring the signatures of the synthesized indexes of local repositories",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(ForbidUnsignedEnv, "1")
+			_, err := New(ctx, append([]Option{WithFS(apkfs.NewMemFS())}, tc.opts...)...)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+			require.ErrorIs(t, err, ErrSignatureInvalid)
+
+			// Without the lockout, the same options are accepted.
+			t.Setenv(ForbidUnsignedEnv, "")
+			_, err = New(ctx, append([]Option{WithFS(apkfs.NewMemFS())}, tc.opts...)...)
+			require.NoError(t, err)
+		})
+	}
+
+	t.Setenv(ForbidUnsignedEnv, "1")
+	_, err = GetRepositoryIndexes(ctx, []string{repo}, nil, "x86_64", WithIgnoreSignatures(true))
+	require.ErrorContains(t, err, "forbids ignoring the signatures of all repositories")
+	_, err = GetRepositoryIndexes(ctx, []string{repo}, nil, "x86_64", WithLocalIndexes(true))
+	require.ErrorContains(t, err, "forbids ignoring the signatures of the synthesized indexes of local repositories")
+}
+
+func TestVerifySignaturesFIPS(t *testing.T) {
+	ctx := context.Background()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	keys := map[string][]byte{"test.rsa.pub": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})}
+
+	data := []byte("APKINDEX")
+	sign := func(h crypto.Hash) Signature {
+		d := h.New()
+		d.Write(data)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, h, d.Sum(nil))
+		require.NoError(t, err)
+		return Signature{KeyID: "test.rsa.pub", Signature: sig, DigestAlgorithm: h}
+	}
+	sha1Sig, sha256Sig := sign(crypto.SHA1), sign(crypto.SHA256)
+
+	v, err := verifySignatures(ctx, digest.NewHasher(false), data, []Signature{sha1Sig}, keys, nil, "index")
+	require.NoError(t, err)
+	require.Equal(t, "RSA-SHA1", v.Algorithm)
+
+	fips := digest.NewHasher(true)
+	_, err = verifySignatures(ctx, fips, data, []Signature{sha1Sig}, keys, nil, "index")
+	require.ErrorIs(t, err, digest.ErrNotApproved)
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+
+	v, err = verifySignatures(ctx, fips, data, []Signature{sha1Sig, sha256Sig}, keys, nil, "index")
+	require.NoError(t, err)
+	require.Equal(t, "RSA-SHA256", v.Algorithm)
+}
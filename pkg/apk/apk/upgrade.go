@@ -0,0 +1,269 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// alpineDBPath is where the apk-tools of Alpine releases keep the database,
+// rather than under /usr.
+const alpineDBPath = "lib/apk/db"
+
+// adoptAlpineDatabase moves the database of a root installed by the
+// apk-tools of an Alpine release from /lib/apk/db to /usr/lib/apk/db, so
+// that its packages are known when applying a new world to it. /lib/apk is
+// then left as a symlink to /usr/lib/apk, so that the apk of the release
+// still finds the database where it keeps it. It does nothing if /lib/apk is
+// not a directory, as in a root apk installed, or if the root already has a
+// database under /usr.
+func (a *APK) adoptAlpineDatabase(ctx context.Context) error {
+	if fi, err := a.fs.Lstat("lib/apk"); err != nil || !fi.IsDir() {
+		return nil
+	}
+	if _, err := a.fs.Stat(installedFilePath); err == nil {
+		return nil
+	}
+	entries, err := a.fs.ReadDir(alpineDBPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading %s: %w", alpineDBPath, err)
+	}
+
+	clog.FromContext(ctx).Infof("moving the apk database from /%s to /%s", alpineDBPath, path.Dir(installedFilePath))
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		from, to := path.Join(alpineDBPath, e.Name()), path.Join(path.Dir(installedFilePath), e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		data, err := a.fs.ReadFile(from)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", from, err)
+		}
+		if err := a.fs.WriteFile(to, data, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("writing %s: %w", to, err)
+		}
+		if err := a.fs.Remove(from); err != nil {
+			return fmt.Errorf("removing %s: %w", from, err)
+		}
+	}
+	return a.resolveApkDB(ctx)
+}
+
+// removeStalePackages removes the installed packages which are not in
+// world, or at another version or build than in world, with the files they
+// installed which no other installed package has, and their scripts and
+// triggers, so that installing world upgrades the root in place. The files
+// of the packages which stay installed are recorded as installed by them.
+func (a *APK) removeStalePackages(ctx context.Context, world []*RepositoryPackage) error {
+	log := clog.FromContext(ctx)
+
+	installed, err := a.GetInstalled()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(installed) == 0 {
+		return nil
+	}
+
+	_, span := otel.Tracer("go-apk").Start(ctx, "removeStalePackages")
+	defer span.End()
+
+	wanted := make(map[string]*RepositoryPackage, len(world))
+	for _, pkg := range world {
+		wanted[pkg.Name] = pkg
+	}
+
+	var kept, removed []*InstalledPackage
+	for _, ip := range installed {
+		want, ok := wanted[ip.Name]
+		switch {
+		case !ok:
+			log.Infof("removing %s-%s, which is not in the world", ip.Name, ip.Version)
+		case want.Version != ip.Version:
+			log.Infof("upgrading %s from %s to %s", ip.Name, ip.Version, want.Version)
+		case len(want.Checksum) > 0 && len(ip.Checksum) > 0 && !bytes.Equal(want.Checksum, ip.Checksum):
+			log.Infof("reinstalling %s-%s, which was rebuilt", ip.Name, ip.Version)
+		default:
+			kept = append(kept, ip)
+			continue
+		}
+		removed = append(removed, ip)
+	}
+	span.SetAttributes(attribute.Int("kept", len(kept)), attribute.Int("removed", len(removed)))
+
+	for _, ip := range kept {
+		for _, f := range ip.Files {
+			if f.Typeflag != tar.TypeDir {
+				a.installedFiles[f.Name] = &ip.Package
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	return a.uninstall(ctx, kept, removed)
+}
+
+// uninstall removes the removed packages from the root and its database,
+// with their files which none of the kept packages has.
+func (a *APK) uninstall(ctx context.Context, kept, removed []*InstalledPackage) error {
+	keptFiles := map[string]bool{}
+	for _, ip := range kept {
+		for _, f := range ip.Files {
+			keptFiles[f.Name] = true
+		}
+	}
+	for _, ip := range removed {
+		for _, f := range ip.Files {
+			if !keptFiles[f.Name] {
+				delete(a.installedFiles, f.Name)
+			}
+		}
+	}
+
+	if err := a.removeFiles(ctx, removed, keptFiles); err != nil {
+		return err
+	}
+	return a.rewriteDatabase(removed)
+}
+
+// removeFiles removes the files of pkgs which are not in keep, and then
+// their directories which are neither in keep nor left with files.
+func (a *APK) removeFiles(ctx context.Context, pkgs []*InstalledPackage, keep map[string]bool) error {
+	var dirs []string
+	for _, ip := range pkgs {
+		for _, f := range ip.Files {
+			if keep[f.Name] {
+				continue
+			}
+			if f.Typeflag == tar.TypeDir {
+				dirs = append(dirs, f.Name)
+				continue
+			}
+			if err := a.fs.Remove(f.Name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("removing %s of %s: %w", f.Name, ip.Name, err)
+			}
+			trace.SpanFromContext(ctx).AddEvent("remove", trace.WithAttributes(attribute.String("package", ip.Name), attribute.String("path", f.Name)))
+		}
+	}
+
+	// Remove the deepest directories first, so that their parents may be
+	// left empty.
+	slices.SortFunc(dirs, func(a, b string) int {
+		return strings.Count(b, "/") - strings.Count(a, "/")
+	})
+	for _, dir := range slices.Compact(dirs) {
+		entries, err := a.fs.ReadDir(dir)
+		if err != nil || len(entries) != 0 {
+			continue
+		}
+		if err := a.fs.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing directory %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// rewriteDatabase drops the entries, scripts and triggers of the removed
+// packages from the database. The entries of the other packages are kept as
+// they are, with any field apko does not parse.
+func (a *APK) rewriteDatabase(removed []*InstalledPackage) error {
+	isRemoved := func(checksum []byte) bool {
+		return slices.ContainsFunc(removed, func(ip *InstalledPackage) bool {
+			return bytes.Equal(ip.Checksum, checksum)
+		})
+	}
+
+	db, err := ReadDatabase(a.fs)
+	if err != nil {
+		return fmt.Errorf("reading the apk database: %w", err)
+	}
+
+	raw, err := a.fs.ReadFile(installedFilePath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", installedFilePath, err)
+	}
+	var installed bytes.Buffer
+	for _, entry := range strings.Split(strings.Trim(string(raw), "\n"), "\n\n") {
+		if entry == "" || slices.ContainsFunc(removed, func(ip *InstalledPackage) bool {
+			return slices.Contains(strings.Split(entry, "\n"), "P:"+ip.Name)
+		}) {
+			continue
+		}
+		installed.WriteString(entry + "\n\n")
+	}
+	var scripts bytes.Buffer
+	if err := WriteScripts(&scripts, slices.DeleteFunc(db.Scripts, func(s Script) bool { return isRemoved(s.Checksum) })...); err != nil {
+		return fmt.Errorf("writing scripts: %w", err)
+	}
+	var triggers bytes.Buffer
+	if err := WriteTriggers(&triggers, slices.DeleteFunc(db.Triggers, func(t Trigger) bool { return isRemoved(t.Checksum) })...); err != nil {
+		return fmt.Errorf("writing triggers: %w", err)
+	}
+
+	for _, f := range []struct {
+		path string
+		data []byte
+	}{
+		{installedFilePath, installed.Bytes()},
+		{scriptsFilePath, scripts.Bytes()},
+		{triggersFilePath, triggers.Bytes()},
+	} {
+		if err := a.writeDatabaseFile(f.path, f.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDatabaseFile replaces the database file at name with data, keeping
+// its permissions.
+func (a *APK) writeDatabaseFile(name string, data []byte) error {
+	perm := fs.FileMode(0o644)
+	if fi, err := a.fs.Stat(name); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := a.fs.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", name, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return f.Close()
+}
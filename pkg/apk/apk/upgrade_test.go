@@ -0,0 +1,156 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// writeTestRepository writes a local repository of pkgs, with an unsigned
+// index, to dir.
+func writeTestRepository(t *testing.T, dir, arch string, pkgs ...InstallablePackage) {
+	t.Helper()
+	archDir := filepath.Join(dir, arch)
+	require.NoError(t, os.MkdirAll(archDir, 0o755))
+	b := NewIndexBuilder()
+	for _, ip := range pkgs {
+		data, err := os.ReadFile(ip.URL())
+		require.NoError(t, err)
+		pkg, _, err := b.AddPackage(bytes.NewReader(data))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(archDir, pkg.Filename()), data, 0o644))
+	}
+	f, err := os.Create(filepath.Join(archDir, "APKINDEX.tar.gz"))
+	require.NoError(t, err)
+	require.NoError(t, b.Write(f, "", ""))
+	require.NoError(t, f.Close())
+}
+
+func TestFixateWorldUpgrade(t *testing.T) {
+	src := apkfs.NewMemFS()
+	arch := ArchToAPK(runtime.GOARCH)
+
+	app := func(version, content string) InstallablePackage {
+		return fakePackage(t, &Package{Name: "app", Version: version, Arch: arch, Origin: "app"}, []testDirEntry{
+			{"etc", 0o755, true, nil, nil},
+			{"etc/app", 0o755, true, nil, nil},
+			{"etc/app/app.conf", 0o644, false, []byte(content), nil},
+			{"usr", 0o755, true, nil, nil},
+			{"usr/share", 0o755, true, nil, nil},
+			{"usr/share/app-" + version, 0o755, true, nil, nil},
+			{"usr/share/app-" + version + "/README", 0o644, false, []byte(version), nil},
+		})
+	}
+	tool := fakePackage(t, &Package{Name: "tool", Version: "1.0-r0", Arch: arch, Origin: "tool"}, []testDirEntry{
+		{"etc", 0o755, true, nil, nil},
+		{"etc/tool.conf", 0o644, false, []byte("tool"), nil},
+	})
+	extra := fakePackage(t, &Package{Name: "extra", Version: "1.0-r0", Arch: arch, Origin: "extra"}, []testDirEntry{
+		{"etc", 0o755, true, nil, nil},
+		{"etc/extra.conf", 0o644, false, []byte("extra"), nil},
+	})
+
+	// fixate applies world to the root, from a repository of pkgs, as a
+	// build on top of the root does.
+	fixate := func(world []string, pkgs ...InstallablePackage) ([]*Package, *APK) {
+		repo := t.TempDir()
+		writeTestRepository(t, repo, arch, pkgs...)
+		a, err := New(t.Context(), WithFS(src), WithArch(arch), WithIgnoreMknodErrors(ignoreMknodErrors), WithIgnoreIndexSignatures(true))
+		require.NoError(t, err)
+		require.NoError(t, a.InitDB(t.Context()))
+		require.NoError(t, a.SetRepositories(t.Context(), []string{repo}))
+		require.NoError(t, a.SetWorld(t.Context(), world))
+		installed, err := a.FixateWorld(t.Context(), nil)
+		require.NoError(t, err)
+		return installed, a
+	}
+	names := func(pkgs []*Package) []string {
+		var names []string
+		for _, pkg := range pkgs {
+			require.NotNil(t, pkg)
+			names = append(names, pkg.Name+"-"+pkg.Version)
+		}
+		slices.Sort(names)
+		return names
+	}
+	installedNames := func(a *APK) []string {
+		installed, err := a.GetInstalled()
+		require.NoError(t, err)
+		var pkgs []*Package
+		for _, ip := range installed {
+			pkgs = append(pkgs, &ip.Package)
+		}
+		return names(pkgs)
+	}
+
+	got, _ := fixate([]string{"app", "extra"}, app("1.0-r0", "v1"), tool, extra)
+	require.Equal(t, []string{"app-1.0-r0", "extra-1.0-r0"}, names(got))
+
+	// A world without extra, and with a newer app and tool, removes extra
+	// and the older app, and keeps what is left installed.
+	got, a := fixate([]string{"app", "tool"}, app("2.0-r0", "v2"), tool, extra)
+	require.Equal(t, []string{"app-2.0-r0", "tool-1.0-r0"}, names(got))
+	require.Equal(t, []string{"app-2.0-r0", "tool-1.0-r0"}, installedNames(a))
+	for _, name := range []string{"etc/extra.conf", "usr/share/app-1.0-r0"} {
+		_, err := src.Stat(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+	}
+	conf, err := src.ReadFile("etc/app/app.conf")
+	require.NoError(t, err)
+	require.Equal(t, "v2", string(conf))
+
+	// The packages of the world which are installed are kept, and are part
+	// of the result.
+	got, a = fixate([]string{"app", "tool"}, app("2.0-r0", "v2"), tool)
+	require.Equal(t, []string{"app-2.0-r0", "tool-1.0-r0"}, names(got))
+	require.Equal(t, []string{"app-2.0-r0", "tool-1.0-r0"}, installedNames(a))
+	for _, name := range []string{"etc/tool.conf", "usr/share/app-2.0-r0/README"} {
+		_, err := src.Stat(name)
+		require.NoError(t, err, name)
+	}
+}
+
+func TestAdoptAlpineDatabase(t *testing.T) {
+	src := apkfs.NewMemFS()
+	require.NoError(t, src.MkdirAll(alpineDBPath, 0o755))
+	installed := "P:busybox\nV:1.36.1-r5\nA:x86_64\nF:bin\nR:busybox\n\n"
+	require.NoError(t, src.WriteFile(alpineDBPath+"/installed", []byte(installed), 0o644))
+
+	a, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors))
+	require.NoError(t, err)
+	require.NoError(t, a.InitDB(t.Context()))
+
+	got, err := src.ReadFile(installedFilePath)
+	require.NoError(t, err)
+	require.Equal(t, installed, string(got))
+
+	// The apk of the release still finds the database at /lib/apk/db.
+	target, err := src.Readlink("lib/apk")
+	require.NoError(t, err)
+	require.Equal(t, "../usr/lib/apk", target)
+	got, err = src.ReadFile(alpineDBPath + "/installed")
+	require.NoError(t, err)
+	require.Equal(t, installed, string(got))
+}
@@ -189,6 +189,17 @@ const (
 	less    = -1
 )
 
+// CompareVersionStrings compares two package versions like CompareVersions,
+// falling back to comparing them as strings when either doesn't parse.
+func CompareVersionStrings(a, b string) int {
+	va, erra := ParseVersion(a)
+	vb, errb := ParseVersion(b)
+	if erra != nil || errb != nil {
+		return strings.Compare(a, b)
+	}
+	return CompareVersions(va, vb)
+}
+
 // CompareVersions compares versions based on https://dev.gentoo.org/~ulm/pms/head/pms.html#x1-250003.2
 func CompareVersions(actual, required Version) int {
 	for i := 0; i < len(actual.numbers) && i < len(required.numbers); i++ {
@@ -861,6 +861,13 @@ func TestCompareVersion(t *testing.T) {
 	}
 }
 
+func TestCompareVersionStrings(t *testing.T) {
+	require.Equal(t, less, CompareVersionStrings("2.0-r0", "10.0-r0"))
+	require.Equal(t, equal, CompareVersionStrings("1.0-r0", "1.0-r0"))
+	// versions which don't parse are compared as strings
+	require.Equal(t, greater, CompareVersionStrings("2.0-r0", "10.0-bad"))
+}
+
 func TestResolveVersion(t *testing.T) {
 	pinPackage := testNamedPackageFromVersionAndPin("2.1.0", "pinA")
 	lowestPackage := testNamedPackageFromVersionAndPin("1.2.3-r0", "")
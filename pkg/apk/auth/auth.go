@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strings"
@@ -18,16 +19,26 @@ import (
 var DefaultAuthenticators Authenticator = multiAuthenticator{
 	// First, we'll try to use the HTTP_AUTH environment variable if it's set.
 	EnvAuth{},
+	// Then the credential helpers configured by APKO_CREDENTIAL_HELPERS.
+	CredentialHelpersFromEnv(),
+	// Then the credentials for the host in ~/.netrc, or the file NETRC names.
+	NetrcAuth{},
+	// Then the credentials saved by "apko repository login".
+	NewStoredAuth(""),
+	// Then tokens from the OAuth2 token endpoint configured by APKO_OAUTH2_*.
+	OAuth2AuthFromEnv(),
 	// If both of these envs are set, we'll try to use the k8s token first.
 	NewK8sAuth(os.Getenv("K8S_TOKEN_PATH"), os.Getenv("CHAINGUARD_IDENTITY"), "https://issuer.enforce.dev", "apk.cgr.dev"),
 	// If only the identity env is set, and k8s auth didn't work, we'll try to use exchanged GCP auth.
 	NewChainguardIdentityAuth(os.Getenv("CHAINGUARD_IDENTITY"), "https://issuer.enforce.dev", "apk.cgr.dev"),
 	// If nothing has worked yet, we'll try to use chainctl.
 	CGRAuth{},
+	// Finally, the default entry of the netrc file, for any other host.
+	NetrcAuth{Default: true},
 }
 
-// Authenticator is an interface for types that can add HTTP basic auth to a
-// request.
+// Authenticator is an interface for types that can add HTTP basic auth, or
+// another kind of authorization, to a request.
 type Authenticator interface {
 	AddAuth(ctx context.Context, req *http.Request) error
 }
@@ -44,7 +55,7 @@ type multiAuthenticator []Authenticator
 func (m multiAuthenticator) AddAuth(ctx context.Context, req *http.Request) error {
 	var merr error
 	for _, a := range m {
-		if _, _, ok := req.BasicAuth(); ok {
+		if hasAuth(req) {
 			// The request has auth, so we can stop here.
 			return nil
 		}
@@ -55,28 +66,64 @@ func (m multiAuthenticator) AddAuth(ctx context.Context, req *http.Request) erro
 	}
 
 	// One last check at the end to see if we added auth, else return the aggregated error.
-	if _, _, ok := req.BasicAuth(); ok {
+	if hasAuth(req) {
 		return nil
 	}
 	return merr
 }
 
+// hasAuth reports whether an authenticator added auth to the request, either
+// HTTP basic auth or another scheme such as a bearer token or a signature.
+func hasAuth(req *http.Request) bool {
+	return req.Header.Get("Authorization") != ""
+}
+
 // EnvAuth adds HTTP basic auth to the request if the request URL matches the
 // HTTP_AUTH environment variable.
+//
+// HTTP_AUTH holds comma separated credentials of the form
+// basic:<host>[/<path>]:<user>:<pass>, where a comma only separates
+// credentials when it is followed by basic:, so that passwords can have
+// commas. With a path, the credentials are only
+// added to requests under it, so that repositories on the same host can use
+// different credentials. The credentials with the longest matching path win.
 type EnvAuth struct{}
 
 func (e EnvAuth) AddAuth(_ context.Context, req *http.Request) error {
-	env := os.Getenv("HTTP_AUTH")
-	parts := strings.Split(env, ":")
-	if len(parts) != 4 || parts[0] != "basic" {
-		return nil
+	var (
+		best       *scope
+		user, pass string
+	)
+	for _, cred := range splitEnvAuth(os.Getenv("HTTP_AUTH")) {
+		parts := strings.SplitN(cred, ":", 4)
+		if len(parts) != 4 || parts[0] != "basic" {
+			continue
+		}
+		sc := parseScope(parts[1])
+		if sc.matches(req.URL) && (best == nil || len(sc.path) > len(best.path)) {
+			best, user, pass = &sc, parts[2], parts[3]
+		}
 	}
-	if req.URL.Host == parts[1] {
-		req.SetBasicAuth(parts[2], parts[3])
+	if best != nil {
+		req.SetBasicAuth(user, pass)
 	}
 	return nil
 }
 
+// splitEnvAuth splits the credentials of HTTP_AUTH at the commas followed
+// by basic:, joining back the commas of the passwords.
+func splitEnvAuth(env string) []string {
+	var creds []string
+	for _, part := range strings.Split(env, ",") {
+		if len(creds) > 0 && !strings.HasPrefix(part, "basic:") {
+			creds[len(creds)-1] += "," + part
+			continue
+		}
+		creds = append(creds, part)
+	}
+	return creds
+}
+
 // CGRAuth adds HTTP basic auth to the request if the request URL matches
 // apk.cgr.dev and the `chainctl` command is available.
 //
@@ -130,6 +177,62 @@ func (s staticAuth) AddAuth(_ context.Context, req *http.Request) error {
 	return nil
 }
 
+// ScopedAuth is an Authenticator that adds HTTP basic auth to the request if
+// the request URL is under scope, a host optionally followed by a path
+// prefix, e.g. "example.jfrog.io/artifactory/api/alpine/team-a".
+func ScopedAuth(scope, user, pass string) Authenticator {
+	return scopedAuth{parseScope(scope), user, pass}
+}
+
+type scopedAuth struct {
+	scope      scope
+	user, pass string
+}
+
+func (s scopedAuth) AddAuth(_ context.Context, req *http.Request) error {
+	if s.scope.matches(req.URL) {
+		req.SetBasicAuth(s.user, s.pass)
+	}
+	return nil
+}
+
+// scope is a host, and optionally a path prefix under it, that credentials
+// are limited to.
+type scope struct{ host, path string }
+
+func parseScope(s string) scope {
+	host, path, _ := strings.Cut(s, "/")
+	return scope{host: host, path: strings.TrimRight("/"+path, "/")}
+}
+
+// matches reports whether u is on the host of the scope, at or below its
+// path prefix.
+func (s scope) matches(u *url.URL) bool {
+	if u.Host != s.host {
+		return false
+	}
+	return s.path == "" || u.Path == s.path || strings.HasPrefix(u.Path, s.path+"/")
+}
+
+// NewScopedAuth returns an Authenticator that adds the auth of a to the
+// requests in scope, a host optionally followed by a path, e.g.
+// "example.com/packages", and leaves the other requests alone.
+func NewScopedAuth(scope string, a Authenticator) Authenticator {
+	return scopedAuthenticator{scope: parseScope(scope), auth: a}
+}
+
+type scopedAuthenticator struct {
+	scope scope
+	auth  Authenticator
+}
+
+func (s scopedAuthenticator) AddAuth(ctx context.Context, req *http.Request) error {
+	if !s.scope.matches(req.URL) {
+		return nil
+	}
+	return s.auth.AddAuth(ctx, req)
+}
+
 // NewTokenSourceAuth creates a new Authenticator that uses the given
 // oauth2.TokenSource to get a token and adds it to the request as HTTP basic
 // auth.
@@ -143,14 +246,38 @@ type tokenSourceAuth struct {
 	ts     oauth2.TokenSource
 }
 
-func (t *tokenSourceAuth) AddAuth(_ context.Context, req *http.Request) error {
+func (t *tokenSourceAuth) AddAuth(ctx context.Context, req *http.Request) error {
 	if req.Host != t.domain {
 		return nil
 	}
-	tok, err := t.ts.Token()
+	tok, err := tokenContext(ctx, t.ts)
 	if err != nil {
 		return err
 	}
 	req.SetBasicAuth(t.user, tok.AccessToken)
 	return nil
 }
+
+// tokenContext returns a token from ts, or the error of ctx once it is done.
+// oauth2.TokenSource takes no context, so a token still being fetched then
+// is left to the source.
+func tokenContext(ctx context.Context, ts oauth2.TokenSource) (*oauth2.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		tok *oauth2.Token
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		tok, err := ts.Token()
+		ch <- result{tok, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.tok, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -3,7 +3,12 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -70,3 +75,254 @@ func TestMultiAuthenticator(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvAuth(t *testing.T) {
+	t.Setenv("HTTP_AUTH", "basic:example.com:all:secret,basic:example.com/api/team-a:a:secret,a,basic:example.com/api/team-a/nested:nested:secret-nested")
+
+	for _, tt := range []struct {
+		url      string
+		wantUser string
+		wantPass string
+	}{
+		{url: "https://example.com/api/team-a/x86_64/APKINDEX.tar.gz", wantUser: "a", wantPass: "secret,a"},
+		{url: "https://example.com/api/team-a/nested/x86_64/APKINDEX.tar.gz", wantUser: "nested", wantPass: "secret-nested"},
+		{url: "https://example.com/api/team-ab/x86_64/APKINDEX.tar.gz", wantUser: "all", wantPass: "secret"},
+		{url: "https://other.example.com/api/team-a/x86_64/APKINDEX.tar.gz"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if err := (EnvAuth{}).AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			if user, pass, _ := req.BasicAuth(); user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("got %q:%q, want %q:%q", user, pass, tt.wantUser, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestScopedAuth(t *testing.T) {
+	a := ScopedAuth("example.com/api/team-a/", "a", "secret")
+	for _, tt := range []struct {
+		url      string
+		wantAuth bool
+	}{
+		{url: "https://example.com/api/team-a", wantAuth: true},
+		{url: "https://example.com/api/team-a/x86_64/APKINDEX.tar.gz", wantAuth: true},
+		{url: "https://example.com/api/team-b/x86_64/APKINDEX.tar.gz"},
+		{url: "https://example.org/api/team-a/x86_64/APKINDEX.tar.gz"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if err := a.AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			if _, _, ok := req.BasicAuth(); ok != tt.wantAuth {
+				t.Errorf("got auth %t, want %t", ok, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestNetrcAuth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	if err := os.WriteFile(path, []byte(`# credentials
+machine example.com login alice password secret-a
+macdef init
+login mallory password nope
+
+machine registry.example.com:8443
+  login bob
+  password secret-b
+default login anonymous password guest
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		auth     NetrcAuth
+		url      string
+		wantUser string
+		wantPass string
+	}{
+		{name: "machine", auth: NetrcAuth{Path: path}, url: "https://example.com/os/APKINDEX.tar.gz", wantUser: "alice", wantPass: "secret-a"},
+		{name: "port", auth: NetrcAuth{Path: path}, url: "https://registry.example.com:8443/os/APKINDEX.tar.gz", wantUser: "bob", wantPass: "secret-b"},
+		{name: "no default", auth: NetrcAuth{Path: path}, url: "https://other.example.com/os/APKINDEX.tar.gz"},
+		{name: "default", auth: NetrcAuth{Path: path, Default: true}, url: "https://other.example.com/os/APKINDEX.tar.gz", wantUser: "anonymous", wantPass: "guest"},
+		{name: "env", url: "https://example.com/os/APKINDEX.tar.gz", wantUser: "alice", wantPass: "secret-a"},
+		{name: "missing", auth: NetrcAuth{Path: filepath.Join(t.TempDir(), "missing")}, url: "https://example.com/os/APKINDEX.tar.gz"},
+		{name: "unreadable", auth: NetrcAuth{Path: t.TempDir()}, url: "https://example.com/os/APKINDEX.tar.gz"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NETRC", path)
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if err := tt.auth.AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			user, pass, _ := req.BasicAuth()
+			if user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("got %q:%q, want %q:%q", user, pass, tt.wantUser, tt.wantPass)
+			}
+		})
+	}
+}
+
+func TestOAuth2Auth(t *testing.T) {
+	subjectFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(subjectFile, []byte("subject-1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		expiresIn int
+		exchange  bool
+		wantFetch int
+	}{
+		{name: "cached", expiresIn: 3600, wantFetch: 1},
+		{name: "refreshed", expiresIn: 30, wantFetch: 2},
+		{name: "exchange", expiresIn: 30, exchange: true, wantFetch: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := r.ParseForm(); err != nil {
+					t.Error(err)
+				}
+				fetches++
+				if tt.exchange {
+					if got := r.Form.Get("grant_type"); got != tokenExchangeGrantType {
+						t.Errorf("got grant type %q", got)
+					}
+					if got, want := r.Form.Get("subject_token"), fmt.Sprintf("subject-%d", fetches); got != want {
+						t.Errorf("got subject token %q, want %q", got, want)
+					}
+				} else if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+					t.Errorf("got client %q:%q", id, secret)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "bearer", "expires_in": %d}`, fetches, tt.expiresIn)
+			}))
+			defer s.Close()
+
+			cfg := OAuth2Config{Scope: "example.com/internal", TokenURL: s.URL}
+			if tt.exchange {
+				cfg.SubjectTokenFile = subjectFile
+			} else {
+				cfg.ClientID, cfg.ClientSecret = "client", "secret"
+			}
+			a := NewOAuth2Auth(cfg)
+
+			for i := 1; i <= 2; i++ {
+				if tt.exchange {
+					if err := os.WriteFile(subjectFile, []byte(fmt.Sprintf("subject-%d", i)), 0o600); err != nil {
+						t.Fatal(err)
+					}
+				}
+				req, _ := http.NewRequest("GET", "https://example.com/internal/x86_64/APKINDEX.tar.gz", nil)
+				if err := a.AddAuth(context.Background(), req); err != nil {
+					t.Fatalf("AddAuth: %v", err)
+				}
+				if user, pass, _ := req.BasicAuth(); user != "user" || pass != fmt.Sprintf("token-%d", fetches) {
+					t.Errorf("got %q:%q", user, pass)
+				}
+			}
+			if fetches != tt.wantFetch {
+				t.Errorf("got %d token fetches, want %d", fetches, tt.wantFetch)
+			}
+
+			// Requests outside the scope get no token.
+			req, _ := http.NewRequest("GET", "https://example.com/public/x86_64/APKINDEX.tar.gz", nil)
+			if err := a.AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			if _, _, ok := req.BasicAuth(); ok {
+				t.Error("got auth outside the scope")
+			}
+		})
+	}
+}
+
+func TestOAuth2AuthContext(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		t.Error("fetched a token for a canceled request")
+	}))
+	defer s.Close()
+
+	// The token is fetched with the context of the request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := NewOAuth2Auth(OAuth2Config{Scope: "example.com", TokenURL: s.URL})
+	req, _ := http.NewRequest("GET", "https://example.com/x86_64/APKINDEX.tar.gz", nil)
+	if err := a.AddAuth(ctx, req); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+
+	// A token endpoint without a host to send its tokens to is an error.
+	t.Setenv("APKO_OAUTH2_TOKEN_URL", s.URL)
+	t.Setenv("APKO_OAUTH2_HOST", "")
+	if err := OAuth2AuthFromEnv().AddAuth(context.Background(), req); err == nil || !strings.Contains(err.Error(), "APKO_OAUTH2_HOST") {
+		t.Errorf("got %v, want an error about APKO_OAUTH2_HOST", err)
+	}
+}
+
+func TestCredentialHelper(t *testing.T) {
+	dir := t.TempDir()
+	calls := filepath.Join(dir, "calls")
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$1 $2" >> %q
+case "$2" in
+  https://example.com/team-a/*) echo '{"Username": "ci", "Secret": "secret-a"}' ;;
+  https://example.com/broken/*) echo "store is locked" >&2; exit 1 ;;
+esac
+`, calls)
+	if err := os.WriteFile(filepath.Join(dir, "apko-credential-test"), []byte(script), 0o755); err != nil { //nolint:gosec
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("APKO_CREDENTIAL_HELPERS", "example.com=test,example.com/team-b=missing")
+	a := CredentialHelpersFromEnv()
+
+	for _, tt := range []struct {
+		url      string
+		wantUser string
+		wantPass string
+		wantErr  bool
+	}{
+		{url: "https://example.com/team-a/x86_64/APKINDEX.tar.gz", wantUser: "ci", wantPass: "secret-a"},
+		// Cached for the same directory.
+		{url: "https://example.com/team-a/x86_64/busybox-1.36.1-r0.apk", wantUser: "ci", wantPass: "secret-a"},
+		{url: "https://example.com/other/x86_64/APKINDEX.tar.gz"},
+		{url: "https://example.com/broken/x86_64/APKINDEX.tar.gz", wantErr: true},
+		// The more specific helper does not exist.
+		{url: "https://example.com/team-b/x86_64/APKINDEX.tar.gz", wantErr: true},
+		{url: "https://example.org/team-a/x86_64/APKINDEX.tar.gz"},
+	} {
+		t.Run(tt.url, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			err := a.AddAuth(context.Background(), req)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			user, pass, _ := req.BasicAuth()
+			if user != tt.wantUser || pass != tt.wantPass {
+				t.Errorf("got %q:%q, want %q:%q", user, pass, tt.wantUser, tt.wantPass)
+			}
+		})
+	}
+
+	b, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "get https://example.com/team-a/x86_64/APKINDEX.tar.gz\nget https://example.com/other/x86_64/APKINDEX.tar.gz\nget https://example.com/broken/x86_64/APKINDEX.tar.gz\n"; got != want {
+		t.Errorf("got helper calls:\n%s\nwant:\n%s", got, want)
+	}
+}
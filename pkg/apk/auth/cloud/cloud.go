@@ -0,0 +1,185 @@
+// Package cloud provides repository Authenticators that use the short-lived
+// credentials of the GCP, AWS or Azure environment apko runs in.
+//
+// It is its own module, so that programs which don't use it don't depend on
+// the cloud SDKs. Programs opt in by adding its authenticators, e.g.
+//
+//	auth.DefaultAuthenticators = auth.MultiAuthenticator(cloud.AuthFromEnv(), auth.DefaultAuthenticators)
+package cloud
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"chainguard.dev/apko/pkg/apk/auth"
+)
+
+const (
+	gcpStorageScope   = "https://www.googleapis.com/auth/devstorage.read_only"
+	azureStorageScope = "https://storage.azure.com/.default"
+	// azureStorageVersion is the Blob Storage API version sent with bearer
+	// tokens, which older versions don't accept.
+	azureStorageVersion = "2020-04-08"
+)
+
+// emptyPayloadHash is the SHA-256 of the empty body of repository requests.
+var emptyPayloadHash = func() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}()
+
+// AuthFromEnv returns the cloud Authenticators enabled by the
+// APKO_GCP_AUTH, APKO_AWS_AUTH and APKO_AZURE_AUTH environment variables,
+// each a comma separated list of hosts, optionally followed by a path, whose
+// requests carry credentials from the ambient cloud environment.
+func AuthFromEnv() auth.Authenticator {
+	var auths []auth.Authenticator
+	for _, s := range envScopes("APKO_GCP_AUTH") {
+		auths = append(auths, NewGCPAuth(s))
+	}
+	for _, s := range envScopes("APKO_AWS_AUTH") {
+		auths = append(auths, NewAWSAuth(s, os.Getenv("APKO_AWS_AUTH_REGION")))
+	}
+	for _, s := range envScopes("APKO_AZURE_AUTH") {
+		auths = append(auths, NewAzureAuth(s))
+	}
+	return auth.MultiAuthenticator(auths...)
+}
+
+func envScopes(key string) []string {
+	var scopes []string
+	for _, s := range strings.Split(os.Getenv(key), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// NewGCPAuth returns an Authenticator that adds an OAuth2 access token from
+// the Application Default Credentials, such as the GCE metadata server or
+// gcloud, as a bearer token to the requests in scope, e.g.
+// "storage.googleapis.com/my-bucket".
+func NewGCPAuth(scope string) auth.Authenticator {
+	return auth.NewScopedAuth(scope, &gcpAuth{})
+}
+
+type gcpAuth struct {
+	once sync.Once
+	ts   oauth2.TokenSource
+	err  error
+}
+
+func (g *gcpAuth) AddAuth(ctx context.Context, req *http.Request) error {
+	g.once.Do(func() {
+		if g.ts != nil {
+			return
+		}
+		g.ts, g.err = google.DefaultTokenSource(context.WithoutCancel(ctx), gcpStorageScope)
+	})
+	if g.err != nil {
+		return fmt.Errorf("finding GCP application default credentials: %w", g.err)
+	}
+	tok, err := g.ts.Token()
+	if err != nil {
+		return fmt.Errorf("getting GCP access token: %w", err)
+	}
+	tok.SetAuthHeader(req)
+	return nil
+}
+
+// NewAWSAuth returns an Authenticator that signs the requests in scope, e.g.
+// "my-bucket.s3.us-east-1.amazonaws.com", for S3 with AWS Signature Version
+// 4, using the credentials of the default AWS configuration: environment
+// variables, shared config files, or the instance or task role. The region
+// of the default configuration is used if region is empty.
+func NewAWSAuth(scope, region string) auth.Authenticator {
+	return auth.NewScopedAuth(scope, &awsAuth{region: region})
+}
+
+type awsAuth struct {
+	region string
+
+	once  sync.Once
+	creds aws.CredentialsProvider
+	err   error
+}
+
+func (a *awsAuth) AddAuth(ctx context.Context, req *http.Request) error {
+	a.once.Do(func() {
+		if a.creds != nil {
+			return
+		}
+		cfg, err := config.LoadDefaultConfig(context.WithoutCancel(ctx))
+		if err != nil {
+			a.err = err
+			return
+		}
+		a.creds = cfg.Credentials
+		if a.region == "" {
+			a.region = cfg.Region
+		}
+	})
+	if a.err != nil {
+		return fmt.Errorf("loading AWS configuration: %w", a.err)
+	}
+	creds, err := a.creds.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("getting AWS credentials: %w", err)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, emptyPayloadHash, "s3", a.region, time.Now()); err != nil {
+		return fmt.Errorf("signing request for AWS: %w", err)
+	}
+	return nil
+}
+
+// NewAzureAuth returns an Authenticator that adds a Microsoft Entra token
+// for Azure Storage from the default Azure credential chain, which includes
+// managed identities, as a bearer token to the requests in scope, e.g.
+// "myaccount.blob.core.windows.net/packages".
+func NewAzureAuth(scope string) auth.Authenticator {
+	return auth.NewScopedAuth(scope, &azureAuth{})
+}
+
+type azureAuth struct {
+	once sync.Once
+	cred azcore.TokenCredential
+	err  error
+}
+
+func (a *azureAuth) AddAuth(ctx context.Context, req *http.Request) error {
+	a.once.Do(func() {
+		if a.cred != nil {
+			return
+		}
+		a.cred, a.err = azidentity.NewDefaultAzureCredential(nil)
+	})
+	if a.err != nil {
+		return fmt.Errorf("finding Azure credentials: %w", a.err)
+	}
+	// The credential caches tokens until shortly before they expire.
+	tok, err := a.cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureStorageScope}})
+	if err != nil {
+		return fmt.Errorf("getting Azure access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.Token)
+	req.Header.Set("X-Ms-Version", azureStorageVersion)
+	return nil
+}
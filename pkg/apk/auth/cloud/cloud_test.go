@@ -0,0 +1,78 @@
+package cloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"golang.org/x/oauth2"
+
+	"chainguard.dev/apko/pkg/apk/auth"
+)
+
+// basicAuth adds basic auth to every request.
+type basicAuth struct{}
+
+func (basicAuth) AddAuth(_ context.Context, req *http.Request) error {
+	req.SetBasicAuth("user", "pass")
+	return nil
+}
+
+type fakeAzureCredential struct{}
+
+func (fakeAzureCredential) GetToken(_ context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if len(opts.Scopes) != 1 || opts.Scopes[0] != azureStorageScope {
+		return azcore.AccessToken{}, fmt.Errorf("unexpected scopes %v", opts.Scopes)
+	}
+	return azcore.AccessToken{Token: "azure-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestCloudAuth(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		auth       auth.Authenticator
+		url        string
+		wantPrefix string
+	}{{
+		name:       "gcp",
+		auth:       auth.NewScopedAuth("storage.googleapis.com/packages", &gcpAuth{ts: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "gcp-token"})}),
+		url:        "https://storage.googleapis.com/packages/x86_64/APKINDEX.tar.gz",
+		wantPrefix: "Bearer gcp-token",
+	}, {
+		name:       "aws",
+		auth:       auth.NewScopedAuth("packages.s3.us-east-1.amazonaws.com", &awsAuth{region: "us-east-1", creds: credentials.NewStaticCredentialsProvider("AKID", "secret", "")}),
+		url:        "https://packages.s3.us-east-1.amazonaws.com/x86_64/APKINDEX.tar.gz",
+		wantPrefix: "AWS4-HMAC-SHA256 Credential=AKID/",
+	}, {
+		name:       "azure",
+		auth:       auth.NewScopedAuth("account.blob.core.windows.net/packages", &azureAuth{cred: fakeAzureCredential{}}),
+		url:        "https://account.blob.core.windows.net/packages/x86_64/APKINDEX.tar.gz",
+		wantPrefix: "Bearer azure-token",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The cloud credentials win over the authenticators after them.
+			a := auth.MultiAuthenticator(tt.auth, basicAuth{})
+			req, _ := http.NewRequest("GET", tt.url, nil)
+			if err := a.AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("got Authorization %q, want prefix %q", got, tt.wantPrefix)
+			}
+
+			req, _ = http.NewRequest("GET", "https://example.com/x86_64/APKINDEX.tar.gz", nil)
+			if err := tt.auth.AddAuth(context.Background(), req); err != nil {
+				t.Fatalf("AddAuth: %v", err)
+			}
+			if got := req.Header.Get("Authorization"); got != "" {
+				t.Errorf("got Authorization %q outside the scope", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// credentialHelperPrefix prefixes the names of credential helper
+	// executables, which are looked up in PATH.
+	credentialHelperPrefix = "apko-credential-"
+
+	// credentialHelperTTL is how long the credentials returned by a helper
+	// are reused.
+	credentialHelperTTL = 5 * time.Minute
+)
+
+// CredentialHelpersFromEnv returns the credential helper Authenticators
+// configured by the APKO_CREDENTIAL_HELPERS environment variable, a comma
+// separated list of <host>[/<path>]=<helper> entries. The helper with the
+// longest matching path is used.
+func CredentialHelpersFromEnv() Authenticator {
+	var helpers []scopedHelper
+	for _, entry := range strings.Split(os.Getenv("APKO_CREDENTIAL_HELPERS"), ",") {
+		scope, helper, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || scope == "" || helper == "" {
+			continue
+		}
+		helpers = append(helpers, scopedHelper{parseScope(scope), NewCredentialHelperAuth(helper)})
+	}
+	return credentialHelpers(helpers)
+}
+
+type scopedHelper struct {
+	scope  scope
+	helper Authenticator
+}
+
+type credentialHelpers []scopedHelper
+
+func (c credentialHelpers) AddAuth(ctx context.Context, req *http.Request) error {
+	var best *scopedHelper
+	for i, h := range c {
+		if h.scope.matches(req.URL) && (best == nil || len(h.scope.path) > len(best.scope.path)) {
+			best = &c[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.helper.AddAuth(ctx, req)
+}
+
+// NewCredentialHelperAuth returns an Authenticator that gets credentials from
+// the apko-credential-<helper> executable, mirroring docker and git
+// credential helpers, so that secret stores can be used without linking them
+// into apko.
+//
+// The helper is run as "apko-credential-<helper> get <url>" and prints
+// {"Username": "...", "Secret": "..."} as JSON, which is added to the request
+// as HTTP basic auth. Username defaults to "user". A helper which prints
+// nothing has no credentials for the URL. The credentials are reused for the
+// requests to the same directory, such as the index and packages of a
+// repository, for a few minutes.
+func NewCredentialHelperAuth(helper string) Authenticator {
+	return &helperAuth{
+		helper: credentialHelperPrefix + helper,
+		cache:  map[string]helperCredentials{},
+	}
+}
+
+type helperAuth struct {
+	helper string
+
+	mu    sync.Mutex
+	cache map[string]helperCredentials
+}
+
+type helperCredentials struct {
+	Username string
+	Secret   string
+
+	expires time.Time
+}
+
+func (h *helperAuth) AddAuth(ctx context.Context, req *http.Request) error {
+	u := url.URL{Scheme: req.URL.Scheme, Host: req.URL.Host, Path: req.URL.Path}
+	key := u.Scheme + "://" + u.Host + path.Dir(u.Path)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	creds, ok := h.cache[key]
+	if !ok || time.Now().After(creds.expires) {
+		var err error
+		creds, err = h.get(ctx, u.String())
+		if err != nil {
+			return err
+		}
+		creds.expires = time.Now().Add(credentialHelperTTL)
+		h.cache[key] = creds
+	}
+	if creds.Secret == "" {
+		return nil
+	}
+	user := creds.Username
+	if user == "" {
+		user = "user"
+	}
+	req.SetBasicAuth(user, creds.Secret)
+	return nil
+}
+
+// get runs the helper for the URL, which carries no credentials or query.
+func (h *helperAuth) get(ctx context.Context, u string) (helperCredentials, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.helper, "get", u)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return helperCredentials{}, fmt.Errorf("running %s get %s: %w: %s", h.helper, u, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var creds helperCredentials
+	if out := bytes.TrimSpace(stdout.Bytes()); len(out) != 0 {
+		if err := json.Unmarshal(out, &creds); err != nil {
+			return helperCredentials{}, fmt.Errorf("parsing credentials from %s: %w", h.helper, err)
+		}
+	}
+	return creds, nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// NetrcAuth adds HTTP basic auth to the request from the netrc file entry for
+// the request host, or with Default from the default entry of the file, for
+// the requests of any host. The default entry goes last in a chain of
+// authenticators, so that it only applies when nothing else authenticates.
+//
+// The file is read from Path if set, then from the NETRC environment
+// variable, and otherwise from ~/.netrc. It is read once, and a missing file
+// adds no auth.
+type NetrcAuth struct {
+	Path    string
+	Default bool
+}
+
+func (n NetrcAuth) AddAuth(ctx context.Context, req *http.Request) error {
+	path := n.Path
+	if path == "" {
+		path = os.Getenv("NETRC")
+	}
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".netrc")
+	}
+
+	for _, e := range readNetrc(ctx, path) {
+		var match bool
+		if n.Default {
+			match = e.machine == ""
+		} else {
+			match = e.machine == req.URL.Host || e.machine == req.URL.Hostname()
+		}
+		if !match {
+			continue
+		}
+		if e.login != "" || e.password != "" {
+			req.SetBasicAuth(e.login, e.password)
+		}
+		return nil
+	}
+	return nil
+}
+
+// netrcFiles caches the entries of the netrc files read, by path.
+var netrcFiles sync.Map
+
+type netrcFile struct {
+	once    sync.Once
+	entries []netrcEntry
+}
+
+// readNetrc returns the entries of the netrc file at path, reading it the
+// first time only. A file which cannot be read is warned about, rather than
+// failing the requests which need no auth.
+func readNetrc(ctx context.Context, path string) []netrcEntry {
+	v, _ := netrcFiles.LoadOrStore(path, &netrcFile{})
+	f := v.(*netrcFile)
+	f.once.Do(func() {
+		b, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return
+		} else if err != nil {
+			clog.FromContext(ctx).Warnf("ignoring netrc file: %v", err)
+			return
+		}
+		f.entries = parseNetrc(string(b))
+	})
+	return f.entries
+}
+
+// netrcEntry is a machine of a netrc file, or its default entry when machine
+// is empty.
+type netrcEntry struct {
+	machine, login, password string
+}
+
+// parseNetrc returns the entries of a netrc file, skipping comments and macro
+// definitions.
+func parseNetrc(data string) []netrcEntry {
+	var (
+		entries []netrcEntry
+		inMacro bool
+	)
+	for _, line := range strings.Split(data, "\n") {
+		if inMacro {
+			// A macro definition ends with an empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "default":
+				entries = append(entries, netrcEntry{})
+				continue
+			case "macdef":
+				inMacro = true
+			}
+			if inMacro || i+1 >= len(fields) {
+				break
+			}
+			value := fields[i+1]
+			switch fields[i] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: value})
+			case "login":
+				if len(entries) > 0 {
+					entries[len(entries)-1].login = value
+				}
+			case "password":
+				if len(entries) > 0 {
+					entries[len(entries)-1].password = value
+				}
+			}
+			i++
+		}
+	}
+	return entries
+}
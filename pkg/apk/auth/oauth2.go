@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+	jwtTokenType           = "urn:ietf:params:oauth:token-type:jwt"
+
+	// oauth2RefreshEarly is how long before their expiry tokens are refreshed,
+	// so that a token does not expire while a request is in flight.
+	oauth2RefreshEarly = time.Minute
+)
+
+// OAuth2Config configures an Authenticator which fetches tokens from an
+// OAuth2 token endpoint.
+type OAuth2Config struct {
+	// Scope is the host, optionally followed by a path prefix, of the
+	// requests the token is added to, e.g. "apk.example.com/internal".
+	Scope string
+	// TokenURL is the token endpoint.
+	TokenURL string
+	// ClientID and ClientSecret authenticate the client to the endpoint.
+	ClientID, ClientSecret string
+	// Scopes are the OAuth2 scopes requested.
+	Scopes []string
+	// Audience is requested as the audience of the token, when set.
+	Audience string
+	// SubjectTokenFile switches from the client credentials grant to an RFC
+	// 8693 token exchange of the token in the file, such as a projected
+	// service account token. The file is read again for each exchange, so
+	// that rotated tokens are picked up.
+	SubjectTokenFile string
+	// SubjectTokenType is the type of the subject token, a JWT by default.
+	SubjectTokenType string
+	// User is the basic auth user the token is sent as, "user" by default.
+	User string
+}
+
+// NewOAuth2Auth returns an Authenticator that adds a token from the endpoint
+// of cfg as HTTP basic auth to the requests in its scope. Tokens are cached
+// until shortly before they expire, and are then refreshed, so that builds
+// outlasting a token keep working.
+func NewOAuth2Auth(cfg OAuth2Config) Authenticator {
+	user := cfg.User
+	if user == "" {
+		user = "user"
+	}
+	return &oauth2Auth{
+		scope: parseScope(cfg.Scope),
+		user:  user,
+		src:   oauth2Source{cfg},
+	}
+}
+
+// OAuth2AuthFromEnv returns the OAuth2 Authenticator configured by the
+// APKO_OAUTH2_* environment variables, which adds no auth when
+// APKO_OAUTH2_TOKEN_URL is not set. Without APKO_OAUTH2_HOST, the token
+// would be sent nowhere, so every request fails instead.
+func OAuth2AuthFromEnv() Authenticator {
+	if os.Getenv("APKO_OAUTH2_TOKEN_URL") == "" {
+		return MultiAuthenticator()
+	}
+	if os.Getenv("APKO_OAUTH2_HOST") == "" {
+		return errAuthenticator{errors.New("APKO_OAUTH2_TOKEN_URL is set without APKO_OAUTH2_HOST, the repositories to send its tokens to")}
+	}
+	var scopes []string
+	if s := os.Getenv("APKO_OAUTH2_SCOPES"); s != "" {
+		scopes = strings.Split(s, ",")
+	}
+	return NewOAuth2Auth(OAuth2Config{
+		Scope:            os.Getenv("APKO_OAUTH2_HOST"),
+		TokenURL:         os.Getenv("APKO_OAUTH2_TOKEN_URL"),
+		ClientID:         os.Getenv("APKO_OAUTH2_CLIENT_ID"),
+		ClientSecret:     os.Getenv("APKO_OAUTH2_CLIENT_SECRET"),
+		Scopes:           scopes,
+		Audience:         os.Getenv("APKO_OAUTH2_AUDIENCE"),
+		SubjectTokenFile: os.Getenv("APKO_OAUTH2_SUBJECT_TOKEN_FILE"),
+	})
+}
+
+type oauth2Auth struct {
+	scope scope
+	user  string
+	src   oauth2Source
+
+	mu  sync.Mutex
+	tok *oauth2.Token
+}
+
+func (o *oauth2Auth) AddAuth(ctx context.Context, req *http.Request) error {
+	if !o.scope.matches(req.URL) {
+		return nil
+	}
+	tok, err := o.token(ctx)
+	if err != nil {
+		return fmt.Errorf("getting oauth2 token: %w", err)
+	}
+	req.SetBasicAuth(o.user, tok.AccessToken)
+	return nil
+}
+
+// token returns the cached token, or fetches a new one with ctx when it
+// expires within oauth2RefreshEarly.
+func (o *oauth2Auth) token(ctx context.Context) (*oauth2.Token, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.tok != nil && (o.tok.Expiry.IsZero() || time.Until(o.tok.Expiry) > oauth2RefreshEarly) {
+		return o.tok, nil
+	}
+	tok, err := o.src.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.tok = tok
+	return tok, nil
+}
+
+// errAuthenticator fails every request with err.
+type errAuthenticator struct {
+	err error
+}
+
+func (e errAuthenticator) AddAuth(context.Context, *http.Request) error {
+	return e.err
+}
+
+// oauth2Source fetches a new token from the endpoint on each call.
+type oauth2Source struct {
+	cfg OAuth2Config
+}
+
+func (s oauth2Source) token(ctx context.Context) (*oauth2.Token, error) {
+	cc := clientcredentials.Config{
+		ClientID:       s.cfg.ClientID,
+		ClientSecret:   s.cfg.ClientSecret,
+		TokenURL:       s.cfg.TokenURL,
+		Scopes:         s.cfg.Scopes,
+		EndpointParams: url.Values{},
+	}
+	if cc.ClientID == "" {
+		// Without a client to authenticate, don't send an empty one.
+		cc.AuthStyle = oauth2.AuthStyleInParams
+	}
+	if s.cfg.Audience != "" {
+		cc.EndpointParams.Set("audience", s.cfg.Audience)
+	}
+	if s.cfg.SubjectTokenFile != "" {
+		b, err := os.ReadFile(s.cfg.SubjectTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading subject token: %w", err)
+		}
+		typ := s.cfg.SubjectTokenType
+		if typ == "" {
+			typ = jwtTokenType
+		}
+		cc.EndpointParams.Set("grant_type", tokenExchangeGrantType)
+		cc.EndpointParams.Set("subject_token", strings.TrimSpace(string(b)))
+		cc.EndpointParams.Set("subject_token_type", typ)
+	}
+	return cc.Token(ctx)
+}
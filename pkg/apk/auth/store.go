@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// The stores of the secrets of saved credentials.
+const (
+	// StoreKeychain keeps secrets in the keychain of the OS: the macOS
+	// Keychain, the Windows Credential Manager, or the Secret Service of the
+	// desktop on Linux.
+	StoreKeychain = "keychain"
+	// StoreFile keeps secrets encrypted in the credentials file, with a key
+	// derived from the APKO_CREDENTIALS_PASSPHRASE environment variable.
+	StoreFile = "file"
+)
+
+// keychainService is the service of the secrets in the keychain.
+const keychainService = "apko"
+
+// credentialsFile lists the saved credentials by their scope, a host and an
+// optional path, with their secret in the file, or in the keychain.
+type credentialsFile struct {
+	// Salt derives the key of the secrets in the file from the passphrase.
+	Salt        []byte                      `json:"salt,omitempty"`
+	Credentials map[string]savedCredentials `json:"credentials"`
+}
+
+type savedCredentials struct {
+	Store    string `json:"store"`
+	Username string `json:"username"`
+	// Secret is the encrypted secret, when Store is StoreFile.
+	Secret []byte `json:"secret,omitempty"`
+}
+
+// DefaultCredentialsPath returns the path of the credentials file: the
+// APKO_CREDENTIALS_FILE environment variable, or apko/credentials.json in the
+// user configuration directory.
+func DefaultCredentialsPath() (string, error) {
+	if p := os.Getenv("APKO_CREDENTIALS_FILE"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "apko", "credentials.json"), nil
+}
+
+// SaveCredentials saves the credentials of the repositories under scope,
+// <host>[/<path>], to the credentials file at path, keeping their secret in
+// store, StoreKeychain or StoreFile.
+func SaveCredentials(path, scope, username, secret, store string) error {
+	scope = normalizeScope(scope)
+	f, err := readCredentialsFile(path)
+	if err != nil {
+		return err
+	}
+	saved := savedCredentials{Store: store, Username: username}
+	switch store {
+	case StoreKeychain:
+		if err := keyring.Set(keychainService, scope, secret); err != nil {
+			return fmt.Errorf("saving the secret in the keychain: %w", err)
+		}
+	case StoreFile:
+		if f.Salt == nil {
+			f.Salt = make([]byte, 32)
+			if _, err := rand.Read(f.Salt); err != nil {
+				return err
+			}
+		}
+		key, err := fileKey(f.Salt)
+		if err != nil {
+			return err
+		}
+		var nonce [24]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return err
+		}
+		saved.Secret = secretbox.Seal(nonce[:], []byte(secret), &nonce, key)
+	default:
+		return fmt.Errorf("unknown credential store %q, expected %s or %s", store, StoreKeychain, StoreFile)
+	}
+	// Don't leave the secret of the previous credentials in the keychain.
+	if prev, ok := f.Credentials[scope]; ok && prev.Store == StoreKeychain && store != StoreKeychain {
+		_ = keyring.Delete(keychainService, scope)
+	}
+	f.Credentials[scope] = saved
+	return writeCredentialsFile(path, f)
+}
+
+// DeleteCredentials removes the credentials saved under scope from the
+// credentials file at path, and their secret from the keychain.
+func DeleteCredentials(path, scope string) error {
+	scope = normalizeScope(scope)
+	f, err := readCredentialsFile(path)
+	if err != nil {
+		return err
+	}
+	saved, ok := f.Credentials[scope]
+	if !ok {
+		return fmt.Errorf("no credentials saved for %s", scope)
+	}
+	if saved.Store == StoreKeychain {
+		if err := keyring.Delete(keychainService, scope); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("deleting the secret from the keychain: %w", err)
+		}
+	}
+	delete(f.Credentials, scope)
+	return writeCredentialsFile(path, f)
+}
+
+// NewStoredAuth returns an Authenticator that adds HTTP basic auth from the
+// credentials saved with SaveCredentials in the credentials file at path, or
+// DefaultCredentialsPath if path is empty. The credentials with the longest
+// matching path win. A missing file adds no auth.
+func NewStoredAuth(path string) Authenticator {
+	return &storedAuth{path: path, secrets: map[string]string{}}
+}
+
+type storedAuth struct {
+	path string
+
+	// secrets caches the secrets read from the keychain or decrypted.
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func (s *storedAuth) AddAuth(_ context.Context, req *http.Request) error {
+	path := s.path
+	if path == "" {
+		var err error
+		if path, err = DefaultCredentialsPath(); err != nil {
+			return nil
+		}
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	f, err := readCredentialsFile(path)
+	if err != nil {
+		return err
+	}
+
+	var best *scope
+	var bestName string
+	for name := range f.Credentials {
+		sc := parseScope(name)
+		if sc.matches(req.URL) && (best == nil || len(sc.path) > len(best.path)) {
+			best, bestName = &sc, name
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	saved := f.Credentials[bestName]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[bestName]
+	if !ok {
+		switch saved.Store {
+		case StoreKeychain:
+			secret, err = keyring.Get(keychainService, bestName)
+			if err != nil {
+				return fmt.Errorf("reading the secret of %s from the keychain: %w", bestName, err)
+			}
+		case StoreFile:
+			if secret, err = openSecret(f.Salt, saved.Secret); err != nil {
+				return fmt.Errorf("decrypting the secret of %s: %w", bestName, err)
+			}
+		default:
+			return fmt.Errorf("unknown credential store %q for %s", saved.Store, bestName)
+		}
+		s.secrets[bestName] = secret
+	}
+	req.SetBasicAuth(saved.Username, secret)
+	return nil
+}
+
+// normalizeScope strips the scheme and trailing slash of a scope given as a
+// URL.
+func normalizeScope(s string) string {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	return strings.TrimSuffix(s, "/")
+}
+
+// fileKey derives the key of the secrets in the credentials file from the
+// APKO_CREDENTIALS_PASSPHRASE environment variable.
+func fileKey(salt []byte) (*[32]byte, error) {
+	pass := os.Getenv("APKO_CREDENTIALS_PASSPHRASE")
+	if pass == "" {
+		return nil, errors.New("APKO_CREDENTIALS_PASSPHRASE is required for the credentials in the file")
+	}
+	k, err := scrypt.Key([]byte(pass), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	return (*[32]byte)(k), nil
+}
+
+func openSecret(salt, sealed []byte) (string, error) {
+	key, err := fileKey(salt)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < 24 {
+		return "", errors.New("invalid secret")
+	}
+	secret, ok := secretbox.Open(nil, sealed[24:], (*[24]byte)(sealed[:24]), key)
+	if !ok {
+		return "", errors.New("wrong passphrase, or corrupted secret")
+	}
+	return string(secret), nil
+}
+
+func readCredentialsFile(path string) (*credentialsFile, error) {
+	f := &credentialsFile{Credentials: map[string]savedCredentials{}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if f.Credentials == nil {
+		f.Credentials = map[string]savedCredentials{}
+	}
+	return f, nil
+}
+
+func writeCredentialsFile(path string, f *credentialsFile) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	// Write atomically, readable only by the user.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".credentials-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestStoredAuth(t *testing.T) {
+	keyring.MockInit()
+	t.Setenv("APKO_CREDENTIALS_PASSPHRASE", "correct horse")
+	path := filepath.Join(t.TempDir(), "credentials.json")
+
+	if err := SaveCredentials(path, "https://example.com/", "alice", "secret-a", StoreKeychain); err != nil {
+		t.Fatalf("SaveCredentials: %v", err)
+	}
+	if err := SaveCredentials(path, "example.com/private", "bob", "secret-b", StoreFile); err != nil {
+		t.Fatalf("SaveCredentials: %v", err)
+	}
+	if err := SaveCredentials(path, "example.com", "carol", "secret-c", "vault"); err == nil {
+		t.Fatal("SaveCredentials with an unknown store succeeded")
+	}
+
+	check := func(t *testing.T, a Authenticator, url, wantUser, wantPass string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", url, nil)
+		if err := a.AddAuth(context.Background(), req); err != nil {
+			t.Fatalf("AddAuth: %v", err)
+		}
+		user, pass, _ := req.BasicAuth()
+		if user != wantUser || pass != wantPass {
+			t.Errorf("got %q:%q, want %q:%q", user, pass, wantUser, wantPass)
+		}
+	}
+
+	for _, tt := range []struct {
+		name, url, wantUser, wantPass string
+	}{
+		{name: "keychain", url: "https://example.com/os/APKINDEX.tar.gz", wantUser: "alice", wantPass: "secret-a"},
+		{name: "longest path", url: "https://example.com/private/os/APKINDEX.tar.gz", wantUser: "bob", wantPass: "secret-b"},
+		{name: "other host", url: "https://other.example.com/os/APKINDEX.tar.gz"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			check(t, NewStoredAuth(path), tt.url, tt.wantUser, tt.wantPass)
+		})
+	}
+
+	t.Run("env path", func(t *testing.T) {
+		t.Setenv("APKO_CREDENTIALS_FILE", path)
+		check(t, NewStoredAuth(""), "https://example.com/os/APKINDEX.tar.gz", "alice", "secret-a")
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		check(t, NewStoredAuth(filepath.Join(t.TempDir(), "missing.json")), "https://example.com/os/APKINDEX.tar.gz", "", "")
+	})
+
+	t.Run("wrong passphrase", func(t *testing.T) {
+		t.Setenv("APKO_CREDENTIALS_PASSPHRASE", "wrong")
+		req, _ := http.NewRequest("GET", "https://example.com/private/os/APKINDEX.tar.gz", nil)
+		if err := NewStoredAuth(path).AddAuth(context.Background(), req); err == nil {
+			t.Error("AddAuth with the wrong passphrase succeeded")
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		if err := DeleteCredentials(path, "example.com"); err != nil {
+			t.Fatalf("DeleteCredentials: %v", err)
+		}
+		if _, err := keyring.Get(keychainService, "example.com"); err == nil {
+			t.Error("secret left in the keychain")
+		}
+		if err := DeleteCredentials(path, "example.com"); err == nil {
+			t.Error("DeleteCredentials of missing credentials succeeded")
+		}
+		check(t, NewStoredAuth(path), "https://example.com/os/APKINDEX.tar.gz", "", "")
+		check(t, NewStoredAuth(path), "https://example.com/private/os/APKINDEX.tar.gz", "bob", "secret-b")
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package digest creates the hashes apko computes, so that builds with the
+// fips tag can refuse the algorithms FIPS 140 does not approve.
+//
+// The apk format mandates SHA-1 in a few places: the checksum of the control
+// section of a package, which names it in the indexes and the cache, the
+// checksums of installed files, and the legacy .SIGN.RSA signatures. Where a
+// SHA-1 digest only identifies something, it is computed with Identify,
+// whatever the build. Where something is trusted because of a digest, it is
+// computed with New for Integrity, which fails with ErrNotApproved in FIPS
+// builds for SHA-1, so that those builds rely on the SHA-256 digests and
+// signatures the format also has.
+package digest
+
+import (
+	"crypto"
+	_ "crypto/sha1" //nolint:gosec // mandated by the apk format, see Identify
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// Purpose is what a digest is computed for.
+type Purpose int
+
+const (
+	// Integrity digests are compared or verified to trust content.
+	Integrity Purpose = iota
+	// Identifier digests name content, such as a cache entry or a UUID, and
+	// nothing is trusted because of them.
+	Identifier
+)
+
+// String returns the name of the purpose.
+func (p Purpose) String() string {
+	switch p {
+	case Integrity:
+		return "integrity"
+	case Identifier:
+		return "identifier"
+	default:
+		return fmt.Sprintf("Purpose(%d)", int(p))
+	}
+}
+
+// ErrNotApproved is returned for a hash algorithm which is not approved for
+// its purpose.
+var ErrNotApproved = errors.New("hash algorithm not approved in FIPS mode")
+
+// Hasher creates hashes, refusing the algorithms it does not approve for a
+// purpose.
+type Hasher interface {
+	New(h crypto.Hash, p Purpose) (hash.Hash, error)
+}
+
+// NewHasher returns a Hasher which approves every available algorithm, or
+// only those approved by FIPS 140 for Integrity if fips is set.
+func NewHasher(fips bool) Hasher {
+	return hasher{fips: fips}
+}
+
+type hasher struct {
+	fips bool
+}
+
+func (hs hasher) New(h crypto.Hash, p Purpose) (hash.Hash, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("hash algorithm %s is not available", h)
+	}
+	if hs.fips && p == Integrity && !fipsApproved(h) {
+		return nil, fmt.Errorf("%w: %s for %s", ErrNotApproved, h, p)
+	}
+	return h.New(), nil
+}
+
+// fipsApproved reports whether FIPS 140 approves h for integrity.
+func fipsApproved(h crypto.Hash) bool {
+	switch h {
+	case crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.SHA512_224, crypto.SHA512_256:
+		return true
+	default:
+		return false
+	}
+}
+
+var defaultHasher = NewHasher(FIPS)
+
+// Default returns the Hasher used by New, which only approves the
+// algorithms of FIPS 140 in builds with the fips tag.
+func Default() Hasher {
+	return defaultHasher
+}
+
+// New returns a new hash of h for p from Default.
+func New(h crypto.Hash, p Purpose) (hash.Hash, error) {
+	return defaultHasher.New(h, p)
+}
+
+// Approved reports whether Default approves h for p.
+func Approved(h crypto.Hash, p Purpose) bool {
+	_, err := defaultHasher.New(h, p)
+	return err == nil
+}
+
+// Identify returns a new hash of h for an identifier, which every build
+// allows for SHA-1 and the algorithms of FIPS 140.
+func Identify(h crypto.Hash) (hash.Hash, error) {
+	return defaultHasher.New(h, Identifier)
+}
@@ -0,0 +1,65 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package digest
+
+import (
+	"crypto"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasher(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		fips    bool
+		h       crypto.Hash
+		p       Purpose
+		wantErr string
+	}{
+		{name: "sha1 integrity", h: crypto.SHA1, p: Integrity},
+		{name: "sha1 identifier", h: crypto.SHA1, p: Identifier},
+		{name: "fips sha256 integrity", fips: true, h: crypto.SHA256, p: Integrity},
+		{name: "fips sha1 identifier", fips: true, h: crypto.SHA1, p: Identifier},
+		{name: "fips sha1 integrity", fips: true, h: crypto.SHA1, p: Integrity, wantErr: "hash algorithm not approved in FIPS mode: SHA-1 for integrity"},
+		{name: "unavailable", h: crypto.MD4, p: Identifier, wantErr: "MD4 is not available"},
+		{name: "fips md5 integrity", fips: true, h: crypto.MD5, p: Integrity, wantErr: "not approved in FIPS mode: MD5"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := NewHasher(tc.fips).New(tc.h, tc.p)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.h.Size(), h.Size())
+		})
+	}
+}
+
+func TestDefault(t *testing.T) {
+	require.Equal(t, !FIPS, Approved(crypto.SHA1, Integrity))
+	require.True(t, Approved(crypto.SHA256, Integrity))
+	require.True(t, Approved(crypto.SHA1, Identifier))
+
+	h, err := Identify(crypto.SHA1)
+	require.NoError(t, err)
+	h.Write([]byte("apk"))
+	require.Equal(t, "f5fce1d3a0929197f8bbf9423ee507657420c4c0", hex.EncodeToString(h.Sum(nil)))
+
+	_, err = Identify(crypto.MD4)
+	require.ErrorContains(t, err, "not available")
+}
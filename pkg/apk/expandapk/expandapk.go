@@ -11,11 +11,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
-	"crypto/sha1"
+	"crypto"
 	"crypto/sha256"
 	"errors"
 	"fmt"
-	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -23,6 +22,7 @@ import (
 	"sync"
 
 	"chainguard.dev/apko/internal/tarfs"
+	"chainguard.dev/apko/pkg/apk/digest"
 	"github.com/klauspost/compress/gzip"
 
 	"go.opentelemetry.io/otel"
@@ -255,6 +255,10 @@ var _ io.Writer = (*expandApkWriter)(nil)
 
 var errExpandApkWriterMaxStreams = errors.New("expandApkWriter max streams reached")
 
+// ErrChecksumMismatch is returned when a file in the data section of a
+// package differs from the checksum recorded in its header.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
 func (w *expandApkWriter) Next() error {
 	if w.f != nil {
 		if err := w.CloseFile(); err != nil {
@@ -380,8 +384,12 @@ func ExpandApk(ctx context.Context, source io.Reader, cacheDir string) (*APKExpa
 	hashes := [][]byte{}
 	maxStreamsReached := false
 	for {
-		// Control section uses sha1.
-		var h hash.Hash = sha1.New() //nolint:gosec // this is what apk tools is using
+		// The apk format mandates SHA-1 for the checksum of the control
+		// section, which names the package. Its data section uses SHA-256.
+		h, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return nil, err
+		}
 
 		if err := sw.Next(); err != nil {
 			if err == errExpandApkWriterMaxStreams {
@@ -566,14 +574,20 @@ func checkSums(ctx context.Context, r io.Reader) error {
 			continue
 		}
 
-		w := sha1.New() //nolint:gosec // this is what apk tools is using
+		// The apk format mandates SHA-1 for the checksums of files, which
+		// are recorded in the installed database. The data section itself is
+		// verified by its SHA-256.
+		w, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return err
+		}
 
 		if _, err := io.Copy(w, tr); err != nil {
 			return fmt.Errorf("hashing %s: %w", header.Name, err)
 		}
 
 		if want, got := checksum, w.Sum(nil); !bytes.Equal(want, got) {
-			return fmt.Errorf("checksum mismatch: %s header was %x, computed %x", header.Name, want, got)
+			return fmt.Errorf("%w: %s header was %x, computed %x", ErrChecksumMismatch, header.Name, want, got)
 		}
 	}
 
@@ -25,15 +25,73 @@ var (
 )
 
 // RSASignDigest signs the provided message digest. The key file must
-// be in the PEM format and can either be encrypted or not.
+// be in the PEM format, holding a PKCS1 or PKCS8 RSA key, and can either
+// be encrypted or not.
 func RSASignDigest(digest []byte, digestType crypto.Hash, keyFile, passphrase string) ([]byte, error) {
+	if err := checkSignDigest(digest, digestType); err != nil {
+		return nil, err
+	}
+
+	key, err := readPrivateKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errNoRSAKey
+	}
+
+	return signRSA(priv, digest, digestType)
+}
+
+// RSAVerifyDigest is exported for use in tests and verifies a
+// signature over the provided hash of a message. The key file must be
+// in the PEM format.
+func RSAVerifyDigest(digest []byte, digestType crypto.Hash, signature []byte, publicKey []byte) error {
+	if len(digest) != digestType.Size() {
+		return errDigestLength
+	}
+
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return errNoRSAKey
+	}
+
+	return verifyRSA(rsaPub, digest, digestType, signature)
+}
+
+func checkSignDigest(digest []byte, digestType crypto.Hash) error {
 	if digestType == crypto.SHA1 {
-		return nil, errWeakDigest
+		return errWeakDigest
 	}
 	if len(digest) != digestType.Size() {
-		return nil, errDigestLength
+		return errDigestLength
+	}
+	return nil
+}
+
+func signRSA(priv *rsa.PrivateKey, digest []byte, digestType crypto.Hash) ([]byte, error) {
+	signature, err := priv.Sign(rand.Reader, digest, digestType)
+	if err != nil {
+		return nil, fmt.Errorf("signing: %w", err)
+	}
+	return signature, nil
+}
+
+func verifyRSA(pub *rsa.PublicKey, digest []byte, digestType crypto.Hash, signature []byte) error {
+	if err := rsa.VerifyPKCS1v15(pub, digestType, digest, signature); err != nil {
+		return fmt.Errorf("verify PKCS1v15 signature: %w", err)
 	}
+	return nil
+}
 
+// readPrivateKey reads the PEM private key in keyFile, decrypting it with
+// passphrase if it is encrypted.
+func readPrivateKey(keyFile, passphrase string) (crypto.PrivateKey, error) {
 	keyFileContent, err := os.ReadFile(keyFile)
 	if err != nil {
 		return nil, fmt.Errorf("reading key file: %w", err)
@@ -60,46 +118,19 @@ func RSASignDigest(digest []byte, digestType crypto.Hash, keyFile, passphrase st
 		blockData = decryptedBlockData
 	}
 
-	priv, err := x509.ParsePKCS1PrivateKey(blockData)
-	if err != nil {
-		return nil, fmt.Errorf("parse PKCS1 private key: %w", err)
-	}
-
-	signature, err := priv.Sign(rand.Reader, digest, digestType)
-	if err != nil {
-		return nil, fmt.Errorf("signing: %w", err)
-	}
-
-	return signature, nil
+	return parsePrivateKey(block.Type, blockData)
 }
 
-// RSAVerifyDigest is exported for use in tests and verifies a
-// signature over the provided hash of a message. The key file must be
-// in the PEM format.
-func RSAVerifyDigest(digest []byte, digestType crypto.Hash, signature []byte, publicKey []byte) error {
-	if len(digest) != digestType.Size() {
-		return errDigestLength
-	}
-
+// parsePublicKey parses the PEM PKIX public key publicKey.
+func parsePublicKey(publicKey []byte) (crypto.PublicKey, error) {
 	block, _ := pem.Decode(publicKey)
 	if block == nil {
-		return errNoPemBlock
+		return nil, errNoPemBlock
 	}
 
 	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		return fmt.Errorf("parse PKIX public key: %w", err)
+		return nil, fmt.Errorf("parse PKIX public key: %w", err)
 	}
-
-	rsaPub, ok := pub.(*rsa.PublicKey)
-	if !ok {
-		return errNoRSAKey
-	}
-
-	err = rsa.VerifyPKCS1v15(rsaPub, digestType, digest, signature)
-	if err != nil {
-		return fmt.Errorf("verify PKCS1v15 signature: %w", err)
-	}
-
-	return nil
+	return pub, nil
 }
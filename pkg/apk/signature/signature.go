@@ -0,0 +1,155 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+var (
+	errUnsupportedKey = errors.New("unsupported key type")
+	errEd25519Digest  = errors.New("ed25519 signatures are of messages, not digests")
+)
+
+// Sign signs message with an RSA, ECDSA or Ed25519 private key, in the key
+// file as for SignDigest. RSA and ECDSA keys sign the digestType digest of
+// message, and Ed25519 keys sign message itself, as Ed25519 hashes it.
+func Sign(message []byte, digestType crypto.Hash, keyFile, passphrase string) ([]byte, error) {
+	if digestType == crypto.SHA1 {
+		return nil, errWeakDigest
+	}
+	key, err := readPrivateKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if priv, ok := key.(ed25519.PrivateKey); ok {
+		return ed25519.Sign(priv, message), nil
+	}
+	h := digestType.New()
+	h.Write(message)
+	return signDigest(key, h.Sum(nil), digestType)
+}
+
+// SignDigest signs the provided message digest with an RSA or ECDSA private
+// key. The key file must be in the PEM format, holding a PKCS1, SEC1 or
+// PKCS8 key, and can either be encrypted or not. RSA signatures use
+// PKCS1v15 and ECDSA signatures are ASN.1 encoded. Ed25519 keys can't sign
+// a digest; Sign signs the message with them.
+func SignDigest(digest []byte, digestType crypto.Hash, keyFile, passphrase string) ([]byte, error) {
+	if err := checkSignDigest(digest, digestType); err != nil {
+		return nil, err
+	}
+	key, err := readPrivateKey(keyFile, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return signDigest(key, digest, digestType)
+}
+
+func signDigest(key crypto.PrivateKey, digest []byte, digestType crypto.Hash) ([]byte, error) {
+	switch priv := key.(type) {
+	case *rsa.PrivateKey:
+		return signRSA(priv, digest, digestType)
+	case *ecdsa.PrivateKey:
+		signature, err := ecdsa.SignASN1(rand.Reader, priv, digest)
+		if err != nil {
+			return nil, fmt.Errorf("signing: %w", err)
+		}
+		return signature, nil
+	case ed25519.PrivateKey:
+		return nil, errEd25519Digest
+	default:
+		return nil, fmt.Errorf("%w: %T", errUnsupportedKey, priv)
+	}
+}
+
+func parsePrivateKey(blockType string, der []byte) (crypto.PrivateKey, error) {
+	switch blockType {
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse PKCS1 private key: %w", err)
+		}
+		return priv, nil
+	case "EC PRIVATE KEY":
+		priv, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse EC private key: %w", err)
+		}
+		return priv, nil
+	default:
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("parse PKCS8 private key: %w", err)
+		}
+		return priv, nil
+	}
+}
+
+// Verify verifies a signature of message with an RSA, ECDSA or Ed25519
+// public key, following the conventions of Sign. The key must be a PKIX
+// public key in the PEM format.
+func Verify(message []byte, digestType crypto.Hash, signature []byte, publicKey []byte) error {
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if pub, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(pub, message, signature) {
+			return errors.New("verify Ed25519 signature: verification failure")
+		}
+		return nil
+	}
+	h := digestType.New()
+	h.Write(message)
+	return verifyDigest(pub, h.Sum(nil), digestType, signature)
+}
+
+// VerifyDigest verifies a signature over the provided hash of a message
+// with an RSA or ECDSA public key, following the conventions of
+// SignDigest. The key must be a PKIX public key in the PEM format.
+func VerifyDigest(digest []byte, digestType crypto.Hash, signature []byte, publicKey []byte) error {
+	if len(digest) != digestType.Size() {
+		return errDigestLength
+	}
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	return verifyDigest(pub, digest, digestType, signature)
+}
+
+func verifyDigest(key crypto.PublicKey, digest []byte, digestType crypto.Hash, signature []byte) error {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return verifyRSA(pub, digest, digestType, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return errors.New("verify ECDSA signature: verification failure")
+		}
+		return nil
+	case ed25519.PublicKey:
+		return errEd25519Digest
+	default:
+		return fmt.Errorf("%w: %T", errUnsupportedKey, pub)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name  string
+		block *pem.Block
+		pub   crypto.PublicKey
+	}{
+		{"rsa", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}, rsaKey.Public()},
+		{"ecdsa", &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}, ecKey.Public()},
+		{"ed25519", &pem.Block{Type: "PRIVATE KEY", Bytes: edDER}, edKey.Public()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			keyFile := filepath.Join(t.TempDir(), "key.pem")
+			require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(tc.block), 0o600))
+
+			pubDER, err := x509.MarshalPKIXPublicKey(tc.pub)
+			require.NoError(t, err)
+			pub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+			message := []byte("APKINDEX")
+			sig, err := Sign(message, crypto.SHA256, keyFile, "")
+			require.NoError(t, err)
+			require.NoError(t, Verify(message, crypto.SHA256, sig, pub))
+			require.Error(t, Verify([]byte("tampered"), crypto.SHA256, sig, pub))
+
+			// Ed25519 signs the message itself, and the others its digest.
+			digest := sha256.Sum256(message)
+			if edPub, ok := tc.pub.(ed25519.PublicKey); ok {
+				require.True(t, ed25519.Verify(edPub, message, sig))
+				_, err = SignDigest(digest[:], crypto.SHA256, keyFile, "")
+				require.ErrorIs(t, err, errEd25519Digest)
+				require.ErrorIs(t, VerifyDigest(digest[:], crypto.SHA256, sig, pub), errEd25519Digest)
+			} else {
+				require.NoError(t, VerifyDigest(digest[:], crypto.SHA256, sig, pub))
+				sig, err := SignDigest(digest[:], crypto.SHA256, keyFile, "")
+				require.NoError(t, err)
+				require.NoError(t, Verify(message, crypto.SHA256, sig, pub))
+			}
+
+			_, err = Sign(message, crypto.SHA1, keyFile, "")
+			require.ErrorIs(t, err, errWeakDigest)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sigstore verifies repository indexes and keyring artifacts with
+// Sigstore bundles, checking that they were signed by an expected Fulcio
+// identity and logged in Rekor.
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/tuf"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/theupdateframework/go-tuf/v2/metadata/fetcher"
+)
+
+// BundleSuffix is appended to the index URL to locate its bundle, for example
+// https://example.com/os/x86_64/APKINDEX.tar.gz.sigstore.json.
+const BundleSuffix = ".sigstore.json"
+
+// publicGoodTrustedRoot is the trusted root of the public Sigstore instance,
+// once fetched.
+var publicGoodTrustedRoot struct {
+	sync.Mutex
+	root *root.TrustedRoot
+}
+
+// fetchPublicGoodTrustedRoot fetches the trusted root of the public Sigstore
+// instance with TUF, through transport when it is set, unless it was fetched
+// already.
+func fetchPublicGoodTrustedRoot(transport http.RoundTripper) (*root.TrustedRoot, error) {
+	publicGoodTrustedRoot.Lock()
+	defer publicGoodTrustedRoot.Unlock()
+	if publicGoodTrustedRoot.root != nil {
+		return publicGoodTrustedRoot.root, nil
+	}
+	opts := tuf.DefaultOptions()
+	if transport != nil {
+		opts.WithFetcher(fetcher.NewDefaultFetcher().NewFetcherWithRoundTripper(transport))
+	}
+	tr, err := root.FetchTrustedRootWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	publicGoodTrustedRoot.root = tr
+	return tr, nil
+}
+
+// Policy is the identity expected to have signed the indexes of a repository,
+// or a keyring artifact.
+type Policy struct {
+	// Identity is the subject alternative name of the signing certificate,
+	// such as an email address or a CI workflow URL.
+	Identity string
+	// IdentityRegexp matches the subject alternative name instead.
+	IdentityRegexp string
+	// Issuer is the OIDC issuer of the signing certificate.
+	Issuer string
+	// IssuerRegexp matches the OIDC issuer instead.
+	IssuerRegexp string
+	// TrustedRoot is the path of the trusted_root.json of a private Sigstore
+	// deployment. The public instance is trusted when empty.
+	TrustedRoot string
+	// Transport makes the requests fetching the trusted root of the public
+	// instance, such as an apk.AuditTransport. Default is
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// Verifier verifies bundles against a Policy. It implements
+// apk.IndexVerifier and apk.ArtifactVerifier.
+type Verifier struct {
+	verifier *verify.Verifier
+	identity verify.CertificateIdentity
+}
+
+// NewVerifier returns a Verifier for the policy, requiring a signed certificate
+// timestamp, a transparency log entry and a timestamp for each bundle.
+func NewVerifier(p Policy) (*Verifier, error) {
+	var (
+		tm  root.TrustedMaterial
+		err error
+	)
+	if p.TrustedRoot != "" {
+		tm, err = root.NewTrustedRootFromPath(p.TrustedRoot)
+	} else {
+		tm, err = fetchPublicGoodTrustedRoot(p.Transport)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading sigstore trusted root: %w", err)
+	}
+	return newVerifier(tm, p,
+		verify.WithSignedCertificateTimestamps(1),
+		verify.WithTransparencyLog(1),
+		verify.WithObserverTimestamps(1),
+	)
+}
+
+func newVerifier(tm root.TrustedMaterial, p Policy, opts ...verify.VerifierOption) (*Verifier, error) {
+	identity, err := verify.NewShortCertificateIdentity(p.Issuer, p.IssuerRegexp, p.Identity, p.IdentityRegexp)
+	if err != nil {
+		return nil, fmt.Errorf("creating certificate identity: %w", err)
+	}
+	v, err := verify.NewVerifier(tm, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating sigstore verifier: %w", err)
+	}
+	return &Verifier{verifier: v, identity: identity}, nil
+}
+
+// SignatureSuffix implements apk.IndexVerifier.
+func (v *Verifier) SignatureSuffix() string {
+	return BundleSuffix
+}
+
+// VerifyIndex implements apk.IndexVerifier, verifying that the bundle signs
+// the index and satisfies the policy.
+func (v *Verifier) VerifyIndex(ctx context.Context, index, signature []byte) error {
+	return v.VerifyArtifact(ctx, index, signature)
+}
+
+// VerifyArtifact implements apk.ArtifactVerifier, verifying that the bundle
+// signs the artifact and satisfies the policy.
+func (v *Verifier) VerifyArtifact(_ context.Context, artifact, signature []byte) error {
+	var b bundle.Bundle
+	if err := b.UnmarshalJSON(signature); err != nil {
+		return fmt.Errorf("parsing sigstore bundle: %w", err)
+	}
+	return v.verify(&b, artifact)
+}
+
+func (v *Verifier) verify(entity verify.SignedEntity, artifact []byte) error {
+	policy := verify.NewPolicy(verify.WithArtifact(bytes.NewReader(artifact)), verify.WithCertificateIdentity(v.identity))
+	if _, err := v.verifier.Verify(entity, policy); err != nil {
+		return fmt.Errorf("verifying sigstore bundle: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sigstore
+
+import (
+	"testing"
+
+	"github.com/sigstore/sigstore-go/pkg/testing/ca"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	vs, err := ca.NewVirtualSigstore()
+	require.NoError(t, err)
+
+	const (
+		identity = "https://github.com/example/os/.github/workflows/release.yaml@refs/heads/main"
+		issuer   = "https://token.actions.githubusercontent.com"
+	)
+	index := []byte("APKINDEX")
+	entity, err := vs.Sign(identity, issuer, index)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name    string
+		policy  Policy
+		index   []byte
+		wantErr bool
+	}{
+		{name: "identity", policy: Policy{Identity: identity, Issuer: issuer}, index: index},
+		{name: "regexps", policy: Policy{IdentityRegexp: `^https://github\.com/example/`, IssuerRegexp: `^https://token\.actions\.`}, index: index},
+		{name: "other identity", policy: Policy{Identity: "someone@example.com", Issuer: issuer}, index: index, wantErr: true},
+		{name: "other issuer", policy: Policy{Identity: identity, Issuer: "https://accounts.google.com"}, index: index, wantErr: true},
+		{name: "other index", policy: Policy{Identity: identity, Issuer: issuer}, index: []byte("tampered"), wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := newVerifier(vs, tc.policy, verify.WithTransparencyLog(1), verify.WithObserverTimestamps(1))
+			require.NoError(t, err)
+			err = v.verify(entity, tc.index)
+			if tc.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIndexInvalidBundle(t *testing.T) {
+	vs, err := ca.NewVirtualSigstore()
+	require.NoError(t, err)
+	v, err := newVerifier(vs, Policy{Identity: "someone@example.com", Issuer: "https://accounts.google.com"}, verify.WithTransparencyLog(1), verify.WithObserverTimestamps(1))
+	require.NoError(t, err)
+	require.ErrorContains(t, v.VerifyIndex(t.Context(), []byte("APKINDEX"), []byte("{}")), "parsing sigstore bundle")
+}
+
+func TestNewVerifierInvalidPolicy(t *testing.T) {
+	_, err := NewVerifier(Policy{Identity: "someone@example.com", TrustedRoot: "testdata/missing.json"})
+	require.ErrorContains(t, err, "loading sigstore trusted root")
+
+	vs, err := ca.NewVirtualSigstore()
+	require.NoError(t, err)
+	_, err = newVerifier(vs, Policy{Identity: "someone@example.com"}, verify.WithTransparencyLog(1), verify.WithObserverTimestamps(1))
+	require.Error(t, err)
+}
@@ -0,0 +1,222 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package attest wraps documents describing images, like SBOMs, in signed
+// in-toto attestations, in DSSE envelopes.
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// StatementType is the type of in-toto v1 statements.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PayloadType is the DSSE payload type of in-toto statements.
+	PayloadType = "application/vnd.in-toto+json"
+)
+
+// Statement is an in-toto v1 statement about subjects.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Envelope is a DSSE envelope.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// Signer signs DSSE envelopes with a private key.
+type Signer struct {
+	key   crypto.Signer
+	keyID string
+}
+
+// LoadSigner reads an unencrypted PEM private key, in PKCS #8, SEC 1 (EC) or
+// PKCS #1 (RSA) form. The key ID is the hex sha256 of the public key in PKIX
+// form, which identifies it without further configuration.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, fmt.Errorf("%s: encrypted keys are not supported", path)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	switch signer.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %T", path, key)
+	}
+	return NewSigner(signer)
+}
+
+// NewSigner returns a signer using key.
+func NewSigner(key crypto.Signer) (*Signer, error) {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, fmt.Errorf("marshaling public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return &Signer{key: key, keyID: hex.EncodeToString(sum[:])}, nil
+}
+
+// KeyID returns the ID of the signer's key, as recorded in signatures.
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// Public returns the public key of the signer.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+// Sign returns a DSSE envelope of payload, signed by s.
+func (s *Signer) Sign(payloadType string, payload []byte) (*Envelope, error) {
+	msg := PAE(payloadType, payload)
+
+	var sig []byte
+	var err error
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		sig, err = s.key.Sign(rand.Reader, msg, crypto.Hash(0))
+	} else {
+		sum := sha256.Sum256(msg)
+		sig, err = s.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("signing: %w", err)
+	}
+
+	return &Envelope{
+		PayloadType: payloadType,
+		Payload:     payload,
+		Signatures:  []Signature{{KeyID: s.keyID, Sig: sig}},
+	}, nil
+}
+
+// Attest returns a signed in-toto statement that predicate, of type
+// predicateType, describes subject.
+func (s *Signer) Attest(subject Subject, predicateType string, predicate []byte) (*Envelope, error) {
+	payload, err := json.Marshal(Statement{
+		Type:          StatementType,
+		Subject:       []Subject{subject},
+		PredicateType: predicateType,
+		Predicate:     predicate,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling statement: %w", err)
+	}
+	return s.Sign(PayloadType, payload)
+}
+
+// Verify checks the envelope carries a valid signature by pub.
+func (e *Envelope) Verify(pub crypto.PublicKey) error {
+	msg := PAE(e.PayloadType, e.Payload)
+	sum := sha256.Sum256(msg)
+	for _, sig := range e.Signatures {
+		switch pub := pub.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(pub, sum[:], sig.Sig) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(pub, msg, sig.Sig) {
+				return nil
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig.Sig) == nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("unsupported key type %T", pub)
+		}
+	}
+	return errors.New("no valid signature")
+}
+
+// PAE returns the DSSE pre-authentication encoding of a payload, which is
+// what is signed.
+func PAE(payloadType string, payload []byte) []byte {
+	var b []byte
+	b = append(b, "DSSEv1 "...)
+	b = strconv.AppendInt(b, int64(len(payloadType)), 10)
+	b = append(b, ' ')
+	b = append(b, payloadType...)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, int64(len(payload)), 10)
+	b = append(b, ' ')
+	b = append(b, payload...)
+	return b
+}
+
+// WriteFile writes the envelope to filename as a single line of JSON, as
+// `cosign attach attestation` and other tools consume them.
+func (e *Envelope) WriteFile(filename string) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("marshaling envelope: %w", err)
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644) //nolint:gosec // attestations are public
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPAE(t *testing.T) {
+	// The example from the DSSE protocol specification.
+	require.Equal(t, "DSSEv1 29 http://example.com/HelloWorld 11 hello world",
+		string(PAE("http://example.com/HelloWorld", []byte("hello world"))))
+}
+
+func writeKey(t *testing.T, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+	return path
+}
+
+func TestSign(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		key  crypto.Signer
+		typ  string
+		der  []byte
+	}{
+		{name: "ecdsa pkcs8", key: ecKey, typ: "PRIVATE KEY"},
+		{name: "ecdsa sec1", key: ecKey, typ: "EC PRIVATE KEY", der: ecDER},
+		{name: "ed25519", key: edKey, typ: "PRIVATE KEY"},
+		{name: "rsa pkcs1", key: rsaKey, typ: "RSA PRIVATE KEY", der: x509.MarshalPKCS1PrivateKey(rsaKey)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			der := tc.der
+			if der == nil {
+				der, err = x509.MarshalPKCS8PrivateKey(tc.key)
+				require.NoError(t, err)
+			}
+			signer, err := LoadSigner(writeKey(t, tc.typ, der))
+			require.NoError(t, err)
+			require.Len(t, signer.KeyID(), 64)
+
+			env, err := signer.Attest(Subject{
+				Name:   "example.com/image",
+				Digest: map[string]string{"sha256": "abc"},
+			}, "https://spdx.dev/Document", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+			require.NoError(t, err)
+			require.Equal(t, PayloadType, env.PayloadType)
+			require.Equal(t, signer.KeyID(), env.Signatures[0].KeyID)
+			require.NoError(t, env.Verify(tc.key.Public()))
+
+			// The envelope round-trips through its file form.
+			path := filepath.Join(t.TempDir(), "att.intoto.jsonl")
+			require.NoError(t, env.WriteFile(path))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			var got Envelope
+			require.NoError(t, json.Unmarshal(data, &got))
+			require.NoError(t, got.Verify(tc.key.Public()))
+
+			var st Statement
+			require.NoError(t, json.Unmarshal(got.Payload, &st))
+			require.Equal(t, StatementType, st.Type)
+			require.Equal(t, "https://spdx.dev/Document", st.PredicateType)
+			require.JSONEq(t, `{"spdxVersion":"SPDX-2.3"}`, string(st.Predicate))
+
+			// Tampering invalidates the signature.
+			got.Payload = append(got.Payload, ' ')
+			require.Error(t, got.Verify(tc.key.Public()))
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		signer, err := NewSigner(ecKey)
+		require.NoError(t, err)
+		env, err := signer.Sign(PayloadType, []byte("{}"))
+		require.NoError(t, err)
+		other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		require.Error(t, env.Verify(&other.PublicKey))
+	})
+}
+
+func TestLoadSignerErrors(t *testing.T) {
+	_, err := LoadSigner(filepath.Join(t.TempDir(), "missing.pem"))
+	require.Error(t, err)
+
+	notPEM := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a key"), 0o600))
+	_, err = LoadSigner(notPEM)
+	require.ErrorContains(t, err, "no PEM block")
+
+	_, err = LoadSigner(writeKey(t, "ENCRYPTED PRIVATE KEY", []byte("x")))
+	require.ErrorContains(t, err, "encrypted keys are not supported")
+
+	_, err = LoadSigner(writeKey(t, "PUBLIC KEY", []byte("x")))
+	require.ErrorContains(t, err, "unsupported PEM block")
+
+	_, err = LoadSigner(writeKey(t, "PRIVATE KEY", []byte("garbage")))
+	require.Error(t, err)
+}
@@ -17,10 +17,24 @@ package build
 import (
 	"context"
 	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 
+	"github.com/chainguard-dev/clog"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/apimachinery/pkg/util/sets"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/sigstore"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/paths"
 )
 
 func (bc *Context) postBuildSetApk(ctx context.Context) error {
@@ -38,6 +52,137 @@ func (bc *Context) postBuildSetApk(ctx context.Context) error {
 	return nil
 }
 
+// excludedPaths returns the parts of the apk database which should be left
+// out of the image layers, as configured by apk-database. The database is
+// still in the build filesystem, so SBOMs generated from it are unaffected.
+func (bc *Context) excludedPaths() []string {
+	switch bc.ic.APKDatabase {
+	case types.APKDatabaseInstalled:
+		var paths []string
+		for _, db := range []string{"usr/lib/apk/db", "lib/apk/db"} {
+			paths = append(paths, db+"/scripts.tar", db+"/scripts.tar.gz", db+"/triggers")
+		}
+		return paths
+	case types.APKDatabaseNone:
+		return []string{"usr/lib/apk/db", "lib/apk/db", "etc/apk"}
+	default:
+		return nil
+	}
+}
+
+// keyringPolicy returns the apk keyring policy for the configured pins.
+func keyringPolicy(p *types.KeyringPolicy) apk.KeyringPolicy {
+	if p == nil {
+		return apk.KeyringPolicy{}
+	}
+	pins := make(map[string][]string, len(p.Pins))
+	for _, pin := range p.Pins {
+		repo := strings.TrimRight(pin.Repository, "/")
+		pins[repo] = append(pins[repo], pin.Fingerprints...)
+	}
+	return apk.KeyringPolicy{
+		Pins: pins,
+		Warn: p.Mode == types.KeyringPolicyWarn,
+	}
+}
+
+// indexVerifications returns the apk options verifying the indexes of the
+// repositories with a Sigstore policy, and the OCI keyring artifacts.
+func (bc *Context) indexVerifications() ([]apk.Option, error) {
+	opts := make([]apk.Option, 0, len(bc.ic.Contents.Sigstore))
+	for _, p := range bc.ic.Contents.Sigstore {
+		trustedRoot := p.TrustedRoot
+		if trustedRoot != "" {
+			var err error
+			trustedRoot, err = paths.ResolvePath(trustedRoot, bc.o.IncludePaths)
+			if err != nil {
+				return nil, fmt.Errorf("sigstore trusted root %s: %w", p.TrustedRoot, err)
+			}
+		}
+		v, err := sigstore.NewVerifier(sigstore.Policy{
+			Identity:       p.Identity,
+			IdentityRegexp: p.IdentityRegexp,
+			Issuer:         p.Issuer,
+			IssuerRegexp:   p.IssuerRegexp,
+			TrustedRoot:    trustedRoot,
+			Transport:      apk.AuditTransport(http.DefaultTransport, bc.o.NetworkAuditor, ""),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("sigstore policy for %s: %w", p.Repository, err)
+		}
+		if strings.HasPrefix(p.Repository, apk.OCIKeyringScheme) {
+			opts = append(opts, apk.WithKeyringVerification(p.Repository, v))
+			continue
+		}
+		opts = append(opts, apk.WithIndexVerification(p.Repository, apk.IndexVerification{
+			Verifier: v,
+			SkipKeys: p.Mode == types.SigstoreModeOnly,
+		}))
+	}
+	return opts, nil
+}
+
+// signaturePolicies returns the apk options setting the signature policy of
+// each configured repository.
+func signaturePolicies(policies []types.SignaturePolicy) []apk.Option {
+	opts := make([]apk.Option, 0, len(policies))
+	for _, p := range policies {
+		opts = append(opts, apk.WithSignaturePolicy(p.Repository, apk.SignaturePolicy{
+			IgnoreIndexSignature:  p.RequireSignedIndex != nil && !*p.RequireSignedIndex,
+			RequireSignedPackages: p.RequireSignedPackages,
+			AllowUnsigned:         p.AllowUnsigned,
+			KeyIDs:                p.RequiredKeyIDs,
+		}))
+	}
+	return opts
+}
+
+// ReasonAllSignaturesIgnored is the reason recorded for the repositories
+// whose signatures are ignored with the deprecated WithIgnoreSignatures.
+const ReasonAllSignaturesIgnored = "the signatures of all repositories are ignored with the deprecated --ignore-signatures"
+
+// unsignAllRepositories maps the deprecated IgnoreSignatures to ignoring the
+// signatures of each repository of the build, so that their indexes and
+// packages record why, as though they had been given to
+// WithUnsignedRepositories.
+func (bc *Context) unsignAllRepositories() {
+	if !bc.o.IgnoreSignatures {
+		return
+	}
+	unsigned := maps.Clone(bc.o.UnsignedRepositories)
+	if unsigned == nil {
+		unsigned = map[string]string{}
+	}
+	for _, repo := range slices.Concat(bc.ic.Contents.BuildRepositories, bc.ic.Contents.RuntimeRepositories, bc.o.ExtraBuildRepos, bc.o.ExtraRuntimeRepos) {
+		repo, _ = localRepository(repo)
+		if repo = strings.TrimRight(repo, "/"); repo == "" {
+			continue
+		}
+		if _, ok := unsigned[repo]; !ok {
+			unsigned[repo] = ReasonAllSignaturesIgnored
+		}
+	}
+	bc.o.UnsignedRepositories = unsigned
+}
+
+// OCIKeyringKeys returns the keys held by the OCI artifact of a keyring
+// entry, verified as the configuration requires, by their name.
+func (bc *Context) OCIKeyringKeys(ctx context.Context, element string) (map[string][]byte, error) {
+	return bc.apk.FetchOCIKeys(ctx, element)
+}
+
+// unsignedRepositories returns the apk options ignoring the signatures of
+// each repository, warning about each.
+func unsignedRepositories(ctx context.Context, unsigned map[string]string) []apk.Option {
+	log := clog.FromContext(ctx)
+	opts := make([]apk.Option, 0, len(unsigned))
+	for _, repo := range slices.Sorted(maps.Keys(unsigned)) {
+		log.Warnf("ignoring the signatures of %s: %s", repo, unsigned[repo])
+		opts = append(opts, apk.WithUnsignedRepository(repo, unsigned[repo]))
+	}
+	return opts
+}
+
 func (bc *Context) initializeApk(ctx context.Context) error {
 	ctx, span := otel.Tracer("apko").Start(ctx, "initializeApk")
 	defer span.End()
@@ -99,3 +244,89 @@ func (bc *Context) initializeApk(ctx context.Context) error {
 
 	return nil
 }
+
+// localRepositoryKeys returns the options accepting the keys which signed
+// the indexes of the local repositories, and which the keyring has no key of
+// the name of, for those repositories only. As melange writes the key next to
+// the directory of the packages it builds, they are looked for in the
+// repository directory and the one above it.
+func (bc *Context) localRepositoryKeys(ctx context.Context) []apk.Option {
+	log := clog.FromContext(ctx)
+	have := map[string]bool{}
+	for _, k := range slices.Concat(bc.ic.Contents.Keyring, bc.o.ExtraKeyFiles) {
+		have[path.Base(k)] = true
+	}
+
+	var opts []apk.Option
+	for _, repo := range slices.Concat(bc.ic.Contents.BuildRepositories, bc.ic.Contents.RuntimeRepositories, bc.o.ExtraBuildRepos, bc.o.ExtraRuntimeRepos) {
+		dir, ok := localRepository(repo)
+		if !ok {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, bc.o.Arch.ToAPK(), "APKINDEX.tar.gz"))
+		if err != nil {
+			continue
+		}
+		names, err := apk.IndexKeyNames(f)
+		f.Close()
+		if err != nil {
+			log.Debugf("reading the signatures of the index of %s: %v", dir, err)
+			continue
+		}
+		keys := map[string][]byte{}
+		for _, name := range names {
+			if have[name] {
+				continue
+			}
+			for _, d := range []string{dir, filepath.Dir(filepath.Clean(dir))} {
+				if b, err := os.ReadFile(filepath.Join(d, name)); err == nil {
+					log.Infof("using key %s for local repository %s", filepath.Join(d, name), dir)
+					keys[name] = b
+					break
+				}
+			}
+		}
+		if len(keys) > 0 {
+			opts = append(opts, apk.WithRepositoryKeys(dir, keys))
+		}
+	}
+	return opts
+}
+
+// localRepository returns the directory of repo, which may be tagged, and
+// reports whether it is a local repository.
+func localRepository(repo string) (string, bool) {
+	if strings.HasPrefix(repo, "@") {
+		fields := strings.Fields(repo)
+		if len(fields) < 2 {
+			return "", false
+		}
+		repo = fields[1]
+	}
+	return repo, !strings.Contains(repo, "://")
+}
+
+// DefaultArchs returns the architectures built when neither the
+// configuration nor the command line sets them: those the local repositories
+// have packages for, as melange writes a directory for each architecture it
+// builds for, or else all of them.
+func DefaultArchs(o *options.Options, ic *types.ImageConfiguration) []types.Architecture {
+	repos := slices.Concat(ic.Contents.BuildRepositories, ic.Contents.RuntimeRepositories, o.ExtraBuildRepos, o.ExtraRuntimeRepos)
+	var archs []types.Architecture
+	for _, arch := range types.AllArchs {
+		for _, repo := range repos {
+			dir, ok := localRepository(repo)
+			if !ok {
+				continue
+			}
+			if apks, _ := filepath.Glob(filepath.Join(dir, arch.ToAPK(), "*.apk")); len(apks) > 0 {
+				archs = append(archs, arch)
+				break
+			}
+		}
+	}
+	if len(archs) == 0 {
+		return types.AllArchs
+	}
+	return archs
+}
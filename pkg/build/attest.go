@@ -0,0 +1,103 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/attest"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/vex"
+)
+
+// AttestationExt is appended to the name of a document to name its signed
+// attestation.
+const AttestationExt = ".intoto.jsonl"
+
+// predicateTypes maps the formats of the documents written along images to
+// their in-toto predicate types.
+var predicateTypes = map[string]string{
+	"spdx":      "https://spdx.dev/Document",
+	"cyclonedx": "https://cyclonedx.org/bom",
+	vex.Format:  vex.Context,
+}
+
+// AttestSBOMs signs each of the documents in docs, written along the image,
+// as an in-toto attestation about the image it describes, with the key given
+// with WithSBOMAttestationKey. Each attestation is written as a DSSE envelope
+// next to its document, so that both can be carried with the image tarball
+// and published later, e.g. with `cosign attach attestation`.
+func AttestSBOMs(ctx context.Context, o options.Options, docs []types.SBOM) ([]types.SBOM, error) {
+	log := clog.FromContext(ctx)
+	_, span := otel.Tracer("apko").Start(ctx, "AttestSBOMs")
+	defer span.End()
+
+	if o.SBOMAttestationKey == "" {
+		return nil, nil
+	}
+
+	signer, err := attest.LoadSigner(o.SBOMAttestationKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading attestation key: %w", err)
+	}
+
+	subject := "image"
+	if len(o.Tags) != 0 {
+		ref, err := name.ParseReference(o.Tags[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing tag %q: %w", o.Tags[0], err)
+		}
+		subject = ref.Context().Name()
+	}
+
+	attestations := make([]types.SBOM, 0, len(docs))
+	for _, doc := range docs {
+		predicateType, ok := predicateTypes[doc.Format]
+		if !ok {
+			return nil, fmt.Errorf("no predicate type for %s documents", doc.Format)
+		}
+		predicate, err := os.ReadFile(doc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", doc.Path, err)
+		}
+		env, err := signer.Attest(attest.Subject{
+			Name:   subject,
+			Digest: map[string]string{doc.Digest.Algorithm: doc.Digest.Hex},
+		}, predicateType, predicate)
+		if err != nil {
+			return nil, fmt.Errorf("attesting %s: %w", doc.Path, err)
+		}
+		filename := doc.Path + AttestationExt
+		if err := env.WriteFile(filename); err != nil {
+			return nil, fmt.Errorf("writing attestation: %w", err)
+		}
+		log.Debugf("wrote attestation %s", filename)
+		attestations = append(attestations, types.SBOM{
+			Arch:   doc.Arch,
+			Path:   filename,
+			Format: doc.Format + AttestationExt,
+			Digest: doc.Digest,
+		})
+	}
+	log.Infof("signed %d attestations with key %s", len(attestations), signer.KeyID())
+	return attestations, nil
+}
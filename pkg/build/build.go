@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -34,6 +35,7 @@ import (
 	v1types "github.com/google/go-containerregistry/pkg/v1/types"
 	"go.opentelemetry.io/otel"
 	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/chainguard-dev/clog"
 
@@ -44,6 +46,7 @@ import (
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/paths"
 	"chainguard.dev/apko/pkg/s6"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
 )
 
 // compressionCache stores descriptor information for already-compressed layers,
@@ -64,6 +67,21 @@ type Context struct {
 	fs      apkfs.FullFS
 	apk     *apk.APK
 	baseimg *baseimg.BaseImage
+
+	extraFixups   []Fixup
+	appliedFixups []Fixup
+	// licenseFiles are the license files collected by the licenses fixup.
+	licenseFiles []soptions.LicenseFile
+	// localFiles are the files copied from the build context.
+	localFiles []soptions.LocalFile
+	// remoteFiles are the files fetched by URL.
+	remoteFiles []soptions.RemoteFile
+
+	// configSBOMFormats is set when the image configuration's sbom-formats
+	// take precedence over o.SBOMFormats.
+	configSBOMFormats bool
+
+	metrics *metrics
 }
 
 func (bc *Context) Summarize(ctx context.Context) {
@@ -153,8 +171,12 @@ func (bc *Context) BuildLayers(ctx context.Context) ([]v1.Layer, error) {
 		if err != nil {
 			return nil, err
 		}
+		pkgs, err := bc.layerPackages()
+		if err != nil {
+			return nil, fmt.Errorf("listing installed packages: %w", err)
+		}
 
-		return []v1.Layer{layer}, nil
+		return []v1.Layer{withCreatedBy(layer, installCreatedBy(pkgs)+", then configure the image")}, nil
 	}
 
 	return bc.buildLayers(ctx)
@@ -166,6 +188,7 @@ func (bc *Context) BuildLayers(ctx context.Context) ([]v1.Layer, error) {
 func (bc *Context) ImageLayoutToLayer(ctx context.Context) (string, v1.Layer, error) {
 	ctx, span := otel.Tracer("apko").Start(ctx, "ImageLayoutToLayer")
 	defer span.End()
+	defer bc.metrics.observe(bc.Arch(), "layers", time.Now())
 
 	if err := bc.checkPaths(ctx); err != nil {
 		return "", nil, err
@@ -189,7 +212,18 @@ func (bc *Context) ImageLayoutToLayer(ctx context.Context) (string, v1.Layer, er
 
 	lw := newLayerWriter(outfile)
 
-	if err := writeTar(ctx, lw.w, bc.fs); err != nil {
+	// remove what the layer leaves out from the base image below it
+	whiteouts, err := bc.baseWhiteouts(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, hdr := range whiteouts {
+		if err := lw.w.WriteHeader(hdr); err != nil {
+			return "", nil, fmt.Errorf("writing whiteout %s: %w", hdr.Name, err)
+		}
+	}
+
+	if err := writeTar(ctx, lw.w, bc.fs, bc.excludedPaths()...); err != nil {
 		return "", nil, fmt.Errorf("generating tarball: %w", err)
 	}
 
@@ -218,6 +252,12 @@ func (bc *Context) checkPaths(ctx context.Context) error {
 	return nil
 }
 
+func (bc *Context) resolveSBOMFormats() {
+	if bc.configSBOMFormats && len(bc.ic.SBOMFormats) != 0 {
+		bc.o.SBOMFormats = bc.ic.SBOMFormats
+	}
+}
+
 // NewOptions evaluates the build.Options in the same way as New().
 func NewOptions(opts ...Option) (*options.Options, *types.ImageConfiguration, error) {
 	bc := Context{
@@ -230,9 +270,108 @@ func NewOptions(opts ...Option) (*options.Options, *types.ImageConfiguration, er
 		}
 	}
 
+	if err := bc.applyVariant(); err != nil {
+		return nil, nil, err
+	}
+	if err := bc.ic.ExpandBuildArgs(bc.o.BuildArgs); err != nil {
+		return nil, nil, err
+	}
+	bc.resolveSBOMFormats()
+	if err := bc.setConfigDigest(); err != nil {
+		return nil, nil, err
+	}
+	bc.unsignAllRepositories()
+
 	return &bc.o, &bc.ic, nil
 }
 
+// setConfigDigest computes the digest of the configuration, unless it was
+// given, and records it in the annotations of the image. The extra
+// packages, repositories and keys given as options change the contents of
+// the image, so they are digested along with the configuration.
+func (bc *Context) setConfigDigest() error {
+	if bc.o.ConfigDigest == "" {
+		effective := bc.ic
+		effective.Contents.BuildRepositories = withExtra(effective.Contents.BuildRepositories, bc.o.ExtraBuildRepos)
+		effective.Contents.RuntimeRepositories = withExtra(effective.Contents.RuntimeRepositories, bc.o.ExtraRuntimeRepos)
+		effective.Contents.Keyring = withExtra(effective.Contents.Keyring, bc.o.ExtraKeyFiles)
+		effective.Contents.Packages = withExtra(effective.Contents.Packages, bc.o.ExtraPackages)
+		digest, err := effective.Digest()
+		if err != nil {
+			return err
+		}
+		bc.o.ConfigDigest = digest
+	}
+	// The annotations may be shared with the configuration passed in.
+	bc.ic.Annotations = maps.Clone(bc.ic.Annotations)
+	if bc.ic.Annotations == nil {
+		bc.ic.Annotations = map[string]string{}
+	}
+	bc.ic.Annotations[types.ConfigDigestAnnotation] = bc.o.ConfigDigest
+	return nil
+}
+
+// withExtra returns the sorted union of list and extra, or list unchanged
+// when there is nothing extra.
+func withExtra(list, extra []string) []string {
+	if len(extra) == 0 {
+		return list
+	}
+	return sets.List(sets.New(list...).Insert(extra...))
+}
+
+// ProbeVCS sets the VCS URL and annotations of ic from the Git repository
+// at the VCS path of o, or else containing its configuration file within
+// the working directory.
+func ProbeVCS(ctx context.Context, o *options.Options, ic *types.ImageConfiguration) {
+	switch {
+	case o.VCSPath != "":
+		ic.ProbeVCS(ctx, o.VCSPath, "", o.VCSTagPrefix)
+	case o.ImageConfigFile != "":
+		toplevelDir, err := os.Getwd()
+		if err != nil {
+			clog.FromContext(ctx).Debugf("failed to probe VCS URL: cannot find working directory: %v", err)
+			return
+		}
+		ic.ProbeVCS(ctx, o.ImageConfigFile, toplevelDir, o.VCSTagPrefix)
+	}
+}
+
+// debugLockfile returns the lockfile of the debug image of an image locked by
+// lockfile, as written by apko lock --debug-image.
+func debugLockfile(lockfile string) string {
+	return strings.TrimSuffix(lockfile, ".lock.json") + "." + types.DebugVariantName + ".lock.json"
+}
+
+// applyVariant applies the variant of the build to the configuration, then
+// the debug variant when building a debug image, which installs other
+// packages so it is locked by its own lockfile.
+func (bc *Context) applyVariant() error {
+	variants := bc.ic.Variants
+	if err := bc.ic.ApplyVariant(bc.o.Variant); err != nil {
+		return err
+	}
+	if !bc.o.DebugImage || bc.o.Variant == types.DebugVariantName {
+		return nil
+	}
+	debug, ok := variants[types.DebugVariantName]
+	if !ok {
+		debug = types.DebugVariant(bc.o.DebugPackages)
+	}
+	bc.ic.Variants = map[string]types.ImageVariant{types.DebugVariantName: debug}
+	if err := bc.ic.ApplyVariant(types.DebugVariantName); err != nil {
+		return err
+	}
+	if bc.o.Lockfile != "" {
+		lockfile := debugLockfile(bc.o.Lockfile)
+		if _, err := os.Stat(lockfile); err != nil {
+			return fmt.Errorf("the debug image is locked by %s, written by apko lock --debug-image: %w", lockfile, err)
+		}
+		bc.o.Lockfile = lockfile
+	}
+	return nil
+}
+
 // New creates a build context.
 // The SOURCE_DATE_EPOCH env variable is supported and will
 // overwrite the provided timestamp if present.
@@ -253,6 +392,31 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		}
 	}
 
+	if err := bc.applyVariant(); err != nil {
+		return nil, err
+	}
+	if err := bc.ic.ExpandBuildArgs(bc.o.BuildArgs); err != nil {
+		return nil, err
+	}
+	bc.resolveSBOMFormats()
+	if err := bc.setConfigDigest(); err != nil {
+		return nil, err
+	}
+	bc.unsignAllRepositories()
+
+	// Probe the VCS URL if it is not set and we are asked to do so.
+	if bc.o.WithVCS && bc.ic.VCSUrl == "" {
+		ProbeVCS(ctx, &bc.o, &bc.ic)
+	}
+
+	if bc.o.Locked && bc.o.Lockfile == "" {
+		return nil, errors.New("a locked build requires a lockfile")
+	}
+	// A frozen build may only use what is in the cache.
+	if bc.o.Frozen {
+		bc.o.Offline = true
+	}
+
 	// SOURCE_DATE_EPOCH will always overwrite the build flag
 	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && len(strings.TrimSpace(v)) != 0 {
 		// The value MUST be an ASCII representation of an integer
@@ -278,10 +442,37 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		apk.WithFS(bc.fs),
 		apk.WithArch(bc.o.Arch.ToAPK()),
 		apk.WithIgnoreMknodErrors(true),
-		apk.WithIgnoreIndexSignatures(bc.o.IgnoreSignatures),
+		apk.WithVerifyPackageSignatures(bc.o.VerifyPackageSignatures),
+		apk.WithLocalIndexSynthesis(bc.o.LocalIndexSynthesis),
 		apk.WithAuthenticator(bc.o.Auth),
 		apk.WithTransport(bc.o.Transport),
+		apk.WithProgressReporter(bc.o.Progress),
+		apk.WithMetricsRegistry(bc.o.Metrics),
+		apk.WithFetchTimeout(bc.o.FetchTimeout),
+		apk.WithResolveTimeout(bc.o.ResolveTimeout),
+		apk.WithNetworkAuditor(bc.o.NetworkAuditor),
+		apk.WithExecutor(bc.o.Executor),
+		apk.WithKeyringPolicy(keyringPolicy(bc.ic.Contents.KeyringPolicy)),
+		apk.WithFileFilter(kernelFileFilter(bc.ic.Kernel)),
+		apk.WithPermissionsPolicy(bc.o.PermissionsPolicy),
+		apk.WithNormalizationRecorder(bc.o.NormalizationRecorder),
+		apk.WithBaseDirectoryPolicy(bc.o.BaseDirectoryPolicy),
+	}
+	apkOpts = append(apkOpts, bc.o.DownloadLimits...)
+	if bc.o.RetryPolicy != nil {
+		apkOpts = append(apkOpts, apk.WithRetryPolicy(*bc.o.RetryPolicy))
+	}
+	verifications, err := bc.indexVerifications()
+	if err != nil {
+		return nil, err
 	}
+	apkOpts = append(apkOpts, verifications...)
+	apkOpts = append(apkOpts, signaturePolicies(bc.ic.Contents.SignaturePolicies)...)
+	if bc.o.IgnoreSignatures {
+		log.Warnf("ignoring the signatures of all repositories is deprecated; ignore those of specific repositories, with a reason, instead")
+	}
+	apkOpts = append(apkOpts, unsignedRepositories(ctx, bc.o.UnsignedRepositories)...)
+	apkOpts = append(apkOpts, bc.localRepositoryKeys(ctx)...)
 	// only try to pass the cache dir if one of the following is true:
 	// - the user has explicitly set a cache dir
 	// - the user's system-determined cachedir, as set by os.UserCacheDir(), can be found
@@ -295,6 +486,8 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		apkOpts = append(apkOpts, apk.WithCache(bc.o.CacheDir, bc.o.Offline, bc.o.SharedCache))
 	} else if _, err := os.UserCacheDir(); err == nil {
 		apkOpts = append(apkOpts, apk.WithCache(bc.o.CacheDir, bc.o.Offline, bc.o.SharedCache))
+	} else if bc.o.Frozen {
+		return nil, fmt.Errorf("a frozen build requires a cache, but cache dir was not set, and cannot determine system default: %w", err)
 	} else {
 		log.Warnf("cache disabled because cache dir was not set, and cannot determine system default: %v", err)
 	}
@@ -326,14 +519,21 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 
 	bc.apk = apkImpl
 
+	bc.metrics, err = newMetrics(bc.o.Metrics)
+	if err != nil {
+		return nil, fmt.Errorf("registering metrics: %w", err)
+	}
+
 	log.Debugf("doing pre-flight checks")
 	if err := bc.ic.Validate(); err != nil {
 		return nil, fmt.Errorf("failed to validate configuration: %w", err)
 	}
 
+	start := time.Now()
 	if err := bc.initializeApk(ctx); err != nil {
 		return nil, fmt.Errorf("initializing apk: %w", err)
 	}
+	bc.metrics.observe(bc.Arch(), "init", start)
 
 	bc.s6 = s6.New(bc.fs)
 
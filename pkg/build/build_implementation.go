@@ -27,6 +27,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/chainguard-dev/clog"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -132,6 +133,7 @@ func newLayerWriter(out *os.File) *layerWriter {
 
 func (bc *Context) buildImage(ctx context.Context) ([]*apk.Package, error) {
 	log := clog.FromContext(ctx)
+	defer bc.metrics.observe(bc.Arch(), "install", time.Now())
 
 	// When using base image for the build, apko adds new layer on top of the base. This means
 	// it will override files from lower layers. We add all installed packages from base to current
@@ -148,28 +150,44 @@ func (bc *Context) buildImage(ctx context.Context) ([]*apk.Package, error) {
 		}
 	}
 
+	// The policies are evaluated against the packages about to be
+	// installed, which are resolved only once.
 	var (
 		pkgs []*apk.Package
 		err  error
 	)
 	if bc.o.Lockfile != "" {
 		log.Debugf("Using lockfile: %s", bc.o.Lockfile)
-		lock, err := lock.FromFile(bc.o.Lockfile)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load lock-file: %w", err)
-		}
-		err = bc.VerifyLockfileConsistency(ctx, lock.Config)
+		l, allPkgs, err := bc.loadLock(ctx)
 		if err != nil {
 			return nil, err
 		}
-		allPkgs, err := installablePackagesForArch(lock, bc.Arch())
-		if err != nil {
-			return nil, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
+		if bc.o.Policy != nil {
+			planned, urls, err := bc.lockedPackages(ctx, l)
+			if err != nil {
+				return nil, err
+			}
+			if err := bc.checkPlannedPolicies(ctx, planned, urls); err != nil {
+				return nil, err
+			}
 		}
 		pkgs, err = bc.apk.InstallPackages(ctx, &bc.o.SourceDateEpoch, allPkgs)
 		if err != nil {
 			return nil, fmt.Errorf("failed installation from lockfile %s: %w", bc.o.Lockfile, err)
 		}
+	} else if bc.o.Policy != nil {
+		resolved, conflicts, err := bc.BuildPackageList(ctx)
+		if err != nil {
+			return nil, err
+		}
+		planned, urls := resolvedPackages(resolved)
+		if err := bc.checkPlannedPolicies(ctx, planned, urls); err != nil {
+			return nil, err
+		}
+		pkgs, err = bc.apk.FixateResolvedWorld(ctx, &bc.o.SourceDateEpoch, resolved, conflicts)
+		if err != nil {
+			return nil, fmt.Errorf("installing apk packages: %w", err)
+		}
 	} else {
 		pkgs, err = bc.apk.FixateWorld(ctx, &bc.o.SourceDateEpoch)
 		if err != nil {
@@ -177,6 +195,10 @@ func (bc *Context) buildImage(ctx context.Context) ([]*apk.Package, error) {
 		}
 	}
 
+	if err := rewriteModuleIndexes(bc.fs, bc.ic.Kernel); err != nil {
+		return nil, fmt.Errorf("failed to rewrite kernel module indexes: %w", err)
+	}
+
 	// For now adding additional accounts is banned when using base image. On the other hand, we don't want to
 	// wipe out the users set in base.
 	// If one wants to add a support for adding additional users they would need to look into this piece of code.
@@ -186,10 +208,32 @@ func (bc *Context) buildImage(ctx context.Context) ([]*apk.Package, error) {
 		}
 	}
 
+	if err := generateOSRelease(bc.fs, &bc.ic); err != nil {
+		return nil, fmt.Errorf("failed to generate /etc/os-release: %w", err)
+	}
+
+	if err := writeSystemConfig(bc.fs, &bc.ic); err != nil {
+		return nil, fmt.Errorf("failed to write system configuration: %w", err)
+	}
+
 	if err := bc.WriteEtcApkoConfig(ctx); err != nil {
 		return nil, fmt.Errorf("failed to install apko config: %w", err)
 	}
 
+	vars, err := bc.substitutionVariables()
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy local files: %w", err)
+	}
+	bc.localFiles, err = copyLocalFiles(ctx, bc.fs, bc.o.IncludePaths, bc.ic.Contents.LocalFiles, vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy local files: %w", err)
+	}
+
+	bc.remoteFiles, err = bc.installRemoteFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to install remote files: %w", err)
+	}
+
 	if err := mutatePaths(bc.fs, &bc.o, &bc.ic); err != nil {
 		return nil, fmt.Errorf("failed to mutate paths: %w", err)
 	}
@@ -198,23 +242,36 @@ func (bc *Context) buildImage(ctx context.Context) ([]*apk.Package, error) {
 		return nil, fmt.Errorf("failed to write supervision tree: %w", err)
 	}
 
-	// add busybox symlinks
+	if err := bc.s6.WriteServices(ctx, bc.ic.Services); err != nil {
+		return nil, fmt.Errorf("failed to write services: %w", err)
+	}
+
+	if err := bc.s6.WriteServiceDefinitions(ctx, bc.ic.Entrypoint.S6RC); err != nil {
+		return nil, fmt.Errorf("failed to write s6-rc service definitions: %w", err)
+	}
+
+	// add necessary character devices
+	if err := installCharDevices(bc.fs); err != nil {
+		return nil, err
+	}
+
 	installed, err := bc.apk.GetInstalled()
 	if err != nil {
 		return nil, fmt.Errorf("getting installed packages: %w", err)
 	}
 
-	if err := installBusyboxLinks(bc.fs, installed); err != nil {
+	if err := bc.runFixups(ctx, installed); err != nil {
 		return nil, err
 	}
 
-	// add necessary character devices
-	if err := installCharDevices(bc.fs); err != nil {
+	if err := applyDirectoryModes(bc.fs, &bc.ic, installed); err != nil {
 		return nil, err
 	}
 
-	if err := updateCache(ctx, bc.fs); err != nil {
-		return nil, err
+	if bc.o.CheckEntrypoint {
+		if err := bc.checkEntrypoint(ctx); err != nil {
+			return nil, err
+		}
 	}
 
 	log.Debug("finished building filesystem")
@@ -230,16 +287,14 @@ func (bc *Context) VerifyLockfileConsistency(ctx context.Context, lockConfig *lo
 		return fmt.Errorf("checksum in the lock file '%v' does not matches the original config: '%v' "+
 			"(maybe regenerate the lock file)",
 			bc.o.Lockfile, bc.o.ImageConfigFile)
+	} else if lockConfig.Digest != "" && bc.o.ConfigDigest != "" && lockConfig.Digest != bc.o.ConfigDigest {
+		log.Warnf("The effective configuration (%s) differs from the one the lock file %s was generated from (%s).",
+			bc.o.ConfigDigest, bc.o.Lockfile, lockConfig.Digest)
 	}
 	return nil
 }
 
-func updateCache(ctx context.Context, fsys apkfs.FullFS) error {
-	if _, err := fsys.Stat("etc/ld.so.conf"); err != nil {
-		clog.FromContext(ctx).Debugf("/etc/ld.so.conf not found, skipping /etc/ld.so.cache update: %v", err)
-		return nil
-	}
-
+func updateCache(_ context.Context, fsys apkfs.FullFS) error {
 	libdirs := []string{"/lib"}
 	dirs, err := ldsocache.ParseLDSOConf(fsys, "etc/ld.so.conf")
 	if err != nil {
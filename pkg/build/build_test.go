@@ -28,6 +28,7 @@ import (
 	"chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
 )
 
 func TestBuildLayers(t *testing.T) {
@@ -124,6 +125,66 @@ func TestBuildImage(t *testing.T) {
 	require.Equal(t, installed[1].Version, "1.0.0-r0")
 }
 
+func TestBuildImageSigstoreTrustedRoot(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := build.New(ctx, fs.NewMemFS(), build.WithImageConfiguration(types.ImageConfiguration{
+		Contents: types.ImageContents{
+			Sigstore: []types.SigstorePolicy{{
+				Repository:  "https://example.com/os",
+				Identity:    "release@example.com",
+				Issuer:      "https://accounts.google.com",
+				TrustedRoot: "missing_trusted_root.json",
+			}},
+		},
+	}))
+	require.ErrorContains(t, err, "sigstore trusted root missing_trusted_root.json")
+}
+
+func TestConfigDigestAnnotation(t *testing.T) {
+	annotations := map[string]string{"foo": "bar"}
+	ic := types.ImageConfiguration{
+		Contents:    types.ImageContents{Packages: []string{"busybox"}},
+		Annotations: annotations,
+	}
+	digest, err := ic.Digest()
+	require.NoError(t, err)
+
+	o, got, err := build.NewOptions(build.WithImageConfiguration(ic))
+	require.NoError(t, err)
+	require.Equal(t, digest, o.ConfigDigest)
+	require.Equal(t, map[string]string{"foo": "bar", types.ConfigDigestAnnotation: digest}, got.Annotations)
+	require.Equal(t, map[string]string{"foo": "bar"}, annotations, "the annotations given are modified")
+
+	// A digest which is given is kept.
+	o, got, err = build.NewOptions(build.WithImageConfiguration(ic), build.WithConfigDigest("sha256:1234"))
+	require.NoError(t, err)
+	require.Equal(t, "sha256:1234", o.ConfigDigest)
+	require.Equal(t, "sha256:1234", got.Annotations[types.ConfigDigestAnnotation])
+
+	// The extra packages, repositories and keys are digested.
+	extras := map[string]build.Option{
+		"packages":      build.WithExtraPackages([]string{"curl"}),
+		"build repos":   build.WithExtraBuildRepos([]string{"https://example.com/build"}),
+		"runtime repos": build.WithExtraRuntimeRepos([]string{"https://example.com/runtime"}),
+		"keys":          build.WithExtraKeys([]string{"https://example.com/key.rsa.pub"}),
+	}
+	for name, opt := range extras {
+		o, _, err := build.NewOptions(build.WithImageConfiguration(ic), opt)
+		require.NoError(t, err)
+		require.NotEqual(t, digest, o.ConfigDigest, name)
+	}
+
+	// They are digested as though they were in the configuration.
+	withPackages := ic
+	withPackages.Contents.Packages = []string{"busybox", "curl"}
+	want, err := withPackages.Digest()
+	require.NoError(t, err)
+	o, _, err = build.NewOptions(build.WithImageConfiguration(ic), build.WithExtraPackages([]string{"curl"}))
+	require.NoError(t, err)
+	require.Equal(t, want, o.ConfigDigest)
+}
+
 func TestBuildImageFromLockFile(t *testing.T) {
 	ctx := context.Background()
 
@@ -153,6 +214,155 @@ func TestBuildImageFromLockFile(t *testing.T) {
 	require.Equal(t, installed[1].Version, "1.0.0-r0")
 }
 
+func TestBuildImageFromTamperedLockFile(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		tamper  func(l *lock.Lock)
+		wantErr string
+	}{{
+		name: "key",
+		tamper: func(l *lock.Lock) {
+			l.Contents.Keyrings[0].Checksum = "sha256-AAAA"
+		},
+		wantErr: "key melange.rsa.pub has checksum",
+	}, {
+		name: "missing key",
+		tamper: func(l *lock.Lock) {
+			l.Contents.Keyrings[0].ID = "other.rsa.pub"
+		},
+		wantErr: "key melange.rsa.pub is not in the lockfile",
+	}, {
+		name: "repository",
+		tamper: func(l *lock.Lock) {
+			for i := range l.Contents.RuntimeRepositories {
+				l.Contents.RuntimeRepositories[i].URL = "https://example.com/" + l.Contents.RuntimeRepositories[i].URL
+			}
+		},
+		wantErr: "do not match the repositories",
+	}, {
+		name: "updated index",
+		tamper: func(l *lock.Lock) {
+			for i := range l.Contents.RuntimeRepositories {
+				l.Contents.RuntimeRepositories[i].Checksum = "sha256-AAAA"
+			}
+		},
+	}, {
+		name: "tampered index",
+		tamper: func(l *lock.Lock) {
+			for i := range l.Contents.RuntimeRepositories {
+				l.Contents.RuntimeRepositories[i].Checksum = "sha256-AAAA"
+			}
+			for i := range l.Contents.Packages {
+				l.Contents.Packages[i].Checksum = "Q1AAAA"
+			}
+		},
+		wantErr: "does not match the lockfile: package pretend-baselayout-1.0.0-r0",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := lock.FromFile(filepath.Join("testdata", "apko.lock.json"))
+			require.NoError(t, err)
+			tc.tamper(&l)
+			lockfile := filepath.Join(t.TempDir(), "apko.lock.json")
+			require.NoError(t, l.SaveToFile(lockfile))
+
+			bc, err := build.New(ctx, fs.NewMemFS(),
+				build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+				build.WithLockFile(lockfile),
+			)
+			require.NoError(t, err)
+			err = bc.BuildImage(ctx)
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildImageLocked(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := build.New(ctx, fs.NewMemFS(),
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithLocked(true, false),
+	)
+	require.ErrorContains(t, err, "a locked build requires a lockfile")
+
+	for _, tc := range []struct {
+		name    string
+		frozen  bool
+		tamper  func(l *lock.Lock)
+		wantErr []string
+	}{{
+		name:   "locked",
+		tamper: func(*lock.Lock) {},
+	}, {
+		name:   "frozen",
+		frozen: true,
+		tamper: func(*lock.Lock) {},
+	}, {
+		name: "without checksums",
+		tamper: func(l *lock.Lock) {
+			l.Contents.Keyrings[0].Checksum = ""
+			for i := range l.Contents.RuntimeRepositories {
+				l.Contents.RuntimeRepositories[i].Checksum = ""
+			}
+		},
+		wantErr: []string{
+			"the lockfile has no checksum for key ./testdata/melange.rsa.pub",
+			"the lockfile has no checksum for index ./testdata/packages/",
+		},
+	}, {
+		name: "updated index",
+		tamper: func(l *lock.Lock) {
+			for i := range l.Contents.RuntimeRepositories {
+				l.Contents.RuntimeRepositories[i].Checksum = "sha256-AAAA"
+			}
+		},
+		wantErr: []string{"changed since the lockfile was generated"},
+	}, {
+		name:   "not cached",
+		frozen: true,
+		tamper: func(l *lock.Lock) {
+			for i := range l.Contents.Packages {
+				l.Contents.Packages[i].URL = "https://packages.example.com/" + filepath.Base(l.Contents.Packages[i].URL)
+			}
+		},
+		wantErr: []string{
+			"package https://packages.example.com/pretend-baselayout-1.0.0-r0.apk is not in the cache",
+			"package https://packages.example.com/replayout-1.0.0-r0.apk is not in the cache",
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := lock.FromFile(filepath.Join("testdata", "apko.lock.json"))
+			require.NoError(t, err)
+			tc.tamper(&l)
+			lockfile := filepath.Join(t.TempDir(), "apko.lock.json")
+			require.NoError(t, l.SaveToFile(lockfile))
+
+			bc, err := build.New(ctx, fs.NewMemFS(),
+				build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+				build.WithLockFile(lockfile),
+				build.WithCache(t.TempDir(), false, nil),
+				build.WithLocked(true, tc.frozen),
+			)
+			require.NoError(t, err)
+			err = bc.BuildImage(ctx)
+			if len(tc.wantErr) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, "the build deviates from the lockfile")
+			for _, want := range tc.wantErr {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
 func TestBuildImageFromTooOldResolvedFile(t *testing.T) {
 	ctx := context.Background()
 
@@ -0,0 +1,172 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	caCertificatesBundle = "/etc/ssl/certs/ca-certificates.crt"
+	caCertificatesConf   = "/etc/ca-certificates.conf"
+	caCertificatesDir    = "/usr/share/ca-certificates"
+	caCertificatesLocal  = "/usr/local/share/ca-certificates"
+)
+
+// packageCertificates returns the paths of the certificates installed by
+// packages which should be in the bundle, following the same rules as
+// update-ca-certificates: if /etc/ca-certificates.conf exists, it selects
+// certificates from /usr/share/ca-certificates (lines starting with "!" are
+// deselected), otherwise every certificate there is used.
+func packageCertificates(fsys apkfs.FullFS) ([]string, error) {
+	var certs []string
+
+	if b, err := fsys.ReadFile(caCertificatesConf); err == nil {
+		for _, line := range strings.Split(string(b), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+				continue
+			}
+			certs = append(certs, path.Join(caCertificatesDir, line))
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", caCertificatesConf, err)
+	} else if err := fs.WalkDir(fsys, caCertificatesDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == caCertificatesDir {
+			return fs.SkipDir
+		} else if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(p, ".crt") {
+			certs = append(certs, p)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking %s: %w", caCertificatesDir, err)
+	}
+
+	entries, err := fsys.ReadDir(caCertificatesLocal)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", caCertificatesLocal, err)
+	}
+	var local []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".crt") {
+			local = append(local, path.Join(caCertificatesLocal, e.Name()))
+		}
+	}
+	slices.Sort(local)
+
+	return append(certs, local...), nil
+}
+
+// updateCACertificates regenerates the CA certificate bundle, standing in for
+// update-ca-certificates which would otherwise run as a package trigger. It
+// only does so if certificates, those of the image configuration, are set,
+// and otherwise leaves the bundle as packages installed it.
+//
+// Additional certificates from the image configuration are written to
+// /usr/local/share/ca-certificates, so they are kept if the bundle is
+// regenerated at runtime, and are added to the bundle. If no package
+// installed any individual certificates (e.g. because it ships a prebuilt
+// bundle), the existing bundle is kept and the additional certificates are
+// appended to it.
+func updateCACertificates(ctx context.Context, fsys apkfs.FullFS, certificates *types.ImageCertificates) (bool, error) {
+	log := clog.FromContext(ctx)
+
+	if certificates == nil {
+		return false, nil
+	}
+	additional := certificates.Additional
+
+	certs, err := packageCertificates(fsys)
+	if err != nil {
+		return false, err
+	}
+	if len(certs) == 0 && len(additional) == 0 {
+		return false, nil
+	}
+
+	var bundle bytes.Buffer
+	if len(certs) == 0 {
+		existing, err := fsys.ReadFile(caCertificatesBundle)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, fmt.Errorf("reading %s: %w", caCertificatesBundle, err)
+		}
+		bundle.Write(existing)
+	}
+
+	for _, c := range certs {
+		// Additional certificates replace any with the same name.
+		if slices.ContainsFunc(additional, func(a types.AdditionalCertificate) bool {
+			return c == path.Join(caCertificatesLocal, a.Name+".crt")
+		}) {
+			continue
+		}
+		b, err := fsys.ReadFile(c)
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warnf("%s lists %s, which does not exist", caCertificatesConf, c)
+			continue
+		} else if err != nil {
+			return false, fmt.Errorf("reading %s: %w", c, err)
+		}
+		appendPEM(&bundle, b)
+	}
+
+	if len(additional) != 0 {
+		if err := fsys.MkdirAll(caCertificatesLocal, 0o755); err != nil {
+			return false, fmt.Errorf("creating %s: %w", caCertificatesLocal, err)
+		}
+	}
+	for _, c := range additional {
+		p := path.Join(caCertificatesLocal, c.Name+".crt")
+		if err := fsys.WriteFile(p, []byte(c.Content), 0o644); err != nil {
+			return false, fmt.Errorf("writing %s: %w", p, err)
+		}
+		appendPEM(&bundle, []byte(c.Content))
+	}
+
+	if err := fsys.MkdirAll(path.Dir(caCertificatesBundle), 0o755); err != nil {
+		return false, fmt.Errorf("creating %s: %w", path.Dir(caCertificatesBundle), err)
+	}
+	if err := fsys.WriteFile(caCertificatesBundle, bundle.Bytes(), 0o644); err != nil {
+		return false, fmt.Errorf("writing %s: %w", caCertificatesBundle, err)
+	}
+	return true, nil
+}
+
+// appendPEM appends a PEM file to the bundle, making sure it ends with a
+// newline so the next certificate starts on its own line.
+func appendPEM(bundle *bytes.Buffer, b []byte) {
+	if bundle.Len() != 0 && !bytes.HasSuffix(bundle.Bytes(), []byte("\n")) {
+		bundle.WriteByte('\n')
+	}
+	bundle.Write(b)
+	if len(b) != 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		bundle.WriteByte('\n')
+	}
+}
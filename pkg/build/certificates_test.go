@@ -0,0 +1,113 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestUpdateCACertificates(t *testing.T) {
+	ctx := context.Background()
+	extra := &types.ImageCertificates{
+		Additional: []types.AdditionalCertificate{{
+			Name:    "corp-root",
+			Content: "CORP",
+		}},
+	}
+
+	t.Run("regenerates from conf", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/usr/share/ca-certificates/mozilla", 0o755))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/a.crt", []byte("A\n"), 0o644))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/b.crt", []byte("B"), 0o644))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/c.crt", []byte("C\n"), 0o644))
+		require.NoError(t, fsys.MkdirAll("/etc/ssl/certs", 0o755))
+		require.NoError(t, fsys.WriteFile("/etc/ca-certificates.conf", []byte("# comment\nmozilla/b.crt\n!mozilla/c.crt\nmozilla/a.crt\n"), 0o644))
+
+		applied, err := updateCACertificates(ctx, fsys, extra)
+		require.NoError(t, err)
+		require.True(t, applied)
+
+		b, err := fsys.ReadFile("/etc/ssl/certs/ca-certificates.crt")
+		require.NoError(t, err)
+		require.Equal(t, "B\nA\nCORP\n", string(b))
+
+		b, err = fsys.ReadFile("/usr/local/share/ca-certificates/corp-root.crt")
+		require.NoError(t, err)
+		require.Equal(t, "CORP", string(b))
+	})
+
+	t.Run("uses every certificate without conf", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/usr/share/ca-certificates/mozilla", 0o755))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/b.crt", []byte("B\n"), 0o644))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/a.crt", []byte("A\n"), 0o644))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/README", []byte("not a cert"), 0o644))
+
+		applied, err := updateCACertificates(ctx, fsys, &types.ImageCertificates{})
+		require.NoError(t, err)
+		require.True(t, applied)
+
+		b, err := fsys.ReadFile("/etc/ssl/certs/ca-certificates.crt")
+		require.NoError(t, err)
+		require.Equal(t, "A\nB\n", string(b))
+	})
+
+	t.Run("appends to prebuilt bundle", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/etc/ssl/certs", 0o755))
+		require.NoError(t, fsys.WriteFile("/etc/ssl/certs/ca-certificates.crt", []byte("PREBUILT\n"), 0o644))
+
+		applied, err := updateCACertificates(ctx, fsys, extra)
+		require.NoError(t, err)
+		require.True(t, applied)
+
+		b, err := fsys.ReadFile("/etc/ssl/certs/ca-certificates.crt")
+		require.NoError(t, err)
+		require.Equal(t, "PREBUILT\nCORP\n", string(b))
+	})
+
+	t.Run("does not apply without certificates", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		applied, err := updateCACertificates(ctx, fsys, &types.ImageCertificates{})
+		require.NoError(t, err)
+		require.False(t, applied)
+
+		_, err = fsys.Stat("/etc/ssl/certs/ca-certificates.crt")
+		require.Error(t, err)
+	})
+
+	t.Run("keeps the bundle of packages without configuration", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/usr/share/ca-certificates/mozilla", 0o755))
+		require.NoError(t, fsys.WriteFile("/usr/share/ca-certificates/mozilla/a.crt", []byte("A\n"), 0o644))
+		require.NoError(t, fsys.MkdirAll("/etc/ssl/certs", 0o755))
+		require.NoError(t, fsys.WriteFile("/etc/ssl/certs/ca-certificates.crt", []byte("PACKAGED\n"), 0o644))
+
+		applied, err := updateCACertificates(ctx, fsys, nil)
+		require.NoError(t, err)
+		require.False(t, applied)
+
+		b, err := fsys.ReadFile("/etc/ssl/certs/ca-certificates.crt")
+		require.NoError(t, err)
+		require.Equal(t, "PACKAGED\n", string(b))
+	})
+}
@@ -0,0 +1,213 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"go.opentelemetry.io/otel"
+)
+
+// closureConfigs are the configuration files which the programs of a
+// closure may read when they run, kept when the image has them: accounts,
+// name resolution, the search paths of the dynamic linker and certificates.
+var closureConfigs = []string{
+	"etc/passwd",
+	"etc/group",
+	"etc/nsswitch.conf",
+	"etc/hosts",
+	"etc/os-release",
+	"etc/ld.so.conf",
+	"etc/ld.so.conf.d/*",
+	"etc/ld.so.cache",
+	"etc/ld-musl-*.path",
+	"etc/ssl/certs/ca-certificates.crt",
+}
+
+// Closure returns the files of the root filesystem built by BuildImage
+// which programs need to run, sorted: each program, looked up as that of the
+// entrypoint would be, the interpreters of scripts, the ELF interpreters and
+// shared libraries of binaries, and the symlinks leading to them, the
+// configuration files they may read, the license files of the packages they
+// come from, and the files matching the globs of paths, with everything
+// below the directories they match.
+//
+// Without programs, that of the entrypoint, or else of the cmd, of the
+// image is used.
+func (bc *Context) Closure(ctx context.Context, programs, paths []string) ([]string, error) {
+	_, span := otel.Tracer("apko").Start(ctx, "Closure")
+	defer span.End()
+
+	if len(programs) == 0 {
+		_, program, err := imageProgram(&bc.ic)
+		if err != nil {
+			return nil, err
+		}
+		if program == "" {
+			return nil, errors.New("the image has neither an entrypoint nor a cmd, so programs have to be named")
+		}
+		programs = []string{program}
+	}
+
+	c, err := bc.newEntrypointCheck()
+	if err != nil {
+		return nil, err
+	}
+	c.files = map[string]bool{}
+	for _, program := range programs {
+		c.program(program, 0)
+	}
+	if len(c.problems) != 0 {
+		return nil, fmt.Errorf("the %s image cannot run %s:\n  %s", bc.Arch().ToAPK(), strings.Join(programs, ", "), strings.Join(c.problems, "\n  "))
+	}
+
+	for _, glob := range closureConfigs {
+		matches, err := fs.Glob(bc.fs, glob)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if p, links, err := resolve(bc.fs, "/"+m); err == nil {
+				c.need(p, links)
+			}
+		}
+	}
+
+	for _, glob := range paths {
+		glob = strings.TrimPrefix(path.Clean(glob), "/")
+		matches, err := fs.Glob(bc.fs, glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid closure path %q: %w", glob, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("closure path %q matches no files", glob)
+		}
+		for _, m := range matches {
+			p, links, err := resolve(bc.fs, "/"+m)
+			if err != nil {
+				return nil, err
+			}
+			c.need(p, links)
+			if err := fs.WalkDir(bc.fs, fsPath(p), func(name string, _ fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				c.files["/"+name] = true
+				return nil
+			}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Add the license files of the packages the files come from.
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("reading the installed packages: %w", err)
+	}
+	for _, pkg := range installed {
+		if !slices.ContainsFunc(pkg.Files, func(hdr tar.Header) bool { return c.files["/"+hdr.Name] }) {
+			continue
+		}
+		for _, hdr := range pkg.Files {
+			if _, ok := licenseFileName(hdr.Name); ok && hdr.FileInfo().Mode().IsRegular() {
+				c.files["/"+hdr.Name] = true
+			}
+		}
+	}
+
+	files := make([]string, 0, len(c.files))
+	for p := range c.files {
+		if p != "/" {
+			files = append(files, strings.TrimPrefix(p, "/"))
+		}
+	}
+	slices.Sort(files)
+	return files, nil
+}
+
+// WriteClosure writes the entries of layer for files, as returned by
+// Closure, to w as a tarball, along with the directories leading to them and
+// the files they are hard links to, in the order of layer.
+func WriteClosure(layer v1.Layer, files []string, w io.Writer) error {
+	keep := map[string]bool{".": true}
+	for _, f := range files {
+		for p := f; p != "."; p = path.Dir(p) {
+			keep[p] = true
+		}
+	}
+
+	// Keep the targets of the hard links kept.
+	if err := eachEntry(layer, func(hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag == tar.TypeLink && keep[entryPath(hdr.Name)] {
+			keep[entryPath(hdr.Linkname)] = true
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := eachEntry(layer, func(hdr *tar.Header, r io.Reader) error {
+		if !keep[entryPath(hdr.Name)] {
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// eachEntry calls fn with each entry of layer and its contents.
+func eachEntry(layer v1.Layer, fn func(*tar.Header, io.Reader) error) error {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %w", err)
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath returns the path of a tar entry named name, relative to the
+// root and without a trailing slash.
+func entryPath(name string) string {
+	return path.Clean(strings.TrimPrefix(strings.TrimPrefix(name, "./"), "/"))
+}
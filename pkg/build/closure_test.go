@@ -0,0 +1,152 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+)
+
+func TestClosure(t *testing.T) {
+	ctx := context.Background()
+
+	closureContext := func(t *testing.T, ic types.ImageConfiguration) *Context {
+		fsys := testRootfs(t)
+		for _, dir := range []string{"/etc/app", "/usr/share/licenses/app", "/usr/share/licenses/other", "/usr/lib/apk/db"} {
+			require.NoError(t, fsys.MkdirAll(dir, 0o755))
+		}
+		for name, data := range map[string]string{
+			"/etc/passwd":                       "root:x:0:0:root:/root:/bin/sh\n",
+			"/etc/app/config.yaml":              "port: 8080\n",
+			"/usr/share/licenses/app/LICENSE":   "Apache-2.0",
+			"/usr/share/licenses/other/LICENSE": "MIT",
+			"/usr/bin/other":                    "other",
+		} {
+			require.NoError(t, fsys.WriteFile(name, []byte(data), 0o644))
+		}
+		a, err := apk.New(ctx, apk.WithFS(fsys))
+		require.NoError(t, err)
+		for name, files := range map[string][]string{
+			"app":   {"usr/bin/app", "usr/share/licenses/app/LICENSE"},
+			"other": {"usr/bin/other", "usr/share/licenses/other/LICENSE"},
+		} {
+			var hdrs []tar.Header
+			for _, f := range files {
+				hdrs = append(hdrs, tar.Header{Name: f, Typeflag: tar.TypeReg, Mode: 0o644})
+			}
+			require.NoError(t, a.AddInstalledPackage(&apk.Package{Name: name, Version: "1.0-r0"}, hdrs))
+		}
+		return &Context{fs: fsys, apk: a, ic: ic, o: options.Options{Arch: types.ParseArchitecture("amd64")}}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		ic       types.ImageConfiguration
+		programs []string
+		paths    []string
+		want     []string
+		wantErr  string
+	}{{
+		name:  "entrypoint",
+		ic:    types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "app --serve"}},
+		paths: []string{"/etc/app"},
+		want: []string{
+			"etc/app", "etc/app/config.yaml", "etc/ld-musl-x86_64.path", "etc/passwd",
+			"lib/ld-musl-x86_64.so.1", "lib/libc.musl-x86_64.so.1", "opt/app/lib/libapp.so.1",
+			"usr/bin/app", "usr/lib/libdep.so.1", "usr/share/licenses/app/LICENSE",
+		},
+	}, {
+		name:     "named programs through symlinks",
+		ic:       types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "app --serve"}},
+		programs: []string{"/bin/sh"},
+		want: []string{
+			"bin", "etc/ld-musl-x86_64.path", "etc/passwd",
+			"lib/ld-musl-x86_64.so.1", "lib/libc.musl-x86_64.so.1",
+			"usr/bin/busybox", "usr/bin/sh",
+		},
+	}, {
+		name:    "no program",
+		wantErr: "the image has neither an entrypoint nor a cmd",
+	}, {
+		name:     "missing program",
+		programs: []string{"nginx"},
+		wantErr:  "nginx: not found in PATH",
+	}, {
+		name:     "missing path",
+		programs: []string{"app"},
+		paths:    []string{"/srv/*"},
+		wantErr:  `closure path "srv/*" matches no files`,
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := closureContext(t, tt.ic).Closure(ctx, tt.programs, tt.paths)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, files)
+		})
+	}
+}
+
+func TestWriteClosure(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "./", Mode: 0o755},
+		{Typeflag: tar.TypeDir, Name: "usr/", Mode: 0o755},
+		{Typeflag: tar.TypeDir, Name: "usr/bin/", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "usr/bin/busybox", Mode: 0o755, Size: 7},
+		{Typeflag: tar.TypeLink, Name: "usr/bin/sh", Linkname: "usr/bin/busybox", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "usr/bin/other", Mode: 0o755, Size: 5},
+		{Typeflag: tar.TypeDir, Name: "var/", Mode: 0o755},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+		_, err := tw.Write(bytes.Repeat([]byte("x"), int(hdr.Size)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	data := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, WriteClosure(layer, []string{"usr/bin/sh"}, &out))
+
+	var names []string
+	tr := tar.NewReader(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+	}
+	// The hard link keeps the file it links to.
+	require.Equal(t, []string{"./", "usr/", "usr/bin/", "usr/bin/busybox", "usr/bin/sh"}, names)
+}
@@ -0,0 +1,313 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// specialModes are the mode bits of a file which are kept along with its
+// permissions.
+const specialModes = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// CommandFixup returns a fixup which runs cmd inside the root filesystem with
+// e, e.g. to do the work of a trigger of a package, or to validate the
+// result. The fixup fails if the command does.
+//
+// The root filesystem is written to a temporary directory for the command to
+// run in, and the directories, regular files and symlinks the command
+// creates, modifies or removes there are then created, modified or removed in
+// the root filesystem. Files the command creates are owned by root, and the
+// command does not see device files. The output of the command is part of the
+// error if it fails, unless cmd has its own Stdout or Stderr.
+func CommandFixup(name, description string, e apk.Executor, cmd apk.Command) Fixup {
+	return Fixup{
+		Name:        name,
+		Description: description,
+		Run: func(ctx context.Context, fsys apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+			if err := onDisk(ctx, fsys, func(dir string) error {
+				return execute(ctx, e, dir, cmd)
+			}); err != nil {
+				return false, err
+			}
+			return true, nil
+		},
+	}
+}
+
+// execute runs cmd in the root filesystem at dir with e, with its output in
+// the error if it fails, unless cmd has its own Stdout or Stderr.
+func execute(ctx context.Context, e apk.Executor, dir string, cmd apk.Command) error {
+	var out bytes.Buffer
+	if cmd.Stdout == nil && cmd.Stderr == nil {
+		cmd.Stdout, cmd.Stderr = &out, &out
+	}
+	if err := e.Execute(ctx, dir, cmd); err != nil {
+		if out.Len() > 0 {
+			return fmt.Errorf("%w:\n%s", err, out.String())
+		}
+		return err
+	}
+	return nil
+}
+
+// onDisk writes fsys to a temporary directory, calls f with it, and then
+// copies the changes f made there back to fsys.
+func onDisk(ctx context.Context, fsys apkfs.FullFS, f func(dir string) error) error {
+	dir, err := os.MkdirTemp("", "apko-fixup-*")
+	if err != nil {
+		return err
+	}
+	defer removeRootfs(dir)
+
+	written, err := writeRootfs(ctx, fsys, dir)
+	if err != nil {
+		return fmt.Errorf("writing the root filesystem to %s: %w", dir, err)
+	}
+	if err := f(dir); err != nil {
+		return err
+	}
+	if err := syncRootfs(fsys, dir, written); err != nil {
+		return fmt.Errorf("copying the changes of the command to the root filesystem: %w", err)
+	}
+	return nil
+}
+
+// writeRootfs writes the directories, regular files and symlinks of fsys to
+// dir, and returns the modes of the paths it wrote.
+func writeRootfs(ctx context.Context, fsys apkfs.FullFS, dir string) (map[string]fs.FileMode, error) {
+	written := map[string]fs.FileMode{}
+	var dirs []string
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		switch mode := info.Mode(); {
+		case mode&fs.ModeSymlink != 0:
+			link, err := fsys.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case mode.IsDir():
+			// Directories are writable until everything is written.
+			if err := os.Mkdir(target, 0o700); err != nil {
+				return err
+			}
+			dirs = append(dirs, p)
+		case mode.IsRegular():
+			if err := copyFromFS(fsys, p, target); err != nil {
+				return err
+			}
+			if err := os.Chmod(target, mode&specialModes); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+		written[p] = info.Mode()
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, p := range dirs {
+		if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(p)), written[p]&specialModes); err != nil {
+			return nil, err
+		}
+	}
+	return written, nil
+}
+
+func copyFromFS(fsys apkfs.FullFS, p, target string) error {
+	in, err := fsys.Open(p)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncRootfs makes the paths of fsys match those of dir, which were written
+// by writeRootfs with the modes in written and then changed.
+func syncRootfs(fsys apkfs.FullFS, dir string, written map[string]fs.FileMode) error {
+	seen := map[string]bool{}
+	if err := filepath.WalkDir(dir, func(hostPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, hostPath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		p := filepath.ToSlash(rel)
+		seen[p] = true
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		old, existed := written[p]
+		mode := info.Mode()
+		switch {
+		case mode&fs.ModeSymlink != 0:
+			link, err := os.Readlink(hostPath)
+			if err != nil {
+				return err
+			}
+			if existed && old&fs.ModeSymlink != 0 {
+				if cur, err := fsys.Readlink(p); err == nil && cur == link {
+					return nil
+				}
+			}
+			if err := removeFromFS(fsys, p, old, existed); err != nil {
+				return err
+			}
+			return fsys.Symlink(link, p)
+		case mode.IsDir():
+			if existed && old.IsDir() {
+				if old&specialModes != mode&specialModes {
+					return fsys.Chmod(p, mode&specialModes)
+				}
+				return nil
+			}
+			if err := removeFromFS(fsys, p, old, existed); err != nil {
+				return err
+			}
+			if err := fsys.Mkdir(p, mode&fs.ModePerm); err != nil {
+				return err
+			}
+			return fsys.Chmod(p, mode&specialModes)
+		case mode.IsRegular():
+			b, err := os.ReadFile(hostPath)
+			if err != nil {
+				return err
+			}
+			if existed && old.IsRegular() {
+				if cur, err := fsys.ReadFile(p); err == nil && bytes.Equal(cur, b) {
+					if old&specialModes != mode&specialModes {
+						return fsys.Chmod(p, mode&specialModes)
+					}
+					return nil
+				}
+			}
+			// Modified files are replaced, so that their hardlinks are not
+			// modified with them.
+			if err := removeFromFS(fsys, p, old, existed); err != nil {
+				return err
+			}
+			if err := fsys.WriteFile(p, b, mode&fs.ModePerm); err != nil {
+				return err
+			}
+			return fsys.Chmod(p, mode&specialModes)
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	// Remove what the command removed, parents before their children, which
+	// are then gone already.
+	var removed []string
+	for p := range written {
+		if !seen[p] {
+			removed = append(removed, p)
+		}
+	}
+	sort.Strings(removed)
+	for _, p := range removed {
+		if err := removeFromFS(fsys, p, written[p], true); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFromFS removes p, of mode old, and everything under it if it is a
+// directory, from fsys if it existed.
+func removeFromFS(fsys apkfs.FullFS, p string, old fs.FileMode, existed bool) error {
+	if !existed {
+		return nil
+	}
+	if !old.IsDir() {
+		if err := fsys.Remove(p); err != nil {
+			return fmt.Errorf("removing %s: %w", p, err)
+		}
+		return nil
+	}
+	var paths []string
+	if err := fs.WalkDir(fsys, p, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, p := range slices.Backward(paths) {
+		if err := fsys.Remove(p); err != nil {
+			return fmt.Errorf("removing %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// removeRootfs removes dir, the directory a root filesystem was written to,
+// making its directories writable first.
+func removeRootfs(dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			_ = os.Chmod(p, 0o700)
+		}
+		return nil
+	})
+	_ = os.RemoveAll(dir)
+}
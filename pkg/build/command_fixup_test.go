@@ -0,0 +1,123 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+// executorFunc runs a command by calling itself with the root filesystem.
+type executorFunc func(root string, cmd apk.Command) error
+
+func (f executorFunc) Execute(_ context.Context, root string, cmd apk.Command) error {
+	return f(root, cmd)
+}
+
+func TestCommandFixup(t *testing.T) {
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("etc/conf.d", 0o755))
+	require.NoError(t, fsys.MkdirAll("usr/share/doc", 0o755))
+	require.NoError(t, fsys.MkdirAll("var/lib", 0o555))
+	require.NoError(t, fsys.WriteFile("etc/conf.d/keep", []byte("keep"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/conf.d/modify", []byte("before"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/conf.d/chmod", []byte("chmod"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/conf.d/remove", []byte("remove"), 0o644))
+	require.NoError(t, fsys.WriteFile("usr/share/doc/README", []byte("doc"), 0o644))
+	require.NoError(t, fsys.Symlink("conf.d/keep", "etc/link"))
+	require.NoError(t, fsys.Symlink("/usr/share", "share"))
+
+	var gotCmd apk.Command
+	e := executorFunc(func(root string, cmd apk.Command) error {
+		gotCmd = cmd
+		// The root filesystem is written as it is.
+		b, err := os.ReadFile(filepath.Join(root, "etc/link"))
+		require.NoError(t, err)
+		require.Equal(t, "keep", string(b))
+		fi, err := os.Stat(filepath.Join(root, "var/lib"))
+		require.NoError(t, err)
+		require.Equal(t, fs.FileMode(0o555), fi.Mode().Perm())
+
+		require.NoError(t, os.WriteFile(filepath.Join(root, "etc/conf.d/modify"), []byte("after"), 0o644))
+		require.NoError(t, os.Chmod(filepath.Join(root, "etc/conf.d/chmod"), 0o755|fs.ModeSetuid))
+		require.NoError(t, os.Remove(filepath.Join(root, "etc/conf.d/remove")))
+		require.NoError(t, os.Mkdir(filepath.Join(root, "etc/new.d"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "etc/new.d/new"), []byte("new"), 0o600))
+		require.NoError(t, os.Remove(filepath.Join(root, "etc/link")))
+		require.NoError(t, os.Symlink("new.d/new", filepath.Join(root, "etc/link")))
+		// A symlink replaced by a directory is not followed when it is
+		// removed.
+		require.NoError(t, os.Remove(filepath.Join(root, "share")))
+		require.NoError(t, os.Mkdir(filepath.Join(root, "share"), 0o755))
+		require.NoError(t, os.RemoveAll(filepath.Join(root, "var")))
+		return nil
+	})
+
+	f := CommandFixup("test", "Runs a test command", e, apk.Command{Args: []string{"update"}})
+	applied, err := f.Run(context.Background(), fsys, nil)
+	require.NoError(t, err)
+	require.True(t, applied)
+	require.Equal(t, []string{"update"}, gotCmd.Args)
+
+	for p, want := range map[string]string{
+		"etc/conf.d/keep":      "keep",
+		"etc/conf.d/modify":    "after",
+		"etc/conf.d/chmod":     "chmod",
+		"etc/new.d/new":        "new",
+		"etc/link":             "new",
+		"usr/share/doc/README": "doc",
+	} {
+		b, err := fsys.ReadFile(p)
+		require.NoError(t, err, p)
+		require.Equal(t, want, string(b), p)
+	}
+	for p, want := range map[string]fs.FileMode{
+		"etc/conf.d/chmod": 0o755 | fs.ModeSetuid,
+		"etc/new.d":        0o750 | fs.ModeDir,
+		"etc/new.d/new":    0o600,
+		"share":            0o755 | fs.ModeDir,
+	} {
+		fi, err := fsys.Lstat(p)
+		require.NoError(t, err, p)
+		require.Equal(t, want, fi.Mode(), p)
+	}
+	for _, p := range []string{"etc/conf.d/remove", "var/lib", "var"} {
+		_, err := fsys.Lstat(p)
+		require.ErrorIs(t, err, fs.ErrNotExist, p)
+	}
+	link, err := fsys.Readlink("etc/link")
+	require.NoError(t, err)
+	require.Equal(t, "new.d/new", link)
+}
+
+func TestCommandFixupError(t *testing.T) {
+	e := executorFunc(func(_ string, cmd apk.Command) error {
+		fmt.Fprintln(cmd.Stderr, "no such trigger")
+		return errors.New("exit status 1")
+	})
+	f := CommandFixup("test", "Runs a test command", e, apk.Command{Args: []string{"trigger"}})
+	_, err := f.Run(context.Background(), tarfs.New(), nil)
+	require.EqualError(t, err, "exit status 1:\nno such trigger\n")
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// applyDirectoryModes sets the modes of the directories of fsys as the
+// directories of the configuration say: those not installed by packages, nor
+// given permissions by paths, lose the bits of the umask, and those matching
+// a mode get it. It then fails if a directory is world-writable when that is
+// forbidden.
+func applyDirectoryModes(fsys apkfs.FullFS, ic *types.ImageConfiguration, installed []*apk.InstalledPackage) error {
+	d := ic.Directories
+	if d == nil {
+		return nil
+	}
+
+	fromPackages := map[string]bool{}
+	for _, pkg := range installed {
+		for _, f := range pkg.Files {
+			if f.Typeflag == tar.TypeDir {
+				fromPackages[path.Clean("/"+f.Name)] = true
+			}
+		}
+	}
+	// The paths given permissions keep them, along with everything under
+	// those applied recursively.
+	explicit := func(p string) bool {
+		for _, mut := range ic.Paths {
+			if mut.Type != "directory" && mut.Type != "permissions" {
+				continue
+			}
+			target := path.Clean("/" + mut.Path)
+			if p == target || (mut.Recursive && strings.HasPrefix(p, strings.TrimSuffix(target, "/")+"/")) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var worldWritable []string
+	if err := fs.WalkDir(fsys, ".", func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !de.IsDir() {
+			return nil
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		name := path.Clean("/" + p)
+		mode := info.Mode() & specialModes
+
+		want := mode
+		if m, ok := directoryMode(d.Modes, name); ok {
+			want = m
+		} else if !fromPackages[name] && !explicit(name) && mode&fs.ModeSticky == 0 {
+			want = mode &^ fs.FileMode(d.Umask)
+		}
+		if want != mode {
+			if err := fsys.Chmod(p, want); err != nil {
+				return fmt.Errorf("chmod %s: %w", name, err)
+			}
+		}
+
+		if d.ForbidWorldWritable && want&0o002 != 0 && !matchesAny(d.AllowWorldWritable, name) {
+			worldWritable = append(worldWritable, name)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("setting the modes of directories: %w", err)
+	}
+
+	if len(worldWritable) > 0 {
+		return fmt.Errorf("directories must not be world-writable, but these are: %s", strings.Join(worldWritable, ", "))
+	}
+	return nil
+}
+
+// directoryMode returns the mode of the last of modes matching the directory
+// at name, if any does.
+func directoryMode(modes []types.DirectoryMode, name string) (fs.FileMode, bool) {
+	for i := len(modes) - 1; i >= 0; i-- {
+		if ok, _ := path.Match(modes[i].Path, name); ok {
+			return fileMode(modes[i].Mode), true
+		}
+	}
+	return 0, false
+}
+
+// matchesAny reports whether name matches any of the patterns.
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileMode converts the Unix mode m, e.g. 0o1777, to an fs.FileMode.
+func fileMode(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
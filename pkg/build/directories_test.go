@@ -0,0 +1,109 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestApplyDirectoryModes(t *testing.T) {
+	setup := func(t *testing.T) apkfs.FullFS {
+		fsys := apkfs.NewMemFS()
+		for dir, mode := range map[string]fs.FileMode{
+			"etc":     0o755,
+			"tmp":     0o777 | fs.ModeSticky,
+			"var":     0o755,
+			"var/www": 0o777,
+			"data":    0o777,
+			"data/db": 0o777,
+			"opt":     0o755,
+		} {
+			require.NoError(t, fsys.MkdirAll(dir, 0o755))
+			require.NoError(t, fsys.Chmod(dir, mode))
+		}
+		return fsys
+	}
+	installed := []*apk.InstalledPackage{{Files: []tar.Header{{Name: "var/www", Typeflag: tar.TypeDir}}}}
+	paths := []types.PathMutation{{Path: "/data", Type: "directory", Permissions: 0o777, Recursive: true}}
+
+	for _, tc := range []struct {
+		name    string
+		dirs    *types.ImageDirectories
+		want    map[string]fs.FileMode
+		wantErr string
+	}{{
+		name: "none",
+		want: map[string]fs.FileMode{"etc": 0o755, "var/www": 0o777},
+	}, {
+		name: "umask",
+		dirs: &types.ImageDirectories{Umask: 0o027},
+		want: map[string]fs.FileMode{
+			"etc":     0o750,
+			"tmp":     0o777 | fs.ModeSticky,
+			"var/www": 0o777,
+			"data":    0o777,
+			"data/db": 0o777,
+		},
+	}, {
+		name: "modes",
+		dirs: &types.ImageDirectories{Umask: 0o022, Modes: []types.DirectoryMode{
+			{Path: "/opt", Mode: 0o755},
+			{Path: "/opt", Mode: 0o700},
+			{Path: "/var/*", Mode: 0o1770},
+		}},
+		want: map[string]fs.FileMode{
+			"opt":     0o700,
+			"var/www": 0o770 | fs.ModeSticky,
+			"etc":     0o755,
+		},
+	}, {
+		name: "world-writable allowed",
+		dirs: &types.ImageDirectories{
+			ForbidWorldWritable: true,
+			AllowWorldWritable:  []string{"/tmp", "/var/www", "/data", "/data/*"},
+		},
+	}, {
+		name: "world-writable",
+		dirs: &types.ImageDirectories{
+			ForbidWorldWritable: true,
+			AllowWorldWritable:  []string{"/tmp"},
+		},
+		wantErr: "directories must not be world-writable, but these are: /data, /data/db, /var/www",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := setup(t)
+			ic := &types.ImageConfiguration{Paths: paths, Directories: tc.dirs}
+			err := applyDirectoryModes(fsys, ic, installed)
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for dir, want := range tc.want {
+				fi, err := fsys.Stat(dir)
+				require.NoError(t, err)
+				require.Equal(t, want, fi.Mode()&specialModes, dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/shlex"
+	"go.opentelemetry.io/otel"
+
+	ldsocache "chainguard.dev/apko/internal/ldso-cache"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// defaultPath is the PATH of images whose environment does not set one, as
+// set in their config.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin"
+
+// defaultLibDirs are searched for shared libraries after the directories of
+// /etc/ld.so.conf and the musl path files, covering the defaults of both glibc
+// and musl.
+var defaultLibDirs = []string{"/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib"}
+
+// maxInterpreterDepth is how many scripts may be interpreted by scripts, as
+// limited by the kernel.
+const maxInterpreterDepth = 4
+
+// elfMachines are the machines of the ELF binaries of each architecture, by
+// its apk name.
+var elfMachines = map[string]elf.Machine{
+	"x86":         elf.EM_386,
+	"x86_64":      elf.EM_X86_64,
+	"aarch64":     elf.EM_AARCH64,
+	"armhf":       elf.EM_ARM,
+	"armv7":       elf.EM_ARM,
+	"loongarch64": elf.EM_LOONGARCH,
+	"ppc64le":     elf.EM_PPC64,
+	"riscv64":     elf.EM_RISCV,
+	"s390x":       elf.EM_S390,
+}
+
+// checkEntrypoint verifies that the program the image runs, that of its
+// entrypoint or else of its cmd, is in the root filesystem with what it
+// needs to run: the interpreter of a script, or the ELF interpreter and shared
+// libraries of a binary for the architecture of the image. Symlinks are
+// followed, and a program without a slash is looked up in the PATH of the
+// image, as the container runtime would.
+func (bc *Context) checkEntrypoint(ctx context.Context) error {
+	ctx, span := otel.Tracer("apko").Start(ctx, "checkEntrypoint")
+	defer span.End()
+
+	if bc.baseimg != nil {
+		clog.FromContext(ctx).Warnf("not checking the entrypoint of an image built on a base image")
+		return nil
+	}
+
+	what, program, err := imageProgram(&bc.ic)
+	if err != nil || program == "" {
+		return err
+	}
+
+	c, err := bc.newEntrypointCheck()
+	if err != nil {
+		return err
+	}
+	c.program(program, 0)
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the %s image cannot run %q, the program of its %s:\n  %s", bc.Arch().ToAPK(), program, what, strings.Join(c.problems, "\n  "))
+}
+
+// newEntrypointCheck returns a check of programs run in the root filesystem
+// with the environment and working directory of the image.
+func (bc *Context) newEntrypointCheck() (*entrypointCheck, error) {
+	env := bc.ic.Environment
+	pathEnv, ok := env["PATH"]
+	if !ok {
+		pathEnv = defaultPath
+	}
+	c := &entrypointCheck{
+		fsys:    bc.fs,
+		machine: elfMachines[bc.Arch().ToAPK()],
+		path:    strings.Split(pathEnv, ":"),
+		workDir: bc.ic.WorkDir,
+		checked: map[string]bool{},
+	}
+	if c.workDir == "" {
+		c.workDir = "/"
+	}
+	if ld := env["LD_LIBRARY_PATH"]; ld != "" {
+		c.libDirs = append(c.libDirs, strings.Split(ld, ":")...)
+	}
+	if dirs, err := ldsocache.ParseLDSOConf(bc.fs, "etc/ld.so.conf"); err == nil {
+		c.libDirs = append(c.libDirs, dirs...)
+	}
+	if paths, err := fs.Glob(bc.fs, "etc/ld-musl-*.path"); err == nil {
+		for _, p := range paths {
+			b, err := bc.fs.ReadFile(p)
+			if err != nil {
+				return nil, fmt.Errorf("reading /%s: %w", p, err)
+			}
+			c.libDirs = append(c.libDirs, strings.FieldsFunc(string(b), func(r rune) bool { return r == ':' || r == '\n' })...)
+		}
+	}
+	c.libDirs = append(c.libDirs, defaultLibDirs...)
+	return c, nil
+}
+
+// imageProgram returns the program the image runs, and whether it is that of
+// the entrypoint or the cmd, as they are set in the image config.
+func imageProgram(ic *types.ImageConfiguration) (what, program string, err error) {
+	var command string
+	switch {
+	case ic.Entrypoint.ShellFragment != "":
+		return "entrypoint", "/bin/sh", nil
+	case ic.Entrypoint.Command != "":
+		what, command = "entrypoint", ic.Entrypoint.Command
+	case ic.Cmd != "":
+		what, command = "cmd", ic.Cmd
+	default:
+		return "", "", nil
+	}
+	argv, err := shlex.Split(command)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to parse %s: %w", what, err)
+	}
+	if len(argv) == 0 {
+		return "", "", nil
+	}
+	return what, argv[0], nil
+}
+
+type entrypointCheck struct {
+	fsys apkfs.FullFS
+	// machine is that of the ELF binaries of the image, 0 if unknown.
+	machine elf.Machine
+	path    []string
+	workDir string
+	// libDirs are searched for the shared libraries without a runpath.
+	libDirs []string
+
+	// checked are the files already checked, by their resolved path.
+	checked  map[string]bool
+	problems []string
+	// files, when not nil, collects the files needed to run the programs
+	// checked, and the symlinks leading to them.
+	files map[string]bool
+}
+
+// need records that the file at p is needed, reached through links.
+func (c *entrypointCheck) need(p string, links []string) {
+	if c.files == nil {
+		return
+	}
+	c.files[p] = true
+	for _, link := range links {
+		c.files[link] = true
+	}
+}
+
+func (c *entrypointCheck) problem(format string, args ...any) {
+	if p := fmt.Sprintf(format, args...); !slices.Contains(c.problems, p) {
+		c.problems = append(c.problems, p)
+	}
+}
+
+// program checks a program run by name, as the entrypoint or the interpreter
+// of a script interpreted depth times.
+func (c *entrypointCheck) program(name string, depth int) {
+	if depth > maxInterpreterDepth {
+		c.problem("%s: too many levels of script interpreters", name)
+		return
+	}
+	p, links, err := c.lookPath(name)
+	if err != nil {
+		c.problem("%s: %v", name, err)
+		return
+	}
+	c.need(p, links)
+	c.executable(name, p, depth)
+}
+
+// lookPath returns the resolved path of the program run by name, and the
+// symlinks leading to it: name itself if it has a slash, or else the first
+// executable file of that name in the directories of the PATH. As with exec,
+// only relative paths resolve from the working directory.
+func (c *entrypointCheck) lookPath(name string) (string, []string, error) {
+	if strings.Contains(name, "/") {
+		return resolve(c.fsys, c.abs(name))
+	}
+	for _, dir := range c.path {
+		p, links, err := resolve(c.fsys, c.abs(path.Join(dir, name)))
+		if err != nil {
+			continue
+		}
+		if fi, err := c.fsys.Stat(fsPath(p)); err == nil && fi.Mode().IsRegular() && fi.Mode()&0o111 != 0 {
+			return p, links, nil
+		}
+	}
+	return "", nil, fmt.Errorf("not found in PATH %s", strings.Join(c.path, ":"))
+}
+
+// abs returns p, resolved from the working directory if it is relative.
+func (c *entrypointCheck) abs(p string) string {
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join("/", c.workDir, p)
+}
+
+// executable checks the program run by name, resolved to p.
+func (c *entrypointCheck) executable(name, p string, depth int) {
+	if c.checked[p] {
+		return
+	}
+	c.checked[p] = true
+
+	fi, err := c.fsys.Stat(fsPath(p))
+	if err != nil {
+		c.problem("%s: %v", name, err)
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		c.problem("%s: %s is not a regular file", name, p)
+		return
+	}
+	if fi.Mode()&0o111 == 0 {
+		c.problem("%s: %s is not executable", name, p)
+		return
+	}
+
+	f, err := c.fsys.OpenReaderAt(fsPath(p))
+	if err != nil {
+		c.problem("%s: %v", name, err)
+		return
+	}
+	defer f.Close()
+
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil && !errors.Is(err, io.EOF) {
+		c.problem("%s: reading %s: %v", name, p, err)
+		return
+	}
+	switch {
+	case string(magic[:]) == elf.ELFMAG:
+		c.elf(name, p, f)
+	case string(magic[:2]) == "#!":
+		c.script(name, p, f, depth)
+	default:
+		c.problem("%s: %s is neither an ELF binary nor a script starting with #!, so running it fails with exec format error", name, p)
+	}
+}
+
+// script checks the interpreter of the script at p. With env as the
+// interpreter, the program env runs is checked too.
+func (c *entrypointCheck) script(name, p string, r io.ReaderAt, depth int) {
+	line, _ := bufio.NewReader(io.NewSectionReader(r, 0, 256)).ReadString('\n')
+	interp, arg, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "#!")), " ")
+	arg = strings.TrimSpace(arg)
+	if interp == "" {
+		c.problem("%s: %s has no interpreter after #!", name, p)
+		return
+	}
+	c.program(interp, depth+1)
+	if path.Base(interp) == "env" && arg != "" && !strings.HasPrefix(arg, "-") {
+		c.program(arg, depth+1)
+	}
+}
+
+// elf checks that the ELF binary at p is for the machine of the image, and
+// that its interpreter and the shared libraries it needs are present.
+func (c *entrypointCheck) elf(name, p string, r io.ReaderAt) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		c.problem("%s: parsing %s: %v", name, p, err)
+		return
+	}
+	defer f.Close()
+	if c.machine != 0 && f.Machine != c.machine {
+		c.problem("%s: %s is built for %s, not %s, so running it fails with exec format error", name, p, f.Machine, c.machine)
+		return
+	}
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		b, err := io.ReadAll(prog.Open())
+		if err != nil {
+			c.problem("%s: reading the interpreter of %s: %v", name, p, err)
+			return
+		}
+		interp := string(bytes.TrimRight(b, "\x00"))
+		resolved, links, err := resolve(c.fsys, interp)
+		if err != nil {
+			c.problem("%s: the ELF interpreter of %s, %s, is missing, so running it fails with no such file or directory", name, p, interp)
+			continue
+		}
+		c.need(resolved, links)
+	}
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		c.problem("%s: reading the libraries needed by %s: %v", name, p, err)
+		return
+	}
+	// The runpath of a binary is searched before the other directories, and
+	// its rpath if it has no runpath.
+	runpath, err := f.DynString(elf.DT_RUNPATH)
+	if err == nil && len(runpath) == 0 {
+		runpath, err = f.DynString(elf.DT_RPATH)
+	}
+	if err != nil {
+		c.problem("%s: reading the runpath of %s: %v", name, p, err)
+		return
+	}
+	var dirs []string
+	for _, rp := range runpath {
+		for _, dir := range strings.Split(rp, ":") {
+			dir = strings.ReplaceAll(strings.ReplaceAll(dir, "${ORIGIN}", "$ORIGIN"), "$ORIGIN", path.Dir(p))
+			dirs = append(dirs, dir)
+		}
+	}
+	dirs = append(dirs, c.libDirs...)
+
+	for _, lib := range needed {
+		c.library(lib, p, dirs)
+	}
+}
+
+// library checks that lib, needed by the binary at from, is in one of dirs,
+// along with the libraries it needs in turn.
+func (c *entrypointCheck) library(lib, from string, dirs []string) {
+	candidates := []string{lib}
+	if !strings.Contains(lib, "/") {
+		candidates = candidates[:0]
+		for _, dir := range dirs {
+			candidates = append(candidates, path.Join("/", dir, lib))
+		}
+	}
+	for _, candidate := range candidates {
+		p, links, err := resolve(c.fsys, candidate)
+		if err != nil {
+			continue
+		}
+		if c.checked[p] {
+			c.need(p, links)
+			return
+		}
+		f, err := c.fsys.OpenReaderAt(fsPath(p))
+		if err != nil {
+			continue
+		}
+		// A library of another machine is skipped by the dynamic linker.
+		if ef, err := elf.NewFile(f); err == nil && c.machine != 0 && ef.Machine != c.machine {
+			f.Close()
+			continue
+		}
+		c.checked[p] = true
+		c.need(p, links)
+		c.elf(lib, p, f)
+		f.Close()
+		return
+	}
+	c.problem("%s: needed by %s, but not in %s", lib, from, strings.Join(slices.Compact(dirs), ", "))
+}
+
+// resolve resolves the symlinks in each of the components of p, an absolute
+// path in fsys, as the kernel would with fsys as the root, and returns the
+// symlinks it followed. It fails if p does not exist.
+func resolve(fsys apkfs.FullFS, p string) (string, []string, error) {
+	var links []string
+	resolved := "/"
+	rest := strings.Split(p, "/")
+	for len(rest) > 0 {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, name)
+		if _, err := fsys.Lstat(fsPath(next)); err != nil {
+			return "", nil, err
+		}
+		// Not every FullFS reports symlinks in Lstat, but all read them.
+		target, err := fsys.Readlink(fsPath(next))
+		if err != nil {
+			resolved = next
+			continue
+		}
+		if links = append(links, next); len(links) > 40 {
+			return "", nil, fmt.Errorf("%s: too many levels of symbolic links", p)
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return resolved, links, nil
+}
+
+// fsPath returns the name of the absolute path p in an apkfs.FullFS.
+func fsPath(p string) string {
+	if p = strings.TrimPrefix(p, "/"); p == "" {
+		return "."
+	}
+	return p
+}
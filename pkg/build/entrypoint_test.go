@@ -0,0 +1,237 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+)
+
+// testELF returns a minimal 64-bit ELF binary for machine, with an
+// interpreter and the libraries it needs if they are given.
+func testELF(t *testing.T, machine elf.Machine, interp string, needed ...string) []byte {
+	t.Helper()
+
+	const (
+		headerSize  = 64
+		progSize    = 56
+		sectionSize = 64
+		dynSize     = 16
+	)
+	var progs, sections, data bytes.Buffer
+	w := func(buf *bytes.Buffer, v any) { require.NoError(t, binary.Write(buf, binary.LittleEndian, v)) }
+
+	nprogs := 0
+	if interp != "" {
+		nprogs = 1
+	}
+	dataOff := uint64(headerSize + nprogs*progSize)
+	if interp != "" {
+		w(&progs, elf.Prog64{Type: uint32(elf.PT_INTERP), Off: dataOff, Filesz: uint64(len(interp) + 1), Memsz: uint64(len(interp) + 1)})
+		data.WriteString(interp + "\x00")
+	}
+
+	nsections := 0
+	if len(needed) > 0 {
+		strtab := []byte{0}
+		var dyn bytes.Buffer
+		for _, lib := range needed {
+			w(&dyn, elf.Dyn64{Tag: int64(elf.DT_NEEDED), Val: uint64(len(strtab))})
+			strtab = append(strtab, lib+"\x00"...)
+		}
+		w(&dyn, elf.Dyn64{Tag: int64(elf.DT_NULL)})
+
+		strOff := dataOff + uint64(data.Len())
+		data.Write(strtab)
+		dynOff := dataOff + uint64(data.Len())
+		data.Write(dyn.Bytes())
+
+		nsections = 3
+		w(&sections, elf.Section64{})
+		w(&sections, elf.Section64{Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint64(len(strtab))})
+		w(&sections, elf.Section64{Type: uint32(elf.SHT_DYNAMIC), Off: dynOff, Size: uint64(dyn.Len()), Link: 1, Entsize: dynSize})
+	}
+
+	var b bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    headerSize,
+		Phentsize: progSize,
+		Phnum:     uint16(nprogs),
+		Shentsize: sectionSize,
+		Shnum:     uint16(nsections),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if nprogs > 0 {
+		hdr.Phoff = headerSize
+	}
+	if nsections > 0 {
+		hdr.Shoff = dataOff + uint64(data.Len())
+	}
+	w(&b, hdr)
+	b.Write(progs.Bytes())
+	b.Write(data.Bytes())
+	b.Write(sections.Bytes())
+	return b.Bytes()
+}
+
+// testInterp is the ELF interpreter of the binaries of testRootfs.
+const testInterp = "/lib/ld-musl-x86_64.so.1"
+
+// testRootfs lays out a musl based image with busybox and an app needing
+// libapp.so.1, which needs libdep.so.1.
+func testRootfs(t *testing.T) apkfs.FullFS {
+	fsys := apkfs.NewMemFS()
+	for _, dir := range []string{"/lib", "/usr/bin", "/usr/lib", "/etc", "/opt/app/lib"} {
+		require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, fsys.WriteFile(testInterp, testELF(t, elf.EM_X86_64, ""), 0o755))
+	require.NoError(t, fsys.Symlink("ld-musl-x86_64.so.1", "/lib/libc.musl-x86_64.so.1"))
+	require.NoError(t, fsys.Symlink("usr/bin", "/bin"))
+	require.NoError(t, fsys.WriteFile("/usr/bin/busybox", testELF(t, elf.EM_X86_64, testInterp, "libc.musl-x86_64.so.1"), 0o755))
+	require.NoError(t, fsys.Symlink("/usr/bin/busybox", "/usr/bin/sh"))
+	require.NoError(t, fsys.Symlink("busybox", "/usr/bin/env"))
+	require.NoError(t, fsys.WriteFile("/usr/bin/app", testELF(t, elf.EM_X86_64, testInterp, "libapp.so.1", "libc.musl-x86_64.so.1"), 0o755))
+	require.NoError(t, fsys.WriteFile("/opt/app/lib/libapp.so.1", testELF(t, elf.EM_X86_64, "", "libdep.so.1"), 0o755))
+	require.NoError(t, fsys.WriteFile("/usr/lib/libdep.so.1", testELF(t, elf.EM_X86_64, ""), 0o755))
+	require.NoError(t, fsys.WriteFile("/etc/ld-musl-x86_64.path", []byte("/lib:/usr/lib:/opt/app/lib\n"), 0o644))
+	require.NoError(t, fsys.WriteFile("/usr/bin/run.sh", []byte("#!/usr/bin/env app\n"), 0o755))
+	return fsys
+}
+
+func TestCheckEntrypoint(t *testing.T) {
+	amd64 := types.ParseArchitecture("amd64")
+	interp := testInterp
+
+	for _, tt := range []struct {
+		name    string
+		ic      types.ImageConfiguration
+		mutate  func(t *testing.T, fsys apkfs.FullFS)
+		wantErr []string
+	}{{
+		name: "shell fragment",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{ShellFragment: "echo hi"}},
+	}, {
+		name: "command in path",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "app --serve"}},
+	}, {
+		name: "cmd through symlinked directory",
+		ic:   types.ImageConfiguration{Cmd: "/bin/app"},
+	}, {
+		name: "script through env",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "run.sh"}},
+	}, {
+		name: "relative to the working directory",
+		ic:   types.ImageConfiguration{WorkDir: "/usr", Entrypoint: types.ImageEntrypoint{Command: "bin/app"}},
+	}, {
+		name: "absolute with a working directory",
+		ic:   types.ImageConfiguration{WorkDir: "/opt/app", Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+	}, {
+		name: "path with a working directory",
+		ic:   types.ImageConfiguration{WorkDir: "/opt/app", Entrypoint: types.ImageEntrypoint{Command: "app"}},
+	}, {
+		name: "shebang with a working directory",
+		ic:   types.ImageConfiguration{WorkDir: "/opt/app", Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/run.sh"}},
+	}, {
+		name: "shebang relative to the working directory",
+		ic:   types.ImageConfiguration{WorkDir: "/opt/app", Entrypoint: types.ImageEntrypoint{Command: "./run.sh"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) {
+			require.NoError(t, fsys.WriteFile("/opt/app/run.sh", []byte("#!/bin/sh\n"), 0o755))
+		},
+	}, {
+		name: "no entrypoint",
+	}, {
+		name:    "not in path",
+		ic:      types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "nginx"}, Environment: map[string]string{"PATH": "/usr/sbin:/usr/bin"}},
+		wantErr: []string{`the x86_64 image cannot run "nginx", the program of its entrypoint`, "nginx: not found in PATH /usr/sbin:/usr/bin"},
+	}, {
+		name:    "missing file",
+		ic:      types.ImageConfiguration{Cmd: "/usr/bin/app2"},
+		wantErr: []string{`the x86_64 image cannot run "/usr/bin/app2", the program of its cmd`},
+	}, {
+		name:    "missing interpreter",
+		ic:      types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+		mutate:  func(t *testing.T, fsys apkfs.FullFS) { require.NoError(t, fsys.Remove(interp)) },
+		wantErr: []string{"/bin/app: the ELF interpreter of /usr/bin/app, /lib/ld-musl-x86_64.so.1, is missing"},
+	}, {
+		name:    "missing library",
+		ic:      types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+		mutate:  func(t *testing.T, fsys apkfs.FullFS) { require.NoError(t, fsys.Remove("/usr/lib/libdep.so.1")) },
+		wantErr: []string{"libdep.so.1: needed by /opt/app/lib/libapp.so.1, but not in"},
+	}, {
+		name:   "library from LD_LIBRARY_PATH",
+		ic:     types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}, Environment: map[string]string{"LD_LIBRARY_PATH": "/opt/app/lib"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) { require.NoError(t, fsys.Remove("/etc/ld-musl-x86_64.path")) },
+	}, {
+		name: "wrong machine",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) {
+			require.NoError(t, fsys.WriteFile("/usr/bin/app", testELF(t, elf.EM_AARCH64, ""), 0o755))
+		},
+		wantErr: []string{"/bin/app: /usr/bin/app is built for EM_AARCH64, not EM_X86_64, so running it fails with exec format error"},
+	}, {
+		name: "not executable",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) {
+			require.NoError(t, fsys.Chmod("/usr/bin/app", 0o644))
+		},
+		wantErr: []string{"/bin/app: /usr/bin/app is not executable"},
+	}, {
+		name: "neither binary nor script",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/bin/app"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) {
+			require.NoError(t, fsys.WriteFile("/usr/bin/app", []byte("echo hi\n"), 0o755))
+		},
+		wantErr: []string{"/bin/app: /usr/bin/app is neither an ELF binary nor a script starting with #!"},
+	}, {
+		name: "script interpreter missing",
+		ic:   types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "run.sh"}},
+		mutate: func(t *testing.T, fsys apkfs.FullFS) {
+			require.NoError(t, fsys.WriteFile("/usr/bin/run.sh", []byte("#!/usr/bin/python3 -u\n"), 0o755))
+		},
+		wantErr: []string{"/usr/bin/python3: file does not exist"},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := testRootfs(t)
+			if tt.mutate != nil {
+				tt.mutate(t, fsys)
+			}
+			bc := &Context{fs: fsys, ic: tt.ic, o: options.Options{Arch: amd64}}
+			err := bc.checkEntrypoint(context.Background())
+			if len(tt.wantErr) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				require.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// Fetch downloads the packages of the build into its cache without
+// installing them, after resolving them from the lockfile or the world as
+// buildImage does. The cache then holds the keys, indexes and packages a
+// frozen build of the same configuration needs.
+func (bc *Context) Fetch(ctx context.Context) error {
+	ctx, span := otel.Tracer("apko").Start(ctx, "Fetch")
+	defer span.End()
+
+	var pkgs []apk.InstallablePackage
+	if bc.o.Lockfile != "" {
+		l, err := lock.FromFile(bc.o.Lockfile)
+		if err != nil {
+			return fmt.Errorf("failed to load lock-file: %w", err)
+		}
+		pkgs, err = installablePackagesForArch(l, bc.Arch())
+		if err != nil {
+			return fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
+		}
+		// A frozen build checks the lockfile against the indexes.
+		if _, err := bc.RepositoryIndexes(ctx); err != nil {
+			return fmt.Errorf("getting repository indexes: %w", err)
+		}
+	} else {
+		resolved, _, err := bc.BuildPackageList(ctx)
+		if err != nil {
+			return fmt.Errorf("resolving apk packages: %w", err)
+		}
+		for _, pkg := range resolved {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	var g errgroup.Group
+	g.SetLimit(runtime.GOMAXPROCS(0) + 1)
+	for _, pkg := range pkgs {
+		g.Go(func() error {
+			if err := bc.apk.CachePackage(ctx, pkg); err != nil {
+				return fmt.Errorf("fetching %s: %w", pkg.PackageName(), err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// FixupFunc applies a fixup to the assembled root filesystem. It reports
+// whether the fixup applied to this image, e.g. a busybox fixup does not apply
+// to an image without busybox.
+type FixupFunc func(ctx context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage) (bool, error)
+
+// Fixup is a post-install step run against the assembled root filesystem.
+//
+// apko does not run package install scripts or triggers, so fixups stand in
+// for the work they would have done (e.g. creating busybox applet links, or
+// regenerating /etc/ld.so.cache). Fixups run in a deterministic order after
+// all packages are installed, and every fixup which applied to an image is
+// recorded in its SBOM as build tooling.
+type Fixup struct {
+	// Name uniquely identifies the fixup.
+	Name string
+	// Description is a short summary of what the fixup does.
+	Description string
+	// Run applies the fixup.
+	Run FixupFunc
+}
+
+// builtinFixups returns the fixups which are always run, in this order,
+// before any fixups added with WithFixups.
+func (bc *Context) builtinFixups() []Fixup {
+	return []Fixup{{
+		Name:        "busybox-links",
+		Description: "Creates symlinks for the busybox applets",
+		Run:         busyboxFixup,
+	}, {
+		Name:        "ldconfig",
+		Description: "Regenerates /etc/ld.so.cache",
+		Run:         ldconfigFixup,
+	}, {
+		Name:        "ca-certificates",
+		Description: "Regenerates the CA certificate bundle",
+		Run: func(ctx context.Context, fsys apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+			return updateCACertificates(ctx, fsys, bc.ic.Certificates)
+		},
+	}, {
+		Name:        "triggers",
+		Description: "Runs the triggers of the packages allowed to run them",
+		Run:         bc.runTriggers,
+	}, {
+		Name:        "pending-triggers",
+		Description: "Records the triggers of the packages which were not run, to run them when the image starts",
+		Run:         bc.recordTriggers,
+	}, {
+		Name:        "licenses",
+		Description: "Collects the license files of the installed packages",
+		Run: func(ctx context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage) (bool, error) {
+			bc.licenseFiles = nil
+			if bc.ic.Licenses == nil {
+				return false, nil
+			}
+			files, err := collectLicenses(ctx, fsys, installed, bc.ic.Licenses)
+			if err != nil {
+				return false, err
+			}
+			bc.licenseFiles = files
+			return true, nil
+		},
+	}}
+}
+
+func busyboxFixup(_ context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage) (bool, error) {
+	if _, err := fsys.Stat(busybox); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err := installBusyboxLinks(fsys, installed); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func ldconfigFixup(ctx context.Context, fsys apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+	if _, err := fsys.Stat("etc/ld.so.conf"); err != nil {
+		clog.FromContext(ctx).Debugf("/etc/ld.so.conf not found, skipping /etc/ld.so.cache update: %v", err)
+		return false, nil
+	}
+	if err := updateCache(ctx, fsys); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// fixups returns the fixups to run for this build: the built-in fixups,
+// followed by any added with WithFixups in the order they were added.
+func (bc *Context) fixups() []Fixup {
+	return append(bc.builtinFixups(), bc.extraFixups...)
+}
+
+// runFixups runs each fixup against the root filesystem, and records the
+// ones which applied.
+func (bc *Context) runFixups(ctx context.Context, installed []*apk.InstalledPackage) error {
+	log := clog.FromContext(ctx)
+
+	ctx, span := otel.Tracer("apko").Start(ctx, "runFixups")
+	defer span.End()
+
+	bc.appliedFixups = nil
+	for _, f := range bc.fixups() {
+		applied, err := f.Run(ctx, bc.fs, installed)
+		if err != nil {
+			return fmt.Errorf("running fixup %s: %w", f.Name, err)
+		}
+		if !applied {
+			log.Debugf("fixup %s does not apply, skipping", f.Name)
+			continue
+		}
+		log.Debugf("applied fixup %s", f.Name)
+		bc.appliedFixups = append(bc.appliedFixups, f)
+	}
+	return nil
+}
+
+// AppliedFixups returns the fixups which applied to the image, in the order
+// they were run.
+func (bc *Context) AppliedFixups() []Fixup {
+	return bc.appliedFixups
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestRunFixups(t *testing.T) {
+	ctx := context.Background()
+
+	var ran []string
+	record := func(name string, applies bool) Fixup {
+		return Fixup{
+			Name: name,
+			Run: func(_ context.Context, _ apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+				ran = append(ran, name)
+				return applies, nil
+			},
+		}
+	}
+
+	bc := &Context{fs: apkfs.NewMemFS()}
+	require.NoError(t, WithFixups(record("first", true), record("second", false), record("third", true))(bc))
+
+	require.NoError(t, bc.runFixups(ctx, nil))
+	require.Equal(t, []string{"first", "second", "third"}, ran)
+
+	// Neither of the built-in fixups apply to an empty filesystem.
+	var applied []string
+	for _, f := range bc.AppliedFixups() {
+		applied = append(applied, f.Name)
+	}
+	require.Equal(t, []string{"first", "third"}, applied)
+}
+
+func TestRunFixupsError(t *testing.T) {
+	bc := &Context{fs: apkfs.NewMemFS()}
+	require.NoError(t, WithFixups(Fixup{
+		Name: "broken",
+		Run: func(_ context.Context, _ apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+			return false, errors.New("boom")
+		},
+	})(bc))
+
+	require.ErrorContains(t, bc.runFixups(context.Background(), nil), "running fixup broken: boom")
+}
+
+func TestWithFixupsValidation(t *testing.T) {
+	noop := func(_ context.Context, _ apkfs.FullFS, _ []*apk.InstalledPackage) (bool, error) {
+		return false, nil
+	}
+
+	for _, tc := range []struct {
+		name   string
+		fixups []Fixup
+	}{
+		{"missing name", []Fixup{{Run: noop}}},
+		{"missing run", []Fixup{{Name: "foo"}}},
+		{"duplicate", []Fixup{{Name: "foo", Run: noop}, {Name: "foo", Run: noop}}},
+		{"shadows builtin", []Fixup{{Name: "ldconfig", Run: noop}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Error(t, WithFixups(tc.fixups...)(&Context{}))
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// historyLayer is a layer together with the created_by of its entry in the
+// history of the image, which oci.BuildImageFromLayers picks up.
+type historyLayer struct {
+	v1.Layer
+	createdBy string
+}
+
+func (l *historyLayer) CreatedBy() string { return l.createdBy }
+
+func withCreatedBy(layer v1.Layer, createdBy string) v1.Layer {
+	return &historyLayer{Layer: layer, createdBy: createdBy}
+}
+
+// configCreatedBy describes the files apko writes itself: accounts, paths,
+// /etc/apk and the like.
+const configCreatedBy = "apko: configure the image"
+
+// installCreatedBy describes a layer installing pkgs, e.g.
+// "apko: install busybox=1.36.1-r0 ca-certificates-bundle=20230506-r0".
+func installCreatedBy(pkgs []*apk.Package) string {
+	if len(pkgs) == 0 {
+		return "apko: install no packages"
+	}
+	names := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		names = append(names, fmt.Sprintf("%s=%s", pkg.Name, pkg.Version))
+	}
+	return "apko: install " + strings.Join(names, " ")
+}
+
+// layerPackages returns the packages installed in the single layer built on
+// top of the base image, if any.
+func (bc *Context) layerPackages() ([]*apk.Package, error) {
+	installed, err := bc.InstalledPackages()
+	if err != nil {
+		return nil, err
+	}
+	base := map[string]bool{}
+	if bc.baseimg != nil {
+		for _, pkg := range bc.baseimg.InstalledPackages() {
+			base[pkg.Name] = true
+		}
+	}
+	pkgs := make([]*apk.Package, 0, len(installed))
+	for _, pkg := range installed {
+		if !base[pkg.Name] {
+			pkgs = append(pkgs, &pkg.Package)
+		}
+	}
+	return pkgs, nil
+}
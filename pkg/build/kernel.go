@@ -0,0 +1,307 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Kernel packages install modules under <root>/<version> and firmware
+// under <root>, in either the split or the merged /usr layout.
+var (
+	moduleRoots   = []string{"lib/modules", "usr/lib/modules"}
+	firmwareRoots = []string{"lib/firmware", "usr/lib/firmware"}
+)
+
+// moduleSuffixes are the extensions of kernel modules, compressed or not,
+// longest first.
+var moduleSuffixes = []string{".ko.zst", ".ko.gz", ".ko.xz", ".ko"}
+
+// staleModuleIndexes are the binary indexes of depmod which list the
+// modules, and which apko does not regenerate.
+var staleModuleIndexes = []string{"modules.dep.bin", "modules.alias.bin", "modules.symbols.bin"}
+
+// kernelFileFilter returns the filter of the files installed from packages
+// which only keeps the kernel modules and firmware selected by k, or nil
+// when k selects everything.
+//
+// Modules are kept with those they depend on, according to the modules.dep
+// of the package installing them.
+func kernelFileFilter(k *types.ImageKernel) apk.FileFilter {
+	if k == nil || (len(k.Modules) == 0 && len(k.Firmware) == 0) {
+		return nil
+	}
+	return func(_ *apk.Package, files fs.FS) (func(string) bool, error) {
+		// The modules kept in the kernel directories which have a
+		// modules.dep, by path.
+		kept := map[string]bool{}
+		hasDeps := map[string]bool{}
+		if len(k.Modules) != 0 {
+			for _, root := range moduleRoots {
+				deps, err := fs.Glob(files, root+"/*/modules.dep")
+				if err != nil {
+					return nil, err
+				}
+				for _, dep := range deps {
+					b, err := fs.ReadFile(files, dep)
+					if err != nil {
+						return nil, fmt.Errorf("reading %s: %w", dep, err)
+					}
+					dir := path.Dir(dep)
+					hasDeps[dir] = true
+					for _, rel := range moduleClosure(parseModulesDep(b), k.Modules) {
+						kept[path.Join(dir, rel)] = true
+					}
+				}
+			}
+		}
+
+		return func(name string) bool {
+			if dir, rel, ok := kernelModule(name); ok && len(k.Modules) != 0 {
+				if hasDeps[dir] {
+					return kept[name]
+				}
+				return matchModule(k.Modules, rel)
+			}
+			if rel, ok := underRoots(name, firmwareRoots); ok && len(k.Firmware) != 0 {
+				return matchTree(k.Firmware, rel)
+			}
+			return true
+		}, nil
+	}
+}
+
+// rewriteModuleIndexes drops the modules which were not installed from the
+// modules.dep, modules.alias and modules.symbols of each kernel, so that
+// modprobe does not look for them, and removes the binary indexes depmod
+// generates from them.
+func rewriteModuleIndexes(fsys apkfs.FullFS, k *types.ImageKernel) error {
+	if k == nil || len(k.Modules) == 0 {
+		return nil
+	}
+	for _, root := range moduleRoots {
+		kernels, err := fsys.ReadDir(root)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, kernel := range kernels {
+			dir := path.Join(root, kernel.Name())
+			if err := rewriteKernelModuleIndexes(fsys, dir); err != nil {
+				return fmt.Errorf("rewriting module indexes of %s: %w", dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+func rewriteKernelModuleIndexes(fsys apkfs.FullFS, dir string) error {
+	depPath := path.Join(dir, "modules.dep")
+	b, err := fsys.ReadFile(depPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	installed := map[string]bool{}
+	var dep bytes.Buffer
+	for _, line := range lines(b) {
+		mod, _, _ := strings.Cut(line, ":")
+		if _, err := fsys.Stat(path.Join(dir, mod)); err != nil {
+			continue
+		}
+		installed[moduleName(mod)] = true
+		dep.WriteString(line + "\n")
+	}
+	if err := rewriteFile(fsys, depPath, dep.Bytes()); err != nil {
+		return err
+	}
+
+	// Both list a module name as the last field of each line.
+	for _, index := range []string{"modules.alias", "modules.symbols"} {
+		indexPath := path.Join(dir, index)
+		b, err := fsys.ReadFile(indexPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		for _, line := range lines(b) {
+			fields := strings.Fields(line)
+			if strings.HasPrefix(line, "#") || installed[fields[len(fields)-1]] {
+				out.WriteString(line + "\n")
+			}
+		}
+		if err := rewriteFile(fsys, indexPath, out.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	for _, index := range staleModuleIndexes {
+		if err := fsys.Remove(path.Join(dir, index)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteFile replaces the content of an existing file, keeping its mode.
+func rewriteFile(fsys apkfs.FullFS, name string, data []byte) error {
+	fi, err := fsys.Stat(name)
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(name, data, fi.Mode().Perm())
+}
+
+// lines returns the non-empty lines of b.
+func lines(b []byte) []string {
+	var out []string
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// parseModulesDep parses a modules.dep, mapping the path of each module to
+// the paths of the modules it depends on.
+func parseModulesDep(b []byte) map[string][]string {
+	deps := map[string][]string{}
+	for _, line := range lines(b) {
+		mod, rest, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, "#") {
+			continue
+		}
+		deps[mod] = strings.Fields(rest)
+	}
+	return deps
+}
+
+// moduleClosure returns the sorted paths of the modules matching globs and
+// of the modules they depend on, directly or not.
+func moduleClosure(deps map[string][]string, globs []string) []string {
+	kept := map[string]bool{}
+	var queue []string
+	for mod := range deps {
+		if matchModule(globs, mod) {
+			kept[mod] = true
+			queue = append(queue, mod)
+		}
+	}
+	for len(queue) != 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		for _, dep := range deps[mod] {
+			if !kept[dep] {
+				kept[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	out := make([]string, 0, len(kept))
+	for mod := range kept {
+		out = append(out, mod)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// kernelModule returns the kernel directory of a kernel module and the
+// path of the module under it, if name is a kernel module.
+func kernelModule(name string) (dir, rel string, ok bool) {
+	for _, root := range moduleRoots {
+		rest, ok := strings.CutPrefix(name, root+"/")
+		if !ok {
+			continue
+		}
+		version, rel, ok := strings.Cut(rest, "/")
+		if !ok || moduleName(rel) == "" {
+			return "", "", false
+		}
+		return path.Join(root, version), rel, true
+	}
+	return "", "", false
+}
+
+// underRoots returns the path of name under the first of roots containing
+// it.
+func underRoots(name string, roots []string) (string, bool) {
+	for _, root := range roots {
+		if rel, ok := strings.CutPrefix(name, root+"/"); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// moduleName returns the name of the kernel module at path, in which
+// dashes and underscores are the same, or "" if path is not a module.
+func moduleName(p string) string {
+	base := path.Base(p)
+	for _, suffix := range moduleSuffixes {
+		if name, ok := strings.CutSuffix(base, suffix); ok {
+			return strings.ReplaceAll(name, "-", "_")
+		}
+	}
+	return ""
+}
+
+// matchModule returns whether the module at rel, relative to its kernel
+// directory, matches one of globs: by name for globs without a slash, and
+// by path otherwise.
+func matchModule(globs []string, rel string) bool {
+	name := moduleName(rel)
+	for _, glob := range globs {
+		if strings.Contains(glob, "/") {
+			if matchTree([]string{glob}, rel) {
+				return true
+			}
+		} else if ok, _ := path.Match(strings.ReplaceAll(glob, "-", "_"), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchTree returns whether rel, or one of the directories containing it,
+// matches one of globs.
+func matchTree(globs []string, rel string) bool {
+	for _, glob := range globs {
+		for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(glob, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const testModulesDep = `kernel/drivers/net/virtio_net.ko.xz: kernel/drivers/net/net_failover.ko.xz kernel/net/core/failover.ko.xz
+kernel/drivers/net/net_failover.ko.xz: kernel/net/core/failover.ko.xz
+kernel/net/core/failover.ko.xz:
+kernel/fs/ext4/ext4.ko.xz: kernel/fs/jbd2/jbd2.ko.xz
+kernel/fs/jbd2/jbd2.ko.xz:
+kernel/drivers/gpu/drm/amd/amdgpu/amdgpu.ko.xz:
+`
+
+func TestKernelFileFilter(t *testing.T) {
+	require.Nil(t, kernelFileFilter(nil))
+	require.Nil(t, kernelFileFilter(&types.ImageKernel{}))
+
+	files := fstest.MapFS{
+		"lib/modules/6.6.1/modules.dep": {Data: []byte(testModulesDep)},
+	}
+	filter := kernelFileFilter(&types.ImageKernel{
+		Modules:  []string{"virtio-net", "kernel/fs/ext4"},
+		Firmware: []string{"amdgpu/navi*", "regulatory.db"},
+	})
+	keep, err := filter(nil, files)
+	require.NoError(t, err)
+
+	for name, want := range map[string]bool{
+		// Matched by name, with its dependencies.
+		"lib/modules/6.6.1/kernel/drivers/net/virtio_net.ko.xz":   true,
+		"lib/modules/6.6.1/kernel/drivers/net/net_failover.ko.xz": true,
+		"lib/modules/6.6.1/kernel/net/core/failover.ko.xz":        true,
+		// Matched by directory, with its dependencies.
+		"lib/modules/6.6.1/kernel/fs/ext4/ext4.ko.xz":                      true,
+		"lib/modules/6.6.1/kernel/fs/jbd2/jbd2.ko.xz":                      true,
+		"lib/modules/6.6.1/kernel/drivers/gpu/drm/amd/amdgpu/amdgpu.ko.xz": false,
+		// Files of the kernel which are not modules are kept.
+		"lib/modules/6.6.1/modules.dep":     true,
+		"lib/modules/6.6.1/modules.builtin": true,
+		// Without a modules.dep, modules are matched alone.
+		"usr/lib/modules/6.6.2/kernel/drivers/net/virtio_net.ko": true,
+		"usr/lib/modules/6.6.2/kernel/drivers/net/e1000e.ko":     false,
+
+		"lib/firmware/amdgpu/navi10_sos.bin":        true,
+		"lib/firmware/amdgpu/vega10_sos.bin":        false,
+		"usr/lib/firmware/regulatory.db":            true,
+		"lib/firmware/iwlwifi-cc-a0-77.ucode":       false,
+		"usr/bin/modprobe":                          true,
+		"etc/modprobe.d/blacklist.conf":             true,
+		"lib/modules-load.d/virtio.conf":            true,
+		"lib/modules/6.6.1/kernel/not-a-module.txt": true,
+	} {
+		require.Equal(t, want, keep(name), name)
+	}
+}
+
+func TestRewriteModuleIndexes(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	dir := "lib/modules/6.6.1"
+	require.NoError(t, fsys.MkdirAll(dir+"/kernel/net/core", 0755))
+	require.NoError(t, fsys.MkdirAll(dir+"/kernel/drivers/net", 0755))
+	for _, f := range []string{"kernel/net/core/failover.ko.xz", "kernel/drivers/net/net_failover.ko.xz", "kernel/drivers/net/virtio_net.ko.xz"} {
+		require.NoError(t, fsys.WriteFile(dir+"/"+f, nil, 0644))
+	}
+	require.NoError(t, fsys.WriteFile(dir+"/modules.dep", []byte(testModulesDep), 0644))
+	require.NoError(t, fsys.WriteFile(dir+"/modules.alias", []byte(`# Aliases extracted from modules themselves.
+alias virtio:d00000001v* virtio_net
+alias fs-ext4 ext4
+`), 0644))
+	require.NoError(t, fsys.WriteFile(dir+"/modules.dep.bin", []byte("stale"), 0644))
+	require.NoError(t, fsys.WriteFile(dir+"/modules.builtin.bin", []byte("builtin"), 0644))
+
+	// Without module filters, the indexes are left alone.
+	require.NoError(t, rewriteModuleIndexes(fsys, &types.ImageKernel{Firmware: []string{"amdgpu"}}))
+	b, err := fsys.ReadFile(dir + "/modules.dep")
+	require.NoError(t, err)
+	require.Equal(t, testModulesDep, string(b))
+
+	require.NoError(t, rewriteModuleIndexes(fsys, &types.ImageKernel{Modules: []string{"virtio_net"}}))
+
+	b, err = fsys.ReadFile(dir + "/modules.dep")
+	require.NoError(t, err)
+	require.Equal(t, `kernel/drivers/net/virtio_net.ko.xz: kernel/drivers/net/net_failover.ko.xz kernel/net/core/failover.ko.xz
+kernel/drivers/net/net_failover.ko.xz: kernel/net/core/failover.ko.xz
+kernel/net/core/failover.ko.xz:
+`, string(b))
+
+	b, err = fsys.ReadFile(dir + "/modules.alias")
+	require.NoError(t, err)
+	require.Equal(t, "# Aliases extracted from modules themselves.\nalias virtio:d00000001v* virtio_net\n", string(b))
+
+	_, err = fsys.Stat(dir + "/modules.dep.bin")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Stat(dir + "/modules.builtin.bin")
+	require.NoError(t, err)
+}
@@ -24,12 +24,14 @@ import (
 	"os"
 	"path"
 	"slices"
+	"time"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 
 	"github.com/chainguard-dev/clog"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"go.opentelemetry.io/otel"
 )
 
 func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
@@ -77,7 +79,8 @@ func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
 	}
 
 	// Then partition that single fs.FS into multiple layers based on our layering strategy.
-	return splitLayers(ctx, bc.fs, groups, bc.o.TempDir())
+	defer bc.metrics.observe(bc.Arch(), "layers", time.Now())
+	return splitLayers(ctx, bc.fs, groups, bc.o.TempDir(), bc.excludedPaths()...)
 }
 
 func replacesGroup(rep string, g *group) (bool, error) {
@@ -245,7 +248,10 @@ func merge(groups ...*group) *group {
 	return merged
 }
 
-func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, tmpdir string) ([]v1.Layer, error) {
+func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, tmpdir string, exclude ...string) ([]v1.Layer, error) {
+	ctx, span := otel.Tracer("apko").Start(ctx, "splitLayers")
+	defer span.End()
+
 	buf := make([]byte, 1<<20)
 
 	// We'll create a writer for each layer and a map to quickly access the writer given a package or group.
@@ -283,7 +289,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, tmpdir
 	// any missing directory entries to the layer before we write the actual file entry.
 	stack := []*file{}
 
-	for f, err := range walkFS(ctx, fsys) {
+	for f, err := range walkFS(ctx, fsys, exclude...) {
 		if err != nil {
 			return nil, err
 		}
@@ -379,7 +385,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, tmpdir
 		if err != nil {
 			return nil, fmt.Errorf("finalizing group[%d] layer: %w", i, err)
 		}
-		layers = append(layers, l)
+		layers = append(layers, withCreatedBy(l, installCreatedBy(g.pkgs)))
 	}
 
 	// ...including the top layer.
@@ -388,7 +394,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, tmpdir
 		return nil, fmt.Errorf("finalizing top layer: %w", err)
 	}
 
-	layers = append(layers, topLayer)
+	layers = append(layers, withCreatedBy(topLayer, configCreatedBy))
 
 	return layers, nil
 }
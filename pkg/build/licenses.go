@@ -0,0 +1,153 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+)
+
+const (
+	// defaultLicensesPath is where license files are collected by default,
+	// which is where some certification programs expect them.
+	defaultLicensesPath = "/licenses"
+	licensesDir         = "usr/share/licenses"
+)
+
+// licenseFilePrefixes are the upper-cased prefixes of the names of license
+// files installed outside of /usr/share/licenses.
+var licenseFilePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "COPYRIGHT", "NOTICE", "UNLICENSE"}
+
+// sourceExts are the extensions of files which are named like license files,
+// but are code, e.g. license.py.
+var sourceExts = map[string]struct{}{
+	".c": {}, ".class": {}, ".go": {}, ".h": {}, ".html": {}, ".java": {},
+	".js": {}, ".json": {}, ".pm": {}, ".py": {}, ".pyc": {}, ".rb": {},
+	".so": {}, ".ts": {}, ".xml": {}, ".yaml": {}, ".yml": {},
+}
+
+// isLicenseFile returns whether a file installed at name, outside of
+// /usr/share/licenses, is a license file, e.g. LICENSE, COPYING.LIB or
+// NOTICE.txt.
+func isLicenseFile(name string) bool {
+	base := path.Base(name)
+	if _, ok := sourceExts[strings.ToLower(path.Ext(base))]; ok {
+		return false
+	}
+	upper := strings.ToUpper(base)
+	for _, prefix := range licenseFilePrefixes {
+		rest, ok := strings.CutPrefix(upper, prefix)
+		if !ok {
+			continue
+		}
+		if rest == "" || strings.ContainsAny(rest[:1], ".-_") || rest == "S" {
+			return true
+		}
+	}
+	return false
+}
+
+// licenseFileName returns the name of the license file installed at name
+// within its package's directory of collected license files. Files under
+// /usr/share/licenses/<dir> keep their path below it, and others are
+// collected by their base name.
+func licenseFileName(name string) (string, bool) {
+	if rest, ok := strings.CutPrefix(name, licensesDir+"/"); ok {
+		if _, below, ok := strings.Cut(rest, "/"); ok {
+			return below, true
+		}
+		return rest, true
+	}
+	if isLicenseFile(name) {
+		return path.Base(name), true
+	}
+	return "", false
+}
+
+// licensesRoot returns the directory license files are collected into,
+// relative to the root of the image.
+func licensesRoot(licenses *types.ImageLicenses) string {
+	root := defaultLicensesPath
+	if licenses.Path != "" {
+		root = licenses.Path
+	}
+	return strings.TrimPrefix(path.Clean(root), "/")
+}
+
+// collectLicenses copies the license files of each installed package into a
+// directory of the package under the configured path, and returns them.
+func collectLicenses(ctx context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage, licenses *types.ImageLicenses) ([]soptions.LicenseFile, error) {
+	log := clog.FromContext(ctx)
+
+	root := licensesRoot(licenses)
+	var collected []soptions.LicenseFile
+	for _, pkg := range installed {
+		dir := path.Join(root, pkg.Name)
+		taken := map[string]struct{}{}
+		for _, hdr := range pkg.Files {
+			if !hdr.FileInfo().Mode().IsRegular() || strings.HasPrefix(hdr.Name, root+"/") {
+				continue
+			}
+			name, ok := licenseFileName(hdr.Name)
+			if !ok {
+				continue
+			}
+			if _, ok := taken[name]; ok {
+				// e.g. LICENSE files of two vendored libraries
+				name = strings.ReplaceAll(hdr.Name, "/", "_")
+			}
+			taken[name] = struct{}{}
+
+			data, err := fsys.ReadFile(hdr.Name)
+			if errors.Is(err, fs.ErrNotExist) {
+				// e.g. removed by a paths directive
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", hdr.Name, err)
+			}
+
+			dest := path.Join(dir, name)
+			if err := fsys.MkdirAll(path.Dir(dest), 0o755); err != nil {
+				return nil, fmt.Errorf("creating %s: %w", path.Dir(dest), err)
+			}
+			if err := fsys.WriteFile(dest, data, 0o644); err != nil {
+				return nil, fmt.Errorf("writing %s: %w", dest, err)
+			}
+
+			sum := sha256.Sum256(data)
+			collected = append(collected, soptions.LicenseFile{
+				Path:    dest,
+				Source:  hdr.Name,
+				SHA256:  hex.EncodeToString(sum[:]),
+				Package: pkg,
+			})
+		}
+	}
+	log.Debugf("collected %d license files into /%s", len(collected), root)
+	return collected, nil
+}
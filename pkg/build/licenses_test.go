@@ -0,0 +1,121 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestIsLicenseFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"usr/lib/foo/LICENSE":         true,
+		"usr/lib/foo/LICENSE.txt":     true,
+		"usr/lib/foo/LICENSE-MIT":     true,
+		"usr/lib/foo/license.md":      true,
+		"usr/lib/foo/LICENCE":         true,
+		"usr/lib/foo/COPYING.LIB":     true,
+		"usr/lib/foo/NOTICE":          true,
+		"usr/lib/foo/LICENSES":        true,
+		"usr/lib/foo/license.py":      false,
+		"usr/lib/foo/licenses.go":     false,
+		"usr/lib/foo/LICENSEE":        false,
+		"usr/lib/foo/noticeboard.txt": false,
+		"usr/bin/foo":                 false,
+	} {
+		require.Equal(t, want, isLicenseFile(name), name)
+	}
+}
+
+func TestCollectLicenses(t *testing.T) {
+	ctx := context.Background()
+	fsys := apkfs.NewMemFS()
+	for name, content := range map[string]string{
+		"usr/share/licenses/foo/LICENSE":     "Apache-2.0",
+		"usr/share/licenses/foo/sub/NOTICE":  "notice",
+		"usr/lib/foo/vendor/a/LICENSE":       "MIT a",
+		"usr/lib/foo/vendor/b/LICENSE":       "MIT b",
+		"usr/lib/foo/license.py":             "code",
+		"usr/bin/foo":                        "binary",
+		"usr/share/licenses/bar/COPYING":     "GPL",
+		"licenses/stale/LICENSE":             "already collected",
+		"usr/share/licenses/removed/LICENSE": "",
+	} {
+		require.NoError(t, fsys.MkdirAll(path.Dir(name), 0o755))
+		require.NoError(t, fsys.WriteFile(name, []byte(content), 0o644))
+	}
+	require.NoError(t, fsys.Remove("usr/share/licenses/removed/LICENSE"))
+
+	files := func(names ...string) []tar.Header {
+		hdrs := make([]tar.Header, 0, len(names))
+		for _, name := range names {
+			hdrs = append(hdrs, tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644})
+		}
+		return hdrs
+	}
+	foo := &apk.InstalledPackage{
+		Package: apk.Package{Name: "foo", Version: "1.0-r0"},
+		Files: append(files(
+			"usr/share/licenses/foo/LICENSE",
+			"usr/share/licenses/foo/sub/NOTICE",
+			"usr/lib/foo/vendor/a/LICENSE",
+			"usr/lib/foo/vendor/b/LICENSE",
+			"usr/lib/foo/license.py",
+			"usr/bin/foo",
+			"usr/share/licenses/removed/LICENSE",
+		), tar.Header{Name: "usr/share/licenses/foo", Typeflag: tar.TypeDir, Mode: 0o755}),
+	}
+	bar := &apk.InstalledPackage{
+		Package: apk.Package{Name: "bar", Version: "2.0-r1"},
+		Files:   files("usr/share/licenses/bar/COPYING", "licenses/stale/LICENSE"),
+	}
+
+	collected, err := collectLicenses(ctx, fsys, []*apk.InstalledPackage{foo, bar}, &types.ImageLicenses{})
+	require.NoError(t, err)
+
+	got := map[string]string{}
+	for _, f := range collected {
+		got[f.Path] = f.Source
+		data, err := fsys.ReadFile(f.Path)
+		require.NoError(t, err)
+		source, err := fsys.ReadFile(f.Source)
+		require.NoError(t, err)
+		require.Equal(t, source, data)
+		require.Len(t, f.SHA256, 64)
+	}
+	require.Equal(t, map[string]string{
+		"licenses/foo/LICENSE":                      "usr/share/licenses/foo/LICENSE",
+		"licenses/foo/sub/NOTICE":                   "usr/share/licenses/foo/sub/NOTICE",
+		"licenses/foo/usr_lib_foo_vendor_a_LICENSE": "usr/lib/foo/vendor/a/LICENSE",
+		"licenses/foo/usr_lib_foo_vendor_b_LICENSE": "usr/lib/foo/vendor/b/LICENSE",
+		"licenses/bar/COPYING":                      "usr/share/licenses/bar/COPYING",
+	}, got)
+	require.Equal(t, "foo", collected[0].Package.Name)
+
+	// The path is configurable.
+	collected, err = collectLicenses(ctx, fsys, []*apk.InstalledPackage{bar}, &types.ImageLicenses{Path: "/usr/share/doc/licenses/"})
+	require.NoError(t, err)
+	require.Len(t, collected, 2)
+	require.Equal(t, "usr/share/doc/licenses/bar/COPYING", collected[0].Path)
+	require.Equal(t, "usr/share/doc/licenses/bar/LICENSE", collected[1].Path)
+}
@@ -0,0 +1,386 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+)
+
+// localCopy is a file, directory or symlink of the build context to copy
+// into the image.
+type localCopy struct {
+	// src is the path of the file on the host
+	src string
+	// dst is the path of the file in the image, without a leading slash
+	dst  string
+	mode fs.FileMode
+}
+
+// excludeMatcher matches the paths, relative to the source directory of a
+// local file, excluded by its patterns. Like .dockerignore, the last
+// matching pattern wins, a pattern starting with "!" brings back the paths
+// it matches, and a pattern matching a directory matches its contents.
+type excludeMatcher []string
+
+func (m excludeMatcher) excluded(rel string) bool {
+	excluded := false
+	for _, pattern := range m {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = path.Clean(strings.TrimPrefix(pattern, "!"))
+		for p := rel; p != "."; p = path.Dir(p) {
+			if matchGlob(strings.Split(pattern, "/"), strings.Split(p, "/")) {
+				excluded = !negated
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// negates returns whether some pattern brings back excluded paths, in which
+// case excluded directories have to be walked anyway.
+func (m excludeMatcher) negates() bool {
+	for _, pattern := range m {
+		if strings.HasPrefix(pattern, "!") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the elements of a path against those of a pattern, where
+// a "**" element matches any number of elements.
+func matchGlob(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := len(elems); i >= 0; i-- {
+				if matchGlob(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], elems[0]); err != nil || !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// resolveLocalSource resolves source relative to the working directory, then
+// to the include paths, which make up the build context, and returns its
+// path. Once the symlinks of its parents are resolved, the source must be
+// within the directory it was found in. A source which is itself a symlink
+// is copied as one, so its target is not resolved.
+func resolveLocalSource(source string, includePaths []string) (string, error) {
+	if filepath.IsAbs(source) || path.IsAbs(source) {
+		return "", fmt.Errorf("%s is an absolute path, not one in the build context", source)
+	}
+	for _, root := range append([]string{"."}, includePaths...) {
+		src := filepath.Join(root, filepath.FromSlash(source))
+		if _, err := os.Lstat(src); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return "", err
+		}
+		realDir, err := filepath.EvalSymlinks(filepath.Dir(src))
+		if err != nil {
+			return "", err
+		}
+		rel, err := filepath.Rel(realRoot, filepath.Join(realDir, filepath.Base(src)))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is outside of the build context %s", src, root)
+		}
+		return src, nil
+	}
+	return "", os.ErrNotExist
+}
+
+// listLocalFiles resolves the source of a local file and lists what it
+// copies into the image, parents first.
+func listLocalFiles(lf types.LocalFile, includePaths []string) ([]localCopy, error) {
+	src, err := resolveLocalSource(lf.Source, includePaths)
+	if err != nil {
+		return nil, fmt.Errorf("resolving local file %s: %w", lf.Source, err)
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return nil, err
+	}
+	dst := strings.TrimPrefix(path.Clean(lf.Destination), "/")
+
+	if !info.IsDir() {
+		if strings.HasSuffix(lf.Destination, "/") {
+			dst = path.Join(dst, filepath.Base(src))
+		}
+		return []localCopy{{src: src, dst: dst, mode: info.Mode()}}, nil
+	}
+
+	exclude := excludeMatcher(lf.Exclude)
+	var copies []localCopy
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." && dst == "" {
+			// Leave the root directory of the image alone.
+			return nil
+		}
+		if rel != "." && exclude.excluded(rel) {
+			if d.IsDir() && !exclude.negates() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		copies = append(copies, localCopy{src: p, dst: path.Join(dst, rel), mode: info.Mode()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking local file %s: %w", lf.Source, err)
+	}
+	return copies, nil
+}
+
+// substitutionRegex matches the ${{name}} references substituted in local
+// files.
+var substitutionRegex = regexp.MustCompile(`\$\{\{\s*([^}\s]+)\s*\}\}`)
+
+// substitute replaces the ${{name}} references in data with the values of
+// the variables, failing on references to undefined variables.
+func substitute(data []byte, vars map[string]string) ([]byte, error) {
+	var undefined []string
+	out := substitutionRegex.ReplaceAllFunc(data, func(ref []byte) []byte {
+		name := string(substitutionRegex.FindSubmatch(ref)[1])
+		v, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+			return ref
+		}
+		return []byte(v)
+	})
+	if len(undefined) != 0 {
+		slices.Sort(undefined)
+		return nil, fmt.Errorf("undefined variables: %s", strings.Join(slices.Compact(undefined), ", "))
+	}
+	return out, nil
+}
+
+// substitutionVariables returns the built-in variables which can be
+// referenced by the substitutions of local files, or nil when no local file
+// has substitutions.
+func (bc *Context) substitutionVariables() (map[string]string, error) {
+	if !slices.ContainsFunc(bc.ic.Contents.LocalFiles, func(lf types.LocalFile) bool {
+		return lf.Substitutions != nil
+	}) {
+		return nil, nil
+	}
+
+	vars := map[string]string{"build.arch": bc.Arch().ToAPK()}
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("getting installed packages: %w", err)
+	}
+	for _, pkg := range installed {
+		vars["package."+pkg.Name+".version"] = pkg.Version
+	}
+	if bc.o.Lockfile != "" {
+		data, err := os.ReadFile(bc.o.Lockfile)
+		if err != nil {
+			return nil, fmt.Errorf("reading lock file: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		vars["lock.digest"] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return vars, nil
+}
+
+// localFileVariables returns the variables substituted in the files of a
+// local file, which are the built-in variables and its own substitutions,
+// or nil when it has no substitutions.
+func localFileVariables(lf types.LocalFile, builtins map[string]string) (map[string]string, error) {
+	if lf.Substitutions == nil {
+		return nil, nil
+	}
+	vars := maps.Clone(builtins)
+	if vars == nil {
+		vars = make(map[string]string, len(lf.Substitutions))
+	}
+	for name, value := range lf.Substitutions {
+		expanded, err := substitute([]byte(value), builtins)
+		if err != nil {
+			return nil, fmt.Errorf("substitution %s of local file %s: %w", name, lf.Source, err)
+		}
+		vars[name] = string(expanded)
+	}
+	return vars, nil
+}
+
+// copyLocalFiles copies the local files of the image configuration from the
+// build context into the image, substituting the variables of those with
+// substitutions, and returns the regular files it copied.
+func copyLocalFiles(ctx context.Context, fsys apkfs.FullFS, includePaths []string, localFiles []types.LocalFile, builtins map[string]string) ([]soptions.LocalFile, error) {
+	log := clog.FromContext(ctx)
+
+	var copied []soptions.LocalFile
+	for _, lf := range localFiles {
+		copies, err := listLocalFiles(lf, includePaths)
+		if err != nil {
+			return nil, err
+		}
+		vars, err := localFileVariables(lf, builtins)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range copies {
+			f, err := copyLocalFile(fsys, lf, c, vars)
+			if err != nil {
+				return nil, fmt.Errorf("copying %s to /%s: %w", c.src, c.dst, err)
+			}
+			if f != nil {
+				copied = append(copied, *f)
+			}
+		}
+		log.Debugf("copied %d paths from %s to %s", len(copies), lf.Source, lf.Destination)
+	}
+	return copied, nil
+}
+
+func copyLocalFile(fsys apkfs.FullFS, lf types.LocalFile, c localCopy, vars map[string]string) (*soptions.LocalFile, error) {
+	if err := ensureParentDirectory(fsys, c.dst); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.mode.IsDir():
+		if err := fsys.MkdirAll(c.dst, 0755); err != nil {
+			return nil, err
+		}
+		if err := mutatePermissionsDirect(fsys, c.dst, 0755, lf.UID, lf.GID); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case c.mode&fs.ModeSymlink != 0:
+		target, err := os.Readlink(c.src)
+		if err != nil {
+			return nil, err
+		}
+		if err := removeExisting(fsys, c.dst); err != nil {
+			return nil, err
+		}
+		if err := fsys.Symlink(target, c.dst); err != nil {
+			return nil, err
+		}
+		return nil, nil
+
+	case c.mode.IsRegular():
+		data, err := os.ReadFile(c.src)
+		if err != nil {
+			return nil, err
+		}
+		if vars != nil {
+			if data, err = substitute(data, vars); err != nil {
+				return nil, err
+			}
+		}
+		perms := fs.FileMode(lf.Permissions)
+		if perms == 0 {
+			perms = 0644
+			if c.mode&0100 != 0 {
+				perms = 0755
+			}
+		}
+		if err := removeExisting(fsys, c.dst); err != nil {
+			return nil, err
+		}
+		if err := fsys.WriteFile(c.dst, data, perms); err != nil {
+			return nil, err
+		}
+		if err := mutatePermissionsDirect(fsys, c.dst, uint32(perms), lf.UID, lf.GID); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		return &soptions.LocalFile{
+			Path:   c.dst,
+			Source: c.src,
+			SHA256: hex.EncodeToString(sum[:]),
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported file type %s", c.mode.Type())
+	}
+}
+
+// removeExisting removes a file or symlink, e.g. installed by a package, a
+// local file replaces.
+func removeExisting(fsys apkfs.FullFS, name string) error {
+	if err := fsys.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// plannedLocalFiles returns the paths the local files of the image
+// configuration are copied to.
+func plannedLocalFiles(localFiles []types.LocalFile, includePaths []string) ([]string, error) {
+	var files []string
+	for _, lf := range localFiles {
+		copies, err := listLocalFiles(lf, includePaths)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range copies {
+			if !c.mode.IsDir() {
+				files = append(files, c.dst)
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+)
+
+func TestExcludeMatcher(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		path     string
+		want     bool
+	}{
+		{[]string{"*.md"}, "README.md", true},
+		{[]string{"*.md"}, "docs/README.md", false},
+		{[]string{"**/*.md"}, "docs/README.md", true},
+		{[]string{"**/*.md"}, "README.md", true},
+		{[]string{"docs"}, "docs/README.md", true},
+		{[]string{"docs/**"}, "docs/a/b/c", true},
+		{[]string{"a/**/c"}, "a/c", true},
+		{[]string{"a/**/c"}, "a/b/b/c", true},
+		{[]string{"a/**/c"}, "a/b/d", false},
+		{[]string{"*.md", "!README.md"}, "README.md", false},
+		{[]string{"*.md", "!README.md"}, "CHANGES.md", true},
+		{[]string{"!README.md", "*.md"}, "README.md", true},
+		{[]string{"./bin/"}, "bin/tool", true},
+		{nil, "bin/tool", false},
+	} {
+		require.Equal(t, tc.want, excludeMatcher(tc.patterns).excluded(tc.path), "%v %s", tc.patterns, tc.path)
+	}
+}
+
+func TestCopyLocalFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app/config.yaml":      "key: value",
+		"app/bin/server":       "#!/bin/sh",
+		"app/docs/README.md":   "docs",
+		"app/.git/HEAD":        "ref",
+		"app/static/index.htm": "<html>",
+		"motd":                 "hello",
+	} {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(dir, "app/bin/server"), 0o755))
+	require.NoError(t, os.Symlink("index.htm", filepath.Join(dir, "app/static/index.html")))
+
+	fsys := apkfs.NewMemFS()
+	// A file installed by a package is replaced.
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/motd", []byte("default"), 0o644))
+
+	local := []types.LocalFile{{
+		Source:      "app",
+		Destination: "/srv/app",
+		UID:         65532,
+		GID:         65532,
+		Exclude:     []string{".git", "docs"},
+	}, {
+		Source:      "motd",
+		Destination: "/etc/",
+		Permissions: 0o600,
+	}}
+	copied, err := copyLocalFiles(ctx, fsys, []string{dir}, local, nil)
+	require.NoError(t, err)
+
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	require.Equal(t, []soptions.LocalFile{
+		{Path: "srv/app/bin/server", Source: filepath.Join(dir, "app/bin/server"), SHA256: sum("#!/bin/sh")},
+		{Path: "srv/app/config.yaml", Source: filepath.Join(dir, "app/config.yaml"), SHA256: sum("key: value")},
+		{Path: "srv/app/static/index.htm", Source: filepath.Join(dir, "app/static/index.htm"), SHA256: sum("<html>")},
+		{Path: "etc/motd", Source: filepath.Join(dir, "motd"), SHA256: sum("hello")},
+	}, copied)
+
+	for name, mode := range map[string]fs.FileMode{
+		"srv/app":             fs.ModeDir | 0o755,
+		"srv/app/bin/server":  0o755,
+		"srv/app/config.yaml": 0o644,
+		"etc/motd":            0o600,
+	} {
+		info, err := fsys.Stat(name)
+		require.NoError(t, err, name)
+		require.Equal(t, mode, info.Mode(), name)
+	}
+	for _, name := range []string{"srv/app/.git", "srv/app/docs"} {
+		_, err := fsys.Stat(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+	}
+	target, err := fsys.Readlink("srv/app/static/index.html")
+	require.NoError(t, err)
+	require.Equal(t, "index.htm", target)
+	data, err := fsys.ReadFile("etc/motd")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	planned, err := plannedLocalFiles(local, []string{dir})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{
+		"srv/app/bin/server", "srv/app/config.yaml", "srv/app/static/index.htm",
+		"srv/app/static/index.html", "etc/motd",
+	}, planned)
+
+	_, err = copyLocalFiles(ctx, fsys, []string{dir}, []types.LocalFile{{Source: "missing", Destination: "/"}}, nil)
+	require.ErrorContains(t, err, "resolving local file missing")
+}
+
+func TestLocalFilesBuildContext(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "context")
+	outside := filepath.Join(root, "outside")
+	for _, name := range []string{filepath.Join(dir, "app", "config.yaml"), filepath.Join(outside, "secret")} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte("data"), 0o644))
+	}
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "escape")))
+	require.NoError(t, os.Symlink("app", filepath.Join(dir, "alias")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "link")))
+
+	for _, tc := range []struct {
+		source  string
+		wantErr string
+	}{
+		{source: "app/config.yaml"},
+		// A symlink within the build context is followed.
+		{source: "alias/config.yaml"},
+		// A symlink is copied as one, so where it points doesn't matter.
+		{source: "link"},
+		{source: "escape/secret", wantErr: "outside of the build context"},
+		{source: "../outside/secret", wantErr: "outside of the build context"},
+		{source: filepath.Join(outside, "secret"), wantErr: "is an absolute path"},
+	} {
+		t.Run(tc.source, func(t *testing.T) {
+			_, err := listLocalFiles(types.LocalFile{Source: tc.source, Destination: "/etc/"}, []string{dir})
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	vars := map[string]string{"build.arch": "aarch64", "package.nginx.version": "1.27.0-r0", "WORKERS": "4"}
+	for _, tc := range []struct {
+		in, want, wantErr string
+	}{
+		{in: "worker_processes ${{WORKERS}};", want: "worker_processes 4;"},
+		{in: "# nginx ${{ package.nginx.version }} for ${{build.arch}}", want: "# nginx 1.27.0-r0 for aarch64"},
+		{in: "no references, ${HOME} and {{ this }}", want: "no references, ${HOME} and {{ this }}"},
+		{in: "${{missing}} ${{WORKERS}} ${{missing}} ${{other}}", wantErr: "undefined variables: missing, other"},
+	} {
+		got, err := substitute([]byte(tc.in), vars)
+		if tc.wantErr != "" {
+			require.EqualError(t, err, tc.wantErr, tc.in)
+			continue
+		}
+		require.NoError(t, err, tc.in)
+		require.Equal(t, tc.want, string(got), tc.in)
+	}
+}
+
+func TestCopyLocalFilesSubstitutions(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "nginx.conf"), []byte("worker_processes ${{WORKERS}};\n# ${{LABEL}}\n"), 0o644))
+
+	builtins := map[string]string{"build.arch": "x86_64", "package.nginx.version": "1.27.0-r0"}
+	local := types.LocalFile{
+		Source:        "nginx.conf",
+		Destination:   "/etc/nginx/nginx.conf",
+		Substitutions: map[string]string{"WORKERS": "4", "LABEL": "nginx ${{package.nginx.version}} (${{build.arch}})"},
+	}
+	fsys := apkfs.NewMemFS()
+	copied, err := copyLocalFiles(ctx, fsys, []string{dir}, []types.LocalFile{local}, builtins)
+	require.NoError(t, err)
+
+	want := "worker_processes 4;\n# nginx 1.27.0-r0 (x86_64)\n"
+	data, err := fsys.ReadFile("etc/nginx/nginx.conf")
+	require.NoError(t, err)
+	require.Equal(t, want, string(data))
+	// The SBOM has the checksum of the substituted file.
+	sum := sha256.Sum256([]byte(want))
+	require.Equal(t, hex.EncodeToString(sum[:]), copied[0].SHA256)
+
+	// Without substitutions, files are copied as is.
+	local.Substitutions = nil
+	_, err = copyLocalFiles(ctx, fsys, []string{dir}, []types.LocalFile{local}, builtins)
+	require.NoError(t, err)
+	data, err = fsys.ReadFile("etc/nginx/nginx.conf")
+	require.NoError(t, err)
+	require.Contains(t, string(data), "${{WORKERS}}")
+
+	local.Substitutions = map[string]string{"WORKERS": "${{lock.digest}}"}
+	_, err = copyLocalFiles(ctx, fsys, []string{dir}, []types.LocalFile{local}, builtins)
+	require.ErrorContains(t, err, "substitution WORKERS of local file nginx.conf: undefined variables: lock.digest")
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+)
+
+// TestLocalRepository checks that the packages melange leaves in a directory
+// are used without indexing them or adding their key to the keyring.
+func TestLocalRepository(t *testing.T) {
+	copyFile := func(t *testing.T, src, dst string) {
+		t.Helper()
+		b, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, b, 0o644))
+	}
+	// melangeOutput lays out packages as melange build writes them, with
+	// the key it signed the index with next to the packages directory.
+	melangeOutput := func(t *testing.T, index, key bool) string {
+		t.Helper()
+		dir := t.TempDir()
+		arch := filepath.Join(dir, "packages", "x86_64")
+		require.NoError(t, os.MkdirAll(arch, 0o755))
+		apks, err := filepath.Glob("testdata/packages/x86_64/*.apk")
+		require.NoError(t, err)
+		for _, p := range apks {
+			copyFile(t, p, filepath.Join(arch, filepath.Base(p)))
+			require.NoError(t, os.Chtimes(filepath.Join(arch, filepath.Base(p)), time.Now(), time.Now().Add(-time.Hour)))
+		}
+		if index {
+			copyFile(t, "testdata/packages/x86_64/APKINDEX.tar.gz", filepath.Join(arch, "APKINDEX.tar.gz"))
+		}
+		if key {
+			copyFile(t, "testdata/melange.rsa.pub", filepath.Join(dir, "melange.rsa.pub"))
+		}
+		return filepath.Join(dir, "packages")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		index, key bool
+		synthesize bool
+		wantErr    string
+	}{
+		{name: "synthesized index", synthesize: true},
+		{name: "no index", wantErr: "replayout"},
+		{name: "signed index with key", index: true, key: true},
+		{name: "signed index without key", index: true, wantErr: "no keys provided"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := t.Context()
+			repo := melangeOutput(t, tc.index, tc.key)
+			bc, err := build.New(ctx, fs.NewMemFS(),
+				build.WithImageConfiguration(types.ImageConfiguration{
+					Contents: types.ImageContents{
+						BuildRepositories: []string{repo},
+						Packages:          []string{"replayout"},
+					},
+				}),
+				build.WithArch(types.ParseArchitecture("x86_64")),
+				build.WithLocalIndexSynthesis(tc.synthesize),
+			)
+			require.NoError(t, err)
+
+			pkgs, _, err := bc.BuildPackageList(ctx)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, p := range pkgs {
+				names = append(names, p.Name)
+			}
+			require.Contains(t, names, "replayout")
+		})
+	}
+}
+
+func TestDefaultArchs(t *testing.T) {
+	repo := t.TempDir()
+	o := &options.Options{ExtraBuildRepos: []string{"https://packages.wolfi.dev/os"}}
+	ic := &types.ImageConfiguration{Contents: types.ImageContents{RuntimeRepositories: []string{"@local " + repo}}}
+	require.Equal(t, types.AllArchs, build.DefaultArchs(o, ic))
+
+	// Only the architectures melange built packages for.
+	for _, arch := range []string{"aarch64", "x86_64"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(repo, arch), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "aarch64", "hello-1.0-r0.apk"), nil, 0o644))
+	require.Equal(t, []types.Architecture{types.ParseArchitecture("arm64")}, build.DefaultArchs(o, ic))
+}
@@ -44,7 +44,7 @@ func LockImageConfiguration(ctx context.Context, ic types.ImageConfiguration, op
 	input.Contents.RuntimeRepositories = sets.List(sets.New(input.Contents.RuntimeRepositories...).Insert(o.ExtraRuntimeRepos...))
 	input.Contents.Keyring = sets.List(sets.New(input.Contents.Keyring...).Insert(o.ExtraKeyFiles...))
 
-	mc, err := NewMultiArch(ctx, input.Archs, append(opts, WithImageConfiguration(*input))...)
+	mc, err := NewMultiArch(ctx, input.Archs, append(opts, WithImageConfiguration(*input), WithConfigDigest(o.ConfigDigest))...)
 	if err != nil {
 		return nil, nil, err
 	}
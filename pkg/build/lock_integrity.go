@@ -0,0 +1,236 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// RepositoryIndexes returns the indexes of the repositories the packages are
+// resolved from.
+func (bc *Context) RepositoryIndexes(ctx context.Context) ([]apk.NamedIndex, error) {
+	// The signatures ignored by the options are ignored per repository.
+	return bc.apk.GetRepositoryIndexes(ctx, false)
+}
+
+// RepositoryIndexesFor returns the indexes of arch of the repositories the
+// packages are resolved from, without a build for arch.
+func (bc *Context) RepositoryIndexesFor(ctx context.Context, arch types.Architecture) ([]apk.NamedIndex, error) {
+	return bc.apk.GetRepositoryIndexesForArch(ctx, arch.ToAPK(), false)
+}
+
+// IndexSignatureVerifications returns how the signature of each repository
+// index fetched so far was verified, or why it was not, by the URL of the
+// index.
+func (bc *Context) IndexSignatureVerifications() map[string]apk.Verification {
+	return bc.apk.IndexSignatureVerifications()
+}
+
+// Keyring returns the keys which the repository indexes are verified with, by
+// their name.
+func (bc *Context) Keyring() (map[string][]byte, error) {
+	return bc.apk.GetKeys()
+}
+
+// lockDeviations collects the ways in which a build deviates from its
+// lockfile.
+type lockDeviations struct {
+	strict     bool
+	deviations []string
+}
+
+func (d *lockDeviations) add(format string, args ...any) {
+	d.deviations = append(d.deviations, fmt.Sprintf(format, args...))
+}
+
+// addStrict adds a deviation which is only an error in a locked build, and
+// otherwise logs it.
+func (d *lockDeviations) addStrict(ctx context.Context, format string, args ...any) {
+	if d.strict {
+		d.add(format, args...)
+	} else {
+		clog.FromContext(ctx).Warnf(format, args...)
+	}
+}
+
+func (d *lockDeviations) err() error {
+	if len(d.deviations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the build deviates from the lockfile:\n  - %s", strings.Join(d.deviations, "\n  - "))
+}
+
+// verifyLockIntegrity checks that the keyring, the repositories and their
+// indexes are those recorded in a lockfile, for the parts of it which have
+// checksums (lock version v2 and later).
+//
+// An index which changed since the lockfile was generated is only an error
+// if a locked package in it changed too: repositories are updated all the
+// time, but a locked package should never be different. In a locked build,
+// any change is an error, as is anything the lockfile has no checksum for,
+// and in a frozen build so is a package which is not in the cache.
+func (bc *Context) verifyLockIntegrity(ctx context.Context, l lock.Lock, pkgs []apk.InstallablePackage) error {
+	d := &lockDeviations{strict: bc.o.Locked}
+
+	// VerifyLockfileConsistency already warns about this otherwise.
+	if l.Config == nil && d.strict {
+		d.add("the lockfile does not contain the checksum of the configuration")
+	}
+	if err := bc.verifyLockedKeyring(ctx, d, l.Contents.Keyrings); err != nil {
+		return err
+	}
+	if err := bc.verifyLockedRepositories(ctx, d, l); err != nil {
+		return err
+	}
+	if bc.o.Frozen {
+		for _, pkg := range pkgs {
+			if !bc.apk.IsCached(pkg) {
+				d.add("package %s is not in the cache", pkg.URL())
+			}
+		}
+	}
+	return d.err()
+}
+
+// verifyLockedKeyring checks that the keyring holds exactly the locked keys.
+func (bc *Context) verifyLockedKeyring(ctx context.Context, d *lockDeviations, keyrings []lock.LockKeyring) error {
+	locked := map[string]string{}
+	for _, k := range keyrings {
+		if k.Checksum != "" {
+			locked[k.ID] = k.Checksum
+		} else if !strings.HasPrefix(k.URL, apk.OCIKeyringScheme) {
+			// The keys of an OCI artifact are locked by their own names.
+			d.addStrict(ctx, "the lockfile has no checksum for key %s", k.Name)
+		}
+	}
+	if len(locked) == 0 {
+		return nil
+	}
+
+	keys, err := bc.Keyring()
+	if err != nil {
+		return err
+	}
+	for _, id := range slices.Sorted(maps.Keys(keys)) {
+		want, ok := locked[id]
+		if !ok {
+			d.add("key %s is not in the lockfile", id)
+			continue
+		}
+		sum := sha256.Sum256(keys[id])
+		if got := lock.SHA256Checksum(sum[:]); got != want {
+			d.add("key %s has checksum %s, but the lockfile has %s", id, got, want)
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(locked)) {
+		if _, ok := keys[id]; !ok {
+			d.add("key %s from the lockfile is not in the keyring", id)
+		}
+	}
+	return nil
+}
+
+// verifyLockedRepositories checks that the repositories are those in the
+// lockfile, and that their indexes still match it.
+func (bc *Context) verifyLockedRepositories(ctx context.Context, d *lockDeviations, l lock.Lock) error {
+	arch := bc.Arch()
+	locked := map[string]lock.LockRepo{}
+	for _, r := range slices.Concat(l.Contents.BuildRepositories, l.Contents.RuntimeRepositories) {
+		if types.ParseArchitecture(r.Architecture) != arch {
+			continue
+		}
+		if r.Checksum != "" {
+			locked[r.URL] = r
+		} else {
+			d.addStrict(ctx, "the lockfile has no checksum for index %s", r.URL)
+		}
+	}
+	if len(locked) == 0 {
+		return nil
+	}
+
+	repos, err := bc.apk.GetRepositories()
+	if err != nil {
+		return err
+	}
+	var current []string
+	for _, repo := range repos {
+		if bc.baseimg != nil && repo == bc.baseimg.APKIndexPath() {
+			continue
+		}
+		// Drop the label of pinned repositories, as the lockfile does.
+		fields := strings.Fields(repo)
+		current = append(current, apk.IndexURL(fields[len(fields)-1], arch.ToAPK()))
+	}
+	slices.Sort(current)
+	if want := slices.Sorted(maps.Keys(locked)); !slices.Equal(current, want) {
+		d.add("repositories %v do not match the repositories %v in the lockfile", current, want)
+		return nil
+	}
+
+	indexes, err := bc.RepositoryIndexes(ctx)
+	if err != nil {
+		if bc.o.Frozen {
+			d.add("unable to read the indexes from the cache: %v", err)
+			return nil
+		}
+		return fmt.Errorf("getting repository indexes: %w", err)
+	}
+	for _, idx := range indexes {
+		r, ok := locked[idx.Source()]
+		if !ok || lock.SHA256Checksum(apk.IndexChecksum(idx)) == r.Checksum {
+			continue
+		}
+		before := len(d.deviations)
+		verifyLockedPackages(ctx, d, idx, l.Contents.Packages)
+		if len(d.deviations) == before {
+			d.addStrict(ctx, "index %s changed since the lockfile was generated, but the locked packages in it did not", idx.Source())
+		}
+	}
+	return nil
+}
+
+// verifyLockedPackages checks that the locked packages which were resolved
+// from idx are still in it with the same checksum.
+func verifyLockedPackages(ctx context.Context, d *lockDeviations, idx apk.NamedIndex, pkgs []lock.LockPkg) {
+	dir := strings.TrimSuffix(idx.Source(), "APKINDEX.tar.gz")
+	checksums := map[string]string{}
+	for _, p := range idx.Packages() {
+		checksums[p.URL()] = p.ChecksumString()
+	}
+	for _, p := range pkgs {
+		if !strings.HasPrefix(p.URL, dir) {
+			continue
+		}
+		got, ok := checksums[p.URL]
+		switch {
+		case !ok:
+			d.addStrict(ctx, "package %s-%s is no longer in index %s", p.Name, p.Version, idx.Source())
+		case got != p.Checksum:
+			d.add("index %s does not match the lockfile: package %s-%s has checksum %s, but the lockfile has %s", idx.Source(), p.Name, p.Version, got, p.Checksum)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"chainguard.dev/apko/internal/promutil"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// metrics are the Prometheus metrics of a build. A nil *metrics records
+// nothing.
+type metrics struct {
+	phaseDuration *prometheus.HistogramVec
+}
+
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	if reg == nil {
+		return nil, nil
+	}
+	phaseDuration, err := promutil.Register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "apko",
+		Subsystem: "build",
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of the phases of builds: init, install, layers and sbom.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+	}, []string{"arch", "phase"}))
+	if err != nil {
+		return nil, err
+	}
+	return &metrics{phaseDuration: phaseDuration}, nil
+}
+
+// observe records the duration of the phase, which started at start, as in
+//
+//	defer bc.metrics.observe(bc.Arch(), "sbom", time.Now())
+func (m *metrics) observe(arch types.Architecture, phase string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.phaseDuration.WithLabelValues(arch.ToAPK(), phase).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,50 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestMetricsRegistry(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+
+	for _, arch := range []string{"x86_64", "aarch64"} {
+		bc, err := build.New(ctx, fs.NewMemFS(),
+			build.WithConfig("apko.yaml", []string{"testdata"}),
+			build.WithArch(types.ParseArchitecture(arch)),
+			build.WithMetricsRegistry(reg),
+		)
+		require.NoError(t, err)
+		_, err = bc.BuildLayers(ctx)
+		require.NoError(t, err)
+	}
+
+	// init, install and layers for each architecture.
+	require.Equal(t, 6, testutil.CollectAndCount(reg, "apko_build_phase_duration_seconds"))
+	// The apk metrics are registered too. The packages may have been expanded
+	// by other tests already, so they don't necessarily have samples.
+	require.Error(t, reg.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "apko_apk_packages_fetched_total", Help: "Packages fetched."})))
+}
@@ -139,3 +139,43 @@ func (m *MultiArch) BuildPackageLists(ctx context.Context) (map[types.Architectu
 
 	return toInstalls, errors.Join(errs...)
 }
+
+// Plans returns the Plan of each architecture.
+func (m *MultiArch) Plans(ctx context.Context) (map[types.Architecture]*Plan, error) {
+	var (
+		g  errgroup.Group
+		mu sync.Mutex
+	)
+	plans := map[types.Architecture]*Plan{}
+	errs := []error{}
+	for arch, bc := range m.Contexts {
+		g.Go(func() error {
+			plan, err := bc.Plan(ctx)
+			if err == nil {
+				err = bc.CheckPolicies(ctx, plan)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("for arch %q: %w", arch, err))
+				return nil
+			}
+
+			plans[arch] = plan
+
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("planning build: %w", err)
+	}
+
+	return plans, nil
+}
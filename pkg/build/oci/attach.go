@@ -0,0 +1,58 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// AttachReferrer publishes data as an OCI artifact of type artifactType which
+// refers to subject, in the repository of subject. Registries which do not
+// support the referrers API list it under the fallback tag of subject.
+func AttachReferrer(ctx context.Context, subject name.Digest, desc v1.Descriptor, artifactType ggcrtypes.MediaType, data []byte, remoteOpts ...remote.Option) (name.Digest, error) {
+	log := clog.FromContext(ctx)
+
+	img, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer: static.NewLayer(data, artifactType),
+	})
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("building %s artifact: %w", artifactType, err)
+	}
+	img = mutate.MediaType(img, ggcrtypes.OCIManifestSchema1)
+	// Registries report the config media type as the artifact type.
+	img = mutate.ConfigMediaType(img, artifactType)
+	img = mutate.Subject(img, desc).(v1.Image)
+
+	h, err := img.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	ref := subject.Context().Digest(h.String())
+	log.Infof("attaching %s to %s as %s", artifactType, subject, ref)
+	if err := remote.Write(ref, img, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("writing %s artifact: %w", artifactType, err)
+	}
+	return ref, nil
+}
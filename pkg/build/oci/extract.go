@@ -0,0 +1,189 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"cmp"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/sys/unix"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// Extract writes the flattened filesystem of an image to fsys, e.g. a
+// directory with apkfs.DirFS, with the modes, owners and times of its
+// entries. Whiteouts and opaque markers are applied as in WalkFiles.
+func Extract(img v1.Image, fsys apkfs.FullFS) error {
+	var links, dirs []*tar.Header
+	if err := WalkFiles(img, func(p string, hdr *tar.Header, r io.Reader) error {
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			// directories are finished last, when their contents are written
+			dirs = append(dirs, hdr)
+			return fsys.MkdirAll(p, 0o755)
+		case tar.TypeLink:
+			// the target may be in a layer below, so not extracted yet
+			links = append(links, hdr)
+			return nil
+		}
+
+		if err := fsys.MkdirAll(path.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if _, err := fsys.Lstat(p); err == nil {
+			// a directory of a layer above, implied by its contents
+			return nil
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			f, err := fsys.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, r); err != nil {
+				f.Close()
+				return fmt.Errorf("writing %s: %w", p, err)
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := fsys.Symlink(hdr.Linkname, p); err != nil {
+				return err
+			}
+			return nil
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			if err := fsys.Mknod(p, nodeMode(hdr), int(unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor)))); err != nil { //nolint:gosec
+				return err
+			}
+		default:
+			return nil
+		}
+		return finish(fsys, hdr)
+	}); err != nil {
+		return err
+	}
+
+	// WalkFiles hides the entries beneath a symlink, but not a hard link
+	// whose directory is a symlink extracted after the walk reached it
+	for _, hdr := range links {
+		target := strings.TrimPrefix(path.Clean("/"+hdr.Linkname), "/")
+		for _, p := range []string{hdr.Name, target} {
+			if err := beneathSymlink(fsys, p); err != nil {
+				return err
+			}
+		}
+		if err := fsys.MkdirAll(path.Dir(hdr.Name), 0o755); err != nil {
+			return err
+		}
+		if err := fsys.Link(target, hdr.Name); err != nil {
+			return fmt.Errorf("linking %s to %s: %w", hdr.Name, hdr.Linkname, err)
+		}
+	}
+
+	// the deepest first, so that writing to a directory can't change the
+	// time of its parent afterwards
+	slices.SortFunc(dirs, func(a, b *tar.Header) int {
+		return cmp.Compare(strings.Count(b.Name, "/"), strings.Count(a.Name, "/"))
+	})
+	for _, hdr := range dirs {
+		if err := finish(fsys, hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractTar writes the flattened filesystem of an image to w as a tarball.
+// Hard links come last, after the files they link to.
+func ExtractTar(img v1.Image, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	var links []*tar.Header
+	if err := WalkFiles(img, func(_ string, hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag == tar.TypeLink {
+			links = append(links, hdr)
+			return nil
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(tw, r); err != nil {
+				return fmt.Errorf("writing %s: %w", hdr.Name, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, hdr := range links {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// beneathSymlink returns an error when a parent directory of p is a symlink,
+// which could lead outside of fsys.
+func beneathSymlink(fsys apkfs.FullFS, p string) error {
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		// Lstat of a symlink dangling in fsys fails, so ask Readlink
+		if _, err := fsys.Readlink(dir); err == nil {
+			return fmt.Errorf("%s is beneath the symlink %s", p, dir)
+		}
+	}
+	return nil
+}
+
+// finish sets the mode, owner and times of an extracted entry.
+func finish(fsys apkfs.FullFS, hdr *tar.Header) error {
+	if err := fsys.Chmod(hdr.Name, hdr.FileInfo().Mode()&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return err
+	}
+	if err := fsys.Chown(hdr.Name, hdr.Uid, hdr.Gid); err != nil {
+		return err
+	}
+	for name, value := range hdr.PAXRecords {
+		if attr, ok := strings.CutPrefix(name, "SCHILY.xattr."); ok {
+			if err := fsys.SetXattr(hdr.Name, attr, []byte(value)); err != nil {
+				return err
+			}
+		}
+	}
+	return fsys.Chtimes(hdr.Name, hdr.ModTime, hdr.ModTime)
+}
+
+// nodeMode returns the mode of a device or fifo entry, with its type bits.
+func nodeMode(hdr *tar.Header) uint32 {
+	perm := uint32(hdr.Mode) & 0o7777 //nolint:gosec
+	switch hdr.Typeflag {
+	case tar.TypeChar:
+		return unix.S_IFCHR | perm
+	case tar.TypeBlock:
+		return unix.S_IFBLK | perm
+	default:
+		return unix.S_IFIFO | perm
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// testImage returns an image of the layers, each a list of tar entries:
+// directories end in a slash, "name -> target" are symlinks, "name => target"
+// hard links, and the contents of other files are their names.
+func testImage(t *testing.T, layers ...[]string) v1.Image {
+	img := empty.Image
+	for _, entries := range layers {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, e := range entries {
+			hdr := &tar.Header{Typeflag: tar.TypeReg, Name: e, Mode: 0o644, Size: int64(len(e))}
+			if name, target, ok := bytes.Cut([]byte(e), []byte(" -> ")); ok {
+				hdr = &tar.Header{Typeflag: tar.TypeSymlink, Name: string(name), Linkname: string(target), Mode: 0o777}
+			} else if name, target, ok := bytes.Cut([]byte(e), []byte(" => ")); ok {
+				hdr = &tar.Header{Typeflag: tar.TypeLink, Name: string(name), Linkname: string(target), Mode: 0o644}
+			} else if e[len(e)-1] == '/' {
+				hdr = &tar.Header{Typeflag: tar.TypeDir, Name: e, Mode: 0o755}
+			}
+			require.NoError(t, tw.WriteHeader(hdr))
+			if hdr.Typeflag == tar.TypeReg {
+				_, err := tw.Write([]byte(e))
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, tw.Close())
+		b := buf.Bytes()
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		})
+		require.NoError(t, err)
+		img, err = mutate.AppendLayers(img, layer)
+		require.NoError(t, err)
+	}
+	return img
+}
+
+func walkedFiles(t *testing.T, img v1.Image) []string {
+	var got []string
+	require.NoError(t, WalkFiles(img, func(p string, _ *tar.Header, _ io.Reader) error {
+		got = append(got, p)
+		return nil
+	}))
+	return got
+}
+
+func TestWalkFiles(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		layers [][]string
+		want   []string
+	}{{
+		desc:   "upper layers first",
+		layers: [][]string{{"a/", "a/b"}, {"a/", "a/c"}},
+		want:   []string{"a", "a/c", "a/b"},
+	}, {
+		desc:   "whiteout",
+		layers: [][]string{{"a/", "a/b", "a/c/", "a/c/d"}, {"a/.wh.c"}},
+		want:   []string{"a", "a/b"},
+	}, {
+		desc:   "opaque",
+		layers: [][]string{{"a/", "a/b", "a/c/", "a/c/d", "e"}, {"a/", "a/.wh..wh..opq", "a/f"}},
+		want:   []string{"a", "a/f", "e"},
+	}, {
+		desc:   "opaque without the directory",
+		layers: [][]string{{"a/", "a/b"}, {"a/.wh..wh..opq"}},
+		want:   []string{"a"},
+	}, {
+		desc:   "file over directory",
+		layers: [][]string{{"a/", "a/b"}, {"./a"}},
+		want:   []string{"a"},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			require.Equal(t, tc.want, walkedFiles(t, testImage(t, tc.layers...)))
+		})
+	}
+}
+
+// TestFilesRuntime checks that the files of an image are those containerd
+// and runc extract from its layers, following the whiteout rules of the OCI
+// image layer specification.
+func TestFilesRuntime(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		layers [][]string
+		want   map[string]byte
+	}{{
+		desc:   "whiteout of a directory",
+		layers: [][]string{{"a/", "a/b/", "a/b/c", "a/d"}, {"a/.wh.b"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/d": tar.TypeReg},
+	}, {
+		desc:   "whiteout of a missing path",
+		layers: [][]string{{"a"}, {".wh.b"}},
+		want:   map[string]byte{"a": tar.TypeReg},
+	}, {
+		desc:   "whiteout before an entry of its layer",
+		layers: [][]string{{"a/", "a/b", "a/c"}, {"a/.wh.b", "a/b"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/b": tar.TypeReg, "a/c": tar.TypeReg},
+	}, {
+		desc:   "whiteout after an entry of its layer",
+		layers: [][]string{{"a/", "a/b/", "a/b/c"}, {"a/b", "a/.wh.b"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/b": tar.TypeReg},
+	}, {
+		desc:   "whiteout entries are not files",
+		layers: [][]string{{"a/"}, {"a/.wh.b", "a/.wh..wh..opq"}},
+		want:   map[string]byte{"a": tar.TypeDir},
+	}, {
+		desc:   "added again above a whiteout",
+		layers: [][]string{{"a/", "a/b", "a/c"}, {".wh.a"}, {"a/", "a/d"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/d": tar.TypeReg},
+	}, {
+		desc:   "opaque keeps the entries of its layer",
+		layers: [][]string{{"a/", "a/b", "a/c/", "a/c/d"}, {"a/", "a/e", "a/.wh..wh..opq", "a/c/"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/c": tar.TypeDir, "a/e": tar.TypeReg},
+	}, {
+		desc:   "opaque root",
+		layers: [][]string{{"a/", "a/b", "c"}, {".wh..wh..opq", "d"}},
+		want:   map[string]byte{"d": tar.TypeReg},
+	}, {
+		desc:   "directory over file",
+		layers: [][]string{{"a"}, {"a/", "a/b"}},
+		want:   map[string]byte{"a": tar.TypeDir, "a/b": tar.TypeReg},
+	}, {
+		desc:   "symlink over directory",
+		layers: [][]string{{"a/", "a/b"}, {"a -> c"}},
+		want:   map[string]byte{"a": tar.TypeSymlink},
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			files, err := Files(testImage(t, tc.layers...))
+			require.NoError(t, err)
+			got := map[string]byte{}
+			for p, hdr := range files {
+				got[p] = hdr.Typeflag
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	img := testImage(t,
+		[]string{"bin/", "bin/busybox", "etc/", "etc/passwd", "etc/apk/", "etc/apk/world", "usr/", "usr/lib/", "usr/lib/libc.so"},
+		[]string{"bin/", "bin/sh -> busybox", "bin/ls => bin/busybox", "etc/.wh.apk", "usr/lib/", "usr/lib/.wh..wh..opq", "usr/lib/libz.so"},
+	)
+
+	// into a filesystem
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, Extract(img, fsys))
+
+	b, err := fsys.ReadFile("bin/ls")
+	require.NoError(t, err)
+	require.Equal(t, "bin/busybox", string(b))
+	target, err := fsys.Readlink("bin/sh")
+	require.NoError(t, err)
+	require.Equal(t, "busybox", target)
+	fi, err := fsys.Stat("usr/lib")
+	require.NoError(t, err)
+	require.Equal(t, "drwxr-xr-x", fi.Mode().String())
+	for _, p := range []string{"etc/apk", "usr/lib/libc.so"} {
+		_, err := fsys.Lstat(p)
+		require.Error(t, err, p)
+	}
+	_, err = fsys.Stat("usr/lib/libz.so")
+	require.NoError(t, err)
+
+	// as a tarball, with the hard link after its target
+	var buf bytes.Buffer
+	require.NoError(t, ExtractTar(img, &buf))
+	var got []string
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, hdr.Name)
+	}
+	require.Equal(t, []string{"bin", "bin/sh", "usr/lib", "usr/lib/libz.so", "bin/busybox", "etc", "etc/passwd", "usr", "bin/ls"}, got)
+}
+
+func TestExtractBeneathSymlink(t *testing.T) {
+	outside := t.TempDir()
+
+	// the entries beneath a symlink of the same layer are hidden by it
+	img := testImage(t, []string{"lib -> " + outside, "lib/passwd"})
+	require.NoError(t, Extract(img, apkfs.DirFS(context.Background(), t.TempDir())))
+	_, err := os.Stat(filepath.Join(outside, "passwd"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// a hard link is only made once the symlink of a layer below is there
+	img = testImage(t, []string{"etc/", "etc/passwd", "lib -> " + outside}, []string{"lib/passwd => etc/passwd"})
+	require.ErrorContains(t, Extract(img, apkfs.DirFS(context.Background(), t.TempDir())), "lib/passwd is beneath the symlink lib")
+	_, err = os.Stat(filepath.Join(outside, "passwd"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -52,9 +52,11 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 
 	comment := "This is an apko single-layer image"
 	if len(layers) > 1 {
-		// TODO: Consider plumbing per-layer info here?
 		comment = ""
 	}
+	if ic.History != nil && ic.History.Comment != "" {
+		comment = ic.History.Comment
+	}
 
 	adds := make([]mutate.Addendum, 0, len(layers))
 	for _, layer := range layers {
@@ -71,12 +73,20 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 		log.Infof("layer digest: %v", digest)
 		log.Infof("layer diffID: %v", diffid)
 
+		// layers built by apko describe how they were built
+		createdBy := "apko"
+		if l, ok := layer.(interface {
+			CreatedBy() string
+		}); ok {
+			createdBy = l.CreatedBy()
+		}
+
 		adds = append(adds, mutate.Addendum{
 			Layer: layer,
 			History: v1.History{
 				Author:    "apko",
 				Comment:   comment,
-				CreatedBy: "apko",
+				CreatedBy: createdBy,
 				Created:   v1.Time{Time: created}, // TODO: Consider per-layer creation time?
 			},
 		})
@@ -112,9 +122,11 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 
 	cfg = cfg.DeepCopy()
 	cfg.Author = "github.com/chainguard-dev/apko"
-	platform := arch.ToOCIPlatform()
+	platform := oic.OCIPlatform(arch)
 	cfg.Architecture = platform.Architecture
 	cfg.Variant = platform.Variant
+	cfg.OSVersion = platform.OSVersion
+	cfg.OSFeatures = platform.OSFeatures
 	cfg.Created = v1.Time{Time: created}
 	cfg.Config.Labels = make(map[string]string)
 	cfg.OS = "linux"
@@ -169,3 +169,59 @@ func TestBuildImageFromLayer(t *testing.T) {
 		})
 	}
 }
+
+type createdByLayer struct {
+	v1.Layer
+	createdBy string
+}
+
+func (l createdByLayer) CreatedBy() string { return l.createdBy }
+
+func TestBuildImageHistory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	layers := []v1.Layer{
+		createdByLayer{static.NewLayer([]byte("busybox"), ggcrtypes.OCILayer), "apko: install busybox=1.36.1-r0"},
+		createdByLayer{static.NewLayer([]byte("config"), ggcrtypes.OCILayer), "apko: configure the image"},
+		static.NewLayer([]byte("other"), ggcrtypes.OCILayer),
+	}
+
+	for _, c := range []struct {
+		desc    string
+		cfg     types.ImageConfiguration
+		comment string
+	}{{
+		desc: "no comment",
+	}, {
+		desc:    "comment",
+		cfg:     types.ImageConfiguration{History: &types.ImageHistory{Comment: "built for TICKET-123"}},
+		comment: "built for TICKET-123",
+	}} {
+		t.Run(c.desc, func(t *testing.T) {
+			img, err := BuildImageFromLayers(ctx, empty.Image, layers, c.cfg, now, types.ParseArchitecture("amd64"))
+			require.NoError(t, err)
+			cfg, err := img.ConfigFile()
+			require.NoError(t, err)
+
+			want := []v1.History{{
+				Created:   v1.Time{Time: now},
+				Author:    "apko",
+				CreatedBy: "apko: install busybox=1.36.1-r0",
+				Comment:   c.comment,
+			}, {
+				Created:   v1.Time{Time: now},
+				Author:    "apko",
+				CreatedBy: "apko: configure the image",
+				Comment:   c.comment,
+			}, {
+				Created:   v1.Time{Time: now},
+				Author:    "apko",
+				CreatedBy: "apko",
+				Comment:   c.comment,
+			}}
+			if d := cmp.Diff(want, cfg.History); d != "" {
+				t.Errorf("History mismatch (-want +got):\n%s", d) //nolint:forbidigo
+			}
+		})
+	}
+}
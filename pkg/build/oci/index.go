@@ -104,7 +104,7 @@ func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageCon
 				MediaType: mt,
 				Digest:    h,
 				Size:      size,
-				Platform:  arch.ToOCIPlatform(),
+				Platform:  ic.OCIPlatform(arch),
 			},
 		})
 	}
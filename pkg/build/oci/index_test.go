@@ -14,10 +14,65 @@
 
 package oci
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
 
 func TestGenerateIndex(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	ic := types.ImageConfiguration{
+		Platform: &types.ImagePlatform{
+			OSVersion:  "1.0",
+			OSFeatures: []string{"feature"},
+			Variants:   map[string]string{"aarch64": "v8"},
+		},
+	}
+
+	layer := static.NewLayer([]byte("hello"), ggcrtypes.OCILayer)
+	imgs := map[types.Architecture]v1.Image{}
+	for _, a := range []string{"arm64", "arm/v7", "amd64"} {
+		arch := types.ParseArchitecture(a)
+		img, err := BuildImageFromLayer(ctx, empty.Image, layer, ic, now, arch)
+		require.NoError(t, err)
+		imgs[arch] = img
+	}
+	_, idx, err := GenerateIndex(ctx, ic, imgs, now)
+	require.NoError(t, err)
+
+	m, err := idx.IndexManifest()
+	require.NoError(t, err)
+	got := map[string]v1.Platform{}
+	for _, desc := range m.Manifests {
+		require.NotNil(t, desc.Platform)
+		got[desc.Platform.Architecture] = *desc.Platform
 
+		// The configuration of each image has the same platform as its
+		// entry in the index.
+		img, err := idx.Image(desc.Digest)
+		require.NoError(t, err)
+		cf, err := img.ConfigFile()
+		require.NoError(t, err)
+		require.Equal(t, desc.Platform, cf.Platform())
+	}
+	want := func(arch, variant string) v1.Platform {
+		return v1.Platform{OS: "linux", Architecture: arch, Variant: variant, OSVersion: "1.0", OSFeatures: []string{"feature"}}
+	}
+	require.Equal(t, map[string]v1.Platform{
+		"arm64": want("arm64", "v8"),
+		"arm":   want("arm", "v7"),
+		"amd64": want("amd64", ""),
+	}, got)
 }
 
 func TestGenerateDockerIndex(t *testing.T) {
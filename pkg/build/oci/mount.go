@@ -0,0 +1,134 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// PublishedBlobs records a repository each layer was published to, by
+// registry and digest, to mount the layer from there when it is published to
+// another repository of the same registry. Its zero value is ready to use,
+// and it may be shared by concurrent publishes.
+type PublishedBlobs struct {
+	repos sync.Map
+}
+
+func blobKey(reg name.Registry, h v1.Hash) string {
+	return reg.RegistryStr() + "@" + h.String()
+}
+
+// record records the layers of img, published to repo.
+func (p *PublishedBlobs) record(repo name.Repository, img v1.Image) error {
+	if p == nil {
+		return nil
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		p.repos.Store(blobKey(repo.Registry, h), repo)
+	}
+	return nil
+}
+
+// lookup returns the repository of the registry reg the layer h was
+// published to, if any.
+func (p *PublishedBlobs) lookup(reg name.Registry, h v1.Hash) (name.Repository, bool) {
+	if p == nil {
+		return name.Repository{}, false
+	}
+	v, ok := p.repos.Load(blobKey(reg, h))
+	if !ok {
+		return name.Repository{}, false
+	}
+	return v.(name.Repository), true
+}
+
+// mountSource returns the repository to mount the layer h from when
+// publishing it to repo: one it was published to, according to published,
+// else the first of from in the registry of repo. The registry uploads the
+// layer anyway if it is not there.
+func mountSource(repo name.Repository, h v1.Hash, published *PublishedBlobs, from []name.Repository) (name.Repository, bool) {
+	if src, ok := published.lookup(repo.Registry, h); ok {
+		return src, src.Name() != repo.Name()
+	}
+	for _, src := range from {
+		if src.RegistryStr() == repo.RegistryStr() && src.Name() != repo.Name() {
+			return src, true
+		}
+	}
+	return name.Repository{}, false
+}
+
+// mountingImage is an image whose layers are mounted from other
+// repositories of the registry it is published to, when they have a source.
+type mountingImage struct {
+	v1.Image
+	layers []v1.Layer
+}
+
+// mountLayers returns img, publishing to repo, with the layers which have a
+// mount source mounted from it, and the layers without a source, which are
+// uploaded.
+func mountLayers(img v1.Image, repo name.Repository, published *PublishedBlobs, from []name.Repository) (v1.Image, []v1.Layer, error) {
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading layers: %w", err)
+	}
+	mounted := make([]v1.Layer, 0, len(layers))
+	var uploaded []v1.Layer
+	for _, l := range layers {
+		h, err := l.Digest()
+		if err != nil {
+			return nil, nil, fmt.Errorf("computing layer digest: %w", err)
+		}
+		src, ok := mountSource(repo, h, published, from)
+		if !ok {
+			mounted = append(mounted, l)
+			uploaded = append(uploaded, l)
+			continue
+		}
+		mounted = append(mounted, &remote.MountableLayer{Layer: l, Reference: src.Digest(h.String())})
+	}
+	return &mountingImage{Image: img, layers: mounted}, uploaded, nil
+}
+
+func (i *mountingImage) Layers() ([]v1.Layer, error) {
+	return i.layers, nil
+}
+
+func (i *mountingImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	for _, l := range i.layers {
+		lh, err := l.Digest()
+		if err != nil {
+			return nil, err
+		}
+		if lh == h {
+			return l, nil
+		}
+	}
+	return i.Image.LayerByDigest(h)
+}
@@ -0,0 +1,89 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishImagesFromIndexMounts(t *testing.T) {
+	// The registry keeps the blobs of all the repositories together, so
+	// it says those publishing to b, d and e are missing from them.
+	reg := registry.New()
+	var mounts atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("mount") != "" {
+			mounts.Add(1)
+		}
+		if r.Method == http.MethodHead && (strings.HasPrefix(r.URL.Path, "/v2/test/b/blobs/") || strings.HasPrefix(r.URL.Path, "/v2/test/d/blobs/") || strings.HasPrefix(r.URL.Path, "/v2/test/e/blobs/")) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	host := strings.TrimPrefix(s.URL, "http://")
+
+	idx, err := random.Index(1024, 2, 2)
+	require.NoError(t, err)
+
+	// The layers published by this process are mounted in other
+	// repositories of the registry.
+	published := &PublishedBlobs{}
+	a, err := name.NewRepository(host + "/test/a")
+	require.NoError(t, err)
+	_, err = PublishImagesFromIndex(t.Context(), idx, a, BlobOptions{Published: published})
+	require.NoError(t, err)
+	require.Zero(t, mounts.Load())
+
+	// Publishes which don't share what was published don't mount it.
+	e, err := name.NewRepository(host + "/test/e")
+	require.NoError(t, err)
+	_, err = PublishImagesFromIndex(t.Context(), idx, e, BlobOptions{})
+	require.NoError(t, err)
+	require.Zero(t, mounts.Load())
+
+	b, err := name.NewRepository(host + "/test/b")
+	require.NoError(t, err)
+	_, err = PublishImagesFromIndex(t.Context(), idx, b, BlobOptions{Published: published})
+	require.NoError(t, err)
+	require.Equal(t, int32(4), mounts.Load())
+
+	// So are the layers of the repositories of MountFrom.
+	img, err := random.Image(1024, 2)
+	require.NoError(t, err)
+	c, err := name.NewRepository(host + "/test/c")
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(c.Tag("latest"), img))
+
+	mounts.Store(0)
+	d, err := name.NewRepository(host + "/test/d")
+	require.NoError(t, err)
+	other, err := random.Index(1024, 2, 1)
+	require.NoError(t, err)
+	_, err = PublishImagesFromIndex(t.Context(), other, d, BlobOptions{Published: published, MountFrom: []name.Repository{c}})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), mounts.Load())
+}
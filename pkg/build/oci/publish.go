@@ -107,6 +107,24 @@ func PublishIndex(ctx context.Context, idx v1.ImageIndex, tags []string, remoteO
 	return dig, nil
 }
 
+// PublishIndexByDigest publishes idx to repo by digest only, without tagging
+// it; the images of idx must have been published to repo already.
+func PublishIndexByDigest(ctx context.Context, idx v1.ImageIndex, repo name.Repository, remoteOpts ...remote.Option) (name.Digest, error) {
+	log := clog.FromContext(ctx)
+
+	h, err := idx.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+	dig := repo.Digest(h.String())
+
+	log.Infof("publishing index %v", dig)
+	if err := remote.WriteIndex(dig, idx, remoteOpts...); err != nil {
+		return name.Digest{}, fmt.Errorf("failed to publish: %w", err)
+	}
+	return dig, nil
+}
+
 // If attempting to save locally, pick the native architecture
 // and use that cached image for local tags
 // Ported from https://github.com/ko-build/ko/blob/main/pkg/publish/daemon.go#L92-L168
@@ -146,10 +164,28 @@ func LoadIndex(ctx context.Context, idx v1.ImageIndex, tags []string) (name.Refe
 	return LoadImage(ctx, img, tags)
 }
 
+// BlobOptions configures how PublishImagesFromIndex publishes the layers of
+// the images.
+type BlobOptions struct {
+	// Published records the repositories the layers were published to, to
+	// mount them from there when they are published to another repository
+	// of the same registry. Share it between the publishes of images with
+	// the same layers; when nil, the layers are only mounted from MountFrom.
+	Published *PublishedBlobs
+	// MountFrom are repositories to mount the layers from, when they are
+	// in the same registry, besides those of Published. The registry
+	// uploads the layers it doesn't have anyway.
+	MountFrom []name.Repository
+	// Chunked, when set, uploads the layers which are not mounted in chunks,
+	// resuming interrupted uploads.
+	Chunked *ChunkedUploader
+}
+
 // PublishImagesFromIndex publishes all images from an index to a remote registry.
 // The only difference between this and PublishIndex is that PublishIndex pushes out all blobs and referenced manifests
 // from within the index. This adds pushing the referenced Image artifacts along with appropriate tags.
-func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Repository, remoteOpts ...remote.Option) ([]name.Digest, error) {
+// Layers blobs.Published records in another repository of the registry are mounted from there.
+func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Repository, blobs BlobOptions, remoteOpts ...remote.Option) ([]name.Digest, error) {
 	_, span := otel.Tracer("apko").Start(ctx, "PublishImagesFromIndex")
 	defer span.End()
 
@@ -173,7 +209,22 @@ func PublishImagesFromIndex(ctx context.Context, idx v1.ImageIndex, repo name.Re
 				return fmt.Errorf("failed to get image for %v from index: %w", m, err)
 			}
 
-			return remote.Write(dig, img, remoteOpts...)
+			img, upload, err := mountLayers(img, repo, blobs.Published, blobs.MountFrom)
+			if err != nil {
+				return fmt.Errorf("failed to mount layers of %v: %w", m.Digest, err)
+			}
+			if blobs.Chunked != nil {
+				for _, l := range upload {
+					if err := blobs.Chunked.Upload(ctx, repo, l); err != nil {
+						return err
+					}
+				}
+			}
+
+			if err := remote.Write(dig, img, remoteOpts...); err != nil {
+				return err
+			}
+			return blobs.Published.record(repo, img)
 		})
 	}
 	if err := g.Wait(); err != nil {
@@ -0,0 +1,300 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// installedPaths are the locations of the installed database, newest first.
+var installedPaths = []string{"usr/lib/apk/db/installed", "lib/apk/db/installed"}
+
+// ReadImage returns the image for an architecture from src, which may be a
+// directory containing an OCI layout, an image tarball (e.g. produced by
+// apko build or docker save) or an image reference.
+func ReadImage(ctx context.Context, src string, arch types.Architecture, opts ...remote.Option) (v1.Image, error) {
+	if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+		idx, err := layout.ImageIndexFromPath(src)
+		if err != nil {
+			return nil, fmt.Errorf("reading OCI layout %s: %w", src, err)
+		}
+		img, err := ImageForArch(idx, arch)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", src, err)
+		}
+		return img, nil
+	} else if err == nil {
+		img, err := tarballForArch(src, arch)
+		if err != nil {
+			return nil, fmt.Errorf("reading image tarball %s: %w", src, err)
+		}
+		return img, nil
+	}
+
+	ref, err := name.ParseReference(src)
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %s: %w", src, err)
+	}
+	img, err := remote.Image(ref, append([]remote.Option{
+		remote.WithContext(ctx),
+		remote.WithPlatform(*arch.ToOCIPlatform()),
+	}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", src, err)
+	}
+	return img, nil
+}
+
+// ImageForArch returns the image for an architecture from an index,
+// descending into nested indexes.
+func ImageForArch(idx v1.ImageIndex, arch types.Architecture) (v1.Image, error) {
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	want := arch.ToOCIPlatform()
+	for _, desc := range m.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			if img, err := ImageForArch(child, arch); err == nil {
+				return img, nil
+			}
+		case desc.MediaType.IsImage():
+			if desc.Platform == nil || desc.Platform.Satisfies(*want) {
+				return idx.Image(desc.Digest)
+			}
+		}
+	}
+	return nil, fmt.Errorf("no image for %s", arch)
+}
+
+// tarballForArch returns the image for an architecture from a tarball,
+// which holds one image per architecture when written by apko build.
+func tarballForArch(src string, arch types.Architecture) (v1.Image, error) {
+	opener := func() (io.ReadCloser, error) { return os.Open(src) }
+	m, err := tarball.LoadManifest(opener)
+	if err != nil {
+		return nil, err
+	}
+	want := arch.ToOCIPlatform()
+	for _, desc := range m {
+		var tag *name.Tag
+		if len(desc.RepoTags) != 0 {
+			t, err := name.NewTag(desc.RepoTags[0])
+			if err != nil {
+				return nil, err
+			}
+			tag = &t
+		} else if len(m) != 1 {
+			continue
+		}
+		img, err := tarball.Image(opener, tag)
+		if err != nil {
+			return nil, err
+		}
+		cf, err := img.ConfigFile()
+		if err != nil {
+			return nil, err
+		}
+		if p := cf.Platform(); p == nil || p.Satisfies(*want) {
+			return img, nil
+		}
+	}
+	return nil, fmt.Errorf("no image for %s", arch)
+}
+
+const (
+	// WhiteoutPrefix prefixes the base name of the whiteout removing a path
+	// from the layers below.
+	WhiteoutPrefix = ".wh."
+	// OpaqueWhiteout is the base name of the marker removing all the
+	// contents of its directory from the layers below.
+	OpaqueWhiteout = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// WalkFiles calls fn for each entry in the flattened filesystem of an image,
+// with its path cleaned and relative to the root. The contents of the entry
+// may be read from r until fn returns.
+//
+// The layers are walked from the top, so an entry shadows those of the
+// layers below: a whiteout removes a path and its contents from the layers
+// below, an opaque marker all the contents of its directory, and an entry
+// other than a directory the contents of a directory below. As container
+// runtimes extract layers, whiteouts and opaque markers leave the entries
+// of their own layer alone.
+func WalkFiles(img v1.Image, fn func(p string, hdr *tar.Header, r io.Reader) error) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("reading image layers: %w", err)
+	}
+
+	// seen are the paths of the layers above, hiding are those hiding
+	// their contents in the layers below
+	seen := map[string]bool{}
+	hiding := map[string]bool{}
+	for i := len(layers) - 1; i >= 0; i-- {
+		removed, opaque, err := walkLayer(layers[i], seen, hiding, fn)
+		if err != nil {
+			return err
+		}
+		for _, p := range removed {
+			seen[p] = true
+			hiding[p] = true
+		}
+		for _, dir := range opaque {
+			hiding[dir] = true
+		}
+	}
+	return nil
+}
+
+// Files returns the headers of the entries in the flattened filesystem of an
+// image by path, as WalkFiles walks them.
+func Files(img v1.Image) (map[string]*tar.Header, error) {
+	files := map[string]*tar.Header{}
+	if err := WalkFiles(img, func(p string, hdr *tar.Header, _ io.Reader) error {
+		files[p] = hdr
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// walkLayer calls fn for the entries of layer which the layers above leave
+// visible, and returns the paths the layer whites out and the directories it
+// makes opaque.
+func walkLayer(layer v1.Layer, seen, hiding map[string]bool, fn func(p string, hdr *tar.Header, r io.Reader) error) (removed, opaque []string, err error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading layer: %w", err)
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return removed, opaque, nil
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("reading image filesystem: %w", err)
+		}
+
+		p := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if p == "" {
+			continue
+		}
+		dir, base := path.Dir(p), path.Base(p)
+		if base == OpaqueWhiteout {
+			opaque = append(opaque, dir)
+			continue
+		}
+		if strings.HasPrefix(base, WhiteoutPrefix) {
+			removed = append(removed, path.Join(dir, strings.TrimPrefix(base, WhiteoutPrefix)))
+			continue
+		}
+		if seen[p] || hidden(hiding, p) {
+			continue
+		}
+		seen[p] = true
+		if hdr.Typeflag != tar.TypeDir {
+			hiding[p] = true
+		}
+
+		hdr.Name = p
+		if err := fn(p, hdr, tr); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// hidden returns whether one of the parent directories of p hides it.
+func hidden(hiding map[string]bool, p string) bool {
+	for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+		if hiding[dir] {
+			return true
+		}
+	}
+	return hiding["."]
+}
+
+// InstalledPackages returns the packages in the apk installed database of an
+// image.
+func InstalledPackages(img v1.Image) ([]*apk.InstalledPackage, error) {
+	var db InstalledDB
+	if err := WalkFiles(img, db.Collect); err != nil {
+		return nil, err
+	}
+	return db.Packages()
+}
+
+// InstalledDB collects the apk installed database of an image while its
+// files are walked with WalkFiles, for callers which read other files in the
+// same pass.
+type InstalledDB struct {
+	found map[string][]byte
+}
+
+// Collect keeps the contents of p if it is an installed database.
+func (d *InstalledDB) Collect(p string, hdr *tar.Header, r io.Reader) error {
+	if hdr.Typeflag != tar.TypeReg || !slices.Contains(installedPaths, p) {
+		return nil
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", p, err)
+	}
+	if d.found == nil {
+		d.found = map[string][]byte{}
+	}
+	d.found[p] = b
+	return nil
+}
+
+// Packages returns the packages in the newest installed database collected.
+func (d *InstalledDB) Packages() ([]*apk.InstalledPackage, error) {
+	for _, ip := range installedPaths {
+		if b, ok := d.found[ip]; ok {
+			installed, err := apk.ParseInstalled(bytes.NewReader(b))
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", ip, err)
+			}
+			return installed, nil
+		}
+	}
+	return nil, errors.New("image has no apk installed database")
+}
@@ -0,0 +1,64 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestReadImageTarball(t *testing.T) {
+	refs := map[name.Reference]v1.Image{}
+	want := map[types.Architecture]v1.Hash{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		img, err := random.Image(64, 1)
+		require.NoError(t, err)
+		cf, err := img.ConfigFile()
+		require.NoError(t, err)
+		cf = cf.DeepCopy()
+		cf.Architecture, cf.OS = arch, "linux"
+		img, err = mutate.ConfigFile(img, cf)
+		require.NoError(t, err)
+
+		tag, err := name.NewTag("example.com/image:latest-" + arch)
+		require.NoError(t, err)
+		refs[tag] = img
+		want[types.ParseArchitecture(arch)], err = img.Digest()
+		require.NoError(t, err)
+	}
+	src := filepath.Join(t.TempDir(), "image.tar")
+	require.NoError(t, tarball.MultiRefWriteToFile(src, refs))
+
+	for arch, digest := range want {
+		img, err := ReadImage(context.Background(), src, arch)
+		require.NoError(t, err)
+		got, err := img.Digest()
+		require.NoError(t, err)
+		require.Equal(t, digest, got)
+	}
+
+	_, err := ReadImage(context.Background(), src, types.ParseArchitecture("riscv64"))
+	require.ErrorContains(t, err, "no image for riscv64")
+}
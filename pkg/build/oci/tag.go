@@ -0,0 +1,116 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// ErrImmutableTag is returned by Tag when a tag points to another manifest
+// and the registry refuses to move it.
+var ErrImmutableTag = errors.New("tag is immutable")
+
+// Tag tags the image or index published at digest with each of tags. A tag
+// in another repository copies the manifest there, mounting its blobs. Tags
+// already pointing to digest are left alone, so tagging is idempotent. The
+// tags are all parsed, and digest looked up, before any tag is written.
+func Tag(ctx context.Context, digest name.Digest, tags []string, remoteOpts ...remote.Option) error {
+	log := clog.FromContext(ctx)
+	opts := append(slices.Clone(remoteOpts), remote.WithContext(ctx))
+
+	refs := make([]name.Tag, 0, len(tags))
+	for _, t := range tags {
+		ref, err := name.NewTag(t)
+		if err != nil {
+			return fmt.Errorf("parsing %q as tag: %w", t, err)
+		}
+		if ref.RegistryStr() != digest.RegistryStr() {
+			return fmt.Errorf("cannot tag %s in another registry than %s", ref, digest.RegistryStr())
+		}
+		refs = append(refs, ref)
+	}
+	desc, err := remote.Get(digest, opts...)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", digest, err)
+	}
+
+	for _, ref := range refs {
+		existing, headErr := remote.Head(ref, opts...)
+		if headErr == nil && existing.Digest == desc.Digest {
+			log.Infof("%s already points to %s", ref, desc.Digest)
+			continue
+		}
+
+		log.Infof("tagging %s as %s", digest, ref)
+		var err error
+		switch {
+		case ref.Context() == digest.Context():
+			err = remote.Tag(ref, desc, opts...)
+		case desc.MediaType.IsIndex():
+			var idx v1.ImageIndex
+			if idx, err = desc.ImageIndex(); err == nil {
+				err = remote.WriteIndex(ref, idx, opts...)
+			}
+		default:
+			var img v1.Image
+			if img, err = desc.Image(); err == nil {
+				err = remote.Write(ref, img, opts...)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if headErr == nil && isImmutableTagError(err) {
+			return fmt.Errorf("%w: %s points to %s: %w", ErrImmutableTag, ref, existing.Digest, err)
+		}
+		return fmt.Errorf("tagging %s: %w", ref, err)
+	}
+	return nil
+}
+
+// isImmutableTagError reports whether err is a registry refusing to move a
+// tag: a conflict, or an error saying the tag or repository is immutable,
+// as ECR, Harbor and Artifact Registry do. Other errors, such as those of
+// authentication, are not.
+func isImmutableTagError(err error) bool {
+	var terr *transport.Error
+	if !errors.As(err, &terr) {
+		return false
+	}
+	switch terr.StatusCode {
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return false
+	}
+	for _, e := range terr.Errors {
+		if strings.Contains(strings.ToLower(e.Message), "immutable") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// ChunkedUploader uploads layers to registries in chunks. When a chunk
+// fails, the upload resumes from the last byte the registry received,
+// instead of starting over, which matters for large layers on registries
+// whose uploads are often interrupted.
+type ChunkedUploader struct {
+	// Keychain authenticates to the registries, anonymously when nil.
+	Keychain authn.Keychain
+	// Transport sends the requests, remote.DefaultTransport when nil.
+	Transport http.RoundTripper
+	// ChunkSize is the size of the chunks, in bytes.
+	ChunkSize int64
+	// Retry is how failed chunks are retried; its Budget is not used.
+	Retry apk.RetryPolicy
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// client returns the client authenticated to push to repo.
+func (u *ChunkedUploader) client(ctx context.Context, repo name.Repository) (*http.Client, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if c, ok := u.clients[repo.Name()]; ok {
+		return c, nil
+	}
+
+	auth := authn.Anonymous
+	if u.Keychain != nil {
+		a, err := authn.Resolve(ctx, u.Keychain, repo)
+		if err != nil {
+			return nil, fmt.Errorf("resolving credentials of %s: %w", repo, err)
+		}
+		auth = a
+	}
+	rt := u.Transport
+	if rt == nil {
+		rt = remote.DefaultTransport
+	}
+	tr, err := transport.NewWithContext(ctx, repo.Registry, auth, rt, []string{repo.Scope(transport.PushScope)})
+	if err != nil {
+		return nil, fmt.Errorf("authenticating to %s: %w", repo.Registry, err)
+	}
+	if u.clients == nil {
+		u.clients = map[string]*http.Client{}
+	}
+	c := &http.Client{Transport: tr}
+	u.clients[repo.Name()] = c
+	return c, nil
+}
+
+// Upload uploads layer to repo, unless it is there already.
+func (u *ChunkedUploader) Upload(ctx context.Context, repo name.Repository, layer v1.Layer) error {
+	log := clog.FromContext(ctx)
+
+	if u.ChunkSize <= 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", u.ChunkSize)
+	}
+	h, err := layer.Digest()
+	if err != nil {
+		return fmt.Errorf("computing layer digest: %w", err)
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return fmt.Errorf("computing layer size: %w", err)
+	}
+	c, err := u.client(ctx, repo)
+	if err != nil {
+		return err
+	}
+	base := &url.URL{Scheme: repo.Scheme(), Host: repo.RegistryStr(), Path: "/v2/" + repo.RepositoryStr() + "/blobs/"}
+
+	// Skip the layers already there.
+	resp, err := doRequest(ctx, c, http.MethodHead, base.JoinPath(h.String()), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = doRequest(ctx, c, http.MethodPost, base.JoinPath("uploads/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusAccepted); err != nil {
+		return fmt.Errorf("starting upload of %s: %w", h, err)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("parsing upload location: %w", err)
+	}
+
+	r := &layerReader{layer: layer}
+	defer r.Close()
+	var offset int64
+	for attempt := 0; offset < size; {
+		end := min(offset+u.ChunkSize, size)
+		next, received, err := u.uploadChunk(ctx, c, location, r, offset, end)
+		if err == nil {
+			location, offset, attempt = next, received, 0
+			continue
+		}
+		if attempt >= u.Retry.MaxRetries || !u.Retry.Retryable(err) {
+			return fmt.Errorf("uploading %s: %w", h, err)
+		}
+		attempt++
+		wait := u.Retry.MinBackoff << (attempt - 1)
+		if u.Retry.MaxBackoff > 0 {
+			wait = min(wait, u.Retry.MaxBackoff)
+		}
+		log.Warnf("uploading %s failed at byte %d, resuming in %s: %v", h, offset, wait, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		// Ask the registry what it received, which may be more than was
+		// acknowledged; registries which don't say resume from the last
+		// acknowledged chunk.
+		if received, ok := u.uploadStatus(ctx, c, location); ok {
+			offset = received
+		}
+	}
+
+	q := location.Query()
+	q.Set("digest", h.String())
+	location.RawQuery = q.Encode()
+	resp, err = doRequest(ctx, c, http.MethodPut, location, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusCreated); err != nil {
+		return fmt.Errorf("committing upload of %s: %w", h, err)
+	}
+	log.Debugf("uploaded %s in chunks of %d bytes", h, u.ChunkSize)
+	return nil
+}
+
+// uploadChunk uploads the bytes of the layer read by r from offset to end,
+// and returns the location to upload the next chunk to and the number of
+// bytes the registry has received.
+func (u *ChunkedUploader) uploadChunk(ctx context.Context, c *http.Client, location *url.URL, r *layerReader, offset, end int64) (*url.URL, int64, error) {
+	if err := r.seek(offset); err != nil {
+		return nil, 0, fmt.Errorf("reading layer: %w", err)
+	}
+
+	header := http.Header{
+		"Content-Type":  {"application/octet-stream"},
+		"Content-Range": {fmt.Sprintf("%d-%d", offset, end-1)},
+	}
+	body := &chunkBody{LimitedReader: io.LimitedReader{R: r, N: end - offset}, closed: make(chan struct{})}
+	resp, err := doRequest(ctx, c, http.MethodPatch, location, header, body)
+	// The transport may still read the chunk after it returns, until it
+	// closes it; r must not move until then.
+	<-body.closed
+	if err != nil {
+		return nil, 0, err
+	}
+	resp.Body.Close()
+	if err := transport.CheckError(resp, http.StatusAccepted, http.StatusNoContent); err != nil {
+		return nil, 0, err
+	}
+	received, ok := parseRange(resp.Header.Get("Range"))
+	if !ok {
+		received = end
+	}
+	next := location
+	if l := resp.Header.Get("Location"); l != "" {
+		if next, err = resp.Request.URL.Parse(l); err != nil {
+			return nil, 0, fmt.Errorf("parsing upload location: %w", err)
+		}
+	}
+	return next, received, nil
+}
+
+// uploadStatus returns the number of bytes the registry received of the
+// upload at location, if it says.
+func (u *ChunkedUploader) uploadStatus(ctx context.Context, c *http.Client, location *url.URL) (int64, bool) {
+	resp, err := doRequest(ctx, c, http.MethodGet, location, nil, nil)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return 0, false
+	}
+	return parseRange(resp.Header.Get("Range"))
+}
+
+// layerReader reads the compressed contents of a layer once, in order,
+// opening them again only to go back to an offset already read, as when an
+// upload resumes from fewer bytes than were sent.
+type layerReader struct {
+	layer v1.Layer
+	rc    io.ReadCloser
+	pos   int64
+}
+
+// seek moves r to offset.
+func (r *layerReader) seek(offset int64) error {
+	if r.rc == nil || offset < r.pos {
+		if err := r.Close(); err != nil {
+			return err
+		}
+		rc, err := r.layer.Compressed()
+		if err != nil {
+			return err
+		}
+		r.rc, r.pos = rc, 0
+	}
+	n, err := io.CopyN(io.Discard, r.rc, offset-r.pos)
+	r.pos += n
+	return err
+}
+
+func (r *layerReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *layerReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+	return err
+}
+
+// chunkBody is the body of the request uploading a chunk, which reports
+// when the transport closes it.
+type chunkBody struct {
+	io.LimitedReader
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (b *chunkBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
+
+func doRequest(ctx context.Context, c *http.Client, method string, target *url.URL, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		if c, ok := body.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if r, ok := body.(*chunkBody); ok {
+		req.ContentLength = r.N
+	}
+	return c.Do(req)
+}
+
+// parseRange parses a Range header of an upload, 0-<last byte received>,
+// into the number of bytes received.
+func parseRange(s string) (int64, bool) {
+	_, last, ok := strings.Cut(strings.TrimPrefix(s, "bytes="), "-")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n + 1, true
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oci
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestChunkedUploader(t *testing.T) {
+	// The registry fails the second chunk once, before reading it.
+	reg := registry.New()
+	var posts, patches atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			posts.Add(1)
+		case http.MethodPatch:
+			if patches.Add(1) == 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	repo, err := name.NewRepository(strings.TrimPrefix(s.URL, "http://") + "/test/chunked")
+	require.NoError(t, err)
+	base, err := random.Layer(10000, "")
+	require.NoError(t, err)
+	layer := &countingLayer{Layer: base}
+	size, err := layer.Size()
+	require.NoError(t, err)
+
+	u := &ChunkedUploader{
+		ChunkSize: 1024,
+		Retry:     apk.RetryPolicy{MaxRetries: 2, MinBackoff: time.Millisecond},
+	}
+	require.NoError(t, u.Upload(t.Context(), repo, layer))
+
+	// The upload is resumed rather than started over.
+	require.Equal(t, int32(1), posts.Load())
+	require.Equal(t, int32((size+1023)/1024+1), patches.Load())
+	// The layer is read once, and again to go back to the failed chunk.
+	require.Equal(t, int32(2), layer.opened.Load())
+
+	h, err := layer.Digest()
+	require.NoError(t, err)
+	got, err := remote.Layer(repo.Digest(h.String()))
+	require.NoError(t, err)
+	gotSize, err := got.Size()
+	require.NoError(t, err)
+	require.Equal(t, size, gotSize)
+
+	// Layers already there are not uploaded again.
+	require.NoError(t, u.Upload(t.Context(), repo, layer))
+	require.Equal(t, int32(1), posts.Load())
+}
+
+// countingLayer counts how many times its contents are read.
+type countingLayer struct {
+	v1.Layer
+	opened atomic.Int32
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	l.opened.Add(1)
+	return l.Layer.Compressed()
+}
@@ -20,13 +20,20 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
+	"chainguard.dev/apko/pkg/attest"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/policy"
+	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/scan"
 
 	"github.com/chainguard-dev/clog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Option is an option for the build context.
@@ -117,6 +124,62 @@ func WithSBOMFormats(formats []string) Option {
 	}
 }
 
+// WithSBOMFiles lists the files installed by each package, with their
+// checksums, in the image SBOMs. This makes the SBOMs much larger.
+func WithSBOMFiles(files bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMFiles = files
+		return nil
+	}
+}
+
+// WithVEX binds the statements of the OpenVEX documents at paths to the
+// image, see GenerateIndexVEX. The documents are validated here so that an
+// invalid one fails the build before anything is built.
+func WithVEX(paths []string) Option {
+	return func(bc *Context) error {
+		if _, err := parseVEXFiles(paths); err != nil {
+			return err
+		}
+		bc.o.VEXFiles = paths
+		return nil
+	}
+}
+
+// WithSBOMProcessors adds processors which modify the SBOMs after they are
+// generated, before they are written, in the order they are added.
+func WithSBOMProcessors(processors ...sbom.Processor) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMProcessors = append(bc.o.SBOMProcessors, processors...)
+		return nil
+	}
+}
+
+// WithSBOMAttestationKey signs the SBOMs and VEX documents written along the
+// image as in-toto attestations with the PEM private key at path, see
+// AttestSBOMs. The key is loaded here so that an unusable one fails the build
+// before anything is built.
+func WithSBOMAttestationKey(path string) Option {
+	return func(bc *Context) error {
+		if path != "" {
+			if _, err := attest.LoadSigner(path); err != nil {
+				return fmt.Errorf("loading attestation key: %w", err)
+			}
+		}
+		bc.o.SBOMAttestationKey = path
+		return nil
+	}
+}
+
+// WithConfigSBOMFormats uses the sbom-formats of the image configuration,
+// when it sets any, instead of the formats set with WithSBOMFormats.
+func WithConfigSBOMFormats() Option {
+	return func(bc *Context) error {
+		bc.configSBOMFormats = true
+		return nil
+	}
+}
+
 func WithExtraKeys(keys []string) Option {
 	return func(bc *Context) error {
 		bc.o.ExtraKeyFiles = keys
@@ -177,6 +240,36 @@ func WithVCS(enable bool) Option {
 	}
 }
 
+// WithConfigDigest sets the digest of the configuration recorded in the
+// image, when the configuration given is not the one it is computed from,
+// e.g. once its packages are locked.
+func WithConfigDigest(digest string) Option {
+	return func(bc *Context) error {
+		bc.o.ConfigDigest = digest
+		return nil
+	}
+}
+
+// WithVCSPath sets a path in the Git repository to probe when VCS probing
+// is enabled, instead of the directory of the configuration file. Unlike
+// the latter, it need not be within the working directory.
+func WithVCSPath(path string) Option {
+	return func(bc *Context) error {
+		bc.o.VCSPath = path
+		return nil
+	}
+}
+
+// WithVCSTagPrefix sets the prefix of the tags of the commit checked out
+// the version annotation is taken from, e.g. "foo/" for the tags of the
+// component foo of a monorepo, like "foo/v1.2.3".
+func WithVCSTagPrefix(prefix string) Option {
+	return func(bc *Context) error {
+		bc.o.VCSTagPrefix = prefix
+		return nil
+	}
+}
+
 // WithAnnotations adds annotations from commandline to those in the config.
 // Commandline annotations take precedence.
 func WithAnnotations(annotations map[string]string) Option {
@@ -208,6 +301,18 @@ func WithLockFile(lockFile string) Option {
 	}
 }
 
+// WithLocked requires the build to be exactly described by the lockfile: any
+// package, index or key which deviates from it is an error, instead of being
+// resolved again. A frozen build is locked, and does not use the network, so
+// everything must be in the cache as well.
+func WithLocked(locked, frozen bool) Option {
+	return func(bc *Context) error {
+		bc.o.Locked = locked || frozen
+		bc.o.Frozen = frozen
+		return nil
+	}
+}
+
 func WithTempDir(tmp string) Option {
 	return func(bc *Context) error {
 		bc.o.TempDirPath = tmp
@@ -223,7 +328,11 @@ func WithAuthenticator(a auth.Authenticator) Option {
 }
 
 // WithIgnoreSignatures sets whether to ignore repository signature verification.
-// Default is false.
+// Default is false. It ignores the signatures of each repository of the
+// build, recording ReasonAllSignaturesIgnored as why.
+//
+// Deprecated: use WithUnsignedRepositories, which ignores the signatures of
+// the given repositories only, and records why.
 func WithIgnoreSignatures(ignore bool) Option {
 	return func(bc *Context) error {
 		bc.o.IgnoreSignatures = ignore
@@ -231,6 +340,259 @@ func WithIgnoreSignatures(ignore bool) Option {
 	}
 }
 
+// WithUnsignedRepositories ignores the signatures of the indexes and packages
+// of each repository, for the reason it maps to, which is recorded in the
+// SBOMs and lockfiles. Every repository needs a reason.
+func WithUnsignedRepositories(unsigned map[string]string) Option {
+	return func(bc *Context) error {
+		for repo, reason := range unsigned {
+			if strings.TrimSpace(reason) == "" {
+				return fmt.Errorf("ignoring the signatures of %s needs a reason", repo)
+			}
+			if bc.o.UnsignedRepositories == nil {
+				bc.o.UnsignedRepositories = map[string]string{}
+			}
+			bc.o.UnsignedRepositories[repo] = reason
+		}
+		return nil
+	}
+}
+
+// WithVerifyPackageSignatures sets whether to verify the signature of every
+// installed package against the keyring, recording the signing key of each
+// in the SBOMs. Default is false.
+func WithVerifyPackageSignatures(verify bool) Option {
+	return func(bc *Context) error {
+		bc.o.VerifyPackageSignatures = verify
+		return nil
+	}
+}
+
+// WithLocalIndexSynthesis sets whether to synthesize the unsigned index of a
+// local repository from its packages when it has none, or one older than any
+// of them. Default is false.
+func WithLocalIndexSynthesis(synthesize bool) Option {
+	return func(bc *Context) error {
+		bc.o.LocalIndexSynthesis = synthesize
+		return nil
+	}
+}
+
+// WithCheckEntrypoint sets whether to verify that the program of the
+// entrypoint, or else of the cmd, is in the image with the interpreter and
+// shared libraries it needs, failing the build otherwise. Default is false.
+func WithCheckEntrypoint(check bool) Option {
+	return func(bc *Context) error {
+		bc.o.CheckEntrypoint = check
+		return nil
+	}
+}
+
+// WithPermissionsPolicy normalizes the ownership and permissions of the files
+// installed from packages with p, such as to make root own them all, or to
+// strip their setuid and setgid bits. The files changed are recorded with the
+// recorder of WithNormalizationRecorder. Default is nil, which keeps them as
+// they are in the packages.
+func WithPermissionsPolicy(p *apk.PermissionsPolicy) Option {
+	return func(bc *Context) error {
+		bc.o.PermissionsPolicy = p
+		return nil
+	}
+}
+
+// WithNormalizationRecorder records the changes the permissions policy makes
+// to the files installed from packages with r, such as a report.Recorder.
+func WithNormalizationRecorder(r apk.NormalizationRecorder) Option {
+	return func(bc *Context) error {
+		bc.o.NormalizationRecorder = r
+		return nil
+	}
+}
+
+// WithBaseDirectoryPolicy sets what to do with the base directories, such
+// as /tmp, which already exist with other permissions than apk creates them
+// with, as when building over an extracted base image: fail the build, fix
+// their permissions, or keep them. Default is apk.BaseDirectoriesStrict,
+// which fails the build.
+func WithBaseDirectoryPolicy(p apk.BaseDirectoryPolicy) Option {
+	return func(bc *Context) error {
+		p, err := apk.ParseBaseDirectoryPolicy(string(p))
+		if err != nil {
+			return err
+		}
+		bc.o.BaseDirectoryPolicy = p
+		return nil
+	}
+}
+
+// WithPolicy sets the policies to evaluate against the plan of the build
+// before installing anything, failing the build on violations. A nil
+// policy evaluates nothing.
+func WithPolicy(p policy.Evaluator) Option {
+	return func(bc *Context) error {
+		bc.o.Policy = p
+		return nil
+	}
+}
+
+// WithScan sets the scanner to run on each image once its SBOMs are
+// generated, failing the build if it finds vulnerabilities of at least the
+// severity of failOn, e.g. "severity>=high". An empty failOn only reports the
+// vulnerabilities found.
+func WithScan(s scan.Scanner, failOn string) Option {
+	return func(bc *Context) error {
+		bc.o.Scanner = s
+		bc.o.ScanFailOn = nil
+		if failOn != "" {
+			sev, err := scan.ParseFailOn(failOn)
+			if err != nil {
+				return err
+			}
+			bc.o.ScanFailOn = &sev
+		}
+		return nil
+	}
+}
+
+// WithTriggers sets the packages whose triggers to run in the root filesystem
+// once all packages are installed. apk does not run triggers otherwise.
+func WithTriggers(packages []string) Option {
+	return func(bc *Context) error {
+		bc.o.Triggers = packages
+		return nil
+	}
+}
+
+// WithRecordTriggers records the triggers of the installed packages which
+// are not run, as they are not given with WithTriggers, in
+// /usr/lib/apko/triggers.json, with the directories of the image to run
+// them with. With firstBoot, their scripts are written to the image too,
+// with /usr/lib/apko/run-triggers, a script running them all once, for the
+// entrypoint or init system to run when the image starts.
+func WithRecordTriggers(record, firstBoot bool) Option {
+	return func(bc *Context) error {
+		bc.o.RecordTriggers = record || firstBoot
+		bc.o.FirstBootTriggers = firstBoot
+		return nil
+	}
+}
+
+// WithExecutor sets the executor which runs the triggers of the packages
+// given with WithTriggers. By default, the triggers are run with
+// executor.Default for the architecture of the build.
+func WithExecutor(e apk.Executor) Option {
+	return func(bc *Context) error {
+		bc.o.Executor = e
+		return nil
+	}
+}
+
+// WithProgressReporter sets the Reporter that receives the progress of
+// downloading, expanding and installing packages.
+func WithProgressReporter(r apk.Reporter) Option {
+	return func(bc *Context) error {
+		bc.o.Progress = r
+		return nil
+	}
+}
+
+// WithMetricsRegistry registers the Prometheus metrics of the build, the
+// duration of its phases, and of its apk implementation with reg. The builds
+// of a process may share the same registry.
+func WithMetricsRegistry(reg prometheus.Registerer) Option {
+	return func(bc *Context) error {
+		bc.o.Metrics = reg
+		return nil
+	}
+}
+
+// WithFetchTimeout bounds the time spent fetching the keys of each
+// repository, the keyring, the repository indexes and each package. Zero
+// means no timeout.
+func WithFetchTimeout(timeout time.Duration) Option {
+	return func(bc *Context) error {
+		bc.o.FetchTimeout = timeout
+		return nil
+	}
+}
+
+// WithResolveTimeout bounds the time spent resolving the packages of each
+// architecture. Zero means no timeout.
+func WithResolveTimeout(timeout time.Duration) Option {
+	return func(bc *Context) error {
+		bc.o.ResolveTimeout = timeout
+		return nil
+	}
+}
+
+// WithRetryPolicy sets how failed requests to the repositories, and to the
+// registries of OCI keyrings, are retried.
+func WithRetryPolicy(p apk.RetryPolicy) Option {
+	return func(bc *Context) error {
+		bc.o.RetryPolicy = &p
+		return nil
+	}
+}
+
+// WithMaxConcurrentDownloads bounds the number of packages, indexes and keys
+// which are downloaded at the same time, by all the architectures of the
+// build. Zero means no bound.
+func WithMaxConcurrentDownloads(n int) Option {
+	limit := apk.WithMaxConcurrentDownloads(n)
+	return func(bc *Context) error {
+		bc.o.DownloadLimits = append(bc.o.DownloadLimits, limit)
+		return nil
+	}
+}
+
+// WithBandwidthLimit bounds the total bandwidth of the downloads of all the
+// architectures of the build, in bytes per second. Zero means no limit.
+func WithBandwidthLimit(bytesPerSec int64) Option {
+	limit := apk.WithBandwidthLimit(bytesPerSec)
+	return func(bc *Context) error {
+		bc.o.DownloadLimits = append(bc.o.DownloadLimits, limit)
+		return nil
+	}
+}
+
+// WithNetworkAuditor records every request made to the repositories during
+// the build with auditor.
+func WithNetworkAuditor(auditor apk.NetworkAuditor) Option {
+	return func(bc *Context) error {
+		bc.o.NetworkAuditor = auditor
+		return nil
+	}
+}
+
+// WithBuildArgs sets the values of the build arguments referenced in the
+// image configuration, see types.ImageConfiguration.ExpandBuildArgs.
+func WithBuildArgs(args map[string]string) Option {
+	return func(bc *Context) error {
+		bc.o.BuildArgs = args
+		return nil
+	}
+}
+
+// WithVariant sets the variant of the image configuration to build, see
+// types.ImageConfiguration.ApplyVariant.
+func WithVariant(name string) Option {
+	return func(bc *Context) error {
+		bc.o.Variant = name
+		return nil
+	}
+}
+
+// WithDebugImage builds the debug image of the configuration, on top of
+// its variant if one is set: its debug variant if it defines one, otherwise
+// types.DebugVariant of packages.
+func WithDebugImage(packages []string) Option {
+	return func(bc *Context) error {
+		bc.o.DebugImage = true
+		bc.o.DebugPackages = packages
+		return nil
+	}
+}
+
 // WithTransport allows explicitly setting the inner HTTP transport.
 func WithTransport(t http.RoundTripper) Option {
 	return func(bc *Context) error {
@@ -238,3 +600,20 @@ func WithTransport(t http.RoundTripper) Option {
 		return nil
 	}
 }
+
+// WithFixups adds fixups to run against the root filesystem after the
+// built-in ones, in the order given.
+func WithFixups(fixups ...Fixup) Option {
+	return func(bc *Context) error {
+		for _, f := range fixups {
+			if f.Name == "" || f.Run == nil {
+				return fmt.Errorf("fixup %q must have a name and a run function", f.Name)
+			}
+			if slices.ContainsFunc(bc.fixups(), func(o Fixup) bool { return o.Name == f.Name }) {
+				return fmt.Errorf("duplicate fixup %q", f.Name)
+			}
+			bc.extraFixups = append(bc.extraFixups, f)
+		}
+		return nil
+	}
+}
@@ -42,7 +42,7 @@ func mutatePermissions(fsys apkfs.FullFS, o *options.Options, mut types.PathMuta
 func mutatePermissionsDirect(fsys apkfs.FullFS, path string, perms, uid, gid uint32) error {
 	target := path
 
-	if err := fsys.Chmod(target, fs.FileMode(perms)); err != nil {
+	if err := fsys.Chmod(target, fileMode(perms)); err != nil {
 		return fmt.Errorf("chmod %q: %w", target, err)
 	}
 	if err := fsys.Chown(target, int(uid), int(gid)); err != nil {
@@ -52,7 +52,7 @@ func mutatePermissionsDirect(fsys apkfs.FullFS, path string, perms, uid, gid uin
 }
 
 func mutateDirectory(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation) error {
-	perms := fs.FileMode(mut.Permissions)
+	perms := fileMode(mut.Permissions)
 
 	if err := fsys.MkdirAll(mut.Path, perms); err != nil {
 		return err
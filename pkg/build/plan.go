@@ -0,0 +1,311 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/lock"
+	"chainguard.dev/apko/pkg/s6"
+)
+
+// Plan describes what a build would install and write, without installing
+// anything.
+type Plan struct {
+	Arch string `json:"arch"`
+	// Packages are the packages which would be installed, in install order.
+	Packages []PlannedPackage `json:"packages"`
+	// Layers are the packages of each layer, when the image is layered. The
+	// files outside packages go in a final layer, which is not listed.
+	Layers []PlannedLayer `json:"layers,omitempty"`
+	// DownloadSize is the size of the packages to fetch, which is about the
+	// compressed size of the image.
+	DownloadSize uint64 `json:"downloadSize"`
+	// InstalledSize is the size of the packages once installed, which is
+	// about the uncompressed size of the image.
+	InstalledSize uint64 `json:"installedSize"`
+	// Files are the files apko would create besides those of the packages.
+	// Directories, ending with a slash, hold files which are only known
+	// once the packages are installed, such as the license files collected
+	// from them.
+	Files []string `json:"files"`
+}
+
+// PlannedPackage is a package in a Plan. The sizes of packages from a
+// lockfile are only known when they are still in the repository indexes.
+type PlannedPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	// Repository is the repository the package is fetched from, as it is
+	// configured, without the architecture.
+	Repository string `json:"repository"`
+	Origin     string `json:"origin,omitempty"`
+	License    string `json:"license,omitempty"`
+	// Checksum is the checksum of the control section of the package, as in
+	// the repository index and lockfile, e.g. Q1...
+	Checksum      string `json:"checksum,omitempty"`
+	Size          uint64 `json:"size"`
+	InstalledSize uint64 `json:"installedSize"`
+}
+
+// PlannedLayer is a layer of a layered image in a Plan.
+type PlannedLayer struct {
+	Packages      []string `json:"packages"`
+	InstalledSize uint64   `json:"installedSize"`
+}
+
+// Plan resolves the packages of the build, from the lockfile if there is
+// one, and returns what BuildLayers would install and write. The keyring and
+// the repository indexes are fetched and verified as for a build, so that
+// errors with them surface, but no package is fetched and nothing is written
+// outside the in-memory filesystem of the build.
+func (bc *Context) Plan(ctx context.Context) (*Plan, error) {
+	ctx, span := otel.Tracer("apko").Start(ctx, "Plan")
+	defer span.End()
+
+	var (
+		pkgs []*apk.Package
+		urls []string
+	)
+	if bc.o.Lockfile != "" {
+		l, _, err := bc.loadLock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if pkgs, urls, err = bc.lockedPackages(ctx, l); err != nil {
+			return nil, err
+		}
+	} else {
+		resolved, _, err := bc.BuildPackageList(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("resolving apk packages: %w", err)
+		}
+		pkgs, urls = resolvedPackages(resolved)
+	}
+	return bc.planOf(pkgs, urls)
+}
+
+// planOf returns the plan of a build installing pkgs, fetched from urls.
+func (bc *Context) planOf(pkgs []*apk.Package, urls []string) (*Plan, error) {
+	p := &Plan{Arch: bc.Arch().ToAPK()}
+	for i, pkg := range pkgs {
+		var checksum string
+		if len(pkg.Checksum) != 0 {
+			checksum = pkg.ChecksumString()
+		}
+		p.Packages = append(p.Packages, PlannedPackage{
+			Name:          pkg.Name,
+			Version:       pkg.Version,
+			URL:           urls[i],
+			Repository:    repositoryOf(urls[i], bc.Arch().ToAPK()),
+			Origin:        pkg.Origin,
+			License:       pkg.License,
+			Checksum:      checksum,
+			Size:          pkg.Size,
+			InstalledSize: pkg.InstalledSize,
+		})
+		p.DownloadSize += pkg.Size
+		p.InstalledSize += pkg.InstalledSize
+	}
+
+	if l := bc.ic.Layering; l != nil && (l.Strategy != "" || l.Budget != 0) {
+		if l.Strategy != "origin" {
+			return nil, fmt.Errorf("unrecognized layering strategy %q", l.Strategy)
+		}
+		if bc.ic.Contents.BaseImage != nil {
+			return nil, fmt.Errorf("layering with %q is unsupported", "baseimage")
+		}
+		groups, err := groupByOriginAndSize(pkgs, l.Budget)
+		if err != nil {
+			return nil, fmt.Errorf("grouping packages: %w", err)
+		}
+		for _, g := range groups {
+			layer := PlannedLayer{InstalledSize: g.size}
+			for _, pkg := range g.pkgs {
+				layer.Packages = append(layer.Packages, pkg.Name+"="+pkg.Version)
+			}
+			p.Layers = append(p.Layers, layer)
+		}
+	}
+
+	files, err := bc.plannedFiles(pkgs)
+	if err != nil {
+		return nil, err
+	}
+	p.Files = files
+	return p, nil
+}
+
+// repositoryOf returns the repository of the URL of a package, which is in
+// the directory of the architecture under the repository.
+func repositoryOf(url, arch string) string {
+	dir := url[:max(strings.LastIndex(url, "/"), 0)]
+	return strings.TrimSuffix(dir, "/"+arch)
+}
+
+// resolvedPackages returns the packages of the resolved world of the build,
+// and the URLs they are fetched from.
+func resolvedPackages(resolved []*apk.RepositoryPackage) ([]*apk.Package, []string) {
+	pkgs := make([]*apk.Package, 0, len(resolved))
+	urls := make([]string, 0, len(resolved))
+	for _, pkg := range resolved {
+		pkgs = append(pkgs, pkg.Package)
+		urls = append(urls, pkg.URL())
+	}
+	return pkgs, urls
+}
+
+// loadLock loads the lockfile of the build and returns it with the packages
+// to install for the architecture, after checking that it locks the
+// configuration and matches the repositories.
+func (bc *Context) loadLock(ctx context.Context) (lock.Lock, []apk.InstallablePackage, error) {
+	l, err := lock.FromFile(bc.o.Lockfile)
+	if err != nil {
+		return lock.Lock{}, nil, fmt.Errorf("failed to load lock-file: %w", err)
+	}
+	if err := bc.VerifyLockfileConsistency(ctx, l.Config); err != nil {
+		return lock.Lock{}, nil, err
+	}
+	installable, err := installablePackagesForArch(l, bc.Arch())
+	if err != nil {
+		return lock.Lock{}, nil, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
+	}
+	if err := bc.verifyLockIntegrity(ctx, l, installable); err != nil {
+		return lock.Lock{}, nil, fmt.Errorf("verifying lockfile %s: %w", bc.o.Lockfile, err)
+	}
+	return l, installable, nil
+}
+
+// lockedPackages returns the locked packages of the architecture, with their
+// sizes from the repository indexes, and the URLs they are fetched from.
+func (bc *Context) lockedPackages(ctx context.Context, l lock.Lock) ([]*apk.Package, []string, error) {
+	indexes, err := bc.RepositoryIndexes(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting repository indexes: %w", err)
+	}
+	indexed := map[string]*apk.Package{}
+	for _, idx := range indexes {
+		for _, pkg := range idx.Packages() {
+			indexed[pkg.URL()] = pkg.Package
+		}
+	}
+
+	var (
+		pkgs []*apk.Package
+		urls []string
+	)
+	for _, lp := range l.Contents.Packages {
+		if lp.Architecture != bc.Arch().ToAPK() {
+			continue
+		}
+		pkg, ok := indexed[lp.URL]
+		if !ok {
+			pkg = &apk.Package{Name: lp.Name, Version: lp.Version, Arch: lp.Architecture}
+			if sum, ok := strings.CutPrefix(lp.Checksum, "Q1"); ok {
+				pkg.Checksum, _ = base64.StdEncoding.DecodeString(sum)
+			}
+		}
+		pkgs = append(pkgs, pkg)
+		urls = append(urls, lp.URL)
+	}
+	return pkgs, urls, nil
+}
+
+// plannedFiles returns the files buildImage creates besides those of pkgs,
+// whether or not a package already has them.
+func (bc *Context) plannedFiles(pkgs []*apk.Package) ([]string, error) {
+	var files []string
+	for _, hdr := range bc.apk.ListInitFiles() {
+		if hdr.Typeflag != tar.TypeDir {
+			files = append(files, strings.TrimPrefix(hdr.Name, "/"))
+		}
+	}
+	keys, err := bc.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("getting keyring: %w", err)
+	}
+	for name := range keys {
+		files = append(files, path.Join("etc/apk/keys", name))
+	}
+
+	if bc.ic.Contents.BaseImage == nil {
+		files = append(files, "etc/passwd")
+		if len(bc.ic.Accounts.Groups) != 0 {
+			files = append(files, "etc/group")
+		}
+	}
+	if bc.ic.OSRelease != nil {
+		files = append(files, "etc/os-release")
+	}
+	files = append(files, plannedSystemConfigFiles(&bc.ic)...)
+	if c := bc.ic.Certificates; c != nil {
+		// The bundle is regenerated unless no package installs
+		// certificates and none are added.
+		files = append(files, strings.TrimPrefix(caCertificatesBundle, "/"))
+		for _, a := range c.Additional {
+			files = append(files, path.Join(strings.TrimPrefix(caCertificatesLocal, "/"), a.Name+".crt"))
+		}
+	}
+	if bc.ic.Licenses != nil {
+		root := licensesRoot(bc.ic.Licenses)
+		for _, pkg := range pkgs {
+			files = append(files, path.Join(root, pkg.Name)+"/")
+		}
+	}
+	files = append(files, "etc/apko.json")
+	// Which packages have triggers to record is only known once they are
+	// installed, and so are the scripts of the triggers.
+	if bc.o.RecordTriggers {
+		files = append(files, pendingTriggersPath)
+	}
+	if bc.o.FirstBootTriggers {
+		files = append(files, firstBootTriggersPath)
+	}
+	for _, mut := range bc.ic.Paths {
+		if mut.Type != "permissions" {
+			files = append(files, strings.TrimPrefix(filepath.Clean(mut.Path), "/"))
+		}
+	}
+	for service := range bc.ic.Entrypoint.Services {
+		files = append(files, path.Join("sv", service, "run"))
+	}
+	files = append(files, s6.ServiceFiles(bc.ic.Services)...)
+	files = append(files, s6.ServiceDefinitionFiles(bc.ic.Entrypoint.S6RC)...)
+	local, err := plannedLocalFiles(bc.ic.Contents.LocalFiles, bc.o.IncludePaths)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, local...)
+	for _, rf := range remoteFilesForArch(bc.ic.Contents.RemoteFiles, bc.Arch()) {
+		// What an archive extracts is only known once it is fetched.
+		if !rf.Extract {
+			files = append(files, remoteFileDestination(rf))
+		}
+	}
+
+	slices.Sort(files)
+	return slices.Compact(files), nil
+}
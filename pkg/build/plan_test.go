@@ -0,0 +1,120 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+)
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name   string
+		opts   []build.Option
+		layers int
+	}{{
+		name: "world",
+		opts: []build.Option{build.WithConfig("apko.yaml", []string{"testdata"})},
+	}, {
+		name: "lockfile",
+		opts: []build.Option{
+			build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+			build.WithLockFile(filepath.Join("testdata", "apko.lock.json")),
+		},
+	}, {
+		name:   "layered",
+		opts:   []build.Option{build.WithConfig("layering.yaml", []string{"testdata"})},
+		layers: 2,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fs.NewMemFS()
+			bc, err := build.New(ctx, fsys, tc.opts...)
+			require.NoError(t, err)
+
+			plan, err := bc.Plan(ctx)
+			require.NoError(t, err)
+
+			require.Equal(t, "x86_64", plan.Arch)
+			require.Len(t, plan.Packages, 2)
+			require.Equal(t, "pretend-baselayout", plan.Packages[0].Name)
+			require.Equal(t, "replayout", plan.Packages[1].Name)
+			var size uint64
+			for _, pkg := range plan.Packages {
+				require.NotZero(t, pkg.Size, pkg.Name)
+				require.NotEmpty(t, pkg.URL, pkg.Name)
+				require.Equal(t, "./testdata/packages", pkg.Repository, pkg.Name)
+				size += pkg.Size
+			}
+			require.Equal(t, size, plan.DownloadSize)
+			require.Len(t, plan.Layers, tc.layers)
+
+			require.Contains(t, plan.Files, "etc/apko.json")
+			require.Contains(t, plan.Files, "etc/passwd")
+			require.Contains(t, plan.Files, "etc/apk/keys/melange.rsa.pub")
+
+			require.NotContains(t, plan.Files, "etc/ssl/certs/ca-certificates.crt")
+
+			// Nothing is installed.
+			_, err = fsys.Stat("etc/apko.json")
+			require.Error(t, err)
+			installed, err := bc.InstalledPackages()
+			require.NoError(t, err)
+			require.Empty(t, installed)
+		})
+	}
+}
+
+func TestPlanFiles(t *testing.T) {
+	ctx := context.Background()
+
+	base, err := filepath.Abs(filepath.Join("testdata", "apko.yaml"))
+	require.NoError(t, err)
+	config := filepath.Join(t.TempDir(), "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte(`include: `+base+`
+certificates:
+  additional:
+    - name: internal
+      content: |
+        -----BEGIN CERTIFICATE-----
+        -----END CERTIFICATE-----
+licenses:
+  path: /usr/share/licenses/all
+`), 0o644))
+
+	bc, err := build.New(ctx, fs.NewMemFS(), build.WithConfig(config, []string{}))
+	require.NoError(t, err)
+	plan, err := bc.Plan(ctx)
+	require.NoError(t, err)
+
+	// The certificates and the directories of the license files of each
+	// package are written besides the packages.
+	for _, f := range []string{
+		"etc/ssl/certs/ca-certificates.crt",
+		"usr/local/share/ca-certificates/internal.crt",
+		"usr/share/licenses/all/pretend-baselayout/",
+		"usr/share/licenses/all/replayout/",
+	} {
+		require.Contains(t, plan.Files, f)
+	}
+}
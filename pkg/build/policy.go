@@ -0,0 +1,88 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// PolicyInput is the document policies are evaluated against, as their
+// input.
+type PolicyInput struct {
+	Plan *Plan `json:"plan"`
+	// Repositories are the repositories packages are resolved from.
+	Repositories []string `json:"repositories"`
+	// Keys are the names of the keys in the keyring.
+	Keys   []string                 `json:"keys"`
+	Config types.ImageConfiguration `json:"config"`
+}
+
+// CheckPolicies evaluates the policies of the build against its plan,
+// logging their warnings, and fails if they deny it. It does nothing if the
+// build has no policies.
+func (bc *Context) CheckPolicies(ctx context.Context, plan *Plan) error {
+	if bc.o.Policy == nil {
+		return nil
+	}
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "CheckPolicies")
+	defer span.End()
+
+	repos, err := bc.apk.GetRepositories()
+	if err != nil {
+		return fmt.Errorf("getting repositories: %w", err)
+	}
+	keys, err := bc.Keyring()
+	if err != nil {
+		return fmt.Errorf("getting keyring: %w", err)
+	}
+
+	r, err := bc.o.Policy.Evaluate(ctx, PolicyInput{
+		Plan:         plan,
+		Repositories: repos,
+		Keys:         slices.Sorted(maps.Keys(keys)),
+		Config:       bc.ic,
+	})
+	if err != nil {
+		return err
+	}
+	for _, w := range r.Warnings {
+		log.Warnf("policy: %s", w)
+	}
+	if len(r.Denials) != 0 {
+		return fmt.Errorf("the %s build violates policies:\n  - %s", bc.Arch().ToAPK(), strings.Join(r.Denials, "\n  - "))
+	}
+	return nil
+}
+
+// checkPlannedPolicies evaluates the policies of the build against the plan of
+// the packages it is about to install, fetched from urls.
+func (bc *Context) checkPlannedPolicies(ctx context.Context, pkgs []*apk.Package, urls []string) error {
+	plan, err := bc.planOf(pkgs, urls)
+	if err != nil {
+		return err
+	}
+	return bc.CheckPolicies(ctx, plan)
+}
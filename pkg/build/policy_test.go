@@ -0,0 +1,113 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/policy"
+)
+
+// denyRepository is a policy which denies the packages of a repository.
+func denyRepository(repo string, calls *int) policy.Evaluator {
+	return policy.EvaluatorFunc(func(_ context.Context, input any) (policy.Result, error) {
+		*calls++
+		in, ok := input.(build.PolicyInput)
+		if !ok {
+			return policy.Result{}, fmt.Errorf("unexpected input %T", input)
+		}
+		var r policy.Result
+		for _, pkg := range in.Plan.Packages {
+			if pkg.Repository == repo {
+				r.Denials = append(r.Denials, fmt.Sprintf("%s comes from %s", pkg.Name, pkg.Repository))
+			}
+		}
+		if len(in.Keys) == 0 {
+			r.Warnings = append(r.Warnings, "no keys")
+		}
+		return r, nil
+	})
+}
+
+func TestCheckPolicies(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		name    string
+		repo    string
+		wantErr string
+	}{{
+		name: "allowed",
+		repo: "https://dl-cdn.alpinelinux.org/alpine/edge/testing",
+	}, {
+		name:    "denied",
+		repo:    "./testdata/packages",
+		wantErr: "the x86_64 build violates policies:\n  - pretend-baselayout comes from ./testdata/packages\n  - replayout comes from ./testdata/packages",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			bc, err := build.New(ctx, fs.NewMemFS(),
+				build.WithConfig("apko.yaml", []string{"testdata"}),
+				build.WithPolicy(denyRepository(tc.repo, &calls)),
+			)
+			require.NoError(t, err)
+			plan, err := bc.Plan(ctx)
+			require.NoError(t, err)
+
+			err = bc.CheckPolicies(ctx, plan)
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, 1, calls)
+		})
+	}
+}
+
+func TestBuildLayersPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	// The policies are evaluated once, before anything is installed.
+	var calls int
+	fsys := fs.NewMemFS()
+	bc, err := build.New(ctx, fsys,
+		build.WithConfig("apko.yaml", []string{"testdata"}),
+		build.WithPolicy(denyRepository("./testdata/packages", &calls)),
+	)
+	require.NoError(t, err)
+	_, err = bc.BuildLayers(ctx)
+	require.ErrorContains(t, err, "violates policies")
+	require.Equal(t, 1, calls)
+	installed, err := fsys.ReadFile("usr/lib/apk/db/installed")
+	require.NoError(t, err)
+	require.Empty(t, installed)
+
+	calls = 0
+	bc, err = build.New(ctx, fs.NewMemFS(),
+		build.WithConfig("apko.yaml", []string{"testdata"}),
+		build.WithPolicy(denyRepository("https://dl-cdn.alpinelinux.org/alpine/edge/testing", &calls)),
+	)
+	require.NoError(t, err)
+	_, err = bc.BuildLayers(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+}
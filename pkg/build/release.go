@@ -0,0 +1,150 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const osReleasePath = "/etc/os-release"
+
+// osReleaseFields returns the os-release variables set in the configuration,
+// keyed by variable name.
+func osReleaseFields(r *types.OSRelease) map[string]string {
+	fields := maps.Clone(r.Extra)
+	if fields == nil {
+		fields = map[string]string{}
+	}
+	for k, v := range map[string]string{
+		"NAME":           r.Name,
+		"ID":             r.ID,
+		"VERSION_ID":     r.VersionID,
+		"PRETTY_NAME":    r.PrettyName,
+		"HOME_URL":       r.HomeURL,
+		"BUG_REPORT_URL": r.BugReportURL,
+	} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// quoteOSReleaseValue quotes an os-release value if it contains anything
+// other than characters which are safe to leave unquoted, as described by
+// os-release(5).
+func quoteOSReleaseValue(v string) string {
+	if v != "" && strings.IndexFunc(v, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-", r))
+	}) == -1 {
+		return v
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + r.Replace(v) + `"`
+}
+
+// resolveOSReleasePath follows /etc/os-release if it is a symlink (as it is
+// on Alpine, where it points at /usr/lib/os-release) so that the file owned
+// by the package is updated rather than replaced.
+func resolveOSReleasePath(fsys apkfs.FullFS) (string, error) {
+	fi, err := fsys.Lstat(osReleasePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return osReleasePath, nil
+	} else if err != nil {
+		return "", fmt.Errorf("stat %s: %w", osReleasePath, err)
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return osReleasePath, nil
+	}
+	target, err := fsys.Readlink(osReleasePath)
+	if err != nil {
+		return "", fmt.Errorf("reading link %s: %w", osReleasePath, err)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(osReleasePath), target)
+	}
+	if _, err := fsys.Stat(target); err != nil {
+		// Dangling link: replace the link itself.
+		if err := fsys.Remove(osReleasePath); err != nil {
+			return "", fmt.Errorf("removing dangling link %s: %w", osReleasePath, err)
+		}
+		return osReleasePath, nil
+	}
+	return target, nil
+}
+
+// generateOSRelease merges the os-release stanza of the image configuration
+// into the os-release file installed by packages. Lines for fields which are
+// not overridden, including comments, are preserved as-is, and fields which
+// were not already present are appended in a deterministic order.
+func generateOSRelease(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
+	if ic.OSRelease == nil {
+		return nil
+	}
+
+	path, err := resolveOSReleasePath(fsys)
+	if err != nil {
+		return err
+	}
+
+	mode := fs.FileMode(0o644)
+	var existing []byte
+	if fi, err := fsys.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+		if existing, err = fsys.ReadFile(path); err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	fields := osReleaseFields(ic.OSRelease)
+
+	var lines []string
+	if len(existing) != 0 {
+		lines = strings.Split(strings.TrimRight(string(existing), "\n"), "\n")
+	}
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if !ok || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if v, ok := fields[key]; ok {
+			lines[i] = key + "=" + quoteOSReleaseValue(v)
+			delete(fields, key)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		lines = append(lines, key+"="+quoteOSReleaseValue(fields[key]))
+	}
+
+	if err := fsys.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating parent directory of %s: %w", path, err)
+	}
+	if err := fsys.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), mode); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
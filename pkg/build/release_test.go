@@ -0,0 +1,114 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestGenerateOSRelease(t *testing.T) {
+	ic := &types.ImageConfiguration{
+		OSRelease: &types.OSRelease{
+			ID:         "acme",
+			PrettyName: "Acme Linux (wolfi based)",
+			Extra: map[string]string{
+				"VARIANT_ID": "fips",
+			},
+		},
+	}
+
+	t.Run("merges with installed file", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/etc", 0o755))
+		require.NoError(t, fsys.WriteFile("/etc/os-release", []byte(`# installed by wolfi-baselayout
+ID=wolfi
+NAME="Wolfi"
+PRETTY_NAME="Wolfi"
+HOME_URL="https://wolfi.dev"
+`), 0o644))
+
+		require.NoError(t, generateOSRelease(fsys, ic))
+
+		b, err := fsys.ReadFile("/etc/os-release")
+		require.NoError(t, err)
+		require.Equal(t, `# installed by wolfi-baselayout
+ID=acme
+NAME="Wolfi"
+PRETTY_NAME="Acme Linux (wolfi based)"
+HOME_URL="https://wolfi.dev"
+VARIANT_ID=fips
+`, string(b))
+
+		info, err := fetchFSReleaseData(fsys)
+		require.NoError(t, err)
+		require.Equal(t, "acme", info.ID)
+		require.Equal(t, "Wolfi", info.Name)
+	})
+
+	t.Run("creates missing file", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, generateOSRelease(fsys, ic))
+
+		b, err := fsys.ReadFile("/etc/os-release")
+		require.NoError(t, err)
+		require.Equal(t, `ID=acme
+PRETTY_NAME="Acme Linux (wolfi based)"
+VARIANT_ID=fips
+`, string(b))
+	})
+
+	t.Run("follows symlink", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/etc", 0o755))
+		require.NoError(t, fsys.MkdirAll("/usr/lib", 0o755))
+		require.NoError(t, fsys.WriteFile("/usr/lib/os-release", []byte("ID=alpine\nVERSION_ID=3.22.0\n"), 0o644))
+		require.NoError(t, fsys.Symlink("../usr/lib/os-release", "/etc/os-release"))
+
+		require.NoError(t, generateOSRelease(fsys, ic))
+
+		target, err := fsys.Readlink("/etc/os-release")
+		require.NoError(t, err)
+		require.Equal(t, "../usr/lib/os-release", target)
+
+		b, err := fsys.ReadFile("/usr/lib/os-release")
+		require.NoError(t, err)
+		require.Equal(t, "ID=acme\nVERSION_ID=3.22.0\nPRETTY_NAME=\"Acme Linux (wolfi based)\"\nVARIANT_ID=fips\n", string(b))
+	})
+
+	t.Run("no stanza leaves file alone", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, generateOSRelease(fsys, &types.ImageConfiguration{}))
+		_, err := fsys.Stat("/etc/os-release")
+		require.Error(t, err)
+	})
+}
+
+func TestQuoteOSReleaseValue(t *testing.T) {
+	for in, want := range map[string]string{
+		"wolfi":          "wolfi",
+		"20230201":       "20230201",
+		"1.2-r3":         "1.2-r3",
+		"":               `""`,
+		"Wolfi Linux":    `"Wolfi Linux"`,
+		`say "hi" $HOME`: `"say \"hi\" \$HOME"`,
+	} {
+		require.Equal(t, want, quoteOSReleaseValue(in), in)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// remoteFilesForArch returns the remote files of the image configuration
+// installed for the architecture.
+func remoteFilesForArch(remoteFiles []types.RemoteFile, arch types.Architecture) []types.RemoteFile {
+	var files []types.RemoteFile
+	for _, rf := range remoteFiles {
+		if len(rf.Archs) == 0 || slices.Contains(rf.Archs, arch) {
+			files = append(files, rf)
+		}
+	}
+	return files
+}
+
+// remoteFileDestination returns the path in the image, without a leading
+// slash, a remote file which is not extracted is installed at.
+func remoteFileDestination(rf types.RemoteFile) string {
+	dst := strings.TrimPrefix(path.Clean(rf.Destination), "/")
+	if strings.HasSuffix(rf.Destination, "/") {
+		if u, err := url.Parse(rf.URL); err == nil {
+			dst = path.Join(dst, path.Base(u.Path))
+		}
+	}
+	return dst
+}
+
+// installRemoteFiles fetches the remote files of the image configuration
+// for the architecture, verifying their digests, and installs or extracts
+// them into the image.
+func (bc *Context) installRemoteFiles(ctx context.Context) ([]soptions.RemoteFile, error) {
+	log := clog.FromContext(ctx)
+
+	var installed []soptions.RemoteFile
+	for _, rf := range remoteFilesForArch(bc.ic.Contents.RemoteFiles, bc.Arch()) {
+		u, err := url.Parse(rf.URL)
+		if err != nil {
+			return nil, err
+		}
+		data, err := bc.apk.FetchFile(ctx, rf.URL, rf.SHA256)
+		if err != nil {
+			return nil, fmt.Errorf("fetching remote file: %w", err)
+		}
+		f := soptions.RemoteFile{URL: u.Redacted(), SHA256: rf.SHA256}
+		if rf.Extract {
+			f.Path = strings.TrimPrefix(path.Clean(rf.Destination), "/")
+			f.Files, err = extractArchive(bc.fs, rf, data)
+			if err != nil {
+				return nil, fmt.Errorf("extracting %s: %w", u.Redacted(), err)
+			}
+			log.Debugf("extracted %d files of %s to %s", len(f.Files), u.Redacted(), rf.Destination)
+		} else {
+			f.Path = remoteFileDestination(rf)
+			perms := rf.Permissions
+			if perms == 0 {
+				perms = 0755
+			}
+			if err := writeRemoteFile(bc.fs, f.Path, data, fs.FileMode(perms), rf); err != nil {
+				return nil, fmt.Errorf("installing %s: %w", u.Redacted(), err)
+			}
+		}
+		installed = append(installed, f)
+	}
+	return installed, nil
+}
+
+func writeRemoteFile(fsys apkfs.FullFS, name string, data []byte, perms fs.FileMode, rf types.RemoteFile) error {
+	if err := ensureParentDirectory(fsys, name); err != nil {
+		return err
+	}
+	if err := removeExisting(fsys, name); err != nil {
+		return err
+	}
+	if err := fsys.WriteFile(name, data, perms); err != nil {
+		return err
+	}
+	return mutatePermissionsDirect(fsys, name, uint32(perms), rf.UID, rf.GID)
+}
+
+// extractArchive extracts a tar or zip archive under the destination of the
+// remote file, returning the regular files it extracted.
+func extractArchive(fsys apkfs.FullFS, rf types.RemoteFile, data []byte) ([]soptions.LocalFile, error) {
+	if bytes.HasPrefix(data, zipMagic) {
+		return extractZip(fsys, rf, data)
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.HasPrefix(data, zstdMagic):
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	var files []soptions.LocalFile
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, ok := extractedPath(rf, hdr.Name)
+		if !ok {
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := extractDir(fsys, name, rf); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			if err := writeRemoteFile(fsys, name, content, hdr.FileInfo().Mode().Perm(), rf); err != nil {
+				return nil, err
+			}
+			files = append(files, extractedFile(name, hdr.Name, content))
+		case tar.TypeSymlink:
+			if err := ensureParentDirectory(fsys, name); err != nil {
+				return nil, err
+			}
+			if err := removeExisting(fsys, name); err != nil {
+				return nil, err
+			}
+			if err := fsys.Symlink(hdr.Linkname, name); err != nil {
+				return nil, err
+			}
+		case tar.TypeLink:
+			target, ok := extractedPath(rf, hdr.Linkname)
+			if !ok {
+				return nil, fmt.Errorf("hardlink %s points outside of the extracted files", hdr.Name)
+			}
+			if err := removeExisting(fsys, name); err != nil {
+				return nil, err
+			}
+			if err := fsys.Link(target, name); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s has unsupported type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+	return files, nil
+}
+
+func extractZip(fsys apkfs.FullFS, rf types.RemoteFile, data []byte) ([]soptions.LocalFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var files []soptions.LocalFile
+	for _, zf := range zr.File {
+		name, ok := extractedPath(rf, zf.Name)
+		if !ok {
+			continue
+		}
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			if err := extractDir(fsys, name, rf); err != nil {
+				return nil, err
+			}
+		case mode.IsRegular():
+			content, err := readZipFile(zf)
+			if err != nil {
+				return nil, err
+			}
+			perms := mode.Perm()
+			if perms == 0 {
+				// Zip files made on Windows have no permissions.
+				perms = 0644
+			}
+			if err := writeRemoteFile(fsys, name, content, perms, rf); err != nil {
+				return nil, err
+			}
+			files = append(files, extractedFile(name, zf.Name, content))
+		case mode&fs.ModeSymlink != 0:
+			target, err := readZipFile(zf)
+			if err != nil {
+				return nil, err
+			}
+			if err := ensureParentDirectory(fsys, name); err != nil {
+				return nil, err
+			}
+			if err := removeExisting(fsys, name); err != nil {
+				return nil, err
+			}
+			if err := fsys.Symlink(string(target), name); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%s has unsupported type %s", zf.Name, mode.Type())
+		}
+	}
+	return files, nil
+}
+
+func readZipFile(zf *zip.File) ([]byte, error) {
+	r, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func extractDir(fsys apkfs.FullFS, name string, rf types.RemoteFile) error {
+	if err := fsys.MkdirAll(name, 0755); err != nil {
+		return err
+	}
+	return mutatePermissionsDirect(fsys, name, 0755, rf.UID, rf.GID)
+}
+
+// extractedPath returns the path in the image, without a leading slash, the
+// archive entry name is extracted to, or false when stripping leading
+// directories leaves nothing of it. Entries can't escape the destination.
+func extractedPath(rf types.RemoteFile, name string) (string, bool) {
+	elems := strings.Split(strings.Trim(path.Clean("/"+name), "/"), "/")
+	if len(elems) <= rf.StripComponents || elems[0] == "" {
+		return "", false
+	}
+	return strings.TrimPrefix(path.Join(rf.Destination, path.Join(elems[rf.StripComponents:]...)), "/"), true
+}
+
+func extractedFile(name, source string, content []byte) soptions.LocalFile {
+	sum := sha256.Sum256(content)
+	return soptions.LocalFile{Path: name, Source: source, SHA256: hex.EncodeToString(sum[:])}
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestExtractedPath(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		strip int
+		want  string
+	}{
+		{name: "tool-1.0/bin/tool", strip: 1, want: "opt/tool/bin/tool"},
+		{name: "./tool-1.0/bin/tool", strip: 1, want: "opt/tool/bin/tool"},
+		{name: "bin/tool", want: "opt/tool/bin/tool"},
+		{name: "../../etc/passwd", want: "opt/tool/etc/passwd"},
+		{name: "tool-1.0/", strip: 1},
+		{name: "./"},
+	} {
+		got, ok := extractedPath(types.RemoteFile{Destination: "/opt/tool", StripComponents: tc.strip}, tc.name)
+		require.Equal(t, tc.want != "", ok, tc.name)
+		require.Equal(t, tc.want, got, tc.name)
+	}
+}
+
+func TestInstallRemoteFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	binary := []byte("\x7fELF static binary")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tool"), binary, 0o644))
+
+	var tgz bytes.Buffer
+	gw := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range []*tar.Header{
+		{Name: "tool-1.0/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "tool-1.0/bin/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "tool-1.0/bin/tool", Typeflag: tar.TypeReg, Mode: 0o755, Size: int64(len(binary))},
+		{Name: "tool-1.0/bin/t", Typeflag: tar.TypeSymlink, Linkname: "tool"},
+	} {
+		require.NoError(t, tw.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := tw.Write(binary)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tool.tar.gz"), tgz.Bytes(), 0o644))
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	zh := &zip.FileHeader{Name: "README", Method: zip.Deflate}
+	zh.SetMode(0o644)
+	w, err := zw.CreateHeader(zh)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("readme"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs.zip"), zipped.Bytes(), 0o644))
+
+	fsys := apkfs.NewMemFS()
+	a, err := apk.New(ctx, apk.WithFS(fsys))
+	require.NoError(t, err)
+	bc := &Context{
+		fs:  fsys,
+		apk: a,
+		o:   options.Options{Arch: types.ParseArchitecture("x86_64")},
+		ic: types.ImageConfiguration{Contents: types.ImageContents{RemoteFiles: []types.RemoteFile{{
+			URL:         "file://" + filepath.Join(dir, "tool"),
+			SHA256:      sha256Hex(binary),
+			Destination: "/usr/bin/",
+			UID:         65532,
+		}, {
+			URL:             "file://" + filepath.Join(dir, "tool.tar.gz"),
+			SHA256:          sha256Hex(tgz.Bytes()),
+			Destination:     "/opt/tool",
+			Extract:         true,
+			StripComponents: 1,
+		}, {
+			URL:         "file://" + filepath.Join(dir, "docs.zip"),
+			SHA256:      sha256Hex(zipped.Bytes()),
+			Destination: "/usr/share/doc/tool",
+			Extract:     true,
+		}, {
+			URL:         "file://" + filepath.Join(dir, "tool"),
+			SHA256:      sha256Hex(binary),
+			Destination: "/usr/bin/arm-only",
+			Archs:       []types.Architecture{types.ParseArchitecture("aarch64")},
+		}}}},
+	}
+
+	installed, err := bc.installRemoteFiles(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []soptions.RemoteFile{{
+		URL:    "file://" + filepath.Join(dir, "tool"),
+		SHA256: sha256Hex(binary),
+		Path:   "usr/bin/tool",
+	}, {
+		URL:    "file://" + filepath.Join(dir, "tool.tar.gz"),
+		SHA256: sha256Hex(tgz.Bytes()),
+		Path:   "opt/tool",
+		Files:  []soptions.LocalFile{{Path: "opt/tool/bin/tool", Source: "tool-1.0/bin/tool", SHA256: sha256Hex(binary)}},
+	}, {
+		URL:    "file://" + filepath.Join(dir, "docs.zip"),
+		SHA256: sha256Hex(zipped.Bytes()),
+		Path:   "usr/share/doc/tool",
+		Files:  []soptions.LocalFile{{Path: "usr/share/doc/tool/README", Source: "README", SHA256: sha256Hex([]byte("readme"))}},
+	}}, installed)
+
+	for name, mode := range map[string]fs.FileMode{
+		"usr/bin/tool":              0o755,
+		"opt/tool/bin/tool":         0o755,
+		"usr/share/doc/tool/README": 0o644,
+	} {
+		info, err := fsys.Stat(name)
+		require.NoError(t, err, name)
+		require.Equal(t, mode, info.Mode(), name)
+	}
+	target, err := fsys.Readlink("opt/tool/bin/t")
+	require.NoError(t, err)
+	require.Equal(t, "tool", target)
+	_, err = fsys.Stat("usr/bin/arm-only")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	bc.ic.Contents.RemoteFiles = []types.RemoteFile{{
+		URL:         "file://" + filepath.Join(dir, "tool"),
+		SHA256:      sha256Hex([]byte("something else")),
+		Destination: "/usr/bin/tool",
+	}}
+	_, err = bc.installRemoteFiles(ctx)
+	require.ErrorContains(t, err, "the sha256 digest of")
+}
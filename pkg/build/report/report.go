@@ -0,0 +1,293 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package report records how long the phases of a build take, from the spans
+// apko and its apk implementation already emit, so that builds can be timed
+// without a tracing backend. It also records the files whose ownership or
+// permissions the build normalized.
+package report
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// Phase is a phase of a build.
+type Phase string
+
+const (
+	// PhaseInit initializes the apk database.
+	PhaseInit Phase = "init"
+	// PhaseKeys fetches and installs the keyring.
+	PhaseKeys Phase = "keys"
+	// PhaseIndexes fetches and verifies the repository indexes.
+	PhaseIndexes Phase = "indexes"
+	// PhaseResolve resolves the packages to install, including the index
+	// fetches it triggers.
+	PhaseResolve Phase = "resolve"
+	// PhaseFetch fetches and expands each package.
+	PhaseFetch Phase = "fetch"
+	// PhaseInstall installs each package.
+	PhaseInstall Phase = "install"
+	// PhaseTar writes the layers.
+	PhaseTar Phase = "tar"
+	// PhaseSBOM generates the SBOMs.
+	PhaseSBOM Phase = "sbom"
+	// PhasePublish pushes the images.
+	PhasePublish Phase = "publish"
+)
+
+// phases maps the names of the spans to the phase they time.
+var phases = map[string]Phase{
+	"InitDB":                 PhaseInit,
+	"InitKeyring":            PhaseKeys,
+	"GetRepositoryIndexes":   PhaseIndexes,
+	"ResolveWorld":           PhaseResolve,
+	"expandPackage":          PhaseFetch,
+	"installPackage":         PhaseInstall,
+	"writeTar":               PhaseTar,
+	"splitLayers":            PhaseTar,
+	"GenerateImageSBOM":      PhaseSBOM,
+	"GenerateIndexSBOM":      PhaseSBOM,
+	"PublishImagesFromIndex": PhasePublish,
+}
+
+// Report is the timing report of a build.
+type Report struct {
+	Started    time.Time `json:"started"`
+	DurationMS int64     `json:"duration_ms"`
+	// Phases are the timings of each phase, per architecture for those which
+	// run per architecture.
+	Phases []PhaseTiming `json:"phases"`
+	// Packages are the timings of each package.
+	Packages []PackageTiming `json:"packages,omitempty"`
+	// Normalized are the files whose ownership or permissions the
+	// permissions policy of the build changed.
+	Normalized []Normalization `json:"normalized,omitempty"`
+}
+
+// PhaseTiming is the timing of a phase.
+type PhaseTiming struct {
+	Phase Phase  `json:"phase"`
+	Arch  string `json:"arch,omitempty"`
+	// Count is how many times the phase ran, e.g. once per package.
+	Count int `json:"count"`
+	// DurationMS is the wall time spent in the phase, which counts
+	// concurrent runs once.
+	DurationMS int64 `json:"duration_ms"`
+}
+
+// PackageTiming is the timing of a package.
+type PackageTiming struct {
+	Name          string `json:"name"`
+	Arch          string `json:"arch,omitempty"`
+	FetchExpandMS int64  `json:"fetch_expand_ms"`
+	InstallMS     int64  `json:"install_ms"`
+}
+
+// Normalization is a change the permissions policy of a build made to a file
+// installed from a package.
+type Normalization = apk.Normalization
+
+// WriteFile writes the report to path as JSON.
+func (r *Report) WriteFile(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("writing build report: %w", err)
+	}
+	return nil
+}
+
+// Recorder is an OpenTelemetry span processor which records the timings of
+// the phases of a build, for a tracer provider such as
+//
+//	sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+//
+// It is also an apk.NormalizationRecorder, for build.WithNormalizationRecorder,
+// which records the files the build normalized.
+type Recorder struct {
+	started time.Time
+
+	mu         sync.Mutex
+	running    map[trace.SpanID]Phase
+	spans      []span
+	normalized []Normalization
+}
+
+type span struct {
+	phase      Phase
+	arch, pkg  string
+	start, end time.Time
+}
+
+// NewRecorder returns a Recorder, whose report starts now.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		started: time.Now(),
+		running: map[trace.SpanID]Phase{},
+	}
+}
+
+func (r *Recorder) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	phase, ok := phases[s.Name()]
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.running[s.SpanContext().SpanID()] = phase
+}
+
+func (r *Recorder) OnEnd(s sdktrace.ReadOnlySpan) {
+	phase, ok := phases[s.Name()]
+	if !ok {
+		return
+	}
+	sp := span{phase: phase, start: s.StartTime(), end: s.EndTime()}
+	for _, kv := range s.Attributes() {
+		switch kv.Key {
+		case "arch":
+			sp.arch = kv.Value.AsString()
+		case "package":
+			sp.pkg = kv.Value.AsString()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.running, s.SpanContext().SpanID())
+	// A span nested in a span of the same phase, such as the index fetches
+	// of GetRepositoryIndexes, is part of its parent.
+	if r.running[s.Parent().SpanID()] == phase {
+		return
+	}
+	r.spans = append(r.spans, sp)
+}
+
+func (r *Recorder) RecordNormalization(n apk.Normalization) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.normalized = append(r.normalized, n)
+}
+
+func (r *Recorder) Shutdown(context.Context) error { return nil }
+
+func (r *Recorder) ForceFlush(context.Context) error { return nil }
+
+// Report returns the timings recorded so far.
+func (r *Recorder) Report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rep := &Report{
+		Started:    r.started,
+		DurationMS: time.Since(r.started).Milliseconds(),
+	}
+
+	type phaseKey struct {
+		phase Phase
+		arch  string
+	}
+	byPhase := map[phaseKey][]span{}
+	type pkgKey struct{ name, arch string }
+	byPkg := map[pkgKey]*PackageTiming{}
+	for _, sp := range r.spans {
+		k := phaseKey{sp.phase, sp.arch}
+		byPhase[k] = append(byPhase[k], sp)
+
+		if sp.pkg == "" || (sp.phase != PhaseFetch && sp.phase != PhaseInstall) {
+			continue
+		}
+		pk := pkgKey{sp.pkg, sp.arch}
+		pt, ok := byPkg[pk]
+		if !ok {
+			pt = &PackageTiming{Name: sp.pkg, Arch: sp.arch}
+			byPkg[pk] = pt
+		}
+		if sp.phase == PhaseFetch {
+			pt.FetchExpandMS += sp.end.Sub(sp.start).Milliseconds()
+		} else {
+			pt.InstallMS += sp.end.Sub(sp.start).Milliseconds()
+		}
+	}
+
+	for k, spans := range byPhase {
+		rep.Phases = append(rep.Phases, PhaseTiming{
+			Phase:      k.phase,
+			Arch:       k.arch,
+			Count:      len(spans),
+			DurationMS: wallTime(spans).Milliseconds(),
+		})
+	}
+	slices.SortFunc(rep.Phases, func(a, b PhaseTiming) int {
+		return cmp.Or(
+			cmp.Compare(phaseOrder(a.Phase), phaseOrder(b.Phase)),
+			cmp.Compare(a.Arch, b.Arch))
+	})
+
+	for _, pt := range byPkg {
+		rep.Packages = append(rep.Packages, *pt)
+	}
+	slices.SortFunc(rep.Packages, func(a, b PackageTiming) int {
+		return cmp.Or(cmp.Compare(a.Arch, b.Arch), cmp.Compare(a.Name, b.Name))
+	})
+
+	rep.Normalized = slices.Clone(r.normalized)
+	slices.SortFunc(rep.Normalized, func(a, b Normalization) int {
+		return cmp.Or(cmp.Compare(a.Arch, b.Arch), cmp.Compare(a.Path, b.Path), cmp.Compare(a.Package, b.Package))
+	})
+	return rep
+}
+
+// phaseOrder orders the phases as they run in a build.
+func phaseOrder(p Phase) int {
+	return slices.Index([]Phase{PhaseInit, PhaseKeys, PhaseIndexes, PhaseResolve, PhaseFetch, PhaseInstall, PhaseTar, PhaseSBOM, PhasePublish}, p)
+}
+
+// wallTime returns the time covered by the spans, counting overlapping spans
+// once.
+func wallTime(spans []span) time.Duration {
+	spans = slices.Clone(spans)
+	slices.SortFunc(spans, func(a, b span) int { return a.start.Compare(b.start) })
+
+	var (
+		total      time.Duration
+		start, end time.Time
+	)
+	for i, sp := range spans {
+		if i == 0 || sp.start.After(end) {
+			total += end.Sub(start)
+			start, end = sp.start, sp.end
+			continue
+		}
+		if sp.end.After(end) {
+			end = sp.end
+		}
+	}
+	return total + end.Sub(start)
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tracer := tp.Tracer("test")
+
+	t0 := time.Now()
+	at := func(ms int) trace.SpanStartEventOption {
+		return trace.WithTimestamp(t0.Add(time.Duration(ms) * time.Millisecond))
+	}
+	end := func(ms int) trace.SpanEndOption {
+		return trace.WithTimestamp(t0.Add(time.Duration(ms) * time.Millisecond))
+	}
+	pkg := func(name string) trace.SpanStartOption {
+		return trace.WithAttributes(attribute.String("package", name), attribute.String("arch", "x86_64"))
+	}
+
+	ctx := context.Background()
+	// Two concurrent index fetches, the first of which nests another.
+	ctx1, idx1 := tracer.Start(ctx, "GetRepositoryIndexes", at(0), trace.WithAttributes(attribute.String("arch", "x86_64")))
+	_, nested := tracer.Start(ctx1, "GetRepositoryIndexes", at(1))
+	_, idx2 := tracer.Start(ctx, "GetRepositoryIndexes", at(5), trace.WithAttributes(attribute.String("arch", "x86_64")))
+	nested.End(end(9))
+	idx1.End(end(10))
+	idx2.End(end(20))
+
+	_, fetch := tracer.Start(ctx, "expandPackage", at(20), pkg("busybox"))
+	fetch.End(end(50))
+	_, install := tracer.Start(ctx, "installPackage", at(50), pkg("busybox"))
+	rec.RecordNormalization(apk.Normalization{Package: "busybox", Arch: "x86_64", Path: "/bin/su", Setuid: true})
+	rec.RecordNormalization(apk.Normalization{Package: "busybox", Arch: "x86_64", Path: "/bin/app", UID: 65532, GID: 65532})
+	install.End(end(55))
+	_, sbom := tracer.Start(ctx, "GenerateIndexSBOM", at(60))
+	sbom.End(end(70))
+	_, other := tracer.Start(ctx, "parseRepositoryIndex", at(0))
+	other.End(end(100))
+
+	rep := rec.Report()
+	require.Equal(t, []PhaseTiming{
+		{Phase: PhaseIndexes, Arch: "x86_64", Count: 2, DurationMS: 20},
+		{Phase: PhaseFetch, Arch: "x86_64", Count: 1, DurationMS: 30},
+		{Phase: PhaseInstall, Arch: "x86_64", Count: 1, DurationMS: 5},
+		{Phase: PhaseSBOM, Count: 1, DurationMS: 10},
+	}, rep.Phases)
+	require.Equal(t, []PackageTiming{
+		{Name: "busybox", Arch: "x86_64", FetchExpandMS: 30, InstallMS: 5},
+	}, rep.Packages)
+	require.Equal(t, []Normalization{
+		{Package: "busybox", Arch: "x86_64", Path: "/bin/app", UID: 65532, GID: 65532},
+		{Package: "busybox", Arch: "x86_64", Path: "/bin/su", Setuid: true},
+	}, rep.Normalized)
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, rep.WriteFile(path))
+}
+
+func TestWallTime(t *testing.T) {
+	t0 := time.Now()
+	s := func(start, end int) span {
+		return span{start: t0.Add(time.Duration(start) * time.Second), end: t0.Add(time.Duration(end) * time.Second)}
+	}
+	for _, tc := range []struct {
+		name  string
+		spans []span
+		want  time.Duration
+	}{
+		{"none", nil, 0},
+		{"one", []span{s(1, 3)}, 2 * time.Second},
+		{"disjoint", []span{s(5, 6), s(1, 3)}, 3 * time.Second},
+		{"overlapping", []span{s(1, 4), s(2, 6)}, 5 * time.Second},
+		{"contained", []span{s(1, 10), s(2, 3), s(12, 13)}, 10 * time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, wallTime(tc.spans))
+		})
+	}
+}
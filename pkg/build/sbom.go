@@ -61,7 +61,10 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 
 	sopt.ImageInfo.SourceDateEpoch = bde
 	sopt.Formats = o.SBOMFormats
+	sopt.IncludeFiles = o.SBOMFiles
+	sopt.Processors = o.SBOMProcessors
 	sopt.ImageInfo.VCSUrl = ic.VCSUrl
+	sopt.ImageInfo.ConfigDigest = o.ConfigDigest
 	sopt.ImageInfo.ImageMediaType = ggcrtypes.OCIManifestSchema1
 
 	sopt.OutputDir = o.TempDir()
@@ -78,30 +81,63 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 
 	_, span := otel.Tracer("apko").Start(ctx, "GenerateImageSBOM")
 	defer span.End()
+	defer bc.metrics.observe(arch, "sbom", time.Now())
 
 	if !bc.WantSBOM() {
 		log.Warnf("skipping SBOM generation")
 		return nil, nil
 	}
 
+	log.Debug("Generating image SBOM")
+	s, err := bc.imageSBOMOptions(ctx, arch, img)
+	if err != nil {
+		return nil, err
+	}
+	h, err := v1.NewHash(s.ImageInfo.ImageDigest)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s image digest: %w", arch, err)
+	}
+
+	var sboms = make([]types.SBOM, 0)
+	generators := generator.Generators(bc.fs)
+	for _, format := range s.Formats {
+		gen, ok := generators[format]
+		if !ok {
+			return nil, fmt.Errorf("unable to generate sboms: no generator available for format %s", format)
+		}
+
+		filename := filepath.Join(s.OutputDir, s.FileName+"."+gen.Ext())
+		if err := gen.Generate(ctx, &s, filename); err != nil {
+			return nil, fmt.Errorf("generating %s sbom: %w", format, err)
+		}
+		sboms = append(sboms, types.SBOM{
+			Path:   filename,
+			Format: format,
+			Arch:   arch.String(),
+			Digest: h,
+		})
+	}
+	return sboms, nil
+}
+
+// imageSBOMOptions returns the options describing the image built for arch.
+func (bc *Context) imageSBOMOptions(ctx context.Context, arch types.Architecture, img v1.Image) (soptions.Options, error) {
 	bde, err := bc.GetBuildDateEpoch()
 	if err != nil {
-		return nil, fmt.Errorf("computing build date epoch: %w", err)
+		return soptions.Options{}, fmt.Errorf("computing build date epoch: %w", err)
 	}
 
 	m, err := img.Manifest()
 	if err != nil {
-		return nil, fmt.Errorf("getting %s manifest: %w", arch, err)
+		return soptions.Options{}, fmt.Errorf("getting %s manifest: %w", arch, err)
 	}
 
 	s := newSBOM(ctx, bc.fs, bc.o, bc.ic, bde)
-	log.Debug("Generating image SBOM")
-
 	s.ImageInfo.Layers = m.Layers
 
 	info, err := fetchFSReleaseData(bc.fs)
 	if err != nil {
-		return nil, fmt.Errorf("reading release data: %w", err)
+		return soptions.Options{}, fmt.Errorf("reading release data: %w", err)
 	}
 
 	s.OS.Name = info.Name
@@ -110,40 +146,33 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 
 	pkgs, err := bc.apk.GetInstalled()
 	if err != nil {
-		return nil, fmt.Errorf("reading apk package index: %w", err)
+		return soptions.Options{}, fmt.Errorf("reading apk package index: %w", err)
 	}
 
 	s.Packages = pkgs
+	s.LicenseFiles = bc.licenseFiles
+	s.LocalFiles = bc.localFiles
+	s.RemoteFiles = bc.remoteFiles
+	s.PackageSignatures = bc.apk.PackageSignatureVerifications()
+	s.IndexSignatures = bc.apk.IndexSignatureVerifications()
+
+	for _, f := range bc.appliedFixups {
+		s.BuildTools = append(s.BuildTools, soptions.BuildTool{
+			Name:        "apko-fixup-" + f.Name,
+			Description: f.Description,
+		})
+	}
 
 	// Get the image digest
 	h, err := img.Digest()
 	if err != nil {
-		return nil, fmt.Errorf("getting %s image digest: %w", arch, err)
+		return soptions.Options{}, fmt.Errorf("getting %s image digest: %w", arch, err)
 	}
 
 	s.ImageInfo.ImageDigest = h.String()
 	s.ImageInfo.Arch = arch
 
-	var sboms = make([]types.SBOM, 0)
-	generators := generator.Generators(bc.fs)
-	for _, format := range s.Formats {
-		gen, ok := generators[format]
-		if !ok {
-			return nil, fmt.Errorf("unable to generate sboms: no generator available for format %s", format)
-		}
-
-		filename := filepath.Join(s.OutputDir, s.FileName+"."+gen.Ext())
-		if err := gen.Generate(ctx, &s, filename); err != nil {
-			return nil, fmt.Errorf("generating %s sbom: %w", format, err)
-		}
-		sboms = append(sboms, types.SBOM{
-			Path:   filename,
-			Format: format,
-			Arch:   arch.String(),
-			Digest: h,
-		})
-	}
-	return sboms, nil
+	return s, nil
 }
 
 type ReleaseData struct {
@@ -249,7 +278,8 @@ func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageCon
 		archImageInfos := make([]soptions.ArchImageInfo, 0, len(archs))
 		for _, arch := range archs {
 			i := imgs[arch]
-			sbomHash, err := khash.SHA256ForFile(filepath.Join(s.OutputDir, fmt.Sprintf("sbom-%s.%s", arch.ToAPK(), gen.Ext())))
+			sbomPath := filepath.Join(s.OutputDir, fmt.Sprintf("sbom-%s.%s", arch.ToAPK(), gen.Ext()))
+			sbomHash, err := khash.SHA256ForFile(sbomPath)
 			if err != nil {
 				return nil, fmt.Errorf("checksumming %s SBOM: %w", arch, err)
 			}
@@ -263,13 +293,15 @@ func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageCon
 				Digest:     d,
 				Arch:       arch,
 				SBOMDigest: sbomHash,
+				SBOMPath:   sbomPath,
+				Platform:   ic.OCIPlatform(arch),
 			}
 			archImageInfos = append(archImageInfos, info)
 		}
 		s.ImageInfo.Images = archImageInfos
 
 		filename := filepath.Join(s.OutputDir, "sbom-index."+gen.Ext())
-		if err := gen.GenerateIndex(&s, filename); err != nil {
+		if err := gen.GenerateIndexContext(ctx, &s, filename); err != nil {
 			return nil, fmt.Errorf("generating %s sbom: %w", format, err)
 		}
 		sboms = append(sboms, types.SBOM{
@@ -15,6 +15,7 @@
 package build
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -22,6 +23,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
 )
 
 func TestFetchFSReleaseData(t *testing.T) {
@@ -63,3 +67,36 @@ func TestBadFSReleaseData(t *testing.T) {
 	_, err := fetchFSReleaseData(fsys)
 	require.Error(t, err)
 }
+
+func TestSBOMFormatsFromConfig(t *testing.T) {
+	ic := types.ImageConfiguration{SBOMFormats: []string{"spdx", "cyclonedx"}}
+
+	o, _, err := NewOptions(WithImageConfiguration(ic), WithSBOMFormats([]string{"spdx"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"spdx"}, o.SBOMFormats)
+
+	o, _, err = NewOptions(WithImageConfiguration(ic), WithSBOMFormats([]string{"spdx"}), WithConfigSBOMFormats())
+	require.NoError(t, err)
+	require.Equal(t, []string{"spdx", "cyclonedx"}, o.SBOMFormats)
+
+	o, _, err = NewOptions(WithImageConfiguration(types.ImageConfiguration{}), WithSBOMFormats([]string{"spdx"}), WithConfigSBOMFormats())
+	require.NoError(t, err)
+	require.Equal(t, []string{"spdx"}, o.SBOMFormats)
+}
+
+func TestWithSBOMProcessors(t *testing.T) {
+	var calls []string
+	processor := func(name string) sbom.Processor {
+		return sbom.ProcessorFunc(func(context.Context, string, any, *soptions.Options) error {
+			calls = append(calls, name)
+			return nil
+		})
+	}
+
+	o, ic, err := NewOptions(WithImageConfiguration(types.ImageConfiguration{}), WithSBOMProcessors(processor("a")), WithSBOMProcessors(processor("b")))
+	require.NoError(t, err)
+
+	s := newSBOM(t.Context(), nil, *o, *ic, o.SourceDateEpoch)
+	require.NoError(t, s.Process(t.Context(), "spdx", nil))
+	require.Equal(t, []string{"a", "b"}, calls)
+}
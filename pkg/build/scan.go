@@ -0,0 +1,66 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/scan"
+)
+
+// WantScan returns whether a scanner was given to scan the image with.
+func (bc *Context) WantScan() bool {
+	return bc.o.Scanner != nil
+}
+
+// Scan scans the image built for arch, with the SBOMs generated for it, and
+// fails if the scanner finds vulnerabilities of at least the severity the
+// build fails on.
+func (bc *Context) Scan(ctx context.Context, arch types.Architecture, img v1.Image, sboms []types.SBOM) error {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "Scan")
+	defer span.End()
+
+	vulns, err := bc.o.Scanner.Scan(ctx, scan.Target{
+		Arch:  arch,
+		Image: img,
+		SBOMs: sboms,
+		FS:    bc.fs,
+	})
+	if err != nil {
+		return fmt.Errorf("scanning the %s image: %w", arch.ToAPK(), err)
+	}
+	log.Infof("vulnerabilities found in the %s image: %s", arch.ToAPK(), scan.Summarize(vulns))
+
+	if bc.o.ScanFailOn == nil {
+		return nil
+	}
+	failing := scan.AtLeast(vulns, *bc.o.ScanFailOn)
+	if len(failing) == 0 {
+		return nil
+	}
+	found := make([]string, 0, len(failing))
+	for _, v := range failing {
+		found = append(found, v.String())
+	}
+	return fmt.Errorf("the %s image has vulnerabilities of severity %s or above:\n  %s", arch.ToAPK(), *bc.o.ScanFailOn, strings.Join(found, "\n  "))
+}
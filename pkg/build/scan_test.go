@@ -0,0 +1,83 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/scan"
+)
+
+type scannerFunc func(ctx context.Context, t scan.Target) ([]scan.Vulnerability, error)
+
+func (f scannerFunc) Scan(ctx context.Context, t scan.Target) ([]scan.Vulnerability, error) {
+	return f(ctx, t)
+}
+
+func TestScan(t *testing.T) {
+	amd64 := types.ParseArchitecture("amd64")
+	sboms := []types.SBOM{{Arch: "x86_64", Path: "/sboms/sbom-x86_64.spdx.json", Format: "spdx"}}
+	vulns := []scan.Vulnerability{
+		{ID: "CVE-2024-0001", Package: "openssl", Version: "3.2.0-r0", Severity: scan.SeverityHigh, FixedIn: "3.2.1-r0"},
+		{ID: "CVE-2024-0002", Package: "zlib", Version: "1.3-r2", Severity: scan.SeverityLow},
+	}
+
+	for _, tt := range []struct {
+		name    string
+		failOn  string
+		wantErr string
+	}{{
+		name: "report only",
+	}, {
+		name:   "below threshold",
+		failOn: "severity>=critical",
+	}, {
+		name:    "at threshold",
+		failOn:  "severity>=high",
+		wantErr: "the x86_64 image has vulnerabilities of severity high or above:\n  CVE-2024-0001 (high) in openssl 3.2.0-r0, fixed in 3.2.1-r0",
+	}, {
+		name:    "above threshold",
+		failOn:  "low",
+		wantErr: "the x86_64 image has vulnerabilities of severity low or above:\n  CVE-2024-0001 (high) in openssl 3.2.0-r0, fixed in 3.2.1-r0\n  CVE-2024-0002 (low) in zlib 1.3-r2",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got scan.Target
+			s := scannerFunc(func(_ context.Context, t scan.Target) ([]scan.Vulnerability, error) {
+				got = t
+				return vulns, nil
+			})
+			bc := &Context{o: options.Options{Arch: amd64}}
+			require.NoError(t, WithScan(s, tt.failOn)(bc))
+			require.True(t, bc.WantScan())
+
+			err := bc.Scan(context.Background(), amd64, nil, sboms)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, amd64, got.Arch)
+			require.Equal(t, sboms, got.SBOMs)
+		})
+	}
+
+	require.ErrorContains(t, WithScan(nil, "severity>=severe")(&Context{}), `unknown severity "severe"`)
+	require.False(t, (&Context{}).WantScan())
+}
@@ -0,0 +1,148 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// SearchResult is a package of the repositories found by a search.
+type SearchResult struct {
+	// Name is the name of the package.
+	Name string
+	// Version is the latest version of the package in the repository.
+	Version string
+	// Repository is the index of the repository the package is in.
+	Repository string
+	// Match is what matched the search: the name of the package, one of its
+	// provides, or the path of a file in the contents database of the
+	// repository.
+	Match string
+}
+
+// SearchPackages returns the latest version of the packages of the
+// repositories whose name matches the glob pattern, as path.Match.
+func (bc *Context) SearchPackages(ctx context.Context, pattern string) ([]SearchResult, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	indexes, err := bc.RepositoryIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var results []SearchResult
+	for _, idx := range indexes {
+		for _, pkg := range latestPackages(idx) {
+			if ok, _ := path.Match(pattern, pkg.Name); ok {
+				results = append(results, searchResult(idx, pkg, pkg.Name))
+			}
+		}
+	}
+	return sortResults(results), nil
+}
+
+// SearchFile returns the latest version of the packages of the repositories
+// which install the file. A file without a directory, or in a bin directory,
+// matches the cmd: provides of packages, and a file named like a shared
+// library matches the so: provides. The contents databases of the
+// repositories which publish one are searched for the file, or for files
+// ending with it when it is relative.
+func (bc *Context) SearchFile(ctx context.Context, file string) ([]SearchResult, error) {
+	indexes, err := bc.RepositoryIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var provides []string
+	base := path.Base(file)
+	if dir := path.Dir(file); dir == "." || path.Base(dir) == "bin" || path.Base(dir) == "sbin" {
+		provides = append(provides, "cmd:"+base)
+	}
+	if strings.Contains(base, ".so") {
+		provides = append(provides, "so:"+base)
+	}
+
+	var results []SearchResult
+	for _, idx := range indexes {
+		for _, pkg := range latestPackages(idx) {
+			for _, p := range pkg.Provides {
+				name, _, _ := strings.Cut(p, "=")
+				if slices.Contains(provides, name) {
+					results = append(results, searchResult(idx, pkg, name))
+					break
+				}
+			}
+		}
+	}
+
+	rel := strings.TrimPrefix(file, "/")
+	entries, err := bc.apk.SearchContents(ctx, indexes, func(p string) bool {
+		return p == rel || (!strings.HasPrefix(file, "/") && strings.HasSuffix(p, "/"+rel))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching contents: %w", err)
+	}
+	for _, e := range entries {
+		latest := latestPackages(e.Index)
+		for _, name := range e.Packages {
+			if pkg, ok := latest[name]; ok {
+				results = append(results, searchResult(e.Index, pkg, "/"+e.Path))
+			}
+		}
+	}
+	return sortResults(results), nil
+}
+
+// latestPackages returns the latest version of each package of idx, by name.
+func latestPackages(idx apk.NamedIndex) map[string]*apk.RepositoryPackage {
+	latest := map[string]*apk.RepositoryPackage{}
+	for _, pkg := range idx.Packages() {
+		prev, ok := latest[pkg.Name]
+		if !ok || apk.CompareVersionStrings(pkg.Version, prev.Version) > 0 {
+			latest[pkg.Name] = pkg
+		}
+	}
+	return latest
+}
+
+func searchResult(idx apk.NamedIndex, pkg *apk.RepositoryPackage, match string) SearchResult {
+	return SearchResult{
+		Name:       pkg.Name,
+		Version:    pkg.Version,
+		Repository: idx.Source(),
+		Match:      match,
+	}
+}
+
+// sortResults sorts results by name and repository, dropping the same
+// package matching more than once.
+func sortResults(results []SearchResult) []SearchResult {
+	slices.SortStableFunc(results, func(a, b SearchResult) int {
+		return cmp.Or(
+			cmp.Compare(a.Name, b.Name),
+			cmp.Compare(a.Repository, b.Repository),
+		)
+	})
+	return slices.CompactFunc(results, func(a, b SearchResult) bool {
+		return a.Name == b.Name && a.Repository == b.Repository
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestSearch(t *testing.T) {
+	ctx := t.Context()
+
+	// A copy of the test repository with a contents database.
+	repo := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(repo, "x86_64"), 0o755))
+	index, err := os.ReadFile("testdata/packages/x86_64/APKINDEX.tar.gz")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "x86_64", "APKINDEX.tar.gz"), index, 0o644))
+	f, err := os.Create(filepath.Join(repo, "x86_64", "CONTENTS.gz"))
+	require.NoError(t, err)
+	zw := gzip.NewWriter(f)
+	_, err = zw.Write([]byte("usr/bin/replay replayout\netc/os-release pretend-baselayout\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	bc, err := build.New(ctx, fs.NewMemFS(),
+		build.WithImageConfiguration(types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Keyring:             []string{"testdata/melange.rsa.pub"},
+				RuntimeRepositories: []string{repo},
+			},
+		}),
+		build.WithArch(types.ParseArchitecture("x86_64")),
+	)
+	require.NoError(t, err)
+
+	results, err := bc.SearchPackages(ctx, "pretend-*")
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "pretend-baselayout", results[0].Name)
+	require.Equal(t, "1.0.0-r0", results[0].Version)
+
+	results, err = bc.SearchPackages(ctx, "*")
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	_, err = bc.SearchPackages(ctx, "[")
+	require.Error(t, err)
+
+	for _, tc := range []struct {
+		file string
+		want []string
+	}{
+		{file: "replay", want: []string{"replayout"}},
+		{file: "bin/replay", want: []string{"replayout"}},
+		{file: "/usr/bin/replay", want: []string{"replayout"}},
+		{file: "/bin/replay"},
+		{file: "os-release", want: []string{"pretend-baselayout"}},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			results, err := bc.SearchFile(ctx, tc.file)
+			require.NoError(t, err)
+			var got []string
+			for _, r := range results {
+				got = append(got, r.Name)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+
+	results, err = bc.SearchFile(ctx, "replay")
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/replay", results[0].Match)
+}
@@ -0,0 +1,228 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/passwd"
+)
+
+const (
+	sysctlConf       = "/etc/sysctl.d/90-apko.conf"
+	limitsConf       = "/etc/security/limits.d/90-apko.conf"
+	ldSoConf         = "/etc/ld.so.conf"
+	ldSoConfDir      = "/etc/ld.so.conf.d"
+	libraryPathsConf = ldSoConfDir + "/apko.conf"
+	tmpFilesConf     = "/etc/tmpfiles.d/apko.conf"
+	crontabsDir      = "/etc/crontabs"
+)
+
+// sysconfHeader starts the files written from the image configuration.
+const sysconfHeader = "# Generated by apko from the image configuration.\n"
+
+// writeSystemConfig writes the sysctl, limits, library paths, tmpfiles and
+// cron jobs of the image configuration to their drop-in files. The kernel
+// parameters are sorted by name, while the other entries keep their order,
+// which matters to pam_limits, the dynamic linker and crond.
+func writeSystemConfig(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
+	if len(ic.Sysctl) != 0 {
+		var b bytes.Buffer
+		b.WriteString(sysconfHeader)
+		for _, k := range slices.Sorted(maps.Keys(ic.Sysctl)) {
+			fmt.Fprintf(&b, "%s = %s\n", k, ic.Sysctl[k])
+		}
+		if err := writeConfFile(fsys, sysctlConf, b.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if len(ic.Limits) != 0 {
+		var b bytes.Buffer
+		b.WriteString(sysconfHeader)
+		for _, l := range ic.Limits {
+			fmt.Fprintf(&b, "%s\t%s\t%s\t%s\n", l.Domain, l.Type, l.Item, l.Value)
+		}
+		if err := writeConfFile(fsys, limitsConf, b.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if len(ic.LibraryPaths) != 0 {
+		var b bytes.Buffer
+		b.WriteString(sysconfHeader)
+		for _, p := range ic.LibraryPaths {
+			fmt.Fprintln(&b, p)
+		}
+		if err := writeConfFile(fsys, libraryPathsConf, b.Bytes()); err != nil {
+			return err
+		}
+		if err := includeLDSoConfDir(fsys); err != nil {
+			return err
+		}
+	}
+
+	if len(ic.TmpFiles) != 0 {
+		var b bytes.Buffer
+		b.WriteString(sysconfHeader)
+		for _, f := range ic.TmpFiles {
+			fields := []string{f.Type, f.Path, f.Mode, f.User, f.Group, f.Age}
+			for i, field := range fields {
+				if field == "" {
+					fields[i] = "-"
+				}
+			}
+			if f.Argument != "" {
+				fields = append(fields, f.Argument)
+			}
+			fmt.Fprintln(&b, strings.Join(fields, " "))
+		}
+		if err := writeConfFile(fsys, tmpFilesConf, b.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if err := checkCronUsers(fsys, ic.Cron); err != nil {
+		return err
+	}
+	crontabs := map[string]*bytes.Buffer{}
+	for _, j := range ic.Cron {
+		user := cronUser(j)
+		b, ok := crontabs[user]
+		if !ok {
+			b = bytes.NewBufferString(sysconfHeader)
+			crontabs[user] = b
+		}
+		fmt.Fprintf(b, "%s %s\n", j.Schedule, j.Command)
+	}
+	for _, user := range slices.Sorted(maps.Keys(crontabs)) {
+		name := path.Join(crontabsDir, user)
+		// Packages may install crontabs, e.g. the periodic jobs of
+		// busybox for root, so the jobs are added to them.
+		if err := appendConfFile(fsys, name, crontabs[user].Bytes()); err != nil {
+			return err
+		}
+		// Crontabs are only readable by root, as crontab(1) writes them.
+		if err := fsys.Chmod(name, 0o600); err != nil {
+			return fmt.Errorf("chmod %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// cronUser returns the user a cron job runs as.
+func cronUser(j types.CronJob) string {
+	if j.User == "" {
+		return "root"
+	}
+	return j.User
+}
+
+// checkCronUsers checks that the cron jobs run as users of the image, from
+// the accounts of the configuration or its packages, as crond ignores the
+// crontabs of other users.
+func checkCronUsers(fsys apkfs.FullFS, jobs []types.CronJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	uf, err := passwd.ReadUserFile(fsys, "etc/passwd")
+	if err != nil {
+		return fmt.Errorf("reading the users of the cron jobs: %w", err)
+	}
+	for _, j := range jobs {
+		user := cronUser(j)
+		if !slices.ContainsFunc(uf.Entries, func(ue passwd.UserEntry) bool { return ue.UserName == user }) {
+			return fmt.Errorf("cron job %q runs as %s, which is not a user of the image", j.Command, user)
+		}
+	}
+	return nil
+}
+
+// appendConfFile appends to a configuration file, creating it and its
+// directory if it doesn't exist.
+func appendConfFile(fsys apkfs.FullFS, name string, data []byte) error {
+	existing, err := fsys.ReadFile(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	if len(existing) != 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		existing = append(existing, '\n')
+	}
+	return writeConfFile(fsys, name, append(existing, data...))
+}
+
+// writeConfFile writes a configuration file, creating its directory.
+func writeConfFile(fsys apkfs.FullFS, name string, data []byte) error {
+	if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", path.Dir(name), err)
+	}
+	if err := fsys.WriteFile(name, data, 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", name, err)
+	}
+	return nil
+}
+
+// includeLDSoConfDir makes /etc/ld.so.conf include the files of
+// /etc/ld.so.conf.d, creating it if no package installed it, so that the
+// library paths get into /etc/ld.so.cache.
+func includeLDSoConfDir(fsys apkfs.FullFS) error {
+	existing, err := fsys.ReadFile(ldSoConf)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading %s: %w", ldSoConf, err)
+	}
+	for _, line := range strings.Split(string(existing), "\n") {
+		if glob, ok := strings.CutPrefix(strings.TrimSpace(line), "include "); ok && strings.HasPrefix(strings.TrimSpace(glob), ldSoConfDir+"/") {
+			return nil
+		}
+	}
+	if len(existing) != 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		existing = append(existing, '\n')
+	}
+	return writeConfFile(fsys, ldSoConf, append(existing, "include "+ldSoConfDir+"/*.conf\n"...))
+}
+
+// plannedSystemConfigFiles returns the files writeSystemConfig writes, or
+// updates, without the leading slash.
+func plannedSystemConfigFiles(ic *types.ImageConfiguration) []string {
+	var files []string
+	if len(ic.Sysctl) != 0 {
+		files = append(files, sysctlConf)
+	}
+	if len(ic.Limits) != 0 {
+		files = append(files, limitsConf)
+	}
+	if len(ic.LibraryPaths) != 0 {
+		files = append(files, libraryPathsConf, ldSoConf)
+	}
+	if len(ic.TmpFiles) != 0 {
+		files = append(files, tmpFilesConf)
+	}
+	for _, j := range ic.Cron {
+		files = append(files, path.Join(crontabsDir, cronUser(j)))
+	}
+	for i, f := range files {
+		files[i] = strings.TrimPrefix(f, "/")
+	}
+	return files
+}
@@ -0,0 +1,169 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	ldsocache "chainguard.dev/apko/internal/ldso-cache"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestWriteSystemConfig(t *testing.T) {
+	ic := &types.ImageConfiguration{
+		Sysctl: map[string]string{
+			"net.ipv4.ip_unprivileged_port_start": "0",
+			"net.core.somaxconn":                  "1024",
+		},
+		Limits: []types.ImageLimit{
+			{Domain: "*", Type: "soft", Item: "nofile", Value: "65536"},
+			{Domain: "@nonroot", Type: "-", Item: "memlock", Value: "unlimited"},
+		},
+		LibraryPaths: []string{"/opt/app/lib", "/usr/lib/jvm/lib"},
+	}
+
+	t.Run("writes drop-in files", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, writeSystemConfig(fsys, ic))
+
+		b, err := fsys.ReadFile("/etc/sysctl.d/90-apko.conf")
+		require.NoError(t, err)
+		require.Equal(t, `# Generated by apko from the image configuration.
+net.core.somaxconn = 1024
+net.ipv4.ip_unprivileged_port_start = 0
+`, string(b))
+
+		b, err = fsys.ReadFile("/etc/security/limits.d/90-apko.conf")
+		require.NoError(t, err)
+		require.Equal(t, "# Generated by apko from the image configuration.\n*\tsoft\tnofile\t65536\n@nonroot\t-\tmemlock\tunlimited\n", string(b))
+
+		b, err = fsys.ReadFile("/etc/ld.so.conf.d/apko.conf")
+		require.NoError(t, err)
+		require.Equal(t, `# Generated by apko from the image configuration.
+/opt/app/lib
+/usr/lib/jvm/lib
+`, string(b))
+
+		b, err = fsys.ReadFile("/etc/ld.so.conf")
+		require.NoError(t, err)
+		require.Equal(t, "include /etc/ld.so.conf.d/*.conf\n", string(b))
+	})
+
+	t.Run("keeps ld.so.conf including the directory", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/etc", 0o755))
+		conf := "# installed by glibc\ninclude /etc/ld.so.conf.d/*.conf\n"
+		require.NoError(t, fsys.WriteFile("/etc/ld.so.conf", []byte(conf), 0o644))
+		require.NoError(t, writeSystemConfig(fsys, ic))
+
+		b, err := fsys.ReadFile("/etc/ld.so.conf")
+		require.NoError(t, err)
+		require.Equal(t, conf, string(b))
+	})
+
+	t.Run("adds the include to ld.so.conf", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("/etc", 0o755))
+		require.NoError(t, fsys.WriteFile("/etc/ld.so.conf", []byte("/usr/local/lib"), 0o644))
+		require.NoError(t, writeSystemConfig(fsys, ic))
+
+		b, err := fsys.ReadFile("/etc/ld.so.conf")
+		require.NoError(t, err)
+		require.Equal(t, "/usr/local/lib\ninclude /etc/ld.so.conf.d/*.conf\n", string(b))
+
+		dirs, err := ldsocache.ParseLDSOConf(fsys, "etc/ld.so.conf")
+		require.NoError(t, err)
+		require.Equal(t, []string{"/usr/local/lib", "/opt/app/lib", "/usr/lib/jvm/lib"}, dirs)
+	})
+
+	// usersFS returns a filesystem whose /etc/passwd has root and app.
+	usersFS := func(t *testing.T) apkfs.FullFS {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("etc", 0o755))
+		require.NoError(t, fsys.WriteFile("etc/passwd", []byte("root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"), 0o644))
+		return fsys
+	}
+
+	t.Run("writes tmpfiles and crontabs", func(t *testing.T) {
+		fsys := usersFS(t)
+		require.NoError(t, writeSystemConfig(fsys, &types.ImageConfiguration{
+			TmpFiles: []types.TmpFile{
+				{Type: "d", Path: "/run/app", Mode: "0755", User: "app", Group: "app"},
+				{Type: "D", Path: "/var/cache/app", Age: "10d"},
+				{Type: "L+", Path: "/etc/app/current.conf", Argument: "/etc/app/app.conf"},
+			},
+			Cron: []types.CronJob{
+				{Schedule: "*/5 * * * *", Command: "/usr/bin/app-cleanup --older-than 1h", User: "app"},
+				{Schedule: "0 3 * * *", Command: "/usr/sbin/logrotate /etc/logrotate.conf"},
+				{Schedule: "30 * * * 1-5", Command: "/usr/bin/app-report", User: "app"},
+			},
+		}))
+
+		b, err := fsys.ReadFile("/etc/tmpfiles.d/apko.conf")
+		require.NoError(t, err)
+		require.Equal(t, `# Generated by apko from the image configuration.
+d /run/app 0755 app app -
+D /var/cache/app - - - 10d
+L+ /etc/app/current.conf - - - - /etc/app/app.conf
+`, string(b))
+
+		b, err = fsys.ReadFile("/etc/crontabs/app")
+		require.NoError(t, err)
+		require.Equal(t, `# Generated by apko from the image configuration.
+*/5 * * * * /usr/bin/app-cleanup --older-than 1h
+30 * * * 1-5 /usr/bin/app-report
+`, string(b))
+		b, err = fsys.ReadFile("/etc/crontabs/root")
+		require.NoError(t, err)
+		require.Equal(t, "# Generated by apko from the image configuration.\n0 3 * * * /usr/sbin/logrotate /etc/logrotate.conf\n", string(b))
+
+		fi, err := fsys.Stat("/etc/crontabs/root")
+		require.NoError(t, err)
+		require.Equal(t, fs.FileMode(0o600), fi.Mode().Perm())
+	})
+
+	t.Run("adds to the crontabs of packages", func(t *testing.T) {
+		fsys := usersFS(t)
+		require.NoError(t, fsys.MkdirAll("etc/crontabs", 0o755))
+		require.NoError(t, fsys.WriteFile("etc/crontabs/root", []byte("*/15 * * * * run-parts /etc/periodic/15min"), 0o600))
+		require.NoError(t, writeSystemConfig(fsys, &types.ImageConfiguration{
+			Cron: []types.CronJob{{Schedule: "0 3 * * *", Command: "/usr/sbin/logrotate /etc/logrotate.conf"}},
+		}))
+
+		b, err := fsys.ReadFile("/etc/crontabs/root")
+		require.NoError(t, err)
+		require.Equal(t, `*/15 * * * * run-parts /etc/periodic/15min
+# Generated by apko from the image configuration.
+0 3 * * * /usr/sbin/logrotate /etc/logrotate.conf
+`, string(b))
+	})
+
+	t.Run("rejects unknown cron users", func(t *testing.T) {
+		require.EqualError(t, writeSystemConfig(usersFS(t), &types.ImageConfiguration{
+			Cron: []types.CronJob{{Schedule: "0 3 * * *", Command: "/usr/bin/report", User: "nobody"}},
+		}), `cron job "/usr/bin/report" runs as nobody, which is not a user of the image`)
+	})
+
+	t.Run("writes nothing by default", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, writeSystemConfig(fsys, &types.ImageConfiguration{}))
+		_, err := fsys.Stat("/etc")
+		require.Error(t, err)
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"io/fs"
 	"iter"
 	"os"
+	"slices"
 
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sys/unix"
@@ -34,13 +35,14 @@ const xattrTarPAXRecordsPrefix = "SCHILY.xattr."
 
 // writeTar writes a tarball to the provided io.Writer from the provided fs.FS.
 // The etc/passwd and etc/group file provide username and group name mappings for the tar.
-func writeTar(ctx context.Context, tw *tar.Writer, fsys apkfs.FullFS) error { //nolint:gocyclo
+// Any excluded paths (and their contents, for directories) are left out of the tarball.
+func writeTar(ctx context.Context, tw *tar.Writer, fsys apkfs.FullFS, exclude ...string) error { //nolint:gocyclo
 	ctx, span := otel.Tracer("go-apk").Start(ctx, "writeTar")
 	defer span.End()
 
 	buf := make([]byte, 1<<20)
 
-	for f, err := range walkFS(ctx, fsys) {
+	for f, err := range walkFS(ctx, fsys, exclude...) {
 		if err != nil {
 			return err
 		}
@@ -78,7 +80,7 @@ type file struct {
 	header *tar.Header
 }
 
-func walkFS(ctx context.Context, fsys apkfs.FullFS) iter.Seq2[*file, error] {
+func walkFS(ctx context.Context, fsys apkfs.FullFS, exclude ...string) iter.Seq2[*file, error] {
 	return func(yield func(*file, error) bool) {
 		usersFile, _ := passwd.ReadUserFile(fsys, "etc/passwd")
 		groupsFile, _ := passwd.ReadGroupFile(fsys, "etc/group")
@@ -104,6 +106,13 @@ func walkFS(ctx context.Context, fsys apkfs.FullFS) iter.Seq2[*file, error] {
 				return err
 			}
 
+			if slices.Contains(exclude, path) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+
 			info, err := d.Info()
 			if err != nil {
 				return err
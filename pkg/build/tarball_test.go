@@ -4,11 +4,14 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
 )
 
 func TestWriteTar(t *testing.T) {
@@ -46,3 +49,46 @@ func TestWriteTar(t *testing.T) {
 	require.Equal(t, file, hdr.Name, "tar file header name mismatch")
 	require.Equal(t, "bar", hdr.PAXRecords[xattrTarPAXRecordsPrefix+"user.file"], "tar header for file xattr mismatch")
 }
+
+func TestWriteTarExclude(t *testing.T) {
+	m := fs.NewMemFS()
+	for _, d := range []string{"etc/apk", "usr/lib/apk/db", "usr/bin"} {
+		require.NoError(t, m.MkdirAll(d, 0o755))
+	}
+	for _, f := range []string{"etc/apk/world", "usr/lib/apk/db/installed", "usr/lib/apk/db/scripts.tar", "usr/bin/hello"} {
+		require.NoError(t, m.WriteFile(f, []byte("hello"), 0o644))
+	}
+
+	for _, tc := range []struct {
+		apkDatabase string
+		want        []string
+	}{{
+		apkDatabase: types.APKDatabaseFull,
+		want:        []string{"etc", "etc/apk", "etc/apk/world", "usr", "usr/bin", "usr/bin/hello", "usr/lib", "usr/lib/apk", "usr/lib/apk/db", "usr/lib/apk/db/installed", "usr/lib/apk/db/scripts.tar"},
+	}, {
+		apkDatabase: types.APKDatabaseInstalled,
+		want:        []string{"etc", "etc/apk", "etc/apk/world", "usr", "usr/bin", "usr/bin/hello", "usr/lib", "usr/lib/apk", "usr/lib/apk/db", "usr/lib/apk/db/installed"},
+	}, {
+		apkDatabase: types.APKDatabaseNone,
+		want:        []string{"etc", "usr", "usr/bin", "usr/bin/hello", "usr/lib", "usr/lib/apk"},
+	}} {
+		t.Run(tc.apkDatabase, func(t *testing.T) {
+			bc := &Context{ic: types.ImageConfiguration{APKDatabase: tc.apkDatabase}}
+
+			var buf bytes.Buffer
+			require.NoError(t, writeTar(context.Background(), tar.NewWriter(&buf), m, bc.excludedPaths()...))
+
+			var got []string
+			tr := tar.NewReader(&buf)
+			for {
+				hdr, err := tr.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				got = append(got, hdr.Name)
+			}
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/executor"
+)
+
+// runTriggers runs the triggers of the installed packages in bc.o.Triggers
+// with the executor of the build, in the order the packages were installed.
+// As apk would, each trigger is run with the directories it watches as its
+// arguments, and not at all if none of them exist.
+func (bc *Context) runTriggers(ctx context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage) (bool, error) {
+	log := clog.FromContext(ctx)
+
+	if len(bc.o.Triggers) == 0 {
+		return false, nil
+	}
+	db, err := apk.ReadDatabase(fsys)
+	if err != nil {
+		return false, fmt.Errorf("reading the apk database: %w", err)
+	}
+
+	runs, err := installedTriggers(ctx, fsys, db, installed, func(name string) bool {
+		return slices.Contains(bc.o.Triggers, name)
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, name := range bc.o.Triggers {
+		i := slices.IndexFunc(installed, func(p *apk.InstalledPackage) bool { return p.Name == name })
+		if i < 0 {
+			log.Warnf("package %s is not installed, not running its trigger", name)
+			continue
+		}
+		_, ok := db.Trigger(&installed[i].Package)
+		_, ok2 := db.Script(&installed[i].Package, ".trigger")
+		if !ok || !ok2 {
+			log.Warnf("package %s has no trigger to run", name)
+		}
+	}
+	if len(runs) == 0 {
+		return false, nil
+	}
+
+	e := bc.o.Executor
+	if e == nil {
+		if e, err = executor.Default(bc.o.Arch); err != nil {
+			return false, fmt.Errorf("running triggers for %s: %w", bc.o.Arch, err)
+		}
+	}
+	if err := onDisk(ctx, fsys, func(dir string) error {
+		for _, r := range runs {
+			log.Infof("running the trigger of %s for %s", r.pkg.Name, strings.Join(r.dirs, " "))
+			if err := runTrigger(ctx, e, dir, r.script, r.dirs); err != nil {
+				return fmt.Errorf("running the trigger of %s: %w", r.pkg.Name, err)
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// trigger is the trigger of an installed package.
+type trigger struct {
+	pkg    *apk.InstalledPackage
+	script []byte
+	// paths are the globs of the directories the trigger watches, and dirs
+	// those of fsys matching them, which the trigger is run with.
+	paths []string
+	dirs  []string
+}
+
+// installedTriggers returns the triggers of the installed packages for which
+// want returns true, in the order the packages were installed. As apk would
+// not run them, the triggers none of whose directories exist are left out.
+func installedTriggers(ctx context.Context, fsys apkfs.FullFS, db *apk.Database, installed []*apk.InstalledPackage, want func(name string) bool) ([]trigger, error) {
+	log := clog.FromContext(ctx)
+
+	var triggers []trigger
+	for _, pkg := range installed {
+		if !want(pkg.Name) {
+			continue
+		}
+		t, ok := db.Trigger(&pkg.Package)
+		script, ok2 := db.Script(&pkg.Package, ".trigger")
+		if !ok || !ok2 {
+			continue
+		}
+		dirs, err := triggerDirs(fsys, t.Paths)
+		if err != nil {
+			return nil, fmt.Errorf("matching the trigger of %s: %w", pkg.Name, err)
+		}
+		if len(dirs) == 0 {
+			log.Debugf("none of the directories the trigger of %s watches exist, skipping", pkg.Name)
+			continue
+		}
+		triggers = append(triggers, trigger{pkg: pkg, script: script.Content, paths: t.Paths, dirs: dirs})
+	}
+	return triggers, nil
+}
+
+// runTrigger runs script, a trigger, with e in the root filesystem at dir,
+// from a temporary file there.
+func runTrigger(ctx context.Context, e apk.Executor, dir string, script []byte, dirs []string) error {
+	f, err := os.CreateTemp(dir, ".trigger-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(script); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o755); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return execute(ctx, e, dir, apk.Command{
+		Args: append([]string{"/" + filepath.Base(f.Name())}, dirs...),
+		Env:  []string{"PATH=" + executor.DefaultPath},
+	})
+}
+
+// triggerDirs returns the absolute paths of the directories of fsys matching
+// patterns.
+func triggerDirs(fsys apkfs.FullFS, patterns []string) ([]string, error) {
+	var dirs []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(fsys, strings.TrimPrefix(pattern, "/"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if fi, err := fsys.Stat(m); err == nil && fi.IsDir() && !slices.Contains(dirs, "/"+m) {
+				dirs = append(dirs, "/"+m)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// The triggers of the installed packages apko did not run are recorded in
+// the image, so that they can be run when it starts.
+const (
+	// pendingTriggersPath lists the triggers, as PendingTriggers in JSON.
+	pendingTriggersPath = "usr/lib/apko/triggers.json"
+	// pendingTriggersDir has the script of each trigger, named after its
+	// package.
+	pendingTriggersDir = "usr/lib/apko/triggers"
+	// firstBootTriggersPath runs the triggers, once.
+	firstBootTriggersPath = "usr/lib/apko/run-triggers"
+	// firstBootTriggersStamp is created once the triggers ran.
+	firstBootTriggersStamp = "/var/lib/apko/triggers-done"
+)
+
+// PendingTriggers are the triggers of the installed packages which apko did
+// not run, as recorded in /usr/lib/apko/triggers.json.
+type PendingTriggers struct {
+	// Triggers are in the order the packages were installed, which is the
+	// order to run them in.
+	Triggers []PendingTrigger `json:"triggers"`
+}
+
+// PendingTrigger is the trigger of an installed package which apko did not
+// run.
+type PendingTrigger struct {
+	Package  string `json:"package"`
+	Version  string `json:"version"`
+	Checksum string `json:"checksum"`
+	// Paths are the globs of the directories the trigger watches, and Dirs
+	// the directories of the image matching them, which the trigger is to
+	// be run with as its arguments.
+	Paths []string `json:"paths"`
+	Dirs  []string `json:"dirs"`
+	// Script is the absolute path of the script of the trigger in the
+	// image, if it was written there to run it when the image starts.
+	Script string `json:"script,omitempty"`
+}
+
+// recordTriggers records the triggers of the installed packages which are
+// not in bc.o.Triggers, and so were not run, at pendingTriggersPath. With
+// bc.o.FirstBootTriggers, their scripts are written to the image too, with
+// a script at firstBootTriggersPath running them all once, for the
+// entrypoint or init system to run when the image starts.
+func (bc *Context) recordTriggers(ctx context.Context, fsys apkfs.FullFS, installed []*apk.InstalledPackage) (bool, error) {
+	if !bc.o.RecordTriggers && !bc.o.FirstBootTriggers {
+		return false, nil
+	}
+	db, err := apk.ReadDatabase(fsys)
+	if err != nil {
+		return false, fmt.Errorf("reading the apk database: %w", err)
+	}
+	triggers, err := installedTriggers(ctx, fsys, db, installed, func(name string) bool {
+		return !slices.Contains(bc.o.Triggers, name)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if err := fsys.MkdirAll(path.Dir(pendingTriggersPath), 0o755); err != nil {
+		return false, err
+	}
+	pending := PendingTriggers{Triggers: []PendingTrigger{}}
+	var run strings.Builder
+	fmt.Fprintf(&run, `#!/bin/sh
+# Runs the triggers of the packages of the image, which apko did not run
+# when building it, once.
+set -e
+[ -e %[1]s ] && exit 0
+`, firstBootTriggersStamp)
+	for _, t := range triggers {
+		pt := PendingTrigger{
+			Package:  t.pkg.Name,
+			Version:  t.pkg.Version,
+			Checksum: t.pkg.ChecksumString(),
+			Paths:    t.paths,
+			Dirs:     t.dirs,
+		}
+		if bc.o.FirstBootTriggers {
+			script := path.Join(pendingTriggersDir, t.pkg.Name)
+			if err := fsys.MkdirAll(pendingTriggersDir, 0o755); err != nil {
+				return false, err
+			}
+			if err := fsys.WriteFile(script, t.script, 0o755); err != nil {
+				return false, fmt.Errorf("writing the trigger of %s: %w", t.pkg.Name, err)
+			}
+			pt.Script = "/" + script
+			args := []string{shellQuote(pt.Script)}
+			for _, dir := range t.dirs {
+				args = append(args, shellQuote(dir))
+			}
+			fmt.Fprintln(&run, strings.Join(args, " "))
+		}
+		pending.Triggers = append(pending.Triggers, pt)
+	}
+	fmt.Fprintf(&run, "mkdir -p %s && : > %s || true\n", path.Dir(firstBootTriggersStamp), firstBootTriggersStamp)
+
+	b, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := fsys.WriteFile(pendingTriggersPath, append(b, '\n'), 0o644); err != nil {
+		return false, fmt.Errorf("writing /%s: %w", pendingTriggersPath, err)
+	}
+	if bc.o.FirstBootTriggers {
+		if err := fsys.WriteFile(firstBootTriggersPath, []byte(run.String()), 0o755); err != nil {
+			return false, fmt.Errorf("writing /%s: %w", firstBootTriggersPath, err)
+		}
+	}
+	return true, nil
+}
+
+// shellQuote quotes s as a single word for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,185 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/tarfs"
+)
+
+// testTriggersFS returns a root filesystem with installed packages, three of
+// which have triggers, and two of those directories to trigger on.
+func testTriggersFS(t *testing.T) (apkfs.FullFS, []*apk.InstalledPackage) {
+	installed := []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "gdk-pixbuf", Version: "2.42.12-r0", Checksum: []byte("gdk-pixbuf-checksum")}},
+		{Package: apk.Package{Name: "glib", Version: "2.80.0-r0", Checksum: []byte("glib-checksum")}},
+		{Package: apk.Package{Name: "shared-mime-info", Version: "2.4-r0", Checksum: []byte("mime-checksum")}},
+		{Package: apk.Package{Name: "busybox", Version: "1.36.1-r0", Checksum: []byte("busybox-checksum")}},
+	}
+	fsys := tarfs.New()
+	require.NoError(t, fsys.MkdirAll("usr/lib/apk/db", 0o755))
+	require.NoError(t, fsys.MkdirAll("usr/lib/gdk-pixbuf-2.0/2.10.0/loaders", 0o755))
+	require.NoError(t, fsys.MkdirAll("usr/share/glib-2.0/schemas", 0o755))
+	var db bytes.Buffer
+	for _, pkg := range installed {
+		require.NoError(t, apk.WriteInstalled(&db, &pkg.Package, nil))
+	}
+	require.NoError(t, fsys.WriteFile(apk.InstalledDBPath, db.Bytes(), 0o644))
+	db.Reset()
+	require.NoError(t, apk.WriteTriggers(&db,
+		apk.Trigger{Checksum: installed[0].Checksum, Paths: []string{"/usr/lib/gdk-pixbuf-2.0/*/loaders"}},
+		apk.Trigger{Checksum: installed[1].Checksum, Paths: []string{"/usr/share/glib-2.0/schemas", "/usr/lib/gio/modules"}},
+		apk.Trigger{Checksum: installed[2].Checksum, Paths: []string{"/usr/share/mime"}},
+	))
+	require.NoError(t, fsys.WriteFile(apk.TriggersDBPath, db.Bytes(), 0o644))
+	db.Reset()
+	script := func(i int, typ, content string) apk.Script {
+		return apk.Script{Package: installed[i].Name, Version: installed[i].Version, Checksum: installed[i].Checksum, Type: typ, Mode: 0o755, Content: []byte(content)}
+	}
+	require.NoError(t, apk.WriteScripts(&db,
+		script(0, ".trigger", "#!/bin/sh\ngdk-pixbuf-query-loaders --update-cache\n"),
+		script(1, ".post-install", "#!/bin/sh\nexit 1\n"),
+		script(1, ".trigger", "#!/bin/sh\nglib-compile-schemas \"$@\"\n"),
+		script(2, ".trigger", "#!/bin/sh\nupdate-mime-database /usr/share/mime\n"),
+	))
+	require.NoError(t, fsys.WriteFile(apk.ScriptsDBPath, db.Bytes(), 0o644))
+	return fsys, installed
+}
+
+func TestRunTriggers(t *testing.T) {
+	fsys, installed := testTriggersFS(t)
+
+	type ran struct {
+		script string
+		args   []string
+	}
+	var runs []ran
+	e := executorFunc(func(root string, cmd apk.Command) error {
+		b, err := os.ReadFile(filepath.Join(root, cmd.Args[0]))
+		require.NoError(t, err)
+		runs = append(runs, ran{string(b), cmd.Args[1:]})
+		if cmd.Args[1] == "/usr/share/glib-2.0/schemas" {
+			return os.WriteFile(filepath.Join(root, "usr/share/glib-2.0/schemas/gschemas.compiled"), []byte("compiled"), 0o644)
+		}
+		return nil
+	})
+
+	for _, tt := range []struct {
+		name     string
+		triggers []string
+		want     []ran
+	}{{
+		name: "none allowed",
+	}, {
+		name:     "none to run",
+		triggers: []string{"shared-mime-info", "busybox", "gtk"},
+	}, {
+		name:     "allowed",
+		triggers: []string{"glib", "gdk-pixbuf", "shared-mime-info"},
+		want: []ran{
+			{"#!/bin/sh\ngdk-pixbuf-query-loaders --update-cache\n", []string{"/usr/lib/gdk-pixbuf-2.0/2.10.0/loaders"}},
+			{"#!/bin/sh\nglib-compile-schemas \"$@\"\n", []string{"/usr/share/glib-2.0/schemas"}},
+		},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			runs = nil
+			bc := &Context{fs: fsys, o: options.Options{Triggers: tt.triggers, Executor: e}}
+			applied, err := bc.runTriggers(context.Background(), fsys, installed)
+			require.NoError(t, err)
+			require.Equal(t, tt.want != nil, applied)
+			require.Equal(t, tt.want, runs)
+		})
+	}
+
+	b, err := fsys.ReadFile("usr/share/glib-2.0/schemas/gschemas.compiled")
+	require.NoError(t, err)
+	require.Equal(t, "compiled", string(b))
+	entries, err := fsys.ReadDir(".")
+	require.NoError(t, err)
+	for _, e := range entries {
+		require.NotContains(t, e.Name(), ".trigger-")
+	}
+}
+
+func TestRecordTriggers(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		triggers  []string
+		firstBoot bool
+		want      []string
+		wantRun   string
+	}{{
+		name: "all pending",
+		want: []string{"gdk-pixbuf", "glib"},
+	}, {
+		name:     "some ran",
+		triggers: []string{"glib"},
+		want:     []string{"gdk-pixbuf"},
+	}, {
+		name:      "first boot",
+		triggers:  []string{"gdk-pixbuf"},
+		firstBoot: true,
+		want:      []string{"glib"},
+		wantRun:   "'/usr/lib/apko/triggers/glib' '/usr/share/glib-2.0/schemas'\n",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys, installed := testTriggersFS(t)
+			bc := &Context{fs: fsys, o: options.Options{Triggers: tt.triggers, RecordTriggers: true, FirstBootTriggers: tt.firstBoot}}
+			applied, err := bc.recordTriggers(context.Background(), fsys, installed)
+			require.NoError(t, err)
+			require.True(t, applied)
+
+			b, err := fsys.ReadFile(pendingTriggersPath)
+			require.NoError(t, err)
+			var pending PendingTriggers
+			require.NoError(t, json.Unmarshal(b, &pending))
+			var got []string
+			for _, p := range pending.Triggers {
+				got = append(got, p.Package)
+				require.NotEmpty(t, p.Dirs)
+				require.Equal(t, tt.firstBoot, p.Script != "")
+			}
+			require.Equal(t, tt.want, got)
+
+			run, err := fsys.ReadFile(firstBootTriggersPath)
+			if !tt.firstBoot {
+				require.ErrorIs(t, err, fs.ErrNotExist)
+				return
+			}
+			require.NoError(t, err)
+			require.Contains(t, string(run), tt.wantRun)
+			script, err := fsys.ReadFile("usr/lib/apko/triggers/glib")
+			require.NoError(t, err)
+			require.Equal(t, "#!/bin/sh\nglib-compile-schemas \"$@\"\n", string(script))
+		})
+	}
+
+	bc := &Context{o: options.Options{}}
+	applied, err := bc.recordTriggers(context.Background(), nil, nil)
+	require.NoError(t, err)
+	require.False(t, applied)
+}
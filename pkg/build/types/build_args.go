@@ -0,0 +1,102 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// buildArgRegex matches a reference to a build argument, either ${NAME} or
+// ${NAME:-default}.
+var buildArgRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandBuildArgs replaces references to build arguments in s. The value of
+// a build argument takes precedence over the default in the reference, and a
+// reference to an undefined argument without a default is recorded in
+// undefined.
+func expandBuildArgs(s string, args map[string]string, undefined map[string]struct{}) string {
+	return buildArgRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		m := buildArgRegex.FindStringSubmatch(ref)
+		if v, ok := args[m[1]]; ok {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		undefined[m[1]] = struct{}{}
+		return ref
+	})
+}
+
+// ParseBuildArgs parses build arguments given as NAME=value. They are split on
+// the first =, so that values may hold commas and equal signs, and a later
+// value of an argument takes precedence.
+func ParseBuildArgs(args []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid build argument %q, must be NAME=value", arg)
+		}
+		parsed[name] = value
+	}
+	return parsed, nil
+}
+
+// ExpandBuildArgs expands references to build arguments, written as ${NAME}
+// or ${NAME:-default}, in the packages, repositories, keyring, annotation
+// values and paths of the configuration.
+//
+// Values are only taken from args, never from the environment. A reference
+// to an argument which is not in args uses its default if it has one, and is
+// an error otherwise.
+func (ic *ImageConfiguration) ExpandBuildArgs(args map[string]string) error {
+	undefined := map[string]struct{}{}
+	expand := func(s *string) {
+		*s = expandBuildArgs(*s, args, undefined)
+	}
+
+	for _, list := range [][]string{
+		ic.Contents.BuildRepositories,
+		ic.Contents.RuntimeRepositories,
+		ic.Contents.Keyring,
+		ic.Contents.Packages,
+	} {
+		for i := range list {
+			expand(&list[i])
+		}
+	}
+	for k, v := range ic.Annotations {
+		expand(&v)
+		ic.Annotations[k] = v
+	}
+	for i := range ic.Paths {
+		expand(&ic.Paths[i].Path)
+		expand(&ic.Paths[i].Source)
+	}
+
+	if len(undefined) != 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return fmt.Errorf("undefined build arguments: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestExpandBuildArgs(t *testing.T) {
+	newConfig := func() types.ImageConfiguration {
+		return types.ImageConfiguration{
+			Contents: types.ImageContents{
+				RuntimeRepositories: []string{"https://${REPO_HOST}/os"},
+				Packages:            []string{"python-${PYTHON_VERSION}", "py${PYTHON_VERSION}-pip", "ca-certificates-bundle"},
+			},
+			Cmd: "echo ${NOT_EXPANDED}",
+			Annotations: map[string]string{
+				"org.opencontainers.image.version": "${VERSION:-dev}",
+			},
+			Paths: []types.PathMutation{{
+				Path:   "/opt/${APP}",
+				Type:   "symlink",
+				Source: "/usr/lib/${APP}",
+			}},
+		}
+	}
+
+	t.Run("defined", func(t *testing.T) {
+		ic := newConfig()
+		require.NoError(t, ic.ExpandBuildArgs(map[string]string{
+			"REPO_HOST":      "packages.example.com",
+			"PYTHON_VERSION": "3.12",
+			"APP":            "app",
+			"VERSION":        "1.2.3",
+		}))
+		require.Equal(t, []string{"https://packages.example.com/os"}, ic.Contents.RuntimeRepositories)
+		require.Equal(t, []string{"python-3.12", "py3.12-pip", "ca-certificates-bundle"}, ic.Contents.Packages)
+		require.Equal(t, "echo ${NOT_EXPANDED}", ic.Cmd)
+		require.Equal(t, "1.2.3", ic.Annotations["org.opencontainers.image.version"])
+		require.Equal(t, "/opt/app", ic.Paths[0].Path)
+		require.Equal(t, "/usr/lib/app", ic.Paths[0].Source)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		ic := newConfig()
+		require.NoError(t, ic.ExpandBuildArgs(map[string]string{
+			"REPO_HOST":      "packages.example.com",
+			"PYTHON_VERSION": "3.12",
+			"APP":            "app",
+		}))
+		require.Equal(t, "dev", ic.Annotations["org.opencontainers.image.version"])
+	})
+
+	t.Run("undefined", func(t *testing.T) {
+		t.Setenv("APP", "from-environment")
+		ic := newConfig()
+		err := ic.ExpandBuildArgs(map[string]string{"REPO_HOST": "packages.example.com"})
+		require.EqualError(t, err, "undefined build arguments: APP, PYTHON_VERSION")
+	})
+}
+
+func TestParseBuildArgs(t *testing.T) {
+	args, err := types.ParseBuildArgs([]string{"TAGS=a,b", "QUERY=x=1", "EMPTY=", "TAGS=c,d"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"TAGS": "c,d", "QUERY": "x=1", "EMPTY": ""}, args)
+
+	_, err = types.ParseBuildArgs([]string{"VERSION"})
+	require.EqualError(t, err, `invalid build argument "VERSION", must be NAME=value`)
+	_, err = types.ParseBuildArgs([]string{"=value"})
+	require.Error(t, err)
+}
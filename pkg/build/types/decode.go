@@ -0,0 +1,87 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// decodeErrorRegex matches the errors reported by the YAML decoder for a
+	// particular line.
+	decodeErrorRegex = regexp.MustCompile(`^line (\d+): (.*)$`)
+	// unknownFieldRegex matches the error reported by the YAML decoder for a
+	// field which is not part of the configuration.
+	unknownFieldRegex = regexp.MustCompile(`^field (\S+) not found in type (\S+)$`)
+)
+
+// describeDecodeError rewrites the errors reported by the YAML decoder to
+// start with the position in the configuration file they refer to, e.g.
+//
+//	apko.yaml:3:1: unknown field "entrypont" in types.ImageConfiguration
+func describeDecodeError(path string, data []byte, err error) error {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return te
+	}
+
+	msgs := make([]string, 0, len(te.Errors))
+	for _, e := range te.Errors {
+		m := decodeErrorRegex.FindStringSubmatch(e)
+		if m == nil {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", path, e))
+			continue
+		}
+		pos, msg := path+":"+m[1], m[2]
+		if f := unknownFieldRegex.FindStringSubmatch(msg); f != nil {
+			line, _ := strconv.Atoi(m[1])
+			if col := keyColumn(&root, line, f[1]); col != 0 {
+				pos += ":" + strconv.Itoa(col)
+			}
+			msg = fmt.Sprintf("unknown field %q in %s", f[1], f[2])
+		}
+		msgs = append(msgs, pos+": "+msg)
+	}
+	return errors.New(strings.Join(msgs, "\n"))
+}
+
+// keyColumn returns the column of the mapping key with the given name on the
+// given line, or 0 if there is none.
+func keyColumn(n *yaml.Node, line int, name string) int {
+	if n.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if k := n.Content[i]; k.Line == line && k.Value == name {
+				return k.Column
+			}
+		}
+	}
+	for _, c := range n.Content {
+		if col := keyColumn(c, line, name); col != 0 {
+			return col
+		}
+	}
+	return 0
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	wolfiRepository = "https://packages.wolfi.dev/os"
+	wolfiKey        = "https://packages.wolfi.dev/os/wolfi-signing.rsa.pub"
+	alpineMirror    = "https://dl-cdn.alpinelinux.org/alpine"
+)
+
+// alpineVersionRegex matches the versions of the alpine flavor, which name
+// the branch of the repositories.
+var alpineVersionRegex = regexp.MustCompile(`^(v?[0-9]+\.[0-9]+|edge|latest-stable)$`)
+
+// flavors lists the names of the flavors, of which alpine takes an optional
+// version, e.g. alpine:3.20.
+var flavors = []string{"wolfi", "alpine"}
+
+// flavorDefaults returns the configuration a flavor provides defaults from.
+func flavorDefaults(flavor string) (*ImageConfiguration, error) {
+	name, version, _ := strings.Cut(flavor, ":")
+	switch name {
+	case "wolfi":
+		if version != "" {
+			return nil, fmt.Errorf("flavor %q does not take a version", name)
+		}
+		return &ImageConfiguration{
+			Contents: ImageContents{
+				RuntimeRepositories: []string{wolfiRepository},
+				Keyring:             []string{wolfiKey},
+			},
+			Archs: []Architecture{amd64, arm64},
+			Cmd:   "/bin/sh -l",
+		}, nil
+
+	case "alpine":
+		if version == "" {
+			version = "latest-stable"
+		}
+		if !alpineVersionRegex.MatchString(version) {
+			return nil, fmt.Errorf("flavor %q has invalid version %q, must be like 3.20, edge or latest-stable", name, version)
+		}
+		if version[0] >= '0' && version[0] <= '9' {
+			version = "v" + version
+		}
+		// The keys of alpine repositories are found from their version.
+		return &ImageConfiguration{
+			Contents: ImageContents{
+				RuntimeRepositories: []string{
+					alpineMirror + "/" + version + "/main",
+					alpineMirror + "/" + version + "/community",
+				},
+			},
+			Archs: []Architecture{amd64, arm64},
+			Cmd:   "/bin/sh",
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown flavor %q, must be one of: %s", flavor, strings.Join(flavors, ", "))
+	}
+}
+
+// FlavorArchs returns the architectures a flavor builds for, unless the
+// configuration sets its archs.
+func FlavorArchs(flavor string) ([]Architecture, error) {
+	defaults, err := flavorDefaults(flavor)
+	if err != nil {
+		return nil, err
+	}
+	return defaults.Archs, nil
+}
+
+// applyFlavor sets the fields of the configuration left unset to the
+// defaults of its flavor. Each field is overridden as a whole, e.g. setting
+// repositories drops those of the flavor.
+func (ic *ImageConfiguration) applyFlavor() error {
+	if ic.Flavor == "" {
+		return nil
+	}
+	defaults, err := flavorDefaults(ic.Flavor)
+	if err != nil {
+		return err
+	}
+	if len(ic.Contents.RuntimeRepositories) == 0 && len(ic.Contents.BuildRepositories) == 0 {
+		ic.Contents.RuntimeRepositories = slices.Clone(defaults.Contents.RuntimeRepositories)
+	}
+	if len(ic.Contents.Keyring) == 0 {
+		ic.Contents.Keyring = slices.Clone(defaults.Contents.Keyring)
+	}
+	if len(ic.Archs) == 0 {
+		ic.Archs = slices.Clone(defaults.Archs)
+	}
+	// Base images can't set the cmd.
+	if ic.Cmd == "" && ic.Entrypoint.Command == "" && ic.Contents.BaseImage == nil {
+		ic.Cmd = defaults.Cmd
+	}
+	return nil
+}
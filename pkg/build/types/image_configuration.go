@@ -16,15 +16,25 @@ package types
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"hash"
 	"maps"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"slices"
 	"strings"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"gopkg.in/yaml.v3"
 
 	"github.com/chainguard-dev/clog"
@@ -33,30 +43,129 @@ import (
 	"chainguard.dev/apko/pkg/vcs"
 )
 
-// Attempt to probe an upstream VCS URL if known.
+// osReleaseKeyRegex matches the variable names allowed in os-release(5).
+var osReleaseKeyRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// certificateNameRegex matches the names allowed for additional certificates,
+// which are used as file names.
+var certificateNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// keyFingerprintRegex matches the key fingerprints of keyring policy pins.
+var keyFingerprintRegex = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// substitutionNameRegex matches the names of the substitutions of local
+// files, which can't clash with the dotted names of built-in variables.
+var substitutionNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sysctlKeyRegex matches the names of kernel parameters, whose components
+// are separated by dots or slashes.
+var sysctlKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+([./][A-Za-z0-9_*-]+)*$`)
+
+// limitItems lists the resources pam_limits can limit.
+var limitItems = []string{
+	"as", "chroot", "core", "cpu", "data", "fsize", "locks", "maxlogins", "maxsyslogins", "memlock",
+	"msgqueue", "nice", "nofile", "nonewprivs", "nproc", "priority", "rss", "rtprio", "sigpending", "stack",
+}
+
+// tmpFileTypeRegex matches the types of tmpfiles.d entries, a letter
+// followed by modifiers.
+var tmpFileTypeRegex = regexp.MustCompile(`^[fwdDevqQpLcbCxXrRzZtThHaA][+!\-=~^]*$`)
+
+// tmpFileModeRegex matches the modes of tmpfiles.d entries, which may be
+// prefixed with ~ to mask the existing mode, or : to only apply to new files.
+var tmpFileModeRegex = regexp.MustCompile(`^(-|:?~?[0-7]{3,4})$`)
+
+// cronScheduleRegex matches the five time and date fields of a crontab line.
+var cronScheduleRegex = regexp.MustCompile(`^[0-9A-Za-z*,/-]+(\s+[0-9A-Za-z*,/-]+){4}$`)
+
+// cronUserRegex matches the user names crontabs are named after.
+var cronUserRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+
+// sha256Regex matches the digests of remote files.
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Attempt to probe an upstream VCS URL if known, from the Git repository
+// containing the configuration within the working directory.
 func (ic *ImageConfiguration) ProbeVCSUrl(ctx context.Context, imageConfigPath string) {
+	toplevelDir, err := os.Getwd()
+	if err != nil {
+		clog.FromContext(ctx).Debugf("failed to probe VCS URL: cannot find working directory: %v", err)
+		return
+	}
+	ic.ProbeVCS(ctx, imageConfigPath, toplevelDir, "")
+}
+
+// ProbeVCS probes the Git repository containing path, looking for it up to
+// toplevelDir, or up to the root if it is empty. It sets the VCS URL from
+// the remote and the commit checked out, and the revision annotation when
+// the repository has no remote. It also sets the version annotation from
+// the highest version among the tags of the commit starting with tagPrefix.
+// Annotations which are set already are kept.
+func (ic *ImageConfiguration) ProbeVCS(ctx context.Context, path, toplevelDir, tagPrefix string) {
 	log := clog.FromContext(ctx)
 
-	url, err := vcs.ProbeDirFromPath(imageConfigPath)
+	info, err := vcs.Probe(path, toplevelDir)
 	if err != nil {
 		log.Debugf("failed to probe VCS URL: %v", err)
 		return
 	}
 
-	if url != "" {
+	setAnnotation := func(key, value string) {
+		if value == "" || ic.Annotations[key] != "" {
+			return
+		}
+		if ic.Annotations == nil {
+			ic.Annotations = map[string]string{}
+		}
+		ic.Annotations[key] = value
+		log.Debugf("detected %s as %s", value, key)
+	}
+
+	if url := info.VCSUrl(); url != "" {
 		ic.VCSUrl = url
 		log.Debugf("detected %s as VCS URL", ic.VCSUrl)
+	} else {
+		setAnnotation("org.opencontainers.image.revision", info.Revision)
+	}
+	setAnnotation("org.opencontainers.image.version", info.Version(tagPrefix))
+}
+
+// ConfigDigestAnnotation is the annotation recording the digest of the
+// configuration an image was built from.
+const ConfigDigestAnnotation = "dev.chainguard.apko.config.digest"
+
+// Digest returns the digest of the configuration, as it is once its
+// includes, variant and build arguments are applied, in the form
+// "sha256:<hex>". It is the SHA-256 of the canonical JSON encoding of the
+// configuration, whose map keys are sorted. The architectures and the
+// ConfigDigestAnnotation are left out, so that building some of the
+// architectures of a configuration, or building it again, gives the same
+// digest.
+func (ic ImageConfiguration) Digest() (string, error) {
+	ic.Archs = nil
+	ic.Include = ""
+	if _, ok := ic.Annotations[ConfigDigestAnnotation]; ok {
+		ic.Annotations = maps.Clone(ic.Annotations)
+		delete(ic.Annotations, ConfigDigestAnnotation)
 	}
+	b, err := json.Marshal(ic)
+	if err != nil {
+		return "", fmt.Errorf("encoding configuration: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
 }
 
 // Parse a configuration blob into an ImageConfiguration struct.
-func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, includePaths []string, configHasher hash.Hash) error {
+// The chain holds the resolved paths of the configuration being parsed and
+// of the configurations which included it, outermost first.
+func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, includePaths []string, configHasher hash.Hash, chain []string) error {
 	log := clog.FromContext(ctx)
 	configHasher.Write(configData)
 	dec := yaml.NewDecoder(strings.NewReader(string(configData)))
 	dec.KnownFields(true)
 	if err := dec.Decode(ic); err != nil {
-		return fmt.Errorf("failed to parse image configuration: %w", err)
+		return fmt.Errorf("failed to parse image configuration: %w", describeDecodeError(chain[len(chain)-1], configData, err))
 	}
 
 	if ic.Include != "" {
@@ -64,7 +173,9 @@ func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, incl
 
 		included := &ImageConfiguration{}
 
-		if err := included.Load(ctx, ic.Include, includePaths, configHasher); err != nil {
+		// Includes are also looked up relative to the including file.
+		includeDirs := append(slices.Clone(includePaths), filepath.Dir(chain[len(chain)-1]))
+		if err := included.load(ctx, ic.Include, includeDirs, configHasher, chain); err != nil {
 			return fmt.Errorf("failed to read include file: %w", err)
 		}
 
@@ -73,6 +184,10 @@ func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, incl
 		}
 	}
 
+	if err := ic.applyFlavor(); err != nil {
+		return fmt.Errorf("failed to apply flavor: %w", err)
+	}
+
 	runtimeRepos := make([]string, 0, len(ic.Contents.RuntimeRepositories))
 	for _, repo := range ic.Contents.RuntimeRepositories {
 		repo = strings.TrimRight(repo, "/")
@@ -97,7 +212,18 @@ func (ic *ImageConfiguration) parse(ctx context.Context, configData []byte, incl
 			!cmp.Equal((ImageAccounts{}), ic.Accounts) ||
 			len(ic.Environment) != 0 ||
 			len(ic.Paths) != 0 ||
-			len(ic.Annotations) != 0 {
+			len(ic.Annotations) != 0 ||
+			ic.OSRelease != nil ||
+			ic.Certificates != nil ||
+			ic.Licenses != nil ||
+			len(ic.Sysctl) != 0 ||
+			len(ic.Limits) != 0 ||
+			len(ic.LibraryPaths) != 0 ||
+			len(ic.TmpFiles) != 0 ||
+			len(ic.Cron) != 0 ||
+			len(ic.Services) != 0 ||
+			ic.Directories != nil ||
+			ic.APKDatabase != "" {
 			return fmt.Errorf("when using base image, the only supported image specification are: contents, archs and includes")
 		}
 	}
@@ -125,6 +251,52 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	if len(target.Archs) == 0 {
 		target.Archs = ic.Archs
 	}
+	if target.APKDatabase == "" {
+		target.APKDatabase = ic.APKDatabase
+	}
+	if len(target.SBOMFormats) == 0 {
+		target.SBOMFormats = ic.SBOMFormats
+	}
+	if target.Flavor == "" {
+		target.Flavor = ic.Flavor
+	}
+	if target.Variants == nil && ic.Variants != nil {
+		target.Variants = maps.Clone(ic.Variants)
+	} else {
+		for k, v := range ic.Variants {
+			if _, ok := target.Variants[k]; !ok {
+				target.Variants[k] = v
+			}
+		}
+	}
+	if target.Platform == nil {
+		target.Platform = ic.Platform
+	}
+	if target.History == nil {
+		target.History = ic.History
+	}
+	if ic.Licenses != nil {
+		if target.Licenses == nil {
+			target.Licenses = &ImageLicenses{}
+		}
+		if target.Licenses.Path == "" {
+			target.Licenses.Path = ic.Licenses.Path
+		}
+	}
+	if ic.Certificates != nil {
+		if target.Certificates == nil {
+			target.Certificates = &ImageCertificates{}
+		}
+		target.Certificates.Additional = slices.Concat(ic.Certificates.Additional, target.Certificates.Additional)
+	}
+	if ic.OSRelease != nil {
+		if target.OSRelease == nil {
+			target.OSRelease = &OSRelease{}
+		}
+		if err := ic.OSRelease.MergeInto(target.OSRelease); err != nil {
+			return err
+		}
+	}
 	if err := ic.Accounts.MergeInto(&target.Accounts); err != nil {
 		return err
 	}
@@ -149,6 +321,46 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	}
 
 	target.Volumes = slices.Concat(ic.Volumes, target.Volumes)
+	if target.Sysctl == nil && ic.Sysctl != nil {
+		target.Sysctl = maps.Clone(ic.Sysctl)
+	} else {
+		for k, v := range ic.Sysctl {
+			if _, ok := target.Sysctl[k]; !ok {
+				target.Sysctl[k] = v
+			}
+		}
+	}
+	target.Limits = slices.Concat(ic.Limits, target.Limits)
+	target.LibraryPaths = slices.Concat(ic.LibraryPaths, target.LibraryPaths)
+	target.TmpFiles = slices.Concat(ic.TmpFiles, target.TmpFiles)
+	target.Cron = slices.Concat(ic.Cron, target.Cron)
+	if ic.Kernel != nil {
+		if target.Kernel == nil {
+			target.Kernel = &ImageKernel{}
+		}
+		target.Kernel.Modules = slices.Concat(ic.Kernel.Modules, target.Kernel.Modules)
+		target.Kernel.Firmware = slices.Concat(ic.Kernel.Firmware, target.Kernel.Firmware)
+	}
+	if ic.Directories != nil {
+		if target.Directories == nil {
+			target.Directories = &ImageDirectories{}
+		}
+		if target.Directories.Umask == 0 {
+			target.Directories.Umask = ic.Directories.Umask
+		}
+		target.Directories.Modes = slices.Concat(ic.Directories.Modes, target.Directories.Modes)
+		target.Directories.ForbidWorldWritable = target.Directories.ForbidWorldWritable || ic.Directories.ForbidWorldWritable
+		target.Directories.AllowWorldWritable = slices.Concat(ic.Directories.AllowWorldWritable, target.Directories.AllowWorldWritable)
+	}
+	if target.Services == nil && ic.Services != nil {
+		target.Services = maps.Clone(ic.Services)
+	} else {
+		for k, v := range ic.Services {
+			if _, ok := target.Services[k]; !ok {
+				target.Services[k] = v
+			}
+		}
+	}
 
 	// Update the contents.
 	return ic.Contents.MergeInto(&target.Contents)
@@ -158,8 +370,46 @@ func (a *ImageAccounts) MergeInto(target *ImageAccounts) error {
 	if target.RunAs == "" {
 		target.RunAs = a.RunAs
 	}
-	target.Users = slices.Concat(a.Users, target.Users)
-	target.Groups = slices.Concat(a.Groups, target.Groups)
+	// Users and groups in the target replace those with the same name.
+	users := slices.DeleteFunc(slices.Clone(a.Users), func(u User) bool {
+		return slices.ContainsFunc(target.Users, func(t User) bool { return t.UserName == u.UserName })
+	})
+	groups := slices.DeleteFunc(slices.Clone(a.Groups), func(g Group) bool {
+		return slices.ContainsFunc(target.Groups, func(t Group) bool { return t.GroupName == g.GroupName })
+	})
+	target.Users = slices.Concat(users, target.Users)
+	target.Groups = slices.Concat(groups, target.Groups)
+	return nil
+}
+
+func (r *OSRelease) MergeInto(target *OSRelease) error {
+	if target.Name == "" {
+		target.Name = r.Name
+	}
+	if target.ID == "" {
+		target.ID = r.ID
+	}
+	if target.VersionID == "" {
+		target.VersionID = r.VersionID
+	}
+	if target.PrettyName == "" {
+		target.PrettyName = r.PrettyName
+	}
+	if target.HomeURL == "" {
+		target.HomeURL = r.HomeURL
+	}
+	if target.BugReportURL == "" {
+		target.BugReportURL = r.BugReportURL
+	}
+	if target.Extra == nil && r.Extra != nil {
+		target.Extra = maps.Clone(r.Extra)
+	} else {
+		for k, v := range r.Extra {
+			if _, ok := target.Extra[k]; !ok {
+				target.Extra[k] = v
+			}
+		}
+	}
 	return nil
 }
 
@@ -171,15 +421,29 @@ func (i *ImageContents) MergeInto(target *ImageContents) error {
 	if target.BaseImage == nil {
 		target.BaseImage = i.BaseImage
 	}
+	if i.KeyringPolicy != nil {
+		if target.KeyringPolicy == nil {
+			target.KeyringPolicy = &KeyringPolicy{}
+		}
+		if target.KeyringPolicy.Mode == "" {
+			target.KeyringPolicy.Mode = i.KeyringPolicy.Mode
+		}
+		target.KeyringPolicy.Pins = slices.Concat(i.KeyringPolicy.Pins, target.KeyringPolicy.Pins)
+	}
+	target.Sigstore = slices.Concat(i.Sigstore, target.Sigstore)
+	target.SignaturePolicies = slices.Concat(i.SignaturePolicies, target.SignaturePolicies)
+	target.LocalFiles = slices.Concat(i.LocalFiles, target.LocalFiles)
+	target.RemoteFiles = slices.Concat(i.RemoteFiles, target.RemoteFiles)
 	return nil
 }
 
-func (ic *ImageConfiguration) readLocal(imageconfigPath string, includePaths []string) ([]byte, error) {
+func (ic *ImageConfiguration) readLocal(imageconfigPath string, includePaths []string) (string, []byte, error) {
 	resolvedPath, err := paths.ResolvePath(imageconfigPath, includePaths)
 	if err != nil {
-		return nil, err
+		return "", nil, err
 	}
-	return os.ReadFile(resolvedPath)
+	data, err := os.ReadFile(resolvedPath)
+	return resolvedPath, data, err
 }
 
 // Load - loads an image configuration given a configuration file path.
@@ -188,21 +452,41 @@ func (ic *ImageConfiguration) readLocal(imageconfigPath string, includePaths []s
 //
 // Deprecated: This will be removed in a future release.
 func (ic *ImageConfiguration) Load(ctx context.Context, imageConfigPath string, includePaths []string, configHasher hash.Hash) error {
-	data, err := ic.readLocal(imageConfigPath, includePaths)
+	return ic.load(ctx, imageConfigPath, includePaths, configHasher, nil)
+}
+
+// load loads an image configuration which was included by the configurations
+// in chain, failing if it would include itself.
+func (ic *ImageConfiguration) load(ctx context.Context, imageConfigPath string, includePaths []string, configHasher hash.Hash, chain []string) error {
+	resolvedPath, data, err := ic.readLocal(imageConfigPath, includePaths)
 	if err != nil {
 		return err
 	}
 
-	return ic.parse(ctx, data, includePaths, configHasher)
+	absPath, err := filepath.Abs(resolvedPath)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(chain, absPath) {
+		return fmt.Errorf("include cycle: %s", strings.Join(append(chain, absPath), " -> "))
+	}
+
+	return ic.parse(ctx, data, includePaths, configHasher, append(slices.Clone(chain), absPath))
 }
 
 // Do preflight checks and mutations on an image configuration.
 func (ic *ImageConfiguration) Validate() error {
+	if err := ic.ValidateServices(); err != nil {
+		return err
+	}
 	if ic.Entrypoint.Type == "service-bundle" {
 		if err := ic.ValidateServiceBundle(); err != nil {
 			return err
 		}
 	}
+	if err := ic.ValidateS6RC(); err != nil {
+		return err
+	}
 
 	for i, u := range ic.Accounts.Users {
 		if u.UserName == "" {
@@ -223,13 +507,300 @@ func (ic *ImageConfiguration) Validate() error {
 			return fmt.Errorf("configured group %v has no configured group name", g)
 		}
 	}
+
+	switch ic.APKDatabase {
+	case "", APKDatabaseFull, APKDatabaseInstalled, APKDatabaseNone:
+	default:
+		return fmt.Errorf("unsupported apk-database %q, must be one of: %s, %s, %s", ic.APKDatabase, APKDatabaseFull, APKDatabaseInstalled, APKDatabaseNone)
+	}
+
+	if p := ic.Contents.KeyringPolicy; p != nil {
+		switch p.Mode {
+		case "", KeyringPolicyEnforce, KeyringPolicyWarn:
+		default:
+			return fmt.Errorf("unsupported keyring policy mode %q, must be one of: %s, %s", p.Mode, KeyringPolicyEnforce, KeyringPolicyWarn)
+		}
+		for _, pin := range p.Pins {
+			if pin.Repository == "" {
+				return fmt.Errorf("keyring policy pin %v has no repository", pin)
+			}
+			if len(pin.Fingerprints) == 0 {
+				return fmt.Errorf("keyring policy pin for %s has no fingerprints", pin.Repository)
+			}
+			for _, fp := range pin.Fingerprints {
+				if !keyFingerprintRegex.MatchString(fp) {
+					return fmt.Errorf("keyring policy pin for %s has invalid fingerprint %q, must be sha256: followed by 64 hex digits", pin.Repository, fp)
+				}
+			}
+		}
+	}
+
+	seenSigstore := map[string]struct{}{}
+	for _, p := range ic.Contents.Sigstore {
+		if p.Repository == "" {
+			return fmt.Errorf("sigstore policy %v has no repository", p)
+		}
+		repo := strings.TrimRight(p.Repository, "/")
+		if _, ok := seenSigstore[repo]; ok {
+			return fmt.Errorf("duplicate sigstore policy for %s", p.Repository)
+		}
+		seenSigstore[repo] = struct{}{}
+		if p.Identity == "" && p.IdentityRegexp == "" {
+			return fmt.Errorf("sigstore policy for %s has no identity or identity_regexp", p.Repository)
+		}
+		if p.Issuer == "" && p.IssuerRegexp == "" {
+			return fmt.Errorf("sigstore policy for %s has no issuer or issuer_regexp", p.Repository)
+		}
+		for _, re := range []string{p.IdentityRegexp, p.IssuerRegexp} {
+			if _, err := regexp.Compile(re); err != nil {
+				return fmt.Errorf("sigstore policy for %s has invalid regular expression %q: %w", p.Repository, re, err)
+			}
+		}
+		if strings.HasPrefix(p.Repository, "oci://") {
+			if _, err := name.ParseReference(strings.TrimPrefix(p.Repository, "oci://")); err != nil {
+				return fmt.Errorf("sigstore policy has invalid repository %s: %w", p.Repository, err)
+			}
+			if p.Mode != "" {
+				return fmt.Errorf("sigstore policy for %s does not support a mode", p.Repository)
+			}
+		}
+		switch p.Mode {
+		case "", SigstoreModeAdditional, SigstoreModeOnly:
+		default:
+			return fmt.Errorf("unsupported sigstore policy mode %q for %s, must be one of: %s, %s", p.Mode, p.Repository, SigstoreModeAdditional, SigstoreModeOnly)
+		}
+	}
+
+	seenSignaturePolicy := map[string]struct{}{}
+	for _, p := range ic.Contents.SignaturePolicies {
+		if p.Repository == "" {
+			return fmt.Errorf("signature policy %v has no repository", p)
+		}
+		repo := strings.TrimRight(p.Repository, "/")
+		if _, ok := seenSignaturePolicy[repo]; ok {
+			return fmt.Errorf("duplicate signature policy for %s", p.Repository)
+		}
+		seenSignaturePolicy[repo] = struct{}{}
+		for _, id := range p.RequiredKeyIDs {
+			if id == "" || strings.Contains(id, "/") {
+				return fmt.Errorf("signature policy for %s has invalid key id %q", p.Repository, id)
+			}
+		}
+	}
+
+	for _, lf := range ic.Contents.LocalFiles {
+		if lf.Source == "" {
+			return fmt.Errorf("local file %v has no source", lf)
+		}
+		if escapesContext(lf.Source) {
+			return fmt.Errorf("local file %s must be a relative path within the build context", lf.Source)
+		}
+		if !path.IsAbs(lf.Destination) {
+			return fmt.Errorf("local file %s has destination %q, which must be an absolute path", lf.Source, lf.Destination)
+		}
+		if lf.Permissions&^0o7777 != 0 {
+			return fmt.Errorf("local file %s has invalid permissions %o", lf.Source, lf.Permissions)
+		}
+		for _, pattern := range lf.Exclude {
+			if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+				return fmt.Errorf("local file %s has invalid exclude pattern %q: %w", lf.Source, pattern, err)
+			}
+			if escapesContext(strings.TrimPrefix(pattern, "!")) {
+				return fmt.Errorf("local file %s has exclude pattern %q, which must be relative to its source", lf.Source, pattern)
+			}
+		}
+		for name := range lf.Substitutions {
+			if !substitutionNameRegex.MatchString(name) {
+				return fmt.Errorf("local file %s has invalid substitution name %q", lf.Source, name)
+			}
+		}
+	}
+
+	for _, rf := range ic.Contents.RemoteFiles {
+		u, err := url.Parse(rf.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http" && u.Scheme != "file") {
+			return fmt.Errorf("remote file %q must have an http, https or file URL", rf.URL)
+		}
+		if !sha256Regex.MatchString(rf.SHA256) {
+			return fmt.Errorf("remote file %s has sha256 %q, which must be a hex encoded sha256 digest", u.Redacted(), rf.SHA256)
+		}
+		if !path.IsAbs(rf.Destination) {
+			return fmt.Errorf("remote file %s has destination %q, which must be an absolute path", u.Redacted(), rf.Destination)
+		}
+		if rf.StripComponents < 0 || (rf.StripComponents != 0 && !rf.Extract) {
+			return fmt.Errorf("remote file %s has strip_components %d, which needs extract", u.Redacted(), rf.StripComponents)
+		}
+		if rf.Permissions&^0o7777 != 0 {
+			return fmt.Errorf("remote file %s has invalid permissions %o", u.Redacted(), rf.Permissions)
+		}
+	}
+
+	if ic.Certificates != nil {
+		seen := map[string]struct{}{}
+		for _, c := range ic.Certificates.Additional {
+			if !certificateNameRegex.MatchString(c.Name) {
+				return fmt.Errorf("additional certificate has invalid name %q", c.Name)
+			}
+			if _, ok := seen[c.Name]; ok {
+				return fmt.Errorf("duplicate additional certificate %q", c.Name)
+			}
+			seen[c.Name] = struct{}{}
+			if block, _ := pem.Decode([]byte(c.Content)); block == nil || block.Type != "CERTIFICATE" {
+				return fmt.Errorf("additional certificate %q does not contain a PEM encoded certificate", c.Name)
+			}
+		}
+	}
+
+	if d := ic.Directories; d != nil {
+		if d.Umask&^0o777 != 0 {
+			return fmt.Errorf("directories umask %o is invalid, must only have permission bits", d.Umask)
+		}
+		for _, m := range d.Modes {
+			if !path.IsAbs(m.Path) {
+				return fmt.Errorf("directory mode path %q must be absolute", m.Path)
+			}
+			if _, err := path.Match(m.Path, ""); err != nil {
+				return fmt.Errorf("directory mode path %q is not a valid pattern: %w", m.Path, err)
+			}
+			if m.Mode == 0 || m.Mode&^0o7777 != 0 {
+				return fmt.Errorf("directory %s has invalid mode %o", m.Path, m.Mode)
+			}
+		}
+		for _, p := range d.AllowWorldWritable {
+			if !path.IsAbs(p) {
+				return fmt.Errorf("world-writable directory %q must be absolute", p)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("world-writable directory %q is not a valid pattern: %w", p, err)
+			}
+		}
+	}
+
+	if ic.Licenses != nil && ic.Licenses.Path != "" {
+		if !path.IsAbs(ic.Licenses.Path) || path.Clean(ic.Licenses.Path) == "/" {
+			return fmt.Errorf("licenses path %q must be an absolute path to a directory other than /", ic.Licenses.Path)
+		}
+	}
+
+	for k, v := range ic.Sysctl {
+		if !sysctlKeyRegex.MatchString(k) {
+			return fmt.Errorf("sysctl %q is not a valid kernel parameter name", k)
+		}
+		if v == "" || strings.ContainsAny(v, "\n\r") {
+			return fmt.Errorf("sysctl %s has invalid value %q, must be a non-empty single line", k, v)
+		}
+	}
+
+	for _, l := range ic.Limits {
+		if l.Domain == "" || strings.ContainsAny(l.Domain, " \t\n\r#") {
+			return fmt.Errorf("limit %v has invalid domain %q, must be a user, @group or *", l, l.Domain)
+		}
+		switch l.Type {
+		case "soft", "hard", "-":
+		default:
+			return fmt.Errorf("limit of %s for %s has unsupported type %q, must be one of: soft, hard, -", l.Item, l.Domain, l.Type)
+		}
+		if !slices.Contains(limitItems, l.Item) {
+			return fmt.Errorf("limit for %s has unsupported item %q, must be one of: %s", l.Domain, l.Item, strings.Join(limitItems, ", "))
+		}
+		if l.Value == "" || strings.ContainsAny(l.Value, " \t\n\r#") {
+			return fmt.Errorf("limit of %s for %s has invalid value %q", l.Item, l.Domain, l.Value)
+		}
+	}
+
+	for _, p := range ic.LibraryPaths {
+		if !path.IsAbs(p) || strings.ContainsAny(p, " \t\n\r#") {
+			return fmt.Errorf("library path %q must be an absolute path without whitespace", p)
+		}
+	}
+
+	for _, f := range ic.TmpFiles {
+		if !tmpFileTypeRegex.MatchString(f.Type) {
+			return fmt.Errorf("tmpfiles entry for %s has unsupported type %q", f.Path, f.Type)
+		}
+		if !path.IsAbs(f.Path) || strings.ContainsAny(f.Path, " \t\n\r") {
+			return fmt.Errorf("tmpfiles entry has path %q, which must be an absolute path without whitespace", f.Path)
+		}
+		if f.Mode != "" && !tmpFileModeRegex.MatchString(f.Mode) {
+			return fmt.Errorf("tmpfiles entry for %s has invalid mode %q, must be octal like 0755", f.Path, f.Mode)
+		}
+		for _, field := range []string{f.User, f.Group, f.Age} {
+			if strings.ContainsAny(field, " \t\n\r") {
+				return fmt.Errorf("tmpfiles entry for %s has invalid field %q, which must not contain whitespace", f.Path, field)
+			}
+		}
+		if strings.ContainsAny(f.Argument, "\n\r") {
+			return fmt.Errorf("tmpfiles entry for %s has an argument of more than one line", f.Path)
+		}
+	}
+
+	for _, j := range ic.Cron {
+		if !cronScheduleRegex.MatchString(j.Schedule) {
+			return fmt.Errorf("cron job %q has invalid schedule %q, must be five fields: minute, hour, day of month, month and day of week", j.Command, j.Schedule)
+		}
+		if strings.TrimSpace(j.Command) == "" || strings.ContainsAny(j.Command, "\n\r") {
+			return fmt.Errorf("cron job scheduled %q must have a command of one line", j.Schedule)
+		}
+		if j.User != "" && !cronUserRegex.MatchString(j.User) {
+			return fmt.Errorf("cron job %q has invalid user %q", j.Command, j.User)
+		}
+	}
+
+	if ic.Kernel != nil {
+		for _, glob := range slices.Concat(ic.Kernel.Modules, ic.Kernel.Firmware) {
+			if _, err := path.Match(glob, ""); err != nil || glob == "" || strings.HasPrefix(glob, "/") {
+				return fmt.Errorf("kernel filter has invalid glob %q, must be a relative path pattern", glob)
+			}
+		}
+	}
+
+	if ic.OSRelease != nil {
+		for k := range ic.OSRelease.Extra {
+			if !osReleaseKeyRegex.MatchString(k) {
+				return fmt.Errorf("os-release field %q is not a valid variable name", k)
+			}
+		}
+	}
+
+	if ic.Platform != nil {
+		for a, variant := range ic.Platform.Variants {
+			arch := ParseArchitecture(a)
+			if !slices.Contains(AllArchs, arch) {
+				return fmt.Errorf("platform variant of unknown architecture %q", a)
+			}
+			if want := arch.ToOCIPlatform().Variant; want != "" && variant != want {
+				return fmt.Errorf("platform variant of %s must be %s, got %q", arch, want, variant)
+			}
+		}
+	}
 	return nil
 }
 
+// OCIPlatform returns the OCI platform of the image of arch, with the
+// fields set in the platform of the configuration.
+func (ic *ImageConfiguration) OCIPlatform(arch Architecture) *v1.Platform {
+	platform := arch.ToOCIPlatform()
+	if ic.Platform == nil {
+		return platform
+	}
+	platform.OSVersion = ic.Platform.OSVersion
+	platform.OSFeatures = slices.Clone(ic.Platform.OSFeatures)
+	for a, variant := range ic.Platform.Variants {
+		if ParseArchitecture(a) == arch {
+			platform.Variant = variant
+		}
+	}
+	return platform
+}
+
+// serviceBundleCommand is the entrypoint of service bundles, which
+// supervises the services under /sv.
+const serviceBundleCommand = "/bin/s6-svscan /sv"
+
 // Do preflight checks and mutations on an image configured to manage
 // a service bundle.
 func (ic *ImageConfiguration) ValidateServiceBundle() error {
-	ic.Entrypoint.Command = "/bin/s6-svscan /sv"
+	ic.Entrypoint.Command = serviceBundleCommand
 
 	// It's harmless to have a duplicate entry in /etc/apk/world,
 	// apk will fix it up when the fixate op happens.
@@ -252,6 +823,9 @@ func (ic *ImageConfiguration) Summarize(ctx context.Context) {
 		log.Infof("    type:    %s", ic.Entrypoint.Type)
 		log.Infof("    command:     %s", ic.Entrypoint.Command)
 		log.Infof("    service: %v", ic.Entrypoint.Services)
+		if len(ic.Entrypoint.S6RC) != 0 {
+			log.Infof("    s6-rc services: %v", slices.Sorted(maps.Keys(ic.Entrypoint.S6RC)))
+		}
 		log.Infof("    shell fragment: %v", ic.Entrypoint.ShellFragment)
 	}
 	if ic.Cmd != "" {
@@ -273,6 +847,12 @@ func (ic *ImageConfiguration) Summarize(ctx context.Context) {
 			log.Infof("      - gid=%d(%s) members=%v", g.GID, g.GroupName, g.Members)
 		}
 	}
+	if ic.OSRelease != nil {
+		log.Infof("  os-release:")
+		log.Infof("    id:          %s", ic.OSRelease.ID)
+		log.Infof("    version id:  %s", ic.OSRelease.VersionID)
+		log.Infof("    pretty name: %s", ic.OSRelease.PrettyName)
+	}
 	if len(ic.Annotations) > 0 {
 		log.Infof("    annotations:")
 		for k, v := range ic.Annotations {
@@ -287,3 +867,11 @@ func gidToInt(gid GID) uint32 {
 	}
 	return *gid
 }
+
+// escapesContext reports whether p, a path or glob pattern of a local file,
+// is absolute or has a ".." element, which would reach outside of the build
+// context.
+func escapesContext(p string) bool {
+	p = filepath.ToSlash(p)
+	return path.IsAbs(p) || filepath.IsAbs(p) || slices.Contains(strings.Split(p, "/"), "..")
+}
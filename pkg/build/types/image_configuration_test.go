@@ -3,9 +3,16 @@ package types_test
 import (
 	"context"
 	"crypto/sha256"
+	"encoding/json"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/build/types"
@@ -46,6 +53,148 @@ func TestOverlayWithAdditionalPackages(t *testing.T) {
 	require.ElementsMatch(t, ic.Contents.Packages, []string{"package", "other_package"})
 }
 
+func TestIncludeRelativeToConfig(t *testing.T) {
+	ctx := context.Background()
+
+	configPath := filepath.Join("testdata", "include", "app.apko.yaml")
+	hasher := sha256.New()
+	ic := types.ImageConfiguration{}
+
+	require.NoError(t, ic.Load(ctx, configPath, []string{}, hasher))
+	require.Equal(t, []string{"base-package", "app-package"}, ic.Contents.Packages)
+	require.Equal(t, "app", ic.Accounts.RunAs)
+	require.Len(t, ic.Accounts.Users, 2)
+	require.Equal(t, "nonroot", ic.Accounts.Users[0].UserName)
+	require.Equal(t, "app", ic.Accounts.Users[1].UserName)
+	require.Equal(t, uint32(2000), ic.Accounts.Users[1].UID)
+	require.Equal(t, map[string]string{
+		"PATH": "/usr/sbin:/sbin:/usr/bin:/bin",
+		"LANG": "en_US.UTF-8",
+	}, ic.Environment)
+}
+
+func TestIncludeCycle(t *testing.T) {
+	ctx := context.Background()
+
+	configPath := filepath.Join("testdata", "include", "cycle-a.apko.yaml")
+	hasher := sha256.New()
+	ic := types.ImageConfiguration{}
+
+	require.ErrorContains(t, ic.Load(ctx, configPath, []string{}, hasher), "include cycle")
+}
+
+func TestUnknownField(t *testing.T) {
+	ctx := context.Background()
+
+	configPath := filepath.Join("testdata", "unknown-field.apko.yaml")
+	hasher := sha256.New()
+	ic := types.ImageConfiguration{}
+
+	require.ErrorContains(t, ic.Load(ctx, configPath, []string{}, hasher), `unknown-field.apko.yaml:4:1: unknown field "entrypont" in types.ImageConfiguration`)
+}
+
+func TestFlavor(t *testing.T) {
+	ctx := context.Background()
+	amd64, arm64 := types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")
+
+	for _, tc := range []struct {
+		name    string
+		config  string
+		want    types.ImageConfiguration
+		wantErr string
+	}{{
+		name:   "wolfi",
+		config: "flavor: wolfi\ncontents:\n  packages: [busybox]\n",
+		want: types.ImageConfiguration{
+			Flavor: "wolfi",
+			Contents: types.ImageContents{
+				BuildRepositories:   []string{},
+				RuntimeRepositories: []string{"https://packages.wolfi.dev/os"},
+				Keyring:             []string{"https://packages.wolfi.dev/os/wolfi-signing.rsa.pub"},
+				Packages:            []string{"busybox"},
+			},
+			Archs: []types.Architecture{amd64, arm64},
+			Cmd:   "/bin/sh -l",
+		},
+	}, {
+		name:   "alpine version",
+		config: "flavor: alpine:3.20\n",
+		want: types.ImageConfiguration{
+			Flavor: "alpine:3.20",
+			Contents: types.ImageContents{
+				BuildRepositories: []string{},
+				RuntimeRepositories: []string{
+					"https://dl-cdn.alpinelinux.org/alpine/v3.20/main",
+					"https://dl-cdn.alpinelinux.org/alpine/v3.20/community",
+				},
+			},
+			Archs: []types.Architecture{amd64, arm64},
+			Cmd:   "/bin/sh",
+		},
+	}, {
+		name:   "alpine default version",
+		config: "flavor: alpine\n",
+		want: types.ImageConfiguration{
+			Flavor: "alpine",
+			Contents: types.ImageContents{
+				BuildRepositories: []string{},
+				RuntimeRepositories: []string{
+					"https://dl-cdn.alpinelinux.org/alpine/latest-stable/main",
+					"https://dl-cdn.alpinelinux.org/alpine/latest-stable/community",
+				},
+			},
+			Archs: []types.Architecture{amd64, arm64},
+			Cmd:   "/bin/sh",
+		},
+	}, {
+		name:   "overridden fields",
+		config: "flavor: alpine\ncontents:\n  repositories: [https://example.com/alpine/edge/main]\narchs: [x86_64]\nentrypoint:\n  command: /usr/bin/app\n",
+		want: types.ImageConfiguration{
+			Flavor: "alpine",
+			Contents: types.ImageContents{
+				BuildRepositories:   []string{},
+				RuntimeRepositories: []string{"https://example.com/alpine/edge/main"},
+			},
+			Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/app"},
+			Archs:      []types.Architecture{amd64},
+		},
+	}, {
+		name:    "unknown flavor",
+		config:  "flavor: debian\n",
+		wantErr: `unknown flavor "debian"`,
+	}, {
+		name:    "bad alpine version",
+		config:  "flavor: alpine:3\n",
+		wantErr: `flavor "alpine" has invalid version "3"`,
+	}, {
+		name:    "wolfi version",
+		config:  "flavor: wolfi:1\n",
+		wantErr: `flavor "wolfi" does not take a version`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "apko.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(tc.config), 0o644))
+
+			ic := types.ImageConfiguration{}
+			err := ic.Load(ctx, configPath, []string{}, sha256.New())
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, ic)
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	var schema struct {
+		Definitions map[string]json.RawMessage `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(types.Schema(), &schema))
+	require.Contains(t, schema.Definitions, "ImageConfiguration")
+}
+
 func TestUserContents(t *testing.T) {
 	ctx := context.Background()
 
@@ -228,6 +377,163 @@ func TestMergeInto(t *testing.T) {
 				"org.blah":  "bar",
 			},
 		},
+	}, {
+		name: "licenses path",
+		source: types.ImageConfiguration{
+			Licenses: &types.ImageLicenses{Path: "/usr/share/doc/licenses"},
+		},
+		target: types.ImageConfiguration{},
+		expected: types.ImageConfiguration{
+			Licenses: &types.ImageLicenses{Path: "/usr/share/doc/licenses"},
+		},
+	}, {
+		name: "licenses path override",
+		source: types.ImageConfiguration{
+			Licenses: &types.ImageLicenses{Path: "/usr/share/doc/licenses"},
+		},
+		target: types.ImageConfiguration{
+			Licenses: &types.ImageLicenses{Path: "/licenses"},
+		},
+		expected: types.ImageConfiguration{
+			Licenses: &types.ImageLicenses{Path: "/licenses"},
+		},
+	}, {
+		name: "os-release fields",
+		source: types.ImageConfiguration{
+			OSRelease: &types.OSRelease{
+				ID:        "foo",
+				VersionID: "foo",
+				Extra: map[string]string{
+					"VARIANT_ID": "foo",
+					"BUILD_ID":   "foo",
+				},
+			},
+		},
+		target: types.ImageConfiguration{
+			OSRelease: &types.OSRelease{
+				ID: "bar",
+				Extra: map[string]string{
+					"VARIANT_ID": "bar",
+				},
+			},
+		},
+		expected: types.ImageConfiguration{
+			OSRelease: &types.OSRelease{
+				ID:        "bar",
+				VersionID: "foo",
+				Extra: map[string]string{
+					"VARIANT_ID": "bar",
+					"BUILD_ID":   "foo",
+				},
+			},
+		},
+	}, {
+		name: "keyring policy",
+		source: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				KeyringPolicy: &types.KeyringPolicy{
+					Mode: types.KeyringPolicyWarn,
+					Pins: []types.KeyPin{{Repository: "foo", Fingerprints: []string{"foo"}}},
+				},
+			},
+		},
+		target: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				KeyringPolicy: &types.KeyringPolicy{
+					Pins: []types.KeyPin{{Repository: "bar", Fingerprints: []string{"bar"}}},
+				},
+			},
+		},
+		expected: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				KeyringPolicy: &types.KeyringPolicy{
+					Mode: types.KeyringPolicyWarn,
+					Pins: []types.KeyPin{
+						{Repository: "foo", Fingerprints: []string{"foo"}},
+						{Repository: "bar", Fingerprints: []string{"bar"}},
+					},
+				},
+			},
+		},
+	}, {
+		name: "sigstore policies",
+		source: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Sigstore: []types.SigstorePolicy{{Repository: "foo", Identity: "foo"}},
+			},
+		},
+		target: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Sigstore: []types.SigstorePolicy{{Repository: "bar", Identity: "bar"}},
+			},
+		},
+		expected: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Sigstore: []types.SigstorePolicy{
+					{Repository: "foo", Identity: "foo"},
+					{Repository: "bar", Identity: "bar"},
+				},
+			},
+		},
+	}, {
+		name: "signature policies",
+		source: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				SignaturePolicies: []types.SignaturePolicy{{Repository: "foo", AllowUnsigned: true}},
+			},
+		},
+		target: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				SignaturePolicies: []types.SignaturePolicy{{Repository: "bar", RequireSignedPackages: true}},
+			},
+		},
+		expected: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				SignaturePolicies: []types.SignaturePolicy{
+					{Repository: "foo", AllowUnsigned: true},
+					{Repository: "bar", RequireSignedPackages: true},
+				},
+			},
+		},
+	}, {
+		name: "system configuration",
+		source: types.ImageConfiguration{
+			Sysctl:       map[string]string{"net.core.somaxconn": "128", "kernel.panic": "10"},
+			Limits:       []types.ImageLimit{{Domain: "*", Type: "soft", Item: "nofile", Value: "1024"}},
+			LibraryPaths: []string{"/usr/local/lib"},
+		},
+		target: types.ImageConfiguration{
+			Sysctl:       map[string]string{"net.core.somaxconn": "1024"},
+			Limits:       []types.ImageLimit{{Domain: "*", Type: "soft", Item: "nofile", Value: "65536"}},
+			LibraryPaths: []string{"/opt/app/lib"},
+		},
+		expected: types.ImageConfiguration{
+			Sysctl: map[string]string{"net.core.somaxconn": "1024", "kernel.panic": "10"},
+			Limits: []types.ImageLimit{
+				{Domain: "*", Type: "soft", Item: "nofile", Value: "1024"},
+				{Domain: "*", Type: "soft", Item: "nofile", Value: "65536"},
+			},
+			LibraryPaths: []string{"/usr/local/lib", "/opt/app/lib"},
+		},
+	}, {
+		name: "variants",
+		source: types.ImageConfiguration{
+			Variants: map[string]types.ImageVariant{
+				"debug": {Packages: []string{"busybox"}},
+				"dev":   {Packages: []string{"git"}},
+			},
+		},
+		target: types.ImageConfiguration{
+			Variants: map[string]types.ImageVariant{
+				"debug": {Packages: []string{"strace"}},
+			},
+		},
+		expected: types.ImageConfiguration{
+			Variants: map[string]types.ImageVariant{
+				"debug": {Packages: []string{"strace"}},
+				"dev":   {Packages: []string{"git"}},
+			},
+		},
 	}}
 
 	for _, tt := range tests {
@@ -238,3 +544,448 @@ func TestMergeInto(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateCertificates(t *testing.T) {
+	const cert = "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+
+	for _, tc := range []struct {
+		name       string
+		additional []types.AdditionalCertificate
+		wantErr    bool
+	}{{
+		name:       "valid",
+		additional: []types.AdditionalCertificate{{Name: "corp-root", Content: cert}},
+	}, {
+		name:       "invalid name",
+		additional: []types.AdditionalCertificate{{Name: "../corp-root", Content: cert}},
+		wantErr:    true,
+	}, {
+		name:       "duplicate name",
+		additional: []types.AdditionalCertificate{{Name: "corp-root", Content: cert}, {Name: "corp-root", Content: cert}},
+		wantErr:    true,
+	}, {
+		name:       "not a certificate",
+		additional: []types.AdditionalCertificate{{Name: "corp-root", Content: "hello"}},
+		wantErr:    true,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Certificates: &types.ImageCertificates{Additional: tc.additional},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateSystemConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		ic      types.ImageConfiguration
+		wantErr string
+	}{{
+		name: "valid",
+		ic: types.ImageConfiguration{
+			Sysctl:       map[string]string{"net.core.somaxconn": "1024", "kernel/shmmax": "68719476736", "net.ipv4.conf.*.rp_filter": "1"},
+			Limits:       []types.ImageLimit{{Domain: "*", Type: "soft", Item: "nofile", Value: "65536"}, {Domain: "@wheel", Type: "-", Item: "nproc", Value: "unlimited"}},
+			LibraryPaths: []string{"/opt/app/lib"},
+		},
+	}, {
+		name:    "sysctl name",
+		ic:      types.ImageConfiguration{Sysctl: map[string]string{"net core": "1"}},
+		wantErr: `sysctl "net core" is not a valid kernel parameter name`,
+	}, {
+		name:    "sysctl value",
+		ic:      types.ImageConfiguration{Sysctl: map[string]string{"net.core.somaxconn": "1\nkernel.panic = 1"}},
+		wantErr: "sysctl net.core.somaxconn has invalid value",
+	}, {
+		name:    "kernel glob",
+		ic:      types.ImageConfiguration{Kernel: &types.ImageKernel{Modules: []string{"virtio*"}, Firmware: []string{"amdgpu/[navi"}}},
+		wantErr: `kernel filter has invalid glob "amdgpu/[navi"`,
+	}, {
+		name:    "absolute kernel glob",
+		ic:      types.ImageConfiguration{Kernel: &types.ImageKernel{Firmware: []string{"/lib/firmware/amdgpu"}}},
+		wantErr: `kernel filter has invalid glob "/lib/firmware/amdgpu"`,
+	}, {
+		name:    "limit type",
+		ic:      types.ImageConfiguration{Limits: []types.ImageLimit{{Domain: "*", Type: "both", Item: "nofile", Value: "1"}}},
+		wantErr: `unsupported type "both"`,
+	}, {
+		name:    "limit item",
+		ic:      types.ImageConfiguration{Limits: []types.ImageLimit{{Domain: "*", Type: "soft", Item: "files", Value: "1"}}},
+		wantErr: `unsupported item "files"`,
+	}, {
+		name:    "limit domain",
+		ic:      types.ImageConfiguration{Limits: []types.ImageLimit{{Type: "soft", Item: "nofile", Value: "1"}}},
+		wantErr: "invalid domain",
+	}, {
+		name:    "limit value",
+		ic:      types.ImageConfiguration{Limits: []types.ImageLimit{{Domain: "*", Type: "soft", Item: "nofile", Value: "1 2"}}},
+		wantErr: `invalid value "1 2"`,
+	}, {
+		name: "tmpfiles and cron",
+		ic: types.ImageConfiguration{
+			TmpFiles: []types.TmpFile{{Type: "d", Path: "/run/app", Mode: "0755", User: "app"}, {Type: "L+", Path: "/etc/a", Argument: "/etc/b c"}, {Type: "z", Path: "/var/log", Mode: ":~0644"}},
+			Cron:     []types.CronJob{{Schedule: "*/5 * * * *", Command: "/usr/bin/cleanup"}, {Schedule: "0 3 * jan mon-fri", Command: "report", User: "app"}},
+		},
+	}, {
+		name:    "tmpfiles type",
+		ic:      types.ImageConfiguration{TmpFiles: []types.TmpFile{{Type: "y", Path: "/run/app"}}},
+		wantErr: `unsupported type "y"`,
+	}, {
+		name:    "tmpfiles path",
+		ic:      types.ImageConfiguration{TmpFiles: []types.TmpFile{{Type: "d", Path: "run/app"}}},
+		wantErr: "must be an absolute path",
+	}, {
+		name:    "tmpfiles mode",
+		ic:      types.ImageConfiguration{TmpFiles: []types.TmpFile{{Type: "d", Path: "/run/app", Mode: "rwx"}}},
+		wantErr: `invalid mode "rwx"`,
+	}, {
+		name:    "cron schedule",
+		ic:      types.ImageConfiguration{Cron: []types.CronJob{{Schedule: "* * * *", Command: "true"}}},
+		wantErr: `invalid schedule "* * * *"`,
+	}, {
+		name:    "cron command",
+		ic:      types.ImageConfiguration{Cron: []types.CronJob{{Schedule: "* * * * *", Command: "true\nfalse"}}},
+		wantErr: "must have a command of one line",
+	}, {
+		name:    "cron user",
+		ic:      types.ImageConfiguration{Cron: []types.CronJob{{Schedule: "* * * * *", Command: "true", User: "../root"}}},
+		wantErr: `invalid user "../root"`,
+	}, {
+		name:    "relative library path",
+		ic:      types.ImageConfiguration{LibraryPaths: []string{"lib"}},
+		wantErr: `library path "lib" must be an absolute path`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.ic.Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateLicenses(t *testing.T) {
+	for _, tc := range []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: ""},
+		{path: "/licenses"},
+		{path: "/usr/share/doc/licenses/"},
+		{path: "licenses", wantErr: true},
+		{path: "/", wantErr: true},
+		{path: "/licenses/..", wantErr: true},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Licenses: &types.ImageLicenses{Path: tc.path},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidatePlatform(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		variants map[string]string
+		wantErr  bool
+	}{
+		{desc: "none"},
+		{desc: "arm64", variants: map[string]string{"arm64": "v8"}},
+		{desc: "apk name", variants: map[string]string{"aarch64": "v8"}},
+		{desc: "same arm variant", variants: map[string]string{"armv7": "v7"}},
+		{desc: "other arm variant", variants: map[string]string{"arm/v7": "v8"}, wantErr: true},
+		{desc: "unknown architecture", variants: map[string]string{"sparc": "v9"}, wantErr: true},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Platform: &types.ImagePlatform{Variants: tc.variants},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestOCIPlatform(t *testing.T) {
+	ic := types.ImageConfiguration{}
+	require.Equal(t, &v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, ic.OCIPlatform(types.ParseArchitecture("armv7")))
+
+	ic.Platform = &types.ImagePlatform{
+		OSVersion:  "6.1",
+		OSFeatures: []string{"sse4"},
+		Variants:   map[string]string{"arm64": "v8"},
+	}
+	require.Equal(t, &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8", OSVersion: "6.1", OSFeatures: []string{"sse4"}}, ic.OCIPlatform(types.ParseArchitecture("aarch64")))
+	require.Equal(t, &v1.Platform{OS: "linux", Architecture: "amd64", OSVersion: "6.1", OSFeatures: []string{"sse4"}}, ic.OCIPlatform(types.ParseArchitecture("amd64")))
+}
+
+func TestValidateKeyringPolicy(t *testing.T) {
+	fp := "sha256:" + strings.Repeat("ab", 32)
+	for _, tc := range []struct {
+		name    string
+		policy  types.KeyringPolicy
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "pinned", policy: types.KeyringPolicy{Pins: []types.KeyPin{{Repository: "https://example.com/os", Fingerprints: []string{fp}}}}},
+		{name: "warn", policy: types.KeyringPolicy{Mode: types.KeyringPolicyWarn}},
+		{name: "bad mode", policy: types.KeyringPolicy{Mode: "ignore"}, wantErr: true},
+		{name: "no repository", policy: types.KeyringPolicy{Pins: []types.KeyPin{{Fingerprints: []string{fp}}}}, wantErr: true},
+		{name: "no fingerprints", policy: types.KeyringPolicy{Pins: []types.KeyPin{{Repository: "https://example.com/os"}}}, wantErr: true},
+		{name: "bad fingerprint", policy: types.KeyringPolicy{Pins: []types.KeyPin{{Repository: "https://example.com/os", Fingerprints: []string{"abcd"}}}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Contents: types.ImageContents{KeyringPolicy: &tc.policy},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateSigstore(t *testing.T) {
+	const (
+		repo     = "https://example.com/os"
+		identity = "release@example.com"
+		issuer   = "https://accounts.google.com"
+	)
+	for _, tc := range []struct {
+		name     string
+		policies []types.SigstorePolicy
+		wantErr  bool
+	}{
+		{name: "identity", policies: []types.SigstorePolicy{{Repository: repo, Identity: identity, Issuer: issuer}}},
+		{name: "regexps", policies: []types.SigstorePolicy{{Repository: repo, IdentityRegexp: `@example\.com$`, IssuerRegexp: `^https://`, Mode: types.SigstoreModeOnly}}},
+		{name: "no repository", policies: []types.SigstorePolicy{{Identity: identity, Issuer: issuer}}, wantErr: true},
+		{name: "no identity", policies: []types.SigstorePolicy{{Repository: repo, Issuer: issuer}}, wantErr: true},
+		{name: "no issuer", policies: []types.SigstorePolicy{{Repository: repo, Identity: identity}}, wantErr: true},
+		{name: "bad regexp", policies: []types.SigstorePolicy{{Repository: repo, IdentityRegexp: "(", Issuer: issuer}}, wantErr: true},
+		{name: "bad mode", policies: []types.SigstorePolicy{{Repository: repo, Identity: identity, Issuer: issuer, Mode: "never"}}, wantErr: true},
+		{name: "keyring artifact", policies: []types.SigstorePolicy{{Repository: "oci://ghcr.io/example/keys", Identity: identity, Issuer: issuer}}},
+		{name: "keyring artifact mode", policies: []types.SigstorePolicy{{Repository: "oci://ghcr.io/example/keys", Identity: identity, Issuer: issuer, Mode: types.SigstoreModeOnly}}, wantErr: true},
+		{name: "bad keyring artifact", policies: []types.SigstorePolicy{{Repository: "oci://Example/Keys", Identity: identity, Issuer: issuer}}, wantErr: true},
+		{name: "duplicate", policies: []types.SigstorePolicy{
+			{Repository: repo, Identity: identity, Issuer: issuer},
+			{Repository: repo + "/", Identity: identity, Issuer: issuer},
+		}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Contents: types.ImageContents{Sigstore: tc.policies},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateSignaturePolicies(t *testing.T) {
+	const repo = "https://example.com/os"
+	for _, tc := range []struct {
+		name     string
+		policies []types.SignaturePolicy
+		wantErr  bool
+	}{
+		{name: "packages", policies: []types.SignaturePolicy{{Repository: repo, RequireSignedPackages: true, RequiredKeyIDs: []string{"os.rsa.pub"}}}},
+		{name: "unsigned", policies: []types.SignaturePolicy{{Repository: repo, AllowUnsigned: true}}},
+		{name: "no repository", policies: []types.SignaturePolicy{{RequireSignedPackages: true}}, wantErr: true},
+		{name: "bad key id", policies: []types.SignaturePolicy{{Repository: repo, RequiredKeyIDs: []string{"keys/os.rsa.pub"}}}, wantErr: true},
+		{name: "duplicate", policies: []types.SignaturePolicy{{Repository: repo}, {Repository: repo + "/"}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Contents: types.ImageContents{SignaturePolicies: tc.policies},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateLocalFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		files   []types.LocalFile
+		wantErr bool
+	}{
+		{name: "directory", files: []types.LocalFile{{Source: "app", Destination: "/srv/app", UID: 65532, Exclude: []string{"**/*.md", "!README.md"}}}},
+		{name: "file", files: []types.LocalFile{{Source: "motd", Destination: "/etc/", Permissions: 0o600}}},
+		{name: "no source", files: []types.LocalFile{{Destination: "/srv"}}, wantErr: true},
+		{name: "relative destination", files: []types.LocalFile{{Source: "app", Destination: "srv/app"}}, wantErr: true},
+		{name: "bad permissions", files: []types.LocalFile{{Source: "app", Destination: "/srv", Permissions: 0o10000}}, wantErr: true},
+		{name: "bad exclude", files: []types.LocalFile{{Source: "app", Destination: "/srv", Exclude: []string{"[a-"}}}, wantErr: true},
+		{name: "absolute source", files: []types.LocalFile{{Source: "/etc/shadow", Destination: "/etc/"}}, wantErr: true},
+		{name: "parent source", files: []types.LocalFile{{Source: "app/../../secrets", Destination: "/srv"}}, wantErr: true},
+		{name: "parent exclude", files: []types.LocalFile{{Source: "app", Destination: "/srv", Exclude: []string{"!../secrets"}}}, wantErr: true},
+		{name: "substitutions", files: []types.LocalFile{{Source: "nginx.conf", Destination: "/etc/nginx/nginx.conf", Substitutions: map[string]string{"WORKERS": "4"}}}},
+		{name: "dotted substitution", files: []types.LocalFile{{Source: "nginx.conf", Destination: "/etc/nginx/nginx.conf", Substitutions: map[string]string{"build.arch": "x"}}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Contents: types.ImageContents{LocalFiles: tc.files},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateRemoteFiles(t *testing.T) {
+	const (
+		u      = "https://example.com/tool-1.0.tar.gz"
+		digest = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	)
+	for _, tc := range []struct {
+		name    string
+		files   []types.RemoteFile
+		wantErr bool
+	}{
+		{name: "file", files: []types.RemoteFile{{URL: u, SHA256: digest, Destination: "/usr/bin/tool"}}},
+		{name: "archive", files: []types.RemoteFile{{URL: u, SHA256: digest, Destination: "/opt/tool", Extract: true, StripComponents: 1}}},
+		{name: "bad scheme", files: []types.RemoteFile{{URL: "ftp://example.com/tool", SHA256: digest, Destination: "/usr/bin/tool"}}, wantErr: true},
+		{name: "no digest", files: []types.RemoteFile{{URL: u, Destination: "/usr/bin/tool"}}, wantErr: true},
+		{name: "prefixed digest", files: []types.RemoteFile{{URL: u, SHA256: "sha256:" + digest, Destination: "/usr/bin/tool"}}, wantErr: true},
+		{name: "relative destination", files: []types.RemoteFile{{URL: u, SHA256: digest, Destination: "usr/bin/tool"}}, wantErr: true},
+		{name: "strip without extract", files: []types.RemoteFile{{URL: u, SHA256: digest, Destination: "/opt/tool", StripComponents: 1}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{
+				Contents: types.ImageContents{RemoteFiles: tc.files},
+			}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestValidateDirectories(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		dirs    types.ImageDirectories
+		wantErr bool
+	}{
+		{name: "umask", dirs: types.ImageDirectories{Umask: 0o027}},
+		{name: "modes", dirs: types.ImageDirectories{Modes: []types.DirectoryMode{{Path: "/var/lib/*", Mode: 0o750}, {Path: "/tmp", Mode: 0o1777}}}},
+		{name: "allow", dirs: types.ImageDirectories{ForbidWorldWritable: true, AllowWorldWritable: []string{"/tmp", "/var/tmp"}}},
+		{name: "bad umask", dirs: types.ImageDirectories{Umask: 0o2022}, wantErr: true},
+		{name: "relative mode path", dirs: types.ImageDirectories{Modes: []types.DirectoryMode{{Path: "var/lib", Mode: 0o750}}}, wantErr: true},
+		{name: "bad mode pattern", dirs: types.ImageDirectories{Modes: []types.DirectoryMode{{Path: "/var/[a-", Mode: 0o750}}}, wantErr: true},
+		{name: "no mode", dirs: types.ImageDirectories{Modes: []types.DirectoryMode{{Path: "/var/lib"}}}, wantErr: true},
+		{name: "bad mode", dirs: types.ImageDirectories{Modes: []types.DirectoryMode{{Path: "/var/lib", Mode: 0o10755}}}, wantErr: true},
+		{name: "relative allow", dirs: types.ImageDirectories{AllowWorldWritable: []string{"tmp"}}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := types.ImageConfiguration{Directories: &tc.dirs}
+			if tc.wantErr {
+				require.Error(t, ic.Validate())
+			} else {
+				require.NoError(t, ic.Validate())
+			}
+		})
+	}
+}
+
+func TestProbeVCS(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := repo.Worktree()
+	require.NoError(t, err)
+	sub := filepath.Join(dir, "images", "foo")
+	require.NoError(t, os.MkdirAll(sub, 0o755))
+	config := filepath.Join(sub, "apko.yaml")
+	require.NoError(t, os.WriteFile(config, []byte("{}\n"), 0o644))
+	_, err = wt.Add("images/foo/apko.yaml")
+	require.NoError(t, err)
+	sig := &object.Signature{Name: "test", Email: "test@example.com"}
+	hash, err := wt.Commit("initial", &git.CommitOptions{Author: sig})
+	require.NoError(t, err)
+	_, err = repo.CreateTag("foo/v1.2.3", hash, nil)
+	require.NoError(t, err)
+	_, err = repo.CreateTag("bar/v4.5.6", hash, nil)
+	require.NoError(t, err)
+
+	// Without a remote, the revision is annotated directly.
+	var ic types.ImageConfiguration
+	ic.ProbeVCS(ctx, config, "", "foo/")
+	require.Empty(t, ic.VCSUrl)
+	require.Equal(t, map[string]string{
+		"org.opencontainers.image.revision": hash.String(),
+		"org.opencontainers.image.version":  "1.2.3",
+	}, ic.Annotations)
+
+	// Annotations which are set are kept.
+	_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: "origin", URLs: []string{"https://example.com/repo.git"}})
+	require.NoError(t, err)
+	ic = types.ImageConfiguration{Annotations: map[string]string{"org.opencontainers.image.version": "2"}}
+	ic.ProbeVCS(ctx, sub, "", "bar/")
+	require.Equal(t, "https://example.com/repo.git@"+hash.String(), ic.VCSUrl)
+	require.Equal(t, map[string]string{"org.opencontainers.image.version": "2"}, ic.Annotations)
+
+	// Repositories outside of the top-level directory are not probed.
+	ic = types.ImageConfiguration{}
+	ic.ProbeVCS(ctx, sub, sub, "")
+	require.Empty(t, ic.VCSUrl)
+	require.Empty(t, ic.Annotations)
+}
+
+func TestDigest(t *testing.T) {
+	ic := types.ImageConfiguration{
+		Contents:    types.ImageContents{Packages: []string{"busybox"}},
+		Archs:       []types.Architecture{types.ParseArchitecture("amd64")},
+		Environment: map[string]string{"B": "2", "A": "1"},
+	}
+	digest, err := ic.Digest()
+	require.NoError(t, err)
+	require.Regexp(t, "^sha256:[0-9a-f]{64}$", digest)
+
+	// The architectures, the include and the digest annotation are left out.
+	same := ic
+	same.Archs = nil
+	same.Include = "base.yaml"
+	same.Annotations = map[string]string{types.ConfigDigestAnnotation: digest}
+	got, err := same.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest, got)
+	require.Equal(t, map[string]string{types.ConfigDigestAnnotation: digest}, same.Annotations)
+
+	changed := ic
+	changed.Environment = map[string]string{"A": "1", "B": "3"}
+	got, err = changed.Digest()
+	require.NoError(t, err)
+	require.NotEqual(t, digest, got)
+}
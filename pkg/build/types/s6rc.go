@@ -0,0 +1,149 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// s6rcNameRegex matches the names of s6-rc services, which name directories.
+var s6rcNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// s6rcReservedNames are the services s6-overlay defines itself.
+var s6rcReservedNames = []string{"base", "user", "user2", "s6rc-oneshot-runner", "s6rc-fdholder"}
+
+// ValidateS6RC checks the s6-rc services of the entrypoint, and for an
+// image configured to run them, points the entrypoint at s6-overlay.
+func (ic *ImageConfiguration) ValidateS6RC() error {
+	ep := &ic.Entrypoint
+	if ep.Type != "s6-rc" {
+		if len(ep.S6RC) != 0 {
+			return fmt.Errorf("entrypoint s6-rc services require the s6-rc entrypoint type")
+		}
+		return nil
+	}
+	if len(ep.S6RC) == 0 {
+		return fmt.Errorf("the s6-rc entrypoint type requires s6-rc services")
+	}
+	if len(ep.Services) != 0 {
+		return fmt.Errorf("entrypoint services require the service-bundle entrypoint type")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(ep.S6RC)) {
+		if err := validateS6RCService(name, ep.S6RC[name], ep.S6RC); err != nil {
+			return err
+		}
+	}
+	if err := checkS6RCCycles(ep.S6RC); err != nil {
+		return err
+	}
+
+	ep.Command = "/init"
+
+	// As for service bundles, apk fixes up a duplicate entry.
+	ic.Contents.Packages = append(ic.Contents.Packages, "s6-overlay")
+
+	return nil
+}
+
+func validateS6RCService(name string, svc S6RCService, services map[string]S6RCService) error {
+	if !s6rcNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid s6-rc service name %q", name)
+	}
+	if slices.Contains(s6rcReservedNames, name) {
+		return fmt.Errorf("s6-rc service name %q is reserved by s6-overlay", name)
+	}
+
+	switch svc.Type {
+	case "longrun":
+		if svc.Run == "" {
+			return fmt.Errorf("s6-rc longrun %q has no run command", name)
+		}
+		if svc.NotificationFD < 0 || (svc.NotificationFD > 0 && svc.NotificationFD < 3) {
+			return fmt.Errorf("s6-rc longrun %q: notification-fd must be 3 or more, got %d", name, svc.NotificationFD)
+		}
+		if svc.Up != "" || svc.Down != "" || len(svc.Contents) != 0 {
+			return fmt.Errorf("s6-rc longrun %q only supports run, finish, notification-fd, readiness-check and dependencies", name)
+		}
+	case "oneshot":
+		if svc.Up == "" {
+			return fmt.Errorf("s6-rc oneshot %q has no up command", name)
+		}
+		if svc.Run != "" || svc.Finish != "" || svc.NotificationFD != 0 || svc.ReadinessCheck != "" || len(svc.Contents) != 0 {
+			return fmt.Errorf("s6-rc oneshot %q only supports up, down and dependencies", name)
+		}
+	case "bundle":
+		if len(svc.Contents) == 0 {
+			return fmt.Errorf("s6-rc bundle %q has no contents", name)
+		}
+		if svc.Run != "" || svc.Finish != "" || svc.NotificationFD != 0 || svc.ReadinessCheck != "" ||
+			svc.Up != "" || svc.Down != "" || len(svc.Dependencies) != 0 {
+			return fmt.Errorf("s6-rc bundle %q only supports contents", name)
+		}
+	default:
+		return fmt.Errorf("s6-rc service %q has unsupported type %q, must be longrun, oneshot or bundle", name, svc.Type)
+	}
+
+	for _, ref := range slices.Concat(svc.Dependencies, svc.Contents) {
+		if ref == name {
+			return fmt.Errorf("s6-rc service %q refers to itself", name)
+		}
+		if _, ok := services[ref]; !ok {
+			return fmt.Errorf("s6-rc service %q refers to undefined service %q", name, ref)
+		}
+	}
+	return nil
+}
+
+// checkS6RCCycles fails if services depend on each other, directly or
+// through bundles, as s6-rc could not order them.
+func checkS6RCCycles(services map[string]S6RCService) error {
+	const (
+		visiting = iota + 1
+		done
+	)
+	state := map[string]int{}
+	var visit func(name string, chain []string) error
+	visit = func(name string, chain []string) error {
+		switch state[name] {
+		case visiting:
+			cycle := append(slices.Clone(chain[slices.Index(chain, name):]), name)
+			return fmt.Errorf("s6-rc dependency cycle: %s", strings.Join(cycle, " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		chain = append(chain, name)
+		svc := services[name]
+		for _, ref := range slices.Concat(svc.Dependencies, svc.Contents) {
+			if err := visit(ref, chain); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateS6RC(t *testing.T) {
+	services := func() map[string]S6RCService {
+		return map[string]S6RCService{
+			"migrate": {Type: "oneshot", Up: "/usr/bin/migrate"},
+			"app": {
+				Type:           "longrun",
+				Run:            "/usr/bin/app",
+				ReadinessCheck: "/usr/bin/curl -sf http://localhost:8080/health",
+				Dependencies:   []string{"migrate"},
+			},
+			"stack": {Type: "bundle", Contents: []string{"app", "migrate"}},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		typ     string
+		mutate  func(map[string]S6RCService)
+		wantErr string
+	}{{
+		name: "valid",
+		typ:  "s6-rc",
+	}, {
+		name:    "wrong entrypoint type",
+		wantErr: "require the s6-rc entrypoint type",
+	}, {
+		name:    "invalid name",
+		typ:     "s6-rc",
+		mutate:  func(s map[string]S6RCService) { s["../etc"] = S6RCService{Type: "oneshot", Up: "true"} },
+		wantErr: `invalid s6-rc service name "../etc"`,
+	}, {
+		name:    "reserved name",
+		typ:     "s6-rc",
+		mutate:  func(s map[string]S6RCService) { s["user"] = S6RCService{Type: "bundle", Contents: []string{"app"}} },
+		wantErr: `"user" is reserved`,
+	}, {
+		name:    "unknown type",
+		typ:     "s6-rc",
+		mutate:  func(s map[string]S6RCService) { s["app"] = S6RCService{Type: "daemon", Run: "/usr/bin/app"} },
+		wantErr: `unsupported type "daemon"`,
+	}, {
+		name:    "longrun without run",
+		typ:     "s6-rc",
+		mutate:  func(s map[string]S6RCService) { s["app"] = S6RCService{Type: "longrun"} },
+		wantErr: `longrun "app" has no run command`,
+	}, {
+		name: "stdio notification fd",
+		typ:  "s6-rc",
+		mutate: func(s map[string]S6RCService) {
+			s["app"] = S6RCService{Type: "longrun", Run: "/usr/bin/app", NotificationFD: 1}
+		},
+		wantErr: "notification-fd must be 3 or more",
+	}, {
+		name:    "oneshot with run",
+		typ:     "s6-rc",
+		mutate:  func(s map[string]S6RCService) { s["migrate"] = S6RCService{Type: "oneshot", Up: "true", Run: "true"} },
+		wantErr: `oneshot "migrate" only supports`,
+	}, {
+		name: "bundle with dependencies",
+		typ:  "s6-rc",
+		mutate: func(s map[string]S6RCService) {
+			s["stack"] = S6RCService{Type: "bundle", Contents: []string{"app"}, Dependencies: []string{"migrate"}}
+		},
+		wantErr: `bundle "stack" only supports contents`,
+	}, {
+		name: "undefined dependency",
+		typ:  "s6-rc",
+		mutate: func(s map[string]S6RCService) {
+			s["app"] = S6RCService{Type: "longrun", Run: "/usr/bin/app", Dependencies: []string{"db"}}
+		},
+		wantErr: `"app" refers to undefined service "db"`,
+	}, {
+		name: "cycle through a bundle",
+		typ:  "s6-rc",
+		mutate: func(s map[string]S6RCService) {
+			s["migrate"] = S6RCService{Type: "oneshot", Up: "true", Dependencies: []string{"stack"}}
+		},
+		wantErr: "s6-rc dependency cycle: app -> migrate -> stack -> app",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &ImageConfiguration{Entrypoint: ImageEntrypoint{Type: tc.typ, S6RC: services()}}
+			if tc.mutate != nil {
+				tc.mutate(ic.Entrypoint.S6RC)
+			}
+
+			err := ic.ValidateS6RC()
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "/init", ic.Entrypoint.Command)
+			require.Contains(t, ic.Contents.Packages, "s6-overlay")
+		})
+	}
+}
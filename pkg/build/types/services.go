@@ -0,0 +1,73 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// serviceNameRegex matches the names of services, which name directories.
+var serviceNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// serviceUserRegex matches the users services run as, by name or ID.
+var serviceUserRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// ValidateServices checks the services of the configuration, and makes
+// the image a service bundle which runs them.
+func (ic *ImageConfiguration) ValidateServices() error {
+	if len(ic.Services) == 0 {
+		return nil
+	}
+
+	ep := ic.Entrypoint
+	if (ep.Type != "" && ep.Type != "service-bundle") || ep.ShellFragment != "" ||
+		(ep.Command != "" && ep.Command != serviceBundleCommand) ||
+		len(ep.Services) != 0 || len(ep.S6RC) != 0 {
+		return fmt.Errorf("services replace the entrypoint, which must not be set")
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(ic.Services)) {
+		svc := ic.Services[name]
+		if !serviceNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid service name %q", name)
+		}
+		if strings.TrimSpace(svc.Command) == "" {
+			return fmt.Errorf("service %q has no command", name)
+		}
+		switch svc.Restart {
+		case "", ServiceRestartAlways, ServiceRestartOnFailure, ServiceRestartNever:
+		default:
+			return fmt.Errorf("service %q has unsupported restart policy %q, must be one of: %s, %s, %s", name, svc.Restart, ServiceRestartAlways, ServiceRestartOnFailure, ServiceRestartNever)
+		}
+		if svc.User != "" && !serviceUserRegex.MatchString(svc.User) {
+			return fmt.Errorf("service %q has invalid user %q", name, svc.User)
+		}
+		if svc.WorkDir != "" && !strings.HasPrefix(svc.WorkDir, "/") {
+			return fmt.Errorf("service %q has work-dir %q, which must be an absolute path", name, svc.WorkDir)
+		}
+		for k := range svc.Environment {
+			if !substitutionNameRegex.MatchString(k) {
+				return fmt.Errorf("service %q has invalid environment variable name %q", name, k)
+			}
+		}
+	}
+
+	ic.Entrypoint.Type = "service-bundle"
+	return nil
+}
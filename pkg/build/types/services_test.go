@@ -0,0 +1,98 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateServices(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		entrypoint ImageEntrypoint
+		svc        ImageService
+		svcName    string
+		wantErr    string
+	}{{
+		name: "valid",
+		svc: ImageService{
+			Command:     "/usr/bin/app",
+			Environment: map[string]string{"PORT": "8080"},
+			Restart:     ServiceRestartOnFailure,
+			User:        "nonroot",
+			WorkDir:     "/srv",
+		},
+	}, {
+		name:       "service bundle entrypoint",
+		entrypoint: ImageEntrypoint{Type: "service-bundle", Command: "/bin/s6-svscan /sv"},
+		svc:        ImageService{Command: "/usr/bin/app"},
+	}, {
+		name:       "entrypoint command",
+		entrypoint: ImageEntrypoint{Command: "/usr/bin/app"},
+		svc:        ImageService{Command: "/usr/bin/app"},
+		wantErr:    "services replace the entrypoint",
+	}, {
+		name:    "invalid name",
+		svcName: "../app",
+		svc:     ImageService{Command: "/usr/bin/app"},
+		wantErr: `invalid service name "../app"`,
+	}, {
+		name:    "no command",
+		svc:     ImageService{Restart: ServiceRestartNever},
+		wantErr: "has no command",
+	}, {
+		name:    "unknown restart policy",
+		svc:     ImageService{Command: "/usr/bin/app", Restart: "unless-stopped"},
+		wantErr: `unsupported restart policy "unless-stopped"`,
+	}, {
+		name:    "relative work-dir",
+		svc:     ImageService{Command: "/usr/bin/app", WorkDir: "srv"},
+		wantErr: "must be an absolute path",
+	}, {
+		name:    "invalid user",
+		svc:     ImageService{Command: "/usr/bin/app", User: "app user"},
+		wantErr: `invalid user "app user"`,
+	}, {
+		name:    "invalid environment variable",
+		svc:     ImageService{Command: "/usr/bin/app", Environment: map[string]string{"A-B": "1"}},
+		wantErr: `invalid environment variable name "A-B"`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			name := tc.svcName
+			if name == "" {
+				name = "app"
+			}
+			ic := &ImageConfiguration{
+				Entrypoint: tc.entrypoint,
+				Services:   map[string]ImageService{name: tc.svc},
+			}
+
+			err := ic.Validate()
+			if tc.wantErr != "" {
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "service-bundle", ic.Entrypoint.Type)
+			require.Equal(t, "/bin/s6-svscan /sv", ic.Entrypoint.Command)
+			require.Contains(t, ic.Contents.Packages, "s6")
+
+			// Validating again, as builds of each architecture do, is fine.
+			require.NoError(t, ic.Validate())
+		})
+	}
+}
@@ -83,12 +83,93 @@ type ImageContents struct {
 	// initial construction of the image, and also at runtime by seeding them
 	// into /etc/apk/repositories in the resulting image.
 	RuntimeRepositories []string `json:"repositories,omitempty" yaml:"repositories,omitempty"`
-	// A list of public keys used to verify the desired repositories
+	// A list of public keys used to verify the desired repositories. An
+	// oci:// reference installs the keys held by the layers of an OCI artifact
 	Keyring []string `json:"keyring,omitempty" yaml:"keyring,omitempty"`
 	// A list of packages to include in the image
 	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
 	// Optional: Base image to build on top of. Warning: Experimental.
 	BaseImage *BaseImageDescriptor `json:"baseimage,omitempty" yaml:"baseimage,omitempty" apko:"experimental"`
+	// Optional: Pinned fingerprints of the keys trusted to sign the repositories
+	KeyringPolicy *KeyringPolicy `json:"keyring_policy,omitempty" yaml:"keyring_policy,omitempty"`
+	// Optional: Sigstore identities expected to have signed the indexes of repositories
+	Sigstore []SigstorePolicy `json:"sigstore,omitempty" yaml:"sigstore,omitempty"`
+	// Optional: How the signatures of the indexes and packages of repositories are verified
+	SignaturePolicies []SignaturePolicy `json:"signature_policies,omitempty" yaml:"signature_policies,omitempty"`
+	// Optional: Files and directories copied from the build context into the image
+	LocalFiles []LocalFile `json:"local_files,omitempty" yaml:"local_files,omitempty"`
+	// Optional: Files fetched by URL and pinned by digest, installed or
+	// extracted into the image
+	RemoteFiles []RemoteFile `json:"remote_files,omitempty" yaml:"remote_files,omitempty"`
+}
+
+type RemoteFile struct {
+	// Required: The http, https or file URL to fetch the file from
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	// Required: The hex encoded sha256 digest of the file
+	SHA256 string `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	// Required: The absolute path in the image to install the file at, or to
+	// extract the archive under
+	Destination string `json:"destination,omitempty" yaml:"destination,omitempty"`
+	// Optional: Whether the file is a tar (optionally compressed with gzip or
+	// zstd) or zip archive to extract under the destination
+	Extract bool `json:"extract,omitempty" yaml:"extract,omitempty"`
+	// Optional: The number of leading directories to strip from the paths of
+	// the extracted files
+	StripComponents int `json:"strip_components,omitempty" yaml:"strip_components,omitempty"`
+	// Optional: The architectures to install the file for, by default all of
+	// them
+	Archs []Architecture `json:"archs,omitempty" yaml:"archs,omitempty"`
+	// Optional: The user ID owning the installed files
+	UID uint32 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	// Optional: The group ID owning the installed files
+	GID uint32 `json:"gid,omitempty" yaml:"gid,omitempty"`
+	// Optional: The permission bits of the installed file, by default 0755.
+	// Extracted files keep the permissions of the archive.
+	Permissions uint32 `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+type LocalFile struct {
+	// Required: The file or directory to copy, relative to the working
+	// directory or one of the include paths
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	// Required: The absolute path in the image to copy to. The contents of a
+	// directory are copied under it, and a file is copied into it when the
+	// path ends with a slash.
+	Destination string `json:"destination,omitempty" yaml:"destination,omitempty"`
+	// Optional: The user ID owning the copied files
+	UID uint32 `json:"uid,omitempty" yaml:"uid,omitempty"`
+	// Optional: The group ID owning the copied files
+	GID uint32 `json:"gid,omitempty" yaml:"gid,omitempty"`
+	// Optional: The permission bits of the copied files, by default 0755 for
+	// executables and 0644 for anything else. Directories are always 0755.
+	Permissions uint32 `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	// Optional: Glob patterns, relative to the source directory, of files to
+	// leave out. A "**" matches any number of directories and a leading "!"
+	// brings back a file excluded by an earlier pattern.
+	Exclude []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	// Optional: Variables substituted for their ${{name}} references in the
+	// copied files. Values and files can also reference the built-in
+	// variables build.arch, package.<name>.version and lock.digest. Files are
+	// copied as is when unset.
+	Substitutions map[string]string `json:"substitutions,omitempty" yaml:"substitutions,omitempty"`
+}
+
+type KeyringPolicy struct {
+	// Optional: What happens to keys whose fingerprint is not pinned, either
+	// "enforce" to reject them (the default) or "warn" to only log them
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Required: The fingerprints of the keys expected to sign each repository.
+	// Keys from the keyring must match the pins of any repository.
+	Pins []KeyPin `json:"pins,omitempty" yaml:"pins,omitempty"`
+}
+
+type KeyPin struct {
+	// Required: The repository signed by the keys
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// Required: The fingerprints of the keys, each "sha256:" followed by the
+	// hex encoded SHA-256 digest of the DER encoded public key
+	Fingerprints []string `json:"fingerprints,omitempty" yaml:"fingerprints,omitempty"`
 }
 
 // MarshalYAML implements yaml.Marshaler for ImageContents, redacting URLs in
@@ -128,7 +209,7 @@ func (i ImageContents) MarshalYAML() (interface{}, error) {
 }
 
 type ImageEntrypoint struct {
-	// Optional: The type of entrypoint. Only "service-bundle" is supported.
+	// Optional: The type of entrypoint, either "service-bundle" or "s6-rc".
 	Type string `json:"type,omitempty"`
 	// Required: The command of the entrypoint
 	Command string `json:"command,omitempty"`
@@ -136,6 +217,177 @@ type ImageEntrypoint struct {
 	ShellFragment string `json:"shell-fragment,omitempty" yaml:"shell-fragment"`
 
 	Services map[string]string `json:"services,omitempty"`
+
+	// Optional: The s6-rc services started by s6-overlay, keyed by name.
+	// The type should be "s6-rc" when specifying them.
+	S6RC map[string]S6RCService `json:"s6-rc,omitempty" yaml:"s6-rc,omitempty"`
+}
+
+// S6RCService describes an s6-rc service definition.
+type S6RCService struct {
+	// Required: The type of the service, one of "longrun", "oneshot" or "bundle"
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Required for longruns: The execline command running the service
+	Run string `json:"run,omitempty" yaml:"run,omitempty"`
+	// Optional for longruns: The execline command run when the service exits
+	Finish string `json:"finish,omitempty" yaml:"finish,omitempty"`
+	// Optional for longruns: The file descriptor the service writes a newline
+	// to once it is ready
+	NotificationFD int `json:"notification-fd,omitempty" yaml:"notification-fd,omitempty"`
+	// Optional for longruns: An execline command polled until it succeeds
+	// once the service is started, to tell it is ready
+	ReadinessCheck string `json:"readiness-check,omitempty" yaml:"readiness-check,omitempty"`
+	// Required for oneshots: The execline command bringing the service up
+	Up string `json:"up,omitempty" yaml:"up,omitempty"`
+	// Optional for oneshots: The execline command bringing the service down
+	Down string `json:"down,omitempty" yaml:"down,omitempty"`
+	// Optional: The services which must be up before this one is started
+	Dependencies []string `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	// Required for bundles: The services the bundle groups
+	Contents []string `json:"contents,omitempty" yaml:"contents,omitempty"`
+}
+
+// OSRelease describes the fields to set in /etc/os-release.
+//
+// Any field left empty is preserved from the os-release file installed by
+// packages (if any), so only the fields that need to change have to be set.
+type OSRelease struct {
+	// Optional: The NAME field
+	Name string `json:"name,omitempty"`
+	// Optional: The ID field
+	ID string `json:"id,omitempty"`
+	// Optional: The VERSION_ID field
+	VersionID string `json:"version-id,omitempty" yaml:"version-id,omitempty"`
+	// Optional: The PRETTY_NAME field
+	PrettyName string `json:"pretty-name,omitempty" yaml:"pretty-name,omitempty"`
+	// Optional: The HOME_URL field
+	HomeURL string `json:"home-url,omitempty" yaml:"home-url,omitempty"`
+	// Optional: The BUG_REPORT_URL field
+	BugReportURL string `json:"bug-report-url,omitempty" yaml:"bug-report-url,omitempty"`
+	// Optional: Additional fields to set, keyed by their os-release variable
+	// name (e.g. VARIANT_ID)
+	Extra map[string]string `json:"extra,omitempty" yaml:"extra,omitempty"`
+}
+
+type ImageCertificates struct {
+	// Optional: Additional certificates to add to the CA certificate bundle
+	Additional []AdditionalCertificate `json:"additional,omitempty" yaml:"additional,omitempty"`
+}
+
+type ImageLicenses struct {
+	// Optional: The directory to collect the license files into, with a
+	// subdirectory per package. Defaults to /licenses.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// ImagePlatform sets the fields of the OCI platform of the images beyond the
+// OS and architecture, in the index and their configs, see
+// ImageConfiguration.OCIPlatform.
+type ImagePlatform struct {
+	// Optional: The os.version of the platform of the images
+	OSVersion string `json:"os.version,omitempty" yaml:"os.version,omitempty"`
+	// Optional: The os.features of the platform of the images
+	OSFeatures []string `json:"os.features,omitempty" yaml:"os.features,omitempty"`
+	// Optional: The variant of the platform of the image of each
+	// architecture, e.g. v8 for arm64. The variants of arm/v6 and arm/v7
+	// are always v6 and v7.
+	Variants map[string]string `json:"variants,omitempty" yaml:"variants,omitempty"`
+}
+
+type ImageHistory struct {
+	// Optional: The comment of the history entry of each layer built by
+	// apko, e.g. the ticket or pipeline the image was built for
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
+}
+
+type ImageVariant struct {
+	// Optional: Packages to install in addition to those of the configuration
+	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
+	// Optional: Packages of the configuration not to install, by name
+	RemovePackages []string `json:"remove-packages,omitempty" yaml:"remove-packages,omitempty"`
+	// Optional: Environment variables to set, overriding those of the
+	// configuration
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// Optional: The entrypoint, replacing that of the configuration
+	Entrypoint *ImageEntrypoint `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
+	// Optional: The command, replacing that of the configuration
+	Cmd string `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	// Optional: Paths mutations to apply after those of the configuration
+	Paths []PathMutation `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
+type ImageLimit struct {
+	// Required: Who the limit applies to: a user name, a group name
+	// prefixed with @, or * for everyone
+	Domain string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	// Required: soft, hard, or - for both
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Required: The resource limited, e.g. nofile, nproc or memlock
+	Item string `json:"item,omitempty" yaml:"item,omitempty"`
+	// Required: The value of the limit, e.g. 65536 or unlimited
+	Value string `json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+type TmpFile struct {
+	// Required: The type of the entry, e.g. d to create a directory, f to
+	// create a file or L to create a symlink, see tmpfiles.d(5)
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Required: The absolute path of the file
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Optional: The octal mode of the file, e.g. 0755
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Optional: The user owning the file
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+	// Optional: The group owning the file
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Optional: How old files must be to be cleaned up, e.g. 10d
+	Age string `json:"age,omitempty" yaml:"age,omitempty"`
+	// Optional: The argument of the entry, e.g. the target of a symlink or
+	// the content of a file
+	Argument string `json:"argument,omitempty" yaml:"argument,omitempty"`
+}
+
+type CronJob struct {
+	// Required: When to run the job, as the five fields of a crontab:
+	// minute, hour, day of month, month and day of week
+	Schedule string `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	// Required: The command to run, by the shell
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Optional: The user to run the job as, root by default, which must be
+	// a user of the image
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+}
+
+type ImageService struct {
+	// Required: The command running the process, as an execline script
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+	// Optional: Environment variables to set for the process
+	Environment map[string]string `json:"environment,omitempty" yaml:"environment,omitempty"`
+	// Optional: When to restart the process once it exits: "always" (the
+	// default), "on-failure" or "never"
+	Restart string `json:"restart,omitempty" yaml:"restart,omitempty"`
+	// Optional: The user to run the process as, root by default
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+	// Optional: The directory to run the process in
+	WorkDir string `json:"work-dir,omitempty" yaml:"work-dir,omitempty"`
+}
+
+type ImageKernel struct {
+	// Optional: Globs of the kernel modules to install, by name or by path
+	// under /lib/modules/<version>, along with the modules they depend on.
+	// All modules are installed when unset.
+	Modules []string `json:"modules,omitempty" yaml:"modules,omitempty"`
+	// Optional: Globs of the firmware files to install, by path under
+	// /lib/firmware. All firmware is installed when unset.
+	Firmware []string `json:"firmware,omitempty" yaml:"firmware,omitempty"`
+}
+
+type AdditionalCertificate struct {
+	// Required: The name of the certificate, used for its file name in
+	// /usr/local/share/ca-certificates
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Required: The PEM encoded certificate
+	Content string `json:"content,omitempty" yaml:"content,omitempty"`
 }
 
 type ImageAccounts struct {
@@ -178,12 +430,19 @@ type ImageConfiguration struct {
 	VCSUrl string `json:"vcs-url,omitempty" yaml:"vcs-url,omitempty"`
 	// Optional: Annotations to apply to the images manifests
 	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
-	// Optional: Path to a local file containing additional image configuration
-	//
-	// The included configuration is deep merged with the parent configuration
+	// Optional: Path to a local file containing a base image configuration
 	//
-	// Deprecated: This will be removed in a future release.
+	// The configuration is merged on top of the included configuration, see
+	// the documentation for how each field is merged.
 	Include string `json:"include,omitempty" yaml:"include,omitempty"`
+	// Optional: A named profile, "wolfi" or "alpine[:<version>]", providing
+	// defaults for the repositories, keyring, architectures and cmd which the
+	// configuration leaves unset
+	Flavor string `json:"flavor,omitempty" yaml:"flavor,omitempty"`
+	// Optional: Named variants of the image, e.g. dev, debug or prod, each
+	// changing the packages, environment and entrypoint of the
+	// configuration, built with --variant
+	Variants map[string]ImageVariant `json:"variants,omitempty" yaml:"variants,omitempty"`
 
 	// Optional: A list of volumes to configure
 	//
@@ -196,6 +455,117 @@ type ImageConfiguration struct {
 
 	// Optional: Configuration to control layering of the OCI image.
 	Layering *Layering `json:"layering,omitempty" yaml:"layering,omitempty"`
+
+	// Optional: Fields to set in /etc/os-release
+	//
+	// The fields are merged with the os-release file installed by packages,
+	// overriding any fields which are set here.
+	OSRelease *OSRelease `json:"os-release,omitempty" yaml:"os-release,omitempty"`
+
+	// Optional: Certificates to add to the image's CA certificate bundle
+	//
+	// When set, the bundle at /etc/ssl/certs/ca-certificates.crt is
+	// regenerated from the certificates installed by packages plus the ones
+	// listed here.
+	Certificates *ImageCertificates `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+
+	// Optional: Collect the license files of the installed packages
+	//
+	// The license files each package installs, under /usr/share/licenses or
+	// elsewhere (e.g. LICENSE, COPYING and NOTICE files), are copied into
+	// one directory, and listed in the SBOM.
+	Licenses *ImageLicenses `json:"licenses,omitempty" yaml:"licenses,omitempty"`
+
+	// Optional: How much of the apk database to keep in the image
+	//
+	// This can be one of:
+	//   - full (the default): keep the whole database, so apk can be used to
+	//     inspect and modify the image at runtime.
+	//   - installed: keep the list of installed packages, but drop the package
+	//     scripts and triggers. apk can still inspect the image, but packages
+	//     upgraded or removed at runtime will not run their scripts.
+	//   - none: drop /usr/lib/apk/db and /etc/apk entirely. apk cannot be used
+	//     in the image, and scanners have to rely on the SBOM generated at
+	//     build time to know what is installed.
+	APKDatabase string `json:"apk-database,omitempty" yaml:"apk-database,omitempty"`
+
+	// Optional: The SBOM formats to generate, e.g. spdx and cyclonedx
+	//
+	// The --sbom-formats flag takes precedence when it is set. When neither
+	// is set, only an SPDX SBOM is generated.
+	SBOMFormats []string `json:"sbom-formats,omitempty" yaml:"sbom-formats,omitempty"`
+
+	// Optional: Fields of the OCI platform of the images besides their
+	// OS and architecture
+	//
+	// They are set in the configuration of each image and in its entry in
+	// the index, which runtimes use to select the image to run.
+	Platform *ImagePlatform `json:"platform,omitempty" yaml:"platform,omitempty"`
+
+	// Optional: Entries of the history of the images
+	//
+	// Each layer built by apko gets an entry whose created_by lists the
+	// packages it installs, which `docker history` shows.
+	History *ImageHistory `json:"history,omitempty" yaml:"history,omitempty"`
+
+	// Optional: Kernel parameters, by name, to write to
+	// /etc/sysctl.d/90-apko.conf
+	Sysctl map[string]string `json:"sysctl,omitempty" yaml:"sysctl,omitempty"`
+
+	// Optional: Resource limits to write to
+	// /etc/security/limits.d/90-apko.conf, for pam_limits
+	Limits []ImageLimit `json:"limits,omitempty" yaml:"limits,omitempty"`
+
+	// Optional: Directories of shared libraries to write to
+	// /etc/ld.so.conf.d/apko.conf, and add to /etc/ld.so.cache
+	LibraryPaths []string `json:"library-paths,omitempty" yaml:"library-paths,omitempty"`
+
+	// Optional: Entries to write to /etc/tmpfiles.d/apko.conf, for
+	// systemd-tmpfiles to create, clean up and remove files at runtime
+	TmpFiles []TmpFile `json:"tmpfiles,omitempty" yaml:"tmpfiles,omitempty"`
+
+	// Optional: Scheduled jobs to write to the crontabs of busybox crond,
+	// /etc/crontabs/<user>
+	Cron []CronJob `json:"cron,omitempty" yaml:"cron,omitempty"`
+
+	// Optional: Processes for the s6 supervisor to run, keyed by name,
+	// which becomes the entrypoint of the image
+	Services map[string]ImageService `json:"services,omitempty" yaml:"services,omitempty"`
+
+	// Optional: Filters of the kernel modules and firmware installed by
+	// packages, for VM and appliance images
+	Kernel *ImageKernel `json:"kernel,omitempty" yaml:"kernel,omitempty"`
+
+	// Optional: The modes of the directories of the image, and a check
+	// that none is world-writable, to enforce security baselines
+	Directories *ImageDirectories `json:"directories,omitempty" yaml:"directories,omitempty"`
+}
+
+// ImageDirectories sets the modes of the directories of the image.
+type ImageDirectories struct {
+	// Optional: The permission bits to clear from the modes of the
+	// directories created outside of packages, such as the base directories
+	// of the image and the parents of paths, e.g. 0o027. Sticky directories,
+	// such as /tmp, keep their modes
+	Umask uint32 `json:"umask,omitempty" yaml:"umask,omitempty"`
+	// Optional: The modes of directories, which override both the umask and
+	// the modes packages install them with
+	Modes []DirectoryMode `json:"modes,omitempty" yaml:"modes,omitempty"`
+	// Optional: Fail the build if any directory of the image, other than
+	// those of allow-world-writable, is world-writable
+	ForbidWorldWritable bool `json:"forbid-world-writable,omitempty" yaml:"forbid-world-writable,omitempty"`
+	// Optional: The absolute paths, or glob patterns, of the directories
+	// which may be world-writable with forbid-world-writable, e.g. /tmp
+	AllowWorldWritable []string `json:"allow-world-writable,omitempty" yaml:"allow-world-writable,omitempty"`
+}
+
+// DirectoryMode is the mode of the directories at a path.
+type DirectoryMode struct {
+	// Required: The absolute path of the directories, or a glob pattern
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Required: The mode of the directories, e.g. 0o1777 for a sticky,
+	// world-writable directory
+	Mode uint32 `json:"mode,omitempty" yaml:"mode,omitempty"`
 }
 
 // Architecture represents a CPU architecture for the container image.
@@ -404,6 +774,72 @@ func ParseArchitectures(in []string) []Architecture {
 	return archs
 }
 
+type SigstorePolicy struct {
+	// Required: The repository whose indexes are signed. Each index is
+	// verified with the Sigstore bundle next to it, at its URL followed by
+	// .sigstore.json. An oci:// repository instead verifies the keyring
+	// artifacts from it, with the bundles attached to them as referrers
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// Optional: The subject alternative name of the signing certificate, such
+	// as an email address or a CI workflow URL. One of identity and
+	// identity_regexp is required
+	Identity string `json:"identity,omitempty" yaml:"identity,omitempty"`
+	// Optional: A regular expression matching the subject alternative name
+	IdentityRegexp string `json:"identity_regexp,omitempty" yaml:"identity_regexp,omitempty"`
+	// Optional: The OIDC issuer of the signing certificate. One of issuer and
+	// issuer_regexp is required
+	Issuer string `json:"issuer,omitempty" yaml:"issuer,omitempty"`
+	// Optional: A regular expression matching the OIDC issuer
+	IssuerRegexp string `json:"issuer_regexp,omitempty" yaml:"issuer_regexp,omitempty"`
+	// Optional: Either "additional" to also verify the key signatures of the
+	// indexes (the default) or "only" to trust the bundle instead. Not
+	// supported for oci:// repositories
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	// Optional: The path of the trusted_root.json of a private Sigstore
+	// deployment. The public Sigstore instance is trusted by default
+	TrustedRoot string `json:"trusted_root,omitempty" yaml:"trusted_root,omitempty"`
+}
+
+type SignaturePolicy struct {
+	// Required: The repository the policy applies to
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// Optional: Whether the indexes of the repository must be signed by a key
+	// of the keyring. Defaults to true
+	RequireSignedIndex *bool `json:"require_signed_index,omitempty" yaml:"require_signed_index,omitempty"`
+	// Optional: Whether each package installed from the repository must be
+	// signed by a key of the keyring
+	RequireSignedPackages bool `json:"require_signed_packages,omitempty" yaml:"require_signed_packages,omitempty"`
+	// Optional: Accept indexes and packages carrying no signature at all.
+	// Invalid signatures are still rejected
+	AllowUnsigned bool `json:"allow_unsigned,omitempty" yaml:"allow_unsigned,omitempty"`
+	// Optional: The names of the keyring keys accepted for the signatures of
+	// the repository, such as "wolfi-signing.rsa.pub". Any key of the keyring
+	// is accepted by default
+	RequiredKeyIDs []string `json:"required_key_ids,omitempty" yaml:"required_key_ids,omitempty"`
+}
+
+const (
+	SigstoreModeAdditional = "additional"
+	SigstoreModeOnly       = "only"
+)
+
+const (
+	KeyringPolicyEnforce = "enforce"
+	KeyringPolicyWarn    = "warn"
+)
+
+const (
+	APKDatabaseFull      = "full"
+	APKDatabaseInstalled = "installed"
+	APKDatabaseNone      = "none"
+)
+
+const (
+	ServiceRestartAlways    = "always"
+	ServiceRestartOnFailure = "on-failure"
+	ServiceRestartNever     = "never"
+)
+
 type SBOM struct {
 	Arch   string
 	Path   string
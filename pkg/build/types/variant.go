@@ -0,0 +1,119 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// variantNameRegex matches the names of variants, which name lockfiles.
+var variantNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// DebugVariantName is the name of the variant built as the debug image of a
+// configuration, see DebugVariant.
+const DebugVariantName = "debug"
+
+// DefaultDebugPackages are the packages debug images add by default.
+var DefaultDebugPackages = []string{"busybox", "strace"}
+
+// DebugVariant returns the variant of the debug image of a configuration
+// which does not define its own debug variant: it adds packages, runs a
+// login shell, and makes /tmp writable by everyone.
+func DebugVariant(packages []string) ImageVariant {
+	return ImageVariant{
+		Packages:   slices.Clone(packages),
+		Entrypoint: &ImageEntrypoint{Command: "/bin/sh"},
+		Cmd:        "-l",
+		Paths: []PathMutation{{
+			Path:        "/tmp",
+			Type:        "permissions",
+			Permissions: 0o1777,
+		}},
+	}
+}
+
+// ApplyVariant applies the named variant to the configuration: its packages
+// are removed and added, its environment variables set, its entrypoint and
+// command replace those of the configuration, and its paths mutations are
+// appended. The variants are then
+// dropped, so that the configuration describes the image built. An empty
+// name only drops the variants.
+func (ic *ImageConfiguration) ApplyVariant(name string) error {
+	variants := ic.Variants
+	ic.Variants = nil
+	for n := range variants {
+		if !variantNameRegex.MatchString(n) {
+			return fmt.Errorf("invalid variant name %q, must start with a letter or digit followed by letters, digits, '.', '_' or '-'", n)
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	v, ok := variants[name]
+	if !ok {
+		names := slices.Sorted(maps.Keys(variants))
+		if len(names) == 0 {
+			return fmt.Errorf("unknown variant %q, the configuration has no variants", name)
+		}
+		return fmt.Errorf("unknown variant %q, must be one of: %s", name, strings.Join(names, ", "))
+	}
+
+	// The packages and environment may be shared with the caller's copy.
+	ic.Contents.Packages = slices.Clone(ic.Contents.Packages)
+	for _, remove := range v.RemovePackages {
+		n := len(ic.Contents.Packages)
+		ic.Contents.Packages = slices.DeleteFunc(ic.Contents.Packages, func(p string) bool {
+			return packageName(p) == remove
+		})
+		if len(ic.Contents.Packages) == n {
+			return fmt.Errorf("variant %q removes package %q, which the configuration does not install", name, remove)
+		}
+	}
+	ic.Contents.Packages = append(ic.Contents.Packages, v.Packages...)
+
+	if len(v.Environment) != 0 {
+		env := maps.Clone(ic.Environment)
+		if env == nil {
+			env = map[string]string{}
+		}
+		maps.Copy(env, v.Environment)
+		ic.Environment = env
+	}
+	if v.Entrypoint != nil {
+		// Services are run by the entrypoint they make, so they are
+		// replaced too.
+		ic.Entrypoint = *v.Entrypoint
+		ic.Services = nil
+	}
+	if v.Cmd != "" {
+		ic.Cmd = v.Cmd
+	}
+	ic.Paths = slices.Concat(ic.Paths, v.Paths)
+	return nil
+}
+
+// packageName returns the name of the package of a package constraint,
+// e.g. foo for foo>=1.2 or foo@local.
+func packageName(constraint string) string {
+	if i := strings.IndexAny(constraint, "=<>~@"); i >= 0 {
+		return constraint[:i]
+	}
+	return constraint
+}
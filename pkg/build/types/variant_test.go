@@ -0,0 +1,141 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestApplyVariant(t *testing.T) {
+	newConfig := func() types.ImageConfiguration {
+		return types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Packages: []string{"python-3.12", "py3.12-pip>=24", "ca-certificates-bundle"},
+			},
+			Entrypoint:  types.ImageEntrypoint{Command: "/usr/bin/python"},
+			Environment: map[string]string{"PYTHONUNBUFFERED": "1", "LOG_LEVEL": "info"},
+			Variants: map[string]types.ImageVariant{
+				"debug": {
+					Packages:    []string{"busybox", "strace"},
+					Environment: map[string]string{"LOG_LEVEL": "debug"},
+					Entrypoint:  &types.ImageEntrypoint{Command: "/bin/sh"},
+					Cmd:         "-l",
+				},
+				"prod": {
+					RemovePackages: []string{"py3.12-pip"},
+				},
+				"broken": {
+					RemovePackages: []string{"busybox"},
+				},
+			},
+		}
+	}
+
+	t.Run("debug", func(t *testing.T) {
+		ic := newConfig()
+		require.NoError(t, ic.ApplyVariant("debug"))
+		require.Equal(t, []string{"python-3.12", "py3.12-pip>=24", "ca-certificates-bundle", "busybox", "strace"}, ic.Contents.Packages)
+		require.Equal(t, map[string]string{"PYTHONUNBUFFERED": "1", "LOG_LEVEL": "debug"}, ic.Environment)
+		require.Equal(t, "/bin/sh", ic.Entrypoint.Command)
+		require.Equal(t, "-l", ic.Cmd)
+		require.Nil(t, ic.Variants)
+	})
+
+	t.Run("entrypoint replaces services", func(t *testing.T) {
+		ic := newConfig()
+		ic.Entrypoint = types.ImageEntrypoint{}
+		ic.Services = map[string]types.ImageService{"app": {Command: "/usr/bin/python app.py"}}
+		require.NoError(t, ic.ApplyVariant("debug"))
+		require.Equal(t, "/bin/sh", ic.Entrypoint.Command)
+		require.Nil(t, ic.Services)
+		require.NoError(t, ic.Validate())
+	})
+
+	t.Run("prod", func(t *testing.T) {
+		ic := newConfig()
+		require.NoError(t, ic.ApplyVariant("prod"))
+		require.Equal(t, []string{"python-3.12", "ca-certificates-bundle"}, ic.Contents.Packages)
+		require.Equal(t, "/usr/bin/python", ic.Entrypoint.Command)
+		require.Equal(t, "info", ic.Environment["LOG_LEVEL"])
+	})
+
+	t.Run("none", func(t *testing.T) {
+		ic := newConfig()
+		require.NoError(t, ic.ApplyVariant(""))
+		require.Equal(t, newConfig().Contents, ic.Contents)
+		require.Nil(t, ic.Variants)
+	})
+
+	t.Run("does not modify shared packages", func(t *testing.T) {
+		ic := newConfig()
+		packages := ic.Contents.Packages
+		require.NoError(t, ic.ApplyVariant("prod"))
+		require.Equal(t, []string{"python-3.12", "py3.12-pip>=24", "ca-certificates-bundle"}, packages)
+	})
+
+	for _, tc := range []struct {
+		name, variant, wantErr string
+		variants               map[string]types.ImageVariant
+	}{{
+		name:    "unknown",
+		variant: "dev",
+		wantErr: `unknown variant "dev", must be one of: broken, debug, prod`,
+	}, {
+		name:     "no variants",
+		variant:  "dev",
+		variants: map[string]types.ImageVariant{},
+		wantErr:  `unknown variant "dev", the configuration has no variants`,
+	}, {
+		name:    "remove missing package",
+		variant: "broken",
+		wantErr: `variant "broken" removes package "busybox", which the configuration does not install`,
+	}, {
+		name:     "invalid name",
+		variants: map[string]types.ImageVariant{"../debug": {}},
+		wantErr:  `invalid variant name "../debug"`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := newConfig()
+			if tc.variants != nil {
+				ic.Variants = tc.variants
+			}
+			require.ErrorContains(t, ic.ApplyVariant(tc.variant), tc.wantErr)
+		})
+	}
+}
+
+func TestDebugVariant(t *testing.T) {
+	ic := types.ImageConfiguration{
+		Contents:   types.ImageContents{Packages: []string{"python-3.12"}},
+		Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/python"},
+		Cmd:        "app.py",
+		Paths:      []types.PathMutation{{Path: "/app", Type: "directory", Permissions: 0o755}},
+		Variants: map[string]types.ImageVariant{
+			types.DebugVariantName: types.DebugVariant(types.DefaultDebugPackages),
+		},
+	}
+	require.NoError(t, ic.ApplyVariant(types.DebugVariantName))
+	require.Equal(t, []string{"python-3.12", "busybox", "strace"}, ic.Contents.Packages)
+	require.Equal(t, "/bin/sh", ic.Entrypoint.Command)
+	require.Equal(t, "-l", ic.Cmd)
+	require.Len(t, ic.Paths, 2)
+	require.Equal(t, "/app", ic.Paths[0].Path)
+	require.Equal(t, "/tmp", ic.Paths[1].Path)
+	require.Equal(t, uint32(0o1777), ic.Paths[1].Permissions)
+}
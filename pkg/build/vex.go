@@ -0,0 +1,125 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/vex"
+)
+
+// WantVEX returns whether OpenVEX documents were given to bind to the image.
+func (bc *Context) WantVEX() bool {
+	return len(bc.o.VEXFiles) != 0
+}
+
+// VEXImage returns the image built for arch as a product VEX statements can
+// be bound to, identified as in its SBOMs.
+func (bc *Context) VEXImage(ctx context.Context, arch types.Architecture, img v1.Image) (vex.Image, error) {
+	s, err := bc.imageSBOMOptions(ctx, arch, img)
+	if err != nil {
+		return vex.Image{}, err
+	}
+	vi := vex.Image{Purl: s.ImagePurl()}
+	for _, pkg := range s.Packages {
+		vi.Packages = append(vi.Packages, s.PackagePurl(&pkg.Package))
+	}
+	return vi, nil
+}
+
+// GenerateIndexVEX binds the statements of the OpenVEX documents given with
+// WithVEX to the index and its images, and writes the result along the SBOMs.
+func GenerateIndexVEX(ctx context.Context, o options.Options, ic types.ImageConfiguration, indexDigest name.Digest, imgs map[types.Architecture]vex.Image) ([]types.SBOM, error) {
+	log := clog.FromContext(ctx)
+	_, span := otel.Tracer("apko").Start(ctx, "GenerateIndexVEX")
+	defer span.End()
+
+	if len(o.VEXFiles) == 0 {
+		return nil, nil
+	}
+
+	docs, err := parseVEXFiles(o.VEXFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSBOM(ctx, nil, o, ic, o.SourceDateEpoch)
+	h, err := v1.NewHash(indexDigest.DigestStr())
+	if err != nil {
+		return nil, errors.New("getting index hash")
+	}
+	s.ImageInfo.IndexDigest = h
+	s.ImageInfo.IndexMediaType = ggcrtypes.OCIImageIndex
+
+	archs := make([]types.Architecture, 0, len(imgs))
+	for arch := range imgs {
+		archs = append(archs, arch)
+	}
+	sort.Slice(archs, func(i, j int) bool {
+		return archs[i].String() < archs[j].String()
+	})
+
+	// The index contains the packages of all of its images.
+	images := []vex.Image{{Purl: s.IndexPurl()}}
+	for _, arch := range archs {
+		for _, pkg := range imgs[arch].Packages {
+			if !slices.Contains(images[0].Packages, pkg) {
+				images[0].Packages = append(images[0].Packages, pkg)
+			}
+		}
+		images = append(images, imgs[arch])
+	}
+
+	doc, err := vex.Bind(docs, images, o.SourceDateEpoch)
+	if err != nil {
+		return nil, fmt.Errorf("binding VEX statements: %w", err)
+	}
+	log.Infof("bound %d VEX statements to the image", len(doc.Statements))
+
+	filename := filepath.Join(s.OutputDir, "vex."+vex.Ext)
+	if err := doc.WriteFile(filename); err != nil {
+		return nil, fmt.Errorf("writing VEX document: %w", err)
+	}
+	return []types.SBOM{{
+		Path:   filename,
+		Format: vex.Format,
+		Digest: h,
+	}}, nil
+}
+
+func parseVEXFiles(paths []string) ([]*vex.Document, error) {
+	docs := make([]*vex.Document, 0, len(paths))
+	for _, path := range paths {
+		doc, err := vex.ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/oci"
+)
+
+// baseWhiteouts returns the whiteouts of the paths of the base image which
+// the layer built on top of it leaves out, e.g. the apk database with
+// apk-database set to none, so that the image has the same files as if it
+// was built without a base image.
+func (bc *Context) baseWhiteouts(ctx context.Context) ([]*tar.Header, error) {
+	exclude := bc.excludedPaths()
+	if bc.baseimg == nil || len(exclude) == 0 {
+		return nil, nil
+	}
+
+	base, err := oci.Files(bc.baseimg.Image())
+	if err != nil {
+		return nil, fmt.Errorf("listing the files of the base image: %w", err)
+	}
+
+	names := whiteouts(base, bc.fs, exclude)
+	headers := make([]*tar.Header, 0, len(names))
+	for _, name := range names {
+		clog.FromContext(ctx).Debugf("whiting out %s of the base image", name)
+		headers = append(headers, &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o600,
+			ModTime:  bc.o.SourceDateEpoch,
+		})
+	}
+	return headers, nil
+}
+
+// whiteouts returns the sorted names of the whiteouts removing the excluded
+// paths from the base filesystem. A directory of fsys whose entries in base
+// are all removed gets an opaque marker instead of a whiteout per entry.
+func whiteouts(base map[string]*tar.Header, fsys fs.StatFS, exclude []string) []string {
+	removed := map[string][]string{}
+	for _, p := range exclude {
+		if _, ok := base[p]; ok {
+			dir := path.Dir(p)
+			removed[dir] = append(removed[dir], p)
+		}
+	}
+
+	var names []string
+	for dir, paths := range removed {
+		if len(paths) > 1 && dir != "." && len(paths) == len(children(base, dir)) {
+			if fi, err := fsys.Stat(dir); err == nil && fi.IsDir() {
+				names = append(names, path.Join(dir, oci.OpaqueWhiteout))
+				continue
+			}
+		}
+		for _, p := range paths {
+			names = append(names, path.Join(dir, oci.WhiteoutPrefix+path.Base(p)))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// children returns the paths of the entries of dir in files.
+func children(files map[string]*tar.Header, dir string) []string {
+	var paths []string
+	for p := range files {
+		if path.Dir(p) == dir {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// tarLayer writes a layer tarball of the entries, directories ending in a
+// slash and whiteouts as they are.
+func tarLayer(t *testing.T, entries ...string) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Typeflag: tar.TypeReg, Name: e, Mode: 0o644}
+		if e[len(e)-1] == '/' {
+			hdr = &tar.Header{Typeflag: tar.TypeDir, Name: e, Mode: 0o755}
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+	}
+	require.NoError(t, tw.Close())
+	return &buf
+}
+
+// imageFiles returns the files of the image of the layer tarballs.
+func imageFiles(t *testing.T, layers ...*bytes.Buffer) map[string]*tar.Header {
+	img := empty.Image
+	for _, buf := range layers {
+		b := buf.Bytes()
+		layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		})
+		require.NoError(t, err)
+		img, err = mutate.AppendLayers(img, layer)
+		require.NoError(t, err)
+	}
+	files, err := oci.Files(img)
+	require.NoError(t, err)
+	return files
+}
+
+func TestWhiteoutsOpaque(t *testing.T) {
+	base := imageFiles(t, tarLayer(t, "opt/", "opt/x/", "opt/x/a", "opt/x/b", "opt/y"))
+	exclude := []string{"opt/x/a", "opt/x/b"}
+
+	// the directory is in the layer: the opaque marker hides all of it
+	m := fs.NewMemFS()
+	require.NoError(t, m.MkdirAll("opt/x", 0o755))
+	require.Equal(t, []string{"opt/x/.wh..wh..opq"}, whiteouts(base, m, exclude))
+
+	// it isn't: each entry is whited out
+	require.Equal(t, []string{"opt/x/.wh.a", "opt/x/.wh.b"}, whiteouts(base, fs.NewMemFS(), exclude))
+
+	// some entries stay
+	require.Equal(t, []string{"opt/x/.wh.a"}, whiteouts(base, m, exclude[:1]))
+}
+
+// TestBaseWhiteouts checks that an image built on a base image has the same
+// files as the image built from scratch, for each way of keeping the apk
+// database.
+func TestBaseWhiteouts(t *testing.T) {
+	ctx := context.Background()
+
+	newFS := func(files ...string) fs.FullFS {
+		m := fs.NewMemFS()
+		for _, f := range files {
+			require.NoError(t, m.MkdirAll(path.Dir(f), 0o755))
+			require.NoError(t, m.WriteFile(f, []byte(f), 0o644))
+		}
+		return m
+	}
+	baseFiles := []string{"bin/sh", "etc/apk/world", "usr/lib/apk/db/installed", "usr/lib/apk/db/scripts.tar", "usr/lib/apk/db/triggers"}
+	topFiles := []string{"usr/bin/hello", "etc/apk/world", "usr/lib/apk/db/installed", "usr/lib/apk/db/scripts.tar"}
+
+	// the base image was built with the full apk database
+	var base bytes.Buffer
+	require.NoError(t, writeTar(ctx, tar.NewWriter(&base), newFS(baseFiles...)))
+
+	for _, apkDatabase := range []string{types.APKDatabaseFull, types.APKDatabaseInstalled, types.APKDatabaseNone} {
+		t.Run(apkDatabase, func(t *testing.T) {
+			bc := &Context{ic: types.ImageConfiguration{APKDatabase: apkDatabase}}
+			exclude := bc.excludedPaths()
+
+			// from scratch
+			var full bytes.Buffer
+			require.NoError(t, writeTar(ctx, tar.NewWriter(&full), newFS(append(baseFiles, topFiles...)...), exclude...))
+			want := imageFiles(t, &full)
+
+			// on top of the base image
+			files := imageFiles(t, &base)
+			top := newFS(topFiles...)
+			var layer bytes.Buffer
+			tw := tar.NewWriter(&layer)
+			for _, name := range whiteouts(files, top, exclude) {
+				require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name}))
+			}
+			require.NoError(t, writeTar(ctx, tw, top, exclude...))
+			files = imageFiles(t, &base, &layer)
+
+			require.Equal(t, slices.Sorted(maps.Keys(want)), slices.Sorted(maps.Keys(files)))
+		})
+	}
+}
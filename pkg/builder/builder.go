@@ -0,0 +1,369 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package builder is a small API to resolve, build, publish and lock images
+// with apko, for programs embedding it. Unlike the packages it is built on,
+// it is kept stable across releases: fields and functions are only added.
+package builder
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Options are the inputs shared by every operation.
+type Options struct {
+	// ConfigFile is the path of the image configuration.
+	ConfigFile string
+	// Config is the image configuration, used as is instead of ConfigFile
+	// when set.
+	Config *types.ImageConfiguration
+	// IncludePaths are where to look for the files the configuration
+	// refers to, besides the working directory.
+	IncludePaths []string
+	// BuildArgs are the values of the build arguments of the configuration.
+	BuildArgs map[string]string
+
+	// Archs are the architectures, by default those of the configuration,
+	// or all of them.
+	Archs []types.Architecture
+
+	// ExtraKeys, ExtraRepositories and ExtraPackages are added to the
+	// keyring, runtime repositories and packages of the configuration.
+	ExtraKeys         []string
+	ExtraRepositories []string
+	ExtraPackages     []string
+
+	// CacheDir is where packages and indexes are cached, by default the
+	// system cache directory.
+	CacheDir string
+	// Offline is whether to only use the cache.
+	Offline bool
+	// Cache is shared by the operations given the same Cache, so that they
+	// fetch each index once. Nil means each operation has its own.
+	Cache *apk.Cache
+
+	// Lockfile constrains the packages to the versions it lists, and
+	// Locked requires every package, index and key to be described by it.
+	Lockfile string
+	Locked   bool
+
+	// BuildDate is the timestamp of the image, by default the newest build
+	// date of its packages.
+	BuildDate time.Time
+	// SBOMFormats are the formats of the SBOMs, by default those of the
+	// configuration; NoSBOM disables them.
+	SBOMFormats []string
+	NoSBOM      bool
+
+	// VCS annotates the image with the source, revision and version of the
+	// Git repository at VCSPath, or else containing ConfigFile within the
+	// working directory. The version is that of the tags of the commit
+	// starting with VCSTagPrefix.
+	VCS          bool
+	VCSPath      string
+	VCSTagPrefix string
+
+	// Progress receives the progress of installing packages, if set.
+	Progress apk.Reporter
+}
+
+// Package is a package resolved for an architecture.
+type Package struct {
+	Name     string
+	Version  string
+	Arch     string
+	URL      string
+	Checksum string
+}
+
+// BuildResult is the outcome of Build.
+type BuildResult struct {
+	// Digest is the digest of the image index.
+	Digest v1.Hash
+	// SBOMs are the paths of the SBOMs, and of the VEX documents and
+	// attestations, written along the image.
+	SBOMs []string
+}
+
+// BuildOptions are the inputs of Build.
+type BuildOptions struct {
+	// Tags are the tags of the image; at least one is required.
+	Tags []string
+	// Output is the path of the image tarball, which "docker load"
+	// accepts, of an existing directory to write an OCI layout to, or
+	// "-" to write the tarball to the standard output.
+	Output string
+	// SBOMDir is where the SBOMs are written, by default next to Output.
+	SBOMDir string
+}
+
+// PublishOptions are the inputs of Publish.
+type PublishOptions struct {
+	// Tags are the tags to publish the image to; at least one is required.
+	Tags []string
+	// Local loads the image into the local Docker daemon instead.
+	Local bool
+	// AttachSBOMs attaches the SBOMs to the index and images as OCI
+	// referrers.
+	AttachSBOMs bool
+	// SBOMDir is where the SBOMs are also written, if set.
+	SBOMDir string
+	// Remote are the options of the requests to the registry, e.g. its
+	// authentication.
+	Remote []remote.Option
+}
+
+// PushOptions are the inputs of Push.
+type PushOptions struct {
+	// Repository is the repository to publish the image to.
+	Repository string
+	// AttachSBOMs attaches the SBOMs to the index and images as OCI
+	// referrers.
+	AttachSBOMs bool
+	// SBOMDir is where the SBOMs are also written, if set.
+	SBOMDir string
+	// Remote are the options of the requests to the registry, e.g. its
+	// authentication.
+	Remote []remote.Option
+}
+
+// LockOptions are the inputs of Lock.
+type LockOptions struct {
+	// Output is the path of the lockfile.
+	Output string
+	// Update are the packages to update in an existing lockfile, keeping
+	// the others at the version they are locked to where possible. All
+	// the packages are resolved again when it is empty.
+	Update []string
+}
+
+// buildOptions translates the options to those of package build. The
+// configuration comes first, as later options apply on top of it.
+func (o Options) buildOptions(tmp string) ([]build.Option, error) {
+	var opts []build.Option
+	switch {
+	case o.Config != nil:
+		opts = append(opts, build.WithImageConfiguration(*o.Config))
+	case o.ConfigFile != "":
+		opts = append(opts, build.WithConfig(o.ConfigFile, o.IncludePaths))
+	default:
+		return nil, errors.New("either Config or ConfigFile is required")
+	}
+
+	opts = append(opts,
+		build.WithIncludePaths(o.IncludePaths),
+		build.WithBuildArgs(o.BuildArgs),
+		build.WithExtraKeys(o.ExtraKeys),
+		build.WithExtraRuntimeRepos(o.ExtraRepositories),
+		build.WithExtraPackages(o.ExtraPackages),
+		build.WithCache(o.CacheDir, o.Offline, cmp.Or(o.Cache, apk.NewCache(true))),
+		build.WithLockFile(o.Lockfile),
+		build.WithLocked(o.Locked, false),
+		build.WithTempDir(tmp),
+		build.WithProgressReporter(o.Progress),
+		build.WithVCS(o.VCS),
+		build.WithVCSPath(o.VCSPath),
+		build.WithVCSTagPrefix(o.VCSTagPrefix),
+	)
+	if !o.BuildDate.IsZero() {
+		opts = append(opts, build.WithSourceDateEpoch(o.BuildDate))
+	}
+	switch {
+	case o.NoSBOM:
+		opts = append(opts, build.WithSBOMFormats([]string{}))
+	case o.SBOMFormats != nil:
+		opts = append(opts, build.WithSBOMFormats(o.SBOMFormats))
+	default:
+		opts = append(opts, build.WithConfigSBOMFormats())
+	}
+	return opts, nil
+}
+
+// withOptions calls f with the options of package build, and a temporary
+// directory for the build, deleted afterwards.
+func withOptions(o Options, f func([]build.Option) error) error {
+	tmp, err := os.MkdirTemp("", "apko-temp-*")
+	if err != nil {
+		return fmt.Errorf("creating tempdir: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	opts, err := o.buildOptions(tmp)
+	if err != nil {
+		return err
+	}
+	return f(opts)
+}
+
+// Resolve returns the packages which would be installed in the image, for
+// each architecture, sorted by name.
+func Resolve(ctx context.Context, o Options) (map[types.Architecture][]Package, error) {
+	var resolved map[types.Architecture][]Package
+	err := withOptions(o, func(opts []build.Option) error {
+		bo, ic, err := build.NewOptions(opts...)
+		if err != nil {
+			return err
+		}
+		archs := o.Archs
+		switch {
+		case len(archs) != 0:
+		case len(ic.Archs) != 0:
+			archs = ic.Archs
+		default:
+			archs = build.DefaultArchs(bo, ic)
+		}
+
+		mc, err := build.NewMultiArch(ctx, archs, append(opts, build.WithImageConfiguration(*ic))...)
+		if err != nil {
+			return err
+		}
+		lists, err := mc.BuildPackageLists(ctx)
+		if err != nil {
+			return err
+		}
+
+		resolved = make(map[types.Architecture][]Package, len(lists))
+		for arch, pkgs := range lists {
+			out := make([]Package, 0, len(pkgs))
+			for _, p := range pkgs {
+				out = append(out, Package{
+					Name:     p.Name,
+					Version:  p.Version,
+					Arch:     p.Arch,
+					URL:      p.URL(),
+					Checksum: p.ChecksumString(),
+				})
+			}
+			slices.SortFunc(out, func(a, b Package) int { return strings.Compare(a.Name, b.Name) })
+			resolved[arch] = out
+		}
+		return nil
+	})
+	return resolved, err
+}
+
+// Build builds the image, and writes it and its SBOMs.
+func Build(ctx context.Context, o Options, bo BuildOptions) (*BuildResult, error) {
+	if len(bo.Tags) == 0 {
+		return nil, errors.New("at least one tag is required")
+	}
+	if bo.Output == "" {
+		return nil, errors.New("an output path is required")
+	}
+	sbomDir := cmp.Or(bo.SBOMDir, filepath.Dir(bo.Output))
+
+	var res BuildResult
+	err := withOptions(o, func(opts []build.Option) error {
+		opts = append(opts, build.WithTags(bo.Tags...))
+		var err error
+		res.Digest, res.SBOMs, err = BuildImage(ctx, bo.Tags[0], bo.Output, o.Archs, bo.Tags, sbomDir, opts...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Publish builds the image and publishes it to the registry, returning the
+// digest of the published index, or the reference of the image loaded into
+// the local Docker daemon.
+func Publish(ctx context.Context, o Options, po PublishOptions) (name.Reference, error) {
+	if len(po.Tags) == 0 {
+		return nil, errors.New("at least one tag is required")
+	}
+
+	var ref name.Reference
+	err := withOptions(o, func(opts []build.Option) error {
+		opts = append(opts, build.WithTags(po.Tags...))
+		var err error
+		ref, err = PublishImage(ctx, "", o.Archs, po.Remote, po.SBOMDir, opts, []PublishOption{
+			WithTags(po.Tags...),
+			WithLocal(po.Local),
+			WithAttachSBOMs(po.AttachSBOMs),
+		})
+		return err
+	})
+	return ref, err
+}
+
+// Push builds the image and publishes it to the repository by digest only,
+// without tagging it, returning the digest of the published index. Tag
+// applies tags to it later.
+func Push(ctx context.Context, o Options, po PushOptions) (name.Digest, error) {
+	if po.Repository == "" {
+		return name.Digest{}, errors.New("a repository is required")
+	}
+	if _, err := name.NewRepository(po.Repository); err != nil {
+		return name.Digest{}, fmt.Errorf("parsing %q as repository: %w", po.Repository, err)
+	}
+
+	var ref name.Reference
+	err := withOptions(o, func(opts []build.Option) error {
+		opts = append(opts, build.WithTags(po.Repository))
+		var err error
+		ref, err = PublishImage(ctx, "", o.Archs, po.Remote, po.SBOMDir, opts, []PublishOption{
+			WithTags(po.Repository),
+			WithDigestOnly(true),
+			WithAttachSBOMs(po.AttachSBOMs),
+		})
+		return err
+	})
+	if err != nil {
+		return name.Digest{}, err
+	}
+	d, ok := ref.(name.Digest)
+	if !ok {
+		return name.Digest{}, fmt.Errorf("published %s, want a digest reference", ref)
+	}
+	return d, nil
+}
+
+// Tag tags the image or index published at digest, e.g. by Push, with each
+// of tags. Tags already pointing to digest are left alone; a tag the
+// registry refuses to move fails with an error wrapping oci.ErrImmutableTag.
+func Tag(ctx context.Context, digest name.Digest, tags []string, ropt ...remote.Option) error {
+	if len(tags) == 0 {
+		return errors.New("at least one tag is required")
+	}
+	return oci.Tag(ctx, digest, tags, ropt...)
+}
+
+// Lock resolves the packages and writes them, with the indexes and keys,
+// to a lockfile.
+func Lock(ctx context.Context, o Options, lo LockOptions) error {
+	if lo.Output == "" {
+		return errors.New("an output path is required")
+	}
+	return withOptions(o, func(opts []build.Option) error {
+		return LockImage(ctx, lo.Output, o.Archs, lo.Update, opts)
+	})
+}
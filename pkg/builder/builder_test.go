@@ -0,0 +1,182 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/builder"
+	pkglock "chainguard.dev/apko/pkg/lock"
+)
+
+func testOptions(t *testing.T) builder.Options {
+	t.Helper()
+	testdata, err := filepath.Abs(filepath.Join("..", "..", "internal", "cli", "testdata"))
+	require.NoError(t, err)
+	return builder.Options{
+		Config: &types.ImageConfiguration{
+			Contents: types.ImageContents{
+				Keyring:             []string{filepath.Join(testdata, "melange.rsa.pub")},
+				RuntimeRepositories: []string{filepath.Join(testdata, "packages")},
+				Packages:            []string{"replayout"},
+			},
+		},
+		Archs:    []types.Architecture{types.ParseArchitecture("amd64")},
+		CacheDir: t.TempDir(),
+		Cache:    apk.NewCache(true),
+	}
+}
+
+func TestResolve(t *testing.T) {
+	resolved, err := builder.Resolve(context.Background(), testOptions(t))
+	require.NoError(t, err)
+	pkgs := resolved[types.ParseArchitecture("amd64")]
+	require.Len(t, resolved, 1)
+	require.NotEmpty(t, pkgs)
+	var names []string
+	for _, p := range pkgs {
+		require.NotEmpty(t, p.Version)
+		require.NotEmpty(t, p.Checksum)
+		require.Equal(t, "x86_64", p.Arch)
+		names = append(names, p.Name)
+	}
+	require.Contains(t, names, "replayout")
+	require.IsNonDecreasing(t, names)
+
+	_, err = builder.Resolve(context.Background(), builder.Options{})
+	require.ErrorContains(t, err, "either Config or ConfigFile is required")
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	o := testOptions(t)
+	o.SBOMFormats = []string{"spdx"}
+	res, err := builder.Build(context.Background(), o, builder.BuildOptions{
+		Tags:   []string{"example.com/builder:latest"},
+		Output: filepath.Join(dir, "image.tar"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "sha256", res.Digest.Algorithm)
+	_, err = os.Stat(filepath.Join(dir, "image.tar"))
+	require.NoError(t, err)
+	require.NotEmpty(t, res.SBOMs)
+	for _, path := range res.SBOMs {
+		require.Equal(t, dir, filepath.Dir(path))
+		_, err := os.Stat(path)
+		require.NoError(t, err)
+	}
+
+	_, err = builder.Build(context.Background(), o, builder.BuildOptions{Output: filepath.Join(dir, "untagged.tar")})
+	require.ErrorContains(t, err, "at least one tag is required")
+}
+
+func TestLock(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "apko.lock.json")
+	require.NoError(t, builder.Lock(context.Background(), testOptions(t), builder.LockOptions{Output: output}))
+
+	l, err := pkglock.FromFile(output)
+	require.NoError(t, err)
+	var names []string
+	for _, p := range l.Contents.Packages {
+		names = append(names, p.Name)
+	}
+	require.Contains(t, names, "replayout")
+}
+
+func TestPushAndTag(t *testing.T) {
+	ctx := context.Background()
+
+	// The registry refuses to move the tag named immutable once locked, and
+	// the tag named denied to the user.
+	reg := registry.New()
+	var manifestPuts atomic.Int32
+	var locked atomic.Bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/") {
+			manifestPuts.Add(1)
+			if locked.Load() && strings.HasSuffix(r.URL.Path, "/manifests/immutable") {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":[{"code":"TAG_INVALID","message":"tag is immutable"}]}`))
+				return
+			}
+			if locked.Load() && strings.HasSuffix(r.URL.Path, "/manifests/denied") {
+				w.WriteHeader(http.StatusForbidden)
+				_, _ = w.Write([]byte(`{"errors":[{"code":"DENIED","message":"requested access to the resource is denied"}]}`))
+				return
+			}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	repo := u.Host + "/test/push"
+
+	digest, err := builder.Push(ctx, testOptions(t), builder.PushOptions{Repository: repo})
+	require.NoError(t, err)
+	require.Equal(t, repo, digest.Context().Name())
+
+	r, err := name.NewRepository(repo)
+	require.NoError(t, err)
+	tags, err := remote.List(r)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	promoted := u.Host + "/test/promoted:prod"
+	require.NoError(t, builder.Tag(ctx, digest, []string{repo + ":v1", repo + ":prod", promoted}))
+	for _, tag := range []string{repo + ":v1", repo + ":prod", promoted} {
+		ref, err := name.ParseReference(tag)
+		require.NoError(t, err)
+		desc, err := remote.Head(ref)
+		require.NoError(t, err)
+		require.Equal(t, digest.DigestStr(), desc.Digest.String())
+	}
+
+	// Tagging again changes nothing.
+	puts := manifestPuts.Load()
+	require.NoError(t, builder.Tag(ctx, digest, []string{repo + ":v1", repo + ":prod"}))
+	require.Equal(t, puts, manifestPuts.Load())
+
+	// A tag of another image, which the registry refuses to move.
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(r.Tag("immutable"), img))
+	require.NoError(t, remote.Write(r.Tag("denied"), img))
+	locked.Store(true)
+	err = builder.Tag(ctx, digest, []string{repo + ":immutable"})
+	require.ErrorIs(t, err, oci.ErrImmutableTag)
+
+	// Being denied is not an immutable tag.
+	err = builder.Tag(ctx, digest, []string{repo + ":denied"})
+	require.Error(t, err)
+	require.NotErrorIs(t, err, oci.ErrImmutableTag)
+}
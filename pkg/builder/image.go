@@ -0,0 +1,362 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sys/unix"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/tarfs"
+	"chainguard.dev/apko/pkg/vex"
+)
+
+// BuildImage builds the image for archs, by default those of the
+// configuration, and writes it to output: a tarball, which "docker load"
+// accepts, an existing directory to write an OCI layout to, or "-" for the
+// standard output. It returns the digest of the image index and the paths of
+// the SBOMs (and other documents) written to sbomPath, or to the standard
+// output with "-". It is what apko build runs, and takes the options of
+// package build, so unlike Build it follows the changes of that package.
+func BuildImage(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, sbomPath string, opts ...build.Option) (v1.Hash, []string, error) {
+	log := clog.FromContext(ctx)
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return v1.Hash{}, nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	// build all of the components in the working directory
+	idx, sboms, err := BuildComponents(ctx, wd, archs, opts...)
+	if err != nil {
+		return v1.Hash{}, nil, err
+	}
+	digest, err := idx.Digest()
+	if err != nil {
+		return v1.Hash{}, nil, err
+	}
+
+	if output == stdoutPath && sbomPath == stdoutPath {
+		return v1.Hash{}, nil, fmt.Errorf("cannot write both the image and the SBOMs to stdout")
+	}
+
+	if output == stdoutPath {
+		// the tarball is appended to once written, so write it aside first
+		tarball := filepath.Join(wd, "image.tar")
+		if _, err := oci.BuildIndex(tarball, idx, append([]string{imageRef}, tags...)); err != nil {
+			return v1.Hash{}, nil, fmt.Errorf("bundling image: %w", err)
+		}
+		if err := copyToStdout(tarball); err != nil {
+			return v1.Hash{}, nil, err
+		}
+	} else if fi, err := os.Stat(output); err == nil && fi.IsDir() {
+		// bundle the parts of the image into a tarball
+		if _, err := layout.Write(output, idx); err != nil {
+			return v1.Hash{}, nil, fmt.Errorf("writing image layout: %w", err)
+		}
+		log.Debugf("Final image layout at: %s", output)
+	} else {
+		// bundle the parts of the image into a tarball
+		if _, err := oci.BuildIndex(output, idx, append([]string{imageRef}, tags...)); err != nil {
+			return v1.Hash{}, nil, fmt.Errorf("bundling image: %w", err)
+		}
+		log.Debugf("Final index tgz at: %s", output)
+	}
+
+	// write the sboms one after the other to stdout, if asked to
+	if sbomPath == stdoutPath {
+		for _, sbom := range sboms {
+			if err := copyToStdout(sbom.Path); err != nil {
+				return v1.Hash{}, nil, err
+			}
+		}
+		return digest, nil, nil
+	}
+
+	// copy sboms over to the sbomPath target directory
+	paths := make([]string, 0, len(sboms))
+	for _, sbom := range sboms {
+		// because os.Rename fails across partitions, we do our own
+		path := filepath.Join(sbomPath, filepath.Base(sbom.Path))
+		if err := rename(sbom.Path, path); err != nil {
+			return v1.Hash{}, nil, fmt.Errorf("moving sbom: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	return digest, paths, nil
+}
+
+// BuildComponents builds all of the components of an image in a single
+// working directory. Each layer is a separate file, as are config,
+// manifests, index and sbom.
+func BuildComponents(ctx context.Context, workDir string, archs []types.Architecture, opts ...build.Option) (idx v1.ImageIndex, sboms []types.SBOM, err error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "buildImageComponents")
+	defer span.End()
+
+	o, ic, err := build.NewOptions(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
+		return nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
+	}
+
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use the archs
+	//   the local repositories have packages for, or else all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = build.DefaultArchs(o, ic)
+	}
+	// save the final set we will build
+	log.Debugf("Building images for %d architectures: %+v", len(ic.Archs), ic.Archs)
+
+	// Probe the VCS URL if it is not set and we are asked to do so.
+	if o.WithVCS && ic.VCSUrl == "" {
+		build.ProbeVCS(ctx, o, ic)
+	}
+	// The configurations of the architectures carry what was probed, and
+	// are locked, so keep the digest of the configuration as given.
+	opts = append(opts, build.WithVCS(false), build.WithConfigDigest(o.ConfigDigest))
+
+	// The build context options is sometimes copied in the next functions. Ensure
+	// we have the directory defined and created by invoking the function early.
+
+	// workDir, passed to us, is where we will lay out the various image filesystems
+	// under it we will have:
+	//  <arch>/ - the rootfs for each architecture
+	//  image/ - the summary layer files and sboms for each architecture
+	// imageDir, created here, is where the final artifacts will be: layer tars, indexes, etc.
+
+	log.Debugf("building tags %v", o.Tags)
+
+	var errg errgroup.Group
+	imageDir := filepath.Join(workDir, "image")
+	if err := os.MkdirAll(imageDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
+	}
+	opts = append(opts, build.WithSBOM(imageDir))
+
+	imgs := map[types.Architecture]v1.Image{}
+	vexImages := map[types.Architecture]vex.Image{}
+
+	mtx := sync.Mutex{}
+
+	// We compute the "build date epoch" of the multi-arch image to be the
+	// maximum "build date epoch" of the per-arch images.  If the user has
+	// explicitly set SOURCE_DATE_EPOCH, that will always trump this
+	// computation.
+	multiArchBDE := o.SourceDateEpoch
+
+	configs, _, err := build.LockImageConfiguration(ctx, *ic, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("locking config: %w", err)
+	}
+
+	for arch, ic := range configs {
+		errg.Go(func() error {
+			if arch == "index" {
+				return nil
+			}
+
+			arch := types.ParseArchitecture(arch)
+			log := log.With("arch", arch.ToAPK())
+			ctx := clog.WithLogger(ctx, log)
+
+			opts := slices.Clone(opts)
+			opts = append(opts, build.WithArch(arch), build.WithImageConfiguration(*ic))
+
+			bc, err := build.New(ctx, tarfs.New(), opts...)
+			if err != nil {
+				return fmt.Errorf("new build for arch %s: %w", arch, err)
+			}
+			layers, err := bc.BuildLayers(ctx)
+			if err != nil {
+				return fmt.Errorf("building %q layer: %w", arch, err)
+			}
+
+			// Compute the "build date epoch" from the packages that were
+			// installed.  The "build date epoch" is the MAX of the builddate
+			// embedded in the installed APKs.  If SOURCE_DATE_EPOCH is
+			// explicitly set by the user, that trumps this.
+			// This computation will only affect the timestamp of the image
+			// itself and its SBOMs, since the timestamps on files come from the
+			// APKs.
+			bde, err := bc.GetBuildDateEpoch()
+			if err != nil {
+				return fmt.Errorf("failed to determine build date epoch: %w", err)
+			}
+
+			img, err := oci.BuildImageFromLayers(ctx, bc.BaseImage(), layers, bc.ImageConfiguration(), bde, bc.Arch())
+			if err != nil {
+				return fmt.Errorf("failed to build OCI image for %q: %w", arch, err)
+			}
+
+			var outputs []types.SBOM
+			if len(o.SBOMFormats) != 0 {
+				outputs, err = bc.GenerateImageSBOM(ctx, arch, img)
+				if err != nil {
+					return fmt.Errorf("generating sbom for %s: %w", arch, err)
+				}
+			}
+
+			if bc.WantScan() {
+				if err := bc.Scan(ctx, arch, img, outputs); err != nil {
+					return err
+				}
+			}
+
+			var vexImage vex.Image
+			if bc.WantVEX() {
+				vexImage, err = bc.VEXImage(ctx, arch, img)
+				if err != nil {
+					return fmt.Errorf("describing %s for VEX: %w", arch, err)
+				}
+			}
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			imgs[arch] = img
+			vexImages[arch] = vexImage
+
+			if bde.After(multiArchBDE) {
+				multiArchBDE = bde
+			}
+
+			if len(o.SBOMFormats) != 0 {
+				sboms = append(sboms, outputs...)
+			}
+
+			return nil
+		})
+	}
+	if err := errg.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	// generate the index
+	finalDigest, idx, err := oci.GenerateIndex(ctx, *ic, imgs, multiArchBDE)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
+	}
+
+	opts = append(opts,
+		build.WithImageConfiguration(*ic),       // We mutate Archs above.
+		build.WithSourceDateEpoch(multiArchBDE), // Maximum child's time.
+	)
+
+	o, ic, err = build.NewOptions(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := build.WriteIndex(ctx, o, idx); err != nil {
+		return nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
+	}
+
+	// the sboms are saved to the same working directory as the image components
+	if len(o.SBOMFormats) != 0 {
+		files, err := build.GenerateIndexSBOM(ctx, *o, *ic, finalDigest, imgs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating index SBOM: %w", err)
+		}
+		sboms = append(sboms, files...)
+	}
+
+	if len(o.VEXFiles) != 0 {
+		files, err := build.GenerateIndexVEX(ctx, *o, *ic, finalDigest, vexImages)
+		if err != nil {
+			return nil, nil, fmt.Errorf("generating VEX document: %w", err)
+		}
+		sboms = append(sboms, files...)
+	}
+
+	// sign the documents, so they can be carried with the image and published later
+	attestations, err := build.AttestSBOMs(ctx, *o, sboms)
+	if err != nil {
+		return nil, nil, fmt.Errorf("attesting SBOMs: %w", err)
+	}
+	sboms = append(sboms, attestations...)
+
+	return idx, sboms, nil
+}
+
+// rename just like os.Rename, but does a copy and delete if the rename fails
+func rename(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	// we can handle cross-device rename errors
+	if !errors.Is(err, unix.EXDEV) {
+		return err
+	}
+	f1, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f1.Close()
+	f2, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer f2.Close()
+	_, err = io.Copy(f2, f1)
+	if err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// stdoutPath is the output path meaning the standard output.
+const stdoutPath = "-"
+
+// copyToStdout copies the file at path to the standard output.
+func copyToStdout(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		return fmt.Errorf("writing %s to stdout: %w", path, err)
+	}
+	return nil
+}
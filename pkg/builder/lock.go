@@ -0,0 +1,400 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	pkglock "chainguard.dev/apko/pkg/lock"
+)
+
+// LockImage resolves the packages for archs and writes them to the lockfile
+// at output. If archs are given, the other architectures of an existing
+// lockfile are kept. If update is given, only those packages of the existing
+// lockfile are updated where possible. It is what apko lock runs, and takes
+// the options of package build, so unlike Lock it follows the changes of that
+// package.
+func LockImage(ctx context.Context, output string, archs []types.Architecture, update []string, opts []build.Option) error {
+	log := clog.FromContext(ctx)
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	o, ic, err := build.NewOptions(opts...)
+
+	if err != nil {
+		return err
+	}
+
+	// The existing lockfile is only needed to keep some of it.
+	var previous *pkglock.Lock
+	keepArchs := len(archs) != 0
+	if keepArchs || len(update) != 0 {
+		l, err := pkglock.FromFile(output)
+		switch {
+		case err == nil:
+			previous = &l
+		case errors.Is(err, fs.ErrNotExist) && len(update) == 0:
+			keepArchs = false
+		default:
+			return fmt.Errorf("reading existing lockfile: %w", err)
+		}
+	}
+	if keepArchs && previous.Config != nil && previous.Config.DeepChecksum != o.ImageConfigChecksum {
+		return fmt.Errorf("the configuration changed since %s was generated, so all architectures must be locked", output)
+	}
+	// cases:
+	// - archs set: use those archs
+	// - archs not set, bc.ImageConfiguration.Archs set: use Config archs
+	// - archs not set, bc.ImageConfiguration.Archs not set: use all archs
+	switch {
+	case len(archs) != 0:
+		ic.Archs = archs
+	case len(ic.Archs) != 0:
+		// do nothing
+	default:
+		ic.Archs = types.AllArchs
+	}
+	// save the final set we will build
+	archs = ic.Archs
+	log.Infof("Determining packages for %d architectures: %+v", len(ic.Archs), ic.Archs)
+
+	// The build context options is sometimes copied in the next functions. Ensure
+	// we have the directory defined and created by invoking the function early.
+	defer os.RemoveAll(o.TempDir())
+
+	lock := pkglock.Lock{
+		Version: pkglock.Version,
+		Config: &pkglock.Config{
+			Name:         o.ImageConfigFile,
+			DeepChecksum: o.ImageConfigChecksum,
+			Digest:       o.ConfigDigest,
+		},
+		Contents: pkglock.LockContents{
+			Packages:            make([]pkglock.LockPkg, 0, len(ic.Contents.Packages)),
+			BuildRepositories:   make([]pkglock.LockRepo, 0, len(ic.Contents.BuildRepositories)),
+			RuntimeRepositories: make([]pkglock.LockRepo, 0, len(ic.Contents.RuntimeRepositories)),
+			Keyrings:            make([]pkglock.LockKeyring, 0, len(ic.Contents.Keyring)),
+		},
+	}
+
+	for _, keyring := range ic.Contents.Keyring {
+		lock.Contents.Keyrings = append(lock.Contents.Keyrings, pkglock.LockKeyring{
+			Name: stripURLScheme(keyring),
+			URL:  keyring,
+		})
+	}
+
+	// Keep the architectures which are not being locked, in the order they
+	// were in.
+	lockArchs := slices.Clone(archs)
+	if keepArchs {
+		lockArchs = nil
+		for _, p := range previous.Contents.Packages {
+			if arch := types.ParseArchitecture(p.Architecture); !slices.Contains(lockArchs, arch) {
+				lockArchs = append(lockArchs, arch)
+			}
+		}
+		for _, arch := range archs {
+			if !slices.Contains(lockArchs, arch) {
+				lockArchs = append(lockArchs, arch)
+			}
+		}
+	}
+
+	keyringLocked := false
+	// TODO: If the archs can't agree on package versions (e.g., arm builds are ahead of x86) then we should fail instead of producing inconsistent locks.
+	for _, arch := range lockArchs {
+		arch := arch
+
+		if !slices.Contains(archs, arch) {
+			keepLockedArch(&lock, previous, arch)
+			continue
+		}
+
+		log := log.With("arch", arch.ToAPK())
+		ctx := clog.WithLogger(ctx, log)
+
+		// working directory for this architecture
+		wd := filepath.Join(wd, arch.ToAPK())
+		bc, resolvedPkgs, err := resolveLockArch(ctx, wd, arch, opts, previous, update)
+		if err != nil {
+			return fmt.Errorf("failed to get package list for image: %w", err)
+		}
+		if !keyringLocked {
+			if err := lockKeyring(&lock, bc); err != nil {
+				return fmt.Errorf("failed to lock keyring: %w", err)
+			}
+			keyringLocked = true
+		}
+		indexes, err := bc.RepositoryIndexes(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get repository indexes: %w", err)
+		}
+		indexChecksums := make(map[string]string, len(indexes))
+		for _, idx := range indexes {
+			if sum := apk.IndexChecksum(idx); sum != nil {
+				indexChecksums[idx.Source()] = pkglock.SHA256Checksum(sum)
+			}
+		}
+		indexVerifications := bc.IndexSignatureVerifications()
+		verification := func(url string) *apk.Verification {
+			if v, ok := indexVerifications[url]; ok {
+				return &v
+			}
+			return nil
+		}
+
+		for _, rpkg := range resolvedPkgs {
+			lockPkg := pkglock.LockPkg{
+				Name:         rpkg.Package.Name,
+				URL:          rpkg.Package.URL(),
+				Architecture: rpkg.Package.Arch,
+				Version:      rpkg.Package.Version,
+				Control: pkglock.LockPkgRangeAndChecksum{
+					Range:    fmt.Sprintf("bytes=%d-%d", rpkg.SignatureSize, rpkg.SignatureSize+rpkg.ControlSize-1),
+					Checksum: "sha1-" + base64.StdEncoding.EncodeToString(rpkg.ControlHash),
+				},
+				Data: pkglock.LockPkgRangeAndChecksum{
+					Range:    fmt.Sprintf("bytes=%d-%d", rpkg.SignatureSize+rpkg.ControlSize, rpkg.SignatureSize+rpkg.ControlSize+rpkg.DataSize-1),
+					Checksum: "sha256-" + base64.StdEncoding.EncodeToString(rpkg.DataHash),
+				},
+				Checksum: rpkg.Package.ChecksumString(),
+			}
+
+			if rpkg.SignatureSize != 0 {
+				lockPkg.Signature = pkglock.LockPkgRangeAndChecksum{
+					Range:    fmt.Sprintf("bytes=0-%d", rpkg.SignatureSize-1),
+					Checksum: "sha1-" + base64.StdEncoding.EncodeToString(rpkg.SignatureHash),
+				}
+			}
+
+			lock.Contents.Packages = append(lock.Contents.Packages, lockPkg)
+		}
+		for _, repositoryURI := range ic.Contents.BuildRepositories {
+			repo := apk.Repository{URI: fmt.Sprintf("%s/%s", repositoryURI, arch.ToAPK())}
+			name, err := RemoveLabel(stripURLScheme(repo.URI))
+			if err != nil {
+				return fmt.Errorf("failed to remove label from repository URI: %w", err)
+			}
+			url, err := RemoveLabel(repo.IndexURI())
+			if err != nil {
+				return fmt.Errorf("failed to remove label from repository index URI: %w", err)
+			}
+			lock.Contents.BuildRepositories = append(lock.Contents.BuildRepositories, pkglock.LockRepo{
+				Name:         name,
+				URL:          url,
+				Architecture: arch.ToAPK(),
+				Checksum:     indexChecksums[url],
+				Verification: verification(url),
+			})
+		}
+		for _, repositoryURI := range ic.Contents.RuntimeRepositories {
+			repo := apk.Repository{URI: fmt.Sprintf("%s/%s", repositoryURI, arch.ToAPK())}
+			name, err := RemoveLabel(stripURLScheme(repo.URI))
+			if err != nil {
+				return fmt.Errorf("failed to remove label from repository URI: %w", err)
+			}
+			url, err := RemoveLabel(repo.IndexURI())
+			if err != nil {
+				return fmt.Errorf("failed to remove label from repository index URI: %w", err)
+			}
+			lock.Contents.RuntimeRepositories = append(lock.Contents.RuntimeRepositories, pkglock.LockRepo{
+				Name:         name,
+				URL:          url,
+				Architecture: arch.ToAPK(),
+				Checksum:     indexChecksums[url],
+				Verification: verification(url),
+			})
+		}
+	}
+	return lock.SaveToFile(output)
+}
+
+// lockKeyring records the name and checksum of the keys in the keyring of bc.
+// Keys which are not in the configuration, such as discovered keys, are added
+// by their name.
+func lockKeyring(lock *pkglock.Lock, bc *build.Context) error {
+	keys, err := bc.Keyring()
+	if err != nil {
+		return err
+	}
+	checksum := func(id string) string {
+		sum := sha256.Sum256(keys[id])
+		delete(keys, id)
+		return pkglock.SHA256Checksum(sum[:])
+	}
+	for i, k := range lock.Contents.Keyrings {
+		id := filepath.Base(k.URL)
+		if _, ok := keys[id]; ok {
+			lock.Contents.Keyrings[i].ID = id
+			lock.Contents.Keyrings[i].Checksum = checksum(id)
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(keys)) {
+		lock.Contents.Keyrings = append(lock.Contents.Keyrings, pkglock.LockKeyring{
+			Name:     id,
+			ID:       id,
+			Checksum: checksum(id),
+		})
+	}
+	return nil
+}
+
+// keepLockedArch copies the packages and repositories of an architecture from
+// the previous lockfile.
+func keepLockedArch(lock *pkglock.Lock, previous *pkglock.Lock, arch types.Architecture) {
+	for _, p := range previous.Contents.Packages {
+		if types.ParseArchitecture(p.Architecture) == arch {
+			lock.Contents.Packages = append(lock.Contents.Packages, p)
+		}
+	}
+	for _, r := range previous.Contents.BuildRepositories {
+		if types.ParseArchitecture(r.Architecture) == arch {
+			lock.Contents.BuildRepositories = append(lock.Contents.BuildRepositories, r)
+		}
+	}
+	for _, r := range previous.Contents.RuntimeRepositories {
+		if types.ParseArchitecture(r.Architecture) == arch {
+			lock.Contents.RuntimeRepositories = append(lock.Contents.RuntimeRepositories, r)
+		}
+	}
+}
+
+// resolveLockArch resolves the packages for an architecture. If update is
+// given, every package other than those keeps the version it has in the
+// previous lockfile; if that can not be resolved, the packages which
+// (transitively) depend on those in update, and their direct dependencies,
+// are updated too.
+func resolveLockArch(ctx context.Context, wd string, arch types.Architecture, opts []build.Option, previous *pkglock.Lock, update []string) (*build.Context, []*apk.APKResolved, error) {
+	log := clog.FromContext(ctx)
+
+	resolve := func(attempt string, pins []string) (*build.Context, []*apk.APKResolved, error) {
+		fsys := apkfs.DirFS(ctx, filepath.Join(wd, attempt), apkfs.WithCreateDir())
+		bopts := append(slices.Clone(opts), build.WithArch(arch), build.WithExtraPackages(pins))
+		bc, err := build.New(ctx, fsys, bopts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolved, err := bc.ResolveWithBase(ctx)
+		return bc, resolved, err
+	}
+
+	bc, latest, err := resolve("latest", nil)
+	if err != nil || len(update) == 0 {
+		return bc, latest, err
+	}
+
+	locked := map[string]string{}
+	for _, p := range previous.Contents.Packages {
+		if types.ParseArchitecture(p.Architecture) == arch {
+			locked[p.Name] = p.Version
+		}
+	}
+	for _, name := range update {
+		if _, ok := locked[name]; !ok {
+			log.Warnf("%s is not in the lockfile for %s", name, arch)
+		}
+	}
+
+	pkgs := make([]*apk.RepositoryPackage, 0, len(latest))
+	for _, r := range latest {
+		pkgs = append(pkgs, r.Package)
+	}
+	// pins returns the locked versions of the packages which are still
+	// needed, other than those being updated.
+	pins := func(updated map[string]struct{}) []string {
+		var pins []string
+		for _, pkg := range pkgs {
+			if _, ok := updated[pkg.Name]; ok {
+				continue
+			}
+			if version, ok := locked[pkg.Name]; ok {
+				pins = append(pins, pkg.Name+"="+version)
+			}
+		}
+		return pins
+	}
+
+	updated := map[string]struct{}{}
+	for _, name := range update {
+		updated[name] = struct{}{}
+	}
+	bc, resolved, err := resolve("pinned", pins(updated))
+	if err == nil {
+		return bc, resolved, nil
+	}
+	log.Warnf("unable to keep the locked versions of all other packages, updating related packages too: %v", err)
+
+	g := apk.NewPackageGraph(pkgs)
+	var dependents func(string)
+	dependents = func(name string) {
+		for _, rdep := range g.ReverseDependencies(name) {
+			if _, ok := updated[rdep]; !ok {
+				updated[rdep] = struct{}{}
+				dependents(rdep)
+			}
+		}
+	}
+	for _, name := range update {
+		dependents(name)
+		for _, dep := range g.Dependencies(name) {
+			updated[dep] = struct{}{}
+		}
+	}
+	return resolve("related", pins(updated))
+}
+
+func stripURLScheme(url string) string {
+	return strings.TrimPrefix(
+		strings.TrimPrefix(url, "https://"),
+		"http://",
+	)
+}
+
+// RemoveLabel returns the repository s without the @label prefixing it.
+func RemoveLabel(s string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("input is empty")
+	}
+
+	for strings.HasPrefix(s, "@") {
+		parts := strings.SplitN(s, " ", 2)
+		if len(parts) < 2 {
+			return "", fmt.Errorf("input does not follow the format '@label url'")
+		}
+		s = parts[1]
+	}
+
+	return s, nil
+}
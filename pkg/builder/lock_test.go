@@ -0,0 +1,52 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder_test
+
+import (
+	"testing"
+
+	"chainguard.dev/apko/pkg/builder"
+)
+
+func TestRemoveLabel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{
+			value: "docker.io/library/alpine:latest",
+			want:  "docker.io/library/alpine:latest",
+		}, {
+			value: "@alpine docker.io/library/alpine:latest",
+			want:  "docker.io/library/alpine:latest",
+		}, {
+			value: "@string",
+			want:  "",
+		}, {
+			value: "@label @label2 docker.io/library/alpine:latest",
+			want:  "docker.io/library/alpine:latest",
+		}, {
+			value: "@label @label2 @label3 any_string",
+			want:  "any_string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got, _ := builder.RemoveLabel(tt.value); got != tt.want {
+				t.Errorf("RemoveLabel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"go.opentelemetry.io/otel"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/vex"
+)
+
+type publishOpt struct {
+	local       bool
+	tags        []string
+	attachSBOMs bool
+	archTags    func(types.Architecture) ([]string, error)
+	blobs       oci.BlobOptions
+	digestOnly  bool
+}
+
+// PublishOption is an option for publishing
+type PublishOption func(*publishOpt) error
+
+// WithLocal sets whether to publish image to local Docker daemon.
+func WithLocal(local bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.local = local
+		return nil
+	}
+}
+
+// WithTags tags to use
+func WithTags(tags ...string) PublishOption {
+	return func(p *publishOpt) error {
+		p.tags = tags
+		return nil
+	}
+}
+
+// WithAttachSBOMs sets whether to attach the SBOMs to the published index and
+// images as OCI referrers.
+func WithAttachSBOMs(attach bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.attachSBOMs = attach
+		return nil
+	}
+}
+
+// WithArchTags sets the tags to also publish the image of each architecture
+// with, which tags returns for the architecture.
+func WithArchTags(tags func(types.Architecture) ([]string, error)) PublishOption {
+	return func(p *publishOpt) error {
+		p.archTags = tags
+		return nil
+	}
+}
+
+// WithBlobOptions sets how the layers of the images are published: the
+// repositories to mount them from, and whether to upload them in chunks.
+func WithBlobOptions(blobs oci.BlobOptions) PublishOption {
+	return func(p *publishOpt) error {
+		p.blobs = blobs
+		return nil
+	}
+}
+
+// WithDigestOnly sets whether to publish the index to the repository of the
+// first tag by digest only, without tagging it.
+func WithDigestOnly(digestOnly bool) PublishOption {
+	return func(p *publishOpt) error {
+		p.digestOnly = digestOnly
+		return nil
+	}
+}
+
+// PublishImage builds the image for archs, by default those of the
+// configuration, and publishes it, returning the digest of the published
+// index, or the reference of the image loaded with WithLocal. The references
+// published are written to the file outputRefs, and the SBOMs to sbomPath,
+// when set. It is what apko publish runs, and takes the options of package
+// build, so unlike Publish it follows the changes of that package.
+func PublishImage(ctx context.Context, outputRefs string, archs []types.Architecture, ropt []remote.Option, sbomPath string, buildOpts []build.Option, publishOpts []PublishOption) (name.Reference, error) {
+	log := clog.FromContext(ctx)
+	ctx, span := otel.Tracer("apko").Start(ctx, "PublishCmd")
+	defer span.End()
+
+	var opts publishOpt
+	for _, opt := range publishOpts {
+		if err := opt(&opts); err != nil {
+			return nil, err
+		}
+	}
+
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	defer os.RemoveAll(wd)
+
+	// build all of the components in the working directory
+	idx, sboms, err := BuildComponents(ctx, wd, archs, buildOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build image components: %w", err)
+	}
+
+	var (
+		local           = opts.local
+		tags            = opts.tags
+		builtReferences = make([]string, 0)
+	)
+
+	if local {
+		if opts.digestOnly {
+			return nil, fmt.Errorf("images loaded to the local Docker daemon are tagged")
+		}
+		if opts.archTags != nil {
+			return nil, fmt.Errorf("per-architecture tags cannot be loaded to the local Docker daemon")
+		}
+		// TODO: We shouldn't even need to build the index if we're loading a single image.
+		ref, err := oci.LoadIndex(ctx, idx, tags)
+		if err != nil {
+			return nil, fmt.Errorf("loading index: %w", err)
+		}
+		log.Infof("using local option, exiting early")
+		return ref, nil
+	}
+
+	// publish each arch-specific image
+	// TODO: This should just happen as part of PublishIndex.
+	ref, err := name.ParseReference(tags[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing %q as tag: %w", tags[0], err)
+	}
+	refs, err := oci.PublishImagesFromIndex(ctx, idx, ref.Context(), opts.blobs, ropt...)
+	if err != nil {
+		return nil, fmt.Errorf("publishing images from index: %w", err)
+	}
+	for _, ref := range refs {
+		builtReferences = append(builtReferences, ref.String())
+	}
+
+	// tag each arch-specific image, if asked to
+	if opts.archTags != nil {
+		archRefs, err := publishArchTags(ctx, idx, opts.archTags, ropt...)
+		if err != nil {
+			return nil, fmt.Errorf("publishing per-architecture tags: %w", err)
+		}
+		builtReferences = append(builtReferences, archRefs...)
+	}
+
+	// publish the index
+	var finalDigest name.Digest
+	if opts.digestOnly {
+		finalDigest, err = oci.PublishIndexByDigest(ctx, idx, ref.Context(), ropt...)
+	} else {
+		finalDigest, err = oci.PublishIndex(ctx, idx, tags, ropt...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("publishing image index: %w", err)
+	}
+	builtReferences = append(builtReferences, finalDigest.String())
+
+	// attach the VEX statements bound to the image to the index
+	if err := attachVEX(ctx, finalDigest, idx, sboms, ropt...); err != nil {
+		return nil, err
+	}
+
+	// attach the SBOMs to the index and images they describe
+	if opts.attachSBOMs {
+		if err := attachSBOMs(ctx, finalDigest, idx, sboms, ropt...); err != nil {
+			return nil, err
+		}
+	}
+
+	// output any file info requested
+	// If provided, this is the name of the file to write digest referenced into
+	if outputRefs != "" {
+		//nolint:gosec // Make image ref file readable by non-root
+		if err := os.WriteFile(outputRefs, []byte(strings.Join(builtReferences, "\n")+"\n"), 0o666); err != nil {
+			return nil, fmt.Errorf("failed to write digest: %w", err)
+		}
+	}
+
+	// copy sboms over to the sbomPath target directory
+	if sbomPath != "" {
+		for _, sbom := range sboms {
+			// because os.Rename fails across partitions, we do our own
+			if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
+				return nil, fmt.Errorf("moving sbom: %w", err)
+			}
+		}
+	}
+
+	return finalDigest, nil
+}
+
+// attachVEX attaches the OpenVEX documents among docs to the index as
+// referrers, for scanners to discover along the image.
+func attachVEX(ctx context.Context, digest name.Digest, idx v1.ImageIndex, docs []types.SBOM, ropt ...remote.Option) error {
+	for _, doc := range docs {
+		if doc.Format != vex.Format {
+			continue
+		}
+		data, err := os.ReadFile(doc.Path)
+		if err != nil {
+			return fmt.Errorf("reading VEX document: %w", err)
+		}
+		desc, err := partial.Descriptor(idx)
+		if err != nil {
+			return fmt.Errorf("describing index: %w", err)
+		}
+		if _, err := oci.AttachReferrer(ctx, digest, *desc, vex.MediaType, data, ropt...); err != nil {
+			return fmt.Errorf("attaching VEX document: %w", err)
+		}
+	}
+	return nil
+}
+
+// sbomMediaTypes are the media types of the SBOM formats, as attached.
+var sbomMediaTypes = map[string]ggcrtypes.MediaType{
+	"spdx":      "application/spdx+json",
+	"cyclonedx": "application/vnd.cyclonedx+json",
+}
+
+// attachSBOMs attaches the SBOMs among docs as referrers of the index or
+// image they describe, in the repository of the index. Scanners pointed at
+// the index find the index SBOM, which references the SBOM of each platform.
+func attachSBOMs(ctx context.Context, digest name.Digest, idx v1.ImageIndex, docs []types.SBOM, ropt ...remote.Option) error {
+	desc, err := partial.Descriptor(idx)
+	if err != nil {
+		return fmt.Errorf("describing index: %w", err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return fmt.Errorf("reading index manifest: %w", err)
+	}
+	subjects := map[v1.Hash]v1.Descriptor{desc.Digest: *desc}
+	for _, m := range manifest.Manifests {
+		subjects[m.Digest] = m
+	}
+
+	for _, doc := range docs {
+		mediaType, ok := sbomMediaTypes[doc.Format]
+		if !ok {
+			continue
+		}
+		subject, ok := subjects[doc.Digest]
+		if !ok {
+			return fmt.Errorf("%s describes %s, which is not in the index", doc.Path, doc.Digest)
+		}
+		data, err := os.ReadFile(doc.Path)
+		if err != nil {
+			return fmt.Errorf("reading SBOM: %w", err)
+		}
+		if _, err := oci.AttachReferrer(ctx, digest.Context().Digest(subject.Digest.String()), subject, mediaType, data, ropt...); err != nil {
+			return fmt.Errorf("attaching SBOM: %w", err)
+		}
+	}
+	return nil
+}
+
+// publishArchTags tags the image of each architecture of idx, already
+// pushed, with the tags returned for the architecture, and returns the
+// references of the tagged digests.
+func publishArchTags(ctx context.Context, idx v1.ImageIndex, tags func(types.Architecture) ([]string, error), ropt ...remote.Option) ([]string, error) {
+	log := clog.FromContext(ctx)
+
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading index manifest: %w", err)
+	}
+	refs := []string{}
+	for _, m := range manifest.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		arch := m.Platform.Architecture
+		if arch == "arm" && m.Platform.Variant != "" {
+			arch += "/" + m.Platform.Variant
+		}
+		expanded, err := tags(types.ParseArchitecture(arch))
+		if err != nil {
+			return nil, err
+		}
+		img, err := idx.Image(m.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading image %s: %w", m.Digest, err)
+		}
+		for _, t := range expanded {
+			tag, err := name.NewTag(t)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %q as tag: %w", t, err)
+			}
+			log.Infof("publishing %s image as %s", arch, tag)
+			if err := remote.Write(tag, img, append(ropt, remote.WithContext(ctx))...); err != nil {
+				return nil, fmt.Errorf("publishing %s: %w", tag, err)
+			}
+			refs = append(refs, tag.Context().Digest(m.Digest.String()).String())
+		}
+	}
+	return refs, nil
+}
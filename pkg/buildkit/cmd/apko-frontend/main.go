@@ -0,0 +1,37 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command apko-frontend is the BuildKit frontend of apko, see package
+// chainguard.dev/apko/pkg/buildkit.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/moby/buildkit/frontend/gateway/grpcclient"
+
+	"chainguard.dev/apko/pkg/buildkit"
+)
+
+func main() {
+	ctx, done := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer done()
+
+	if err := grpcclient.RunFromEnvironment(ctx, buildkit.Build); err != nil {
+		log.Fatalf("error during frontend execution: %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package buildkit is a BuildKit gateway frontend which builds apko images,
+// so that "docker buildx build -f apko.yaml ." builds them with the caching
+// and exporters of BuildKit.
+package buildkit
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containerd/platforms"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/moby/buildkit/client/llb"
+	"github.com/moby/buildkit/exporter/containerimage/exptypes"
+	"github.com/moby/buildkit/frontend/gateway/client"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/mod/semver"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+	"sigs.k8s.io/release-utils/version"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const (
+	// ApkoRepository is the repository of the image apko runs in to build
+	// the root filesystems, unless the APKO_IMAGE build argument is set. The
+	// image is that of the release of apko the frontend is part of, as the
+	// frontend passes flags to apko which earlier releases do not have.
+	ApkoRepository = "cgr.dev/chainguard/apko"
+
+	defaultFilename = "apko.yaml"
+
+	keyFilename       = "filename"
+	keyTargetPlatform = "platform"
+	buildArgPrefix    = "build-arg:"
+
+	// The frontend build arguments, which are not passed on to apko.
+	argApkoImage       = "APKO_IMAGE"
+	argSourceDateEpoch = "SOURCE_DATE_EPOCH"
+
+	localNameConfig  = "dockerfile"
+	localNameContext = "context"
+
+	configDir  = "/config"
+	contextDir = "/context"
+	outDir     = "/out"
+	cacheDir   = "/var/cache/apko"
+)
+
+// Build builds the image described by the configuration file (apko.yaml
+// unless the filename option is set) for each target platform, or the
+// architectures of the configuration, or else the platform of the worker.
+//
+// apko runs in the image of the same release in ApkoRepository, in the build context, with the packages
+// and indexes cached in a cache mount shared by the builds; its root
+// filesystem becomes the image, with the configuration apko wrote to
+// /etc/apko.json as the image configuration.
+func Build(ctx context.Context, c client.Client) (*client.Result, error) {
+	bopts := c.BuildOpts()
+	filename := cmp.Or(bopts.Opts[keyFilename], defaultFilename)
+	args := buildArgs(bopts.Opts)
+	apkoImage, err := apkoImageFor(args[argApkoImage], version.GetVersionInfo().GitVersion)
+	if err != nil {
+		return nil, err
+	}
+	delete(args, argApkoImage)
+	created, buildDate, err := sourceDateEpoch(args[argSourceDateEpoch])
+	if err != nil {
+		return nil, err
+	}
+	delete(args, argSourceDateEpoch)
+
+	configSt := llb.Local(localNameConfig,
+		llb.SessionID(bopts.SessionID),
+		llb.FollowPaths([]string{filename}),
+		llb.SharedKeyHint(filename),
+		llb.WithCustomName("[internal] load "+filename),
+	)
+	contextSt := llb.Local(localNameContext,
+		llb.SessionID(bopts.SessionID),
+		llb.SharedKeyHint(localNameContext),
+		llb.WithCustomName("[internal] load build context"),
+	)
+
+	config, err := readFile(ctx, c, configSt, filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", filename, err)
+	}
+	var workerPlatforms []ocispecs.Platform
+	if len(bopts.Workers) != 0 {
+		workerPlatforms = bopts.Workers[0].Platforms
+	}
+	// apko resolves includes in its working directory, the build context.
+	readInclude := func(name string) ([]byte, error) {
+		return readFile(ctx, c, contextSt, name)
+	}
+	archs, err := targetArchs(bopts.Opts[keyTargetPlatform], config, readInclude, workerPlatforms)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]client.Reference, len(archs))
+	configs := make([][]byte, len(archs))
+	plats := make([]ocispecs.Platform, len(archs))
+	var eg errgroup.Group
+	for i, arch := range archs {
+		eg.Go(func() error {
+			st := rootfs(c, apkoImage, configSt, contextSt, filename, arch, args, buildDate)
+			def, err := st.Marshal(ctx)
+			if err != nil {
+				return err
+			}
+			res, err := c.Solve(ctx, client.SolveRequest{Definition: def.ToPB()})
+			if err != nil {
+				return err
+			}
+			ref, err := res.SingleRef()
+			if err != nil {
+				return err
+			}
+			data, err := ref.ReadFile(ctx, client.ReadRequest{Filename: "/etc/apko.json"})
+			if err != nil {
+				return fmt.Errorf("reading the configuration of the %s image: %w", arch, err)
+			}
+			cfg, p, err := imageConfig(ctx, data, arch, created)
+			if err != nil {
+				return fmt.Errorf("configuring the %s image: %w", arch, err)
+			}
+			refs[i], configs[i], plats[i] = ref, cfg, p
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	res := client.NewResult()
+	if len(archs) == 1 && !strings.Contains(bopts.Opts[keyTargetPlatform], ",") {
+		res.SetRef(refs[0])
+		res.AddMeta(exptypes.ExporterImageConfigKey, configs[0])
+		return res, nil
+	}
+	var ps exptypes.Platforms
+	for i, p := range plats {
+		id := platforms.Format(p)
+		res.AddRef(id, refs[i])
+		res.AddMeta(exptypes.ExporterImageConfigKey+"/"+id, configs[i])
+		ps.Platforms = append(ps.Platforms, exptypes.Platform{ID: id, Platform: p})
+	}
+	b, err := json.Marshal(ps)
+	if err != nil {
+		return nil, err
+	}
+	res.AddMeta(exptypes.ExporterPlatformsKey, b)
+	return res, nil
+}
+
+// rootfs returns the root filesystem apko builds for arch.
+func rootfs(c client.Client, apkoImage string, configSt, contextSt llb.State, filename string, arch types.Architecture, args map[string]string, buildDate string) llb.State {
+	argv := []string{"apko", "build-minirootfs",
+		"--build-arch", arch.ToAPK(),
+		"--cache-dir", cacheDir,
+		"--progress", "none",
+	}
+	if buildDate != "" {
+		argv = append(argv, "--build-date", buildDate)
+	}
+	for _, k := range slices.Sorted(maps.Keys(args)) {
+		argv = append(argv, "--build-arg", k+"="+args[k])
+	}
+	argv = append(argv, path.Join(configDir, filename), path.Join(outDir, "rootfs.tar.gz"))
+
+	run := llb.Image(apkoImage, llb.WithMetaResolver(c)).Run(
+		llb.Args(argv),
+		llb.Dir(contextDir),
+		llb.User("0:0"),
+		llb.AddMount(configDir, configSt, llb.Readonly),
+		llb.AddMount(contextDir, contextSt, llb.Readonly),
+		llb.AddMount(cacheDir, llb.Scratch(), llb.AsPersistentCacheDir("apko-cache", llb.CacheMountShared)),
+		llb.WithCustomNamef("[%s] apko build-minirootfs %s", arch.ToAPK(), filename),
+	)
+	out := run.AddMount(outDir, llb.Scratch())
+	return llb.Scratch().File(
+		llb.Copy(out, "rootfs.tar.gz", "/", &llb.CopyInfo{AttemptUnpack: true}),
+		llb.WithCustomNamef("[%s] unpack root filesystem", arch.ToAPK()),
+	)
+}
+
+// readFile returns the content of a file of the state.
+func readFile(ctx context.Context, c client.Client, st llb.State, filename string) ([]byte, error) {
+	def, err := st.Marshal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.Solve(ctx, client.SolveRequest{Definition: def.ToPB()})
+	if err != nil {
+		return nil, err
+	}
+	ref, err := res.SingleRef()
+	if err != nil {
+		return nil, err
+	}
+	return ref.ReadFile(ctx, client.ReadRequest{Filename: filename})
+}
+
+// buildArgs returns the build arguments among the options of the frontend.
+func buildArgs(opts map[string]string) map[string]string {
+	args := map[string]string{}
+	for k, v := range opts {
+		if name, ok := strings.CutPrefix(k, buildArgPrefix); ok && !strings.HasPrefix(name, "BUILDKIT_") {
+			args[name] = v
+		}
+	}
+	return args
+}
+
+// apkoImageFor returns the image apko runs in: image, the APKO_IMAGE build
+// argument, or else the image of release v, the version of the frontend, in
+// ApkoRepository. Frontends which are not a release have no such image.
+func apkoImageFor(image, v string) (string, error) {
+	if image != "" {
+		return image, nil
+	}
+	if !semver.IsValid(v) || semver.Prerelease(v) != "" || semver.Build(v) != "" {
+		return "", fmt.Errorf("the frontend is not a release of apko (%s): set the %s build argument to an apko image of the same version", v, argApkoImage)
+	}
+	return ApkoRepository + ":" + strings.TrimPrefix(v, "v"), nil
+}
+
+// sourceDateEpoch parses the SOURCE_DATE_EPOCH build argument, returning the
+// creation time of the image and the build date of its files, as
+// build-minirootfs takes it. Without it, both are the Unix epoch, as for
+// apko build-minirootfs.
+func sourceDateEpoch(v string) (time.Time, string, error) {
+	if v == "" {
+		return time.Unix(0, 0).UTC(), "", nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", v, err)
+	}
+	t := time.Unix(sec, 0).UTC()
+	return t, t.Format(time.RFC3339), nil
+}
+
+// targetArchs returns the architectures to build: those of the platform
+// option, which may list several, or else those of the configuration, or
+// else the first platform of the worker.
+func targetArchs(platformOpt string, config []byte, readInclude func(string) ([]byte, error), workerPlatforms []ocispecs.Platform) ([]types.Architecture, error) {
+	var archs []types.Architecture
+	if platformOpt != "" {
+		for _, s := range strings.Split(platformOpt, ",") {
+			p, err := platforms.Parse(strings.TrimSpace(s))
+			if err != nil {
+				return nil, fmt.Errorf("parsing platform %q: %w", s, err)
+			}
+			if p.OS != "linux" {
+				return nil, fmt.Errorf("unsupported platform %s: apko only builds linux images", s)
+			}
+			archs = append(archs, archFromPlatform(p))
+		}
+		return archs, nil
+	}
+
+	archs, err := configArchs(config, readInclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(archs) != 0 {
+		return archs, nil
+	}
+
+	if len(workerPlatforms) == 0 {
+		return nil, fmt.Errorf("no platform to build for: set the platform, or archs in the configuration")
+	}
+	return []types.Architecture{archFromPlatform(workerPlatforms[0])}, nil
+}
+
+// configArchs returns the architectures of the configuration, as apko
+// merges them: those of the configuration, or else those of the
+// configurations it includes, or else those of the innermost flavor.
+func configArchs(config []byte, readInclude func(string) ([]byte, error)) ([]types.Architecture, error) {
+	var flavor string
+	seen := map[string]bool{}
+	for {
+		var ic struct {
+			Archs   []types.Architecture `yaml:"archs"`
+			Include string               `yaml:"include"`
+			Flavor  string               `yaml:"flavor"`
+		}
+		if err := yaml.Unmarshal(config, &ic); err != nil {
+			return nil, fmt.Errorf("parsing configuration: %w", err)
+		}
+		if len(ic.Archs) != 0 {
+			return ic.Archs, nil
+		}
+		flavor = cmp.Or(ic.Flavor, flavor)
+		if ic.Include == "" {
+			break
+		}
+		if seen[ic.Include] {
+			return nil, fmt.Errorf("include cycle at %s", ic.Include)
+		}
+		seen[ic.Include] = true
+		var err error
+		if config, err = readInclude(ic.Include); err != nil {
+			return nil, fmt.Errorf("reading include %s: %w", ic.Include, err)
+		}
+	}
+	if flavor == "" {
+		return nil, nil
+	}
+	return types.FlavorArchs(flavor)
+}
+
+// archFromPlatform returns the architecture of an OCI platform.
+func archFromPlatform(p ocispecs.Platform) types.Architecture {
+	if p.Architecture == "arm" && p.Variant != "" {
+		return types.ParseArchitecture(p.Architecture + "/" + p.Variant)
+	}
+	return types.ParseArchitecture(p.Architecture)
+}
+
+// imageConfig returns the OCI image configuration and platform of an image,
+// from the configuration apko wrote to /etc/apko.json. BuildKit fills in its
+// root filesystem and history.
+func imageConfig(ctx context.Context, data []byte, arch types.Architecture, created time.Time) ([]byte, ocispecs.Platform, error) {
+	var ic types.ImageConfiguration
+	if err := json.Unmarshal(data, &ic); err != nil {
+		return nil, ocispecs.Platform{}, err
+	}
+	img, err := oci.BuildImageFromLayers(ctx, empty.Image, nil, ic, created, arch)
+	if err != nil {
+		return nil, ocispecs.Platform{}, err
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return nil, ocispecs.Platform{}, err
+	}
+	p := ic.OCIPlatform(arch)
+	return cfg, ocispecs.Platform{
+		OS:           p.OS,
+		Architecture: p.Architecture,
+		Variant:      p.Variant,
+		OSVersion:    p.OSVersion,
+		OSFeatures:   p.OSFeatures,
+	}, nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildkit
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ocispecs "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestTargetArchs(t *testing.T) {
+	worker := []ocispecs.Platform{{OS: "linux", Architecture: "arm64"}}
+	includes := map[string]string{
+		"base.yaml":  "include: wolfi.yaml\narchs: [x86_64]\n",
+		"wolfi.yaml": "flavor: wolfi\n",
+		"plain.yaml": "contents:\n  packages: [wolfi-base]\n",
+		"cycle.yaml": "include: cycle.yaml\n",
+	}
+	readInclude := func(name string) ([]byte, error) {
+		s, ok := includes[name]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		return []byte(s), nil
+	}
+	for _, tt := range []struct {
+		name     string
+		platform string
+		config   string
+		want     []types.Architecture
+		wantErr  string
+	}{{
+		name:     "platform option",
+		platform: "linux/amd64,linux/arm/v7",
+		config:   "archs: [x86_64]\n",
+		want:     []types.Architecture{types.ParseArchitecture("amd64"), types.ParseArchitecture("arm/v7")},
+	}, {
+		name:   "config archs",
+		config: "contents:\n  packages: [wolfi-base]\narchs: [x86_64, aarch64]\n",
+		want:   []types.Architecture{types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")},
+	}, {
+		name:   "included archs",
+		config: "include: base.yaml\n",
+		want:   []types.Architecture{types.ParseArchitecture("amd64")},
+	}, {
+		name:   "included flavor",
+		config: "include: wolfi.yaml\n",
+		want:   []types.Architecture{types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")},
+	}, {
+		name:   "flavor",
+		config: "flavor: alpine\ninclude: plain.yaml\n",
+		want:   []types.Architecture{types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")},
+	}, {
+		name:    "include cycle",
+		config:  "include: cycle.yaml\n",
+		wantErr: "include cycle",
+	}, {
+		name:    "missing include",
+		config:  "include: missing.yaml\n",
+		wantErr: "reading include missing.yaml",
+	}, {
+		name:   "worker platform",
+		config: "contents:\n  packages: [wolfi-base]\n",
+		want:   []types.Architecture{types.ParseArchitecture("arm64")},
+	}, {
+		name:     "not linux",
+		platform: "windows/amd64",
+		wantErr:  "apko only builds linux images",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := targetArchs(tt.platform, []byte(tt.config), readInclude, worker)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestBuildArgs(t *testing.T) {
+	got := buildArgs(map[string]string{
+		"filename":                  "apko.yaml",
+		"build-arg:VERSION":         "1.2",
+		"build-arg:BUILDKIT_SYNTAX": "cgr.dev/chainguard/apko-frontend",
+		"build-arg:APKO_IMAGE":      "example.com/apko",
+	})
+	require.Equal(t, map[string]string{"VERSION": "1.2", "APKO_IMAGE": "example.com/apko"}, got)
+}
+
+func TestApkoImageFor(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		image   string
+		version string
+		want    string
+		wantErr string
+	}{{
+		name:    "release",
+		version: "v0.30.1",
+		want:    "cgr.dev/chainguard/apko:0.30.1",
+	}, {
+		name:    "build argument",
+		image:   "example.com/apko",
+		version: "devel",
+		want:    "example.com/apko",
+	}, {
+		name:    "development build",
+		version: "v0.30.1-12-gdeadbee",
+		wantErr: "set the APKO_IMAGE build argument",
+	}, {
+		name:    "unknown version",
+		version: "devel",
+		wantErr: "set the APKO_IMAGE build argument",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := apkoImageFor(tt.image, tt.version)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	created, date, err := sourceDateEpoch("")
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(0, 0).UTC(), created)
+	require.Empty(t, date)
+
+	created, date, err = sourceDateEpoch("1700000000")
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1700000000, 0).UTC(), created)
+	require.Equal(t, "2023-11-14T22:13:20Z", date)
+
+	_, _, err = sourceDateEpoch("yesterday")
+	require.ErrorContains(t, err, "invalid SOURCE_DATE_EPOCH")
+}
+
+func TestImageConfig(t *testing.T) {
+	ic := types.ImageConfiguration{
+		Entrypoint:  types.ImageEntrypoint{Command: "/usr/bin/nginx -g 'daemon off;'"},
+		Environment: map[string]string{"FOO": "bar"},
+		WorkDir:     "/srv",
+		Accounts:    types.ImageAccounts{RunAs: "65532"},
+		Platform:    &types.ImagePlatform{OSVersion: "1.0", OSFeatures: []string{"sse4"}},
+	}
+	data, err := json.Marshal(ic)
+	require.NoError(t, err)
+
+	arch := types.ParseArchitecture("arm/v7")
+	created := time.Unix(1700000000, 0).UTC()
+	b, p, err := imageConfig(context.Background(), data, arch, created)
+	require.NoError(t, err)
+
+	var cfg v1.ConfigFile
+	require.NoError(t, json.Unmarshal(b, &cfg))
+	require.Equal(t, "linux", cfg.OS)
+	require.Equal(t, "arm", cfg.Architecture)
+	require.Equal(t, "v7", cfg.Variant)
+	require.Equal(t, created, cfg.Created.UTC())
+	require.Equal(t, []string{"/usr/bin/nginx", "-g", "daemon off;"}, cfg.Config.Entrypoint)
+	require.Equal(t, "/srv", cfg.Config.WorkingDir)
+	require.Equal(t, "65532", cfg.Config.User)
+	require.Contains(t, cfg.Config.Env, "FOO=bar")
+	require.Equal(t, ocispecs.Platform{OS: "linux", Architecture: "arm", Variant: "v7", OSVersion: "1.0", OSFeatures: []string{"sse4"}}, p)
+}
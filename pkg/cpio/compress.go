@@ -0,0 +1,70 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpio
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressions of cpio archives, among those the kernel unpacks
+// initramfs archives with.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Compressions are the supported compressions.
+var Compressions = []string{CompressionNone, CompressionGzip, CompressionZstd}
+
+// CompressionFor returns the compression named by the extension of path:
+// .gz for gzip and .zst for zstd, none otherwise.
+func CompressionFor(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return CompressionGzip
+	case strings.HasSuffix(path, ".zst"):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// NewWriter returns a writer compressing to w with compression, which has
+// to be closed to flush it. It does not close w. The output only depends
+// on what is written, so archives stay reproducible.
+func NewWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone, "":
+		return nopCloser{w}, nil
+	case CompressionGzip:
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	case CompressionZstd:
+		// The kernel allocates the window while unpacking the
+		// initramfs early in boot, so keep it small.
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithWindowSize(1<<20), zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unsupported compression %q, must be one of: %s", compression, strings.Join(Compressions, ", "))
+	}
+}
@@ -17,14 +17,27 @@ package cpio
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 
+	"github.com/chainguard-dev/clog"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/u-root/u-root/pkg/cpio"
 )
 
-func FromLayer(layer v1.Layer, dest io.Writer) error {
+// FromLayer writes the files of layer to dest as a newc cpio archive, in
+// the order of the layer, which the kernel can unpack as an initramfs.
+//
+// Ownership, modification times and hard links are preserved, and inode
+// numbers are assigned in order, so the same layer always gives the same
+// archive.
+func FromLayer(ctx context.Context, layer v1.Layer, dest io.Writer) error {
+	links, err := hardLinkCounts(layer)
+	if err != nil {
+		return err
+	}
+
 	// Open the filesystem layer to walk through the file.
 	u, err := layer.Uncompressed()
 	if err != nil {
@@ -35,6 +48,10 @@ func FromLayer(layer v1.Layer, dest io.Writer) error {
 
 	w := cpio.NewDedupWriter(cpio.Newc.Writer(dest))
 
+	// The inodes of the files which are hard linked, by name.
+	inodes := map[string]uint64{}
+	var ino uint64
+
 	// Iterate through the tar archive entries
 	for {
 		header, err := tarReader.Next()
@@ -42,25 +59,17 @@ func FromLayer(layer v1.Layer, dest io.Writer) error {
 			break // End of archive
 		}
 		if err != nil {
-			fmt.Println("Error reading tar entry:", err)
-			return err
+			return fmt.Errorf("reading tar entry: %w", err)
 		}
 
+		var rec cpio.Record
 		// Determine CPIO file mode based on TAR typeflag
 		switch header.Typeflag {
 		case tar.TypeDir:
-			if err := cpio.WriteRecordsAndDirs(w, []cpio.Record{
-				cpio.Directory(header.Name, uint64(header.Mode)),
-			}); err != nil {
-				return err
-			}
+			rec = cpio.Directory(header.Name, uint64(header.Mode))
 
 		case tar.TypeSymlink:
-			if err := cpio.WriteRecordsAndDirs(w, []cpio.Record{
-				cpio.Symlink(header.Name, header.Linkname),
-			}); err != nil {
-				return err
-			}
+			rec = cpio.Symlink(header.Name, header.Linkname)
 
 		case tar.TypeReg:
 			var original bytes.Buffer
@@ -70,28 +79,75 @@ func FromLayer(layer v1.Layer, dest io.Writer) error {
 			// than buffering.
 			//nolint:gosec
 			if _, err := io.Copy(&original, tarReader); err != nil {
-				fmt.Println("Error reading file content:", err)
-				return err
+				return fmt.Errorf("reading content of %s: %w", header.Name, err)
 			}
 
-			if err := cpio.WriteRecordsAndDirs(w, []cpio.Record{
-				cpio.StaticFile(header.Name, original.String(), uint64(header.Mode)),
-			}); err != nil {
-				return err
+			rec = cpio.StaticFile(header.Name, original.String(), uint64(header.Mode)&^cpio.S_IFMT)
+			if n := links[header.Name]; n != 0 {
+				ino++
+				inodes[header.Name] = ino
+				rec.Ino = ino
+				rec.NLink = uint64(n) + 1
 			}
 
-		case tar.TypeChar:
-			if err := cpio.WriteRecordsAndDirs(w, []cpio.Record{
-				cpio.CharDev(header.Name, uint64(header.Mode), uint64(header.Devmajor), uint64(header.Devminor)),
-			}); err != nil {
-				return err
+		case tar.TypeLink:
+			// The kernel links entries with the inode of an earlier
+			// one, whose content they share, so they carry none.
+			target, ok := inodes[header.Linkname]
+			if !ok {
+				return fmt.Errorf("hard link %s to %s, which is not a regular file before it", header.Name, header.Linkname)
 			}
+			rec = cpio.StaticFile(header.Name, "", uint64(header.Mode)&^cpio.S_IFMT)
+			rec.Ino = target
+			rec.NLink = uint64(links[header.Linkname]) + 1
+
+		case tar.TypeChar:
+			rec = cpio.CharDev(header.Name, uint64(header.Mode), uint64(header.Devmajor), uint64(header.Devminor))
+
+		case tar.TypeBlock:
+			rec = cpio.CharDev(header.Name, uint64(header.Mode), uint64(header.Devmajor), uint64(header.Devminor))
+			rec.Mode = cpio.S_IFBLK | rec.Mode&^cpio.S_IFMT
+
+		case tar.TypeFifo:
+			rec = cpio.Record{Info: cpio.Info{Name: header.Name, Mode: cpio.S_IFIFO | uint64(header.Mode)&^cpio.S_IFMT}}
 
 		default:
-			fmt.Printf("Unsupported TAR typeflag: %c for %s\n", header.Typeflag, header.Name)
+			clog.FromContext(ctx).Warnf("skipping %s, unsupported tar typeflag %c", header.Name, header.Typeflag)
 			continue // Skip unsupported types
 		}
+
+		rec.UID = uint64(header.Uid) //nolint:gosec
+		rec.GID = uint64(header.Gid) //nolint:gosec
+		rec.MTime = uint64(max(header.ModTime.Unix(), 0))
+		if err := cpio.WriteRecordsAndDirs(w, []cpio.Record{rec}); err != nil {
+			return err
+		}
 	}
 
 	return w.WriteRecord(cpio.TrailerRecord)
 }
+
+// hardLinkCounts returns the number of hard links to each file of layer
+// other than its own entry, by name.
+func hardLinkCounts(layer v1.Layer) (map[string]int, error) {
+	u, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer u.Close()
+
+	links := map[string]int{}
+	tr := tar.NewReader(u)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return links, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar entry: %w", err)
+		}
+		if header.Typeflag == tar.TypeLink {
+			links[header.Linkname]++
+		}
+	}
+}
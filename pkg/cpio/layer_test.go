@@ -0,0 +1,131 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cpio
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+func testLayer(t *testing.T) []byte {
+	t.Helper()
+	mtime := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "bin", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "bin/busybox", Mode: 0o755}, data: "busybox"},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "bin/sh", Linkname: "bin/busybox", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "bin/ls", Linkname: "busybox", Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "home/nonroot", Mode: 0o700, Uid: 65532, Gid: 65532}},
+		{hdr: tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0o666, Devmajor: 1, Devminor: 3}},
+	} {
+		f.hdr.ModTime = mtime
+		f.hdr.Size = int64(len(f.data))
+		require.NoError(t, tw.WriteHeader(&f.hdr))
+		_, err := tw.Write([]byte(f.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestFromLayer(t *testing.T) {
+	data := testLayer(t)
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, FromLayer(context.Background(), layer, &out))
+
+	records, err := cpio.ReadAllRecords(cpio.Newc.Reader(bytes.NewReader(out.Bytes())))
+	require.NoError(t, err)
+	byName := map[string]cpio.Record{}
+	var names []string
+	for _, r := range records {
+		byName[r.Name] = r
+		names = append(names, r.Name)
+	}
+
+	// Missing parent directories are written before their entries.
+	require.Equal(t, []string{".", "bin", "bin/busybox", "bin/sh", "bin/ls", "home", "home/nonroot", "dev", "dev/null"}, names)
+
+	busybox, sh := byName["bin/busybox"], byName["bin/sh"]
+	require.Equal(t, uint64(cpio.S_IFREG|0o755), busybox.Mode)
+	require.Equal(t, uint64(7), busybox.FileSize)
+	require.Equal(t, uint64(1700000000), busybox.MTime)
+	require.Equal(t, uint64(2), busybox.NLink)
+	require.NotZero(t, busybox.Ino)
+	require.Equal(t, busybox.Ino, sh.Ino)
+	require.Equal(t, uint64(0), sh.FileSize)
+
+	home := byName["home/nonroot"]
+	require.Equal(t, uint64(cpio.S_IFDIR|0o700), home.Mode)
+	require.Equal(t, uint64(65532), home.UID)
+	require.Equal(t, uint64(65532), home.GID)
+
+	null := byName["dev/null"]
+	require.Equal(t, uint64(cpio.S_IFCHR|0o666), null.Mode)
+	require.Equal(t, uint64(1), null.Rmajor)
+	require.Equal(t, uint64(3), null.Rminor)
+
+	// The same layer gives the same archive.
+	var again bytes.Buffer
+	require.NoError(t, FromLayer(context.Background(), layer, &again))
+	require.Equal(t, out.Bytes(), again.Bytes())
+}
+
+func TestNewWriter(t *testing.T) {
+	require.Equal(t, CompressionGzip, CompressionFor("initramfs.cpio.gz"))
+	require.Equal(t, CompressionZstd, CompressionFor("initramfs.cpio.zst"))
+	require.Equal(t, CompressionNone, CompressionFor("initramfs.cpio"))
+
+	for compression, magic := range map[string][]byte{
+		CompressionNone: []byte("070701"),
+		CompressionGzip: {0x1f, 0x8b},
+		CompressionZstd: {0x28, 0xb5, 0x2f, 0xfd},
+	} {
+		t.Run(compression, func(t *testing.T) {
+			compress := func() []byte {
+				var buf bytes.Buffer
+				w, err := NewWriter(&buf, compression)
+				require.NoError(t, err)
+				_, err = w.Write([]byte("070701" + "content"))
+				require.NoError(t, err)
+				require.NoError(t, w.Close())
+				return buf.Bytes()
+			}
+			out := compress()
+			require.True(t, bytes.HasPrefix(out, magic), "%x", out)
+			require.Equal(t, out, compress(), "compression is reproducible")
+		})
+	}
+
+	_, err := NewWriter(io.Discard, "bzip2")
+	require.ErrorContains(t, err, `unsupported compression "bzip2"`)
+}
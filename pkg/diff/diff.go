@@ -0,0 +1,246 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff compares the packages and files of two images or lockfiles.
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"text/tabwriter"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// Package is a package installed in an image, or locked in a lockfile.
+type Package struct {
+	Name    string
+	Version string
+	// Size is the installed size of the package, if known.
+	Size uint64
+	// Files are the paths of the files installed by the package, if known.
+	Files []string
+}
+
+// FromLock returns the packages locked for an architecture.
+func FromLock(l lock.Lock, arch types.Architecture) []Package {
+	var pkgs []Package
+	for _, p := range l.Contents.Packages {
+		if types.ParseArchitecture(p.Architecture) == arch {
+			pkgs = append(pkgs, Package{Name: p.Name, Version: p.Version})
+		}
+	}
+	return pkgs
+}
+
+// FromInstalled returns the packages in an installed database.
+func FromInstalled(installed []*apk.InstalledPackage) []Package {
+	pkgs := make([]Package, 0, len(installed))
+	for _, p := range installed {
+		pkg := Package{
+			Name:    p.Name,
+			Version: p.Version,
+			Size:    p.InstalledSize,
+		}
+		for _, f := range p.Files {
+			pkg.Files = append(pkg.Files, f.Name)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+// PackageChange is a package which differs between two images.
+type PackageChange struct {
+	Name string `json:"name"`
+	// From is the version before the change, empty if it was added.
+	From string `json:"from,omitempty"`
+	// To is the version after the change, empty if it was removed.
+	To string `json:"to,omitempty"`
+	// SizeDelta is the change in installed size, in bytes.
+	SizeDelta int64 `json:"sizeDelta"`
+}
+
+// Report describes the differences between two images.
+type Report struct {
+	Added      []PackageChange `json:"added,omitempty"`
+	Removed    []PackageChange `json:"removed,omitempty"`
+	Upgraded   []PackageChange `json:"upgraded,omitempty"`
+	Downgraded []PackageChange `json:"downgraded,omitempty"`
+	// AddedFiles and RemovedFiles are only reported when the file lists of
+	// both sides are known, i.e. neither is a lockfile.
+	AddedFiles   []string `json:"addedFiles,omitempty"`
+	RemovedFiles []string `json:"removedFiles,omitempty"`
+	// SizeDelta is the change in the installed size of all packages, in bytes.
+	SizeDelta int64 `json:"sizeDelta"`
+
+	// sizes is set when the sizes of both sides are known, i.e. neither is
+	// a lockfile.
+	sizes bool
+}
+
+// Compare reports how the packages in b differ from those in a.
+func Compare(a, b []Package) Report {
+	var r Report
+
+	before := make(map[string]Package, len(a))
+	for _, p := range a {
+		before[p.Name] = p
+	}
+	after := make(map[string]Package, len(b))
+	for _, p := range b {
+		after[p.Name] = p
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		to := after[name]
+		from, ok := before[name]
+		if !ok {
+			r.Added = append(r.Added, PackageChange{Name: name, To: to.Version, SizeDelta: int64(to.Size)}) //nolint:gosec
+			continue
+		}
+		if from.Version == to.Version {
+			continue
+		}
+		c := PackageChange{Name: name, From: from.Version, To: to.Version, SizeDelta: int64(to.Size) - int64(from.Size)} //nolint:gosec
+		if apk.CompareVersionStrings(from.Version, to.Version) > 0 {
+			r.Downgraded = append(r.Downgraded, c)
+		} else {
+			r.Upgraded = append(r.Upgraded, c)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[name]; ok {
+			continue
+		}
+		from := before[name]
+		r.Removed = append(r.Removed, PackageChange{Name: name, From: from.Version, SizeDelta: -int64(from.Size)}) //nolint:gosec
+	}
+
+	r.sizes = hasSizes(a) && hasSizes(b)
+	for _, c := range slices.Concat(r.Added, r.Removed, r.Upgraded, r.Downgraded) {
+		r.SizeDelta += c.SizeDelta
+	}
+
+	if hasFiles(a) && hasFiles(b) {
+		beforeFiles, afterFiles := files(a), files(b)
+		for _, f := range slices.Sorted(maps.Keys(afterFiles)) {
+			if _, ok := beforeFiles[f]; !ok {
+				r.AddedFiles = append(r.AddedFiles, f)
+			}
+		}
+		for _, f := range slices.Sorted(maps.Keys(beforeFiles)) {
+			if _, ok := afterFiles[f]; !ok {
+				r.RemovedFiles = append(r.RemovedFiles, f)
+			}
+		}
+	}
+
+	return r
+}
+
+func hasSizes(pkgs []Package) bool {
+	return slices.ContainsFunc(pkgs, func(p Package) bool { return p.Size != 0 })
+}
+
+func hasFiles(pkgs []Package) bool {
+	return slices.ContainsFunc(pkgs, func(p Package) bool { return len(p.Files) != 0 })
+}
+
+func files(pkgs []Package) map[string]struct{} {
+	out := map[string]struct{}{}
+	for _, p := range pkgs {
+		for _, f := range p.Files {
+			out[f] = struct{}{}
+		}
+	}
+	return out
+}
+
+// Empty returns true if there are no differences.
+func (r Report) Empty() bool {
+	return len(r.Added)+len(r.Removed)+len(r.Upgraded)+len(r.Downgraded)+len(r.AddedFiles)+len(r.RemovedFiles) == 0
+}
+
+// WriteJSON writes the report as JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a human readable form.
+func (r Report) WriteText(w io.Writer) error {
+	if r.Empty() {
+		_, err := fmt.Fprintln(w, "no differences")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, changes := range []struct {
+		kind    string
+		changes []PackageChange
+	}{
+		{"added", r.Added},
+		{"removed", r.Removed},
+		{"upgraded", r.Upgraded},
+		{"downgraded", r.Downgraded},
+	} {
+		for _, c := range changes.changes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s", changes.kind, c.Name, orNone(c.From), orNone(c.To))
+			if r.sizes {
+				fmt.Fprintf(tw, "\t%s", formatSize(c.SizeDelta))
+			}
+			fmt.Fprintln(tw)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(r.AddedFiles)+len(r.RemovedFiles) != 0 {
+		fmt.Fprintf(w, "\nfiles: %d added, %d removed\n", len(r.AddedFiles), len(r.RemovedFiles))
+		for _, f := range r.AddedFiles {
+			fmt.Fprintf(w, "+ /%s\n", f)
+		}
+		for _, f := range r.RemovedFiles {
+			fmt.Fprintf(w, "- /%s\n", f)
+		}
+	}
+
+	if r.sizes {
+		fmt.Fprintf(w, "\ntotal size: %s\n", formatSize(r.SizeDelta))
+	}
+	return nil
+}
+
+func orNone(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
+
+// formatSize formats a size delta in bytes with a sign.
+func formatSize(delta int64) string {
+	if delta >= 0 {
+		return fmt.Sprintf("+%d B", delta)
+	}
+	return fmt.Sprintf("%d B", delta)
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+func TestCompare(t *testing.T) {
+	before := []Package{
+		{Name: "busybox", Version: "1.36.1-r5", Size: 900, Files: []string{"bin/busybox"}},
+		{Name: "openssl", Version: "3.2.0-r0", Size: 500, Files: []string{"usr/lib/libssl.so.3"}},
+		{Name: "zlib", Version: "1.3-r2", Size: 100, Files: []string{"lib/libz.so.1"}},
+	}
+	after := []Package{
+		{Name: "busybox", Version: "1.36.1-r5", Size: 900, Files: []string{"bin/busybox"}},
+		{Name: "openssl", Version: "3.1.4-r0", Size: 450, Files: []string{"usr/lib/libssl.so.3"}},
+		{Name: "zlib", Version: "1.3.1-r0", Size: 120, Files: []string{"lib/libz.so.1"}},
+		{Name: "curl", Version: "8.5.0-r0", Size: 300, Files: []string{"usr/bin/curl"}},
+	}
+
+	r := Compare(before, after)
+	require.Equal(t, []PackageChange{{Name: "curl", To: "8.5.0-r0", SizeDelta: 300}}, r.Added)
+	require.Empty(t, r.Removed)
+	require.Equal(t, []PackageChange{{Name: "zlib", From: "1.3-r2", To: "1.3.1-r0", SizeDelta: 20}}, r.Upgraded)
+	require.Equal(t, []PackageChange{{Name: "openssl", From: "3.2.0-r0", To: "3.1.4-r0", SizeDelta: -50}}, r.Downgraded)
+	require.Equal(t, []string{"usr/bin/curl"}, r.AddedFiles)
+	require.Empty(t, r.RemovedFiles)
+	require.Equal(t, int64(270), r.SizeDelta)
+
+	r = Compare(after, before)
+	require.Equal(t, []PackageChange{{Name: "curl", From: "8.5.0-r0", SizeDelta: -300}}, r.Removed)
+	require.Equal(t, []string{"usr/bin/curl"}, r.RemovedFiles)
+
+	require.True(t, Compare(before, before).Empty())
+}
+
+func TestWriteText(t *testing.T) {
+	l := lock.Lock{Contents: lock.LockContents{Packages: []lock.LockPkg{
+		{Name: "busybox", Version: "1.36.1-r5", Architecture: "x86_64"},
+		{Name: "busybox", Version: "1.36.1-r5", Architecture: "aarch64"},
+		{Name: "zlib", Version: "1.3-r2", Architecture: "x86_64"},
+	}}}
+	installed := []Package{
+		{Name: "busybox", Version: "1.36.1-r6", Size: 900, Files: []string{"bin/busybox"}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, Compare(FromLock(l, types.ParseArchitecture("amd64")), installed).WriteText(&buf))
+	require.Equal(t, `removed   zlib     1.3-r2     (none)
+upgraded  busybox  1.36.1-r5  1.36.1-r6
+`, buf.String())
+}
@@ -0,0 +1,48 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"context"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// Load returns the packages of src for an architecture. The source may be a
+// lockfile, a directory containing an OCI layout, or an image reference.
+func Load(ctx context.Context, src string, arch types.Architecture, opts ...remote.Option) ([]Package, error) {
+	if fi, err := os.Stat(src); err == nil && !fi.IsDir() {
+		l, err := lock.FromFile(src)
+		if err != nil {
+			return nil, err
+		}
+		return FromLock(l, arch), nil
+	}
+
+	img, err := oci.ReadImage(ctx, src, arch, opts...)
+	if err != nil {
+		return nil, err
+	}
+	installed, err := oci.InstalledPackages(img)
+	if err != nil {
+		return nil, err
+	}
+	return FromInstalled(installed), nil
+}
@@ -0,0 +1,310 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diskimage writes the root filesystem of an image as an ext4 or
+// erofs filesystem image, which virtual machines like firecracker or
+// cloud-hypervisor can boot from as a block device.
+package diskimage
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// The formats of filesystem images.
+const (
+	FormatExt4  = "ext4"
+	FormatErofs = "erofs"
+)
+
+// Formats are the supported formats.
+var Formats = []string{FormatExt4, FormatErofs}
+
+// The type bits of unix file modes.
+const (
+	modeType = 0o170000
+	modeDir  = 0o040000
+	modeReg  = 0o100000
+	modeLink = 0o120000
+	modeChr  = 0o020000
+	modeBlk  = 0o060000
+	modeFifo = 0o010000
+)
+
+// FromLayer writes the files of layer to dest as a filesystem image of
+// format, sized to fit them.
+//
+// Inodes are numbered and data laid out in the order of the sorted paths,
+// with the identifiers of the filesystem derived from the digest of layer
+// and its times from those of the files, so the same layer always gives
+// the same image.
+func FromLayer(layer v1.Layer, format string, dest io.WriterAt) error {
+	var write func(*tree, io.WriterAt) error
+	switch format {
+	case FormatExt4:
+		write = writeExt4
+	case FormatErofs:
+		write = writeErofs
+	default:
+		return fmt.Errorf("unsupported filesystem format %q, must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+
+	digest, err := layer.Digest()
+	if err != nil {
+		return err
+	}
+	spool, err := os.CreateTemp("", "apko-diskimage-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	t, err := readTree(layer, spool)
+	if err != nil {
+		return err
+	}
+	if _, err := hex.Decode(t.uuid[:], []byte(digest.Hex[:32])); err != nil {
+		return fmt.Errorf("parsing digest %s: %w", digest, err)
+	}
+	// Mark the identifier as a random (version 4) UUID.
+	t.uuid[6] = t.uuid[6]&0x0f | 0x40
+	t.uuid[8] = t.uuid[8]&0x3f | 0x80
+	return write(t, dest)
+}
+
+// tree is the root filesystem of a layer.
+type tree struct {
+	root *node
+	// The contents of the regular files, at their offsets.
+	spool io.ReaderAt
+	uuid  [16]byte
+}
+
+// node is a file, which may be linked to by several entries.
+type node struct {
+	mode     uint32
+	uid, gid uint32
+	mtime    time.Time
+	xattrs   map[string][]byte
+
+	// The size and the offset in the spool of a regular file.
+	size   int64
+	offset int64
+	// The target of a symbolic link.
+	target string
+	// The device numbers of a device.
+	major, minor uint32
+	// The entries of a directory.
+	entries []entry
+
+	nlink uint32
+	// The inode number, assigned by the writer of the format.
+	ino uint64
+}
+
+// entry is a named link to a node in a directory.
+type entry struct {
+	name string
+	node *node
+}
+
+func (n *node) isDir() bool { return n.mode&modeType == modeDir }
+
+// lookup returns the node of the entry of directory n named name.
+func (n *node) lookup(name string) *node {
+	if i, ok := slices.BinarySearchFunc(n.entries, name, compareEntry); ok {
+		return n.entries[i].node
+	}
+	return nil
+}
+
+// link adds an entry named name to directory n, in the order of names.
+func (n *node) link(name string, child *node) {
+	i, ok := slices.BinarySearchFunc(n.entries, name, compareEntry)
+	if ok {
+		n.entries[i].node = child
+		return
+	}
+	n.entries = slices.Insert(n.entries, i, entry{name: name, node: child})
+}
+
+func compareEntry(e entry, name string) int { return strings.Compare(e.name, name) }
+
+// readTree reads the files of layer, writing the contents of the regular
+// files to spool.
+func readTree(layer v1.Layer, spool *os.File) (*tree, error) {
+	u, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer u.Close()
+
+	t := &tree{
+		root:  &node{mode: modeDir | 0o755},
+		spool: spool,
+	}
+	// The nodes of the regular files, by name, for hard links to them.
+	files := map[string]*node{}
+	var offset int64
+
+	tr := tar.NewReader(u)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar entry: %w", err)
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+
+		n := &node{
+			mode:  uint32(header.Mode) & 0o7777, //nolint:gosec
+			uid:   uint32(header.Uid),           //nolint:gosec
+			gid:   uint32(header.Gid),           //nolint:gosec
+			mtime: header.ModTime,
+		}
+		for k, v := range header.PAXRecords {
+			if attr, ok := strings.CutPrefix(k, "SCHILY.xattr."); ok {
+				if n.xattrs == nil {
+					n.xattrs = map[string][]byte{}
+				}
+				n.xattrs[attr] = []byte(v)
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			n.mode |= modeDir
+			if name == "." {
+				n.entries = t.root.entries
+				t.root = n
+				continue
+			}
+		case tar.TypeReg:
+			n.mode |= modeReg
+			n.offset = offset
+			n.size, err = io.Copy(io.NewOffsetWriter(spool, offset), tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading content of %s: %w", header.Name, err)
+			}
+			offset += n.size
+			files[name] = n
+		case tar.TypeLink:
+			target, ok := files[path.Clean(strings.TrimPrefix(header.Linkname, "/"))]
+			if !ok {
+				return nil, fmt.Errorf("hard link %s to %s, which is not a regular file before it", header.Name, header.Linkname)
+			}
+			files[name] = target
+			n = target
+		case tar.TypeSymlink:
+			n.mode |= modeLink
+			n.target = header.Linkname
+		case tar.TypeChar, tar.TypeBlock:
+			n.mode |= modeChr
+			if header.Typeflag == tar.TypeBlock {
+				n.mode = n.mode&^modeType | modeBlk
+			}
+			n.major, n.minor = uint32(header.Devmajor), uint32(header.Devminor) //nolint:gosec
+		case tar.TypeFifo:
+			n.mode |= modeFifo
+		default:
+			continue
+		}
+
+		parent := t.mkdirAll(path.Dir(name))
+		if existing := parent.lookup(path.Base(name)); existing != nil && existing.isDir() && n.isDir() {
+			// A directory listed again keeps its entries.
+			n.entries = existing.entries
+		}
+		parent.link(path.Base(name), n)
+	}
+
+	t.countLinks()
+	return t, nil
+}
+
+// mkdirAll returns the directory named dir, creating it and its parents
+// when the layer has no entries for them.
+func (t *tree) mkdirAll(dir string) *node {
+	if dir == "." {
+		return t.root
+	}
+	parent := t.mkdirAll(path.Dir(dir))
+	n := parent.lookup(path.Base(dir))
+	if n == nil || !n.isDir() {
+		n = &node{mode: modeDir | 0o755, mtime: t.root.mtime}
+		parent.link(path.Base(dir), n)
+	}
+	return n
+}
+
+// countLinks sets the number of links to each node: the entries linking
+// to it, and for directories their own "." entry and the ".." entries of
+// their subdirectories.
+func (t *tree) countLinks() {
+	t.root.nlink = 2
+	t.walk(func(n *node) {
+		for _, e := range n.entries {
+			if e.node.isDir() {
+				n.nlink++
+				e.node.nlink += 2
+			} else {
+				e.node.nlink++
+			}
+		}
+	})
+}
+
+// walk calls fn for every node of t once, directories before their
+// entries, in the order of their paths.
+func (t *tree) walk(fn func(*node)) {
+	seen := map[*node]bool{}
+	var visit func(*node)
+	visit = func(n *node) {
+		if seen[n] {
+			return
+		}
+		seen[n] = true
+		fn(n)
+		for _, e := range n.entries {
+			visit(e.node)
+		}
+	}
+	visit(t.root)
+}
+
+// parents returns the directory linking to each directory of t, the root
+// being its own parent.
+func (t *tree) parents() map[*node]*node {
+	parents := map[*node]*node{t.root: t.root}
+	t.walk(func(n *node) {
+		for _, e := range n.entries {
+			if e.node.isDir() {
+				parents[e.node] = n
+			}
+		}
+	})
+	return parents
+}
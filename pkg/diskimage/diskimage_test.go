@@ -0,0 +1,207 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+func testLayer(t *testing.T, extra ...tar.Header) v1.Layer {
+	t.Helper()
+	mtime := time.Unix(1700000000, 0)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	files := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "bin", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "bin/busybox", Mode: 0o755}, data: strings.Repeat("busybox", 1000)},
+		{hdr: tar.Header{Typeflag: tar.TypeLink, Name: "bin/sh", Linkname: "bin/busybox", Mode: 0o755}},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "bin/ls", Linkname: "busybox", Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "bin/far", Linkname: strings.Repeat("../", 30) + "bin/busybox", Mode: 0o777}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "bin/ping", Mode: 0o4755, PAXRecords: map[string]string{
+			"SCHILY.xattr.security.capability": "\x01\x00\x00\x02\x00\x20\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00",
+		}}, data: "ping"},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "etc/os-release", Mode: 0o644}, data: "ID=wolfi\n"},
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "home/nonroot", Mode: 0o700, Uid: 65532, Gid: 65532}},
+		{hdr: tar.Header{Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0o666, Devmajor: 1, Devminor: 3}},
+		{hdr: tar.Header{Typeflag: tar.TypeFifo, Name: "run/initctl", Mode: 0o600}},
+	}
+	// Enough entries for a directory of several blocks.
+	for i := range 400 {
+		files = append(files, struct {
+			hdr  tar.Header
+			data string
+		}{hdr: tar.Header{Typeflag: tar.TypeReg, Name: fmt.Sprintf("usr/share/zoneinfo/%s-%03d", strings.Repeat("z", 40), i), Mode: 0o644}, data: "TZif"})
+	}
+	for _, hdr := range extra {
+		files = append(files, struct {
+			hdr  tar.Header
+			data string
+		}{hdr: hdr})
+	}
+	for _, f := range files {
+		f.hdr.ModTime = mtime
+		f.hdr.Size = int64(len(f.data))
+		require.NoError(t, tw.WriteHeader(&f.hdr))
+		_, err := tw.Write([]byte(f.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	data := buf.Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	require.NoError(t, err)
+	return layer
+}
+
+func TestReadTree(t *testing.T) {
+	spool, err := os.CreateTemp(t.TempDir(), "spool")
+	require.NoError(t, err)
+	defer spool.Close()
+
+	tr, err := readTree(testLayer(t), spool)
+	require.NoError(t, err)
+
+	// Missing parent directories are created.
+	home := tr.root.lookup("home")
+	require.NotNil(t, home)
+	require.Equal(t, uint32(modeDir|0o755), home.mode)
+	nonroot := home.lookup("nonroot")
+	require.Equal(t, uint32(modeDir|0o700), nonroot.mode)
+	require.Equal(t, uint32(65532), nonroot.uid)
+
+	// Hard links share their node.
+	bin := tr.root.lookup("bin")
+	busybox := bin.lookup("busybox")
+	require.Same(t, busybox, bin.lookup("sh"))
+	require.Equal(t, uint32(2), busybox.nlink)
+	require.Equal(t, int64(7000), busybox.size)
+
+	// Directories count their own entry, "." and their subdirectories.
+	require.Equal(t, uint32(8), tr.root.nlink)
+	require.Equal(t, uint32(3), home.nlink)
+
+	ping := bin.lookup("ping")
+	require.Equal(t, uint32(modeReg|0o4755), ping.mode)
+	require.Len(t, ping.xattrs["security.capability"], 20)
+
+	null := tr.root.lookup("dev").lookup("null")
+	require.Equal(t, uint32(modeChr|0o666), null.mode)
+	require.Equal(t, []uint32{1, 3}, []uint32{null.major, null.minor})
+
+	var names []string
+	for _, e := range bin.entries {
+		names = append(names, e.name)
+	}
+	require.Equal(t, []string{"busybox", "far", "ls", "ping", "sh"}, names)
+}
+
+func TestFromLayer(t *testing.T) {
+	for _, tt := range []struct {
+		format string
+		magic  func([]byte) bool
+	}{{
+		format: FormatExt4,
+		magic:  func(b []byte) bool { return binary.LittleEndian.Uint16(b[1024+56:]) == 0xef53 },
+	}, {
+		format: FormatErofs,
+		magic:  func(b []byte) bool { return binary.LittleEndian.Uint32(b[1024:]) == erofsMagic },
+	}} {
+		t.Run(tt.format, func(t *testing.T) {
+			layer := testLayer(t)
+			var images [][]byte
+			for i := range 2 {
+				p := filepath.Join(t.TempDir(), fmt.Sprintf("%d.%s", i, tt.format))
+				f, err := os.Create(p)
+				require.NoError(t, err)
+				require.NoError(t, FromLayer(layer, tt.format, f))
+				require.NoError(t, f.Close())
+
+				b, err := os.ReadFile(p)
+				require.NoError(t, err)
+				require.True(t, tt.magic(b))
+				require.Zero(t, len(b)%4096)
+				images = append(images, b)
+
+				if fsck, err := exec.LookPath("fsck." + tt.format); err == nil {
+					out, err := exec.Command(fsck, "-fn", p).CombinedOutput()
+					require.NoError(t, err, string(out))
+				}
+			}
+
+			// The same layer gives the same image.
+			require.Equal(t, images[0], images[1])
+		})
+	}
+}
+
+func TestFromLayerErrors(t *testing.T) {
+	dest, err := os.Create(filepath.Join(t.TempDir(), "image"))
+	require.NoError(t, err)
+	defer dest.Close()
+
+	require.ErrorContains(t, FromLayer(testLayer(t), "btrfs", dest), `unsupported filesystem format "btrfs"`)
+
+	acl := testLayer(t, tar.Header{Typeflag: tar.TypeDir, Name: "srv", Mode: 0o755, PAXRecords: map[string]string{
+		"SCHILY.xattr.system.posix_acl_access": "\x02\x00\x00\x00",
+	}})
+	for _, format := range Formats {
+		require.ErrorContains(t, FromLayer(acl, format, dest), "unsupported extended attribute system.posix_acl_access")
+	}
+}
+
+func TestErofsDirectory(t *testing.T) {
+	dir := &node{mode: modeDir | 0o755}
+	for i := range 200 {
+		dir.link(fmt.Sprintf("%s%03d", strings.Repeat("f", 50), i), &node{mode: modeReg | 0o644})
+	}
+	dir.link("-", &node{mode: modeReg | 0o644})
+
+	blocks, size := erofsDirectory(dir, dir)
+	require.Len(t, blocks, 4)
+	// The entries are sorted by name across the blocks, with "." and "..".
+	require.Equal(t, []string{"-", ".", ".."}, []string{blocks[0][0].name, blocks[0][1].name, blocks[0][2].name})
+	var count int
+	for _, entries := range blocks {
+		used := 0
+		for _, e := range entries {
+			used += erofsDirentSize + len(e.name)
+		}
+		require.LessOrEqual(t, used, erofsBlockSize)
+		count += len(entries)
+	}
+	require.Equal(t, 203, count)
+	last := blocks[len(blocks)-1]
+	require.Equal(t, 3*erofsBlockSize+len(last)*(erofsDirentSize+53), size)
+}
@@ -0,0 +1,281 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// The layout of erofs images: 4KiB blocks, with the superblock followed by
+// the extended inodes, each with its extended attributes and the tail of
+// its data which does not fill a block, and then the blocks of data.
+const (
+	erofsBlockSize      = 4096
+	erofsBlockSizeBits  = 12
+	erofsMagic          = 0xe0f5e1e2
+	erofsSuperblockOff  = 1024
+	erofsSuperblockSize = 128
+	erofsInodeSize      = 64
+	erofsDirentSize     = 12
+	erofsSlotSize       = 32
+
+	erofsLayoutFlatPlain  = 0
+	erofsLayoutFlatInline = 2
+)
+
+// erofsInode is where a node goes in an erofs image.
+type erofsInode struct {
+	node   *node
+	offset int // of the inode in the image
+	layout int
+	size   int
+	xattrs []byte
+	// The first block of the data, and the number of its full blocks
+	// outside the inode.
+	block, blocks int
+	// The entries of a directory, in the blocks they go in.
+	dirBlocks [][]entry
+}
+
+// metaSize returns the size of the inode, its extended attributes and
+// the inline tail of its data.
+func (i *erofsInode) metaSize() int {
+	size := erofsInodeSize + len(i.xattrs)
+	if i.layout == erofsLayoutFlatInline {
+		size += i.size % erofsBlockSize
+	}
+	return size
+}
+
+func (i *erofsInode) nid() uint64 { return uint64(i.offset / erofsSlotSize) } //nolint:gosec
+
+func writeErofs(t *tree, dest io.WriterAt) error {
+	parents := t.parents()
+	var inodes []*erofsInode
+	byNode := map[*node]*erofsInode{}
+	var err error
+	t.walk(func(n *node) {
+		i := &erofsInode{node: n}
+		n.ino = uint64(len(inodes) + 1)
+		switch n.mode & modeType {
+		case modeReg:
+			i.size = int(n.size)
+		case modeLink:
+			i.size = len(n.target)
+		case modeDir:
+			i.dirBlocks, i.size = erofsDirectory(n, parents[n])
+		}
+		xattrs, xerr := erofsXattrs(n.xattrs)
+		if xerr != nil && err == nil {
+			err = fmt.Errorf("inode %d: %w", n.ino, xerr)
+		}
+		i.xattrs = xattrs
+		inodes = append(inodes, i)
+		byNode[n] = i
+	})
+	if err != nil {
+		return err
+	}
+
+	// Lay out the inodes, keeping each with its inline tail within a
+	// block, and then the blocks of data.
+	offset := erofsSuperblockOff + erofsSuperblockSize
+	for _, i := range inodes {
+		tail := i.size % erofsBlockSize
+		i.layout = erofsLayoutFlatPlain
+		if tail != 0 && erofsInodeSize+len(i.xattrs)+tail <= erofsBlockSize {
+			i.layout = erofsLayoutFlatInline
+		}
+		size := i.metaSize()
+		if size <= erofsBlockSize && offset%erofsBlockSize+size > erofsBlockSize {
+			offset = (offset + erofsBlockSize - 1) &^ (erofsBlockSize - 1)
+		}
+		i.offset = offset
+		offset = (offset + size + erofsSlotSize - 1) &^ (erofsSlotSize - 1)
+	}
+	if root := inodes[0]; root.nid() > 0xffff {
+		return fmt.Errorf("root inode at %d is out of reach", root.offset)
+	}
+	meta := make([]byte, offset)
+	block := (offset + erofsBlockSize - 1) / erofsBlockSize
+	for _, i := range inodes {
+		i.blocks = i.size / erofsBlockSize
+		if i.layout == erofsLayoutFlatPlain {
+			i.blocks = (i.size + erofsBlockSize - 1) / erofsBlockSize
+		}
+		if i.blocks > 0 {
+			i.block = block
+			block += i.blocks
+		}
+	}
+
+	if _, err := dest.WriteAt([]byte{0}, int64(block)*erofsBlockSize-1); err != nil {
+		return err
+	}
+	for _, i := range inodes {
+		data, err := i.data(byNode, t.spool)
+		if err != nil {
+			return err
+		}
+		if i.blocks > 0 {
+			w := io.NewOffsetWriter(dest, int64(i.block)*erofsBlockSize)
+			if _, err := io.CopyN(w, data, int64(min(i.blocks*erofsBlockSize, i.size))); err != nil {
+				return err
+			}
+		}
+		b := meta[i.offset:]
+		i.put(b)
+		if i.layout == erofsLayoutFlatInline {
+			if _, err := io.ReadFull(data, b[erofsInodeSize+len(i.xattrs):i.metaSize()]); err != nil {
+				return err
+			}
+		}
+	}
+
+	sb := meta[erofsSuperblockOff:]
+	le := binary.LittleEndian
+	le.PutUint32(sb[0:], erofsMagic)
+	sb[12] = erofsBlockSizeBits
+	le.PutUint16(sb[14:], uint16(inodes[0].nid()))             //nolint:gosec
+	le.PutUint64(sb[16:], uint64(len(inodes)))                 //nolint:gosec
+	le.PutUint64(sb[24:], uint64(max(t.root.mtime.Unix(), 0))) //nolint:gosec
+	le.PutUint32(sb[32:], uint32(t.root.mtime.Nanosecond()))   //nolint:gosec
+	le.PutUint32(sb[36:], uint32(block))                       //nolint:gosec
+	copy(sb[48:], t.uuid[:])
+	_, err = dest.WriteAt(meta, 0)
+	return err
+}
+
+// put writes the extended inode of i followed by its extended attributes
+// to b.
+func (i *erofsInode) put(b []byte) {
+	n := i.node
+	le := binary.LittleEndian
+	le.PutUint16(b[0:], uint16(1|i.layout<<1)) //nolint:gosec
+	if len(i.xattrs) > 0 {
+		le.PutUint16(b[2:], uint16(1+(len(i.xattrs)-12)/4)) //nolint:gosec
+	}
+	le.PutUint16(b[4:], uint16(n.mode)) //nolint:gosec
+	le.PutUint64(b[8:], uint64(i.size)) //nolint:gosec
+	switch n.mode & modeType {
+	case modeChr, modeBlk:
+		le.PutUint32(b[16:], n.minor&0xff|n.major<<8|(n.minor&^0xff)<<12)
+	default:
+		le.PutUint32(b[16:], uint32(i.block)) //nolint:gosec
+	}
+	le.PutUint32(b[20:], uint32(n.ino)) //nolint:gosec
+	le.PutUint32(b[24:], n.uid)
+	le.PutUint32(b[28:], n.gid)
+	le.PutUint64(b[32:], uint64(n.mtime.Unix()))       //nolint:gosec
+	le.PutUint32(b[40:], uint32(n.mtime.Nanosecond())) //nolint:gosec
+	le.PutUint32(b[44:], n.nlink)
+	copy(b[erofsInodeSize:], i.xattrs)
+}
+
+// data returns a reader of the data of i.
+func (i *erofsInode) data(inodes map[*node]*erofsInode, spool io.ReaderAt) (io.Reader, error) {
+	n := i.node
+	switch n.mode & modeType {
+	case modeReg:
+		return io.NewSectionReader(spool, n.offset, n.size), nil
+	case modeLink:
+		return strings.NewReader(n.target), nil
+	case modeDir:
+		var b []byte
+		for _, entries := range i.dirBlocks {
+			block := make([]byte, erofsBlockSize)
+			nameOff := erofsDirentSize * len(entries)
+			for j, e := range entries {
+				d := block[erofsDirentSize*j:]
+				binary.LittleEndian.PutUint64(d[0:], inodes[e.node].nid())
+				binary.LittleEndian.PutUint16(d[8:], uint16(nameOff)) //nolint:gosec
+				d[10] = fileType(e.node.mode)
+				nameOff += copy(block[nameOff:], e.name)
+			}
+			b = append(b, block...)
+		}
+		return strings.NewReader(string(b[:i.size])), nil
+	}
+	return strings.NewReader(""), nil
+}
+
+// erofsDirectory returns the entries of directory n with parent, sorted
+// by name and split into the blocks they fit in, and its size, which ends
+// after the last name.
+func erofsDirectory(n, parent *node) ([][]entry, int) {
+	entries := append([]entry{{".", n}, {"..", parent}}, n.entries...)
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.name, b.name) })
+
+	var blocks [][]entry
+	used := erofsBlockSize
+	for _, e := range entries {
+		size := erofsDirentSize + len(e.name)
+		if used+size > erofsBlockSize {
+			blocks = append(blocks, nil)
+			used = 0
+		}
+		blocks[len(blocks)-1] = append(blocks[len(blocks)-1], e)
+		used += size
+	}
+	return blocks, (len(blocks)-1)*erofsBlockSize + used
+}
+
+// erofsXattrPrefixes are the name indexes of the prefixes of extended
+// attribute names.
+var erofsXattrPrefixes = []struct {
+	prefix string
+	index  byte
+}{
+	{"user.", 1},
+	{"trusted.", 4},
+	{"security.", 6},
+}
+
+// erofsXattrs returns the extended attributes xattrs as stored after an
+// inode: a header followed by the entries, sorted by name.
+func erofsXattrs(xattrs map[string][]byte) ([]byte, error) {
+	if len(xattrs) == 0 {
+		return nil, nil
+	}
+	names := slices.Sorted(maps.Keys(xattrs))
+	b := make([]byte, 12)
+	for _, name := range names {
+		i := slices.IndexFunc(erofsXattrPrefixes, func(p struct {
+			prefix string
+			index  byte
+		}) bool {
+			return strings.HasPrefix(name, p.prefix)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("unsupported extended attribute %s", name)
+		}
+		p := erofsXattrPrefixes[i]
+		suffix, value := name[len(p.prefix):], xattrs[name]
+		if len(suffix) > 255 || len(value) > 0xffff {
+			return nil, fmt.Errorf("extended attribute %s is too long", name)
+		}
+		e := []byte{byte(len(suffix)), p.index, 0, 0}
+		binary.LittleEndian.PutUint16(e[2:], uint16(len(value))) //nolint:gosec
+		e = append(append(e, suffix...), value...)
+		b = append(b, e...)
+		b = append(b, make([]byte, (4-len(e)%4)%4)...)
+	}
+	return b, nil
+}
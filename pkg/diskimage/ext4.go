@@ -0,0 +1,691 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskimage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The geometry of ext4 images: 4KiB blocks, in groups of as many blocks
+// as a block bitmap covers, with 256 byte inodes leaving room for extended
+// attributes after the 32 bytes of extra fields.
+const (
+	ext4BlockSize      = 4096
+	ext4BlocksPerGroup = 8 * ext4BlockSize
+	ext4InodeSize      = 256
+	ext4ExtraIsize     = 32
+	ext4DescSize       = 32
+
+	ext4RootIno      = 2
+	ext4LostFoundIno = 11
+)
+
+// The features of ext4 images, which leave out the journal and checksums
+// since the images are built once and then mostly read.
+const (
+	ext4CompatExtAttr      = 0x8
+	ext4IncompatFiletype   = 0x2
+	ext4IncompatExtents    = 0x40
+	ext4RoCompatSparse     = 0x1
+	ext4RoCompatLargeFile  = 0x2
+	ext4RoCompatDirNlink   = 0x20
+	ext4RoCompatExtraIsize = 0x40
+
+	ext4ExtentsFlag  = 0x80000
+	ext4ExtentMagic  = 0xf30a
+	ext4XattrMagic   = 0xea020000
+	ext4SignedHash   = 0x1
+	ext4HashHalfMD4  = 1
+	ext4MaxLinks     = 65000
+	ext4FastSymlink  = 60
+	ext4LeafExtents  = (ext4BlockSize - 12) / 12
+	ext4InodeExtents = 4
+)
+
+// ext4Layout is where the files of a tree go in an ext4 image.
+type ext4Layout struct {
+	t      *tree
+	inodes []*node // by inode number - 1
+	// The directories linking to each directory.
+	parents map[*node]*node
+	groups  int
+	// The number of inodes per group, and of blocks of their tables.
+	inodesPerGroup int
+	inodeTableBlks int
+	gdtBlocks      int
+	blocks         int
+	// The blocks in use, and the next one to allocate.
+	used []bool
+	next int
+	// The contents of the directories.
+	dirBlocks map[*node][]byte
+	// The data blocks of the files, the extent tree leaves listing them
+	// when the inode cannot, and the number of blocks of both.
+	extents      map[*node][]ext4Extent
+	leaves       map[*node][]int
+	extentBlocks map[*node]int
+	dirsPerGroup []int
+}
+
+// ext4Extent is a run of blocks of a file.
+type ext4Extent struct {
+	logical, start, length int
+}
+
+func writeExt4(t *tree, dest io.WriterAt) error {
+	l := &ext4Layout{
+		t:            t,
+		dirBlocks:    map[*node][]byte{},
+		extents:      map[*node][]ext4Extent{},
+		leaves:       map[*node][]int{},
+		extentBlocks: map[*node]int{},
+	}
+	if err := l.numberInodes(); err != nil {
+		return err
+	}
+	data := 0
+	for _, n := range l.inodes[ext4RootIno-1:] {
+		if n == nil {
+			continue
+		}
+		if n.isDir() {
+			b, err := l.directory(n)
+			if err != nil {
+				return err
+			}
+			l.dirBlocks[n] = b
+		}
+		data += l.dataBlocks(n)
+	}
+	l.plan(data)
+	if err := l.allocate(); err != nil {
+		return err
+	}
+	return l.write(dest)
+}
+
+// numberInodes numbers the inodes after the reserved ones in the order of
+// the paths, giving the root and lost+found their well-known numbers.
+func (l *ext4Layout) numberInodes() error {
+	root := l.t.root
+	lostFound := root.lookup("lost+found")
+	if lostFound == nil || !lostFound.isDir() {
+		lostFound = &node{mode: modeDir | 0o700, mtime: root.mtime, nlink: 2}
+		root.link("lost+found", lostFound)
+		root.nlink++
+	}
+	l.inodes = make([]*node, ext4LostFoundIno)
+	l.parents = l.t.parents()
+	root.ino = ext4RootIno
+	l.inodes[ext4RootIno-1] = root
+	lostFound.ino = ext4LostFoundIno
+	l.inodes[ext4LostFoundIno-1] = lostFound
+	var err error
+	l.t.walk(func(n *node) {
+		if n.ino != 0 {
+			return
+		}
+		if n.nlink > ext4MaxLinks && !n.isDir() {
+			err = fmt.Errorf("file with %d links, more than ext4 allows", n.nlink)
+		}
+		l.inodes = append(l.inodes, n)
+		n.ino = uint64(len(l.inodes))
+	})
+	return err
+}
+
+// dataBlocks returns the number of data blocks of n.
+func (l *ext4Layout) dataBlocks(n *node) int {
+	switch n.mode & modeType {
+	case modeDir:
+		return len(l.dirBlocks[n]) / ext4BlockSize
+	case modeReg:
+		return int((n.size + ext4BlockSize - 1) / ext4BlockSize)
+	case modeLink:
+		if len(n.target) >= ext4FastSymlink {
+			return 1
+		}
+	}
+	return 0
+}
+
+// directory returns the blocks of the linear directory n.
+func (l *ext4Layout) directory(n *node) ([]byte, error) {
+	entries := append([]entry{{".", n}, {"..", l.parents[n]}}, n.entries...)
+
+	b := make([]byte, ext4BlockSize)
+	block, off := 0, 0
+	last := -1 // the offset of the last entry
+	for _, e := range entries {
+		if len(e.name) > 255 {
+			return nil, fmt.Errorf("name %s is longer than 255 bytes", e.name)
+		}
+		size := 8 + (len(e.name)+3)&^3
+		if off+size > ext4BlockSize {
+			// The last entry of a block spans up to its end.
+			binary.LittleEndian.PutUint16(b[last+4:], uint16(block+ext4BlockSize-last)) //nolint:gosec
+			b = append(b, make([]byte, ext4BlockSize)...)
+			block, off = block+ext4BlockSize, 0
+		}
+		last = block + off
+		binary.LittleEndian.PutUint32(b[last:], uint32(e.node.ino)) //nolint:gosec
+		binary.LittleEndian.PutUint16(b[last+4:], uint16(size))     //nolint:gosec
+		b[last+6] = byte(len(e.name))
+		b[last+7] = fileType(e.node.mode)
+		copy(b[last+8:], e.name)
+		off += size
+	}
+	binary.LittleEndian.PutUint16(b[last+4:], uint16(block+ext4BlockSize-last)) //nolint:gosec
+	return b, nil
+}
+
+// fileType returns the type of a directory entry for a file of mode.
+func fileType(mode uint32) byte {
+	switch mode & modeType {
+	case modeReg:
+		return 1
+	case modeDir:
+		return 2
+	case modeChr:
+		return 3
+	case modeBlk:
+		return 4
+	case modeFifo:
+		return 5
+	case modeLink:
+		return 7
+	}
+	return 0
+}
+
+// hasSuperblock reports whether group holds a copy of the superblock,
+// which with sparse_super are group 0, 1 and the powers of 3, 5 and 7.
+func hasSuperblock(group int) bool {
+	if group <= 1 {
+		return true
+	}
+	for _, base := range []int{3, 5, 7} {
+		n := base
+		for n < group {
+			n *= base
+		}
+		if n == group {
+			return true
+		}
+	}
+	return false
+}
+
+// groupStart returns the first block of group.
+func groupStart(group int) int { return group * ext4BlocksPerGroup }
+
+// bitmaps returns the blocks of the block and inode bitmaps of group,
+// followed by its inode table.
+func (l *ext4Layout) bitmaps(group int) (blockBitmap, inodeBitmap, inodeTable int) {
+	b := groupStart(group)
+	if hasSuperblock(group) {
+		b += 1 + l.gdtBlocks
+	}
+	return b, b + 1, b + 2
+}
+
+// plan sizes the image to hold data blocks besides the metadata of the
+// groups, with some room for the extent tree blocks of fragmented files.
+func (l *ext4Layout) plan(data int) {
+	inodes := len(l.inodes)
+	data += 16 + data/ext4BlocksPerGroup
+	l.groups = 1
+	for {
+		ipg := (inodes + l.groups - 1) / l.groups
+		ipg = max((ipg+15)&^15, 16)
+		if ipg > ext4BlocksPerGroup {
+			l.groups++
+			continue
+		}
+		l.inodesPerGroup = ipg
+		l.inodeTableBlks = ipg * ext4InodeSize / ext4BlockSize
+		l.gdtBlocks = (l.groups*ext4DescSize + ext4BlockSize - 1) / ext4BlockSize
+		l.blocks = data
+		for g := range l.groups {
+			l.blocks += 2 + l.inodeTableBlks
+			if hasSuperblock(g) {
+				l.blocks += 1 + l.gdtBlocks
+			}
+		}
+		if need := (l.blocks + ext4BlocksPerGroup - 1) / ext4BlocksPerGroup; need > l.groups {
+			l.groups = need
+			continue
+		}
+		break
+	}
+
+	l.used = make([]bool, l.blocks)
+	for g := range l.groups {
+		_, _, table := l.bitmaps(g)
+		for b := groupStart(g); b < table+l.inodeTableBlks; b++ {
+			l.used[b] = true
+		}
+	}
+}
+
+// alloc returns the extents of the next count free blocks.
+func (l *ext4Layout) alloc(count int) ([]ext4Extent, error) {
+	var extents []ext4Extent
+	for logical := 0; logical < count; logical++ {
+		for l.next < l.blocks && l.used[l.next] {
+			l.next++
+		}
+		if l.next == l.blocks {
+			return nil, fmt.Errorf("ext4 image of %d blocks is full", l.blocks)
+		}
+		l.used[l.next] = true
+		if n := len(extents); n > 0 && extents[n-1].start+extents[n-1].length == l.next {
+			extents[n-1].length++
+		} else {
+			extents = append(extents, ext4Extent{logical: logical, start: l.next, length: 1})
+		}
+		l.next++
+	}
+	return extents, nil
+}
+
+// allocate lays out the blocks of the files in the order of their inodes.
+func (l *ext4Layout) allocate() error {
+	l.dirsPerGroup = make([]int, l.groups)
+	for _, n := range l.inodes {
+		if n == nil {
+			continue
+		}
+		if n.isDir() {
+			l.dirsPerGroup[int(n.ino-1)/l.inodesPerGroup]++
+		}
+		count := l.dataBlocks(n)
+		if count == 0 && n.mode&modeType != modeReg && n.mode&modeType != modeDir {
+			continue
+		}
+		extents, err := l.alloc(count)
+		if err != nil {
+			return err
+		}
+		l.extents[n] = extents
+		l.extentBlocks[n] = count
+		if len(extents) > ext4InodeExtents {
+			leaves := (len(extents) + ext4LeafExtents - 1) / ext4LeafExtents
+			if leaves > ext4InodeExtents {
+				return fmt.Errorf("file of %d blocks is too fragmented", count)
+			}
+			for range leaves {
+				leaf, err := l.alloc(1)
+				if err != nil {
+					return err
+				}
+				l.leaves[n] = append(l.leaves[n], leaf[0].start)
+			}
+			l.extentBlocks[n] += leaves
+		}
+	}
+	return nil
+}
+
+// write writes the image to dest.
+func (l *ext4Layout) write(dest io.WriterAt) error {
+	// Size the image, whatever its last block holds.
+	if _, err := dest.WriteAt([]byte{0}, int64(l.blocks)*ext4BlockSize-1); err != nil {
+		return err
+	}
+
+	for _, n := range l.inodes {
+		if n == nil {
+			continue
+		}
+		if err := l.writeData(dest, n); err != nil {
+			return err
+		}
+	}
+
+	usedInodes := len(l.inodes)
+	gdt := make([]byte, l.gdtBlocks*ext4BlockSize)
+	freeBlocks := 0
+	for g := range l.groups {
+		start, end := groupStart(g), min(groupStart(g+1), l.blocks)
+		blockBitmapBlk, inodeBitmapBlk, tableBlk := l.bitmaps(g)
+
+		// Mark the blocks past the end of the image as used.
+		blockBitmap := make([]byte, ext4BlockSize)
+		free := 0
+		for b := start; b < start+ext4BlocksPerGroup; b++ {
+			if b >= end || l.used[b] {
+				blockBitmap[(b-start)/8] |= 1 << ((b - start) % 8)
+			} else {
+				free++
+			}
+		}
+		freeBlocks += free
+
+		// Mark the inodes past the end of the group as used.
+		inodeBitmap := make([]byte, ext4BlockSize)
+		freeInodes := 0
+		table := make([]byte, l.inodeTableBlks*ext4BlockSize)
+		for i := range 8 * ext4BlockSize {
+			ino := g*l.inodesPerGroup + i + 1
+			if i >= l.inodesPerGroup || ino <= usedInodes {
+				inodeBitmap[i/8] |= 1 << (i % 8)
+			} else {
+				freeInodes++
+			}
+			if i < l.inodesPerGroup && ino <= usedInodes && l.inodes[ino-1] != nil {
+				if err := l.inode(table[i*ext4InodeSize:(i+1)*ext4InodeSize], l.inodes[ino-1]); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, w := range []struct {
+			block int
+			data  []byte
+		}{{blockBitmapBlk, blockBitmap}, {inodeBitmapBlk, inodeBitmap}, {tableBlk, table}} {
+			if _, err := dest.WriteAt(w.data, int64(w.block)*ext4BlockSize); err != nil {
+				return err
+			}
+		}
+
+		desc := gdt[g*ext4DescSize:]
+		binary.LittleEndian.PutUint32(desc[0:], uint32(blockBitmapBlk))     //nolint:gosec
+		binary.LittleEndian.PutUint32(desc[4:], uint32(inodeBitmapBlk))     //nolint:gosec
+		binary.LittleEndian.PutUint32(desc[8:], uint32(tableBlk))           //nolint:gosec
+		binary.LittleEndian.PutUint16(desc[12:], uint16(free))              //nolint:gosec
+		binary.LittleEndian.PutUint16(desc[14:], uint16(freeInodes))        //nolint:gosec
+		binary.LittleEndian.PutUint16(desc[16:], uint16(l.dirsPerGroup[g])) //nolint:gosec
+	}
+
+	for g := range l.groups {
+		if !hasSuperblock(g) {
+			continue
+		}
+		sb := l.superblock(g, freeBlocks, l.groups*l.inodesPerGroup-usedInodes)
+		offset := int64(groupStart(g)) * ext4BlockSize
+		if g == 0 {
+			offset = 1024
+		}
+		if _, err := dest.WriteAt(sb, offset); err != nil {
+			return err
+		}
+		if _, err := dest.WriteAt(gdt, int64(groupStart(g)+1)*ext4BlockSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeData writes the data blocks and extent tree leaves of n.
+func (l *ext4Layout) writeData(dest io.WriterAt, n *node) error {
+	extents := l.extents[n]
+	var data io.Reader
+	switch n.mode & modeType {
+	case modeDir:
+		data = strings.NewReader(string(l.dirBlocks[n]))
+	case modeReg:
+		data = io.NewSectionReader(l.t.spool, n.offset, n.size)
+	case modeLink:
+		if len(extents) == 0 {
+			return nil
+		}
+		data = strings.NewReader(n.target)
+	default:
+		return nil
+	}
+	for _, e := range extents {
+		w := io.NewOffsetWriter(dest, int64(e.start)*ext4BlockSize)
+		if _, err := io.CopyN(w, data, int64(e.length)*ext4BlockSize); err != nil && err != io.EOF {
+			return err
+		}
+	}
+
+	leaves := l.leaves[n]
+	for i, leaf := range leaves {
+		chunk := extents[i*ext4LeafExtents : min((i+1)*ext4LeafExtents, len(extents))]
+		b := make([]byte, ext4BlockSize)
+		putExtents(b, chunk, ext4LeafExtents)
+		if _, err := dest.WriteAt(b, int64(leaf)*ext4BlockSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putExtents writes an extent tree node of depth 0 holding extents to b.
+func putExtents(b []byte, extents []ext4Extent, capacity int) {
+	binary.LittleEndian.PutUint16(b[0:], ext4ExtentMagic)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(extents))) //nolint:gosec
+	binary.LittleEndian.PutUint16(b[4:], uint16(capacity))     //nolint:gosec
+	for i, e := range extents {
+		x := b[12+12*i:]
+		binary.LittleEndian.PutUint32(x[0:], uint32(e.logical)) //nolint:gosec
+		binary.LittleEndian.PutUint16(x[4:], uint16(e.length))  //nolint:gosec
+		binary.LittleEndian.PutUint32(x[8:], uint32(e.start))   //nolint:gosec
+	}
+}
+
+// inode writes the inode of n to b.
+func (l *ext4Layout) inode(b []byte, n *node) error {
+	size := uint64(n.size) //nolint:gosec
+	switch n.mode & modeType {
+	case modeDir:
+		size = uint64(len(l.dirBlocks[n]))
+	case modeLink:
+		size = uint64(len(n.target))
+	}
+	nlink := n.nlink
+	if n.isDir() && nlink > ext4MaxLinks {
+		// With dir_nlink, a directory of too many subdirectories
+		// counts one link.
+		nlink = 1
+	}
+
+	binary.LittleEndian.PutUint16(b[0:], uint16(n.mode))                               //nolint:gosec
+	binary.LittleEndian.PutUint16(b[2:], uint16(n.uid))                                //nolint:gosec
+	binary.LittleEndian.PutUint32(b[4:], uint32(size))                                 //nolint:gosec
+	binary.LittleEndian.PutUint16(b[24:], uint16(n.gid))                               //nolint:gosec
+	binary.LittleEndian.PutUint16(b[26:], uint16(nlink))                               //nolint:gosec
+	binary.LittleEndian.PutUint32(b[28:], uint32(l.extentBlocks[n]*ext4BlockSize/512)) //nolint:gosec
+	binary.LittleEndian.PutUint32(b[108:], uint32(size>>32))                           //nolint:gosec
+	binary.LittleEndian.PutUint16(b[120:], uint16(n.uid>>16))
+	binary.LittleEndian.PutUint16(b[122:], uint16(n.gid>>16))
+	binary.LittleEndian.PutUint16(b[128:], ext4ExtraIsize)
+
+	// The access, change, modification and creation times are all the
+	// modification time of the file.
+	seconds, extra := ext4Time(n.mtime)
+	for _, off := range []int{8, 12, 16, 144} {
+		binary.LittleEndian.PutUint32(b[off:], seconds)
+	}
+	for _, off := range []int{132, 136, 140, 148} {
+		binary.LittleEndian.PutUint32(b[off:], extra)
+	}
+
+	block := b[40:100]
+	switch n.mode & modeType {
+	case modeChr, modeBlk:
+		if n.major < 256 && n.minor < 256 {
+			binary.LittleEndian.PutUint32(block[0:], n.major<<8|n.minor)
+		} else {
+			binary.LittleEndian.PutUint32(block[4:], n.minor&0xff|n.major<<8|(n.minor&^0xff)<<12)
+		}
+	case modeLink:
+		if len(n.target) < ext4FastSymlink {
+			copy(block, n.target)
+			break
+		}
+		fallthrough
+	case modeDir, modeReg:
+		binary.LittleEndian.PutUint32(b[32:], ext4ExtentsFlag)
+		extents := l.extents[n]
+		if leaves := l.leaves[n]; len(leaves) > 0 {
+			binary.LittleEndian.PutUint16(block[0:], ext4ExtentMagic)
+			binary.LittleEndian.PutUint16(block[2:], uint16(len(leaves))) //nolint:gosec
+			binary.LittleEndian.PutUint16(block[4:], ext4InodeExtents)
+			binary.LittleEndian.PutUint16(block[6:], 1)
+			for i, leaf := range leaves {
+				x := block[12+12*i:]
+				binary.LittleEndian.PutUint32(x[0:], uint32(extents[i*ext4LeafExtents].logical)) //nolint:gosec
+				binary.LittleEndian.PutUint32(x[4:], uint32(leaf))                               //nolint:gosec
+			}
+		} else {
+			putExtents(block, extents, ext4InodeExtents)
+		}
+	}
+
+	if err := putExt4Xattrs(b[128+ext4ExtraIsize:], n.xattrs); err != nil {
+		return fmt.Errorf("inode %d: %w", n.ino, err)
+	}
+	return nil
+}
+
+// ext4Time returns the seconds and the extra field of the nanoseconds and
+// epoch bits of t, as stored in ext4 inodes.
+func ext4Time(t time.Time) (uint32, uint32) {
+	s := t.Unix()
+	epoch := uint32((s-int64(int32(s)))>>32) & 3        //nolint:gosec
+	return uint32(s), uint32(t.Nanosecond())<<2 | epoch //nolint:gosec
+}
+
+// ext4XattrPrefixes are the name indexes of the prefixes of extended
+// attribute names.
+var ext4XattrPrefixes = []struct {
+	prefix string
+	index  byte
+}{
+	{"user.", 1},
+	{"trusted.", 4},
+	{"security.", 6},
+	{"system.", 7},
+}
+
+// putExt4Xattrs writes the extended attributes xattrs to the space after
+// the extra fields of an inode, b.
+func putExt4Xattrs(b []byte, xattrs map[string][]byte) error {
+	if len(xattrs) == 0 {
+		return nil
+	}
+	type attr struct {
+		index byte
+		name  string
+		value []byte
+	}
+	var attrs []attr
+	for name, value := range xattrs {
+		if strings.HasPrefix(name, "system.posix_acl_") {
+			return fmt.Errorf("unsupported extended attribute %s", name)
+		}
+		i := slices.IndexFunc(ext4XattrPrefixes, func(p struct {
+			prefix string
+			index  byte
+		}) bool {
+			return strings.HasPrefix(name, p.prefix)
+		})
+		if i < 0 {
+			return fmt.Errorf("unsupported extended attribute %s", name)
+		}
+		p := ext4XattrPrefixes[i]
+		attrs = append(attrs, attr{p.index, name[len(p.prefix):], value})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].index != attrs[j].index {
+			return attrs[i].index < attrs[j].index
+		}
+		return attrs[i].name < attrs[j].name
+	})
+
+	binary.LittleEndian.PutUint32(b[0:], ext4XattrMagic)
+	entries := b[4:]
+	off, end := 0, len(entries)
+	for _, a := range attrs {
+		size := 16 + (len(a.name)+3)&^3
+		valueSize := (len(a.value) + 3) &^ 3
+		// Leave 4 bytes for the end of the entries.
+		if off+size+4 > end-valueSize {
+			return fmt.Errorf("extended attributes do not fit in the inode")
+		}
+		end -= valueSize
+		copy(entries[end:], a.value)
+		e := entries[off:]
+		e[0] = byte(len(a.name))
+		e[1] = a.index
+		binary.LittleEndian.PutUint16(e[2:], uint16(end))          //nolint:gosec
+		binary.LittleEndian.PutUint32(e[8:], uint32(len(a.value))) //nolint:gosec
+		binary.LittleEndian.PutUint32(e[12:], ext4XattrHash(a.name, entries[end:end+valueSize]))
+		copy(e[16:], a.name)
+		off += size
+	}
+	return nil
+}
+
+// ext4XattrHash returns the hash of an extended attribute entry, of its
+// name and value padded to 4 bytes.
+func ext4XattrHash(name string, value []byte) uint32 {
+	var hash uint32
+	for _, c := range []byte(name) {
+		hash = hash<<5 ^ hash>>27 ^ uint32(c)
+	}
+	for i := 0; i < len(value); i += 4 {
+		hash = hash<<16 ^ hash>>16 ^ binary.LittleEndian.Uint32(value[i:])
+	}
+	return hash
+}
+
+// superblock returns the superblock of the image, as copied to group.
+func (l *ext4Layout) superblock(group, freeBlocks, freeInodes int) []byte {
+	b := make([]byte, 1024)
+	created := uint32(max(l.t.root.mtime.Unix(), 0)) //nolint:gosec
+	le := binary.LittleEndian
+
+	le.PutUint32(b[0:], uint32(l.groups*l.inodesPerGroup)) //nolint:gosec
+	le.PutUint32(b[4:], uint32(l.blocks))                  //nolint:gosec
+	le.PutUint32(b[12:], uint32(freeBlocks))               //nolint:gosec
+	le.PutUint32(b[16:], uint32(freeInodes))               //nolint:gosec
+	le.PutUint32(b[24:], 2)                                // 4KiB blocks
+	le.PutUint32(b[28:], 2)                                // and clusters
+	le.PutUint32(b[32:], ext4BlocksPerGroup)
+	le.PutUint32(b[36:], ext4BlocksPerGroup)
+	le.PutUint32(b[40:], uint32(l.inodesPerGroup)) //nolint:gosec
+	le.PutUint32(b[48:], created)
+	le.PutUint16(b[54:], 0xffff) // no checks after a number of mounts
+	le.PutUint16(b[56:], 0xef53)
+	le.PutUint16(b[58:], 1) // clean
+	le.PutUint16(b[60:], 1) // continue on errors
+	le.PutUint32(b[64:], created)
+	le.PutUint32(b[76:], 1) // dynamic revision
+	le.PutUint32(b[84:], ext4LostFoundIno)
+	le.PutUint16(b[88:], ext4InodeSize)
+	le.PutUint16(b[90:], uint16(group)) //nolint:gosec
+	le.PutUint32(b[92:], ext4CompatExtAttr)
+	le.PutUint32(b[96:], ext4IncompatFiletype|ext4IncompatExtents)
+	le.PutUint32(b[100:], ext4RoCompatSparse|ext4RoCompatLargeFile|ext4RoCompatDirNlink|ext4RoCompatExtraIsize)
+	copy(b[104:], l.t.uuid[:])
+	// Seed the hashes of directory names with the identifier too.
+	copy(b[236:], l.t.uuid[:])
+	b[252] = ext4HashHalfMD4
+	le.PutUint32(b[264:], created)
+	le.PutUint16(b[348:], ext4ExtraIsize)
+	le.PutUint16(b[350:], ext4ExtraIsize)
+	le.PutUint32(b[352:], ext4SignedHash)
+	return b
+}
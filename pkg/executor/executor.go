@@ -0,0 +1,240 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package executor provides implementations of apk.Executor, which run
+// commands inside a root filesystem on disk:
+//
+//   - Chroot runs them chrooted into the root filesystem, which needs the
+//     privileges to chroot;
+//   - UserNS runs them chrooted into the root filesystem in a new user
+//     namespace, which needs no privileges where unprivileged user namespaces
+//     are enabled;
+//   - QEMU runs them through qemu-user with another executor, for root
+//     filesystems of another architecture than the host's.
+//
+// None of them isolate the network, the processes or the mounts of the
+// command from the host, and none of them mount /dev or /proc in the root
+// filesystem: they are meant to run build steps against trusted packages,
+// not to sandbox untrusted ones.
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// DefaultPath is the PATH commands are looked up in when their environment
+// has none.
+const DefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+type chroot struct {
+	userns bool
+}
+
+// Chroot returns an executor which runs commands chrooted into the root
+// filesystem, as the current user. It needs the privileges to chroot, as the
+// root user has.
+func Chroot() apk.Executor {
+	return &chroot{}
+}
+
+// UserNS returns an executor which runs commands chrooted into the root
+// filesystem in a new user namespace, as the root user of the namespace,
+// which is mapped to the current user. Files created by the command are owned
+// by the current user on the host.
+func UserNS() apk.Executor {
+	return &chroot{userns: true}
+}
+
+type qemu struct {
+	arch     types.Architecture
+	emulator string
+	inner    apk.Executor
+}
+
+// QEMU returns an executor which runs commands of root filesystems of arch
+// with inner, through the qemu-user emulator of arch found in the PATH of the
+// host, qemu-<arch>-static or else qemu-<arch>. The emulator is copied into
+// the root filesystem while the command runs, so it must be statically
+// linked.
+func QEMU(arch types.Architecture, inner apk.Executor) (apk.Executor, error) {
+	var errs []error
+	for _, name := range []string{"qemu-" + arch.ToQEmu() + "-static", "qemu-" + arch.ToQEmu()} {
+		emulator, err := exec.LookPath(name)
+		if err == nil {
+			return &qemu{arch: arch, emulator: emulator, inner: inner}, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("no qemu-user emulator for %s: %w", arch, errors.Join(errs...))
+}
+
+// binfmtDir is where the binfmt_misc handlers of the kernel are registered.
+var binfmtDir = "/proc/sys/fs/binfmt_misc"
+
+// Default returns the executor for root filesystems of arch: UserNS, through
+// QEMU if the host cannot run programs of arch, natively or with a qemu-user
+// emulator registered with binfmt_misc.
+func Default(arch types.Architecture) (apk.Executor, error) {
+	if arch.Compatible(types.ParseArchitecture(runtime.GOARCH)) || binfmtRegistered(arch) {
+		return UserNS(), nil
+	}
+	return QEMU(arch, UserNS())
+}
+
+// binfmtRegistered returns whether a qemu-user emulator of arch is registered
+// with binfmt_misc, enabled, and with the F flag, with which the kernel opens
+// the emulator when it is registered rather than in the root filesystem of
+// the program.
+func binfmtRegistered(arch types.Architecture) bool {
+	b, err := os.ReadFile(filepath.Join(binfmtDir, "qemu-"+arch.ToQEmu()))
+	if err != nil {
+		return false
+	}
+	lines := strings.Split(string(b), "\n")
+	if len(lines) == 0 || lines[0] != "enabled" {
+		return false
+	}
+	for _, line := range lines {
+		if flags, ok := strings.CutPrefix(line, "flags: "); ok {
+			return strings.Contains(flags, "F")
+		}
+	}
+	return false
+}
+
+func (e *qemu) Execute(ctx context.Context, root string, cmd apk.Command) error {
+	if len(cmd.Args) == 0 {
+		return errors.New("no command to execute")
+	}
+	program, err := LookPath(root, cmd.Args[0], cmd.Dir, cmd.Env)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(e.emulator)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(root, ".qemu-"+e.arch.ToQEmu()+"-*")
+	if err != nil {
+		return fmt.Errorf("copying %s into the root filesystem: %w", e.emulator, err)
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("copying %s into the root filesystem: %w", e.emulator, err)
+	}
+	if err := out.Chmod(0o755); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// The emulator runs the program with the original argv[0].
+	args := append([]string{"/" + filepath.Base(out.Name()), "-0", cmd.Args[0], program}, cmd.Args[1:]...)
+	cmd.Args = args
+	return e.inner.Execute(ctx, root, cmd)
+}
+
+// LookPath returns the path in the root filesystem at root of the program
+// name, run in the working directory dir with the environment env: name
+// itself if it has a slash, or else the first regular file of that name in
+// the directories of the PATH of env, or of DefaultPath if env has none.
+func LookPath(root, name, dir string, env []string) (string, error) {
+	if dir == "" {
+		dir = "/"
+	}
+	if strings.Contains(name, "/") {
+		return path.Join(dir, name), nil
+	}
+	pathEnv := DefaultPath
+	for _, e := range env {
+		if v, ok := strings.CutPrefix(e, "PATH="); ok {
+			pathEnv = v
+		}
+	}
+	for _, d := range filepath.SplitList(pathEnv) {
+		p := path.Join(d, name)
+		if !path.IsAbs(p) {
+			p = path.Join(dir, p)
+		}
+		resolved, err := Resolve(root, p)
+		if err != nil {
+			continue
+		}
+		if fi, err := os.Stat(resolved); err == nil && fi.Mode().IsRegular() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s: not found in PATH %s of the root filesystem", name, pathEnv)
+}
+
+// Resolve returns the path on the host of p, a path in the root filesystem at
+// root, resolving its symlinks as they would be resolved chrooted into root,
+// so that the result cannot be outside of root. The last element of p need
+// not exist, any other must.
+func Resolve(root, p string) (string, error) {
+	resolved := "/"
+	rest := strings.Split(p, "/")
+	for links := 0; len(rest) > 0; {
+		name := rest[0]
+		rest = rest[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = path.Dir(resolved)
+			continue
+		}
+		next := path.Join(resolved, name)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if errors.Is(err, os.ErrNotExist) && len(rest) == 0 {
+			resolved = next
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > 40 {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", p)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(root, resolved), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func (e *chroot) Execute(ctx context.Context, root string, cmd apk.Command) error {
+	if len(cmd.Args) == 0 {
+		return errors.New("no command to execute")
+	}
+	dir := cmd.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	program, err := LookPath(root, cmd.Args[0], dir, cmd.Env)
+	if err != nil {
+		return err
+	}
+
+	// The program is an absolute path, which is only looked up in the root
+	// filesystem after the chroot.
+	c := exec.CommandContext(ctx, program)
+	c.Args = cmd.Args
+	c.Env = cmd.Env
+	c.Dir = dir
+	c.Stdin, c.Stdout, c.Stderr = cmd.Stdin, cmd.Stdout, cmd.Stderr
+	c.SysProcAttr = &syscall.SysProcAttr{Chroot: root}
+	if e.userns {
+		c.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER
+		c.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		c.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	}
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("running %s: %w", program, err)
+	}
+	return nil
+}
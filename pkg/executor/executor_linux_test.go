@@ -0,0 +1,206 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// TestMain runs the test binary as the command of the tests when it is run
+// with APKO_EXECUTOR_HELPER set: it prints its working directory, user ID
+// and whether /marker exists, and exits with the status given.
+func TestMain(m *testing.M) {
+	if status, ok := os.LookupEnv("APKO_EXECUTOR_HELPER"); ok {
+		wd, _ := os.Getwd()
+		_, err := os.Stat("/marker")
+		fmt.Printf("wd=%s uid=%d marker=%t args=%v\n", wd, os.Getuid(), err == nil, os.Args)
+		var code int
+		fmt.Sscan(status, &code)
+		os.Exit(code)
+	}
+	os.Exit(m.Run())
+}
+
+// testRoot returns a root filesystem holding the test binary as
+// /usr/bin/helper, linked from /bin, with the ELF interpreter and the shared
+// libraries it needs if it is dynamically linked, and /marker.
+func testRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	self, err := os.Executable()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr/bin"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "work"), 0o755))
+	copyFile(t, self, filepath.Join(root, "usr/bin/helper"))
+	require.NoError(t, os.Symlink("usr/bin", filepath.Join(root, "bin")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "marker"), nil, 0o644))
+
+	f, err := elf.Open(self)
+	require.NoError(t, err)
+	defer f.Close()
+	var interp string
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			b, err := io.ReadAll(p.Open())
+			require.NoError(t, err)
+			interp = strings.TrimRight(string(b), "\x00")
+		}
+	}
+	if interp == "" {
+		return root
+	}
+	copyFile(t, interp, filepath.Join(root, interp))
+	libs, err := f.ImportedLibraries()
+	require.NoError(t, err)
+	for _, lib := range libs {
+		// The libraries are copied where the interpreter finds them on the
+		// host, in its own directory or a multiarch one.
+		matches, _ := filepath.Glob(filepath.Join("/lib/*-linux-gnu", lib))
+		matches = append(matches, filepath.Join(filepath.Dir(interp), lib))
+		p := matches[0]
+		copyFile(t, p, filepath.Join(root, p))
+	}
+	return root
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(dst), 0o755))
+	require.NoError(t, os.WriteFile(dst, b, 0o755))
+}
+
+func TestExecute(t *testing.T) {
+	if err := exec.Command("unshare", "-Ur", "true").Run(); err != nil {
+		t.Skipf("user namespaces are not available: %v", err)
+	}
+	root := testRoot(t)
+
+	for _, tt := range []struct {
+		name    string
+		e       apk.Executor
+		cmd     apk.Command
+		want    string
+		wantErr string
+	}{{
+		name: "in PATH",
+		e:    UserNS(),
+		cmd:  apk.Command{Args: []string{"helper", "a"}, Env: []string{"APKO_EXECUTOR_HELPER=0", "PATH=/bin"}},
+		want: "wd=/ uid=0 marker=true args=[helper a]\n",
+	}, {
+		name: "default PATH and dir",
+		e:    UserNS(),
+		cmd:  apk.Command{Args: []string{"helper"}, Env: []string{"APKO_EXECUTOR_HELPER=0"}, Dir: "/work"},
+		want: "wd=/work uid=0 marker=true args=[helper]\n",
+	}, {
+		name: "relative to dir",
+		e:    UserNS(),
+		cmd:  apk.Command{Args: []string{"../bin/helper"}, Env: []string{"APKO_EXECUTOR_HELPER=0"}, Dir: "/work"},
+		want: "wd=/work uid=0 marker=true args=[../bin/helper]\n",
+	}, {
+		name:    "exit status",
+		e:       UserNS(),
+		cmd:     apk.Command{Args: []string{"helper"}, Env: []string{"APKO_EXECUTOR_HELPER=3"}},
+		want:    "wd=/ uid=0 marker=true args=[helper]\n",
+		wantErr: "running /usr/bin/helper: exit status 3",
+	}, {
+		name:    "not found",
+		e:       UserNS(),
+		cmd:     apk.Command{Args: []string{"missing"}, Env: []string{"PATH=/bin:/sbin"}},
+		wantErr: "missing: not found in PATH /bin:/sbin of the root filesystem",
+	}, {
+		name:    "no command",
+		e:       UserNS(),
+		wantErr: "no command to execute",
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.cmd.Stdout = &out
+			err := tt.e.Execute(context.Background(), root, tt.cmd)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.want, out.String())
+		})
+	}
+
+	t.Run("exit error", func(t *testing.T) {
+		err := UserNS().Execute(context.Background(), root, apk.Command{Args: []string{"helper"}, Env: []string{"APKO_EXECUTOR_HELPER=5"}})
+		var exitErr *exec.ExitError
+		require.True(t, errors.As(err, &exitErr))
+		require.Equal(t, 5, exitErr.ExitCode())
+	})
+
+	t.Run("chroot", func(t *testing.T) {
+		if os.Getuid() != 0 {
+			t.Skip("chroot needs to run as root")
+		}
+		var out bytes.Buffer
+		err := Chroot().Execute(context.Background(), root, apk.Command{Args: []string{"/bin/helper"}, Env: []string{"APKO_EXECUTOR_HELPER=0"}, Stdout: &out})
+		require.NoError(t, err)
+		require.Equal(t, "wd=/ uid=0 marker=true args=[/bin/helper]\n", out.String())
+	})
+}
+
+func TestResolve(t *testing.T) {
+	root := testRoot(t)
+	require.NoError(t, os.Symlink("/../../../usr", filepath.Join(root, "escape")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+
+	for _, tt := range []struct {
+		p       string
+		want    string
+		wantErr bool
+	}{
+		{p: "/bin/helper", want: "/usr/bin/helper"},
+		{p: "usr/bin/../../marker", want: "/marker"},
+		{p: "bin/../marker", want: "/usr/marker"},
+		{p: "/../../marker", want: "/marker"},
+		{p: "/escape/bin", want: "/usr/bin"},
+		{p: "/bin/missing", want: "/usr/bin/missing"},
+		{p: "/missing/file", wantErr: true},
+		{p: "/loop", wantErr: true},
+	} {
+		t.Run(tt.p, func(t *testing.T) {
+			got, err := Resolve(root, tt.p)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(root, tt.want), got)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestBinfmtRegistered(t *testing.T) {
+	dir := t.TempDir()
+	old := binfmtDir
+	binfmtDir = dir
+	t.Cleanup(func() { binfmtDir = old })
+
+	for name, content := range map[string]string{
+		"qemu-aarch64": "enabled\ninterpreter /usr/bin/qemu-aarch64-static\nflags: POCF\noffset 0\n",
+		"qemu-riscv64": "enabled\ninterpreter /usr/bin/qemu-riscv64\nflags: P\noffset 0\n",
+		"qemu-s390x":   "disabled\ninterpreter /usr/bin/qemu-s390x-static\nflags: F\noffset 0\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	for arch, want := range map[types.Architecture]bool{
+		types.ParseArchitecture("arm64"):   true,
+		types.ParseArchitecture("riscv64"): false,
+		types.ParseArchitecture("s390x"):   false,
+		types.ParseArchitecture("ppc64le"): false,
+	} {
+		require.Equal(t, want, binfmtRegistered(arch), arch)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package feed finds what changed in apk repositories since they were last
+// polled, so that images are rebuilt when their packages or keys change
+// rather than on a schedule.
+package feed
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// State is what a poll saw of the repositories and the keyring, against
+// which the next poll finds changes.
+type State struct {
+	// Repositories are the indexes polled, by their URL.
+	Repositories map[string]Repository `json:"repositories"`
+	// Keys are the checksums of the keys of the keyring, by their name.
+	Keys map[string]string `json:"keys"`
+}
+
+// Repository is what a poll saw of the index of a repository.
+type Repository struct {
+	// Checksum is the SHA256 of the APKINDEX.tar.gz, when it is known.
+	Checksum string `json:"checksum,omitempty"`
+	// Packages are the latest versions of the packages, by their name.
+	Packages map[string]string `json:"packages"`
+}
+
+// EventType is the kind of change an Event is about.
+type EventType string
+
+const (
+	// NewPackage is a package which was not in the repository.
+	NewPackage EventType = "new-package"
+	// NewVersion is a newer version of a package.
+	NewVersion EventType = "new-version"
+	// Withdrawn is the latest version of a package being taken out of the
+	// repository, which leaves an older version the latest.
+	Withdrawn EventType = "withdrawn"
+	// Removed is a package which is no longer in the repository.
+	Removed EventType = "removed"
+	// RepositoryAdded is a repository which was not polled before. Its
+	// packages are recorded without an event each.
+	RepositoryAdded EventType = "repository-added"
+	// RepositoryRemoved is a repository which is no longer polled.
+	RepositoryRemoved EventType = "repository-removed"
+	// KeyAdded is a key which was not in the keyring.
+	KeyAdded EventType = "key-added"
+	// KeyRotated is a key whose contents changed.
+	KeyRotated EventType = "key-rotated"
+	// KeyRemoved is a key which is no longer in the keyring.
+	KeyRemoved EventType = "key-removed"
+)
+
+// Event is a change found by a poll.
+type Event struct {
+	Type EventType `json:"type"`
+	// Repository is the URL of the index of the repository, for the events
+	// about repositories and packages.
+	Repository string `json:"repository,omitempty"`
+	// Package is the name of the package, for the events about packages.
+	Package string `json:"package,omitempty"`
+	// Previous is the latest version of the package in the recorded state.
+	Previous string `json:"previous,omitempty"`
+	// Version is the latest version of the package now.
+	Version string `json:"version,omitempty"`
+	// Key is the name of the key, for the events about keys.
+	Key string `json:"key,omitempty"`
+}
+
+// Snapshot returns the state of indexes and of the keyring they are
+// verified with, keys by their name.
+func Snapshot(indexes []apk.NamedIndex, keys map[string][]byte) State {
+	s := State{
+		Repositories: make(map[string]Repository, len(indexes)),
+		Keys:         make(map[string]string, len(keys)),
+	}
+	for _, idx := range indexes {
+		r := Repository{Packages: map[string]string{}}
+		if sum := apk.IndexChecksum(idx); sum != nil {
+			r.Checksum = lock.SHA256Checksum(sum)
+		}
+		for _, pkg := range idx.Packages() {
+			if prev, ok := r.Packages[pkg.Name]; !ok || apk.CompareVersionStrings(pkg.Version, prev) > 0 {
+				r.Packages[pkg.Name] = pkg.Version
+			}
+		}
+		s.Repositories[idx.Source()] = r
+	}
+	for name, key := range keys {
+		sum := sha256.Sum256(key)
+		s.Keys[name] = lock.SHA256Checksum(sum[:])
+	}
+	return s
+}
+
+// Merge adds the repositories and keys of other to s, for polling the
+// indexes of several architectures into one state.
+func (s *State) Merge(other State) {
+	if s.Repositories == nil {
+		s.Repositories = map[string]Repository{}
+	}
+	if s.Keys == nil {
+		s.Keys = map[string]string{}
+	}
+	maps.Copy(s.Repositories, other.Repositories)
+	maps.Copy(s.Keys, other.Keys)
+}
+
+// Changes returns the events which lead from the state prev to s: the keys
+// first, then the repositories by their URL and their packages by name.
+//
+// A zero prev is a first poll, which has no events: there is nothing to
+// compare it with.
+func (s State) Changes(prev State) []Event {
+	if prev.Repositories == nil && prev.Keys == nil {
+		return nil
+	}
+
+	var events []Event
+	for _, name := range sortedKeys(s.Keys, prev.Keys) {
+		sum, ok := s.Keys[name]
+		was, had := prev.Keys[name]
+		switch {
+		case !had:
+			events = append(events, Event{Type: KeyAdded, Key: name})
+		case !ok:
+			events = append(events, Event{Type: KeyRemoved, Key: name})
+		case sum != was:
+			events = append(events, Event{Type: KeyRotated, Key: name})
+		}
+	}
+
+	for _, url := range sortedKeys(s.Repositories, prev.Repositories) {
+		r, ok := s.Repositories[url]
+		was, had := prev.Repositories[url]
+		switch {
+		case !had:
+			events = append(events, Event{Type: RepositoryAdded, Repository: url})
+			continue
+		case !ok:
+			events = append(events, Event{Type: RepositoryRemoved, Repository: url})
+			continue
+		case r.Checksum != "" && r.Checksum == was.Checksum:
+			continue
+		}
+		for _, name := range sortedKeys(r.Packages, was.Packages) {
+			version, ok := r.Packages[name]
+			previous, had := was.Packages[name]
+			e := Event{Repository: url, Package: name, Previous: previous, Version: version}
+			switch {
+			case !had:
+				e.Type = NewPackage
+			case !ok:
+				e.Type = Removed
+			case apk.CompareVersionStrings(version, previous) > 0:
+				e.Type = NewVersion
+			case version != previous:
+				e.Type = Withdrawn
+			default:
+				continue
+			}
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// sortedKeys returns the keys of a and b, sorted.
+func sortedKeys[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// FromFile reads the state saved at path. A missing file is the zero state,
+// as before a first poll.
+func FromFile(path string) (State, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return State{}, nil
+	} else if err != nil {
+		return State{}, fmt.Errorf("reading feed state: %w", err)
+	}
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return State{}, fmt.Errorf("parsing feed state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// SaveToFile saves the state at path, replacing the previous state at once
+// so that an interrupted poll leaves it whole.
+func (s State) SaveToFile(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal feed state: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0o644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// WriteEventsJSON writes events as a JSON object, for automation which
+// rebuilds the images using the packages and keys that changed.
+func WriteEventsJSON(w io.Writer, events []Event) error {
+	if events == nil {
+		events = []Event{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Events []Event `json:"events"`
+	}{events})
+}
+
+// WriteEventsText writes events as a table.
+func WriteEventsText(w io.Writer, events []Event) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "EVENT\tNAME\tPREVIOUS\tVERSION\tREPOSITORY")
+	for _, e := range events {
+		name := e.Package
+		if name == "" {
+			name = e.Key
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Type, name, e.Previous, e.Version, e.Repository)
+	}
+	return tw.Flush()
+}
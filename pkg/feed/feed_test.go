@@ -0,0 +1,169 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func testIndex(uri string, pkgs ...*apk.Package) apk.NamedIndex {
+	repo := &apk.Repository{URI: uri}
+	return apk.NewNamedRepositoryWithIndex("", repo.WithIndex(&apk.APKIndex{Packages: pkgs}))
+}
+
+func TestSnapshot(t *testing.T) {
+	s := Snapshot([]apk.NamedIndex{testIndex("https://packages.wolfi.dev/os/x86_64",
+		&apk.Package{Name: "busybox", Version: "1.36.1-r2"},
+		&apk.Package{Name: "busybox", Version: "1.37.0-r0"},
+		&apk.Package{Name: "glibc", Version: "2.40-r1"},
+	)}, map[string][]byte{"wolfi-signing.rsa.pub": []byte("key")})
+	require.Equal(t, State{
+		Repositories: map[string]Repository{
+			"https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz": {Packages: map[string]string{
+				"busybox": "1.37.0-r0",
+				"glibc":   "2.40-r1",
+			}},
+		},
+		Keys: map[string]string{"wolfi-signing.rsa.pub": "sha256-LHDhK3oGRvkiefQnx7OOczTY5Tic/xZ6HcMOc/gmtoM="},
+	}, s)
+}
+
+func TestChanges(t *testing.T) {
+	const (
+		os    = "https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz"
+		extra = "https://packages.example.com/x86_64/APKINDEX.tar.gz"
+	)
+	prev := State{
+		Repositories: map[string]Repository{
+			os: {Packages: map[string]string{
+				"busybox": "1.36.1-r2",
+				"curl":    "8.10.0-r0",
+				"glibc":   "2.40-r1",
+				"openssl": "3.4.0-r1",
+			}},
+			extra: {Packages: map[string]string{"app": "1.0-r0"}},
+		},
+		Keys: map[string]string{"old.rsa.pub": "sha256-a", "wolfi-signing.rsa.pub": "sha256-b"},
+	}
+
+	for _, tt := range []struct {
+		name string
+		prev State
+		next State
+		want []Event
+	}{{
+		name: "first poll",
+		next: prev,
+	}, {
+		name: "unchanged",
+		prev: prev,
+		next: prev,
+	}, {
+		name: "changed",
+		prev: prev,
+		next: State{
+			Repositories: map[string]Repository{
+				os: {Packages: map[string]string{
+					"busybox": "1.37.0-r0",
+					"glibc":   "2.40-r1",
+					"openssl": "3.4.0-r0",
+					"wget":    "1.25.0-r0",
+				}},
+				"https://packages.example.com/new/x86_64/APKINDEX.tar.gz": {Packages: map[string]string{"app": "1.0-r0"}},
+			},
+			Keys: map[string]string{"new.rsa.pub": "sha256-c", "wolfi-signing.rsa.pub": "sha256-d"},
+		},
+		want: []Event{
+			{Type: KeyAdded, Key: "new.rsa.pub"},
+			{Type: KeyRemoved, Key: "old.rsa.pub"},
+			{Type: KeyRotated, Key: "wolfi-signing.rsa.pub"},
+			{Type: RepositoryAdded, Repository: "https://packages.example.com/new/x86_64/APKINDEX.tar.gz"},
+			{Type: RepositoryRemoved, Repository: extra},
+			{Type: NewVersion, Repository: os, Package: "busybox", Previous: "1.36.1-r2", Version: "1.37.0-r0"},
+			{Type: Removed, Repository: os, Package: "curl", Previous: "8.10.0-r0"},
+			{Type: Withdrawn, Repository: os, Package: "openssl", Previous: "3.4.0-r1", Version: "3.4.0-r0"},
+			{Type: NewPackage, Repository: os, Package: "wget", Version: "1.25.0-r0"},
+		},
+	}, {
+		name: "same index checksum",
+		prev: State{Repositories: map[string]Repository{extra: {Checksum: "sha256-e", Packages: map[string]string{"app": "1.0-r0"}}}},
+		next: State{Repositories: map[string]Repository{extra: {Checksum: "sha256-e", Packages: map[string]string{"app": "1.1-r0"}}}},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.next.Changes(tt.prev))
+		})
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.json")
+
+	s, err := FromFile(path)
+	require.NoError(t, err)
+	require.Zero(t, s)
+
+	want := State{
+		Repositories: map[string]Repository{"https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz": {
+			Checksum: "sha256-a",
+			Packages: map[string]string{"busybox": "1.37.0-r0"},
+		}},
+		Keys: map[string]string{},
+	}
+	require.NoError(t, want.SaveToFile(path))
+	// the state replaces the file, without leaving a temporary one
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	s, err = FromFile(path)
+	require.NoError(t, err)
+	require.Equal(t, want, s)
+	require.Empty(t, s.Changes(want))
+}
+
+func TestWriteEvents(t *testing.T) {
+	events := []Event{
+		{Type: KeyRotated, Key: "wolfi-signing.rsa.pub"},
+		{Type: NewVersion, Repository: "https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz", Package: "busybox", Previous: "1.36.1-r2", Version: "1.37.0-r0"},
+	}
+
+	var b bytes.Buffer
+	require.NoError(t, WriteEventsText(&b, events))
+	require.Equal(t, []string{
+		"EVENT        NAME                   PREVIOUS   VERSION    REPOSITORY",
+		"key-rotated  wolfi-signing.rsa.pub",
+		"new-version  busybox                1.36.1-r2  1.37.0-r0  https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz",
+	}, trimLines(b.String()))
+
+	b.Reset()
+	require.NoError(t, WriteEventsJSON(&b, nil))
+	require.JSONEq(t, `{"events": []}`, b.String())
+}
+
+// trimLines returns the lines of s without their trailing spaces.
+func trimLines(s string) []string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " ")
+	}
+	return lines
+}
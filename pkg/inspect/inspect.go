@@ -0,0 +1,253 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inspect describes the packages, files and configuration of an
+// image, as apk info would describe a system.
+package inspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dustin/go-humanize"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// osReleasePaths are the locations of os-release, in order of precedence.
+var osReleasePaths = []string{"etc/os-release", "usr/lib/os-release"}
+
+// OSRelease is the identity of the distribution an image is built from.
+type OSRelease struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name,omitempty"`
+	PrettyName string `json:"prettyName,omitempty"`
+	VersionID  string `json:"versionID,omitempty"`
+}
+
+// Package is a package installed in an image.
+type Package struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	Architecture  string `json:"architecture,omitempty"`
+	Origin        string `json:"origin,omitempty"`
+	License       string `json:"license,omitempty"`
+	InstalledSize uint64 `json:"installedSize"`
+	// Files is the number of files the package installed.
+	Files int `json:"files"`
+}
+
+// File is a file in the filesystem of an image.
+type File struct {
+	Path string `json:"path"`
+	// Package is the name of the package which installed the file, empty
+	// if it was not installed by a package.
+	Package string `json:"package,omitempty"`
+	Size    int64  `json:"size"`
+}
+
+// Report describes an image.
+type Report struct {
+	Architecture string     `json:"architecture"`
+	OSRelease    *OSRelease `json:"osRelease,omitempty"`
+	Config       v1.Config  `json:"config"`
+	Packages     []Package  `json:"packages"`
+	// Files is only set when the files are asked for, as there are many.
+	Files []File `json:"files,omitempty"`
+	// InstalledSize is the installed size of all packages, in bytes.
+	InstalledSize uint64 `json:"installedSize"`
+}
+
+// Load returns the report of the image for an architecture from src, which
+// may be a directory containing an OCI layout, an image tarball or an image
+// reference.
+func Load(ctx context.Context, src string, arch types.Architecture, files bool, opts ...remote.Option) (*Report, error) {
+	img, err := oci.ReadImage(ctx, src, arch, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return Inspect(img, files)
+}
+
+// Inspect returns the report of an image, reading its configuration, its apk
+// installed database and its os-release, and listing its files if files is
+// set.
+func Inspect(img v1.Image, files bool) (*Report, error) {
+	cf, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("reading image config: %w", err)
+	}
+	r := &Report{Config: cf.Config}
+	if p := cf.Platform(); p != nil {
+		r.Architecture = p.Architecture
+		if p.Variant != "" {
+			r.Architecture += "/" + p.Variant
+		}
+	}
+
+	var db oci.InstalledDB
+	releases := map[string][]byte{}
+	if err := oci.WalkFiles(img, func(p string, hdr *tar.Header, rd io.Reader) error {
+		if slices.Contains(osReleasePaths, p) && hdr.Typeflag == tar.TypeReg {
+			b, err := io.ReadAll(rd)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", p, err)
+			}
+			releases[p] = b
+		}
+		if files && hdr.Typeflag != tar.TypeDir {
+			r.Files = append(r.Files, File{Path: p, Size: hdr.Size})
+		}
+		return db.Collect(p, hdr, rd)
+	}); err != nil {
+		return nil, err
+	}
+
+	installed, err := db.Packages()
+	if err != nil {
+		return nil, err
+	}
+	owners := map[string]string{}
+	for _, p := range installed {
+		pkg := Package{
+			Name:          p.Name,
+			Version:       p.Version,
+			Architecture:  p.Arch,
+			Origin:        p.Origin,
+			License:       p.License,
+			InstalledSize: p.InstalledSize,
+		}
+		for _, f := range p.Files {
+			if f.Typeflag != tar.TypeDir {
+				pkg.Files++
+				owners[f.Name] = p.Name
+			}
+		}
+		r.Packages = append(r.Packages, pkg)
+		r.InstalledSize += p.InstalledSize
+	}
+	slices.SortFunc(r.Packages, func(a, b Package) int { return strings.Compare(a.Name, b.Name) })
+
+	for i := range r.Files {
+		r.Files[i].Package = owners[r.Files[i].Path]
+	}
+	slices.SortFunc(r.Files, func(a, b File) int { return strings.Compare(a.Path, b.Path) })
+
+	for _, p := range osReleasePaths {
+		if b, ok := releases[p]; ok {
+			rd, err := build.ParseReleaseData(bytes.NewReader(b))
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", p, err)
+			}
+			r.OSRelease = &OSRelease{
+				ID:         rd.ID,
+				Name:       rd.Name,
+				PrettyName: rd.PrettyName,
+				VersionID:  rd.VersionID,
+			}
+			break
+		}
+	}
+	return r, nil
+}
+
+// WriteJSON writes the report as JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes the report in a human readable form, with the packages
+// and files as tables.
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "architecture:\t%s\n", orNone(r.Architecture))
+	fmt.Fprintf(tw, "os:\t%s\n", r.OSRelease.describe())
+	fmt.Fprintf(tw, "entrypoint:\t%s\n", orNone(strings.Join(r.Config.Entrypoint, " ")))
+	fmt.Fprintf(tw, "cmd:\t%s\n", orNone(strings.Join(r.Config.Cmd, " ")))
+	fmt.Fprintf(tw, "user:\t%s\n", orNone(r.Config.User))
+	fmt.Fprintf(tw, "working dir:\t%s\n", orNone(r.Config.WorkingDir))
+	for i, env := range r.Config.Env {
+		label := ""
+		if i == 0 {
+			label = "environment:"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", label, env)
+	}
+	for i, k := range slices.Sorted(maps.Keys(r.Config.Labels)) {
+		label := ""
+		if i == 0 {
+			label = "labels:"
+		}
+		fmt.Fprintf(tw, "%s\t%s=%s\n", label, k, r.Config.Labels[k])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVERSION\tORIGIN\tLICENSE\tSIZE\tFILES")
+	for _, p := range r.Packages {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", p.Name, p.Version, p.Origin, p.License, humanize.Bytes(p.InstalledSize), p.Files)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d packages, %s installed\n", len(r.Packages), humanize.Bytes(r.InstalledSize))
+
+	if len(r.Files) != 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PATH\tPACKAGE\tSIZE")
+		for _, f := range r.Files {
+			fmt.Fprintf(tw, "/%s\t%s\t%s\n", f.Path, orNone(f.Package), humanize.Bytes(uint64(f.Size))) //nolint:gosec
+		}
+		return tw.Flush()
+	}
+	return nil
+}
+
+// describe returns the pretty name of the distribution, or its name and
+// version.
+func (o *OSRelease) describe() string {
+	switch {
+	case o == nil:
+		return "(none)"
+	case o.PrettyName != "":
+		return o.PrettyName
+	default:
+		return orNone(strings.TrimSpace(o.Name + " " + o.VersionID))
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
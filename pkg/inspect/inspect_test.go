@@ -0,0 +1,141 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inspect
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/stretchr/testify/require"
+)
+
+const installed = `C:Q1kavxlyJ9L+cdAW9My2ixbJybJ2g=
+P:busybox
+V:1.36.1-r5
+A:x86_64
+I:900
+o:busybox
+L:GPL-2.0-only
+F:bin
+R:busybox
+
+P:ca-certificates-bundle
+V:20240315-r0
+A:x86_64
+I:200
+o:ca-certificates
+L:MPL-2.0
+F:etc/ssl/certs
+R:ca-certificates.crt
+
+`
+
+const osRelease = `ID=wolfi
+NAME="Wolfi"
+PRETTY_NAME="Wolfi"
+VERSION_ID="20230201"
+`
+
+func testImage(t *testing.T) v1.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name, body string
+	}{
+		{"bin/busybox", "#!busybox"},
+		{"etc/os-release", osRelease},
+		{"etc/ssl/certs/ca-certificates.crt", "certs"},
+		{"lib/apk/db/installed", installed},
+		{"tmp/scratch", "x"},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.body))}))
+		_, err := tw.Write([]byte(f.body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	require.NoError(t, err)
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	require.NoError(t, err)
+	cf, err := img.ConfigFile()
+	require.NoError(t, err)
+	cf = cf.DeepCopy()
+	cf.Architecture, cf.OS = "amd64", "linux"
+	cf.Config = v1.Config{Entrypoint: []string{"/bin/sh", "-l"}, User: "65532"}
+	img, err = mutate.ConfigFile(img, cf)
+	require.NoError(t, err)
+	return img
+}
+
+func TestInspect(t *testing.T) {
+	r, err := Inspect(testImage(t), true)
+	require.NoError(t, err)
+
+	require.Equal(t, "amd64", r.Architecture)
+	require.Equal(t, &OSRelease{ID: "wolfi", Name: "Wolfi", PrettyName: "Wolfi", VersionID: "20230201"}, r.OSRelease)
+	require.Equal(t, []string{"/bin/sh", "-l"}, r.Config.Entrypoint)
+	require.Equal(t, []Package{
+		{Name: "busybox", Version: "1.36.1-r5", Architecture: "x86_64", Origin: "busybox", License: "GPL-2.0-only", InstalledSize: 900, Files: 1},
+		{Name: "ca-certificates-bundle", Version: "20240315-r0", Architecture: "x86_64", Origin: "ca-certificates", License: "MPL-2.0", InstalledSize: 200, Files: 1},
+	}, r.Packages)
+	require.Equal(t, uint64(1100), r.InstalledSize)
+	require.Equal(t, []File{
+		{Path: "bin/busybox", Package: "busybox", Size: 9},
+		{Path: "etc/os-release", Size: int64(len(osRelease))},
+		{Path: "etc/ssl/certs/ca-certificates.crt", Package: "ca-certificates-bundle", Size: 5},
+		{Path: "lib/apk/db/installed", Size: int64(len(installed))},
+		{Path: "tmp/scratch", Size: 1},
+	}, r.Files)
+
+	r, err = Inspect(testImage(t), false)
+	require.NoError(t, err)
+	require.Empty(t, r.Files)
+}
+
+func TestInspectNoDatabase(t *testing.T) {
+	_, err := Inspect(empty.Image, false)
+	require.ErrorContains(t, err, "no apk installed database")
+}
+
+func TestWriteText(t *testing.T) {
+	r, err := Inspect(testImage(t), false)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	require.Equal(t, `architecture:  amd64
+os:            Wolfi
+entrypoint:    /bin/sh -l
+cmd:           (none)
+user:          65532
+working dir:   (none)
+
+NAME                    VERSION      ORIGIN           LICENSE       SIZE   FILES
+busybox                 1.36.1-r5    busybox          GPL-2.0-only  900 B  1
+ca-certificates-bundle  20240315-r0  ca-certificates  MPL-2.0       200 B  1
+
+2 packages, 1.1 kB installed
+`, buf.String())
+}
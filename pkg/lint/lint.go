@@ -0,0 +1,285 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lint checks image configurations for common mistakes, and suggests
+// how to fix them.
+package lint
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+// The IDs of the rules.
+const (
+	// RuleUnpinnedPackage finds packages without a version when the
+	// configuration has a lockfile.
+	RuleUnpinnedPackage = "unpinned-package"
+	// RuleRepositoryWithoutKeys finds repositories none of the keys of the
+	// keyring can be for, and whose keys are not discovered.
+	RuleRepositoryWithoutKeys = "repository-without-keys"
+	// RuleEntrypointNotProvided finds entrypoints whose command no resolved
+	// package provides.
+	RuleEntrypointNotProvided = "entrypoint-not-provided"
+	// RuleMissingGroup finds users whose group is not in the accounts.
+	RuleMissingGroup = "missing-group"
+)
+
+// Finding is a mistake found in a configuration.
+type Finding struct {
+	// Rule is the ID of the rule which found the mistake.
+	Rule string `json:"rule"`
+	// Path is the JSON pointer (RFC 6901) of what the finding is about in
+	// the configuration, e.g. /contents/packages/2.
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	Fix     *Fix   `json:"fix,omitempty"`
+}
+
+// Fix is a suggested fix of a finding.
+type Fix struct {
+	Description string `json:"description"`
+	// Patch is the JSON patch (RFC 6902) of the configuration which applies
+	// the fix, when it can be applied mechanically.
+	Patch []PatchOperation `json:"patch,omitempty"`
+}
+
+// PatchOperation is an operation of a JSON patch.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value,omitempty"`
+}
+
+// Input is a configuration and what is known about its build.
+type Input struct {
+	// Config is the configuration, with its includes resolved. The paths of
+	// the findings are in it.
+	Config *types.ImageConfiguration
+	// Lock is the lockfile of the configuration, nil if it has none.
+	Lock *lock.Lock
+	// Resolved are the packages resolved for each architecture, and
+	// Available the packages of the repositories. The entrypoint is only
+	// checked when the packages were resolved.
+	Resolved  map[types.Architecture][]*apk.RepositoryPackage
+	Available map[types.Architecture][]*apk.RepositoryPackage
+	// KeysDiscovered reports whether the keys of a repository are found
+	// without the keyring. When nil, they are assumed not to be.
+	KeysDiscovered func(repository string) bool
+}
+
+// Config returns the findings of every rule in the configuration of in.
+func Config(in Input) []Finding {
+	var findings []Finding
+	findings = append(findings, unpinnedPackages(in)...)
+	findings = append(findings, repositoriesWithoutKeys(in)...)
+	findings = append(findings, entrypointNotProvided(in)...)
+	findings = append(findings, missingGroups(in)...)
+	return findings
+}
+
+func unpinnedPackages(in Input) []Finding {
+	if in.Lock == nil {
+		return nil
+	}
+	// The versions of each package in the lockfile, in any architecture.
+	locked := map[string][]string{}
+	for _, p := range in.Lock.Contents.Packages {
+		if !slices.Contains(locked[p.Name], p.Version) {
+			locked[p.Name] = append(locked[p.Name], p.Version)
+		}
+	}
+
+	var findings []Finding
+	for i, pkg := range in.Config.Contents.Packages {
+		if strings.ContainsAny(pkg, "=<>~") {
+			continue
+		}
+		f := Finding{
+			Rule:    RuleUnpinnedPackage,
+			Path:    fmt.Sprintf("/contents/packages/%d", i),
+			Message: fmt.Sprintf("package %q has no version, so builds without the lockfile may install another version than it locks", pkg),
+		}
+		name, tag, _ := strings.Cut(pkg, "@")
+		switch versions := locked[name]; {
+		case len(versions) == 0:
+			f.Fix = &Fix{Description: fmt.Sprintf("%q is not in the lockfile, regenerate it with apko lock", name)}
+		case len(versions) > 1:
+			f.Fix = &Fix{Description: fmt.Sprintf("pin %q to a version; the lockfile has %s for different architectures", name, strings.Join(versions, ", "))}
+		default:
+			pinned := name + "=" + versions[0]
+			if tag != "" {
+				pinned += "@" + tag
+			}
+			f.Fix = &Fix{
+				Description: fmt.Sprintf("pin the locked version with %q", pinned),
+				Patch:       []PatchOperation{{Op: "replace", Path: f.Path, Value: pinned}},
+			}
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+func repositoriesWithoutKeys(in Input) []Finding {
+	contents := in.Config.Contents
+	keyHosts := map[string]bool{}
+	for _, key := range contents.Keyring {
+		u, err := url.Parse(key)
+		if err != nil || u.Host == "" {
+			// A local key may be for any of the repositories.
+			return nil
+		}
+		keyHosts[u.Host] = true
+	}
+
+	var findings []Finding
+	check := func(field string, repos []string) {
+		for i, repo := range repos {
+			// Strip the tag of tagged repositories, "@tag <repository>".
+			if strings.HasPrefix(repo, "@") {
+				_, repo, _ = strings.Cut(repo, " ")
+				repo = strings.TrimSpace(repo)
+			}
+			u, err := url.Parse(repo)
+			if err != nil {
+				continue
+			}
+			if keyHosts[u.Host] || allowsUnsigned(contents.SignaturePolicies, repo) {
+				continue
+			}
+			if in.KeysDiscovered != nil && in.KeysDiscovered(repo) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Rule:    RuleRepositoryWithoutKeys,
+				Path:    fmt.Sprintf("/contents/%s/%d", field, i),
+				Message: fmt.Sprintf("no key of the keyring is for repository %s, and none are discovered, so its index cannot be verified", repo),
+				Fix:     &Fix{Description: "add the key which signs the repository to contents.keyring"},
+			})
+		}
+	}
+	check("build_repositories", contents.BuildRepositories)
+	check("repositories", contents.RuntimeRepositories)
+	return findings
+}
+
+// allowsUnsigned reports whether a signature policy allows the repository to
+// be unsigned.
+func allowsUnsigned(policies []types.SignaturePolicy, repo string) bool {
+	for _, p := range policies {
+		if p.AllowUnsigned && strings.HasPrefix(strings.TrimSuffix(repo, "/")+"/", strings.TrimSuffix(p.Repository, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func entrypointNotProvided(in Input) []Finding {
+	ep := in.Config.Entrypoint
+	fields := strings.Fields(ep.Command)
+	if ep.Type != "" || len(fields) == 0 || len(in.Resolved) == 0 {
+		return nil
+	}
+	command := fields[0]
+	// The command may be created by a path mutation instead.
+	for _, p := range in.Config.Paths {
+		if strings.TrimPrefix(p.Path, "/") == strings.TrimPrefix(command, "/") {
+			return nil
+		}
+	}
+	cmd := "cmd:" + path.Base(command)
+
+	var archs []string
+	candidates := map[string]bool{}
+	for arch, pkgs := range in.Resolved {
+		if slices.ContainsFunc(pkgs, func(p *apk.RepositoryPackage) bool { return provides(p, cmd) }) {
+			continue
+		}
+		archs = append(archs, arch.String())
+		for _, p := range in.Available[arch] {
+			if provides(p, cmd) {
+				candidates[p.Name] = true
+			}
+		}
+	}
+	if len(archs) == 0 {
+		return nil
+	}
+	slices.Sort(archs)
+
+	f := Finding{
+		Rule:    RuleEntrypointNotProvided,
+		Path:    "/entrypoint/command",
+		Message: fmt.Sprintf("no package provides %s, the command of the entrypoint, for %s", command, strings.Join(archs, ", ")),
+		Fix:     &Fix{Description: fmt.Sprintf("add a package which provides %s to contents.packages", cmd)},
+	}
+	if len(candidates) > 0 {
+		names := make([]string, 0, len(candidates))
+		for name := range candidates {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		f.Fix = &Fix{
+			Description: fmt.Sprintf("add %s, which provides %s, to contents.packages", names[0], cmd),
+			Patch:       []PatchOperation{{Op: "add", Path: "/contents/packages/-", Value: names[0]}},
+		}
+		if len(names) > 1 {
+			f.Fix.Description += fmt.Sprintf(" (also provided by %s)", strings.Join(names[1:], ", "))
+		}
+	}
+	return []Finding{f}
+}
+
+// provides reports whether p provides name, e.g. cmd:sh.
+func provides(p *apk.RepositoryPackage, name string) bool {
+	return slices.ContainsFunc(p.Provides, func(provided string) bool {
+		provided, _, _ = strings.Cut(provided, "=")
+		return provided == name
+	})
+}
+
+func missingGroups(in Input) []Finding {
+	accounts := in.Config.Accounts
+	var findings []Finding
+	for i, u := range accounts.Users {
+		// The group of a user defaults to the one with its UID.
+		gid := u.UID
+		if u.GID != nil {
+			gid = *u.GID
+		}
+		// The root group comes with the base layout of the image.
+		if gid == 0 || slices.ContainsFunc(accounts.Groups, func(g types.Group) bool { return g.GID == gid }) {
+			continue
+		}
+		group := types.Group{GroupName: u.UserName, GID: gid, Members: []string{u.UserName}}
+		findings = append(findings, Finding{
+			Rule:    RuleMissingGroup,
+			Path:    fmt.Sprintf("/accounts/users/%d", i),
+			Message: fmt.Sprintf("user %q is in group %d, which is not in accounts.groups", u.UserName, gid),
+			Fix: &Fix{
+				Description: fmt.Sprintf("add group %q with GID %d to accounts.groups", group.GroupName, gid),
+				Patch:       []PatchOperation{{Op: "add", Path: "/accounts/groups/-", Value: group}},
+			},
+		})
+	}
+	return findings
+}
@@ -0,0 +1,194 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+)
+
+func pkg(name string, provides ...string) *apk.RepositoryPackage {
+	return &apk.RepositoryPackage{Package: &apk.Package{Name: name, Provides: provides}}
+}
+
+func TestConfig(t *testing.T) {
+	amd64, arm64 := types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")
+	gid := uint32(1000)
+
+	for _, tt := range []struct {
+		name string
+		in   Input
+		want []Finding
+	}{{
+		name: "clean",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Contents: types.ImageContents{
+					RuntimeRepositories: []string{"https://packages.wolfi.dev/os"},
+					Keyring:             []string{"https://packages.wolfi.dev/os/wolfi-signing.rsa.pub"},
+					Packages:            []string{"busybox=1.36-r0"},
+				},
+				Entrypoint: types.ImageEntrypoint{Command: "/bin/sh -l"},
+				Accounts: types.ImageAccounts{
+					Users:  []types.User{{UserName: "nonroot", UID: 65532}, {UserName: "root"}},
+					Groups: []types.Group{{GroupName: "nonroot", GID: 65532}},
+				},
+			},
+			Lock:     &lock.Lock{},
+			Resolved: map[types.Architecture][]*apk.RepositoryPackage{amd64: {pkg("busybox", "cmd:sh=1.36-r0")}},
+		},
+	}, {
+		name: "unpinned packages",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Contents: types.ImageContents{Packages: []string{"busybox", "git~2", "tzdata@local", "go", "missing"}},
+			},
+			Lock: &lock.Lock{Contents: lock.LockContents{Packages: []lock.LockPkg{
+				{Name: "busybox", Version: "1.36-r0", Architecture: "x86_64"},
+				{Name: "busybox", Version: "1.36-r0", Architecture: "aarch64"},
+				{Name: "tzdata", Version: "2024a-r0", Architecture: "x86_64"},
+				{Name: "go", Version: "1.22-r0", Architecture: "x86_64"},
+				{Name: "go", Version: "1.22-r1", Architecture: "aarch64"},
+			}}},
+		},
+		want: []Finding{{
+			Rule: RuleUnpinnedPackage, Path: "/contents/packages/0",
+			Message: `package "busybox" has no version, so builds without the lockfile may install another version than it locks`,
+			Fix: &Fix{
+				Description: `pin the locked version with "busybox=1.36-r0"`,
+				Patch:       []PatchOperation{{Op: "replace", Path: "/contents/packages/0", Value: "busybox=1.36-r0"}},
+			},
+		}, {
+			Rule: RuleUnpinnedPackage, Path: "/contents/packages/2",
+			Message: `package "tzdata@local" has no version, so builds without the lockfile may install another version than it locks`,
+			Fix: &Fix{
+				Description: `pin the locked version with "tzdata=2024a-r0@local"`,
+				Patch:       []PatchOperation{{Op: "replace", Path: "/contents/packages/2", Value: "tzdata=2024a-r0@local"}},
+			},
+		}, {
+			Rule: RuleUnpinnedPackage, Path: "/contents/packages/3",
+			Message: `package "go" has no version, so builds without the lockfile may install another version than it locks`,
+			Fix:     &Fix{Description: `pin "go" to a version; the lockfile has 1.22-r0, 1.22-r1 for different architectures`},
+		}, {
+			Rule: RuleUnpinnedPackage, Path: "/contents/packages/4",
+			Message: `package "missing" has no version, so builds without the lockfile may install another version than it locks`,
+			Fix:     &Fix{Description: `"missing" is not in the lockfile, regenerate it with apko lock`},
+		}},
+	}, {
+		name: "unpinned packages without lockfile",
+		in: Input{
+			Config: &types.ImageConfiguration{Contents: types.ImageContents{Packages: []string{"busybox"}}},
+		},
+	}, {
+		name: "repositories without keys",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Contents: types.ImageContents{
+					BuildRepositories:   []string{"@local https://example.com/local"},
+					RuntimeRepositories: []string{"https://packages.wolfi.dev/os", "https://example.com/os", "https://discovered.example.com/os", "https://unsigned.example.com/os/"},
+					Keyring:             []string{"https://packages.wolfi.dev/os/wolfi-signing.rsa.pub"},
+					SignaturePolicies:   []types.SignaturePolicy{{Repository: "https://unsigned.example.com/os", AllowUnsigned: true}},
+				},
+			},
+			KeysDiscovered: func(repo string) bool { return repo == "https://discovered.example.com/os" },
+		},
+		want: []Finding{{
+			Rule: RuleRepositoryWithoutKeys, Path: "/contents/build_repositories/0",
+			Message: "no key of the keyring is for repository https://example.com/local, and none are discovered, so its index cannot be verified",
+			Fix:     &Fix{Description: "add the key which signs the repository to contents.keyring"},
+		}, {
+			Rule: RuleRepositoryWithoutKeys, Path: "/contents/repositories/1",
+			Message: "no key of the keyring is for repository https://example.com/os, and none are discovered, so its index cannot be verified",
+			Fix:     &Fix{Description: "add the key which signs the repository to contents.keyring"},
+		}},
+	}, {
+		name: "repositories with local keys",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Contents: types.ImageContents{
+					RuntimeRepositories: []string{"https://example.com/os"},
+					Keyring:             []string{"keys/example.rsa.pub"},
+				},
+			},
+		},
+	}, {
+		name: "entrypoint not provided",
+		in: Input{
+			Config: &types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/nginx -g 'daemon off;'"}},
+			Resolved: map[types.Architecture][]*apk.RepositoryPackage{
+				amd64: {pkg("busybox", "cmd:sh")},
+				arm64: {pkg("nginx", "cmd:nginx=1.25-r0")},
+			},
+			Available: map[types.Architecture][]*apk.RepositoryPackage{
+				amd64: {pkg("busybox", "cmd:sh"), pkg("nginx-mainline", "cmd:nginx=1.27-r0"), pkg("nginx", "cmd:nginx=1.25-r0")},
+			},
+		},
+		want: []Finding{{
+			Rule: RuleEntrypointNotProvided, Path: "/entrypoint/command",
+			Message: "no package provides /usr/bin/nginx, the command of the entrypoint, for amd64",
+			Fix: &Fix{
+				Description: "add nginx, which provides cmd:nginx, to contents.packages (also provided by nginx-mainline)",
+				Patch:       []PatchOperation{{Op: "add", Path: "/contents/packages/-", Value: "nginx"}},
+			},
+		}},
+	}, {
+		name: "entrypoint without candidates",
+		in: Input{
+			Config:   &types.ImageConfiguration{Entrypoint: types.ImageEntrypoint{Command: "app"}},
+			Resolved: map[types.Architecture][]*apk.RepositoryPackage{amd64: {pkg("busybox", "cmd:sh")}},
+		},
+		want: []Finding{{
+			Rule: RuleEntrypointNotProvided, Path: "/entrypoint/command",
+			Message: "no package provides app, the command of the entrypoint, for amd64",
+			Fix:     &Fix{Description: "add a package which provides cmd:app to contents.packages"},
+		}},
+	}, {
+		name: "entrypoint from paths",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Entrypoint: types.ImageEntrypoint{Command: "/usr/bin/app"},
+				Paths:      []types.PathMutation{{Path: "usr/bin/app", Type: "symlink", Source: "/bin/busybox"}},
+			},
+			Resolved: map[types.Architecture][]*apk.RepositoryPackage{amd64: {pkg("busybox", "cmd:sh")}},
+		},
+	}, {
+		name: "missing groups",
+		in: Input{
+			Config: &types.ImageConfiguration{
+				Accounts: types.ImageAccounts{
+					Users:  []types.User{{UserName: "nonroot", UID: 65532}, {UserName: "build", UID: 1001, GID: &gid}, {UserName: "www", UID: 1000}},
+					Groups: []types.Group{{GroupName: "www", GID: 1000}},
+				},
+			},
+		},
+		want: []Finding{{
+			Rule: RuleMissingGroup, Path: "/accounts/users/0",
+			Message: `user "nonroot" is in group 65532, which is not in accounts.groups`,
+			Fix: &Fix{
+				Description: `add group "nonroot" with GID 65532 to accounts.groups`,
+				Patch:       []PatchOperation{{Op: "add", Path: "/accounts/groups/-", Value: types.Group{GroupName: "nonroot", GID: 65532, Members: []string{"nonroot"}}}},
+			},
+		}},
+	}} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Config(tt.in))
+		})
+	}
+}
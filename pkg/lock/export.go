@@ -0,0 +1,209 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/sbom/generator/cyclonedx"
+)
+
+// ExportFormats are the formats a lock can be exported to.
+var ExportFormats = []string{"cyclonedx", "slsa-resolved-deps", "plain"}
+
+// Export writes the locked packages to w in one of ExportFormats, so they can
+// be consumed by tools which do not understand the lock format. Package URLs
+// are qualified with namespace, the distribution of the packages, if it is set.
+func (lock Lock) Export(w io.Writer, format, namespace string) error {
+	switch format {
+	case "cyclonedx":
+		return lock.writeCycloneDX(w, namespace)
+	case "slsa-resolved-deps":
+		return lock.writeResolvedDependencies(w, namespace)
+	case "plain":
+		return lock.writePlain(w)
+	default:
+		return fmt.Errorf("unsupported format %q, must be one of: %s", format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+// PackageURL returns the package URL of a locked package.
+func (p LockPkg) PackageURL(namespace string) string {
+	return purl.NewPackageURL("apk", namespace, p.Name, p.Version,
+		purl.QualifiersFromMap(map[string]string{"arch": p.Architecture}), "").ToString()
+}
+
+// writePlain writes the packages as name=version, the way they are given to
+// apk, with a comment before the packages of each architecture if there is
+// more than one.
+func (lock Lock) writePlain(w io.Writer) error {
+	var archs []string
+	byArch := map[string][]LockPkg{}
+	for _, p := range lock.Contents.Packages {
+		if _, ok := byArch[p.Architecture]; !ok {
+			archs = append(archs, p.Architecture)
+		}
+		byArch[p.Architecture] = append(byArch[p.Architecture], p)
+	}
+	for i, arch := range archs {
+		if len(archs) > 1 {
+			sep := ""
+			if i > 0 {
+				sep = "\n"
+			}
+			if _, err := fmt.Fprintf(w, "%s# %s\n", sep, arch); err != nil {
+				return err
+			}
+		}
+		for _, p := range byArch[arch] {
+			if _, err := fmt.Fprintf(w, "%s=%s\n", p.Name, p.Version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type cdxBOM struct {
+	BOMFormat   string         `json:"bomFormat"`
+	SpecVersion string         `json:"specVersion"`
+	Version     int            `json:"version"`
+	Metadata    cdxMetadata    `json:"metadata"`
+	Components  []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Tools cdxTools `json:"tools"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Type               string           `json:"type"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// writeCycloneDX writes the packages as the components of a CycloneDX BOM.
+func (lock Lock) writeCycloneDX(w io.Writer, namespace string) error {
+	bom := cdxBOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: cyclonedx.SpecVersion,
+		Version:     1,
+		Metadata: cdxMetadata{
+			Tools: cdxTools{Components: []cdxComponent{{Type: "application", Name: "apko"}}},
+		},
+		Components: make([]cdxComponent, 0, len(lock.Contents.Packages)),
+	}
+	for _, p := range lock.Contents.Packages {
+		ref := p.PackageURL(namespace)
+		bom.Components = append(bom.Components, cdxComponent{
+			BOMRef:             ref,
+			Type:               "library",
+			Name:               p.Name,
+			Version:            p.Version,
+			PURL:               ref,
+			ExternalReferences: []cdxExternalRef{{Type: "distribution", URL: p.URL}},
+			Properties: []cdxProperty{
+				{Name: "apko:checksum", Value: p.Checksum},
+				{Name: "apko:control-checksum", Value: p.Control.Checksum},
+				{Name: "apko:data-checksum", Value: p.Data.Checksum},
+			},
+		})
+	}
+	return writeJSON(w, bom)
+}
+
+// resourceDescriptor is an in-toto ResourceDescriptor, as used for the
+// resolvedDependencies of SLSA provenance.
+type resourceDescriptor struct {
+	URI         string            `json:"uri"`
+	Name        string            `json:"name,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// writeResolvedDependencies writes the keys, indexes and packages as the
+// resolvedDependencies of SLSA provenance. Keys and indexes have the digest
+// of their file, since lock version v2; the checksums of packages are those
+// of their sections, so they are annotations instead.
+func (lock Lock) writeResolvedDependencies(w io.Writer, namespace string) error {
+	deps := []resourceDescriptor{}
+	for _, k := range lock.Contents.Keyrings {
+		deps = append(deps, resourceDescriptor{URI: k.URL, Name: k.Name, Digest: sha256Digest(k.Checksum)})
+	}
+	for _, r := range slices.Concat(lock.Contents.BuildRepositories, lock.Contents.RuntimeRepositories) {
+		deps = append(deps, resourceDescriptor{URI: r.URL, Name: r.Name, Digest: sha256Digest(r.Checksum)})
+	}
+	for _, p := range lock.Contents.Packages {
+		deps = append(deps, resourceDescriptor{
+			URI:  p.URL,
+			Name: p.Name,
+			Annotations: map[string]string{
+				"purl":            p.PackageURL(namespace),
+				"version":         p.Version,
+				"architecture":    p.Architecture,
+				"checksum":        p.Checksum,
+				"controlChecksum": p.Control.Checksum,
+				"dataChecksum":    p.Data.Checksum,
+			},
+		})
+	}
+	return writeJSON(w, deps)
+}
+
+// sha256Digest converts a checksum from the lock file to an in-toto digest
+// set, or nil if it is not set.
+func sha256Digest(checksum string) map[string]string {
+	b64, ok := strings.CutPrefix(checksum, "sha256-")
+	if !ok {
+		return nil
+	}
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil
+	}
+	return map[string]string{"sha256": hex.EncodeToString(b)}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/sbom/generator/cyclonedx"
+)
+
+func testLock() Lock {
+	return Lock{
+		Version: Version,
+		Contents: LockContents{
+			Keyrings: []LockKeyring{{
+				Name:     "wolfi-signing.rsa.pub",
+				URL:      "https://packages.wolfi.dev/os/wolfi-signing.rsa.pub",
+				ID:       "wolfi-signing.rsa.pub",
+				Checksum: "sha256-AQID",
+			}},
+			RuntimeRepositories: []LockRepo{{
+				Name:         "packages.wolfi.dev/os/x86_64",
+				URL:          "https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz",
+				Architecture: "x86_64",
+			}},
+			Packages: []LockPkg{{
+				Name:         "busybox",
+				URL:          "https://packages.wolfi.dev/os/x86_64/busybox-1.36.1-r2.apk",
+				Version:      "1.36.1-r2",
+				Architecture: "x86_64",
+				Checksum:     "Q1AQID",
+			}, {
+				Name:         "busybox",
+				URL:          "https://packages.wolfi.dev/os/aarch64/busybox-1.36.1-r2.apk",
+				Version:      "1.36.1-r2",
+				Architecture: "aarch64",
+				Checksum:     "Q1BAUG",
+			}},
+		},
+	}
+}
+
+func TestExportPlain(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testLock().Export(&buf, "plain", ""))
+	require.Equal(t, "# x86_64\nbusybox=1.36.1-r2\n\n# aarch64\nbusybox=1.36.1-r2\n", buf.String())
+}
+
+// failingWriter fails once n bytes are written.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestExportPlainWriteError(t *testing.T) {
+	// the comment of the second architecture does not fit
+	require.ErrorContains(t, testLock().Export(&failingWriter{n: 30}, "plain", ""), "disk full")
+}
+
+func TestExportCycloneDX(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testLock().Export(&buf, "cyclonedx", "wolfi"))
+
+	var bom cdxBOM
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &bom))
+	require.Equal(t, "CycloneDX", bom.BOMFormat)
+	require.Equal(t, cyclonedx.SpecVersion, bom.SpecVersion)
+	require.Len(t, bom.Components, 2)
+	require.Equal(t, "pkg:apk/wolfi/busybox@1.36.1-r2?arch=x86_64", bom.Components[0].PURL)
+	require.Equal(t, "https://packages.wolfi.dev/os/aarch64/busybox-1.36.1-r2.apk", bom.Components[1].ExternalReferences[0].URL)
+}
+
+func TestExportResolvedDependencies(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testLock().Export(&buf, "slsa-resolved-deps", ""))
+
+	var deps []resourceDescriptor
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &deps))
+	require.Len(t, deps, 4)
+	require.Equal(t, map[string]string{"sha256": "010203"}, deps[0].Digest)
+	// The index has no checksum in the lock.
+	require.Nil(t, deps[1].Digest)
+	require.Equal(t, "pkg:apk/busybox@1.36.1-r2?arch=x86_64", deps[2].Annotations["purl"])
+	require.Equal(t, "Q1BAUG", deps[3].Annotations["checksum"])
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	require.ErrorContains(t, testLock().Export(&bytes.Buffer{}, "spdx", ""), `unsupported format "spdx"`)
+}
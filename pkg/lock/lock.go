@@ -1,14 +1,21 @@
 package lock
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"slices"
 
+	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build/types"
 )
 
+// Version is the version of the lock format written by apko. Since v2, the
+// keys and repository indexes used to resolve the packages are recorded with
+// their checksums.
+const Version = "v2"
+
 type Lock struct {
 	Version  string       `json:"version"`
 	Config   *Config      `json:"config,omitempty"`
@@ -21,6 +28,9 @@ type Config struct {
 	Name string `json:"name,omitempty"`
 	// This checksum also covers included files and command-line settings that influence the artifacts resolution.
 	DeepChecksum string `json:"checksum,omitempty"`
+	// Digest is the digest of the effective configuration, once includes,
+	// variant and build arguments are applied, as annotated on the images.
+	Digest string `json:"digest,omitempty"`
 }
 
 type LockContents struct {
@@ -53,11 +63,28 @@ type LockRepo struct {
 	Name         string `json:"name"`
 	URL          string `json:"url"`
 	Architecture string `json:"architecture"`
+	// Checksum is the SHA256 of the APKINDEX.tar.gz the packages were resolved from.
+	// Populated since lock version v2.
+	Checksum string `json:"checksum,omitempty"`
+	// Verification is how the signature of the index was verified when the
+	// packages were resolved from it, or why it was not.
+	Verification *apk.Verification `json:"verification,omitempty"`
 }
 
 type LockKeyring struct {
 	Name string `json:"name"`
 	URL  string `json:"url"`
+	// ID is the name of the key in /etc/apk/keys, which signatures refer to.
+	// Populated since lock version v2.
+	ID string `json:"id,omitempty"`
+	// Checksum is the SHA256 of the key.
+	// Populated since lock version v2.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// SHA256Checksum formats a SHA256 digest the way checksums are written in the lock file.
+func SHA256Checksum(sum []byte) string {
+	return "sha256-" + base64.StdEncoding.EncodeToString(sum)
 }
 
 func FromFile(lockFile string) (Lock, error) {
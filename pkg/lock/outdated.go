@@ -0,0 +1,130 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Update is a newer version of a locked package which is available in a
+// repository.
+type Update struct {
+	Name         string `json:"name"`
+	Architecture string `json:"architecture"`
+	Current      string `json:"current"`
+	Candidate    string `json:"candidate"`
+	// Repository is the repository the candidate is in.
+	Repository string `json:"repository"`
+	// ChangelogURL is where the changes of the project can be found, if it
+	// is hosted somewhere they can be discovered.
+	ChangelogURL string `json:"changelogURL,omitempty"`
+}
+
+// Outdated returns the packages locked for arch which have a newer version in
+// indexes, in the order they are locked.
+func (lock Lock) Outdated(arch types.Architecture, indexes []apk.NamedIndex) ([]Update, error) {
+	latest := map[string]*apk.RepositoryPackage{}
+	versions := map[string]apk.Version{}
+	for _, idx := range indexes {
+		for _, pkg := range idx.Packages() {
+			v, err := apk.ParseVersion(pkg.Version)
+			if err != nil {
+				// Such a version can never be resolved, so it is not a candidate.
+				continue
+			}
+			if prev, ok := versions[pkg.Name]; !ok || apk.CompareVersions(v, prev) > 0 {
+				latest[pkg.Name] = pkg
+				versions[pkg.Name] = v
+			}
+		}
+	}
+
+	var updates []Update
+	for _, p := range lock.Contents.Packages {
+		if types.ParseArchitecture(p.Architecture) != arch {
+			continue
+		}
+		candidate, ok := latest[p.Name]
+		if !ok {
+			continue
+		}
+		current, err := apk.ParseVersion(p.Version)
+		if err != nil {
+			return nil, fmt.Errorf("parsing locked version of %s: %w", p.Name, err)
+		}
+		if apk.CompareVersions(versions[p.Name], current) <= 0 {
+			continue
+		}
+		updates = append(updates, Update{
+			Name:         p.Name,
+			Architecture: p.Architecture,
+			Current:      p.Version,
+			Candidate:    candidate.Version,
+			Repository:   candidate.Repository().URI,
+			ChangelogURL: changelogURL(candidate.Package.URL),
+		})
+	}
+	return updates, nil
+}
+
+// changelogURL returns the releases page of a project hosted on GitHub or
+// GitLab, or an empty string for anything else.
+func changelogURL(project string) string {
+	u, err := url.Parse(project)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	repo := strings.TrimSuffix(parts[1], ".git")
+	switch u.Host {
+	case "github.com", "www.github.com":
+		return fmt.Sprintf("https://github.com/%s/%s/releases", parts[0], repo)
+	case "gitlab.com":
+		return fmt.Sprintf("https://gitlab.com/%s/%s/-/releases", parts[0], repo)
+	default:
+		return ""
+	}
+}
+
+// WriteUpdatesJSON writes updates as a JSON object, for bots which turn them
+// into pull requests.
+func WriteUpdatesJSON(w io.Writer, updates []Update) error {
+	if updates == nil {
+		updates = []Update{}
+	}
+	return writeJSON(w, struct {
+		Updates []Update `json:"updates"`
+	}{updates})
+}
+
+// WriteUpdatesText writes updates as a table.
+func WriteUpdatesText(w io.Writer, updates []Update) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tARCH\tCURRENT\tCANDIDATE\tREPOSITORY")
+	for _, u := range updates {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", u.Name, u.Architecture, u.Current, u.Candidate, u.Repository)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestOutdated(t *testing.T) {
+	repo := &apk.Repository{URI: "https://packages.wolfi.dev/os/x86_64"}
+	idx := apk.NewNamedRepositoryWithIndex("", repo.WithIndex(&apk.APKIndex{
+		Packages: []*apk.Package{
+			{Name: "busybox", Version: "1.36.1-r2"},
+			{Name: "busybox", Version: "1.37.0-r0", URL: "https://github.com/mirror/busybox"},
+			{Name: "busybox", Version: "1.36.1-r7"},
+		},
+	}))
+
+	updates, err := testLock().Outdated(types.ParseArchitecture("x86_64"), []apk.NamedIndex{idx})
+	require.NoError(t, err)
+	require.Equal(t, []Update{{
+		Name:         "busybox",
+		Architecture: "x86_64",
+		Current:      "1.36.1-r2",
+		Candidate:    "1.37.0-r0",
+		Repository:   "https://packages.wolfi.dev/os/x86_64",
+		ChangelogURL: "https://github.com/mirror/busybox/releases",
+	}}, updates)
+
+	// Nothing newer is locked for aarch64 in this index.
+	updates, err = testLock().Outdated(types.ParseArchitecture("aarch64"), nil)
+	require.NoError(t, err)
+	require.Empty(t, updates)
+}
+
+func TestChangelogURL(t *testing.T) {
+	for project, want := range map[string]string{
+		"https://github.com/mirror/busybox":    "https://github.com/mirror/busybox/releases",
+		"https://gitlab.com/gnutls/gnutls.git": "https://gitlab.com/gnutls/gnutls/-/releases",
+		"https://busybox.net":                  "",
+		"https://github.com/chainguard-dev":    "",
+	} {
+		require.Equal(t, want, changelogURL(project), project)
+	}
+}
@@ -22,41 +22,89 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/policy"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
+	"chainguard.dev/apko/pkg/scan"
 )
 
 type Options struct {
 	WithVCS bool `json:"withVCS,omitempty"`
+	// VCSPath is in the Git repository to probe, instead of the directory
+	// of the configuration file, which must be within the working directory.
+	VCSPath string `json:"vcsPath,omitempty"`
+	// VCSTagPrefix selects the tags the version annotation is taken from.
+	VCSTagPrefix string `json:"vcsTagPrefix,omitempty"`
+	// ConfigDigest is the digest of the effective configuration, recorded
+	// in the annotations, SBOMs and lockfile.
+	ConfigDigest string `json:"configDigest,omitempty"`
 	// ImageConfigFile might, but does not have to be a filename. It might be any abstract configuration identifier.
 	ImageConfigFile string `json:"imageConfigFile,omitempty"`
 	// ImageConfigChecksum (when set) allows to detect mismatch between configuration and the lockfile.
-	ImageConfigChecksum     string             `json:"configChecksum,omitempty"`
-	TarballPath             string             `json:"tarballPath,omitempty"`
-	Tags                    []string           `json:"tags,omitempty"`
-	SourceDateEpoch         time.Time          `json:"sourceDateEpoch,omitempty"`
-	SBOMPath                string             `json:"sbomPath,omitempty"`
-	SBOMFormats             []string           `json:"sbomFormats,omitempty"`
-	ExtraKeyFiles           []string           `json:"extraKeyFiles,omitempty"`
-	ExtraBuildRepos         []string           `json:"extraBuildRepos,omitempty"`
-	ExtraRuntimeRepos       []string           `json:"extraRepos,omitempty"`
-	ExtraPackages           []string           `json:"extraPackages,omitempty"`
-	Arch                    types.Architecture `json:"arch,omitempty"`
-	TempDirPath             string             `json:"tempDirPath,omitempty"`
-	PackageVersionTag       string             `json:"packageVersionTag,omitempty"`
-	PackageVersionTagStem   bool               `json:"packageVersionTagStem,omitempty"`
-	PackageVersionTagPrefix string             `json:"packageVersionTagPrefix,omitempty"`
-	TagSuffix               string             `json:"tagSuffix,omitempty"`
-	Local                   bool               `json:"local,omitempty"`
-	CacheDir                string             `json:"cacheDir,omitempty"`
-	Offline                 bool               `json:"offline,omitempty"`
-	SharedCache             *apk.Cache         `json:"-"`
-	Lockfile                string             `json:"lockfile,omitempty"`
-	Auth                    auth.Authenticator `json:"-"`
-	IncludePaths            []string           `json:"includePaths,omitempty"`
-	IgnoreSignatures        bool               `json:"ignoreSignatures,omitempty"`
-	Transport               http.RoundTripper  `json:"-"`
+	ImageConfigChecksum     string                  `json:"configChecksum,omitempty"`
+	TarballPath             string                  `json:"tarballPath,omitempty"`
+	Tags                    []string                `json:"tags,omitempty"`
+	SourceDateEpoch         time.Time               `json:"sourceDateEpoch,omitempty"`
+	SBOMPath                string                  `json:"sbomPath,omitempty"`
+	SBOMFormats             []string                `json:"sbomFormats,omitempty"`
+	SBOMFiles               bool                    `json:"sbomFiles,omitempty"`
+	VEXFiles                []string                `json:"vexFiles,omitempty"`
+	SBOMAttestationKey      string                  `json:"sbomAttestationKey,omitempty"`
+	ExtraKeyFiles           []string                `json:"extraKeyFiles,omitempty"`
+	ExtraBuildRepos         []string                `json:"extraBuildRepos,omitempty"`
+	ExtraRuntimeRepos       []string                `json:"extraRepos,omitempty"`
+	ExtraPackages           []string                `json:"extraPackages,omitempty"`
+	Arch                    types.Architecture      `json:"arch,omitempty"`
+	TempDirPath             string                  `json:"tempDirPath,omitempty"`
+	PackageVersionTag       string                  `json:"packageVersionTag,omitempty"`
+	PackageVersionTagStem   bool                    `json:"packageVersionTagStem,omitempty"`
+	PackageVersionTagPrefix string                  `json:"packageVersionTagPrefix,omitempty"`
+	TagSuffix               string                  `json:"tagSuffix,omitempty"`
+	Local                   bool                    `json:"local,omitempty"`
+	CacheDir                string                  `json:"cacheDir,omitempty"`
+	Offline                 bool                    `json:"offline,omitempty"`
+	SharedCache             *apk.Cache              `json:"-"`
+	Lockfile                string                  `json:"lockfile,omitempty"`
+	Locked                  bool                    `json:"locked,omitempty"`
+	Frozen                  bool                    `json:"frozen,omitempty"`
+	Auth                    auth.Authenticator      `json:"-"`
+	IncludePaths            []string                `json:"includePaths,omitempty"`
+	IgnoreSignatures        bool                    `json:"ignoreSignatures,omitempty"`
+	UnsignedRepositories    map[string]string       `json:"unsignedRepositories,omitempty"`
+	VerifyPackageSignatures bool                    `json:"verifyPackageSignatures,omitempty"`
+	LocalIndexSynthesis     bool                    `json:"localIndexSynthesis,omitempty"`
+	CheckEntrypoint         bool                    `json:"checkEntrypoint,omitempty"`
+	PermissionsPolicy       *apk.PermissionsPolicy  `json:"permissionsPolicy,omitempty"`
+	BaseDirectoryPolicy     apk.BaseDirectoryPolicy `json:"baseDirectoryPolicy,omitempty"`
+	Policy                  policy.Evaluator        `json:"-"`
+	Triggers                []string                `json:"triggers,omitempty"`
+	RecordTriggers          bool                    `json:"recordTriggers,omitempty"`
+	FirstBootTriggers       bool                    `json:"firstBootTriggers,omitempty"`
+	Executor                apk.Executor            `json:"-"`
+	Scanner                 scan.Scanner            `json:"-"`
+	ScanFailOn              *scan.Severity          `json:"scanFailOn,omitempty"`
+	Transport               http.RoundTripper       `json:"-"`
+	Progress                apk.Reporter            `json:"-"`
+	Metrics                 prometheus.Registerer   `json:"-"`
+	FetchTimeout            time.Duration           `json:"fetchTimeout,omitempty"`
+	ResolveTimeout          time.Duration           `json:"resolveTimeout,omitempty"`
+	RetryPolicy             *apk.RetryPolicy        `json:"-"`
+	DownloadLimits          []apk.Option            `json:"-"`
+	NetworkAuditor          apk.NetworkAuditor      `json:"-"`
+	BuildArgs               map[string]string       `json:"buildArgs,omitempty"`
+	Variant                 string                  `json:"variant,omitempty"`
+	DebugImage              bool                    `json:"debugImage,omitempty"`
+	DebugPackages           []string                `json:"debugPackages,omitempty"`
+
+	// NormalizationRecorder records the changes PermissionsPolicy makes.
+	NormalizationRecorder apk.NormalizationRecorder `json:"-"`
+
+	// SBOMProcessors modify the SBOMs before they are written.
+	SBOMProcessors []soptions.Processor `json:"-"`
 }
 
 type Auth struct{ User, Pass string }
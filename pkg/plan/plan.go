@@ -0,0 +1,180 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plan is the JSON document "apko resolve -o json" writes: what a
+// build would install for each architecture. Unlike the other outputs of
+// apko, its schema is versioned, so that tools such as infrastructure as
+// code providers can diff plans, and rely on them, across releases.
+package plan
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Version is the version of the schema of the documents. Fields may be
+// added within a version; it is only increased when a field is removed, or
+// its meaning changes.
+const Version = 1
+
+// Document is the plan of the build of an image.
+type Document struct {
+	Version int `json:"version"`
+	// Digest is the sha256 digest of the rest of the document, which only
+	// changes when the plan does.
+	Digest      string            `json:"digest"`
+	Config      Config            `json:"config"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Archs are the plans of each architecture, sorted by architecture.
+	Archs []Arch `json:"archs"`
+}
+
+// Config identifies the configuration the document was planned from.
+type Config struct {
+	Name string `json:"name,omitempty"`
+	// Checksum is the checksum of the configuration and the files it
+	// includes, as in lockfiles.
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// Arch is the plan of an architecture.
+type Arch struct {
+	Arch string `json:"arch"`
+	// Packages are the packages to install, sorted by name.
+	Packages      []Package `json:"packages"`
+	DownloadSize  uint64    `json:"downloadSize"`
+	InstalledSize uint64    `json:"installedSize"`
+	// Files are the files apko creates besides those of the packages,
+	// sorted.
+	Files []string `json:"files"`
+}
+
+// Package is a package to install.
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	// Checksum is the checksum of the control section of the package, as
+	// in repository indexes and lockfiles.
+	Checksum      string `json:"checksum,omitempty"`
+	Repository    string `json:"repository"`
+	Origin        string `json:"origin,omitempty"`
+	License       string `json:"license,omitempty"`
+	Size          uint64 `json:"size"`
+	InstalledSize uint64 `json:"installedSize"`
+}
+
+// New returns the document of the plans of the architectures of a build.
+func New(config Config, annotations map[string]string, plans map[types.Architecture]*build.Plan) (*Document, error) {
+	d := &Document{
+		Version:     Version,
+		Config:      config,
+		Annotations: annotations,
+		Archs:       make([]Arch, 0, len(plans)),
+	}
+	if len(d.Annotations) == 0 {
+		d.Annotations = nil
+	}
+	for _, arch := range slices.SortedFunc(maps.Keys(plans), func(a, b types.Architecture) int {
+		return strings.Compare(a.ToAPK(), b.ToAPK())
+	}) {
+		p := plans[arch]
+		a := Arch{
+			Arch:          arch.ToAPK(),
+			Packages:      make([]Package, 0, len(p.Packages)),
+			DownloadSize:  p.DownloadSize,
+			InstalledSize: p.InstalledSize,
+			Files:         slices.Sorted(slices.Values(p.Files)),
+		}
+		if a.Files == nil {
+			a.Files = []string{}
+		}
+		for _, pkg := range p.Packages {
+			a.Packages = append(a.Packages, Package{
+				Name:          pkg.Name,
+				Version:       pkg.Version,
+				URL:           pkg.URL,
+				Checksum:      pkg.Checksum,
+				Repository:    pkg.Repository,
+				Origin:        pkg.Origin,
+				License:       pkg.License,
+				Size:          pkg.Size,
+				InstalledSize: pkg.InstalledSize,
+			})
+		}
+		slices.SortFunc(a.Packages, func(a, b Package) int { return strings.Compare(a.Name, b.Name) })
+		d.Archs = append(d.Archs, a)
+	}
+
+	digest, err := d.digest()
+	if err != nil {
+		return nil, err
+	}
+	d.Digest = digest
+	return d, nil
+}
+
+// digest returns the digest of the document without its digest.
+func (d *Document) digest() (string, error) {
+	c := *d
+	c.Digest = ""
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Write writes the document as indented JSON. The same plan is always
+// written the same way, so documents can be compared as text.
+func (d *Document) Write(w io.Writer) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// Read reads a document, failing if its version is not supported.
+func Read(r io.Reader) (*Document, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+	if v.Version != Version {
+		return nil, fmt.Errorf("unsupported plan version %d, expected %d", v.Version, Version)
+	}
+	var d Document
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("parsing plan: %w", err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/plan"
+)
+
+func testPlans() map[types.Architecture]*build.Plan {
+	plans := map[types.Architecture]*build.Plan{}
+	for _, arch := range []string{"aarch64", "x86_64"} {
+		plans[types.ParseArchitecture(arch)] = &build.Plan{
+			Arch: arch,
+			Packages: []build.PlannedPackage{{
+				Name:          "wolfi-baselayout",
+				Version:       "20230201-r0",
+				URL:           "https://packages.wolfi.dev/os/" + arch + "/wolfi-baselayout-20230201-r0.apk",
+				Repository:    "https://packages.wolfi.dev/os",
+				Origin:        "wolfi-baselayout",
+				License:       "MIT",
+				Checksum:      "Q1kfU1D1dX5h8p1D6ZrV8Cg0U3Ag8=",
+				Size:          5000,
+				InstalledSize: 12000,
+			}, {
+				Name:          "ca-certificates-bundle",
+				Version:       "20240315-r0",
+				URL:           "https://packages.wolfi.dev/os/" + arch + "/ca-certificates-bundle-20240315-r0.apk",
+				Repository:    "https://packages.wolfi.dev/os",
+				Origin:        "ca-certificates",
+				License:       "MPL-2.0 AND MIT",
+				Checksum:      "Q1a3bN0UvGAMJb2vv0dXUAx3wV1xo=",
+				Size:          120000,
+				InstalledSize: 230000,
+			}},
+			DownloadSize:  125000,
+			InstalledSize: 242000,
+			Files:         []string{"etc/apk/world", "etc/apk/arch"},
+		}
+	}
+	return plans
+}
+
+// TestGolden guards the schema of the documents: the golden file may only
+// change by adding fields, unless plan.Version is increased.
+func TestGolden(t *testing.T) {
+	doc, err := plan.New(plan.Config{Name: "apko.yaml", Checksum: "sha256-abc="}, map[string]string{"org.opencontainers.image.vendor": "example"}, testPlans())
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, doc.Write(&buf))
+
+	want, err := os.ReadFile(filepath.Join("testdata", "plan.json"))
+	require.NoError(t, err)
+	require.Equal(t, string(want), buf.String())
+
+	read, err := plan.Read(bytes.NewReader(want))
+	require.NoError(t, err)
+	require.Equal(t, doc, read)
+}
+
+func TestDigest(t *testing.T) {
+	config := plan.Config{Name: "apko.yaml"}
+	a, err := plan.New(config, nil, testPlans())
+	require.NoError(t, err)
+	b, err := plan.New(config, map[string]string{}, testPlans())
+	require.NoError(t, err)
+	require.Equal(t, a.Digest, b.Digest)
+	require.True(t, strings.HasPrefix(a.Digest, "sha256:"))
+
+	plans := testPlans()
+	plans[types.ParseArchitecture("x86_64")].Packages[0].Version = "20240101-r0"
+	c, err := plan.New(config, nil, plans)
+	require.NoError(t, err)
+	require.NotEqual(t, a.Digest, c.Digest)
+}
+
+func TestReadVersion(t *testing.T) {
+	_, err := plan.Read(strings.NewReader(`{"version": 2, "archs": []}`))
+	require.ErrorContains(t, err, "unsupported plan version 2, expected 1")
+
+	_, err = plan.Read(strings.NewReader(`not json`))
+	require.ErrorContains(t, err, "parsing plan")
+}
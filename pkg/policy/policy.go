@@ -0,0 +1,44 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy defines how policies are evaluated against the documents
+// apko builds from, such as the plan of a build, so that organizations can
+// enforce rules on images, e.g. that no package comes from a testing
+// repository, before anything is installed. Rego policies are evaluated by
+// package chainguard.dev/apko/pkg/policy/rego, which links the policy engine
+// only into the programs using it.
+package policy
+
+import "context"
+
+// Result is the outcome of evaluating policies, sorted.
+type Result struct {
+	// Denials are the violations, which fail the build.
+	Denials []string `json:"denials,omitempty"`
+	// Warnings are only reported.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Evaluator evaluates policies against an input document.
+type Evaluator interface {
+	Evaluate(ctx context.Context, input any) (Result, error)
+}
+
+// EvaluatorFunc is an Evaluator which calls a function.
+type EvaluatorFunc func(ctx context.Context, input any) (Result, error)
+
+// Evaluate calls f.
+func (f EvaluatorFunc) Evaluate(ctx context.Context, input any) (Result, error) {
+	return f(ctx, input)
+}
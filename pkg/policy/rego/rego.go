@@ -0,0 +1,150 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rego evaluates Rego policies with the Open Policy Agent.
+//
+// Policies are Rego modules in the "apko" package. Each value of their deny
+// rules is a violation, which fails the build, and each value of their warn
+// rules is only reported. A value is a message, or an object with a msg
+// field.
+package rego
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+
+	"chainguard.dev/apko/pkg/policy"
+)
+
+// Package is the Rego package of the rules policies define.
+const Package = "apko"
+
+// Policy is a set of compiled policies.
+type Policy struct {
+	deny, warn rego.PreparedEvalQuery
+}
+
+var _ policy.Evaluator = (*Policy)(nil)
+
+// Load compiles the Rego modules in paths, each a .rego file or a directory
+// searched recursively for them, skipping tests (*_test.rego).
+func Load(ctx context.Context, paths ...string) (*Policy, error) {
+	modules := map[string]string{}
+	for _, p := range paths {
+		if err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || path != p && (filepath.Ext(path) != ".rego" || strings.HasSuffix(path, "_test.rego")) {
+				return nil
+			}
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			modules[path] = string(b)
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("reading policies: %w", err)
+		}
+	}
+	if len(modules) == 0 {
+		return nil, fmt.Errorf("no policies in %s", strings.Join(paths, ", "))
+	}
+
+	var p Policy
+	for rule, query := range map[string]*rego.PreparedEvalQuery{"deny": &p.deny, "warn": &p.warn} {
+		opts := []func(*rego.Rego){rego.Query(fmt.Sprintf("data.%s.%s", Package, rule))}
+		for name, src := range modules {
+			opts = append(opts, rego.Module(name, src))
+		}
+		q, err := rego.New(opts...).PrepareForEval(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("compiling policies: %w", err)
+		}
+		*query = q
+	}
+	return &p, nil
+}
+
+// Evaluate evaluates the policies with input, which is marshaled to JSON.
+func (p *Policy) Evaluate(ctx context.Context, input any) (policy.Result, error) {
+	b, err := json.Marshal(input)
+	if err != nil {
+		return policy.Result{}, fmt.Errorf("marshaling policy input: %w", err)
+	}
+	var doc any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return policy.Result{}, fmt.Errorf("unmarshaling policy input: %w", err)
+	}
+
+	var r policy.Result
+	for _, e := range []struct {
+		query *rego.PreparedEvalQuery
+		out   *[]string
+	}{{&p.deny, &r.Denials}, {&p.warn, &r.Warnings}} {
+		rs, err := e.query.Eval(ctx, rego.EvalInput(doc))
+		if err != nil {
+			return policy.Result{}, fmt.Errorf("evaluating policies: %w", err)
+		}
+		for _, res := range rs {
+			for _, expr := range res.Expressions {
+				msgs, err := messages(expr.Value)
+				if err != nil {
+					return policy.Result{}, err
+				}
+				*e.out = append(*e.out, msgs...)
+			}
+		}
+		slices.Sort(*e.out)
+	}
+	return r, nil
+}
+
+// messages returns the messages of the values of a rule, which is undefined,
+// or a set (a list once evaluated) of messages or objects with a msg field.
+func messages(v any) ([]string, error) {
+	values, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("policy rules must be sets of messages, got %T", v)
+	}
+	msgs := make([]string, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			msgs = append(msgs, v)
+		case map[string]any:
+			if msg, ok := v["msg"].(string); ok {
+				msgs = append(msgs, msg)
+				continue
+			}
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, string(b))
+		default:
+			msgs = append(msgs, fmt.Sprint(v))
+		}
+	}
+	return msgs, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rego
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/policy"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(body), 0o644))
+	}
+	return dir
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	dir := writeFiles(t, map[string]string{
+		"packages.rego": `package apko
+
+deny contains msg if {
+	some pkg in input.packages
+	startswith(pkg.repository, "https://dl-cdn.alpinelinux.org/alpine/edge/testing")
+	msg := sprintf("%s comes from edge/testing", [pkg.name])
+}
+`,
+		"nested/size.rego": `package apko
+
+warn contains {"msg": sprintf("%d packages", [count(input.packages)]), "severity": "low"} if count(input.packages) > 1
+`,
+		// Tests and other files are not policies.
+		"packages_test.rego": "not rego",
+		"README.md":          "not rego",
+	})
+
+	p, err := Load(ctx, dir)
+	require.NoError(t, err)
+
+	type pkg struct {
+		Name       string `json:"name"`
+		Repository string `json:"repository"`
+	}
+	r, err := p.Evaluate(ctx, map[string]any{"packages": []pkg{
+		{Name: "zlib", Repository: "https://dl-cdn.alpinelinux.org/alpine/edge/testing"},
+		{Name: "busybox", Repository: "https://dl-cdn.alpinelinux.org/alpine/edge/main"},
+		{Name: "curl", Repository: "https://dl-cdn.alpinelinux.org/alpine/edge/testing"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, policy.Result{
+		Denials:  []string{"curl comes from edge/testing", "zlib comes from edge/testing"},
+		Warnings: []string{"3 packages"},
+	}, r)
+
+	r, err = p.Evaluate(ctx, map[string]any{"packages": []pkg{{Name: "busybox"}}})
+	require.NoError(t, err)
+	require.Equal(t, policy.Result{}, r)
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+
+	// A file is loaded whatever its name.
+	dir := writeFiles(t, map[string]string{"policy": "package apko\n\ndeny contains \"always\"\n"})
+	p, err := Load(ctx, filepath.Join(dir, "policy"))
+	require.NoError(t, err)
+	r, err := p.Evaluate(ctx, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"always"}, r.Denials)
+
+	_, err = Load(ctx, writeFiles(t, map[string]string{"README.md": "nothing"}))
+	require.ErrorContains(t, err, "no policies in")
+
+	_, err = Load(ctx, writeFiles(t, map[string]string{"bad.rego": "package apko\n\ndeny contains"}))
+	require.ErrorContains(t, err, "compiling policies")
+
+	_, err = Load(ctx, filepath.Join(dir, "missing"))
+	require.ErrorContains(t, err, "reading policies")
+
+	p, err = Load(ctx, writeFiles(t, map[string]string{"bad.rego": "package apko\n\ndeny := 1\n"}))
+	require.NoError(t, err)
+	_, err = p.Evaluate(ctx, nil)
+	require.ErrorContains(t, err, "policy rules must be sets of messages")
+}
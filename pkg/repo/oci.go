@@ -0,0 +1,138 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+const (
+	// ArtifactType is the artifact type of the OCI artifacts holding a
+	// repository.
+	ArtifactType = "application/vnd.apko.repository.v1"
+
+	// ociTitleAnnotation names the file held by a layer, as set by oras
+	// push.
+	ociTitleAnnotation = "org.opencontainers.image.title"
+
+	fileMediaType types.MediaType = "application/octet-stream"
+)
+
+// ociStore is a repository in an OCI artifact, with a layer per file titled
+// by its path, as oras push stores a directory. Files are only published
+// when the store is committed, by pushing the manifest of the artifact after
+// its layers, which replaces the tag at once.
+type ociStore struct {
+	ref  name.Reference
+	opts []remote.Option
+
+	// files are the layers of the artifact, by the file they hold.
+	files map[string]v1.Layer
+}
+
+// openOCI returns the store of oci://ref, with the files of the artifact
+// the reference names, if any.
+func openOCI(ctx context.Context, dest string, o *options) (*ociStore, error) {
+	ref, err := name.ParseReference(strings.TrimPrefix(dest, apk.OCIKeyringScheme))
+	if err != nil {
+		return nil, fmt.Errorf("parsing reference %s: %w", dest, err)
+	}
+	s := &ociStore{
+		ref:   ref,
+		opts:  append([]remote.Option{remote.WithContext(ctx)}, o.remoteOptions...),
+		files: map[string]v1.Layer{},
+	}
+
+	img, err := remote.Image(ref, s.opts...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", ref, err)
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest of %s: %w", ref, err)
+	}
+	for _, desc := range m.Layers {
+		title := desc.Annotations[ociTitleAnnotation]
+		if title == "" {
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s of %s: %w", title, ref, err)
+		}
+		s.files[title] = layer
+	}
+	return s, nil
+}
+
+func (s *ociStore) Get(_ context.Context, name string) (io.ReadCloser, error) {
+	layer, ok := s.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s in %s: %w", name, s.ref, fs.ErrNotExist)
+	}
+	// The blobs of files are not compressed.
+	return layer.Compressed()
+}
+
+func (s *ociStore) Put(_ context.Context, name string, r io.Reader, _ int64) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.files[name] = static.NewLayer(b, fileMediaType)
+	return nil
+}
+
+// Commit pushes the artifact with the files of the store.
+func (s *ociStore) Commit(ctx context.Context) error {
+	adds := make([]mutate.Addendum, 0, len(s.files))
+	for _, title := range slices.Sorted(maps.Keys(s.files)) {
+		adds = append(adds, mutate.Addendum{
+			Layer:       s.files[title],
+			Annotations: map[string]string{ociTitleAnnotation: title},
+		})
+	}
+	img, err := mutate.Append(mutate.MediaType(empty.Image, types.OCIManifestSchema1), adds...)
+	if err != nil {
+		return err
+	}
+	img = mutate.ConfigMediaType(img, ArtifactType)
+	if err := remote.Write(s.ref, img, append(s.opts, remote.WithContext(ctx))...); err != nil {
+		return fmt.Errorf("pushing %s: %w", s.ref, err)
+	}
+	return nil
+}
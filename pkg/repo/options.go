@@ -0,0 +1,53 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Option configures how a store is opened.
+type Option func(*options)
+
+type options struct {
+	s3Endpoint    string
+	httpClient    *http.Client
+	remoteOptions []remote.Option
+}
+
+// WithS3Endpoint sets the endpoint of S3 compatible storage, such as MinIO,
+// whose buckets are addressed by path instead of by host name.
+func WithS3Endpoint(endpoint string) Option {
+	return func(o *options) {
+		o.s3Endpoint = endpoint
+	}
+}
+
+// WithHTTPClient sets the HTTP client of S3 requests.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithRemoteOptions sets the options of the requests to OCI registries, such
+// as their authentication.
+func WithRemoteOptions(opts ...remote.Option) Option {
+	return func(o *options) {
+		o.remoteOptions = opts
+	}
+}
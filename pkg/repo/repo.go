@@ -0,0 +1,172 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package repo publishes apk repositories to directories, S3 buckets and OCI
+// registries.
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// indexName is the name of the index of each architecture of a repository.
+const indexName = "APKINDEX.tar.gz"
+
+// Store holds the files of a repository, named by their path in it, such as
+// x86_64/APKINDEX.tar.gz.
+type Store interface {
+	// Get opens the file name, returning an error wrapping fs.ErrNotExist
+	// if there is none.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Put stores the size bytes of r as the file name. Readers see the old
+	// file or the new one, never a part of it.
+	Put(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// Open returns the store of a destination: s3://bucket/path for a prefix of
+// an S3 bucket, oci://ref for an OCI artifact, or else a directory.
+func Open(ctx context.Context, dest string, opts ...Option) (Store, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	switch {
+	case strings.HasPrefix(dest, s3Scheme):
+		return openS3(ctx, dest, o)
+	case strings.HasPrefix(dest, apk.OCIKeyringScheme):
+		return openOCI(ctx, dest, o)
+	case strings.Contains(dest, "://"):
+		return nil, fmt.Errorf("unsupported destination %s, must be s3://, oci:// or a directory", dest)
+	default:
+		return dirStore(dest), nil
+	}
+}
+
+// Publish publishes the apks at paths to s, and the APKINDEX.tar.gz of each
+// of their architectures, with the packages of the existing index and
+// signed with the private key in keyFile. The packages are stored first and
+// each index last, so that the index never names a package which isn't
+// there yet. Stores which publish all files at once, such as OCI artifacts,
+// are committed at the end.
+func Publish(ctx context.Context, s Store, paths []string, keyFile, passphrase string) error {
+	log := clog.FromContext(ctx)
+
+	// the path of each package to publish, by architecture and file name
+	pkgs := map[string]map[string]string{}
+	builders := map[string]*apk.IndexBuilder{}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		pkg, _, err := apk.NewIndexBuilder().AddPackage(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", p, err)
+		}
+		if pkg.Arch == "" || pkg.Arch == "noarch" {
+			return fmt.Errorf("%s has no architecture to publish it for", p)
+		}
+		b, ok := builders[pkg.Arch]
+		if !ok {
+			b = apk.NewIndexBuilder()
+			b.Arch = pkg.Arch
+			if err := addExisting(ctx, s, b); err != nil {
+				return err
+			}
+			builders[pkg.Arch] = b
+		}
+		b.Add(pkg)
+		if pkgs[pkg.Arch] == nil {
+			pkgs[pkg.Arch] = map[string]string{}
+		}
+		pkgs[pkg.Arch][pkg.Filename()] = p
+	}
+
+	for _, arch := range slices.Sorted(maps.Keys(builders)) {
+		for _, filename := range slices.Sorted(maps.Keys(pkgs[arch])) {
+			name := path.Join(arch, filename)
+			if err := putFile(ctx, s, name, pkgs[arch][filename]); err != nil {
+				return err
+			}
+			log.Infof("published %s", name)
+		}
+	}
+	for _, arch := range slices.Sorted(maps.Keys(builders)) {
+		var buf bytes.Buffer
+		if err := builders[arch].Write(&buf, keyFile, passphrase); err != nil {
+			return fmt.Errorf("writing index for %s: %w", arch, err)
+		}
+		name := path.Join(arch, indexName)
+		if err := s.Put(ctx, name, &buf, int64(buf.Len())); err != nil {
+			return fmt.Errorf("publishing %s: %w", name, err)
+		}
+		log.Infof("published %s with %d packages", name, len(builders[arch].Index().Packages))
+	}
+
+	if c, ok := s.(interface{ Commit(context.Context) error }); ok {
+		return c.Commit(ctx)
+	}
+	return nil
+}
+
+// addExisting adds the packages of the existing index of the architecture of
+// b in s, if any.
+func addExisting(ctx context.Context, s Store, b *apk.IndexBuilder) error {
+	name := path.Join(b.Arch, indexName)
+	rc, err := s.Get(ctx, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("fetching %s: %w", name, err)
+	}
+	idx, err := apk.IndexFromArchive(rc)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	b.AddIndex(idx)
+	return nil
+}
+
+// putFile stores the file at p as name.
+func putFile(ctx context.Context, s Store, name, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, name, f, fi.Size()); err != nil {
+		return fmt.Errorf("publishing %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/repo"
+)
+
+const testdata = "../../internal/cli/testdata"
+
+// fakeS3 is an S3 bucket holding objects in memory.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	puts    []string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/") {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		b, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(b) //nolint:errcheck
+	case http.MethodPut:
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = b
+		f.puts = append(f.puts, r.URL.Path)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+
+	s3 := &fakeS3{objects: map[string][]byte{}}
+	s3Server := httptest.NewServer(s3)
+	defer s3Server.Close()
+	reg := httptest.NewServer(registry.New())
+	defer reg.Close()
+	u, err := url.Parse(reg.URL)
+	require.NoError(t, err)
+
+	key := filepath.Join(testdata, "melange.rsa")
+	first := filepath.Join(testdata, "packages", "x86_64", "pretend-baselayout-1.0.0-r0.apk")
+	second := filepath.Join(testdata, "packages", "x86_64", "replayout-1.0.0-r0.apk")
+
+	for _, dest := range []string{
+		t.TempDir(),
+		"s3://bucket/os",
+		"oci://" + u.Host + "/os:latest",
+	} {
+		t.Run(strings.SplitN(dest, ":", 2)[0], func(t *testing.T) {
+			open := func() repo.Store {
+				s, err := repo.Open(ctx, dest, repo.WithS3Endpoint(s3Server.URL))
+				require.NoError(t, err)
+				return s
+			}
+
+			// Publishing again keeps the packages of the existing index.
+			require.NoError(t, repo.Publish(ctx, open(), []string{first}, key, ""))
+			require.NoError(t, repo.Publish(ctx, open(), []string{second}, key, ""))
+
+			s := open()
+			rc, err := s.Get(ctx, "x86_64/APKINDEX.tar.gz")
+			require.NoError(t, err)
+			idx, err := apk.IndexFromArchive(rc)
+			require.NoError(t, err)
+			require.NotEmpty(t, idx.Signature)
+			var names []string
+			for _, pkg := range idx.Packages {
+				names = append(names, pkg.Filename())
+				rc, err := s.Get(ctx, "x86_64/"+pkg.Filename())
+				require.NoError(t, err)
+				b, err := io.ReadAll(rc)
+				require.NoError(t, err)
+				require.Equal(t, pkg.Size, uint64(len(b)))
+			}
+			require.Equal(t, []string{"pretend-baselayout-1.0.0-r0.apk", "replayout-1.0.0-r0.apk"}, names)
+		})
+	}
+
+	// The index is stored after the packages.
+	require.Equal(t, []string{
+		"/bucket/os/x86_64/pretend-baselayout-1.0.0-r0.apk",
+		"/bucket/os/x86_64/APKINDEX.tar.gz",
+		"/bucket/os/x86_64/replayout-1.0.0-r0.apk",
+		"/bucket/os/x86_64/APKINDEX.tar.gz",
+	}, s3.puts)
+}
+
+func TestOpen(t *testing.T) {
+	_, err := repo.Open(context.Background(), "gs://bucket/os")
+	require.ErrorContains(t, err, "unsupported destination")
+	_, err = repo.Open(context.Background(), "s3:///os")
+	require.ErrorContains(t, err, "no bucket")
+}
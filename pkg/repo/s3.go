@@ -0,0 +1,146 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+const (
+	s3Scheme = "s3://"
+	// s3DefaultRegion is the region of buckets when none is configured.
+	s3DefaultRegion = "us-east-1"
+	// unsignedPayload signs requests without hashing their body first, so
+	// that packages are streamed.
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// s3Store is a repository under a prefix of an S3 bucket. Each object is
+// stored by a single PUT, which S3 applies atomically.
+type s3Store struct {
+	client *http.Client
+	// base is the URL of the prefix of the repository in the bucket.
+	base   *url.URL
+	region string
+	creds  aws.CredentialsProvider
+}
+
+// openS3 returns the store of s3://bucket/prefix, with the credentials and
+// region of the default AWS configuration: environment variables, shared
+// config files, or the instance or task role.
+func openS3(ctx context.Context, dest string, o *options) (*s3Store, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(dest, s3Scheme), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("no bucket in %s", dest)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS configuration: %w", err)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = s3DefaultRegion
+	}
+
+	var base *url.URL
+	if o.s3Endpoint != "" {
+		base, err = url.Parse(o.s3Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parsing S3 endpoint: %w", err)
+		}
+		base = base.JoinPath(bucket, prefix)
+	} else {
+		base = &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, region), Path: "/" + prefix}
+	}
+
+	client := o.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3Store{client: client, base: base, region: region, creds: cfg.Credentials}, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, name, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %w", s.url(name), fs.ErrNotExist)
+	default:
+		defer res.Body.Close()
+		return nil, s3Error(res)
+	}
+}
+
+func (s *s3Store) Put(ctx context.Context, name string, r io.Reader, size int64) error {
+	res, err := s.do(ctx, http.MethodPut, name, r, size)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s3Error(res)
+	}
+	return nil
+}
+
+func (s *s3Store) url(name string) string {
+	u := *s.base
+	u.Path = path.Join(u.Path, name)
+	return u.String()
+}
+
+// do sends a request for the object name, signed with AWS Signature Version
+// 4.
+func (s *s3Store) do(ctx context.Context, method, name string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.url(name), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	creds, err := s.creds.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting AWS credentials: %w", err)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, unsignedPayload, "s3", s.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("signing request for AWS: %w", err)
+	}
+	return s.client.Do(req)
+}
+
+// s3Error returns the error of a failed S3 request, with the message S3
+// answered with.
+func s3Error(res *http.Response) error {
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return fmt.Errorf("%s %s: %s: %s", res.Request.Method, res.Request.URL.Redacted(), res.Status, strings.TrimSpace(string(b)))
+}
@@ -0,0 +1,139 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s6
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// ServiceDefinitionsDir is where s6-overlay reads the s6-rc source
+// definitions of services from.
+const ServiceDefinitionsDir = "etc/s6-overlay/s6-rc.d"
+
+// defaultNotificationFD is the readiness notification file descriptor of
+// services which only set a readiness check.
+const defaultNotificationFD = 3
+
+const execlineHeader = "#!/bin/execlineb -P\n"
+
+type definitionFile struct {
+	path string
+	data string
+	mode fs.FileMode
+}
+
+// definitionFiles lays out the s6-rc source definitions of services: a
+// directory per service, and an entry in the user bundle s6-overlay starts.
+func definitionFiles(services map[string]types.S6RCService) []definitionFile {
+	var files []definitionFile
+	add := func(mode fs.FileMode, data string, elem ...string) {
+		files = append(files, definitionFile{
+			path: path.Join(append([]string{ServiceDefinitionsDir}, elem...)...),
+			data: data,
+			mode: mode,
+		})
+	}
+
+	add(0644, "bundle\n", "user", "type")
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		svc := services[name]
+		add(0644, svc.Type+"\n", name, "type")
+		add(0644, "", "user", "contents.d", name)
+
+		switch svc.Type {
+		case "longrun":
+			run := svc.Run
+			fd := svc.NotificationFD
+			if svc.ReadinessCheck != "" {
+				// s6-notifyoncheck polls data/check, and notifies
+				// readiness on the notification fd once it succeeds.
+				run = "s6-notifyoncheck -n 0\n" + run
+				add(0755, execlineHeader+svc.ReadinessCheck+"\n", name, "data", "check")
+				if fd == 0 {
+					fd = defaultNotificationFD
+				}
+			}
+			add(0755, execlineHeader+run+"\n", name, "run")
+			if svc.Finish != "" {
+				add(0755, execlineHeader+svc.Finish+"\n", name, "finish")
+			}
+			if fd != 0 {
+				add(0644, strconv.Itoa(fd)+"\n", name, "notification-fd")
+			}
+		case "oneshot":
+			add(0644, svc.Up+"\n", name, "up")
+			if svc.Down != "" {
+				add(0644, svc.Down+"\n", name, "down")
+			}
+		case "bundle":
+			for _, member := range svc.Contents {
+				add(0644, "", name, "contents.d", member)
+			}
+			continue
+		}
+
+		// Depending on base starts services once s6-overlay has set up
+		// the container.
+		add(0644, "", name, "dependencies.d", "base")
+		for _, dep := range svc.Dependencies {
+			add(0644, "", name, "dependencies.d", dep)
+		}
+	}
+	return files
+}
+
+// ServiceDefinitionFiles returns the paths of the files
+// WriteServiceDefinitions writes for services.
+func ServiceDefinitionFiles(services map[string]types.S6RCService) []string {
+	if len(services) == 0 {
+		return nil
+	}
+	var paths []string
+	for _, f := range definitionFiles(services) {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// WriteServiceDefinitions writes the s6-rc source definitions of services
+// for s6-overlay to compile and start when the container boots.
+func (sc *Context) WriteServiceDefinitions(ctx context.Context, services map[string]types.S6RCService) error {
+	if len(services) == 0 {
+		return nil
+	}
+
+	log := clog.FromContext(ctx)
+	log.Debug("generating s6-rc service definitions")
+
+	for _, f := range definitionFiles(services) {
+		if err := sc.fs.MkdirAll(path.Dir(f.path), 0755); err != nil {
+			return fmt.Errorf("could not make service definition directory: %w", err)
+		}
+		if err := sc.fs.WriteFile(f.path, []byte(f.data), f.mode); err != nil {
+			return fmt.Errorf("could not write %s: %w", f.path, err)
+		}
+	}
+	return nil
+}
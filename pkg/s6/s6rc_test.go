@@ -0,0 +1,71 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s6
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestWriteServiceDefinitions(t *testing.T) {
+	services := map[string]types.S6RCService{
+		"migrate": {Type: "oneshot", Up: "/usr/bin/migrate"},
+		"app": {
+			Type:           "longrun",
+			Run:            "/usr/bin/app",
+			ReadinessCheck: "/usr/bin/curl -sf http://localhost:8080/health",
+			Dependencies:   []string{"migrate"},
+		},
+		"stack": {Type: "bundle", Contents: []string{"app"}},
+	}
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, New(fsys).WriteServiceDefinitions(context.Background(), services))
+
+	for file, want := range map[string]string{
+		"user/type":                  "bundle\n",
+		"user/contents.d/app":        "",
+		"app/type":                   "longrun\n",
+		"app/run":                    "#!/bin/execlineb -P\ns6-notifyoncheck -n 0\n/usr/bin/app\n",
+		"app/data/check":             "#!/bin/execlineb -P\n/usr/bin/curl -sf http://localhost:8080/health\n",
+		"app/notification-fd":        "3\n",
+		"app/dependencies.d/base":    "",
+		"app/dependencies.d/migrate": "",
+		"migrate/type":               "oneshot\n",
+		"migrate/up":                 "/usr/bin/migrate\n",
+		"stack/type":                 "bundle\n",
+		"stack/contents.d/app":       "",
+	} {
+		b, err := fsys.ReadFile(ServiceDefinitionsDir + "/" + file)
+		require.NoError(t, err, file)
+		require.Equal(t, want, string(b), file)
+	}
+
+	fi, err := fsys.Stat(ServiceDefinitionsDir + "/app/run")
+	require.NoError(t, err)
+	require.Equal(t, 0755, int(fi.Mode().Perm()))
+
+	_, err = fsys.Stat(ServiceDefinitionsDir + "/stack/dependencies.d")
+	require.Error(t, err, "bundles have no dependencies")
+
+	files := ServiceDefinitionFiles(services)
+	require.Contains(t, files, ServiceDefinitionsDir+"/migrate/up")
+	require.Empty(t, ServiceDefinitionFiles(nil))
+}
@@ -0,0 +1,101 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s6
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Finish scripts exiting 125 tell s6-supervise not to restart the service.
+// They get the exit code of the run script as first argument.
+const (
+	finishNever     = "#!/bin/execlineb -P\nexit 125\n"
+	finishOnFailure = "#!/bin/execlineb -S2\nifelse { eltest ${1} = 0 } { exit 125 } exit 0\n"
+)
+
+// serviceFiles lays out the supervision tree of services.
+func serviceFiles(services map[string]types.ImageService) []definitionFile {
+	var files []definitionFile
+	for _, name := range slices.Sorted(maps.Keys(services)) {
+		svc := services[name]
+
+		var run strings.Builder
+		run.WriteString(execlineHeader)
+		if svc.WorkDir != "" {
+			fmt.Fprintf(&run, "cd %s\n", execlineQuote(svc.WorkDir))
+		}
+		for _, k := range slices.Sorted(maps.Keys(svc.Environment)) {
+			fmt.Fprintf(&run, "export %s %s\n", k, execlineQuote(svc.Environment[k]))
+		}
+		if svc.User != "" {
+			fmt.Fprintf(&run, "s6-setuidgid %s\n", svc.User)
+		}
+		run.WriteString(svc.Command + "\n")
+		files = append(files, definitionFile{path: path.Join("sv", name, "run"), data: run.String(), mode: 0755})
+
+		switch svc.Restart {
+		case types.ServiceRestartOnFailure:
+			files = append(files, definitionFile{path: path.Join("sv", name, "finish"), data: finishOnFailure, mode: 0755})
+		case types.ServiceRestartNever:
+			files = append(files, definitionFile{path: path.Join("sv", name, "finish"), data: finishNever, mode: 0755})
+		}
+	}
+	return files
+}
+
+// execlineQuote quotes s as a single word of an execline script.
+func execlineQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// ServiceFiles returns the paths of the files WriteServices writes for
+// services.
+func ServiceFiles(services map[string]types.ImageService) []string {
+	var paths []string
+	for _, f := range serviceFiles(services) {
+		paths = append(paths, f.path)
+	}
+	return paths
+}
+
+// WriteServices writes the supervision tree running services, with their
+// environment, user, working directory and restart policy.
+func (sc *Context) WriteServices(ctx context.Context, services map[string]types.ImageService) error {
+	if len(services) == 0 {
+		return nil
+	}
+
+	log := clog.FromContext(ctx)
+	log.Debug("generating services supervision tree")
+
+	for _, f := range serviceFiles(services) {
+		if err := sc.fs.MkdirAll(path.Dir(f.path), 0777); err != nil {
+			return fmt.Errorf("could not make supervision directory: %w", err)
+		}
+		if err := sc.fs.WriteFile(f.path, []byte(f.data), f.mode); err != nil {
+			return fmt.Errorf("could not write %s: %w", f.path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s6
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestWriteServices(t *testing.T) {
+	services := map[string]types.ImageService{
+		"app": {
+			Command:     "/usr/bin/app serve",
+			Environment: map[string]string{"PORT": "8080", "GREETING": `say "hi"`},
+			User:        "nonroot",
+			WorkDir:     "/srv/app",
+		},
+		"migrate": {Command: "/usr/bin/app migrate", Restart: types.ServiceRestartOnFailure},
+		"report":  {Command: "/usr/bin/report", Restart: types.ServiceRestartNever},
+	}
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, New(fsys).WriteServices(context.Background(), services))
+
+	for file, want := range map[string]string{
+		"sv/app/run": `#!/bin/execlineb -P
+cd "/srv/app"
+export GREETING "say \"hi\""
+export PORT "8080"
+s6-setuidgid nonroot
+/usr/bin/app serve
+`,
+		"sv/migrate/run":    "#!/bin/execlineb -P\n/usr/bin/app migrate\n",
+		"sv/migrate/finish": finishOnFailure,
+		"sv/report/finish":  finishNever,
+	} {
+		b, err := fsys.ReadFile(file)
+		require.NoError(t, err, file)
+		require.Equal(t, want, string(b), file)
+	}
+
+	_, err := fsys.Stat("sv/app/finish")
+	require.Error(t, err, "services restarted always have no finish script")
+
+	require.Equal(t, []string{
+		"sv/app/run",
+		"sv/migrate/run",
+		"sv/migrate/finish",
+		"sv/report/run",
+		"sv/report/finish",
+	}, ServiceFiles(services))
+}
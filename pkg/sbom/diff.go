@@ -0,0 +1,93 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// instanceFields are the top-level fields identifying a document, rather than
+// describing its contents. They are derived from the rest of the document, so
+// they differ whenever anything else does.
+var instanceFields = []string{
+	"documentNamespace", // SPDX
+	"serialNumber",      // CycloneDX
+}
+
+// Diff compares two JSON SBOMs semantically, and returns a human-readable
+// report of their differences, or an empty string if they describe the same
+// thing. The order of arrays and of object keys is ignored, as is the
+// formatting of the documents and the fields identifying them.
+func Diff(a, b []byte) (string, error) {
+	x, err := normalize(a)
+	if err != nil {
+		return "", fmt.Errorf("parsing first SBOM: %w", err)
+	}
+	y, err := normalize(b)
+	if err != nil {
+		return "", fmt.Errorf("parsing second SBOM: %w", err)
+	}
+	return cmp.Diff(x, y), nil
+}
+
+func normalize(data []byte) (any, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if m, ok := doc.(map[string]any); ok {
+		for _, f := range instanceFields {
+			delete(m, f)
+		}
+	}
+	return sortArrays(doc), nil
+}
+
+// sortArrays sorts every array in v by the JSON encoding of its elements,
+// whose own arrays are sorted first.
+func sortArrays(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = sortArrays(e)
+		}
+	case []any:
+		keys := make([]string, len(v))
+		for i, e := range v {
+			v[i] = sortArrays(e)
+			// Marshaling values decoded from JSON cannot fail.
+			b, _ := json.Marshal(v[i])
+			keys[i] = string(b)
+		}
+		sort.Sort(byKey{v, keys})
+	}
+	return v
+}
+
+type byKey struct {
+	elems []any
+	keys  []string
+}
+
+func (s byKey) Len() int           { return len(s.elems) }
+func (s byKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+func (s byKey) Swap(i, j int) {
+	s.elems[i], s.elems[j] = s.elems[j], s.elems[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
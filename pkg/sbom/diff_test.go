@@ -0,0 +1,64 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	a := []byte(`{
+  "documentNamespace": "https://spdx.org/spdxdocs/apko/sbom-1",
+  "packages": [
+    {"SPDXID": "SPDXRef-a", "checksums": [{"algorithm": "SHA1"}, {"algorithm": "SHA256"}]},
+    {"SPDXID": "SPDXRef-b"}
+  ]
+}`)
+
+	for _, tc := range []struct {
+		name string
+		b    string
+		same bool
+	}{{
+		name: "reordered and reformatted",
+		b:    `{"packages":[{"SPDXID":"SPDXRef-b"},{"checksums":[{"algorithm":"SHA256"},{"algorithm":"SHA1"}],"SPDXID":"SPDXRef-a"}],"documentNamespace":"https://spdx.org/spdxdocs/apko/sbom-1"}`,
+		same: true,
+	}, {
+		name: "different namespace",
+		b:    `{"documentNamespace":"https://spdx.org/spdxdocs/apko/sbom-2","packages":[{"SPDXID":"SPDXRef-a","checksums":[{"algorithm":"SHA1"},{"algorithm":"SHA256"}]},{"SPDXID":"SPDXRef-b"}]}`,
+		same: true,
+	}, {
+		name: "missing package",
+		b:    `{"documentNamespace":"https://spdx.org/spdxdocs/apko/sbom-1","packages":[{"SPDXID":"SPDXRef-b"}]}`,
+	}, {
+		name: "changed field",
+		b:    `{"documentNamespace":"https://spdx.org/spdxdocs/apko/sbom-1","packages":[{"SPDXID":"SPDXRef-a","checksums":[{"algorithm":"MD5"},{"algorithm":"SHA256"}]},{"SPDXID":"SPDXRef-b"}]}`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := Diff(a, []byte(tc.b))
+			require.NoError(t, err)
+			if tc.same {
+				require.Empty(t, diff)
+			} else {
+				require.NotEmpty(t, diff)
+			}
+		})
+	}
+
+	_, err := Diff(a, []byte("not json"))
+	require.Error(t, err)
+}
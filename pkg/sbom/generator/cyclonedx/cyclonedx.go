@@ -0,0 +1,582 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cyclonedx generates CycloneDX SBOMs of images and indexes.
+package cyclonedx
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/mail"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	purl "github.com/package-url/packageurl-go"
+	"sigs.k8s.io/release-utils/version"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+// SpecVersion is the version of the CycloneDX specification of the documents
+// apko writes.
+const SpecVersion = "1.6"
+
+type CycloneDX struct {
+	fs apkfs.FullFS
+}
+
+func New(fs apkfs.FullFS) CycloneDX {
+	return CycloneDX{fs}
+}
+
+func (cx *CycloneDX) Key() string {
+	return "cyclonedx"
+}
+
+func (cx *CycloneDX) Ext() string {
+	return "cdx.json"
+}
+
+type Document struct {
+	BOMFormat    string       `json:"bomFormat"`
+	SpecVersion  string       `json:"specVersion"`
+	SerialNumber string       `json:"serialNumber,omitempty"`
+	Version      int          `json:"version"`
+	Metadata     Metadata     `json:"metadata"`
+	Components   []Component  `json:"components"`
+	Dependencies []Dependency `json:"dependencies,omitempty"`
+}
+
+type Metadata struct {
+	Timestamp  string     `json:"timestamp"`
+	Tools      Tools      `json:"tools"`
+	Component  *Component `json:"component,omitempty"`
+	Supplier   *Entity    `json:"supplier,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+type Tools struct {
+	Components []Component `json:"components"`
+}
+
+type Entity struct {
+	Name string `json:"name"`
+}
+
+type Component struct {
+	BOMRef             string        `json:"bom-ref"`
+	Type               string        `json:"type"`
+	Name               string        `json:"name"`
+	Version            string        `json:"version,omitempty"`
+	Description        string        `json:"description,omitempty"`
+	Supplier           *Entity       `json:"supplier,omitempty"`
+	Authors            []Contact     `json:"authors,omitempty"`
+	Licenses           []License     `json:"licenses,omitempty"`
+	PURL               string        `json:"purl,omitempty"`
+	Hashes             []Hash        `json:"hashes,omitempty"`
+	ExternalReferences []ExternalRef `json:"externalReferences,omitempty"`
+	Properties         []Property    `json:"properties,omitempty"`
+	Pedigree           *Pedigree     `json:"pedigree,omitempty"`
+	Components         []Component   `json:"components,omitempty"`
+}
+
+type Contact struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Pedigree struct {
+	Commits []Commit `json:"commits"`
+}
+
+type Commit struct {
+	UID string `json:"uid"`
+}
+
+type License struct {
+	Expression string `json:"expression"`
+}
+
+type Hash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type ExternalRef struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Comment string `json:"comment,omitempty"`
+	Hashes  []Hash `json:"hashes,omitempty"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type Dependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func newDocument(opts *options.Options) *Document {
+	doc := &Document{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: SpecVersion,
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Tools: Tools{Components: []Component{{
+				BOMRef:   "apko",
+				Type:     "application",
+				Name:     "apko",
+				Version:  version.GetVersionInfo().GitVersion,
+				Supplier: &Entity{Name: "Chainguard, Inc"},
+			}}},
+			Supplier: supplier(opts),
+		},
+		Components: []Component{},
+	}
+	// The digest of the configuration tells which one the image was built
+	// from.
+	if opts.ImageInfo.ConfigDigest != "" {
+		doc.Metadata.Properties = append(doc.Metadata.Properties, Property{
+			Name:  "apko:config-digest",
+			Value: opts.ImageInfo.ConfigDigest,
+		})
+	}
+	for _, tool := range opts.BuildTools {
+		doc.Metadata.Tools.Components = append(doc.Metadata.Tools.Components, Component{
+			BOMRef:      "apko-" + tool.Name,
+			Type:        "application",
+			Name:        tool.Name,
+			Version:     version.GetVersionInfo().GitVersion,
+			Description: tool.Description,
+			Supplier:    &Entity{Name: "Chainguard, Inc"},
+		})
+	}
+	return doc
+}
+
+func supplier(opts *options.Options) *Entity {
+	if opts.OS.Name == "" {
+		return nil
+	}
+	return &Entity{Name: opts.OS.Name}
+}
+
+// Returns ":" otherwise :(
+func hashToString(h v1.Hash) string {
+	if h == (v1.Hash{}) {
+		return ""
+	}
+	return h.String()
+}
+
+func sha256Hashes(h v1.Hash) []Hash {
+	if h.Hex == "" {
+		return nil
+	}
+	return []Hash{{Algorithm: "SHA-256", Content: h.Hex}}
+}
+
+func ociPurl(name, digest string, qualifiers options.PurlQualifiers) string {
+	return purl.NewPackageURL(purl.TypeOCI, "", name, digest, nil, "").String() + "?" + qualifiers.String()
+}
+
+// Generate writes a CycloneDX SBOM of an image in path
+func (cx *CycloneDX) Generate(ctx context.Context, opts *options.Options, path string) error {
+	doc := newDocument(opts)
+
+	var image *Component
+	if opts.ImageInfo.ImageDigest != "" {
+		digest, err := v1.NewHash(opts.ImageInfo.ImageDigest)
+		if err != nil {
+			return fmt.Errorf("parsing image digest: %w", err)
+		}
+		image = &Component{
+			BOMRef:      opts.ImagePurl(),
+			Type:        "container",
+			Name:        opts.ImageInfo.ImageDigest,
+			Version:     opts.ImageInfo.ImageDigest,
+			Description: "apko container image",
+			Supplier:    supplier(opts),
+			Hashes:      sha256Hashes(digest),
+		}
+		image.PURL = image.BOMRef
+		addSource(image, opts)
+		doc.Metadata.Component = image
+	}
+
+	var layers []string
+	for _, layer := range opts.ImageInfo.Layers {
+		c := Component{
+			BOMRef:      ociPurl(opts.ImagePurlName(), hashToString(layer.Digest), opts.LayerPurlQualifiers(layer)),
+			Type:        "file",
+			Name:        hashToString(layer.Digest),
+			Version:     opts.OS.Version,
+			Description: "apko operating system layer",
+			Supplier:    supplier(opts),
+			Hashes:      sha256Hashes(layer.Digest),
+		}
+		c.PURL = c.BOMRef
+		layers = append(layers, c.BOMRef)
+		doc.Components = append(doc.Components, c)
+	}
+	if image != nil {
+		doc.Dependencies = append(doc.Dependencies, Dependency{Ref: image.BOMRef, DependsOn: layers})
+	} else if len(doc.Components) != 0 {
+		doc.Metadata.Component = &doc.Components[0]
+		doc.Components = doc.Components[1:]
+	}
+
+	osComponent := Component{
+		BOMRef:      "operating-system-" + opts.OS.ID,
+		Type:        "operating-system",
+		Name:        opts.OS.ID,
+		Version:     opts.OS.Version,
+		Description: "Operating System",
+		Supplier:    supplier(opts),
+	}
+	// The packages were resolved from the indexes of the operating system,
+	// whose verification is recorded for auditing the build.
+	for _, u := range slices.Sorted(maps.Keys(opts.IndexSignatures)) {
+		osComponent.Properties = append(osComponent.Properties, Property{
+			Name:  "apk:index-signature",
+			Value: fmt.Sprintf("%s %s", u, opts.IndexSignatures[u]),
+		})
+	}
+	doc.Components = append(doc.Components, osComponent)
+
+	// Files copied from the build context are not owned by any package.
+	for _, f := range opts.LocalFiles {
+		doc.Components = append(doc.Components, Component{
+			BOMRef:      "file:/" + f.Path,
+			Type:        "file",
+			Name:        "/" + f.Path,
+			Description: "Copied from the build context at " + f.Source,
+			Hashes:      []Hash{{Algorithm: "SHA-256", Content: f.SHA256}},
+		})
+	}
+
+	// Files fetched by URL record where they were fetched from, and nest the
+	// files extracted from archives.
+	for _, f := range opts.RemoteFiles {
+		c := Component{
+			BOMRef: "file:/" + f.Path,
+			Type:   "file",
+			Name:   "/" + f.Path,
+			PURL:   f.Purl(),
+			Hashes: []Hash{{Algorithm: "SHA-256", Content: f.SHA256}},
+			ExternalReferences: []ExternalRef{{
+				Type:   "distribution",
+				URL:    f.URL,
+				Hashes: []Hash{{Algorithm: "SHA-256", Content: f.SHA256}},
+			}},
+		}
+		if f.Files != nil {
+			c.BOMRef = f.Purl()
+			c.Type = "data"
+			c.Name = f.Name()
+			c.Description = "Extracted to /" + f.Path
+		}
+		for _, lf := range f.Files {
+			c.Components = append(c.Components, Component{
+				BOMRef:      "file:/" + lf.Path,
+				Type:        "file",
+				Name:        "/" + lf.Path,
+				Description: "Extracted from " + lf.Source,
+				Hashes:      []Hash{{Algorithm: "SHA-256", Content: lf.SHA256}},
+			})
+		}
+		doc.Components = append(doc.Components, c)
+	}
+
+	files := map[*apk.InstalledPackage][]Component{}
+	if opts.IncludeFiles {
+		installed, err := opts.InstalledFiles(cx.fs)
+		if err != nil {
+			return fmt.Errorf("listing files: %w", err)
+		}
+		seen := make(map[string]struct{}, len(installed))
+		for _, f := range installed {
+			if _, ok := seen[f.Path]; ok {
+				continue
+			}
+			seen[f.Path] = struct{}{}
+			files[f.Package] = append(files[f.Package], Component{
+				BOMRef: "file:/" + f.Path,
+				Type:   "file",
+				Name:   "/" + f.Path,
+				Hashes: []Hash{{Algorithm: "SHA-256", Content: f.SHA256}},
+			})
+		}
+	}
+
+	// License files collected into the image are referenced by their package.
+	licenses := map[string][]ExternalRef{}
+	for _, f := range opts.LicenseFiles {
+		key := f.Package.Name + "@" + f.Package.Version
+		licenses[key] = append(licenses[key], ExternalRef{
+			Type:    "license",
+			URL:     "file:///" + f.Path,
+			Hashes:  []Hash{{Algorithm: "SHA-256", Content: f.SHA256}},
+			Comment: "Collected from /" + f.Source,
+		})
+	}
+
+	pkgs := make([]*apk.RepositoryPackage, 0, len(opts.Packages))
+	refs := make(map[string]string, len(opts.Packages))
+	for _, ipkg := range opts.Packages {
+		c := packageComponent(opts, &ipkg.Package)
+		c.Components = files[ipkg]
+		c.ExternalReferences = append(c.ExternalReferences, licenses[ipkg.Name+"@"+ipkg.Version]...)
+		refs[ipkg.Name] = c.BOMRef
+		doc.Components = append(doc.Components, c)
+		pkgs = append(pkgs, &apk.RepositoryPackage{Package: &ipkg.Package})
+	}
+	g := apk.NewPackageGraph(pkgs)
+	for _, ipkg := range opts.Packages {
+		dependsOn := []string{}
+		for _, dep := range g.Dependencies(ipkg.Name) {
+			dependsOn = append(dependsOn, refs[dep])
+		}
+		doc.Dependencies = append(doc.Dependencies, Dependency{Ref: refs[ipkg.Name], DependsOn: dependsOn})
+	}
+
+	if err := opts.Process(ctx, cx.Key(), doc); err != nil {
+		return fmt.Errorf("processing SBOM: %w", err)
+	}
+
+	if err := renderDoc(doc, path); err != nil {
+		return fmt.Errorf("rendering document: %w", err)
+	}
+	return nil
+}
+
+// packageComponent returns the component describing an apk package, with the
+// purl apk packages describe themselves with in their own SBOMs.
+func packageComponent(opts *options.Options, pkg *apk.Package) Component {
+	ref := opts.PackagePurl(pkg)
+	c := Component{
+		BOMRef:      ref,
+		Type:        "library",
+		Name:        pkg.Name,
+		Version:     pkg.Version,
+		Description: pkg.Description,
+		Supplier:    supplier(opts),
+		PURL:        ref,
+	}
+	if pkg.License != "" {
+		c.Licenses = []License{{Expression: pkg.License}}
+	}
+	if len(pkg.Checksum) != 0 {
+		// The checksum of the control section, which apk identifies packages by.
+		c.Hashes = []Hash{{Algorithm: "SHA-1", Content: hex.EncodeToString(pkg.Checksum)}}
+	}
+	if pkg.URL != "" {
+		c.ExternalReferences = append(c.ExternalReferences, ExternalRef{Type: "website", URL: pkg.URL})
+	}
+	if pkg.Origin != "" {
+		c.Properties = append(c.Properties, Property{Name: "apk:origin", Value: pkg.Origin})
+	}
+	if pkg.RepoCommit != "" {
+		c.Properties = append(c.Properties, Property{Name: "apk:commit", Value: pkg.RepoCommit})
+		c.Pedigree = &Pedigree{Commits: []Commit{{UID: pkg.RepoCommit}}}
+	}
+	if v, ok := opts.PackageSignatures[pkg.Name]; ok {
+		c.Properties = append(c.Properties, signatureProperties(v)...)
+	}
+	if pkg.Maintainer != "" {
+		if addr, err := mail.ParseAddress(pkg.Maintainer); err == nil {
+			c.Authors = []Contact{{Name: addr.Name, Email: addr.Address}}
+		} else {
+			c.Authors = []Contact{{Name: pkg.Maintainer}}
+		}
+	}
+	return c
+}
+
+// signatureProperties returns the properties recording how the signature of
+// a package was verified, or why it was not.
+func signatureProperties(v apk.Verification) []Property {
+	if !v.Verified {
+		return []Property{{Name: "apk:signature-unverified", Value: v.Reason}}
+	}
+	var props []Property
+	if v.KeyID != "" {
+		props = append(props, Property{Name: "apk:signature-key", Value: v.KeyID})
+	}
+	return append(props, Property{Name: "apk:signature-algorithm", Value: v.Algorithm})
+}
+
+// addSource adds a reference to the source code the image was built from
+func addSource(c *Component, opts *options.Options) {
+	if opts.ImageInfo.VCSUrl == "" {
+		return
+	}
+	c.ExternalReferences = append(c.ExternalReferences, ExternalRef{Type: "vcs", URL: opts.ImageInfo.VCSUrl})
+}
+
+// GenerateIndex writes a CycloneDX SBOM of an index in path
+func (cx *CycloneDX) GenerateIndex(opts *options.Options, path string) error {
+	return cx.GenerateIndexContext(context.Background(), opts, path)
+}
+
+// GenerateIndexContext writes a CycloneDX SBOM of an index in path, passing
+// ctx to the processors of opts.
+func (cx *CycloneDX) GenerateIndexContext(ctx context.Context, opts *options.Options, path string) error {
+	if len(opts.ImageInfo.Images) == 0 {
+		return errors.New("unable to render index sbom, no architecture images found")
+	}
+	doc := newDocument(opts)
+
+	digest := opts.ImageInfo.IndexDigest.DeepCopy().String()
+	index := &Component{
+		BOMRef:      opts.IndexPurl(),
+		Type:        "container",
+		Name:        digest,
+		Version:     digest,
+		Description: "Multi-arch image index",
+		Supplier:    supplier(opts),
+		Hashes:      sha256Hashes(opts.ImageInfo.IndexDigest),
+	}
+	index.PURL = index.BOMRef
+	addSource(index, opts)
+	doc.Metadata.Component = index
+
+	images := []string{}
+	for i, info := range opts.ImageInfo.Images {
+		c := Component{
+			BOMRef:   ociPurl(opts.ImagePurlName(), info.Digest.DeepCopy().String(), opts.ArchImagePurlQualifiers(&opts.ImageInfo.Images[i])),
+			Type:     "container",
+			Name:     "sha256:" + info.Digest.DeepCopy().Hex,
+			Version:  "sha256:" + info.Digest.DeepCopy().Hex,
+			Supplier: supplier(opts),
+			Hashes:   sha256Hashes(info.Digest),
+			Properties: []Property{
+				{Name: "oci:platform", Value: info.OCIPlatform().String()},
+			},
+		}
+		c.PURL = c.BOMRef
+		if info.SBOMPath != "" {
+			ref, err := imageSBOMRef(info)
+			if err != nil {
+				return fmt.Errorf("referencing %s image SBOM: %w", info.Arch, err)
+			}
+			c.ExternalReferences = append(c.ExternalReferences, ref)
+		}
+		images = append(images, c.BOMRef)
+		doc.Components = append(doc.Components, c)
+	}
+	doc.Dependencies = []Dependency{{Ref: index.BOMRef, DependsOn: images}}
+
+	if err := opts.Process(ctx, cx.Key(), doc); err != nil {
+		return fmt.Errorf("processing SBOM: %w", err)
+	}
+
+	if err := renderDoc(doc, path); err != nil {
+		return fmt.Errorf("rendering document: %w", err)
+	}
+	return nil
+}
+
+// imageSBOMRef references the SBOM of an image of the index, by its BOM-Link,
+// so that consumers of the index SBOM can find the contents of every platform.
+func imageSBOMRef(info options.ArchImageInfo) (ExternalRef, error) {
+	data, err := os.ReadFile(info.SBOMPath)
+	if err != nil {
+		return ExternalRef{}, fmt.Errorf("reading SBOM: %w", err)
+	}
+	imageDoc := &Document{}
+	if err := json.Unmarshal(data, imageDoc); err != nil {
+		return ExternalRef{}, fmt.Errorf("parsing SBOM: %w", err)
+	}
+	ref := ExternalRef{
+		Type: "bom",
+		URL:  fmt.Sprintf("urn:cdx:%s/%d", strings.TrimPrefix(imageDoc.SerialNumber, "urn:uuid:"), imageDoc.Version),
+	}
+	if info.SBOMDigest != "" {
+		ref.Hashes = []Hash{{Algorithm: "SHA-256", Content: info.SBOMDigest}}
+	}
+	return ref, nil
+}
+
+// sortComponents sorts components, and the components nested in them, by
+// their bom-ref.
+func sortComponents(components []Component) {
+	sort.SliceStable(components, func(i, j int) bool {
+		return components[i].BOMRef < components[j].BOMRef
+	})
+	for i := range components {
+		sortComponents(components[i].Components)
+	}
+}
+
+// canonicalize sorts the components and dependencies of the document, which
+// have no meaningful order, and sets its serial number to a UUID derived from
+// the rest of the document, so that the same image always gets a
+// byte-identical SBOM.
+func canonicalize(doc *Document) error {
+	sortComponents(doc.Components)
+	if doc.Metadata.Component != nil {
+		sortComponents(doc.Metadata.Component.Components)
+	}
+	sort.SliceStable(doc.Dependencies, func(i, j int) bool {
+		return doc.Dependencies[i].Ref < doc.Dependencies[j].Ref
+	})
+	for i := range doc.Dependencies {
+		sort.Strings(doc.Dependencies[i].DependsOn)
+	}
+
+	doc.SerialNumber = ""
+	id, err := options.ContentUUID(doc)
+	if err != nil {
+		return err
+	}
+	doc.SerialNumber = "urn:uuid:" + id
+	return nil
+}
+
+// renderDoc marshals a document to json and writes it to disk
+func renderDoc(doc *Document, path string) error {
+	if err := canonicalize(doc); err != nil {
+		return fmt.Errorf("canonicalizing document: %w", err)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("opening SBOM path %s for writing: %w", path, err)
+	}
+	defer out.Close()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(true)
+
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("encoding cyclonedx sbom: %w", err)
+	}
+	return nil
+}
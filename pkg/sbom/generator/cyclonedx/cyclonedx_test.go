@@ -0,0 +1,392 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cyclonedx
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+var testOpts = &options.Options{
+	ImageInfo: options.ImageInfo{
+		Name:            "cgr.dev/chainguard/example",
+		ImageDigest:     "sha256:9e1bb6fdd8d1e3aea2ec4e6a0e6aa5e4d8bd3b5e3b5bb1b6a9ab3b2d3e4f5a6b",
+		Arch:            types.ParseArchitecture("x86_64"),
+		SourceDateEpoch: time.Unix(1700000000, 0).UTC(),
+		Layers: []v1.Descriptor{{
+			Digest: v1.Hash{Algorithm: "sha256", Hex: "0f1e2d3c4b5a69788796a5b4c3d2e1f00f1e2d3c4b5a69788796a5b4c3d2e1f0"},
+		}},
+	},
+	OS: options.OSInfo{
+		Name:    "Wolfi",
+		ID:      "wolfi",
+		Version: "20230201",
+	},
+	FileName: "sbom",
+	Packages: []*apk.InstalledPackage{
+		{
+			Package: apk.Package{
+				Name:        "busybox",
+				Version:     "1.36.1-r0",
+				Arch:        "x86_64",
+				Description: "Size optimized toolbox of many common UNIX utilities",
+				License:     "GPL-2.0-only",
+				Origin:      "busybox",
+				URL:         "https://busybox.net",
+				Dependencies: []string{
+					"so:libc.so.6",
+				},
+				Checksum: []byte{
+					0xd, 0xe6, 0xf4, 0x8c, 0xdc, 0xad, 0x92, 0xb8, 0xcf, 0x5b,
+					0x83, 0x7f, 0x78, 0xa2, 0xd9, 0xe3, 0x70, 0x70, 0x3a, 0x5c,
+				},
+			},
+		},
+		{
+			Package: apk.Package{
+				Name:     "glibc",
+				Version:  "2.38-r1",
+				Arch:     "x86_64",
+				License:  "LGPL-2.1-or-later",
+				Provides: []string{"so:libc.so.6=6"},
+			},
+		},
+	},
+}
+
+func generate(t *testing.T, opts *options.Options) *Document {
+	t.Helper()
+	cx := New(apkfs.NewMemFS())
+	path := filepath.Join(t.TempDir(), opts.FileName+"."+cx.Ext())
+	require.NoError(t, cx.Generate(t.Context(), opts, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+	return doc
+}
+
+func TestGenerate(t *testing.T) {
+	doc := generate(t, testOpts)
+
+	require.Equal(t, "CycloneDX", doc.BOMFormat)
+	require.Equal(t, "1.6", doc.SpecVersion)
+	require.Equal(t, "2023-11-14T22:13:20Z", doc.Metadata.Timestamp)
+	require.NotNil(t, doc.Metadata.Component)
+	require.Equal(t, "container", doc.Metadata.Component.Type)
+	require.Equal(t, []Hash{{Algorithm: "SHA-256", Content: "9e1bb6fdd8d1e3aea2ec4e6a0e6aa5e4d8bd3b5e3b5bb1b6a9ab3b2d3e4f5a6b"}}, doc.Metadata.Component.Hashes)
+
+	components := map[string]Component{}
+	for _, c := range doc.Components {
+		components[c.Name] = c
+	}
+	busybox, ok := components["busybox"]
+	require.True(t, ok, "missing busybox component")
+	require.Equal(t, Component{
+		BOMRef:             "pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64",
+		Type:               "library",
+		Name:               "busybox",
+		Version:            "1.36.1-r0",
+		Description:        "Size optimized toolbox of many common UNIX utilities",
+		Supplier:           &Entity{Name: "Wolfi"},
+		Licenses:           []License{{Expression: "GPL-2.0-only"}},
+		PURL:               "pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64",
+		Hashes:             []Hash{{Algorithm: "SHA-1", Content: "0de6f48cdcad92b8cf5b837f78a2d9e370703a5c"}},
+		ExternalReferences: []ExternalRef{{Type: "website", URL: "https://busybox.net"}},
+		Properties:         []Property{{Name: "apk:origin", Value: "busybox"}},
+	}, busybox)
+	require.Equal(t, "operating-system", components["wolfi"].Type)
+
+	deps := map[string][]string{}
+	for _, d := range doc.Dependencies {
+		deps[d.Ref] = d.DependsOn
+	}
+	require.Equal(t, []string{"pkg:apk/wolfi/glibc@2.38-r1?arch=x86_64"}, deps["pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64"])
+	require.Empty(t, deps["pkg:apk/wolfi/glibc@2.38-r1?arch=x86_64"])
+	require.Len(t, deps[doc.Metadata.Component.BOMRef], 1)
+}
+
+func TestGenerateConfigDigest(t *testing.T) {
+	opts := *testOpts
+	opts.ImageInfo.ConfigDigest = "sha256:1234"
+	doc := generate(t, &opts)
+
+	require.Equal(t, []Property{{Name: "apko:config-digest", Value: "sha256:1234"}}, doc.Metadata.Properties)
+	require.Empty(t, generate(t, testOpts).Metadata.Properties)
+}
+
+func TestReproducible(t *testing.T) {
+	// Create two sboms based on the same input and ensure
+	// they are identical
+	dir := t.TempDir()
+	cx := New(apkfs.NewMemFS())
+	d := [][]byte{}
+	for i := 0; i < 2; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("sbom%d.%s", i, cx.Ext()))
+		require.NoError(t, cx.Generate(t.Context(), testOpts, path))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		d = append(d, data)
+	}
+	diff := cmp.Diff(d[0], d[1])
+	require.Empty(t, diff, fmt.Sprintf("difference in expected output %s", diff))
+}
+
+func TestGenerateIndex(t *testing.T) {
+	opts := *testOpts
+	opts.ImageInfo.IndexDigest = v1.Hash{Algorithm: "sha256", Hex: "aaaa"}
+	opts.ImageInfo.Images = []options.ArchImageInfo{
+		{Digest: v1.Hash{Algorithm: "sha256", Hex: "bbbb"}, Arch: types.ParseArchitecture("amd64")},
+		{Digest: v1.Hash{Algorithm: "sha256", Hex: "cccc"}, Arch: types.ParseArchitecture("arm64"), Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+	}
+
+	cx := New(apkfs.NewMemFS())
+	path := filepath.Join(t.TempDir(), "sbom-index."+cx.Ext())
+	require.NoError(t, cx.GenerateIndexContext(t.Context(), &opts, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	require.Equal(t, "sha256:aaaa", doc.Metadata.Component.Name)
+	require.Len(t, doc.Components, 2)
+	require.Equal(t, "linux/amd64", doc.Components[0].Properties[0].Value)
+	// the platform of the index, with the configured variant
+	require.Equal(t, "linux/arm64/v8", doc.Components[1].Properties[0].Value)
+	require.Equal(t, []Dependency{{
+		Ref:       doc.Metadata.Component.BOMRef,
+		DependsOn: []string{doc.Components[0].BOMRef, doc.Components[1].BOMRef},
+	}}, doc.Dependencies)
+
+	opts.ImageInfo.Images = nil
+	require.Error(t, cx.GenerateIndex(&opts, path))
+}
+
+func TestGenerateIndexImageSBOMs(t *testing.T) {
+	cx := New(apkfs.NewMemFS())
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "sbom-x86_64."+cx.Ext())
+	require.NoError(t, cx.Generate(t.Context(), testOpts, imagePath))
+	data, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	imageDoc := &Document{}
+	require.NoError(t, json.Unmarshal(data, imageDoc))
+
+	opts := *testOpts
+	opts.ImageInfo.IndexDigest = v1.Hash{Algorithm: "sha256", Hex: "aaaa"}
+	opts.ImageInfo.Images = []options.ArchImageInfo{{
+		Digest:     v1.Hash{Algorithm: "sha256", Hex: "bbbb"},
+		Arch:       types.ParseArchitecture("amd64"),
+		SBOMDigest: "dddd",
+		SBOMPath:   imagePath,
+	}}
+	path := filepath.Join(dir, "sbom-index."+cx.Ext())
+	require.NoError(t, cx.GenerateIndexContext(t.Context(), &opts, path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	require.Len(t, doc.Components, 1)
+	require.Regexp(t, `^urn:uuid:`, imageDoc.SerialNumber)
+	require.Equal(t, []ExternalRef{{
+		Type:   "bom",
+		URL:    "urn:cdx:" + imageDoc.SerialNumber[len("urn:uuid:"):] + "/1",
+		Hashes: []Hash{{Algorithm: "SHA-256", Content: "dddd"}},
+	}}, doc.Components[0].ExternalReferences)
+
+	opts.ImageInfo.Images[0].SBOMPath = filepath.Join(dir, "missing.cdx.json")
+	require.Error(t, cx.GenerateIndexContext(t.Context(), &opts, path))
+}
+
+func TestGenerateFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("bin", 0o755))
+	require.NoError(t, fsys.WriteFile("bin/busybox", []byte("hello\n"), 0o755))
+
+	opts := *testOpts
+	opts.IncludeFiles = true
+	busybox := *opts.Packages[0]
+	busybox.Files = []tar.Header{
+		{Name: "bin", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "bin/busybox", Mode: 0o755},
+	}
+	opts.Packages = []*apk.InstalledPackage{&busybox, opts.Packages[1]}
+
+	cx := New(fsys)
+	path := filepath.Join(t.TempDir(), opts.FileName+"."+cx.Ext())
+	require.NoError(t, cx.Generate(t.Context(), &opts, path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	for _, c := range doc.Components {
+		switch c.Name {
+		case "busybox":
+			require.Equal(t, []Component{{
+				BOMRef: "file:/bin/busybox",
+				Type:   "file",
+				Name:   "/bin/busybox",
+				Hashes: []Hash{{Algorithm: "SHA-256", Content: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"}},
+			}}, c.Components)
+		default:
+			require.Empty(t, c.Components)
+		}
+	}
+
+	// Files are only listed when asked for.
+	require.Empty(t, generate(t, testOpts).Components[2].Components)
+}
+
+func TestGenerateLicenseFiles(t *testing.T) {
+	opts := *testOpts
+	// A copy of the package, as the installed database is read again for the
+	// SBOM after the license files are collected.
+	busybox := *opts.Packages[0]
+	opts.LicenseFiles = []options.LicenseFile{{
+		Path:    "licenses/busybox/LICENSE",
+		Source:  "usr/share/licenses/busybox/LICENSE",
+		SHA256:  "aaaa",
+		Package: &busybox,
+	}}
+
+	doc := generate(t, &opts)
+	for _, c := range doc.Components {
+		switch c.Name {
+		case "busybox":
+			require.Contains(t, c.ExternalReferences, ExternalRef{
+				Type:    "license",
+				URL:     "file:///licenses/busybox/LICENSE",
+				Comment: "Collected from /usr/share/licenses/busybox/LICENSE",
+				Hashes:  []Hash{{Algorithm: "SHA-256", Content: "aaaa"}},
+			})
+		default:
+			for _, ref := range c.ExternalReferences {
+				require.NotEqual(t, "license", ref.Type, c.Name)
+			}
+		}
+	}
+}
+
+func TestGenerateLocalFiles(t *testing.T) {
+	opts := *testOpts
+	opts.LocalFiles = []options.LocalFile{{
+		Path:   "srv/app/config.yaml",
+		Source: "app/config.yaml",
+		SHA256: "aaaa",
+	}}
+
+	require.Contains(t, generate(t, &opts).Components, Component{
+		BOMRef:      "file:/srv/app/config.yaml",
+		Type:        "file",
+		Name:        "/srv/app/config.yaml",
+		Description: "Copied from the build context at app/config.yaml",
+		Hashes:      []Hash{{Algorithm: "SHA-256", Content: "aaaa"}},
+	})
+}
+
+func TestGenerateRemoteFiles(t *testing.T) {
+	opts := *testOpts
+	opts.RemoteFiles = []options.RemoteFile{{
+		URL:    "https://example.com/docs.zip",
+		SHA256: "bbbb",
+		Path:   "usr/share/doc/tool",
+		Files:  []options.LocalFile{{Path: "usr/share/doc/tool/README", Source: "README", SHA256: "cccc"}},
+	}}
+
+	require.Contains(t, generate(t, &opts).Components, Component{
+		BOMRef:      "pkg:generic/docs.zip?checksum=sha256%3Abbbb&download_url=https%3A%2F%2Fexample.com%2Fdocs.zip",
+		Type:        "data",
+		Name:        "docs.zip",
+		Description: "Extracted to /usr/share/doc/tool",
+		PURL:        "pkg:generic/docs.zip?checksum=sha256%3Abbbb&download_url=https%3A%2F%2Fexample.com%2Fdocs.zip",
+		Hashes:      []Hash{{Algorithm: "SHA-256", Content: "bbbb"}},
+		ExternalReferences: []ExternalRef{{
+			Type:   "distribution",
+			URL:    "https://example.com/docs.zip",
+			Hashes: []Hash{{Algorithm: "SHA-256", Content: "bbbb"}},
+		}},
+		Components: []Component{{
+			BOMRef:      "file:/usr/share/doc/tool/README",
+			Type:        "file",
+			Name:        "/usr/share/doc/tool/README",
+			Description: "Extracted from README",
+			Hashes:      []Hash{{Algorithm: "SHA-256", Content: "cccc"}},
+		}},
+	})
+}
+
+func TestProcessors(t *testing.T) {
+	opts := *testOpts
+	opts.Processors = []options.Processor{options.ProcessorFunc(func(_ context.Context, format string, doc any, _ *options.Options) error {
+		require.Equal(t, "cyclonedx", format)
+		d := doc.(*Document)
+		d.Metadata.Component.Properties = append(d.Metadata.Component.Properties, Property{Name: "acme:team", Value: "platform"})
+		return nil
+	})}
+
+	plain, processed := generate(t, testOpts), generate(t, &opts)
+	require.Contains(t, processed.Metadata.Component.Properties, Property{Name: "acme:team", Value: "platform"})
+	// The serial number is derived from the processed document.
+	require.NotEqual(t, plain.SerialNumber, processed.SerialNumber)
+}
+
+func TestPackageMetadata(t *testing.T) {
+	pkg := &apk.Package{
+		Name:       "libcrypto3",
+		Version:    "3.1.4-r0",
+		Arch:       "aarch64",
+		License:    "Apache-2.0",
+		Origin:     "openssl",
+		Maintainer: "Wolfi <wolfi@chainguard.dev>",
+		RepoCommit: "868f0dc23e721039f9669b56d01ea4b897f2fb24",
+	}
+	c := packageComponent(testOpts, pkg)
+	require.Equal(t, []Contact{{Name: "Wolfi", Email: "wolfi@chainguard.dev"}}, c.Authors)
+	require.Equal(t, &Pedigree{Commits: []Commit{{UID: "868f0dc23e721039f9669b56d01ea4b897f2fb24"}}}, c.Pedigree)
+	require.Equal(t, []Property{
+		{Name: "apk:origin", Value: "openssl"},
+		{Name: "apk:commit", Value: "868f0dc23e721039f9669b56d01ea4b897f2fb24"},
+	}, c.Properties)
+
+	pkg.Maintainer = "the openssl maintainers"
+	require.Equal(t, []Contact{{Name: "the openssl maintainers"}}, packageComponent(testOpts, pkg).Authors)
+
+	opts := *testOpts
+	opts.PackageSignatures = map[string]apk.Verification{"libcrypto3": {Verified: true, KeyID: "wolfi-signing.rsa.pub", Algorithm: "RSA-SHA256"}}
+	require.Subset(t, packageComponent(&opts, pkg).Properties, []Property{
+		{Name: "apk:signature-key", Value: "wolfi-signing.rsa.pub"},
+		{Name: "apk:signature-algorithm", Value: "RSA-SHA256"},
+	})
+	opts.PackageSignatures = map[string]apk.Verification{"libcrypto3": {Reason: apk.ReasonSignaturesIgnored}}
+	require.Contains(t, packageComponent(&opts, pkg).Properties, Property{Name: "apk:signature-unverified", Value: "signature verification is disabled"})
+}
@@ -19,6 +19,7 @@ import (
 
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 
+	"chainguard.dev/apko/pkg/sbom/generator/cyclonedx"
 	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
@@ -28,6 +29,7 @@ type Generator interface {
 	Ext() string
 	Generate(context.Context, *options.Options, string) error
 	GenerateIndex(*options.Options, string) error
+	GenerateIndexContext(context.Context, *options.Options, string) error
 }
 
 func Generators(fsys apkfs.FullFS) map[string]Generator {
@@ -36,5 +38,8 @@ func Generators(fsys apkfs.FullFS) map[string]Generator {
 	sx := spdx.New(fsys)
 	generators[sx.Key()] = &sx
 
+	cx := cyclonedx.New(fsys)
+	generators[cx.Key()] = &cx
+
 	return generators
 }
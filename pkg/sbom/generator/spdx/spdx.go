@@ -16,11 +16,17 @@ package spdx
 
 import (
 	"context"
+	"crypto"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"net/mail"
 	"os"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -31,6 +37,7 @@ import (
 	"sigs.k8s.io/release-utils/version"
 
 	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/digest"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
@@ -42,6 +49,8 @@ const (
 	NOASSERTION          = "NOASSERTION"
 	ExtRefPackageManager = "PACKAGE-MANAGER"
 	ExtRefTypePurl       = "purl"
+	ExtRefPersistentID   = "PERSISTENT-ID"
+	ExtRefTypeGitoid     = "gitoid"
 	apkSBOMdir           = "/var/lib/db/sbom"
 )
 
@@ -114,8 +123,10 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 		doc.Packages = append(doc.Packages, *imagePackage)
 	}
 
+	var layerID string
 	for _, layer := range opts.ImageInfo.Layers {
 		layerPackage := sx.layerPackage(opts, layer)
+		layerID = layerPackage.ID
 
 		// Add to the relationships list
 		if imagePackage != nil {
@@ -144,6 +155,11 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 		}
 	}
 
+	if len(doc.DocumentDescribes) != 0 {
+		addBuildTools(doc, opts, doc.DocumentDescribes[0])
+	}
+	addConfigDigest(doc, opts)
+
 	for _, pkg := range opts.Packages {
 		// Check to see if the apk contains an sbom describing itself
 		if err := sx.ProcessInternalApkSBOM(opts, doc, pkg); err != nil {
@@ -163,6 +179,22 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 	}
 	doc.Packages = dedupedPackages
 
+	addApkPackages(doc, opts, layerID)
+
+	if opts.IncludeFiles {
+		if err := sx.addFiles(doc, opts); err != nil {
+			return fmt.Errorf("adding files: %w", err)
+		}
+	}
+
+	addLicenseFiles(doc, opts)
+	addLocalFiles(doc, opts)
+	addRemoteFiles(doc, opts, layerID)
+
+	if err := opts.Process(ctx, sx.Key(), doc); err != nil {
+		return fmt.Errorf("processing SBOM: %w", err)
+	}
+
 	if err := renderDoc(doc, path); err != nil {
 		return fmt.Errorf("rendering document: %w", err)
 	}
@@ -292,6 +324,7 @@ func copySBOMElements(sourceDoc, targetDoc *Document, todo map[string]struct{})
 				missing = append(missing, want)
 			}
 		}
+		sort.Strings(missing)
 
 		return fmt.Errorf("unable to find %d elements in source document: %v", missed, missing)
 	}
@@ -353,8 +386,47 @@ func (sx *SPDX) ParseInternalSBOM(opts *options.Options, path string) (*Document
 	return internalSBOM, nil
 }
 
+// canonicalize sorts the elements of the document, which have no meaningful
+// order, and appends a UUID derived from the rest of the document to its
+// namespace, so that the same image always gets a byte-identical SBOM.
+func canonicalize(doc *Document) error {
+	sort.SliceStable(doc.Packages, func(i, j int) bool {
+		return doc.Packages[i].ID < doc.Packages[j].ID
+	})
+	sort.SliceStable(doc.Relationships, func(i, j int) bool {
+		a, b := doc.Relationships[i], doc.Relationships[j]
+		if a.Element != b.Element {
+			return a.Element < b.Element
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Related < b.Related
+	})
+	sort.SliceStable(doc.ExternalDocumentRefs, func(i, j int) bool {
+		return doc.ExternalDocumentRefs[i].ExternalDocumentID < doc.ExternalDocumentRefs[j].ExternalDocumentID
+	})
+	sort.SliceStable(doc.LicensingInfos, func(i, j int) bool {
+		return doc.LicensingInfos[i].LicenseID < doc.LicensingInfos[j].LicenseID
+	})
+	sort.SliceStable(doc.Files, func(i, j int) bool {
+		return doc.Files[i].ID < doc.Files[j].ID
+	})
+
+	id, err := options.ContentUUID(doc)
+	if err != nil {
+		return err
+	}
+	doc.Namespace = strings.TrimSuffix(doc.Namespace, "/") + "/" + doc.Name + "-" + id
+	return nil
+}
+
 // renderDoc marshals a document to json and writes it to disk
 func renderDoc(doc *Document, path string) error {
+	if err := canonicalize(doc); err != nil {
+		return fmt.Errorf("canonicalizing document: %w", err)
+	}
+
 	out, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("opening SBOM path %s for writing: %w", path, err)
@@ -449,6 +521,7 @@ type Document struct {
 	Relationships        []Relationship        `json:"relationships"`
 	ExternalDocumentRefs []ExternalDocumentRef `json:"externalDocumentRefs,omitempty"`
 	LicensingInfos       []LicensingInfo       `json:"hasExtractedLicensingInfos,omitempty"`
+	Files                []File                `json:"files,omitempty"`
 }
 
 type ExternalDocumentRef struct {
@@ -479,6 +552,7 @@ type File struct {
 	FileTypes         []string   `json:"fileTypes,omitempty"`
 	LicenseInfoInFile []string   `json:"licenseInfoInFiles,omitempty"` // List of licenses
 	Checksums         []Checksum `json:"checksums,omitempty"`
+	Comment           string     `json:"comment,omitempty"`
 }
 
 type Package struct {
@@ -490,6 +564,7 @@ type Package struct {
 	LicenseDeclared  string                   `json:"licenseDeclared,omitempty"`
 	Description      string                   `json:"description,omitempty"`
 	DownloadLocation string                   `json:"downloadLocation"`
+	Homepage         string                   `json:"homepage,omitempty"`
 	Originator       string                   `json:"originator,omitempty"`
 	Supplier         string                   `json:"supplier,omitempty"`
 	SourceInfo       string                   `json:"sourceInfo,omitempty"`
@@ -499,6 +574,14 @@ type Package struct {
 	Checksums        []Checksum               `json:"checksums,omitempty"`
 	ExternalRefs     []ExternalRef            `json:"externalRefs,omitempty"`
 	VerificationCode *PackageVerificationCode `json:"packageVerificationCode,omitempty"`
+	Annotations      []Annotation             `json:"annotations,omitempty"`
+}
+
+type Annotation struct {
+	Date      string `json:"annotationDate"`
+	Type      string `json:"annotationType"`
+	Annotator string `json:"annotator"`
+	Comment   string `json:"comment"`
 }
 
 type PackageVerificationCode struct {
@@ -522,7 +605,14 @@ type Relationship struct {
 	Related string `json:"relatedSpdxElement"`
 }
 
+// GenerateIndex writes an SPDX SBOM of an index in path
 func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
+	return sx.GenerateIndexContext(context.Background(), opts, path)
+}
+
+// GenerateIndexContext writes an SPDX SBOM of an index in path, passing ctx
+// to the processors of opts.
+func (sx *SPDX) GenerateIndexContext(ctx context.Context, opts *options.Options, path string) error {
 	if len(opts.ImageInfo.Images) == 0 {
 		return errors.New("unable to render index sbom, no architecture images found")
 	}
@@ -613,12 +703,27 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 			Element: stringToIdentifier(indexPackage.ID),
 			Type:    "VARIANT_OF",
 			Related: imagePackageID,
+		}, Relationship{
+			Element: indexPackage.ID,
+			Type:    "CONTAINS",
+			Related: imagePackageID,
 		})
+
+		if info.SBOMPath != "" {
+			if err := addImageSBOMRef(doc, imagePackageID, info); err != nil {
+				return fmt.Errorf("referencing %s image SBOM: %w", info.Arch, err)
+			}
+		}
 	}
 
 	if opts.ImageInfo.VCSUrl != "" {
 		addSourcePackage(opts.ImageInfo.VCSUrl, doc, &indexPackage, opts)
 	}
+	addConfigDigest(doc, opts)
+
+	if err := opts.Process(ctx, sx.Key(), doc); err != nil {
+		return fmt.Errorf("processing SBOM: %w", err)
+	}
 
 	if err := renderDoc(doc, path); err != nil {
 		return fmt.Errorf("rendering document: %w", err)
@@ -627,6 +732,43 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 	return nil
 }
 
+// addImageSBOMRef references the SBOM of an image of the index as an external
+// document, which describes the image, so that consumers of the index SBOM
+// can find the contents of every platform.
+func addImageSBOMRef(doc *Document, imagePackageID string, info options.ArchImageInfo) error {
+	data, err := os.ReadFile(info.SBOMPath)
+	if err != nil {
+		return fmt.Errorf("reading SBOM: %w", err)
+	}
+	imageDoc := &Document{}
+	if err := json.Unmarshal(data, imageDoc); err != nil {
+		return fmt.Errorf("parsing SBOM: %w", err)
+	}
+
+	// SPDX requires a SHA1 checksum of referenced documents
+	h, err := digest.Identify(crypto.SHA1)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	sum := h.Sum(nil)
+	docRef := "DocumentRef-image-" + stringToIdentifier(info.Arch.String())
+	doc.ExternalDocumentRefs = append(doc.ExternalDocumentRefs, ExternalDocumentRef{
+		Checksum: Checksum{
+			Algorithm: "SHA1",
+			Value:     hex.EncodeToString(sum),
+		},
+		ExternalDocumentID: docRef,
+		SPDXDocument:       imageDoc.Namespace,
+	})
+	doc.Relationships = append(doc.Relationships, Relationship{
+		Element: imagePackageID,
+		Type:    "DESCRIBED_BY",
+		Related: docRef + ":" + imageDoc.ID,
+	})
+	return nil
+}
+
 // addOperatingSystem adds a package describing the operating system
 func addOperatingSystem(doc *Document, opts *options.Options) {
 	osPackage := Package{
@@ -640,9 +782,351 @@ func addOperatingSystem(doc *Document, opts *options.Options) {
 		PrimaryPurpose:   "OPERATING-SYSTEM",
 	}
 
+	// The packages were resolved from the indexes of the operating system,
+	// whose verification is recorded for auditing the build.
+	for _, u := range slices.Sorted(maps.Keys(opts.IndexSignatures)) {
+		osPackage.Annotations = append(osPackage.Annotations,
+			apkoAnnotation(opts, fmt.Sprintf("apk index %s %s", u, opts.IndexSignatures[u])))
+	}
+
 	doc.Packages = append(doc.Packages, osPackage)
 }
 
+// apkoAnnotation returns an annotation by apko, e.g. recording how a
+// signature was verified.
+func apkoAnnotation(opts *options.Options, comment string) Annotation {
+	return Annotation{
+		Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+		Type:      "OTHER",
+		Annotator: fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
+		Comment:   comment,
+	}
+}
+
+// addConfigDigest annotates the described package with the digest of the
+// configuration it was built from.
+func addConfigDigest(doc *Document, opts *options.Options) {
+	if opts.ImageInfo.ConfigDigest == "" || len(doc.DocumentDescribes) == 0 {
+		return
+	}
+	for i := range doc.Packages {
+		if doc.Packages[i].ID == doc.DocumentDescribes[0] {
+			doc.Packages[i].Annotations = append(doc.Packages[i].Annotations,
+				apkoAnnotation(opts, "apko configuration "+opts.ImageInfo.ConfigDigest))
+			return
+		}
+	}
+}
+
+// addBuildTools adds a package for each build tool which was applied to the
+// described element
+func addBuildTools(doc *Document, opts *options.Options, described string) {
+	for _, tool := range opts.BuildTools {
+		toolPackage := Package{
+			ID:               fmt.Sprintf("SPDXRef-BuildTool-%s", stringToIdentifier(tool.Name)),
+			Name:             tool.Name,
+			Version:          version.GetVersionInfo().GitVersion,
+			Supplier:         "Organization: Chainguard, Inc",
+			FilesAnalyzed:    false,
+			Description:      tool.Description,
+			DownloadLocation: NOASSERTION,
+			PrimaryPurpose:   "APPLICATION",
+		}
+
+		doc.Packages = append(doc.Packages, toolPackage)
+		doc.Relationships = append(doc.Relationships, Relationship{
+			Element: toolPackage.ID,
+			Type:    "BUILD_TOOL_OF",
+			Related: described,
+		})
+	}
+}
+
+// addApkPackages adds a package for each installed apk which did not come with
+// an SBOM of its own, contained by the layer, and fills in what is missing from
+// the packages taken from the apks' SBOMs with the metadata in .PKGINFO.
+func addApkPackages(doc *Document, opts *options.Options, layerID string) {
+	index := make(map[string]int, len(doc.Packages))
+	for i, p := range doc.Packages {
+		index[p.Name+"@"+p.Version] = i
+	}
+	for _, ipkg := range opts.Packages {
+		if i, ok := index[ipkg.Name+"@"+ipkg.Version]; ok {
+			enrichApkPackage(&doc.Packages[i], opts, &ipkg.Package)
+			continue
+		}
+		p := Package{
+			ID:               "SPDXRef-Package-" + stringToIdentifier(ipkg.Name+"-"+ipkg.Version),
+			Name:             ipkg.Name,
+			Version:          ipkg.Version,
+			FilesAnalyzed:    false,
+			LicenseConcluded: NOASSERTION,
+			DownloadLocation: NOASSERTION,
+			Originator:       originator(&ipkg.Package),
+			Supplier:         supplier(opts),
+			CopyrightText:    NOASSERTION,
+		}
+		if len(ipkg.Checksum) != 0 {
+			// apk identifies packages by the checksum of their control section.
+			p.Checksums = []Checksum{{Algorithm: "SHA1", Value: hex.EncodeToString(ipkg.Checksum)}}
+		}
+		if p.Originator == "" {
+			p.Originator = p.Supplier
+		}
+		enrichApkPackage(&p, opts, &ipkg.Package)
+		doc.Packages = append(doc.Packages, p)
+		if layerID != "" {
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: layerID,
+				Type:    "CONTAINS",
+				Related: p.ID,
+			})
+		}
+	}
+}
+
+// enrichApkPackage fills in the fields of p which are not set with the
+// metadata of the apk it describes
+func enrichApkPackage(p *Package, opts *options.Options, pkg *apk.Package) {
+	if (p.LicenseDeclared == "" || p.LicenseDeclared == NOASSERTION) && pkg.License != "" {
+		p.LicenseDeclared = pkg.License
+	}
+	if p.LicenseDeclared == "" {
+		p.LicenseDeclared = NOASSERTION
+	}
+	if p.Description == "" {
+		p.Description = pkg.Description
+	}
+	if p.Homepage == "" {
+		p.Homepage = pkg.URL
+	}
+	if p.SourceInfo == "" {
+		p.SourceInfo = sourceInfo(pkg)
+	}
+
+	refs := map[string]struct{}{}
+	for _, ref := range p.ExternalRefs {
+		refs[ref.Type] = struct{}{}
+	}
+	if _, ok := refs[ExtRefTypePurl]; !ok {
+		p.ExternalRefs = append(p.ExternalRefs, ExternalRef{
+			Category: ExtRefPackageManager,
+			Type:     ExtRefTypePurl,
+			Locator:  opts.PackagePurl(pkg),
+		})
+	}
+	if _, ok := refs[ExtRefTypeGitoid]; !ok {
+		if id := commitGitoid(pkg.RepoCommit); id != "" {
+			p.ExternalRefs = append(p.ExternalRefs, ExternalRef{
+				Category: ExtRefPersistentID,
+				Type:     ExtRefTypeGitoid,
+				Locator:  id,
+			})
+		}
+	}
+
+	if v, ok := opts.PackageSignatures[pkg.Name]; ok {
+		p.Annotations = append(p.Annotations, apkoAnnotation(opts, "apk signature "+v.String()))
+	}
+}
+
+// originator returns the maintainer of an apk as an SPDX originator
+func originator(pkg *apk.Package) string {
+	if pkg.Maintainer == "" {
+		return ""
+	}
+	if addr, err := mail.ParseAddress(pkg.Maintainer); err == nil && addr.Name != "" {
+		return fmt.Sprintf("Person: %s (%s)", addr.Name, addr.Address)
+	}
+	return "Person: " + pkg.Maintainer
+}
+
+// sourceInfo describes the origin package and commit an apk was built from
+func sourceInfo(pkg *apk.Package) string {
+	var parts []string
+	if pkg.Origin != "" && pkg.Origin != pkg.Name {
+		parts = append(parts, "origin package "+pkg.Origin)
+	}
+	if pkg.RepoCommit != "" {
+		parts = append(parts, "commit "+pkg.RepoCommit)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "built from " + strings.Join(parts, " at ")
+}
+
+var gitCommitRe = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// commitGitoid returns the gitoid URI of a git commit, or "" if commit is not
+// a full git commit hash
+func commitGitoid(commit string) string {
+	if !gitCommitRe.MatchString(commit) {
+		return ""
+	}
+	algo := "sha1"
+	if len(commit) == 64 {
+		algo = "sha256"
+	}
+	return fmt.Sprintf("gitoid:commit:%s:%s", algo, commit)
+}
+
+// addFiles adds the files installed by each package, contained by the
+// package when it is in the document and by the described element otherwise
+func (sx *SPDX) addFiles(doc *Document, opts *options.Options) error {
+	files, err := opts.InstalledFiles(sx.fs)
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]string, len(doc.Packages))
+	for _, p := range doc.Packages {
+		owners[p.Name+"@"+p.Version] = p.ID
+	}
+	seen := make(map[string]struct{}, len(files))
+	for _, f := range files {
+		id := "SPDXRef-File-" + stringToIdentifier(f.Path)
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		doc.Files = append(doc.Files, File{
+			ID:        id,
+			Name:      "/" + f.Path,
+			Checksums: []Checksum{{Algorithm: "SHA256", Value: f.SHA256}},
+			Comment:   fmt.Sprintf("Installed by apk package %s-%s", f.Package.Name, f.Package.Version),
+		})
+		owner, ok := owners[f.Package.Name+"@"+f.Package.Version]
+		if !ok {
+			if len(doc.DocumentDescribes) == 0 {
+				continue
+			}
+			owner = doc.DocumentDescribes[0]
+		}
+		doc.Relationships = append(doc.Relationships, Relationship{
+			Element: owner,
+			Type:    "CONTAINS",
+			Related: id,
+		})
+	}
+	return nil
+}
+
+// addLicenseFiles lists the license files collected into the image, contained
+// by the package they were collected from.
+func addLicenseFiles(doc *Document, opts *options.Options) {
+	owners := make(map[string]string, len(doc.Packages))
+	for _, p := range doc.Packages {
+		owners[p.Name+"@"+p.Version] = p.ID
+	}
+	for _, f := range opts.LicenseFiles {
+		id := "SPDXRef-File-" + stringToIdentifier(f.Path)
+		doc.Files = append(doc.Files, File{
+			ID:        id,
+			Name:      "/" + f.Path,
+			FileTypes: []string{"TEXT"},
+			Checksums: []Checksum{{Algorithm: "SHA256", Value: f.SHA256}},
+			Comment:   fmt.Sprintf("License file of apk package %s-%s, collected from /%s", f.Package.Name, f.Package.Version, f.Source),
+		})
+		owner, ok := owners[f.Package.Name+"@"+f.Package.Version]
+		if !ok {
+			if len(doc.DocumentDescribes) == 0 {
+				continue
+			}
+			owner = doc.DocumentDescribes[0]
+		}
+		doc.Relationships = append(doc.Relationships, Relationship{
+			Element: owner,
+			Type:    "CONTAINS",
+			Related: id,
+		})
+	}
+}
+
+// addLocalFiles lists the files copied into the image from the build
+// context, contained by the described element as no package owns them.
+func addLocalFiles(doc *Document, opts *options.Options) {
+	if len(doc.DocumentDescribes) == 0 {
+		return
+	}
+	for _, f := range opts.LocalFiles {
+		id := "SPDXRef-File-" + stringToIdentifier(f.Path)
+		doc.Files = append(doc.Files, File{
+			ID:        id,
+			Name:      "/" + f.Path,
+			FileTypes: []string{"OTHER"},
+			Checksums: []Checksum{{Algorithm: "SHA256", Value: f.SHA256}},
+			Comment:   "Copied from the build context at " + f.Source,
+		})
+		doc.Relationships = append(doc.Relationships, Relationship{
+			Element: doc.DocumentDescribes[0],
+			Type:    "CONTAINS",
+			Related: id,
+		})
+	}
+}
+
+// addRemoteFiles adds a package for each file fetched by URL into the image,
+// recording where it was fetched from and its digest, which contains the
+// file or the files extracted from the archive.
+func addRemoteFiles(doc *Document, opts *options.Options, layerID string) {
+	owner := layerID
+	if owner == "" && len(doc.DocumentDescribes) != 0 {
+		owner = doc.DocumentDescribes[0]
+	}
+	for _, f := range opts.RemoteFiles {
+		p := Package{
+			ID:               "SPDXRef-RemoteFile-" + stringToIdentifier(f.Path),
+			Name:             f.Name(),
+			FilesAnalyzed:    false,
+			LicenseConcluded: NOASSERTION,
+			LicenseDeclared:  NOASSERTION,
+			DownloadLocation: f.URL,
+			CopyrightText:    NOASSERTION,
+			PrimaryPurpose:   "FILE",
+			Checksums:        []Checksum{{Algorithm: "SHA256", Value: f.SHA256}},
+			ExternalRefs: []ExternalRef{{
+				Category: ExtRefPackageManager,
+				Type:     ExtRefTypePurl,
+				Locator:  f.Purl(),
+			}},
+		}
+		files := []options.LocalFile{{Path: f.Path, SHA256: f.SHA256}}
+		if f.Files != nil {
+			p.PrimaryPurpose = "ARCHIVE"
+			files = f.Files
+		}
+		doc.Packages = append(doc.Packages, p)
+		if owner != "" {
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: owner,
+				Type:    "CONTAINS",
+				Related: p.ID,
+			})
+		}
+
+		for _, lf := range files {
+			id := "SPDXRef-File-" + stringToIdentifier(lf.Path)
+			file := File{
+				ID:        id,
+				Name:      "/" + lf.Path,
+				Checksums: []Checksum{{Algorithm: "SHA256", Value: lf.SHA256}},
+				Comment:   "Fetched from " + f.URL,
+			}
+			if lf.Source != "" {
+				file.Comment = fmt.Sprintf("Extracted from %s of %s", lf.Source, f.URL)
+			}
+			doc.Files = append(doc.Files, file)
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: p.ID,
+				Type:    "CONTAINS",
+				Related: id,
+			})
+		}
+	}
+}
+
 // addSourcePackage creates a package describing the source code
 func addSourcePackage(vcsURL string, doc *Document, parent *Package, opts *options.Options) {
 	version := ""
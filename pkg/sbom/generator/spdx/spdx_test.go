@@ -15,6 +15,9 @@
 package spdx
 
 import (
+	"archive/tar"
+	"context"
+	"crypto/sha1" //nolint:gosec // SPDX references documents by SHA1
 	"encoding/json"
 	"fmt"
 	"os"
@@ -22,14 +25,17 @@ import (
 	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/stretchr/testify/require"
 	"sigs.k8s.io/release-utils/command"
+	"sigs.k8s.io/release-utils/version"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
 
@@ -262,6 +268,95 @@ func TestReproducible(t *testing.T) {
 	require.Empty(t, diff, fmt.Sprintf("difference in expected output %s", diff))
 }
 
+func TestGenerateIndex(t *testing.T) {
+	dir := t.TempDir()
+	sx := New(apkfs.NewMemFS())
+	imageOpts := *testOpts
+	imageOpts.ImageInfo.ImageDigest = "sha256:bbbb"
+	imagePath := filepath.Join(dir, "sbom-x86_64."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), &imageOpts, imagePath))
+	data, err := os.ReadFile(imagePath)
+	require.NoError(t, err)
+	imageDoc := &Document{}
+	require.NoError(t, json.Unmarshal(data, imageDoc))
+	imageSum := sha1.Sum(data) //nolint:gosec
+
+	opts := *testOpts
+	opts.ImageInfo.IndexDigest = v1.Hash{Algorithm: "sha256", Hex: "aaaa"}
+	opts.ImageInfo.Images = []options.ArchImageInfo{{
+		Digest:   v1.Hash{Algorithm: "sha256", Hex: "bbbb"},
+		Arch:     types.ParseArchitecture("amd64"),
+		SBOMPath: imagePath,
+	}, {
+		Digest: v1.Hash{Algorithm: "sha256", Hex: "cccc"},
+		Arch:   types.ParseArchitecture("arm64"),
+	}}
+	path := filepath.Join(dir, "sbom-index."+sx.Ext())
+	require.NoError(t, sx.GenerateIndexContext(t.Context(), &opts, path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	require.Equal(t, []ExternalDocumentRef{{
+		Checksum:           Checksum{Algorithm: "SHA1", Value: fmt.Sprintf("%x", imageSum)},
+		ExternalDocumentID: "DocumentRef-image-amd64",
+		SPDXDocument:       imageDoc.Namespace,
+	}}, doc.ExternalDocumentRefs)
+	require.ElementsMatch(t, []Relationship{
+		{Element: "SPDXRef-Package-sha256-aaaa", Type: "CONTAINS", Related: "SPDXRef-Package-sha256-bbbb"},
+		{Element: "SPDXRef-Package-sha256-aaaa", Type: "CONTAINS", Related: "SPDXRef-Package-sha256-cccc"},
+		{Element: "SPDXRef-Package-sha256-aaaa", Type: "VARIANT_OF", Related: "SPDXRef-Package-sha256-bbbb"},
+		{Element: "SPDXRef-Package-sha256-aaaa", Type: "VARIANT_OF", Related: "SPDXRef-Package-sha256-cccc"},
+		{Element: "SPDXRef-Package-sha256-bbbb", Type: "DESCRIBED_BY", Related: "DocumentRef-image-amd64:SPDXRef-DOCUMENT"},
+	}, doc.Relationships)
+
+	opts.ImageInfo.Images[1].SBOMPath = filepath.Join(dir, "missing.spdx.json")
+	require.Error(t, sx.GenerateIndex(&opts, path))
+}
+
+func TestProcessors(t *testing.T) {
+	sx := New(apkfs.NewMemFS())
+	generate := func(opts *options.Options) *Document {
+		path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+		require.NoError(t, sx.Generate(t.Context(), opts, path))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		doc := &Document{}
+		require.NoError(t, json.Unmarshal(data, doc))
+		return doc
+	}
+
+	opts := *testOpts
+	opts.Processors = []options.Processor{options.ProcessorFunc(func(_ context.Context, format string, doc any, _ *options.Options) error {
+		require.Equal(t, "spdx", format)
+		d := doc.(*Document)
+		for i := range d.Packages {
+			if d.Packages[i].Name == "musl" {
+				d.Packages[i].AttributionText = "owner: team-libc"
+			}
+		}
+		return nil
+	})}
+
+	plain, processed := generate(testOpts), generate(&opts)
+	var found bool
+	for _, p := range processed.Packages {
+		if p.Name == "musl" {
+			require.Equal(t, "owner: team-libc", p.AttributionText)
+			found = true
+		}
+	}
+	require.True(t, found)
+	// The namespace is derived from the processed document.
+	require.NotEqual(t, plain.Namespace, processed.Namespace)
+
+	opts.Processors = []options.Processor{options.ProcessorFunc(func(context.Context, string, any, *options.Options) error {
+		return fmt.Errorf("boom")
+	})}
+	require.ErrorContains(t, sx.Generate(t.Context(), &opts, filepath.Join(t.TempDir(), "sbom.spdx.json")), "boom")
+}
+
 // To run TestValidateSPDX, point SPDX_TOOLS_JAR to the SPDX tools
 // jar file and make sure the java binary is in your path. The jar
 // can be downloaded from https://github.com/spdx/tools-java
@@ -338,3 +433,312 @@ func TestSourcePackage(t *testing.T) {
 	require.Equal(t, imagePackage.ID, doc.Relationships[0].Element)
 	require.Equal(t, doc.Packages[0].ID, doc.Relationships[0].Related)
 }
+
+func TestBuildTools(t *testing.T) {
+	doc := Document{}
+
+	addBuildTools(&doc, &options.Options{
+		BuildTools: []options.BuildTool{{
+			Name:        "apko-fixup-ldconfig",
+			Description: "Regenerates /etc/ld.so.cache",
+		}},
+	}, "SPDXRef-Package-image")
+
+	require.Len(t, doc.Packages, 1)
+	require.Equal(t, "SPDXRef-BuildTool-apko-fixup-ldconfig", doc.Packages[0].ID)
+	require.Equal(t, "apko-fixup-ldconfig", doc.Packages[0].Name)
+	require.Equal(t, "APPLICATION", doc.Packages[0].PrimaryPurpose)
+
+	require.Len(t, doc.Relationships, 1)
+	require.Equal(t, "BUILD_TOOL_OF", doc.Relationships[0].Type)
+	require.Equal(t, doc.Packages[0].ID, doc.Relationships[0].Element)
+	require.Equal(t, "SPDXRef-Package-image", doc.Relationships[0].Related)
+}
+
+func TestConfigDigest(t *testing.T) {
+	doc := Document{
+		DocumentDescribes: []string{"SPDXRef-Package-image"},
+		Packages:          []Package{{ID: "SPDXRef-Package-layer"}, {ID: "SPDXRef-Package-image"}},
+	}
+	opts := &options.Options{ImageInfo: options.ImageInfo{ConfigDigest: "sha256:1234"}}
+
+	addConfigDigest(&doc, opts)
+
+	require.Empty(t, doc.Packages[0].Annotations)
+	require.Equal(t, []Annotation{{
+		Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+		Type:      "OTHER",
+		Annotator: fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
+		Comment:   "apko configuration sha256:1234",
+	}}, doc.Packages[1].Annotations)
+}
+
+func TestAddFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("usr/lib", 0o755))
+	require.NoError(t, fsys.WriteFile("usr/lib/libc.so", []byte("hello\n"), 0o755))
+	require.NoError(t, fsys.WriteFile("usr/lib/libz.so", []byte("hello\n"), 0o755))
+	sx := New(fsys)
+
+	opts := &options.Options{
+		IncludeFiles: true,
+		Packages: []*apk.InstalledPackage{
+			{
+				Package: apk.Package{Name: "musl", Version: "1.2.2-r7"},
+				Files:   []tar.Header{{Name: "usr/lib/libc.so", Mode: 0o755}},
+			},
+			{
+				Package: apk.Package{Name: "zlib", Version: "1.3-r0"},
+				Files:   []tar.Header{{Name: "usr/lib/libz.so", Mode: 0o755}},
+			},
+		},
+	}
+	// Only musl has an SBOM of its own, so zlib's file is contained by the
+	// described element.
+	doc := &Document{
+		DocumentDescribes: []string{"SPDXRef-Image"},
+		Packages:          []Package{{ID: "SPDXRef-Package-musl", Name: "musl", Version: "1.2.2-r7"}},
+	}
+	require.NoError(t, sx.addFiles(doc, opts))
+
+	sum := "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	require.Equal(t, []File{{
+		ID:        "SPDXRef-File-usrC47libC47libc.so",
+		Name:      "/usr/lib/libc.so",
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: sum}},
+		Comment:   "Installed by apk package musl-1.2.2-r7",
+	}, {
+		ID:        "SPDXRef-File-usrC47libC47libz.so",
+		Name:      "/usr/lib/libz.so",
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: sum}},
+		Comment:   "Installed by apk package zlib-1.3-r0",
+	}}, doc.Files)
+	require.Equal(t, []Relationship{
+		{Element: "SPDXRef-Package-musl", Type: "CONTAINS", Related: "SPDXRef-File-usrC47libC47libc.so"},
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-File-usrC47libC47libz.so"},
+	}, doc.Relationships)
+}
+
+func TestAddLicenseFiles(t *testing.T) {
+	musl := &apk.InstalledPackage{Package: apk.Package{Name: "musl", Version: "1.2.2-r7"}}
+	zlib := &apk.InstalledPackage{Package: apk.Package{Name: "zlib", Version: "1.3-r0"}}
+	opts := &options.Options{
+		LicenseFiles: []options.LicenseFile{{
+			Path:    "licenses/musl/COPYRIGHT",
+			Source:  "usr/share/licenses/musl/COPYRIGHT",
+			SHA256:  "aaaa",
+			Package: musl,
+		}, {
+			Path:    "licenses/zlib/LICENSE",
+			Source:  "usr/share/licenses/zlib/LICENSE",
+			SHA256:  "bbbb",
+			Package: zlib,
+		}},
+	}
+	doc := &Document{
+		DocumentDescribes: []string{"SPDXRef-Image"},
+		Packages:          []Package{{ID: "SPDXRef-Package-musl", Name: "musl", Version: "1.2.2-r7"}},
+	}
+	addLicenseFiles(doc, opts)
+
+	require.Equal(t, []File{{
+		ID:        "SPDXRef-File-licensesC47muslC47COPYRIGHT",
+		Name:      "/licenses/musl/COPYRIGHT",
+		FileTypes: []string{"TEXT"},
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: "aaaa"}},
+		Comment:   "License file of apk package musl-1.2.2-r7, collected from /usr/share/licenses/musl/COPYRIGHT",
+	}, {
+		ID:        "SPDXRef-File-licensesC47zlibC47LICENSE",
+		Name:      "/licenses/zlib/LICENSE",
+		FileTypes: []string{"TEXT"},
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: "bbbb"}},
+		Comment:   "License file of apk package zlib-1.3-r0, collected from /usr/share/licenses/zlib/LICENSE",
+	}}, doc.Files)
+	require.Equal(t, []Relationship{
+		{Element: "SPDXRef-Package-musl", Type: "CONTAINS", Related: "SPDXRef-File-licensesC47muslC47COPYRIGHT"},
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-File-licensesC47zlibC47LICENSE"},
+	}, doc.Relationships)
+}
+
+func TestAddLocalFiles(t *testing.T) {
+	opts := &options.Options{
+		LocalFiles: []options.LocalFile{{
+			Path:   "srv/app/config.yaml",
+			Source: "app/config.yaml",
+			SHA256: "aaaa",
+		}},
+	}
+	doc := &Document{DocumentDescribes: []string{"SPDXRef-Image"}}
+	addLocalFiles(doc, opts)
+
+	require.Equal(t, []File{{
+		ID:        "SPDXRef-File-srvC47appC47config.yaml",
+		Name:      "/srv/app/config.yaml",
+		FileTypes: []string{"OTHER"},
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: "aaaa"}},
+		Comment:   "Copied from the build context at app/config.yaml",
+	}}, doc.Files)
+	require.Equal(t, []Relationship{
+		{Element: "SPDXRef-Image", Type: "CONTAINS", Related: "SPDXRef-File-srvC47appC47config.yaml"},
+	}, doc.Relationships)
+}
+
+func TestAddRemoteFiles(t *testing.T) {
+	opts := &options.Options{
+		RemoteFiles: []options.RemoteFile{{
+			URL:    "https://example.com/tool",
+			SHA256: "aaaa",
+			Path:   "usr/bin/tool",
+		}, {
+			URL:    "https://example.com/docs.zip",
+			SHA256: "bbbb",
+			Path:   "usr/share/doc/tool",
+			Files:  []options.LocalFile{{Path: "usr/share/doc/tool/README", Source: "README", SHA256: "cccc"}},
+		}},
+	}
+	doc := &Document{DocumentDescribes: []string{"SPDXRef-Image"}}
+	addRemoteFiles(doc, opts, "SPDXRef-Layer")
+
+	require.Len(t, doc.Packages, 2)
+	require.Equal(t, "tool", doc.Packages[0].Name)
+	require.Equal(t, "https://example.com/tool", doc.Packages[0].DownloadLocation)
+	require.Equal(t, "FILE", doc.Packages[0].PrimaryPurpose)
+	require.Equal(t, []Checksum{{Algorithm: "SHA256", Value: "aaaa"}}, doc.Packages[0].Checksums)
+	require.Equal(t, "pkg:generic/tool?checksum=sha256%3Aaaaa&download_url=https%3A%2F%2Fexample.com%2Ftool", doc.Packages[0].ExternalRefs[0].Locator)
+	require.Equal(t, "docs.zip", doc.Packages[1].Name)
+	require.Equal(t, "ARCHIVE", doc.Packages[1].PrimaryPurpose)
+
+	require.Equal(t, []File{{
+		ID:        "SPDXRef-File-usrC47binC47tool",
+		Name:      "/usr/bin/tool",
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: "aaaa"}},
+		Comment:   "Fetched from https://example.com/tool",
+	}, {
+		ID:        "SPDXRef-File-usrC47shareC47docC47toolC47README",
+		Name:      "/usr/share/doc/tool/README",
+		Checksums: []Checksum{{Algorithm: "SHA256", Value: "cccc"}},
+		Comment:   "Extracted from README of https://example.com/docs.zip",
+	}}, doc.Files)
+	require.Equal(t, []Relationship{
+		{Element: "SPDXRef-Layer", Type: "CONTAINS", Related: "SPDXRef-RemoteFile-usrC47binC47tool"},
+		{Element: "SPDXRef-RemoteFile-usrC47binC47tool", Type: "CONTAINS", Related: "SPDXRef-File-usrC47binC47tool"},
+		{Element: "SPDXRef-Layer", Type: "CONTAINS", Related: "SPDXRef-RemoteFile-usrC47shareC47docC47tool"},
+		{Element: "SPDXRef-RemoteFile-usrC47shareC47docC47tool", Type: "CONTAINS", Related: "SPDXRef-File-usrC47shareC47docC47toolC47README"},
+	}, doc.Relationships)
+}
+
+func TestAddApkPackages(t *testing.T) {
+	opts := &options.Options{
+		OS: options.OSInfo{ID: "wolfi", Name: "Wolfi"},
+		Packages: []*apk.InstalledPackage{
+			{Package: apk.Package{
+				Name:        "busybox",
+				Version:     "1.36.1-r0",
+				Arch:        "x86_64",
+				Description: "Size optimized toolbox of many common UNIX utilities",
+				License:     "GPL-2.0-only",
+				Origin:      "busybox",
+				Maintainer:  "Wolfi <wolfi@chainguard.dev>",
+				URL:         "https://busybox.net",
+				RepoCommit:  "868f0dc23e721039f9669b56d01ea4b897f2fb24",
+				Checksum:    []byte{0xd, 0xe6, 0xf4, 0x8c},
+			}},
+			{Package: apk.Package{
+				Name:       "libcrypto3",
+				Version:    "3.1.4-r0",
+				Arch:       "x86_64",
+				License:    "Apache-2.0",
+				Origin:     "openssl",
+				RepoCommit: "not-a-commit",
+			}},
+		},
+	}
+	// libcrypto3 came with an SBOM of its own, which is missing its license.
+	doc := &Document{
+		Packages: []Package{{
+			ID:              "SPDXRef-Package-libcrypto3-3.1.4-r0",
+			Name:            "libcrypto3",
+			Version:         "3.1.4-r0",
+			LicenseDeclared: NOASSERTION,
+			Originator:      "Organization: Wolfi",
+		}},
+	}
+	addApkPackages(doc, opts, "SPDXRef-Package-layer")
+
+	require.Equal(t, []Package{{
+		ID:              "SPDXRef-Package-libcrypto3-3.1.4-r0",
+		Name:            "libcrypto3",
+		Version:         "3.1.4-r0",
+		LicenseDeclared: "Apache-2.0",
+		Originator:      "Organization: Wolfi",
+		SourceInfo:      "built from origin package openssl at commit not-a-commit",
+		ExternalRefs: []ExternalRef{{
+			Category: ExtRefPackageManager,
+			Type:     ExtRefTypePurl,
+			Locator:  "pkg:apk/wolfi/libcrypto3@3.1.4-r0?arch=x86_64",
+		}},
+	}, {
+		ID:               "SPDXRef-Package-busybox-1.36.1-r0",
+		Name:             "busybox",
+		Version:          "1.36.1-r0",
+		LicenseConcluded: NOASSERTION,
+		LicenseDeclared:  "GPL-2.0-only",
+		Description:      "Size optimized toolbox of many common UNIX utilities",
+		DownloadLocation: NOASSERTION,
+		Homepage:         "https://busybox.net",
+		Originator:       "Person: Wolfi (wolfi@chainguard.dev)",
+		Supplier:         "Organization: Wolfi",
+		SourceInfo:       "built from commit 868f0dc23e721039f9669b56d01ea4b897f2fb24",
+		CopyrightText:    NOASSERTION,
+		Checksums:        []Checksum{{Algorithm: "SHA1", Value: "0de6f48c"}},
+		ExternalRefs: []ExternalRef{{
+			Category: ExtRefPackageManager,
+			Type:     ExtRefTypePurl,
+			Locator:  "pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64",
+		}, {
+			Category: ExtRefPersistentID,
+			Type:     ExtRefTypeGitoid,
+			Locator:  "gitoid:commit:sha1:868f0dc23e721039f9669b56d01ea4b897f2fb24",
+		}},
+	}}, doc.Packages)
+	require.Equal(t, []Relationship{{
+		Element: "SPDXRef-Package-layer",
+		Type:    "CONTAINS",
+		Related: "SPDXRef-Package-busybox-1.36.1-r0",
+	}}, doc.Relationships)
+}
+
+func TestPackageSignatureAnnotation(t *testing.T) {
+	opts := &options.Options{
+		OS: options.OSInfo{ID: "wolfi", Name: "Wolfi"},
+		Packages: []*apk.InstalledPackage{
+			{Package: apk.Package{Name: "busybox", Version: "1.36.1-r0"}},
+			{Package: apk.Package{Name: "unsigned", Version: "1.0-r0"}},
+			{Package: apk.Package{Name: "unknown", Version: "1.0-r0"}},
+		},
+		PackageSignatures: map[string]apk.Verification{
+			"busybox":  {Verified: true, KeyID: "wolfi-signing.rsa.pub", Algorithm: "RSA-SHA256"},
+			"unsigned": {Reason: apk.ReasonSignaturesIgnored},
+		},
+		IndexSignatures: map[string]apk.Verification{
+			"https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz": {Verified: true, KeyID: "wolfi-signing.rsa.pub", Algorithm: "RSA-SHA256"},
+		},
+	}
+	doc := &Document{}
+	addApkPackages(doc, opts, "")
+	addOperatingSystem(doc, opts)
+
+	annotation := func(comment string) []Annotation {
+		return []Annotation{{
+			Date:      opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Type:      "OTHER",
+			Annotator: fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
+			Comment:   comment,
+		}}
+	}
+	require.Len(t, doc.Packages, 4)
+	require.Equal(t, annotation("apk signature verified with key wolfi-signing.rsa.pub (RSA-SHA256)"), doc.Packages[0].Annotations)
+	require.Equal(t, annotation("apk signature unverified: signature verification is disabled"), doc.Packages[1].Annotations)
+	require.Empty(t, doc.Packages[2].Annotations)
+	require.Equal(t, annotation("apk index https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz verified with key wolfi-signing.rsa.pub (RSA-SHA256)"), doc.Packages[3].Annotations)
+}
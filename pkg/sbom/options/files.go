@@ -0,0 +1,163 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// File is a regular file installed by an apk package.
+type File struct {
+	// Path is the path of the file in the image, without a leading slash
+	Path string
+	// SHA256 is the hex encoded sha256 of the file contents
+	SHA256 string
+	// Package is the installed package which owns the file
+	Package *apk.InstalledPackage
+}
+
+// LicenseFile is a license file of an apk package, collected into the image.
+type LicenseFile struct {
+	// Path is the path of the collected file in the image, without a leading
+	// slash
+	Path string
+	// Source is the path the package installed the file at, without a
+	// leading slash
+	Source string
+	// SHA256 is the hex encoded sha256 of the file contents
+	SHA256 string
+	// Package is the installed package which owns the file
+	Package *apk.InstalledPackage
+}
+
+// LocalFile is a file copied into the image from the build context.
+type LocalFile struct {
+	// Path is the path of the file in the image, without a leading slash
+	Path string
+	// Source is the path of the file in the build context
+	Source string
+	// SHA256 is the hex encoded sha256 of the file contents
+	SHA256 string
+}
+
+// RemoteFile is a file fetched by URL into the image, or an archive
+// extracted into it.
+type RemoteFile struct {
+	// URL is where the file was fetched from
+	URL string
+	// SHA256 is the hex encoded sha256 of the fetched file
+	SHA256 string
+	// Path is the path of the file in the image, or of the directory the
+	// archive was extracted under, without a leading slash
+	Path string
+	// Files are the regular files extracted from an archive, whose Source is
+	// their path in the archive
+	Files []LocalFile
+}
+
+// Name returns the file name of the remote file in its URL.
+func (f RemoteFile) Name() string {
+	if u, err := url.Parse(f.URL); err == nil {
+		return path.Base(u.Path)
+	}
+	return f.URL
+}
+
+// Purl returns the generic purl of the remote file, which records where it
+// was fetched from and its digest.
+func (f RemoteFile) Purl() string {
+	return purl.NewPackageURL("generic", "", f.Name(), "", purl.QualifiersFromMap(map[string]string{
+		"checksum":     "sha256:" + f.SHA256,
+		"download_url": f.URL,
+	}), "").ToString()
+}
+
+// InstalledFiles returns the regular files of the installed packages, as
+// listed in the installed database, with the checksums of their contents in
+// fsys. Directories, symlinks and files which were since removed from fsys
+// (e.g. by paths directives) or replaced by local or remote files are left
+// out.
+func (o *Options) InstalledFiles(fsys apkfs.FullFS) ([]File, error) {
+	local := make(map[string]struct{}, len(o.LocalFiles))
+	for _, f := range o.LocalFiles {
+		local[f.Path] = struct{}{}
+	}
+	for _, rf := range o.RemoteFiles {
+		if rf.Files == nil {
+			local[rf.Path] = struct{}{}
+		}
+		for _, f := range rf.Files {
+			local[f.Path] = struct{}{}
+		}
+	}
+	var files []File
+	for _, pkg := range o.Packages {
+		for _, hdr := range pkg.Files {
+			if !hdr.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			if _, ok := local[strings.TrimPrefix(hdr.Name, "/")]; ok {
+				continue
+			}
+			info, err := fsys.Lstat(hdr.Name)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return nil, fmt.Errorf("stat %s: %w", hdr.Name, err)
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			// Not every filesystem's Lstat reports symlinks.
+			if _, err := fsys.Readlink(hdr.Name); err == nil {
+				continue
+			}
+			sum, err := fileSHA256(fsys, hdr.Name)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, File{Path: hdr.Name, SHA256: sum, Package: pkg})
+		}
+	}
+	return files, nil
+}
+
+func fileSHA256(fsys apkfs.FullFS, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
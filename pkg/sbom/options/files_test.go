@@ -0,0 +1,71 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestInstalledFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("usr/bin", 0o755))
+	require.NoError(t, fsys.WriteFile("usr/bin/hello", []byte("hello\n"), 0o755))
+	require.NoError(t, fsys.Symlink("hello", "usr/bin/hi"))
+
+	pkg := &apk.InstalledPackage{
+		Package: apk.Package{Name: "hello", Version: "1.0-r0"},
+		Files: []tar.Header{
+			{Name: "usr/bin", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "usr/bin/hello", Mode: 0o755},
+			{Name: "usr/bin/hi", Mode: 0o644},
+			// Removed from the image after installation.
+			{Name: "usr/bin/gone", Mode: 0o644},
+		},
+	}
+	o := &Options{Packages: []*apk.InstalledPackage{pkg}}
+
+	files, err := o.InstalledFiles(fsys)
+	require.NoError(t, err)
+	require.Equal(t, []File{{
+		Path:    "usr/bin/hello",
+		SHA256:  "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+		Package: pkg,
+	}}, files)
+}
+
+func TestInstalledFilesReplacedByLocalFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/motd", []byte("hello\n"), 0o644))
+
+	pkg := &apk.InstalledPackage{
+		Package: apk.Package{Name: "alpine-baselayout", Version: "3.4.3-r1"},
+		Files:   []tar.Header{{Name: "etc/motd", Mode: 0o644}},
+	}
+	o := &Options{
+		Packages:   []*apk.InstalledPackage{pkg},
+		LocalFiles: []LocalFile{{Path: "etc/motd", Source: "motd", SHA256: "aaaa"}},
+	}
+
+	files, err := o.InstalledFiles(fsys)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
@@ -53,6 +53,43 @@ type Options struct {
 
 	// Packages is a list of packages which will be listed in the SBOM
 	Packages []*apk.InstalledPackage
+
+	// IncludeFiles lists the files installed by each package, with their
+	// checksums, in the SBOM
+	IncludeFiles bool
+
+	// LicenseFiles are the license files of the packages collected into the
+	// image, which are referenced from the SBOM
+	LicenseFiles []LicenseFile
+
+	// LocalFiles are the files copied into the image from the build context,
+	// which are not owned by any package
+	LocalFiles []LocalFile
+
+	// RemoteFiles are the files fetched by URL into the image
+	RemoteFiles []RemoteFile
+
+	// PackageSignatures records how the signature of each package was
+	// verified, or why it was not, by package name
+	PackageSignatures map[string]apk.Verification
+
+	// IndexSignatures records how the signature of each repository index
+	// the packages were resolved from was verified, or why it was not, by
+	// the URL of the index
+	IndexSignatures map[string]apk.Verification
+
+	// Processors modify the generated documents before they are written
+	Processors []Processor
+
+	// BuildTools is a list of the steps apko ran against the image while
+	// assembling it (e.g. post-install fixups), listed in the SBOM as tooling
+	BuildTools []BuildTool
+}
+
+// BuildTool describes a step apko ran while assembling an image.
+type BuildTool struct {
+	Name        string
+	Description string
 }
 
 type PurlQualifiers map[string]string
@@ -71,6 +108,7 @@ type ImageInfo struct {
 	ImageDigest     string
 	Layers          []v1.Descriptor
 	VCSUrl          string
+	ConfigDigest    string
 	IndexMediaType  ggcrtypes.MediaType
 	ImageMediaType  ggcrtypes.MediaType
 	IndexDigest     v1.Hash
@@ -83,6 +121,21 @@ type ArchImageInfo struct {
 	Digest     v1.Hash
 	Arch       types.Architecture
 	SBOMDigest string
+	// SBOMPath is the path of the SBOM of the image, in the format of the
+	// index SBOM being generated, which the index SBOM references
+	SBOMPath string
+	// Platform is the platform of the image in the index, with the
+	// variant and OS fields of the configuration
+	Platform *v1.Platform
+}
+
+// OCIPlatform returns the platform of the image, or the one of its
+// architecture if it is not set.
+func (aii *ArchImageInfo) OCIPlatform() *v1.Platform {
+	if aii.Platform != nil {
+		return aii.Platform
+	}
+	return aii.Arch.ToOCIPlatform()
 }
 
 // ImagePurlName returns a name to represent the image in a purl
@@ -107,6 +160,28 @@ func (o *Options) IndexPurlName() string {
 	return repoName
 }
 
+// ImagePurl returns the purl of the image, which identifies it in SBOMs and
+// VEX documents
+func (o *Options) ImagePurl() string {
+	return purl.NewPackageURL(
+		purl.TypeOCI, "", o.ImagePurlName(), o.ImageInfo.ImageDigest, nil, "",
+	).String() + "?" + o.ImagePurlQualifiers().String()
+}
+
+// IndexPurl returns the purl of the multiarch index
+func (o *Options) IndexPurl() string {
+	return purl.NewPackageURL(
+		purl.TypeOCI, "", o.IndexPurlName(), o.ImageInfo.IndexDigest.String(), nil, "",
+	).String() + "?" + o.IndexPurlQualifiers().String()
+}
+
+// PackagePurl returns the purl of an apk installed in the image, as apks
+// describe themselves in their own SBOMs
+func (o *Options) PackagePurl(pkg *apk.Package) string {
+	return purl.NewPackageURL("apk", o.OS.ID, pkg.Name, pkg.Version,
+		purl.QualifiersFromMap(map[string]string{"arch": pkg.Arch}), "").ToString()
+}
+
 // ImagePurlQualifiers returns the qualifiers for an image, the extra
 // data that goes into the purl quey string
 func (o *Options) ImagePurlQualifiers() (qualifiers PurlQualifiers) {
@@ -0,0 +1,46 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"context"
+	"fmt"
+)
+
+// Processor modifies SBOMs after they are generated, before they are
+// written, e.g. to add organization-specific fields.
+type Processor interface {
+	// ProcessSBOM is called with the key of the format of the SBOM, e.g.
+	// "spdx", and a pointer to its document, e.g. *spdx.Document, which it
+	// may modify. opts describes the image or index the SBOM is about.
+	ProcessSBOM(ctx context.Context, format string, doc any, opts *Options) error
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(ctx context.Context, format string, doc any, opts *Options) error
+
+func (f ProcessorFunc) ProcessSBOM(ctx context.Context, format string, doc any, opts *Options) error {
+	return f(ctx, format, doc, opts)
+}
+
+// Process runs the processors on a generated document, in order.
+func (o *Options) Process(ctx context.Context, format string, doc any) error {
+	for i, p := range o.Processors {
+		if err := p.ProcessSBOM(ctx, format, doc, o); err != nil {
+			return fmt.Errorf("running SBOM processor %d: %w", i, err)
+		}
+	}
+	return nil
+}
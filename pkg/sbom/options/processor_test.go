@@ -0,0 +1,52 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	var calls []string
+	record := func(name string, err error) Processor {
+		return ProcessorFunc(func(_ context.Context, format string, doc any, opts *Options) error {
+			require.Equal(t, "spdx", format)
+			require.Equal(t, "doc", *doc.(*string))
+			require.Equal(t, "sbom", opts.FileName)
+			calls = append(calls, name)
+			return err
+		})
+	}
+
+	doc := "doc"
+	opts := &Options{FileName: "sbom", Processors: []Processor{record("a", nil), record("b", nil)}}
+	require.NoError(t, opts.Process(t.Context(), "spdx", &doc))
+	require.Equal(t, []string{"a", "b"}, calls)
+
+	// Processing stops at the first error.
+	calls = nil
+	boom := errors.New("boom")
+	opts.Processors = []Processor{record("a", boom), record("b", nil)}
+	err := opts.Process(t.Context(), "spdx", &doc)
+	require.ErrorIs(t, err, boom)
+	require.Equal(t, []string{"a"}, calls)
+
+	// No processors is fine.
+	require.NoError(t, (&Options{}).Process(t.Context(), "spdx", &doc))
+}
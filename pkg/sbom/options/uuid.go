@@ -0,0 +1,52 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+
+	"chainguard.dev/apko/pkg/apk/digest"
+)
+
+// uuidNamespace is the RFC 4122 URL namespace, under which document UUIDs
+// are derived.
+var uuidNamespace = [16]byte{
+	0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1,
+	0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8,
+}
+
+// ContentUUID returns a name-based (version 5) UUID of the JSON encoding of
+// doc. SBOMs are identified by it instead of a random UUID, so that the same
+// document always gets the same ID, and a different one never does.
+func ContentUUID(doc any) (string, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshaling document: %w", err)
+	}
+
+	h, err := digest.Identify(crypto.SHA1) // UUIDv5 is defined over SHA-1
+	if err != nil {
+		return "", err
+	}
+	h.Write(uuidNamespace[:])
+	h.Write(data)
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
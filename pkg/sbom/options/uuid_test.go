@@ -0,0 +1,39 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentUUID(t *testing.T) {
+	a, err := ContentUUID(map[string]string{"name": "a"})
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), a)
+
+	again, err := ContentUUID(map[string]string{"name": "a"})
+	require.NoError(t, err)
+	require.Equal(t, a, again)
+
+	b, err := ContentUUID(map[string]string{"name": "b"})
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+
+	_, err = ContentUUID(func() {})
+	require.Error(t, err)
+}
@@ -18,6 +18,15 @@ import (
 	"chainguard.dev/apko/pkg/sbom/options"
 )
 
+// Processor modifies SBOMs after they are generated, before they are written
+// and attached, so that embedders can add their own fields, e.g. internal
+// component IDs or ownership annotations. Processors are added to builds
+// with build.WithSBOMProcessors.
+type Processor = options.Processor
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc = options.ProcessorFunc
+
 var DefaultOptions = options.Options{
 	OS: options.OSInfo{
 		Name: "Chainguard, Inc.", // This populates the supplier for index SBOMs.
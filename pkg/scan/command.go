@@ -0,0 +1,176 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The scanners New knows.
+const (
+	Auto      = "auto"
+	GrypeName = "grype"
+	TrivyName = "trivy"
+)
+
+// New returns the scanner of a name, one of grype or trivy, found in PATH.
+// auto is the first of them which is installed.
+func New(name string) (Scanner, error) {
+	switch name {
+	case GrypeName, TrivyName:
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return nil, fmt.Errorf("finding %s: %w", name, err)
+		}
+		if name == GrypeName {
+			return Grype(path), nil
+		}
+		return Trivy(path), nil
+	case Auto:
+		for _, n := range []string{GrypeName, TrivyName} {
+			if _, err := exec.LookPath(n); err == nil {
+				return New(n)
+			}
+		}
+		return nil, errors.New("no scanner found, install grype or trivy")
+	default:
+		return nil, fmt.Errorf("unsupported scanner %q, must be one of: auto, grype, trivy", name)
+	}
+}
+
+// command is a scanner run as a subprocess on the SBOM of the image, which
+// reports the vulnerabilities it finds as JSON.
+type command struct {
+	path string
+	args func(sbom string) []string
+	// formats are the SBOM formats the scanner reads, in order of preference.
+	formats []string
+	parse   func(b []byte) ([]Vulnerability, error)
+}
+
+func (c command) Scan(ctx context.Context, t Target) ([]Vulnerability, error) {
+	sbom, err := t.SBOM(c.formats...)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.path, c.args(sbom)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %w: %s", c.path, err, strings.TrimSpace(stderr.String()))
+	}
+	vulns, err := c.parse(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("parsing the report of %s: %w", c.path, err)
+	}
+	return vulns, nil
+}
+
+// Grype returns a scanner which runs grype, at path, on the SPDX or CycloneDX
+// SBOM of the image.
+func Grype(path string) Scanner {
+	return command{
+		path: path,
+		args: func(sbom string) []string {
+			return []string{"sbom:" + sbom, "--output", "json", "--quiet"}
+		},
+		formats: []string{"spdx", "cyclonedx"},
+		parse:   parseGrype,
+	}
+}
+
+func parseGrype(b []byte) ([]Vulnerability, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID       string `json:"id"`
+				Severity string `json:"severity"`
+				Fix      struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, err
+	}
+	vulns := make([]Vulnerability, 0, len(report.Matches))
+	for _, m := range report.Matches {
+		// Severities unknown to apko, if any, are reported as unknown.
+		sev, _ := ParseSeverity(m.Vulnerability.Severity)
+		vulns = append(vulns, Vulnerability{
+			ID:       m.Vulnerability.ID,
+			Package:  m.Artifact.Name,
+			Version:  m.Artifact.Version,
+			Severity: sev,
+			FixedIn:  strings.Join(m.Vulnerability.Fix.Versions, ", "),
+		})
+	}
+	return vulns, nil
+}
+
+// Trivy returns a scanner which runs trivy, at path, on the CycloneDX or SPDX
+// SBOM of the image.
+func Trivy(path string) Scanner {
+	return command{
+		path: path,
+		args: func(sbom string) []string {
+			return []string{"sbom", "--format", "json", "--quiet", sbom}
+		},
+		formats: []string{"cyclonedx", "spdx"},
+		parse:   parseTrivy,
+	}
+}
+
+func parseTrivy(b []byte) ([]Vulnerability, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string `json:"VulnerabilityID"`
+				PkgName          string `json:"PkgName"`
+				InstalledVersion string `json:"InstalledVersion"`
+				FixedVersion     string `json:"FixedVersion"`
+				Severity         string `json:"Severity"`
+			} `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(b, &report); err != nil {
+		return nil, err
+	}
+	var vulns []Vulnerability
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			sev, _ := ParseSeverity(v.Severity)
+			vulns = append(vulns, Vulnerability{
+				ID:       v.VulnerabilityID,
+				Package:  v.PkgName,
+				Version:  v.InstalledVersion,
+				Severity: sev,
+				FixedIn:  v.FixedVersion,
+			})
+		}
+	}
+	return vulns, nil
+}
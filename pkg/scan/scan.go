@@ -0,0 +1,164 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scan runs vulnerability scanners on the images apko builds, with
+// their SBOMs, so scanning can gate the build.
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// Severity is the severity of a vulnerability, ordered from least to most
+// severe.
+type Severity int
+
+const (
+	SeverityUnknown Severity = iota
+	SeverityNegligible
+	SeverityLow
+	SeverityMedium
+	SeverityHigh
+	SeverityCritical
+)
+
+var severityNames = []string{"unknown", "negligible", "low", "medium", "high", "critical"}
+
+// ParseSeverity returns the severity of a name, in any case.
+func ParseSeverity(s string) (Severity, error) {
+	i := slices.Index(severityNames, strings.ToLower(strings.TrimSpace(s)))
+	if i == -1 {
+		return SeverityUnknown, fmt.Errorf("unknown severity %q, must be one of: %s", s, strings.Join(severityNames, ", "))
+	}
+	return Severity(i), nil
+}
+
+// ParseFailOn returns the severity from which vulnerabilities fail a build,
+// given as "severity>=high" or as the severity alone.
+func ParseFailOn(s string) (Severity, error) {
+	name := strings.TrimSpace(s)
+	if rest, ok := strings.CutPrefix(name, "severity"); ok {
+		if name, ok = strings.CutPrefix(strings.TrimSpace(rest), ">="); !ok {
+			return SeverityUnknown, fmt.Errorf("invalid threshold %q, must be of the form severity>=<severity>", s)
+		}
+	}
+	return ParseSeverity(name)
+}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(b []byte) error {
+	v, err := ParseSeverity(string(b))
+	if err != nil {
+		return err
+	}
+	*s = v
+	return nil
+}
+
+// Vulnerability is a vulnerability a scanner found in a package of an image.
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Package  string   `json:"package"`
+	Version  string   `json:"version"`
+	Severity Severity `json:"severity"`
+	// FixedIn is the version which fixes the vulnerability, if any.
+	FixedIn string `json:"fixedIn,omitempty"`
+}
+
+func (v Vulnerability) String() string {
+	s := fmt.Sprintf("%s (%s) in %s %s", v.ID, v.Severity, v.Package, v.Version)
+	if v.FixedIn != "" {
+		s += ", fixed in " + v.FixedIn
+	}
+	return s
+}
+
+// Target is an image to scan, as built for an architecture.
+type Target struct {
+	Arch  types.Architecture
+	Image v1.Image
+	// SBOMs are the SBOMs generated for the image, in every format asked
+	// for.
+	SBOMs []types.SBOM
+	// FS is the root filesystem of the image.
+	FS fs.FS
+}
+
+// SBOM returns the path of the SBOM of the target in the first of formats
+// it was generated in.
+func (t Target) SBOM(formats ...string) (string, error) {
+	for _, f := range formats {
+		for _, s := range t.SBOMs {
+			if s.Format == f {
+				return s.Path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no %s SBOM of the %s image to scan", strings.Join(formats, " or "), t.Arch.ToAPK())
+}
+
+// Scanner finds the vulnerabilities of the packages in an image.
+type Scanner interface {
+	Scan(ctx context.Context, t Target) ([]Vulnerability, error)
+}
+
+// AtLeast returns the vulnerabilities of at least a severity.
+func AtLeast(vulns []Vulnerability, s Severity) []Vulnerability {
+	var found []Vulnerability
+	for _, v := range vulns {
+		if v.Severity >= s {
+			found = append(found, v)
+		}
+	}
+	return found
+}
+
+// Summarize counts vulnerabilities by severity, most severe first, e.g.
+// "2 critical, 1 low".
+func Summarize(vulns []Vulnerability) string {
+	counts := make([]int, len(severityNames))
+	for _, v := range vulns {
+		if v.Severity >= 0 && int(v.Severity) < len(counts) {
+			counts[v.Severity]++
+		}
+	}
+	var parts []string
+	for s := SeverityCritical; s >= SeverityUnknown; s-- {
+		if counts[s] != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+		}
+	}
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,129 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestParseFailOn(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		want    Severity
+		wantErr bool
+	}{
+		{in: "severity>=high", want: SeverityHigh},
+		{in: "severity >= Critical", want: SeverityCritical},
+		{in: "medium", want: SeverityMedium},
+		{in: "NEGLIGIBLE", want: SeverityNegligible},
+		{in: "severity>high", wantErr: true},
+		{in: "severity>=severe", wantErr: true},
+		{in: "", wantErr: true},
+	} {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFailOn(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestAtLeastAndSummarize(t *testing.T) {
+	vulns := []Vulnerability{
+		{ID: "CVE-1", Severity: SeverityCritical},
+		{ID: "CVE-2", Severity: SeverityLow},
+		{ID: "CVE-3", Severity: SeverityCritical},
+		{ID: "CVE-4", Severity: SeverityUnknown},
+	}
+	require.Equal(t, []Vulnerability{vulns[0], vulns[2]}, AtLeast(vulns, SeverityHigh))
+	require.Equal(t, vulns, AtLeast(vulns, SeverityUnknown))
+	require.Equal(t, "2 critical, 1 low, 1 unknown", Summarize(vulns))
+	require.Equal(t, "none", Summarize(nil))
+}
+
+func TestParseReports(t *testing.T) {
+	grype := `{"matches": [{
+  "vulnerability": {"id": "CVE-2024-0001", "severity": "High", "fix": {"versions": ["3.2.1-r0"], "state": "fixed"}},
+  "artifact": {"name": "openssl", "version": "3.2.0-r0", "type": "apk"}
+}, {
+  "vulnerability": {"id": "GHSA-xxxx", "severity": "Negligible", "fix": {"versions": [], "state": "not-fixed"}},
+  "artifact": {"name": "zlib", "version": "1.3-r2", "type": "apk"}
+}]}`
+	got, err := parseGrype([]byte(grype))
+	require.NoError(t, err)
+	require.Equal(t, []Vulnerability{
+		{ID: "CVE-2024-0001", Package: "openssl", Version: "3.2.0-r0", Severity: SeverityHigh, FixedIn: "3.2.1-r0"},
+		{ID: "GHSA-xxxx", Package: "zlib", Version: "1.3-r2", Severity: SeverityNegligible},
+	}, got)
+
+	trivy := `{"Results": [{"Target": "sbom.cdx.json", "Vulnerabilities": [{
+  "VulnerabilityID": "CVE-2024-0001", "PkgName": "openssl", "InstalledVersion": "3.2.0-r0", "FixedVersion": "3.2.1-r0", "Severity": "CRITICAL"
+}]}, {"Target": "empty"}]}`
+	got, err = parseTrivy([]byte(trivy))
+	require.NoError(t, err)
+	require.Equal(t, []Vulnerability{
+		{ID: "CVE-2024-0001", Package: "openssl", Version: "3.2.0-r0", Severity: SeverityCritical, FixedIn: "3.2.1-r0"},
+	}, got)
+
+	_, err = parseGrype([]byte("not json"))
+	require.Error(t, err)
+}
+
+func TestCommand(t *testing.T) {
+	dir := t.TempDir()
+	// A stand-in for grype which checks its arguments and reports a match.
+	fake := filepath.Join(dir, "grype")
+	require.NoError(t, os.WriteFile(fake, []byte(`#!/bin/sh
+[ "$1" = "sbom:/sboms/sbom-x86_64.spdx.json" ] || { echo "unexpected argument $1" >&2; exit 2; }
+echo '{"matches": [{"vulnerability": {"id": "CVE-1", "severity": "Medium"}, "artifact": {"name": "busybox", "version": "1.36.1-r5"}}]}'
+`), 0o755))
+
+	target := Target{
+		Arch: types.ParseArchitecture("amd64"),
+		SBOMs: []types.SBOM{
+			{Path: "/sboms/sbom-x86_64.cdx.json", Format: "cyclonedx"},
+			{Path: "/sboms/sbom-x86_64.spdx.json", Format: "spdx"},
+		},
+	}
+	got, err := Grype(fake).Scan(context.Background(), target)
+	require.NoError(t, err)
+	require.Equal(t, []Vulnerability{{ID: "CVE-1", Package: "busybox", Version: "1.36.1-r5", Severity: SeverityMedium}}, got)
+
+	// trivy prefers the CycloneDX SBOM, which the stand-in rejects.
+	_, err = Trivy(fake).Scan(context.Background(), target)
+	require.ErrorContains(t, err, "unexpected argument sbom")
+
+	_, err = Grype(fake).Scan(context.Background(), Target{Arch: target.Arch})
+	require.ErrorContains(t, err, "no spdx or cyclonedx SBOM of the x86_64 image to scan")
+}
+
+func TestNew(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := New(Auto)
+	require.ErrorContains(t, err, "no scanner found")
+	_, err = New("clair")
+	require.ErrorContains(t, err, `unsupported scanner "clair"`)
+}
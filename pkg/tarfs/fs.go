@@ -17,7 +17,7 @@ package tarfs
 import (
 	"archive/tar"
 	"bytes"
-	"crypto/sha1" //nolint:gosec // this is what apk tools is using
+	"crypto"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -35,6 +35,7 @@ import (
 	"golang.org/x/sys/unix"
 
 	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/digest"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
@@ -478,7 +479,11 @@ func (m *memFS) writeHeader(name string, te tarEntry) (bool, error) {
 		// This can happen when go-apk's InitKeyring conflicts with alpine-keys.
 		// Since those files will be in memory, quickly compute the checksum and
 		// ignore this file if they match.
-		h := sha1.New() //nolint:gosec // this is what apk tools is using
+		// The apk format mandates SHA-1 for the checksums of files.
+		h, err := digest.Identify(crypto.SHA1)
+		if err != nil {
+			return false, err
+		}
 		h.Write(existing.data)
 		checksum := h.Sum(nil)
 
@@ -15,45 +15,116 @@
 package vcs
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/mod/semver"
 )
 
 const defaultRemoteName = "origin"
 
-// Given a starting directory and toplevel directory, work backwards
-// to the toplevel directory and probe for a Git repository, returning
-// the origin URI if known.
-func ProbeDirForVCSUrl(startDir, toplevelDir string) (string, error) {
-	repo, err := OpenRepository(startDir, toplevelDir)
-	if err != nil {
-		return "", fmt.Errorf("opening git repository: %w", err)
+// Info describes the commit checked out in a Git repository.
+type Info struct {
+	// URL is the URL of the remote of the repository, without any
+	// credentials, or empty if it has none.
+	URL string
+	// Revision is the hash of the commit checked out, which may be a
+	// detached HEAD.
+	Revision string
+	// Tags are the names of the tags pointing at Revision, highest
+	// version first.
+	Tags []string
+}
+
+// VCSUrl returns the URL and revision in the url@hash form of the VCS URL
+// of image configurations, or an empty string without a URL.
+func (i *Info) VCSUrl() string {
+	if i.URL == "" {
+		return ""
 	}
+	return fmt.Sprintf("%s@%s", i.URL, i.Revision)
+}
 
-	vcsURL, err := getRemoteURL(repo, defaultRemoteName)
+// Version returns the highest version among the tags made of prefix and a
+// semantic version, without the prefix and a leading v, or an empty string
+// if there is no such tag. Monorepos tagging their components as e.g.
+// "foo/v1.2.3" pick the tags of a component with the prefix "foo/".
+func (i *Info) Version(prefix string) string {
+	for _, tag := range i.Tags {
+		v, ok := strings.CutPrefix(tag, prefix)
+		if !ok || strings.Contains(v, "/") || tagVersion(tag) == "" {
+			continue
+		}
+		if len(v) > 1 && v[0] == 'v' && v[1] >= '0' && v[1] <= '9' {
+			v = v[1:]
+		}
+		return v
+	}
+	return ""
+}
+
+// Probe opens the Git repository containing path, a file or directory,
+// looking for it from path up to toplevelDir, or up to the root if
+// toplevelDir is empty, and describes the commit checked out. The remote is
+// "origin", or the only remote of the repository. Worktrees, detached
+// HEADs and shallow clones, as CI systems commonly check out, are
+// supported.
+func Probe(path, toplevelDir string) (*Info, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot dereference relative path %s: %w", path, err)
+	}
+	fi, err := os.Stat(path)
 	if err != nil {
-		return "", fmt.Errorf("fetching remote URL: %w", err)
+		return nil, fmt.Errorf("cannot check start directory: %w", err)
+	}
+	// If the path is not a directory, start from its parent, so that
+	// things like "foo/apko.yaml" can be passed as is.
+	if !fi.IsDir() {
+		path = filepath.Dir(path)
 	}
 
-	hash, err := resolveGitRevision(repo, "HEAD")
+	repo, err := OpenRepository(path, toplevelDir)
 	if err != nil {
-		return "", fmt.Errorf("resolving repo HEAD: %w", err)
+		return nil, fmt.Errorf("opening git repository: %w", err)
 	}
-	if hash != "" {
-		vcsURL = fmt.Sprintf("%s@%s", vcsURL, hash)
+
+	var info Info
+	if info.URL, err = probeRemoteURL(repo); err != nil {
+		return nil, fmt.Errorf("fetching remote URL: %w", err)
 	}
+	if info.Revision, err = resolveGitRevision(repo, "HEAD"); err != nil {
+		return nil, fmt.Errorf("resolving repo HEAD: %w", err)
+	}
+	if info.Tags, err = headTags(repo, plumbing.NewHash(info.Revision)); err != nil {
+		return nil, fmt.Errorf("listing tags: %w", err)
+	}
+	return &info, nil
+}
 
-	return vcsURL, nil
+// Given a starting directory and toplevel directory, work backwards
+// to the toplevel directory and probe for a Git repository, returning
+// the remote URI if known.
+func ProbeDirForVCSUrl(startDir, toplevelDir string) (string, error) {
+	info, err := Probe(startDir, toplevelDir)
+	if err != nil {
+		return "", err
+	}
+	if info.URL == "" {
+		return "", errors.New("fetching remote URL: unable to determine upstream git vcs url: remote not found")
+	}
+	return info.VCSUrl(), nil
 }
 
 // Given a starting directory, work backwards to the current working
-// directory and probe for a Git repository, returning the origin URI
+// directory and probe for a Git repository, returning the remote URI
 // if known.
 func ProbeDirFromPath(startingPath string) (string, error) {
 	toplevelDir, err := os.Getwd()
@@ -61,24 +132,84 @@ func ProbeDirFromPath(startingPath string) (string, error) {
 		return "", fmt.Errorf("cannot find working directory: %w", err)
 	}
 
-	startingPath, err = filepath.Abs(startingPath)
-	if err != nil {
-		return "", fmt.Errorf("cannot dereference relative path %s: %w", startingPath, err)
+	return ProbeDirForVCSUrl(startingPath, toplevelDir)
+}
+
+// probeRemoteURL returns the URL of the "origin" remote, or of the only
+// remote if there is no "origin", as CI systems may name it differently.
+func probeRemoteURL(repo *git.Repository) (string, error) {
+	name := defaultRemoteName
+	if _, err := repo.Remote(name); errors.Is(err, git.ErrRemoteNotFound) {
+		remotes, err := repo.Remotes()
+		if err != nil {
+			return "", err
+		}
+		if len(remotes) != 1 {
+			return "", nil
+		}
+		name = remotes[0].Config().Name
 	}
+	return getRemoteURL(repo, name)
+}
 
-	fi, err := os.Stat(startingPath)
+// headTags returns the names of the lightweight and annotated tags
+// pointing at head, highest version first. The tags of a shallow clone may
+// refer to commits it lacks, which is fine as they are not loaded.
+func headTags(repo *git.Repository, head plumbing.Hash) ([]string, error) {
+	refs, err := repo.Tags()
 	if err != nil {
-		return "", fmt.Errorf("cannot check start directory: %w", err)
+		return nil, err
 	}
+	var tags []string
+	if err := refs.ForEach(func(ref *plumbing.Reference) error {
+		target := ref.Hash()
+		if tag, err := repo.TagObject(target); err == nil {
+			if tag.TargetType != plumbing.CommitObject {
+				return nil
+			}
+			target = tag.Target
+		}
+		if target == head {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		return -compareTagVersions(a, b)
+	})
+	return tags, nil
+}
 
-	// If starting path is not a directory, get the parent directory.
-	// This way we can just pass things like "foo/apko.yaml" as the
-	// input here.
-	if !fi.IsDir() {
-		startingPath = filepath.Dir(startingPath)
+// compareTagVersions compares tags by the semantic version ending them,
+// with or without a leading v, tags without one sorting lowest and by name.
+func compareTagVersions(a, b string) int {
+	va, vb := tagVersion(a), tagVersion(b)
+	switch {
+	case va != "" && vb != "":
+		if c := semver.Compare(va, vb); c != 0 {
+			return c
+		}
+	case va != "":
+		return 1
+	case vb != "":
+		return -1
 	}
+	return -strings.Compare(a, b)
+}
 
-	return ProbeDirForVCSUrl(startingPath, toplevelDir)
+// tagVersion returns the semantic version ending tag, after its last
+// slash, in the form package semver expects, or an empty string.
+func tagVersion(tag string) string {
+	v := tag[strings.LastIndex(tag, "/")+1:]
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) {
+		return ""
+	}
+	return v
 }
 
 func getRemoteURL(repo *git.Repository, remoteName string) (string, error) {
@@ -163,7 +294,10 @@ func OpenRepository(startDir, toplevelDir string) (repo *git.Repository, err err
 			return nil, fmt.Errorf("path %s is not contained by %s", searchPath, toplevelDir)
 		}
 
-		repo, err := git.PlainOpen(searchPath)
+		repo, err := git.PlainOpenWithOptions(searchPath, &git.PlainOpenOptions{
+			// Worktrees keep most of the repository in the main one.
+			EnableDotGitCommonDir: true,
+		})
 		if err != nil {
 			if searchPath == "/" || searchPath == toplevelDir {
 				return nil, fmt.Errorf("directory %s is not in a git repository", startDir)
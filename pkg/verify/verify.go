@@ -0,0 +1,176 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package verify checks that an image matches the lockfile and SBOM it was
+// built with.
+package verify
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ocitypes "github.com/google/go-containerregistry/pkg/v1/types"
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+// Finding is a difference between the image and what was expected of it.
+type Finding struct {
+	// Source is what the expectation came from, "lockfile" or "sbom".
+	Source string `json:"source"`
+	// Subject is the package, or the digest of the manifest or layer, the
+	// finding is about.
+	Subject  string `json:"subject"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Result is the outcome of verifying an image.
+type Result struct {
+	Digest   string    `json:"digest"`
+	Arch     string    `json:"arch"`
+	Verified bool      `json:"verified"`
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+func (r *Result) add(f Finding) {
+	r.Findings = append(r.Findings, f)
+}
+
+// Image verifies an image, whose installed database is installed, against
+// the packages locked for its architecture and against an SPDX SBOM. Either
+// of l and sbom may be nil to skip that check.
+func Image(img v1.Image, installed []*apk.InstalledPackage, arch types.Architecture, l *lock.Lock, sbom []byte) (*Result, error) {
+	digest, err := img.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("getting image digest: %w", err)
+	}
+	r := &Result{Digest: digest.String(), Arch: arch.ToAPK()}
+
+	if l != nil {
+		verifyLock(r, installed, arch, l)
+	}
+	if sbom != nil {
+		if err := verifySBOM(r, img, installed, sbom); err != nil {
+			return nil, err
+		}
+	}
+
+	r.Verified = len(r.Findings) == 0
+	return r, nil
+}
+
+func verifyLock(r *Result, installed []*apk.InstalledPackage, arch types.Architecture, l *lock.Lock) {
+	actual := make(map[string]*apk.InstalledPackage, len(installed))
+	for _, p := range installed {
+		actual[p.Name] = p
+	}
+
+	locked := map[string]struct{}{}
+	for _, p := range l.Contents.Packages {
+		if types.ParseArchitecture(p.Architecture) != arch {
+			continue
+		}
+		locked[p.Name] = struct{}{}
+
+		ip, ok := actual[p.Name]
+		switch {
+		case !ok:
+			r.add(Finding{Source: "lockfile", Subject: p.Name, Expected: p.Version, Message: "locked package is not installed"})
+		case ip.Version != p.Version:
+			r.add(Finding{Source: "lockfile", Subject: p.Name, Expected: p.Version, Actual: ip.Version, Message: "installed version does not match the lockfile"})
+		case p.Checksum != "" && p.Checksum != "Q1"+base64.StdEncoding.EncodeToString(ip.Checksum):
+			r.add(Finding{Source: "lockfile", Subject: p.Name, Expected: p.Checksum, Actual: "Q1" + base64.StdEncoding.EncodeToString(ip.Checksum), Message: "installed checksum does not match the lockfile"})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := locked[name]; !ok {
+			r.add(Finding{Source: "lockfile", Subject: name, Actual: actual[name].Version, Message: "installed package is not in the lockfile"})
+		}
+	}
+}
+
+func verifySBOM(r *Result, img v1.Image, installed []*apk.InstalledPackage, sbom []byte) error {
+	var doc spdx.Document
+	if err := json.Unmarshal(sbom, &doc); err != nil {
+		return fmt.Errorf("parsing SBOM: %w", err)
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("getting image layers: %w", err)
+	}
+	actualLayers := map[string]struct{}{}
+	for _, l := range layers {
+		d, err := l.Digest()
+		if err != nil {
+			return fmt.Errorf("getting layer digest: %w", err)
+		}
+		actualLayers[d.String()] = struct{}{}
+	}
+
+	described := map[string]struct{}{}
+	for _, p := range doc.Packages {
+		for _, ref := range p.ExternalRefs {
+			if ref.Type != "purl" {
+				continue
+			}
+			u, err := purl.FromString(ref.Locator)
+			if err != nil {
+				continue
+			}
+			switch u.Type {
+			case purl.TypeOCI:
+				switch ocitypes.MediaType(u.Qualifiers.Map()["mediatype"]) {
+				case ocitypes.OCIManifestSchema1, ocitypes.DockerManifestSchema2:
+					if u.Version != r.Digest {
+						r.add(Finding{Source: "sbom", Subject: "manifest", Expected: u.Version, Actual: r.Digest, Message: "image digest does not match the SBOM"})
+					}
+				case ocitypes.OCILayer, ocitypes.DockerLayer:
+					if _, ok := actualLayers[u.Version]; !ok {
+						r.add(Finding{Source: "sbom", Subject: u.Version, Message: "layer in the SBOM is not in the image"})
+					}
+				}
+			case purl.TypeApk:
+				described[u.Name+"@"+u.Version] = struct{}{}
+			}
+		}
+	}
+
+	actual := map[string]struct{}{}
+	for _, p := range installed {
+		actual[p.Name+"@"+p.Version] = struct{}{}
+	}
+	for _, p := range slices.Sorted(maps.Keys(described)) {
+		if _, ok := actual[p]; !ok {
+			r.add(Finding{Source: "sbom", Subject: p, Message: "package in the SBOM is not installed"})
+		}
+	}
+	for _, p := range slices.Sorted(maps.Keys(actual)) {
+		if _, ok := described[p]; !ok {
+			r.add(Finding{Source: "sbom", Subject: p, Message: "installed package is not in the SBOM"})
+		}
+	}
+	return nil
+}
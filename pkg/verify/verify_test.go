@@ -0,0 +1,98 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package verify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/lock"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestImage(t *testing.T) {
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	layerDigest, err := layers[0].Digest()
+	require.NoError(t, err)
+
+	arch := types.ParseArchitecture("amd64")
+	installed := []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "busybox", Version: "1.36.1-r5", Checksum: []byte{1, 2, 3}}},
+		{Package: apk.Package{Name: "zlib", Version: "1.3-r2", Checksum: []byte{4, 5, 6}}},
+	}
+
+	l := &lock.Lock{Contents: lock.LockContents{Packages: []lock.LockPkg{
+		{Name: "busybox", Version: "1.36.1-r5", Architecture: "x86_64", Checksum: "Q1AQID"},
+		{Name: "zlib", Version: "1.3-r2", Architecture: "x86_64", Checksum: "Q1BAUG"},
+		{Name: "zlib", Version: "1.3-r3", Architecture: "aarch64", Checksum: "Q1BAUG"},
+	}}}
+
+	doc := spdx.Document{Packages: []spdx.Package{{
+		ExternalRefs: []spdx.ExternalRef{{Type: "purl", Locator: "pkg:oci/image@" + digest.String() + "?mediaType=application%2Fvnd.oci.image.manifest.v1%2Bjson"}},
+	}, {
+		ExternalRefs: []spdx.ExternalRef{{Type: "purl", Locator: "pkg:oci/image@" + layerDigest.String() + "?mediaType=application%2Fvnd.oci.image.layer.v1.tar%2Bgzip"}},
+	}, {
+		ExternalRefs: []spdx.ExternalRef{{Type: "purl", Locator: "pkg:apk/wolfi/busybox@1.36.1-r5?arch=x86_64"}},
+	}, {
+		ExternalRefs: []spdx.ExternalRef{{Type: "purl", Locator: "pkg:apk/wolfi/zlib@1.3-r2?arch=x86_64"}},
+	}}}
+	sbom, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	t.Run("match", func(t *testing.T) {
+		r, err := Image(img, installed, arch, l, sbom)
+		require.NoError(t, err)
+		require.Empty(t, r.Findings)
+		require.True(t, r.Verified)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		tampered := []*apk.InstalledPackage{
+			{Package: apk.Package{Name: "busybox", Version: "1.36.1-r5", Checksum: []byte{9, 9, 9}}},
+			{Package: apk.Package{Name: "curl", Version: "8.5.0-r0"}},
+		}
+		r, err := Image(img, tampered, arch, l, sbom)
+		require.NoError(t, err)
+		require.False(t, r.Verified)
+		require.Equal(t, []Finding{
+			{Source: "lockfile", Subject: "busybox", Expected: "Q1AQID", Actual: "Q1CQkJ", Message: "installed checksum does not match the lockfile"},
+			{Source: "lockfile", Subject: "zlib", Expected: "1.3-r2", Message: "locked package is not installed"},
+			{Source: "lockfile", Subject: "curl", Actual: "8.5.0-r0", Message: "installed package is not in the lockfile"},
+			{Source: "sbom", Subject: "zlib@1.3-r2", Message: "package in the SBOM is not installed"},
+			{Source: "sbom", Subject: "curl@8.5.0-r0", Message: "installed package is not in the SBOM"},
+		}, r.Findings)
+	})
+
+	t.Run("other image", func(t *testing.T) {
+		other, err := random.Image(1024, 1)
+		require.NoError(t, err)
+		r, err := Image(other, installed, arch, nil, sbom)
+		require.NoError(t, err)
+		require.False(t, r.Verified)
+		require.Len(t, r.Findings, 2)
+		require.Equal(t, "image digest does not match the SBOM", r.Findings[0].Message)
+		require.Equal(t, "layer in the SBOM is not in the image", r.Findings[1].Message)
+	})
+}
@@ -0,0 +1,292 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vex reads OpenVEX documents and binds their statements to the
+// images apko builds, so scanners can match them to the images' SBOMs.
+package vex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	purl "github.com/package-url/packageurl-go"
+)
+
+const (
+	// Context is the JSON-LD context of the OpenVEX documents apko writes.
+	Context = "https://openvex.dev/ns/v0.2.0"
+	// MediaType is the media type of OpenVEX documents, used as the artifact
+	// type of the referrers they are attached to images with.
+	MediaType = "application/openvex+json"
+	// Format is the format of the OpenVEX documents apko writes along the SBOMs.
+	Format = "openvex"
+	// Ext is the extension of the OpenVEX documents apko writes.
+	Ext = "openvex.json"
+)
+
+// Status is the impact of a vulnerability on a product.
+type Status string
+
+const (
+	StatusNotAffected        Status = "not_affected"
+	StatusAffected           Status = "affected"
+	StatusFixed              Status = "fixed"
+	StatusUnderInvestigation Status = "under_investigation"
+)
+
+// Justifications are the reasons a product can be not_affected.
+var Justifications = []string{
+	"component_not_present",
+	"vulnerable_code_not_present",
+	"vulnerable_code_not_in_execute_path",
+	"vulnerable_code_cannot_be_controlled_by_adversary",
+	"inline_mitigations_already_exist",
+}
+
+type Document struct {
+	Context    string      `json:"@context"`
+	ID         string      `json:"@id"`
+	Author     string      `json:"author"`
+	Role       string      `json:"role,omitempty"`
+	Timestamp  *time.Time  `json:"timestamp,omitempty"`
+	Version    int         `json:"version"`
+	Tooling    string      `json:"tooling,omitempty"`
+	Statements []Statement `json:"statements"`
+}
+
+type Statement struct {
+	ID              string        `json:"@id,omitempty"`
+	Vulnerability   Vulnerability `json:"vulnerability"`
+	Timestamp       *time.Time    `json:"timestamp,omitempty"`
+	Products        []Product     `json:"products"`
+	Status          Status        `json:"status"`
+	StatusNotes     string        `json:"status_notes,omitempty"`
+	Justification   string        `json:"justification,omitempty"`
+	ImpactStatement string        `json:"impact_statement,omitempty"`
+	ActionStatement string        `json:"action_statement,omitempty"`
+}
+
+type Vulnerability struct {
+	ID          string   `json:"@id,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Aliases     []string `json:"aliases,omitempty"`
+}
+
+type Component struct {
+	ID          string            `json:"@id,omitempty"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	Hashes      map[string]string `json:"hashes,omitempty"`
+}
+
+type Product struct {
+	Component
+	Subcomponents []Component `json:"subcomponents,omitempty"`
+}
+
+// purls returns the purls identifying the component
+func (c Component) purls() []string {
+	var purls []string
+	if c.ID != "" {
+		purls = append(purls, c.ID)
+	}
+	if p := c.Identifiers["purl"]; p != "" && p != c.ID {
+		purls = append(purls, p)
+	}
+	return purls
+}
+
+// ParseFile reads and validates the OpenVEX document at path.
+func ParseFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, fmt.Errorf("validating %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Validate checks the statements carry what the OpenVEX specification
+// requires for their status.
+func (d *Document) Validate() error {
+	var errs []error
+	for i, s := range d.Statements {
+		if s.Vulnerability.Name == "" {
+			errs = append(errs, fmt.Errorf("statement %d: missing vulnerability name", i))
+		}
+		if len(s.Products) == 0 {
+			errs = append(errs, fmt.Errorf("statement %d: no products", i))
+		}
+		switch s.Status {
+		case StatusNotAffected:
+			if s.Justification == "" && s.ImpactStatement == "" {
+				errs = append(errs, fmt.Errorf("statement %d: not_affected requires a justification or an impact_statement", i))
+			}
+			if s.Justification != "" && !slices.Contains(Justifications, s.Justification) {
+				errs = append(errs, fmt.Errorf("statement %d: unknown justification %q", i, s.Justification))
+			}
+		case StatusAffected:
+			if s.ActionStatement == "" {
+				errs = append(errs, fmt.Errorf("statement %d: affected requires an action_statement", i))
+			}
+		case StatusFixed, StatusUnderInvestigation:
+		default:
+			errs = append(errs, fmt.Errorf("statement %d: unknown status %q", i, s.Status))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Image is a product statements can be bound to: an image or an index,
+// identified by its purl, and the purls of the packages it contains.
+type Image struct {
+	Purl     string
+	Packages []string
+}
+
+// Bind returns a document with the statements of docs which apply to any of
+// images, rewritten to have the images as their products and the packages the
+// statements named as their subcomponents, as OpenVEX tooling expects to match
+// them with scan results. A statement applies to an image if it names the
+// image itself, or any of its packages. Statements name packages with purls,
+// which match regardless of qualifiers they leave out, and of the version if
+// they leave it out.
+func Bind(docs []*Document, images []Image, timestamp time.Time) (*Document, error) {
+	out := &Document{
+		Context:    Context,
+		Author:     "apko",
+		Timestamp:  &timestamp,
+		Version:    1,
+		Tooling:    "apko",
+		Statements: []Statement{},
+	}
+	for _, doc := range docs {
+		if doc.Author != "" && out.Author == "apko" {
+			out.Author = doc.Author
+			out.Role = doc.Role
+		}
+		for _, s := range doc.Statements {
+			var products []Product
+			for _, img := range images {
+				p, ok, err := bindProduct(s, img)
+				if err != nil {
+					return nil, err
+				}
+				if ok {
+					products = append(products, p)
+				}
+			}
+			if len(products) == 0 {
+				continue
+			}
+			s.Products = products
+			if s.Timestamp == nil {
+				s.Timestamp = doc.Timestamp
+			}
+			out.Statements = append(out.Statements, s)
+		}
+	}
+
+	data, err := json.Marshal(out.Statements)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	out.ID = "https://openvex.dev/docs/public/apko-" + hex.EncodeToString(sum[:])
+	return out, nil
+}
+
+// bindProduct returns the product of s for img, and whether s applies to it.
+func bindProduct(s Statement, img Image) (Product, bool, error) {
+	product := Product{Component: Component{ID: img.Purl}}
+	applies := false
+	var names []Component
+	for _, p := range s.Products {
+		if slices.Contains(p.purls(), img.Purl) {
+			applies = true
+			product.Subcomponents = append(product.Subcomponents, p.Subcomponents...)
+			continue
+		}
+		names = append(names, p.Component)
+		names = append(names, p.Subcomponents...)
+	}
+	for _, c := range names {
+		for _, ref := range c.purls() {
+			for _, pkg := range img.Packages {
+				ok, err := matches(ref, pkg)
+				if err != nil {
+					return Product{}, false, err
+				}
+				if ok && !slices.ContainsFunc(product.Subcomponents, func(c Component) bool { return c.ID == pkg }) {
+					applies = true
+					product.Subcomponents = append(product.Subcomponents, Component{ID: pkg})
+				}
+			}
+		}
+	}
+	return product, applies, nil
+}
+
+// matches returns whether the purl of a statement names the purl of a package.
+func matches(ref, pkg string) (bool, error) {
+	want, err := purl.FromString(ref)
+	if err != nil {
+		// Products are not necessarily purls.
+		return false, nil
+	}
+	got, err := purl.FromString(pkg)
+	if err != nil {
+		return false, fmt.Errorf("parsing package purl %q: %w", pkg, err)
+	}
+	if want.Type != got.Type || want.Namespace != got.Namespace || want.Name != got.Name {
+		return false, nil
+	}
+	if want.Version != "" && want.Version != got.Version {
+		return false, nil
+	}
+	qualifiers := got.Qualifiers.Map()
+	for k, v := range want.Qualifiers.Map() {
+		if qualifiers[k] != v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// WriteFile writes doc to path.
+func (d *Document) WriteFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// purls are full of ampersands.
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(d)
+}
@@ -0,0 +1,179 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		statement Statement
+		wantErr   string
+	}{{
+		name: "not affected",
+		statement: Statement{
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        StatusNotAffected,
+			Justification: "vulnerable_code_not_present",
+		},
+	}, {
+		name: "not affected without justification",
+		statement: Statement{
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        StatusNotAffected,
+		},
+		wantErr: "not_affected requires a justification or an impact_statement",
+	}, {
+		name: "unknown justification",
+		statement: Statement{
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        StatusNotAffected,
+			Justification: "trust_me",
+		},
+		wantErr: `unknown justification "trust_me"`,
+	}, {
+		name: "affected without action",
+		statement: Statement{
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        StatusAffected,
+		},
+		wantErr: "affected requires an action_statement",
+	}, {
+		name: "no vulnerability or products",
+		statement: Statement{
+			Status: StatusFixed,
+		},
+		wantErr: "statement 0: missing vulnerability name\nstatement 0: no products",
+	}, {
+		name: "unknown status",
+		statement: Statement{
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        "fine",
+		},
+		wantErr: `unknown status "fine"`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := (&Document{Statements: []Statement{tc.statement}}).Validate()
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vex.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"statements": [{"vulnerability": {"name": "CVE-2024-0001"}, "products": [{"@id": "pkg:apk/wolfi/busybox"}], "status": "fixed"}]}`), 0o644))
+	doc, err := ParseFile(path)
+	require.NoError(t, err)
+	require.Len(t, doc.Statements, 1)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"statements": [{"status": "fixed"}]}`), 0o644))
+	_, err = ParseFile(path)
+	require.ErrorContains(t, err, "missing vulnerability name")
+}
+
+func TestBind(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	image := Image{
+		Purl: "pkg:oci/example@sha256%3Aaaaa?arch=amd64&os=linux",
+		Packages: []string{
+			"pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64",
+			"pkg:apk/wolfi/glibc@2.38-r1?arch=x86_64",
+		},
+	}
+	docs := []*Document{{
+		Author:    "Example Security",
+		Timestamp: &ts,
+		Statements: []Statement{{
+			// Any version, any arch.
+			Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox"}}},
+			Status:        StatusFixed,
+		}, {
+			// Not the installed version.
+			Vulnerability: Vulnerability{Name: "CVE-2024-0002"},
+			Products:      []Product{{Component: Component{ID: "pkg:apk/wolfi/busybox@1.35.0-r0"}}},
+			Status:        StatusFixed,
+		}, {
+			// Not the installed arch, or named by an identifier.
+			Vulnerability: Vulnerability{Name: "CVE-2024-0003"},
+			Products: []Product{
+				{Component: Component{ID: "pkg:apk/wolfi/glibc?arch=aarch64"}},
+				{Component: Component{ID: "glibc", Identifiers: map[string]string{"purl": "pkg:apk/wolfi/glibc@2.38-r1"}}},
+			},
+			Status:          StatusNotAffected,
+			ImpactStatement: "not reachable",
+		}, {
+			// The image itself.
+			Vulnerability: Vulnerability{Name: "CVE-2024-0004"},
+			Products: []Product{{
+				Component:     Component{ID: image.Purl},
+				Subcomponents: []Component{{ID: "pkg:golang/example.com/foo@v1.0.0"}},
+			}},
+			Status: StatusUnderInvestigation,
+		}},
+	}}
+
+	doc, err := Bind(docs, []Image{image}, ts)
+	require.NoError(t, err)
+	require.Equal(t, "Example Security", doc.Author)
+	require.Equal(t, Context, doc.Context)
+	require.Equal(t, []Statement{{
+		Vulnerability: Vulnerability{Name: "CVE-2024-0001"},
+		Timestamp:     &ts,
+		Products: []Product{{
+			Component:     Component{ID: image.Purl},
+			Subcomponents: []Component{{ID: "pkg:apk/wolfi/busybox@1.36.1-r0?arch=x86_64"}},
+		}},
+		Status: StatusFixed,
+	}, {
+		Vulnerability: Vulnerability{Name: "CVE-2024-0003"},
+		Timestamp:     &ts,
+		Products: []Product{{
+			Component:     Component{ID: image.Purl},
+			Subcomponents: []Component{{ID: "pkg:apk/wolfi/glibc@2.38-r1?arch=x86_64"}},
+		}},
+		Status:          StatusNotAffected,
+		ImpactStatement: "not reachable",
+	}, {
+		Vulnerability: Vulnerability{Name: "CVE-2024-0004"},
+		Timestamp:     &ts,
+		Products: []Product{{
+			Component:     Component{ID: image.Purl},
+			Subcomponents: []Component{{ID: "pkg:golang/example.com/foo@v1.0.0"}},
+		}},
+		Status: StatusUnderInvestigation,
+	}}, doc.Statements)
+
+	// The document is identified by its statements.
+	again, err := Bind(docs, []Image{image}, ts)
+	require.NoError(t, err)
+	require.Equal(t, doc.ID, again.ID)
+}